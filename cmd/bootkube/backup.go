@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/recovery"
+)
+
+var (
+	cmdBackup = &cobra.Command{
+		Use:          "backup",
+		Short:        "Continuously back up a self-hosted control plane",
+		Long:         "This command watches the control plane objects of the apiserver and the Secrets and ConfigMaps they mount, and writes them to the backup file whenever they change. `bootkube recover --backup` recovers the control plane from it. It is rendered as the control-plane-backup DaemonSet of the control plane nodes by `bootkube render --control-plane-backup-path`.",
+		PreRunE:      validateBackupOpts,
+		RunE:         runCmdBackup,
+		SilenceUsage: true,
+	}
+
+	backupOpts struct {
+		output         string
+		kubeConfigPath string
+		interval       time.Duration
+		selector       string
+		namespaces     string
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdBackup)
+	cmdBackup.Flags().StringVar(&backupOpts.output, "output", "", "Path of the backup file, which is replaced by every backup.")
+	cmdBackup.Flags().StringVar(&backupOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster. Defaults to the in-cluster configuration.")
+	cmdBackup.Flags().DurationVar(&backupOpts.interval, "interval", 30*time.Second, "Minimum interval between two backups, over which changes are written together.")
+	cmdBackup.Flags().StringVar(&backupOpts.selector, "selector", "", "Label selector of the DaemonSets and Deployments of the control plane to back up, like that of bootkube recover.")
+	cmdBackup.Flags().StringVar(&backupOpts.namespaces, "namespaces", "", "Namespaces to back up the control plane from besides kube-system, comma separated.")
+}
+
+func runCmdBackup(cmd *cobra.Command, args []string) error {
+	client, err := newKubeClient(backupOpts.kubeConfigPath)
+	if err != nil {
+		return err
+	}
+	var sel recovery.Selection
+	if backupOpts.selector != "" {
+		if sel.Selector, err = labels.Parse(backupOpts.selector); err != nil {
+			return err
+		}
+	}
+	if backupOpts.namespaces != "" {
+		sel.Namespaces = strings.Split(backupOpts.namespaces, ",")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	return recovery.NewBackupController(client, sel, backupOpts.output, backupOpts.interval).Run(ctx)
+}
+
+func validateBackupOpts(cmd *cobra.Command, args []string) error {
+	if backupOpts.output == "" {
+		return errors.New("missing required flag: --output")
+	}
+	if backupOpts.interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if _, err := labels.Parse(backupOpts.selector); err != nil {
+		return fmt.Errorf("invalid --selector: %v", err)
+	}
+	if backupOpts.namespaces != "" {
+		for _, ns := range strings.Split(backupOpts.namespaces, ",") {
+			if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+				return fmt.Errorf("invalid namespace %q in --namespaces: %s", ns, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
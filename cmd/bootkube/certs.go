@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+)
+
+var (
+	cmdCerts = &cobra.Command{
+		Use:   "certs",
+		Short: "Manage cluster credentials",
+	}
+
+	cmdCertsIssue = &cobra.Command{
+		Use:          "issue",
+		Short:        "Issue a short-lived client credential from the cluster CA",
+		Long:         "This command signs a short-lived client certificate for the given user and groups with the cluster CA and writes a kubeconfig using it to output-dir. If the CA private key is not available (external CA), a certificate signing request is written instead, to be signed out of band.",
+		PreRunE:      validateCertsIssueOpts,
+		RunE:         runCmdCertsIssue,
+		SilenceUsage: true,
+	}
+
+	certsIssueOpts struct {
+		assetDir   string
+		caCertPath string
+		caKeyPath  string
+		user       string
+		groups     []string
+		ttl        time.Duration
+		server     string
+		outputDir  string
+		externalCA bool
+		maxTTL     time.Duration
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdCerts)
+	cmdCerts.AddCommand(cmdCertsIssue)
+	cmdCertsIssue.Flags().StringVar(&certsIssueOpts.assetDir, "asset-dir", "", "Path to the rendered cluster assets. Used to locate the CA and apiserver URL when they are not set explicitly.")
+	cmdCertsIssue.Flags().StringVar(&certsIssueOpts.caCertPath, "ca-certificate-path", "", "Path to the PEM encoded cluster CA certificate. Defaults to tls/ca.crt in --asset-dir.")
+	cmdCertsIssue.Flags().StringVar(&certsIssueOpts.caKeyPath, "ca-private-key-path", "", "Path to the PEM encoded cluster CA private key. Defaults to tls/ca.key in --asset-dir.")
+	cmdCertsIssue.Flags().BoolVar(&certsIssueOpts.externalCA, "external-ca", false, "Write a certificate signing request instead of signing with the cluster CA.")
+	cmdCertsIssue.Flags().StringVar(&certsIssueOpts.user, "user", "", "User name (certificate common name) to issue the credential for.")
+	cmdCertsIssue.Flags().StringSliceVar(&certsIssueOpts.groups, "groups", nil, "Groups (certificate organizations) of the user, comma separated.")
+	cmdCertsIssue.Flags().DurationVar(&certsIssueOpts.ttl, "ttl", 2*time.Hour, "How long the issued certificate is valid for.")
+	cmdCertsIssue.Flags().DurationVar(&certsIssueOpts.maxTTL, "max-ttl", 24*time.Hour, "The maximum allowed value of --ttl.")
+	cmdCertsIssue.Flags().StringVar(&certsIssueOpts.server, "server", "", "URL of the apiserver written to the kubeconfig. Defaults to the server in auth/kubeconfig in --asset-dir.")
+	cmdCertsIssue.Flags().StringVar(&certsIssueOpts.outputDir, "output-dir", "", "Output path for the issued key, certificate (or CSR) and kubeconfig.")
+}
+
+func runCmdCertsIssue(cmd *cobra.Command, args []string) error {
+	caCertPath := certsIssueOpts.caCertPath
+	if caCertPath == "" {
+		caCertPath = filepath.Join(certsIssueOpts.assetDir, asset.AssetPathCACert)
+	}
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+	cfg := bootkube.CredentialConfig{
+		User:   certsIssueOpts.user,
+		Groups: certsIssueOpts.groups,
+		TTL:    certsIssueOpts.ttl,
+		Server: certsIssueOpts.server,
+		CACert: caCert,
+	}
+
+	if !certsIssueOpts.externalCA {
+		caKeyPath := certsIssueOpts.caKeyPath
+		if caKeyPath == "" {
+			caKeyPath = filepath.Join(certsIssueOpts.assetDir, asset.AssetPathCAKey)
+		}
+		if cfg.CAKey, err = ioutil.ReadFile(caKeyPath); err != nil {
+			return fmt.Errorf("failed to read CA private key (use --external-ca if the CA key is not available): %v", err)
+		}
+		if cfg.Server == "" {
+			if cfg.Server, err = bootkube.ServerFromKubeConfig(filepath.Join(certsIssueOpts.assetDir, asset.AssetPathAdminKubeConfig)); err != nil {
+				return fmt.Errorf("failed to determine apiserver URL (use --server): %v", err)
+			}
+		}
+	}
+
+	cred, err := bootkube.IssueCredential(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(certsIssueOpts.outputDir, 0700); err != nil {
+		return err
+	}
+	base := filepath.Join(certsIssueOpts.outputDir, certsIssueOpts.user)
+	files := map[string][]byte{base + ".key": cred.PrivateKey}
+	if cred.CSR != nil {
+		files[base+".csr"] = cred.CSR
+	} else {
+		files[base+".crt"] = cred.Certificate
+		files[filepath.Join(certsIssueOpts.outputDir, "kubeconfig")] = cred.KubeConfig
+	}
+	for path, data := range files {
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+	}
+
+	if cred.CSR != nil {
+		bootkube.UserOutput("Wrote certificate signing request for user %q to %s.csr. Sign it with the external CA using a validity of at most %s.\n", certsIssueOpts.user, base, certsIssueOpts.ttl)
+		return nil
+	}
+	// This line is the audit record of the issuance: the serial number and subject can be matched
+	// against the apiserver audit log.
+	bootkube.UserOutput("Issued client certificate for user %q groups %q with serial number %s, valid until %s. Kubeconfig written to %s\n",
+		certsIssueOpts.user, strings.Join(certsIssueOpts.groups, ","), cred.SerialNumber, cred.NotAfter.Format(time.RFC3339), filepath.Join(certsIssueOpts.outputDir, "kubeconfig"))
+	return nil
+}
+
+func validateCertsIssueOpts(cmd *cobra.Command, args []string) error {
+	if certsIssueOpts.user == "" {
+		return errors.New("missing required flag: --user")
+	}
+	if certsIssueOpts.outputDir == "" {
+		return errors.New("missing required flag: --output-dir")
+	}
+	if certsIssueOpts.assetDir == "" && certsIssueOpts.caCertPath == "" {
+		return errors.New("missing required flag: --asset-dir or --ca-certificate-path")
+	}
+	if !certsIssueOpts.externalCA && certsIssueOpts.assetDir == "" && (certsIssueOpts.caKeyPath == "" || certsIssueOpts.server == "") {
+		return errors.New("--ca-private-key-path and --server are required when --asset-dir is not set")
+	}
+	if certsIssueOpts.ttl <= 0 {
+		return errors.New("--ttl must be positive")
+	}
+	if certsIssueOpts.ttl > certsIssueOpts.maxTTL {
+		return fmt.Errorf("--ttl %s exceeds --max-ttl %s", certsIssueOpts.ttl, certsIssueOpts.maxTTL)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+)
+
+var (
+	cmdDiff = &cobra.Command{
+		Use:          "diff",
+		Short:        "Compare the rendered assets with a running cluster",
+		Long:         "Dry-runs the manifests in asset-dir against the cluster and prints the objects that would be created and the fields that would change, e.g. to preview re-applying the assets of an upgrade render.",
+		PreRunE:      validateDiffOpts,
+		RunE:         runCmdDiff,
+		SilenceUsage: true,
+	}
+
+	diffOpts struct {
+		assetDir       string
+		kubeConfigPath string
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdDiff)
+	cmdDiff.Flags().StringVar(&diffOpts.assetDir, "asset-dir", "", "Path to the cluster asset directory to compare.")
+	cmdDiff.Flags().StringVar(&diffOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster. Defaults to the admin kubeconfig in asset-dir.")
+}
+
+func runCmdDiff(cmd *cobra.Command, args []string) error {
+	kubeConfigPath := diffOpts.kubeConfigPath
+	if kubeConfigPath == "" {
+		kubeConfigPath = filepath.Join(diffOpts.assetDir, asset.AssetPathAdminKubeConfig)
+	}
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+		&clientcmd.ConfigOverrides{})
+	return bootkube.DiffCluster(kubeConfig, diffOpts.assetDir, os.Stdout)
+}
+
+func validateDiffOpts(cmd *cobra.Command, args []string) error {
+	if diffOpts.assetDir == "" {
+		return errors.New("missing required flag: --asset-dir")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+)
+
+var (
+	cmdRotateEncryptionKey = &cobra.Command{
+		Use:   "rotate-encryption-key",
+		Short: "Rotate the key secrets are encrypted at rest with",
+		Long: "This command rotates the encryption at rest key of a cluster rendered with --encryption-provider in three steps: " +
+			"without flags it adds a new key, with --promote it makes the new key the one secrets are encrypted with, and with --prune " +
+			"it removes the old keys. Each step updates the asset directory and prints how to roll it out.",
+		PreRunE:      validateRotateEncryptionKeyOpts,
+		RunE:         runCmdRotateEncryptionKey,
+		SilenceUsage: true,
+	}
+
+	rotateEncryptionKeyOpts struct {
+		assetDir string
+		promote  bool
+		prune    bool
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdRotateEncryptionKey)
+	cmdRotateEncryptionKey.Flags().StringVar(&rotateEncryptionKeyOpts.assetDir, "asset-dir", "", "Path to the cluster asset directory.")
+	cmdRotateEncryptionKey.Flags().BoolVar(&rotateEncryptionKeyOpts.promote, "promote", false, "Encrypt new secrets with the added key. Run once the added key is rolled out to all apiservers.")
+	cmdRotateEncryptionKey.Flags().BoolVar(&rotateEncryptionKeyOpts.prune, "prune", false, "Remove the old keys. Run once all secrets are re-encrypted with the new key.")
+}
+
+func runCmdRotateEncryptionKey(cmd *cobra.Command, args []string) error {
+	secretManifest := filepath.Join(rotateEncryptionKeyOpts.assetDir, asset.AssetPathAPIServerSecret)
+	namespace := bootkube.ControlPlaneNamespace(rotateEncryptionKeyOpts.assetDir)
+	rollout := "Roll out the change to all apiservers:\n\n" +
+		"  kubectl apply -f " + secretManifest + "\n" +
+		"  kubectl -n " + namespace + " rollout restart daemonset/kube-apiserver\n" +
+		"  kubectl -n " + namespace + " rollout status daemonset/kube-apiserver\n\n"
+	if bootkube.IsStaticControlPlane(rotateEncryptionKeyOpts.assetDir) {
+		rollout = "Roll out the change to all apiservers: copy " +
+			filepath.Join(rotateEncryptionKeyOpts.assetDir, asset.AssetPathEncryptionConfig) + " to " + asset.StaticSecretsDir +
+			" on every master node, then restart the kube-apiserver static pod, e.g. by moving its manifest out of the pod manifest directory and back.\n\n"
+	}
+
+	switch {
+	case rotateEncryptionKeyOpts.promote:
+		name, err := bootkube.PromoteEncryptionKey(rotateEncryptionKeyOpts.assetDir)
+		if err != nil {
+			return err
+		}
+		bootkube.UserOutput("New secrets will be encrypted with %s. %s", name, rollout)
+		bootkube.UserOutput("Then re-encrypt all secrets with the new key:\n\n"+
+			"  kubectl get secrets --all-namespaces -o json | kubectl replace -f -\n\n"+
+			"and remove the old keys with: bootkube rotate-encryption-key --prune --asset-dir=%s\n", rotateEncryptionKeyOpts.assetDir)
+	case rotateEncryptionKeyOpts.prune:
+		pruned, err := bootkube.PruneEncryptionKeys(rotateEncryptionKeyOpts.assetDir)
+		if err != nil {
+			return err
+		}
+		if len(pruned) == 0 {
+			bootkube.UserOutput("There are no old keys to remove.\n")
+			return nil
+		}
+		bootkube.UserOutput("Removed %s. %s", strings.Join(pruned, ", "), rollout)
+	default:
+		name, err := bootkube.AddEncryptionKey(rotateEncryptionKeyOpts.assetDir)
+		if err != nil {
+			return err
+		}
+		bootkube.UserOutput("Added %s. %s", name, rollout)
+		bootkube.UserOutput("Then encrypt new secrets with it: bootkube rotate-encryption-key --promote --asset-dir=%s\n", rotateEncryptionKeyOpts.assetDir)
+	}
+	return nil
+}
+
+func validateRotateEncryptionKeyOpts(cmd *cobra.Command, args []string) error {
+	if rotateEncryptionKeyOpts.assetDir == "" {
+		return errors.New("missing required flag: --asset-dir")
+	}
+	if rotateEncryptionKeyOpts.promote && rotateEncryptionKeyOpts.prune {
+		return errors.New("--promote and --prune are mutually exclusive")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+	"github.com/kubernetes-sigs/bootkube/pkg/version"
+)
+
+var (
+	cmdHistory = &cobra.Command{
+		Use:          "history",
+		Short:        "List the bootkube operations recorded in the cluster",
+		Long:         "This command lists the bootkube operations (start, recover, rollback) that were recorded in the cluster, along with who performed them, when, and the hash of the asset directory that was used.",
+		PreRunE:      validateHistoryOpts,
+		RunE:         runCmdHistory,
+		SilenceUsage: true,
+	}
+
+	cmdRollback = &cobra.Command{
+		Use:          "rollback",
+		Short:        "Restore the rendered manifests of a previous revision",
+		Long:         "This command writes the manifests that were snapshotted for a revision listed by `bootkube history` into asset-dir, so they can be re-applied to the cluster.",
+		PreRunE:      validateRollbackOpts,
+		RunE:         runCmdRollback,
+		SilenceUsage: true,
+	}
+
+	historyOpts struct {
+		kubeConfigPath string
+	}
+
+	rollbackOpts struct {
+		kubeConfigPath string
+		assetDir       string
+		revision       int
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdHistory)
+	cmdHistory.Flags().StringVar(&historyOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster.")
+
+	cmdRoot.AddCommand(cmdRollback)
+	cmdRollback.Flags().StringVar(&rollbackOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster.")
+	cmdRollback.Flags().StringVar(&rollbackOpts.assetDir, "asset-dir", "", "Output path for the restored manifests.")
+	cmdRollback.Flags().IntVar(&rollbackOpts.revision, "to", 0, "The history revision to restore.")
+}
+
+func runCmdHistory(cmd *cobra.Command, args []string) error {
+	client, err := newKubeClient(historyOpts.kubeConfigPath)
+	if err != nil {
+		return err
+	}
+	entries, err := bootkube.ListHistory(client)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tOPERATION\tUSER\tTIMESTAMP\tFROM\tTO\tASSET HASH")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Revision, e.Operation, e.User, e.Timestamp.Format(time.RFC3339), e.FromVersion, e.ToVersion, e.AssetHash)
+	}
+	return w.Flush()
+}
+
+func runCmdRollback(cmd *cobra.Command, args []string) error {
+	client, err := newKubeClient(rollbackOpts.kubeConfigPath)
+	if err != nil {
+		return err
+	}
+	if err := bootkube.RestoreRevision(client, rollbackOpts.revision, rollbackOpts.assetDir); err != nil {
+		return err
+	}
+	entry, err := bootkube.RecordHistory(client, bootkube.HistoryEntry{Operation: bootkube.OperationRollback, ToVersion: version.Version}, rollbackOpts.assetDir)
+	if err != nil {
+		return err
+	}
+	bootkube.UserOutput("Restored revision %d to %s (recorded as revision %d). Re-apply with: kubectl apply -R -f %s\n", rollbackOpts.revision, rollbackOpts.assetDir, entry.Revision, rollbackOpts.assetDir)
+	return nil
+}
+
+func validateHistoryOpts(cmd *cobra.Command, args []string) error {
+	if historyOpts.kubeConfigPath == "" {
+		return errors.New("missing required flag: --kubeconfig")
+	}
+	return nil
+}
+
+func validateRollbackOpts(cmd *cobra.Command, args []string) error {
+	if rollbackOpts.kubeConfigPath == "" {
+		return errors.New("missing required flag: --kubeconfig")
+	}
+	if rollbackOpts.assetDir == "" {
+		return errors.New("missing required flag: --asset-dir")
+	}
+	if rollbackOpts.revision <= 0 {
+		return errors.New("missing required flag: --to")
+	}
+	return nil
+}
+
+func newKubeClient(kubeConfigPath string) (kubernetes.Interface, error) {
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+		&clientcmd.ConfigOverrides{})
+	config, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+)
+
+var (
+	cmdNetwork = &cobra.Command{
+		Use:   "network",
+		Short: "Manage the network provider of a cluster",
+	}
+
+	cmdNetworkMigrate = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate a flannel cluster to another network provider",
+		Long: "This command deploys the network provider given with --to and moves the nodes of a flannel cluster to it one at a time: " +
+			"each node is cordoned and drained, switched to the new network provider, checked for pod connectivity and uncordoned. " +
+			"flannel is removed once all nodes are migrated and the manifests in asset-dir are updated. An interrupted migration " +
+			"is resumed by running the command again.",
+		PreRunE:      validateNetworkMigrateOpts,
+		RunE:         runCmdNetworkMigrate,
+		SilenceUsage: true,
+	}
+
+	networkMigrateOpts struct {
+		assetDir       string
+		kubeConfigPath string
+		to             string
+		timeout        time.Duration
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdNetwork)
+	cmdNetwork.AddCommand(cmdNetworkMigrate)
+	cmdNetworkMigrate.Flags().StringVar(&networkMigrateOpts.assetDir, "asset-dir", "", "Path to the cluster asset directory. Its flannel manifests are replaced once the migration completes.")
+	cmdNetworkMigrate.Flags().StringVar(&networkMigrateOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster. Defaults to the admin kubeconfig in asset-dir.")
+	cmdNetworkMigrate.Flags().StringVar(&networkMigrateOpts.to, "to", "", fmt.Sprintf("The network provider to migrate to (%s).", strings.Join(bootkube.NetworkMigrationTargets, ", ")))
+	cmdNetworkMigrate.Flags().DurationVar(&networkMigrateOpts.timeout, "timeout", 10*time.Minute, "Timeout of each step of migrating a node, such as draining it or waiting for the new network provider.")
+}
+
+func runCmdNetworkMigrate(cmd *cobra.Command, args []string) error {
+	kubeConfigPath := networkMigrateOpts.kubeConfigPath
+	if kubeConfigPath == "" {
+		kubeConfigPath = filepath.Join(networkMigrateOpts.assetDir, asset.AssetPathAdminKubeConfig)
+	}
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+		&clientcmd.ConfigOverrides{})
+	return bootkube.MigrateNetwork(kubeConfig, bootkube.NetworkMigrationConfig{
+		AssetDir: networkMigrateOpts.assetDir,
+		To:       networkMigrateOpts.to,
+		Timeout:  networkMigrateOpts.timeout,
+	})
+}
+
+func validateNetworkMigrateOpts(cmd *cobra.Command, args []string) error {
+	if networkMigrateOpts.assetDir == "" {
+		return errors.New("missing required flag: --asset-dir")
+	}
+	if networkMigrateOpts.to == "" {
+		return errors.New("missing required flag: --to")
+	}
+	if networkMigrateOpts.timeout <= 0 {
+		return errors.New("--timeout must be positive")
+	}
+	return nil
+}
@@ -7,15 +7,22 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
 	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
 	"github.com/kubernetes-sigs/bootkube/pkg/recovery"
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+	"github.com/kubernetes-sigs/bootkube/pkg/version"
 
 	"github.com/spf13/cobra"
 	"go.etcd.io/etcd/clientv3"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 var (
@@ -33,10 +40,26 @@ var (
 		etcdCAPath          string
 		etcdCertificatePath string
 		etcdPrivateKeyPath  string
+		etcdUsername        string
+		etcdPasswordFile    string
 		etcdServers         string
+		apiServerManifest   string
 		etcdPrefix          string
+		etcdSnapshot        string
+		etcdSnapshotTimeout time.Duration
+		etcdDataDir         string
+		backup              string
+		manifestDir         string
+		seedEtcd            bool
+		seedEtcdServiceIP   string
+		dryRun              bool
+		verify              bool
+		selector            string
+		namespaces          string
 		kubeConfigPath      string
 		podManifestPath     string
+		caCertPath          string
+		caKeyPath           string
 	}
 )
 
@@ -46,10 +69,26 @@ func init() {
 	cmdRecover.Flags().StringVar(&recoverOpts.etcdCAPath, "etcd-ca-path", "", "Path to an existing PEM encoded CA that will be used for TLS-enabled communication between the apiserver and etcd. Must be used in conjunction with --etcd-certificate-path and --etcd-private-key-path, and must have etcd configured to use TLS with matching secrets.")
 	cmdRecover.Flags().StringVar(&recoverOpts.etcdCertificatePath, "etcd-certificate-path", "", "Path to an existing certificate that will be used for TLS-enabled communication between the apiserver and etcd. Must be used in conjunction with --etcd-ca-path and --etcd-private-key-path, and must have etcd configured to use TLS with matching secrets.")
 	cmdRecover.Flags().StringVar(&recoverOpts.etcdPrivateKeyPath, "etcd-private-key-path", "", "Path to an existing private key that will be used for TLS-enabled communication between the apiserver and etcd. Must be used in conjunction with --etcd-ca-path and --etcd-certificate-path, and must have etcd configured to use TLS with matching secrets.")
+	cmdRecover.Flags().StringVar(&recoverOpts.etcdUsername, "etcd-username", "", "Username of etcd role-based access control for --etcd-servers.")
+	cmdRecover.Flags().StringVar(&recoverOpts.etcdPasswordFile, "etcd-password-file", "", "Path to a file holding the password of --etcd-username.")
 	cmdRecover.Flags().StringVar(&recoverOpts.etcdServers, "etcd-servers", "", "List of etcd server URLs including host:port, comma separated.")
+	cmdRecover.Flags().StringVar(&recoverOpts.apiServerManifest, "apiserver-manifest", "", "Path to a kube-apiserver manifest, such as its checkpoint in --pod-manifest-path or the bootstrap-manifests/bootstrap-apiserver.yaml of an earlier recovery, to read the etcd servers and prefix from instead of --etcd-servers and --etcd-prefix. Its etcd client TLS files are used unless set, if mounted from the host.")
 	cmdRecover.Flags().StringVar(&recoverOpts.etcdPrefix, "etcd-prefix", "/registry", "Path prefix to Kubernetes cluster data in etcd.")
+	cmdRecover.Flags().StringVar(&recoverOpts.etcdSnapshot, "etcd-snapshot", "", "Path to an etcd snapshot, as saved by etcdctl snapshot save, to recover from when no etcd or apiserver is running. It is restored into a temporary etcd started as a static pod in --pod-manifest-path.")
+	cmdRecover.Flags().DurationVar(&recoverOpts.etcdSnapshotTimeout, "etcd-snapshot-timeout", 5*time.Minute, "Timeout for the temporary etcd of --etcd-snapshot to start.")
+	cmdRecover.Flags().StringVar(&recoverOpts.etcdDataDir, "etcd-data-dir", "", "Path to the data dir of a stopped etcd member to recover from like an --etcd-snapshot, e.g. of the last member of a self-hosted etcd cluster that lost its quorum.")
+	cmdRecover.Flags().StringVar(&recoverOpts.backup, "backup", "", "Path to a control plane backup written by bootkube backup to recover from, e.g. copied from a control plane node when no etcd or apiserver is running.")
+	cmdRecover.Flags().StringVar(&recoverOpts.manifestDir, "manifest-dir", "", "Path to a directory of exported objects to recover from, such as the YAML of kubectl get -o yaml or the JSON of a velero backup, when no etcd or apiserver is reachable.")
+	cmdRecover.Flags().BoolVar(&recoverOpts.seedEtcd, "seed-etcd", false, "Also recover a self-hosted etcd cluster that lost its quorum from --etcd-snapshot or --etcd-data-dir: bootkube start runs a single boot-etcd member restored from it, which the etcd-operator scales the cluster back out from.")
+	cmdRecover.Flags().StringVar(&recoverOpts.seedEtcdServiceIP, "bootstrap-etcd-service-ip", "10.3.0.20", "Cluster IP of the service of the boot-etcd member of --seed-etcd, in the service CIDR of the cluster.")
+	cmdRecover.Flags().BoolVar(&recoverOpts.dryRun, "dry-run", false, "Print the objects found in the recovery source, the assets that would be written and the required objects that are missing, without writing to --recovery-dir. An --etcd-snapshot or --etcd-data-dir is still read through a temporary etcd.")
+	cmdRecover.Flags().BoolVar(&recoverOpts.verify, "verify", false, "After writing --recovery-dir, check it like bootkube validate, that the bootstrap pods mount and use recovered secrets, and that their etcd servers resolve and serve certificates of the recovered etcd CA. Fails on errors, before booting from a broken recovery.")
+	cmdRecover.Flags().StringVar(&recoverOpts.selector, "selector", "", "Label selector of the DaemonSets and Deployments of the control plane to recover, e.g. tier=control-plane for renamed components. By default those with the k8s-app label kube-apiserver, kube-controller-manager or kube-scheduler.")
+	cmdRecover.Flags().StringVar(&recoverOpts.namespaces, "namespaces", "", "Namespaces to recover the control plane from besides kube-system, comma separated, e.g. a custom control plane namespace.")
 	cmdRecover.Flags().StringVar(&recoverOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster.")
-	cmdRecover.Flags().StringVar(&recoverOpts.podManifestPath, "pod-manifest-path", "/etc/kubernetes/manifests", "The location where the kubelet is configured to look for static pod manifests. (Only need to be set when recovering from a etcd backup file)")
+	cmdRecover.Flags().StringVar(&recoverOpts.podManifestPath, "pod-manifest-path", "/etc/kubernetes/manifests", "The location where the kubelet is configured to look for static pod manifests. (Only need to be set when recovering from an etcd snapshot)")
+	cmdRecover.Flags().StringVar(&recoverOpts.caCertPath, "ca-cert-path", "", "Path to the PEM encoded CA certificate renewing the expired certificates of the recovered control plane. Defaults to the recovered tls/ca.crt.")
+	cmdRecover.Flags().StringVar(&recoverOpts.caKeyPath, "ca-key-path", "", "Path to the PEM encoded private key of the CA renewing the expired certificates of the recovered control plane. Defaults to the recovered tls/ca.key.")
 }
 
 func runCmdRecover(cmd *cobra.Command, args []string) error {
@@ -59,14 +98,73 @@ func runCmdRecover(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if recoverOpts.apiServerManifest != "" {
+		if err := discoverEtcd(cmd, recoverOpts.apiServerManifest); err != nil {
+			return err
+		}
+	}
+
+	snapshot := recoverOpts.etcdSnapshot
+	if recoverOpts.etcdDataDir != "" {
+		snapshot = recovery.SnapshotFromDataDir(recoverOpts.etcdDataDir)
+	}
+	if snapshot != "" {
+		if snapshot, err = filepath.Abs(snapshot); err != nil {
+			return err
+		}
+	}
+
 	var backend recovery.Backend
 	switch {
+	case snapshot != "":
+		bootkube.UserOutput("Attempting recovery using etcd snapshot at %q...\n", snapshot)
+		if err := recovery.StartRecoveryEtcdForBackup(recoverOpts.podManifestPath, snapshot); err != nil {
+			return err
+		}
+		defer func() {
+			if err := recovery.CleanRecoveryEtcd(recoverOpts.podManifestPath); err != nil {
+				bootkube.UserWarning("failed to remove the recovery etcd from %s: %v\n", recoverOpts.podManifestPath, err)
+			}
+		}()
+		bootkube.UserOutput("Waiting for the recovery etcd to start...\n")
+		ctx, cancel := context.WithTimeout(context.Background(), recoverOpts.etcdSnapshotTimeout)
+		defer cancel()
+		etcdClient, err := recovery.WaitForRecoveryEtcd(ctx)
+		if err != nil {
+			return err
+		}
+		defer etcdClient.Close()
+		backend = recovery.NewEtcdBackend(etcdClient, recoverOpts.etcdPrefix)
+
+	case recoverOpts.backup != "":
+		bootkube.UserOutput("Attempting recovery using the control plane backup at %q...\n", recoverOpts.backup)
+		backend = recovery.NewBackupBackend(recoverOpts.backup)
+
+	case recoverOpts.manifestDir != "":
+		bootkube.UserOutput("Attempting recovery using the manifests in %q...\n", recoverOpts.manifestDir)
+		backend = recovery.NewManifestDirBackend(recoverOpts.manifestDir)
+
 	case recoverOpts.etcdServers != "":
 		bootkube.UserOutput("Attempting recovery using etcd cluster at %q...\n", recoverOpts.etcdServers)
-		etcdClient, err := createEtcdClient()
+		cfg, err := newEtcdClientConfig(recoverOpts.etcdServers, recoverOpts.etcdCAPath, recoverOpts.etcdCertificatePath, recoverOpts.etcdPrivateKeyPath)
+		if err != nil {
+			return err
+		}
+		if recoverOpts.etcdUsername != "" {
+			cfg.Username = recoverOpts.etcdUsername
+			if recoverOpts.etcdPasswordFile != "" {
+				password, err := ioutil.ReadFile(recoverOpts.etcdPasswordFile)
+				if err != nil {
+					return err
+				}
+				cfg.Password = strings.TrimSpace(string(password))
+			}
+		}
+		etcdClient, err := clientv3.New(cfg)
 		if err != nil {
 			return err
 		}
+		defer etcdClient.Close()
 		backend = recovery.NewEtcdBackend(etcdClient, recoverOpts.etcdPrefix)
 
 	default:
@@ -77,20 +175,255 @@ func runCmdRecover(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	as, err := recovery.Recover(context.Background(), backend, recoverOpts.kubeConfigPath)
+	var sel recovery.Selection
+	if recoverOpts.selector != "" {
+		if sel.Selector, err = labels.Parse(recoverOpts.selector); err != nil {
+			return err
+		}
+	}
+	if recoverOpts.namespaces != "" {
+		sel.Namespaces = strings.Split(recoverOpts.namespaces, ",")
+	}
+	var seed *recovery.SeedEtcdConfig
+	if recoverOpts.seedEtcd {
+		seed = &recovery.SeedEtcdConfig{
+			Snapshot:  snapshot,
+			ServiceIP: net.ParseIP(recoverOpts.seedEtcdServiceIP),
+		}
+	}
+	if recoverOpts.dryRun {
+		plan, err := recovery.PlanRecover(context.Background(), backend, recoverOpts.kubeConfigPath, sel, seed)
+		if err != nil {
+			return err
+		}
+		printRecoveryPlan(plan)
+		if len(plan.Missing) > 0 {
+			return fmt.Errorf("%d required objects are missing, the recovery would fail", len(plan.Missing))
+		}
+		return nil
+	}
+
+	var as asset.Assets
+	if seed != nil {
+		as, err = recovery.RecoverSeedEtcd(context.Background(), backend, recoverOpts.kubeConfigPath, sel, *seed)
+	} else {
+		as, err = recovery.Recover(context.Background(), backend, recoverOpts.kubeConfigPath, sel)
+	}
 	if err != nil {
 		return err
 	}
-	return as.WriteFiles(recoverOpts.recoveryDir)
+	if err := renewExpiredCerts(as); err != nil {
+		return err
+	}
+	if err := as.WriteFiles(recoverOpts.recoveryDir); err != nil {
+		return err
+	}
+	if recoverOpts.verify {
+		bootkube.UserOutput("Verifying the recovered assets...\n")
+		findings, err := bootkube.ValidateRecoveredAssets(recoverOpts.recoveryDir, "")
+		if err != nil {
+			return err
+		}
+		for _, f := range findings {
+			bootkube.UserOutput("%s\n", f)
+		}
+		if err := findingErrors(findings); err != nil {
+			return fmt.Errorf("the recovered assets in %s are not usable: %v", recoverOpts.recoveryDir, err)
+		}
+	}
+
+	// The apiserver is only known to be reachable when it was used as the recovery source.
+	if recoverOpts.etcdServers == "" && snapshot == "" && recoverOpts.backup == "" && recoverOpts.manifestDir == "" {
+		client, err := newKubeClient(recoverOpts.kubeConfigPath)
+		if err == nil {
+			_, err = bootkube.RecordHistory(client, bootkube.HistoryEntry{Operation: bootkube.OperationRecover, ToVersion: version.Version}, recoverOpts.recoveryDir)
+		}
+		if err != nil {
+			bootkube.UserWarning("failed to record bootkube history: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// printRecoveryPlan prints what recover would do.
+func printRecoveryPlan(plan *recovery.Plan) {
+	written := "Would write"
+	if recoverOpts.recoveryDir != "" {
+		written += " to " + recoverOpts.recoveryDir
+	}
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"Found in the recovery source", plan.Found},
+		{written, plan.Assets},
+		{"Missing", plan.Missing},
+		{"Expired certificates", plan.Expired},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		bootkube.UserOutput("%s:\n", section.title)
+		for _, item := range section.items {
+			bootkube.UserOutput("  %s\n", item)
+		}
+	}
+}
+
+// discoverEtcd sets the etcd servers and prefix, and the etcd client TLS files unless set, to
+// those of the kube-apiserver manifest at p.
+func discoverEtcd(cmd *cobra.Command, p string) error {
+	cfg, err := recovery.EtcdConfigFromManifest(p)
+	if err != nil {
+		return err
+	}
+	recoverOpts.etcdServers = strings.Join(cfg.Servers, ",")
+	if cfg.Prefix != "" && !cmd.Flags().Changed("etcd-prefix") {
+		recoverOpts.etcdPrefix = cfg.Prefix
+	}
+	if recoverOpts.etcdCAPath == "" {
+		recoverOpts.etcdCAPath = cfg.CAFile
+	}
+	if recoverOpts.etcdCertificatePath == "" && recoverOpts.etcdPrivateKeyPath == "" && cfg.CertFile != "" && cfg.KeyFile != "" {
+		recoverOpts.etcdCertificatePath, recoverOpts.etcdPrivateKeyPath = cfg.CertFile, cfg.KeyFile
+	}
+	bootkube.UserOutput("Discovered etcd servers %q with prefix %q in %s\n", recoverOpts.etcdServers, recoverOpts.etcdPrefix, p)
+	return nil
+}
+
+// renewExpiredCerts renews the expired certificates of the recovered assets, which would fail the
+// TLS handshakes of the recovered control plane, with the CA of --ca-cert-path and --ca-key-path or
+// the recovered one.
+func renewExpiredCerts(as asset.Assets) error {
+	now := time.Now()
+	expired := recovery.ExpiredCerts(as, now)
+	if len(expired) == 0 {
+		return nil
+	}
+	var caCertPEM, caKeyPEM []byte
+	if a, err := as.Get(asset.AssetPathCACert); err == nil {
+		caCertPEM = a.Data
+	}
+	if a, err := as.Get(asset.AssetPathCAKey); err == nil {
+		caKeyPEM = a.Data
+	}
+	var err error
+	if recoverOpts.caCertPath != "" {
+		if caCertPEM, err = ioutil.ReadFile(recoverOpts.caCertPath); err != nil {
+			return err
+		}
+	}
+	if recoverOpts.caKeyPath != "" {
+		if caKeyPEM, err = ioutil.ReadFile(recoverOpts.caKeyPath); err != nil {
+			return err
+		}
+	}
+	if caCertPEM == nil || caKeyPEM == nil {
+		bootkube.UserWarning("the recovered certificates %s expired, set --ca-cert-path and --ca-key-path to renew them\n", strings.Join(expired, ", "))
+		return nil
+	}
+	caCert, err := tlsutil.ParsePEMEncodedCACert(caCertPEM)
+	if err != nil {
+		return fmt.Errorf("invalid CA certificate: %v", err)
+	}
+	caKey, err := tlsutil.ParsePEMEncodedPrivateKey(caKeyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid CA private key: %v", err)
+	}
+	renewed, notRenewed, err := recovery.RenewExpiredCerts(as, caCert, caKey, now)
+	if err != nil {
+		return err
+	}
+	for _, name := range renewed {
+		bootkube.UserOutput("Renewed the expired certificate %s\n", name)
+	}
+	if len(notRenewed) > 0 {
+		bootkube.UserWarning("the recovered certificates %s expired but are not signed by the CA, renew them manually\n", strings.Join(notRenewed, ", "))
+	}
+	return nil
 }
 
 func validateRecoverOpts(cmd *cobra.Command, args []string) error {
-	if recoverOpts.recoveryDir == "" {
+	if recoverOpts.recoveryDir == "" && !recoverOpts.dryRun {
 		return errors.New("missing required flag: --recovery-dir")
 	}
+	if recoverOpts.verify && recoverOpts.dryRun {
+		return errors.New("--verify can't be set with --dry-run, which writes no assets")
+	}
 	if (recoverOpts.etcdCertificatePath != "" || recoverOpts.etcdPrivateKeyPath != "") && (recoverOpts.etcdCertificatePath == "" || recoverOpts.etcdPrivateKeyPath == "") {
 		return errors.New("you must specify both --etcd-certificate-path, and --etcd-private-key-path")
 	}
+	if recoverOpts.etcdSnapshot != "" && recoverOpts.etcdDataDir != "" {
+		return errors.New("only one of --etcd-snapshot and --etcd-data-dir can be set")
+	}
+	if recoverOpts.etcdSnapshot != "" || recoverOpts.etcdDataDir != "" {
+		if recoverOpts.etcdServers != "" {
+			return errors.New("--etcd-servers can't be set with --etcd-snapshot or --etcd-data-dir")
+		}
+		if recoverOpts.etcdSnapshot != "" {
+			if _, err := os.Stat(recoverOpts.etcdSnapshot); err != nil {
+				return fmt.Errorf("invalid --etcd-snapshot: %v", err)
+			}
+		} else if _, err := os.Stat(recovery.SnapshotFromDataDir(recoverOpts.etcdDataDir)); err != nil {
+			return fmt.Errorf("invalid --etcd-data-dir: %v", err)
+		}
+		if recoverOpts.etcdSnapshotTimeout <= 0 {
+			return errors.New("--etcd-snapshot-timeout must be positive")
+		}
+	}
+	if recoverOpts.apiServerManifest != "" {
+		if recoverOpts.etcdServers != "" || recoverOpts.etcdSnapshot != "" || recoverOpts.etcdDataDir != "" {
+			return errors.New("--apiserver-manifest can't be set with --etcd-servers, --etcd-snapshot or --etcd-data-dir")
+		}
+		if _, err := os.Stat(recoverOpts.apiServerManifest); err != nil {
+			return fmt.Errorf("invalid --apiserver-manifest: %v", err)
+		}
+	}
+	if recoverOpts.etcdUsername != "" && recoverOpts.etcdServers == "" && recoverOpts.apiServerManifest == "" {
+		return errors.New("--etcd-username requires --etcd-servers or --apiserver-manifest")
+	}
+	if recoverOpts.etcdPasswordFile != "" && recoverOpts.etcdUsername == "" {
+		return errors.New("--etcd-password-file requires --etcd-username")
+	}
+	if recoverOpts.backup != "" {
+		if recoverOpts.etcdServers != "" || recoverOpts.apiServerManifest != "" || recoverOpts.etcdSnapshot != "" || recoverOpts.etcdDataDir != "" {
+			return errors.New("--backup can't be set with --etcd-servers, --apiserver-manifest, --etcd-snapshot or --etcd-data-dir")
+		}
+		if _, err := os.Stat(recoverOpts.backup); err != nil {
+			return fmt.Errorf("invalid --backup: %v", err)
+		}
+	}
+	if recoverOpts.manifestDir != "" {
+		if recoverOpts.backup != "" || recoverOpts.etcdServers != "" || recoverOpts.apiServerManifest != "" || recoverOpts.etcdSnapshot != "" || recoverOpts.etcdDataDir != "" {
+			return errors.New("--manifest-dir can't be set with --backup, --etcd-servers, --apiserver-manifest, --etcd-snapshot or --etcd-data-dir")
+		}
+		if info, err := os.Stat(recoverOpts.manifestDir); err != nil {
+			return fmt.Errorf("invalid --manifest-dir: %v", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("invalid --manifest-dir: %s is not a directory", recoverOpts.manifestDir)
+		}
+	}
+	if recoverOpts.seedEtcd {
+		if recoverOpts.etcdSnapshot == "" && recoverOpts.etcdDataDir == "" {
+			return errors.New("--seed-etcd requires --etcd-snapshot or --etcd-data-dir")
+		}
+		if net.ParseIP(recoverOpts.seedEtcdServiceIP) == nil {
+			return fmt.Errorf("invalid --bootstrap-etcd-service-ip %q", recoverOpts.seedEtcdServiceIP)
+		}
+	}
+	if _, err := labels.Parse(recoverOpts.selector); err != nil {
+		return fmt.Errorf("invalid --selector: %v", err)
+	}
+	if recoverOpts.namespaces != "" {
+		for _, ns := range strings.Split(recoverOpts.namespaces, ",") {
+			if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+				return fmt.Errorf("invalid namespace %q in --namespaces: %s", ns, strings.Join(errs, ", "))
+			}
+		}
+	}
+	if (recoverOpts.caCertPath != "") != (recoverOpts.caKeyPath != "") {
+		return errors.New("you must specify both --ca-cert-path and --ca-key-path")
+	}
 	if recoverOpts.etcdPrefix == "" {
 		return errors.New("missing required flag: --etcd-prefix")
 	}
@@ -100,27 +433,38 @@ func validateRecoverOpts(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func createEtcdClient() (*clientv3.Client, error) {
+// createEtcdClient returns a client of the comma separated etcd servers, using TLS if the CA or
+// the client certificate and key are set.
+func createEtcdClient(servers, caPath, certificatePath, privateKeyPath string) (*clientv3.Client, error) {
+	cfg, err := newEtcdClientConfig(servers, caPath, certificatePath, privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(cfg)
+}
+
+// newEtcdClientConfig returns the client config of createEtcdClient.
+func newEtcdClientConfig(servers, caPath, certificatePath, privateKeyPath string) (clientv3.Config, error) {
 	cfg := clientv3.Config{
-		Endpoints:   strings.Split(recoverOpts.etcdServers, ","),
+		Endpoints:   strings.Split(servers, ","),
 		DialTimeout: 5 * time.Second,
 	}
 	var roots *x509.CertPool
-	if recoverOpts.etcdCAPath != "" {
+	if caPath != "" {
 		roots = x509.NewCertPool()
-		etcdCA, err := ioutil.ReadFile(recoverOpts.etcdCAPath)
+		etcdCA, err := ioutil.ReadFile(caPath)
 		if err != nil {
-			return nil, err
+			return cfg, err
 		}
 		if ok := roots.AppendCertsFromPEM(etcdCA); !ok {
-			return nil, fmt.Errorf("error processing --etcd-ca-file %s", recoverOpts.etcdCAPath)
+			return cfg, fmt.Errorf("error processing --etcd-ca-file %s", caPath)
 		}
 	}
 	var certs []tls.Certificate
-	if recoverOpts.etcdCertificatePath != "" && recoverOpts.etcdPrivateKeyPath != "" {
-		clientCert, err := tls.LoadX509KeyPair(recoverOpts.etcdCertificatePath, recoverOpts.etcdPrivateKeyPath)
+	if certificatePath != "" && privateKeyPath != "" {
+		clientCert, err := tls.LoadX509KeyPair(certificatePath, privateKeyPath)
 		if err != nil {
-			return nil, err
+			return cfg, err
 		}
 		certs = []tls.Certificate{clientCert}
 	}
@@ -130,5 +474,5 @@ func createEtcdClient() (*clientv3.Client, error) {
 			Certificates: certs,
 		}
 	}
-	return clientv3.New(cfg)
+	return cfg, nil
 }
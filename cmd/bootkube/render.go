@@ -5,6 +5,7 @@ import (
 	"os"
 	"plugin"
 
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
 	bootkubeplugin "github.com/kubernetes-sigs/bootkube/pkg/plugin"
 	"github.com/spf13/cobra"
 )
@@ -21,6 +22,7 @@ var (
 		assetDir    string
 		plugin      string
 		pluginFlags []string
+		signingKey  string
 	}
 
 	pluginOpts bootkubeplugin.Options
@@ -32,6 +34,7 @@ func init() {
 	cmdRender.Flags().StringVar(&pluginOpts.AssetDir, "asset-dir", "", "Output path for rendered assets")
 	cmdRender.Flags().StringVar(&renderOpts.plugin, "plugin", "", "Path to the render plugin")
 	cmdRender.Flags().StringSliceVar(&renderOpts.pluginFlags, "plugin-flag", []string{}, "The flags to pass to the render plugin")
+	cmdRender.Flags().StringVar(&renderOpts.signingKey, "signing-key", "", "Path to a PEM encoded RSA or ECDSA private key to sign the checksums of the rendered assets with.")
 
 	cobra.MarkFlagRequired(cmdRender.Flags(), "asset-dir")
 	cobra.MarkFlagRequired(cmdRender.Flags(), "plugin")
@@ -57,5 +60,8 @@ func runCmdRender(cmd *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
-	return renderer.Render(&pluginOpts, renderOpts.pluginFlags)
+	if err := renderer.Render(&pluginOpts, renderOpts.pluginFlags); err != nil {
+		return err
+	}
+	return bootkube.WriteAssetChecksums(pluginOpts.AssetDir, renderOpts.signingKey)
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -21,10 +25,41 @@ var (
 	}
 
 	startOpts struct {
-		assetDir        string
-		podManifestPath string
-		strict          bool
-		requiredPods    []string
+		assetDir          string
+		assetBundle       string
+		decryptionKey     string
+		podManifestPath   string
+		podManifestPrefix string
+		strict            bool
+		requiredPods      []string
+		noPivot           bool
+		verifyAssets      bool
+		verifyKey         string
+		logFormat         string
+		logLevel          string
+
+		timeout          time.Duration
+		apiServerTimeout time.Duration
+		assetTimeout     time.Duration
+		pivotTimeout     time.Duration
+		retries          int
+		retryBackoff     time.Duration
+		statusAddress    string
+		progressFD       int
+		progressFile     string
+		parallelism      int
+		allowUpdate      bool
+		prune            bool
+		adopt            bool
+		writeKubeConfig  bool
+		embedCerts       bool
+
+		etcdServers         string
+		etcdCAPath          string
+		etcdCertificatePath string
+		etcdPrivateKeyPath  string
+		etcdMembers         int
+		etcdMinHealthy      int
 	}
 )
 
@@ -37,18 +72,131 @@ var defaultRequiredPods = []string{
 
 func init() {
 	cmdRoot.AddCommand(cmdStart)
-	cmdStart.Flags().StringVar(&startOpts.assetDir, "asset-dir", "", "Path to the cluster asset directory. Expected layout generated by the `bootkube render` command.")
+	cmdStart.Flags().StringVar(&startOpts.assetDir, "asset-dir", "", "Path to the cluster asset directory. Expected layout generated by the `bootkube render` command. Can also be an s3://<bucket>/<object>, gs://<bucket>/<object> or https:// URL of a tarball of the asset directory, which is downloaded and verified against its checksums before the boot.")
+	cmdStart.Flags().StringVar(&startOpts.assetBundle, "asset-bundle", "", "Path or s3://, gs:// or https:// URL of an age encrypted tarball of the asset directory, used instead of --asset-dir. It is decrypted in memory with --decryption-key and verified against its checksums before the boot.")
+	cmdStart.Flags().StringVar(&startOpts.decryptionKey, "decryption-key", "", "Path to the age identity file, as written by age-keygen, to decrypt --asset-bundle with.")
 	cmdStart.Flags().StringVar(&startOpts.podManifestPath, "pod-manifest-path", "/etc/kubernetes/manifests", "The location where the kubelet is configured to look for static pod manifests.")
-	cmdStart.Flags().BoolVar(&startOpts.strict, "strict", false, "Strict mode will cause bootkube to exit early if any manifests in the asset directory cannot be created.")
-	cmdStart.Flags().StringSliceVar(&startOpts.requiredPods, "required-pods", defaultRequiredPods, "List of pods with their namespace (written as <namespace>/<pod-name>) that are required to be running before the start command does the pivot.")
+	cmdStart.Flags().StringVar(&startOpts.podManifestPrefix, "pod-manifest-prefix", "", "Prefix for the file names of the static pod manifests copied to --pod-manifest-path, e.g. bootkube-, so that they don't collide with those of other tools using the kubelet.")
+	cmdStart.Flags().BoolVar(&startOpts.strict, "strict", false, "Strict mode will cause bootkube to fail if any manifests in the asset directory cannot be created, listing all of them, before the pivot.")
+	cmdStart.Flags().StringSliceVar(&startOpts.requiredPods, "required-pods", defaultRequiredPods, "List of pods with their namespace (written as <namespace>/<pod-name>) that are required to be running and ready before the start command does the pivot. Workloads written as <namespace>/<kind>/<name>, e.g. kube-system/daemonset/kube-proxy, require all pods of a DaemonSet, Deployment or StatefulSet to be ready.")
+	cmdStart.Flags().BoolVar(&startOpts.noPivot, "no-pivot", false, "Keep the bootstrap control plane as the permanent, static pod based control plane instead of pivoting to a self-hosted one. The self-hosted control plane manifests are not created.")
+	cmdStart.Flags().BoolVar(&startOpts.verifyAssets, "verify-assets", false, "Refuse to start if the asset directory doesn't match the checksums written by `bootkube render`.")
+	cmdStart.Flags().StringVar(&startOpts.verifyKey, "verify-assets-key", "", "Path to the PEM encoded public key or certificate the asset checksums must be signed with. Implies --verify-assets.")
+	cmdStart.Flags().StringVar(&startOpts.logFormat, "log-format", bootkube.LogFormatText, "Format of the bootkube output, text or json. The json format writes one JSON object with the time, level and message per line, for provisioning systems to parse.")
+	cmdStart.Flags().DurationVar(&startOpts.timeout, "timeout", 0, "Overall timeout of bootkube start, 0 for none. The phases are also bounded by their own timeouts.")
+	cmdStart.Flags().DurationVar(&startOpts.apiServerTimeout, "apiserver-timeout", bootkube.DefaultPhaseTimeout, "Timeout for the bootstrap apiserver to become ready.")
+	cmdStart.Flags().DurationVar(&startOpts.assetTimeout, "asset-timeout", bootkube.DefaultPhaseTimeout, "Timeout for creating the assets once the apiserver is ready.")
+	cmdStart.Flags().DurationVar(&startOpts.pivotTimeout, "pivot-timeout", bootkube.DefaultPhaseTimeout, "Timeout for the required pods to run and the pivot to the self-hosted control plane.")
+	cmdStart.Flags().IntVar(&startOpts.retries, "retries", bootkube.DefaultRetryPolicy.Retries, "How often a failed request to create an asset is retried.")
+	cmdStart.Flags().DurationVar(&startOpts.retryBackoff, "retry-backoff", bootkube.DefaultRetryPolicy.Backoff, "Wait before the first retry of a failed request to the apiserver. It doubles with each further retry, up to 10s, plus a random jitter of up to 20%.")
+	cmdStart.Flags().StringVar(&startOpts.statusAddress, "status-address", "", "Address to serve /healthz and the Prometheus /metrics of the bootstrap progress on, e.g. 127.0.0.1:10270. Disabled if empty.")
+	cmdStart.Flags().IntVar(&startOpts.progressFD, "progress-fd", -1, "File descriptor to write the progress events to as newline delimited JSON, e.g. 3. Disabled if negative.")
+	cmdStart.Flags().StringVar(&startOpts.progressFile, "progress-file", "", "Path of a file or named pipe to write the progress events to as newline delimited JSON.")
+	cmdStart.Flags().IntVar(&startOpts.parallelism, "parallelism", bootkube.DefaultParallelism, "How many manifests are created at once.")
+	cmdStart.Flags().BoolVar(&startOpts.allowUpdate, "allow-update", false, "Server-side apply the manifests as the bootkube field manager, updating objects that already exist to match their manifest instead of failing.")
+	cmdStart.Flags().BoolVar(&startOpts.prune, "prune", false, "Delete the objects bootkube created from the asset directory whose manifest was removed from it, like kubectl apply --prune. Namespaces and CRDs are never pruned.")
+	cmdStart.Flags().BoolVar(&startOpts.adopt, "adopt", false, "Probe the cluster with the admin kubeconfig first and, if the apiserver and the self-hosted control plane are already healthy, skip the bootstrap control plane and only create the missing assets. Makes bootkube start safe to re-run.")
+	cmdStart.Flags().BoolVar(&startOpts.writeKubeConfig, "write-admin-kubeconfig", false, "Once the cluster is bootstrapped, write the admin kubeconfig of the self-hosted control plane to auth/admin-kubeconfig of the asset directory, replacing an existing one. It points at the apiserver of the kubelet kubeconfig with the admin client certificate.")
+	cmdStart.Flags().BoolVar(&startOpts.embedCerts, "admin-kubeconfig-embed-certs", true, "Embed the CA and the admin client certificate and key in the admin kubeconfig instead of referring to their files in the asset directory. Used with --write-admin-kubeconfig.")
+	cmdStart.Flags().StringVar(&startOpts.etcdServers, "etcd-servers", "", "List of etcd server URLs including host:port, comma separated. If set, the self-hosted etcd members must be healthy, agree on a leader and have no alarms before the bootstrap control plane is torn down.")
+	cmdStart.Flags().StringVar(&startOpts.etcdCAPath, "etcd-ca-path", "", "Path to the PEM encoded CA of the etcd servers.")
+	cmdStart.Flags().StringVar(&startOpts.etcdCertificatePath, "etcd-certificate-path", "", "Path to the client certificate for the etcd servers. Must be used in conjunction with --etcd-private-key-path.")
+	cmdStart.Flags().StringVar(&startOpts.etcdPrivateKeyPath, "etcd-private-key-path", "", "Path to the private key of the client certificate for the etcd servers. Must be used in conjunction with --etcd-certificate-path.")
+	cmdStart.Flags().IntVar(&startOpts.etcdMembers, "etcd-members", 0, "How many self-hosted etcd members to wait for before the pivot, any number if zero. Used with --etcd-servers.")
+	cmdStart.Flags().IntVar(&startOpts.etcdMinHealthy, "etcd-min-healthy", 0, "How many self-hosted etcd members must be healthy before the pivot, a quorum of them if zero. Used with --etcd-servers.")
+	cmdStart.Flags().StringVar(&startOpts.logLevel, "log-level", bootkube.LogLevelInfo, "Minimum level of the bootkube output: debug, info, warning or error.")
 }
 
 func runCmdStart(cmd *cobra.Command, args []string) error {
+	if startOpts.assetBundle != "" || bootkube.IsRemoteAssetDir(startOpts.assetDir) {
+		ctx := context.Background()
+		if startOpts.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, startOpts.timeout)
+			defer cancel()
+		}
+		var dir string
+		var cleanup func()
+		var err error
+		if startOpts.assetBundle != "" {
+			bootkube.UserOutput("Decrypting the asset bundle %s\n", bootkube.RedactAssetSource(startOpts.assetBundle))
+			dir, cleanup, err = bootkube.ExtractAssetBundle(ctx, startOpts.assetBundle, startOpts.decryptionKey)
+		} else {
+			bootkube.UserOutput("Downloading the assets from %s\n", bootkube.RedactAssetSource(startOpts.assetDir))
+			dir, cleanup, err = bootkube.FetchAssets(ctx, startOpts.assetDir)
+		}
+		if err != nil {
+			bootkube.UserError("%v\n", err)
+			return err
+		}
+		defer cleanup()
+		// Downloaded and decrypted assets are always checked against the checksums they were rendered with.
+		startOpts.assetDir = dir
+		startOpts.verifyAssets = true
+	}
+	// The default required pods are the self-hosted control plane, which isn't created without a
+	// pivot or with a static control plane.
+	if (startOpts.noPivot || bootkube.IsStaticControlPlane(startOpts.assetDir)) && !cmd.Flags().Changed("required-pods") {
+		startOpts.requiredPods = nil
+	}
+	// They are in the control plane namespace the assets were rendered with.
+	if ns := bootkube.ControlPlaneNamespace(startOpts.assetDir); ns != "kube-system" && !cmd.Flags().Changed("required-pods") {
+		var pods []string
+		for _, p := range startOpts.requiredPods {
+			pods = append(pods, ns+"/"+strings.SplitN(p, "/", 2)[1])
+		}
+		startOpts.requiredPods = pods
+	}
+	var progress io.Writer
+	switch {
+	case startOpts.progressFD >= 0:
+		f := os.NewFile(uintptr(startOpts.progressFD), "progress-fd")
+		defer f.Close()
+		progress = f
+	case startOpts.progressFile != "":
+		f, err := os.OpenFile(startOpts.progressFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		progress = f
+	}
+	var etcd bootkube.EtcdClient
+	if startOpts.etcdServers != "" {
+		client, err := createEtcdClient(startOpts.etcdServers, startOpts.etcdCAPath, startOpts.etcdCertificatePath, startOpts.etcdPrivateKeyPath)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		etcd = client
+	}
 	bk, err := bootkube.NewBootkube(bootkube.Config{
-		AssetDir:        startOpts.assetDir,
-		PodManifestPath: startOpts.podManifestPath,
-		Strict:          startOpts.strict,
-		RequiredPods:    startOpts.requiredPods,
+		AssetDir:          startOpts.assetDir,
+		PodManifestPath:   startOpts.podManifestPath,
+		PodManifestPrefix: startOpts.podManifestPrefix,
+		Strict:            startOpts.strict,
+		RequiredPods:      startOpts.requiredPods,
+		NoPivot:           startOpts.noPivot,
+		VerifyAssets:      startOpts.verifyAssets || startOpts.verifyKey != "",
+		VerifyKeyPath:     startOpts.verifyKey,
+
+		Timeout:          startOpts.timeout,
+		APIServerTimeout: startOpts.apiServerTimeout,
+		AssetTimeout:     startOpts.assetTimeout,
+		PivotTimeout:     startOpts.pivotTimeout,
+		Retry:            bootkube.RetryPolicy{Retries: startOpts.retries, Backoff: startOpts.retryBackoff},
+		StatusAddress:    startOpts.statusAddress,
+		Progress:         progress,
+		Parallelism:      startOpts.parallelism,
+		AllowUpdate:      startOpts.allowUpdate,
+		Prune:            startOpts.prune,
+		Adopt:            startOpts.adopt,
+
+		WriteAdminKubeConfig:      startOpts.writeKubeConfig,
+		AdminKubeConfigEmbedCerts: startOpts.embedCerts,
+
+		Etcd:       etcd,
+		EtcdHealth: bootkube.EtcdHealth{Members: startOpts.etcdMembers, MinHealthy: startOpts.etcdMinHealthy},
 	})
 	if err != nil {
 		return err
@@ -57,21 +205,69 @@ func runCmdStart(cmd *cobra.Command, args []string) error {
 	err = bk.Run()
 	if err != nil {
 		// Always report errors.
-		bootkube.UserOutput("Error: %v\n", err)
+		bootkube.UserError("%v\n", err)
 	}
 	return err
 }
 
 func validateStartOpts(cmd *cobra.Command, args []string) error {
+	if err := bootkube.ConfigureLogging(startOpts.logFormat, startOpts.logLevel); err != nil {
+		return err
+	}
 	if startOpts.podManifestPath == "" {
 		return errors.New("missing required flag: --pod-manifest-path")
 	}
-	if startOpts.assetDir == "" {
+	if strings.Contains(startOpts.podManifestPrefix, "/") {
+		return errors.New("--pod-manifest-prefix must not contain a path separator")
+	}
+	if startOpts.assetDir == "" && startOpts.assetBundle == "" {
 		return errors.New("missing required flag: --asset-dir")
 	}
+	if startOpts.assetDir != "" && startOpts.assetBundle != "" {
+		return errors.New("only one of --asset-dir and --asset-bundle can be set")
+	}
+	if (startOpts.assetBundle == "") != (startOpts.decryptionKey == "") {
+		return errors.New("--asset-bundle and --decryption-key must be set together")
+	}
+	if startOpts.writeKubeConfig && (startOpts.assetBundle != "" || bootkube.IsRemoteAssetDir(startOpts.assetDir)) {
+		return errors.New("--write-admin-kubeconfig needs a local --asset-dir")
+	}
+	if (startOpts.etcdCertificatePath == "") != (startOpts.etcdPrivateKeyPath == "") {
+		return errors.New("--etcd-certificate-path and --etcd-private-key-path must be set together")
+	}
+	if startOpts.etcdMembers < 0 || startOpts.etcdMinHealthy < 0 {
+		return errors.New("--etcd-members and --etcd-min-healthy must not be negative")
+	}
+	if startOpts.etcdMembers > 0 && startOpts.etcdMinHealthy > startOpts.etcdMembers {
+		return errors.New("--etcd-min-healthy must not be more than --etcd-members")
+	}
+	if startOpts.timeout < 0 {
+		return errors.New("--timeout must not be negative")
+	}
+	for flag, t := range map[string]time.Duration{
+		"--apiserver-timeout": startOpts.apiServerTimeout,
+		"--asset-timeout":     startOpts.assetTimeout,
+		"--pivot-timeout":     startOpts.pivotTimeout,
+	} {
+		if t <= 0 {
+			return fmt.Errorf("%s must be positive", flag)
+		}
+	}
+	if startOpts.progressFD >= 0 && startOpts.progressFile != "" {
+		return errors.New("only one of --progress-fd and --progress-file can be set")
+	}
+	if startOpts.parallelism < 1 {
+		return errors.New("--parallelism must be at least 1")
+	}
+	if startOpts.retries < 0 {
+		return errors.New("--retries must not be negative")
+	}
+	if startOpts.retryBackoff <= 0 {
+		return errors.New("--retry-backoff must be positive")
+	}
 	for _, nsPod := range startOpts.requiredPods {
-		if len(strings.Split(nsPod, "/")) != 2 {
-			return fmt.Errorf("invalid required pod: expected %q to be of shape <namespace>/<pod-name>", nsPod)
+		if err := bootkube.ParseRequiredPod(nsPod); err != nil {
+			return err
 		}
 	}
 	return nil
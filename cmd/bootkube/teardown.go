@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"go.etcd.io/etcd/clientv3"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+)
+
+var (
+	cmdTeardown = &cobra.Command{
+		Use:          "teardown",
+		Short:        "Remove a bootkube managed cluster",
+		Long:         "With --cluster, this command deletes the objects created from the manifests in asset-dir in the delete order recorded by `bootkube render`, ending with the self-hosted control plane. With --bootstrap, it instead removes what the bootstrap control plane left behind on the node once the self-hosted control plane is healthy: the bootstrap static pod manifests, the bootstrap secrets and, with --etcd-servers, the bootstrap etcd member.",
+		PreRunE:      validateTeardownOpts,
+		RunE:         runCmdTeardown,
+		SilenceUsage: true,
+	}
+
+	teardownOpts struct {
+		assetDir       string
+		kubeConfigPath string
+		cluster        bool
+
+		bootstrap           bool
+		podManifestPath     string
+		podManifestPrefix   string
+		etcdServers         string
+		etcdCAPath          string
+		etcdCertificatePath string
+		etcdPrivateKeyPath  string
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdTeardown)
+	cmdTeardown.Flags().StringVar(&teardownOpts.assetDir, "asset-dir", "", "Path to the cluster asset directory the cluster was started from.")
+	cmdTeardown.Flags().StringVar(&teardownOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster. Defaults to the admin kubeconfig in asset-dir.")
+	cmdTeardown.Flags().BoolVar(&teardownOpts.cluster, "cluster", false, "Delete the cluster objects created from the rendered manifests, including the self-hosted control plane.")
+	cmdTeardown.Flags().BoolVar(&teardownOpts.bootstrap, "bootstrap", false, "Remove the leftovers of the bootstrap control plane from this node, checking that the self-hosted control plane is still healthy after each step.")
+	cmdTeardown.Flags().StringVar(&teardownOpts.podManifestPath, "pod-manifest-path", "/etc/kubernetes/manifests", "The location where the kubelet is configured to look for static pod manifests. Used with --bootstrap.")
+	cmdTeardown.Flags().StringVar(&teardownOpts.podManifestPrefix, "pod-manifest-prefix", "", "The prefix bootkube start was run with for the file names of the static pod manifests. Used with --bootstrap.")
+	cmdTeardown.Flags().StringVar(&teardownOpts.etcdServers, "etcd-servers", "", "List of etcd server URLs including host:port, comma separated, to remove the bootstrap etcd member from. Used with --bootstrap.")
+	cmdTeardown.Flags().StringVar(&teardownOpts.etcdCAPath, "etcd-ca-path", "", "Path to the PEM encoded CA of the etcd servers.")
+	cmdTeardown.Flags().StringVar(&teardownOpts.etcdCertificatePath, "etcd-certificate-path", "", "Path to the client certificate for the etcd servers. Must be used in conjunction with --etcd-private-key-path.")
+	cmdTeardown.Flags().StringVar(&teardownOpts.etcdPrivateKeyPath, "etcd-private-key-path", "", "Path to the private key of the client certificate for the etcd servers. Must be used in conjunction with --etcd-certificate-path.")
+}
+
+func runCmdTeardown(cmd *cobra.Command, args []string) error {
+	kubeConfigPath := teardownOpts.kubeConfigPath
+	if kubeConfigPath == "" {
+		kubeConfigPath = filepath.Join(teardownOpts.assetDir, asset.AssetPathAdminKubeConfig)
+	}
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+		&clientcmd.ConfigOverrides{})
+	if teardownOpts.bootstrap {
+		var etcd clientv3.Cluster
+		if teardownOpts.etcdServers != "" {
+			client, err := createEtcdClient(teardownOpts.etcdServers, teardownOpts.etcdCAPath, teardownOpts.etcdCertificatePath, teardownOpts.etcdPrivateKeyPath)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+			etcd = client
+		}
+		return bootkube.TeardownBootstrap(kubeConfig, teardownOpts.assetDir, teardownOpts.podManifestPath, teardownOpts.podManifestPrefix, etcd)
+	}
+	return bootkube.TeardownCluster(kubeConfig, teardownOpts.assetDir)
+}
+
+func validateTeardownOpts(cmd *cobra.Command, args []string) error {
+	if teardownOpts.assetDir == "" {
+		return errors.New("missing required flag: --asset-dir")
+	}
+	if teardownOpts.cluster == teardownOpts.bootstrap {
+		return errors.New("exactly one of --cluster and --bootstrap must be set")
+	}
+	if (teardownOpts.etcdCertificatePath == "") != (teardownOpts.etcdPrivateKeyPath == "") {
+		return errors.New("you must specify both --etcd-certificate-path, and --etcd-private-key-path")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+)
+
+var (
+	cmdToken = &cobra.Command{
+		Use:               "token",
+		Short:             "Manage the bootstrap tokens nodes join the cluster with",
+		PersistentPreRunE: validateTokenOpts,
+	}
+
+	cmdTokenCreate = &cobra.Command{
+		Use:          "create",
+		Short:        "Create a bootstrap token",
+		Long:         "This command creates a bootstrap token kubelets can join the running cluster with, and prints it along with the hash of the cluster CA.",
+		Args:         cobra.NoArgs,
+		RunE:         runCmdTokenCreate,
+		SilenceUsage: true,
+	}
+
+	cmdTokenList = &cobra.Command{
+		Use:          "list",
+		Short:        "List the bootstrap tokens",
+		Args:         cobra.NoArgs,
+		RunE:         runCmdTokenList,
+		SilenceUsage: true,
+	}
+
+	cmdTokenDelete = &cobra.Command{
+		Use:          "delete TOKEN_ID...",
+		Short:        "Delete bootstrap tokens",
+		Args:         cobra.MinimumNArgs(1),
+		RunE:         runCmdTokenDelete,
+		SilenceUsage: true,
+	}
+
+	tokenOpts struct {
+		assetDir       string
+		kubeConfigPath string
+		ttl            time.Duration
+		description    string
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdToken)
+	cmdToken.AddCommand(cmdTokenCreate, cmdTokenList, cmdTokenDelete)
+	cmdToken.PersistentFlags().StringVar(&tokenOpts.assetDir, "asset-dir", "", "Path to the rendered cluster assets. Used to locate the admin kubeconfig when --kubeconfig is not set.")
+	cmdToken.PersistentFlags().StringVar(&tokenOpts.kubeConfigPath, "kubeconfig", "", "Path to kubeconfig for communicating with the cluster. Defaults to the admin kubeconfig in asset-dir.")
+	cmdTokenCreate.Flags().DurationVar(&tokenOpts.ttl, "ttl", asset.DefaultBootstrapTokenTTL, "How long the token is valid for. 0 means the token never expires.")
+	cmdTokenCreate.Flags().StringVar(&tokenOpts.description, "description", "", "Human readable description of what the token is for.")
+}
+
+func runCmdTokenCreate(cmd *cobra.Command, args []string) error {
+	client, err := newKubeClient(tokenKubeConfigPath())
+	if err != nil {
+		return err
+	}
+	token, err := bootkube.CreateBootstrapToken(client, tokenOpts.ttl, tokenOpts.description)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token.Token())
+	if token.Expiration.IsZero() {
+		bootkube.UserOutput("Created bootstrap token %s, which doesn't expire.\n", token.ID)
+	} else {
+		bootkube.UserOutput("Created bootstrap token %s, which expires at %s.\n", token.ID, token.Expiration.Format(time.RFC3339))
+	}
+	if hash, err := bootkube.ClusterCACertHash(client); err != nil {
+		bootkube.UserWarning("unable to determine the cluster CA hash: %v\n", err)
+	} else {
+		bootkube.UserOutput("Cluster CA hash: %s\n", hash)
+	}
+	return nil
+}
+
+func runCmdTokenList(cmd *cobra.Command, args []string) error {
+	client, err := newKubeClient(tokenKubeConfigPath())
+	if err != nil {
+		return err
+	}
+	tokens, err := bootkube.ListBootstrapTokens(client)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TOKEN ID\tEXPIRES\tUSAGES\tDESCRIPTION")
+	for _, t := range tokens {
+		expires := "<never>"
+		if !t.Expiration.IsZero() {
+			expires = t.Expiration.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.ID, expires, strings.Join(t.Usages, ","), t.Description)
+	}
+	return w.Flush()
+}
+
+func runCmdTokenDelete(cmd *cobra.Command, args []string) error {
+	client, err := newKubeClient(tokenKubeConfigPath())
+	if err != nil {
+		return err
+	}
+	for _, id := range args {
+		if err := bootkube.DeleteBootstrapToken(client, id); err != nil {
+			return err
+		}
+		bootkube.UserOutput("Deleted bootstrap token %s\n", strings.SplitN(id, ".", 2)[0])
+	}
+	return nil
+}
+
+func tokenKubeConfigPath() string {
+	if tokenOpts.kubeConfigPath != "" {
+		return tokenOpts.kubeConfigPath
+	}
+	return filepath.Join(tokenOpts.assetDir, asset.AssetPathAdminKubeConfig)
+}
+
+func validateTokenOpts(cmd *cobra.Command, args []string) error {
+	if tokenOpts.assetDir == "" && tokenOpts.kubeConfigPath == "" {
+		return errors.New("missing required flag: --asset-dir or --kubeconfig")
+	}
+	if tokenOpts.ttl < 0 {
+		return errors.New("--ttl must not be negative")
+	}
+	return nil
+}
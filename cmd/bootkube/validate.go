@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/bootkube"
+)
+
+var (
+	cmdValidate = &cobra.Command{
+		Use:          "validate",
+		Short:        "Check a rendered asset directory",
+		Long:         "Checks the manifests of asset-dir against the Kubernetes API schema, the Secrets, ConfigMaps and asset files pods reference, and the TLS certificates against the endpoints they serve, e.g. after editing rendered assets.",
+		PreRunE:      validateValidateOpts,
+		RunE:         runCmdValidate,
+		SilenceUsage: true,
+	}
+
+	validateOpts struct {
+		assetDir          string
+		kubernetesVersion string
+		output            string
+	}
+)
+
+func init() {
+	cmdRoot.AddCommand(cmdValidate)
+	cmdValidate.Flags().StringVar(&validateOpts.assetDir, "asset-dir", "", "Path to the cluster asset directory to check.")
+	cmdValidate.Flags().StringVar(&validateOpts.kubernetesVersion, "kubernetes-version", "", "Kubernetes version the API versions of manifests must be served by, e.g. v1.18.2. Defaults to the version of the rendered apiserver image.")
+	cmdValidate.Flags().StringVar(&validateOpts.output, "output", "text", "Format of the findings: text or json.")
+}
+
+func runCmdValidate(cmd *cobra.Command, args []string) error {
+	findings, err := bootkube.ValidateAssets(validateOpts.assetDir, validateOpts.kubernetesVersion)
+	if err != nil {
+		return err
+	}
+	if validateOpts.output == "json" {
+		if findings == nil {
+			findings = []bootkube.Finding{}
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	}
+	return findingErrors(findings)
+}
+
+// findingErrors returns an error if any of the findings is an error.
+func findingErrors(findings []bootkube.Finding) error {
+	var errs int
+	for _, f := range findings {
+		if f.Severity == bootkube.SeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("%d of %d findings are errors", errs, len(findings))
+	}
+	return nil
+}
+
+func validateValidateOpts(cmd *cobra.Command, args []string) error {
+	if validateOpts.assetDir == "" {
+		return errors.New("missing required flag: --asset-dir")
+	}
+	if validateOpts.output != "text" && validateOpts.output != "json" {
+		return fmt.Errorf("invalid --output %q, want: text or json", validateOpts.output)
+	}
+	return nil
+}
@@ -4,10 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/kubernetes-sigs/bootkube/pkg/checkpoint"
@@ -18,9 +20,11 @@ const (
 	podNameEnv      = "POD_NAME"
 	podNamespaceEnv = "POD_NAMESPACE"
 
-	defaultRuntimeEndpoint       = "unix:///var/run/dockershim.sock"
 	defaultRuntimeRequestTimeout = 2 * time.Minute
 	defaultCheckpointGracePeriod = 1 * time.Minute
+	defaultCheckpointInterval    = 5 * time.Second
+	defaultCheckpointBackoff     = 10 * time.Second
+	defaultMaxCheckpointBackoff  = 2 * time.Minute
 )
 
 var (
@@ -29,15 +33,39 @@ var (
 	remoteRuntimeEndpoint string
 	runtimeRequestTimeout time.Duration
 	checkpointGracePeriod time.Duration
+	checkpointRetention   time.Duration
+	checkpointHistory     int
+	metricsAddr           string
+	healthzAddr           string
+	checkpointSelector    string
+	checkpointNamespaces  string
+	checkpointInterval    time.Duration
+	checkpointBackoff     time.Duration
+	maxCheckpointBackoff  time.Duration
+	apiserverPollInterval time.Duration
+	kubeletPollInterval   time.Duration
+	dryRun                bool
 )
 
 func init() {
 	flag.StringVar(&lockfilePath, "lock-file", "/var/run/lock/pod-checkpointer.lock", "The path to lock file for checkpointer to use")
 	flag.StringVar(&kubeconfigPath, "kubeconfig", "/etc/kubernetes/kubeconfig", "Path to a kubeconfig file containing credentials used to talk to the kubelet.")
 	flag.Set("logtostderr", "true")
-	flag.StringVar(&remoteRuntimeEndpoint, "container-runtime-endpoint", defaultRuntimeEndpoint, "[Experimental] The endpoint of remote runtime service. Currently unix socket is supported on Linux, and tcp is supported on windows.  Examples:'unix:///var/run/dockershim.sock', 'tcp://localhost:3735'")
+	flag.StringVar(&remoteRuntimeEndpoint, "container-runtime-endpoint", "", "The endpoint of the CRI runtime service of the container runtime, e.g. 'unix:///var/run/containerd/containerd.sock'. Currently unix socket is supported on Linux, and tcp is supported on windows. Defaults to the socket of dockershim, containerd or CRI-O below /var/run, whichever exists.")
 	flag.DurationVar(&runtimeRequestTimeout, "runtime-request-timeout", defaultRuntimeRequestTimeout, "Timeout of all runtime requests except long running request - pull, logs, exec and attach. When timeout exceeded, kubelet will cancel the request, throw out an error and retry later.")
 	flag.DurationVar(&checkpointGracePeriod, "checkpoint-grace-period", defaultCheckpointGracePeriod, "Grace period for cleaning up checkpoints when the parent pod is deleted. Non-zero values are helpful for accommodating control plane eventual consistency.")
+	flag.DurationVar(&checkpointRetention, "checkpoint-retention", 0, "How long inactive checkpoints are retained once their parent pod is no longer seen by the apiserver or kubelet, even if the apiserver is unavailable. Zero retains them until the apiserver confirms the deletion of the parent pod.")
+	flag.IntVar(&checkpointHistory, "checkpoint-history", 0, "Number of previous versions of the checkpoint manifest of each pod to keep in /etc/kubernetes/checkpoint-history.")
+	flag.StringVar(&checkpointSelector, "checkpoint-selector", "", "Label selector of pods to checkpoint in addition to those with the checkpointer.alpha.coreos.com/checkpoint=true annotation, e.g. 'tier=control-plane'. Only pods in the checkpoint namespaces are selected.")
+	flag.StringVar(&checkpointNamespaces, "checkpoint-namespaces", "", "Comma-separated namespaces to checkpoint pods of in addition to the namespace of the checkpointer.")
+	flag.DurationVar(&checkpointInterval, "checkpoint-interval", defaultCheckpointInterval, "How often pods are checkpointed and the state of the checkpoints is updated.")
+	flag.DurationVar(&checkpointBackoff, "checkpoint-backoff", defaultCheckpointBackoff, "How long a pod is not checkpointed after it failed to be, doubling with every further failure up to --max-checkpoint-backoff.")
+	flag.DurationVar(&maxCheckpointBackoff, "max-checkpoint-backoff", defaultMaxCheckpointBackoff, "The maximum time a pod is not checkpointed after repeated failures.")
+	flag.DurationVar(&apiserverPollInterval, "apiserver-poll-interval", 0, "How often parent pods are retrieved from the apiserver. Between polls the last retrieved ones are used. Zero polls every --checkpoint-interval.")
+	flag.DurationVar(&kubeletPollInterval, "kubelet-poll-interval", 0, "How often parent pods are retrieved from the kubelet. Between polls the last retrieved ones are used. Zero polls every --checkpoint-interval.")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "The address to serve Prometheus metrics on at /metrics, e.g. ':9302'. Metrics are not served if empty.")
+	flag.StringVar(&healthzAddr, "healthz-addr", "", "The address to serve the health of the checkpointer on at /healthz, e.g. '127.0.0.1:9303'. It may be the same as --metrics-addr. Health is not served if empty.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Log the checkpoints that would be started, stopped or removed and the files that would be written or removed, without writing or removing them. The lock file is not acquired, so that it can run next to another checkpointer.")
 }
 
 func main() {
@@ -50,9 +78,23 @@ func main() {
 		glog.Fatalf("Error reading downward API: %v", err)
 	}
 
-	glog.Infof("Trying to acquire the flock at %q", lockfilePath)
-	if err := flock(lockfilePath); err != nil {
-		glog.Fatalf("Error when acquiring the flock: %v", err)
+	if checkpointInterval <= 0 {
+		glog.Fatalf("--checkpoint-interval must be positive")
+	}
+	selector, err := labels.Parse(checkpointSelector)
+	if err != nil {
+		glog.Fatalf("Invalid --checkpoint-selector: %v", err)
+	}
+	var namespaces []string
+	if checkpointNamespaces != "" {
+		namespaces = strings.Split(checkpointNamespaces, ",")
+	}
+
+	if !dryRun {
+		glog.Infof("Trying to acquire the flock at %q", lockfilePath)
+		if err := flock(lockfilePath); err != nil {
+			glog.Fatalf("Error when acquiring the flock: %v", err)
+		}
 	}
 
 	glog.Infof("Starting checkpointer for node: %s", nodeName)
@@ -73,6 +115,18 @@ func main() {
 		RemoteRuntimeEndpoint: remoteRuntimeEndpoint,
 		RuntimeRequestTimeout: runtimeRequestTimeout,
 		CheckpointGracePeriod: checkpointGracePeriod,
+		CheckpointRetention:   checkpointRetention,
+		CheckpointHistory:     checkpointHistory,
+		CheckpointSelector:    selector,
+		CheckpointNamespaces:  namespaces,
+		CheckpointInterval:    checkpointInterval,
+		CheckpointBackoff:     checkpointBackoff,
+		MaxCheckpointBackoff:  maxCheckpointBackoff,
+		APIServerPollInterval: apiserverPollInterval,
+		KubeletPollInterval:   kubeletPollInterval,
+		MetricsAddr:           metricsAddr,
+		HealthzAddr:           healthzAddr,
+		DryRun:                dryRun,
 	}); err != nil {
 		glog.Fatalf("Error starting checkpointer: %v", err)
 	}
@@ -0,0 +1,183 @@
+package asset
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// defaultAdmissionPlugins are enabled by the apiserver manifests.
+var defaultAdmissionPlugins = []string{
+	"NamespaceLifecycle",
+	"LimitRanger",
+	"ServiceAccount",
+	"PersistentVolumeClaimResize",
+	"DefaultStorageClass",
+	"DefaultTolerationSeconds",
+	"MutatingAdmissionWebhook",
+	"ValidatingAdmissionWebhook",
+	"ResourceQuota",
+	"Priority",
+	"NodeRestriction",
+}
+
+// AdmissionConfig is an AdmissionConfiguration of the apiserver with the files it references.
+type AdmissionConfig struct {
+	// Config is the AdmissionConfiguration, referencing the files where the apiserver mounts
+	// them.
+	Config []byte
+	// Files are the plugin configuration files and webhook kubeconfigs of Config by asset name.
+	Files map[string][]byte
+	// Plugins are the admission plugins Config configures.
+	Plugins []string
+}
+
+// NewAdmissionConfig parses an AdmissionConfiguration and reads the files it references with
+// readFile: the configuration files of plugins (path) and the kubeconfigs of webhooks
+// (kubeConfigFile settings). These are stored in the apiserver secret with the configuration.
+func NewAdmissionConfig(config []byte, readFile func(path string) ([]byte, error)) (*AdmissionConfig, error) {
+	var c map[string]interface{}
+	if err := yaml.Unmarshal(config, &c); err != nil {
+		return nil, err
+	}
+	if c["kind"] != "AdmissionConfiguration" {
+		return nil, fmt.Errorf("expected kind AdmissionConfiguration, got %q", c["kind"])
+	}
+	plugins, _ := c["plugins"].([]interface{})
+	if len(plugins) == 0 {
+		return nil, errors.New("no admission plugins are configured")
+	}
+
+	ac := &AdmissionConfig{Files: map[string][]byte{}}
+	for _, p := range plugins {
+		p, _ := p.(map[string]interface{})
+		name, _ := p["name"].(string)
+		if name == "" {
+			return nil, errors.New("admission plugin without a name")
+		}
+		ac.Plugins = append(ac.Plugins, name)
+		prefix := "admission-" + strings.ToLower(name)
+
+		if configuration, ok := p["configuration"]; ok {
+			if err := ac.addKubeConfigs(configuration, prefix, readFile); err != nil {
+				return nil, fmt.Errorf("admission plugin %s: %v", name, err)
+			}
+		}
+		if file, ok := p["path"].(string); ok && file != "" {
+			b, err := readFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("admission plugin %s: %v", name, err)
+			}
+			var pc interface{}
+			if err := yaml.Unmarshal(b, &pc); err != nil {
+				return nil, fmt.Errorf("admission plugin %s: failed to parse %s: %v", name, file, err)
+			}
+			if err := ac.addKubeConfigs(pc, prefix, readFile); err != nil {
+				return nil, fmt.Errorf("admission plugin %s: %v", name, err)
+			}
+			if b, err = yaml.Marshal(pc); err != nil {
+				return nil, err
+			}
+			p["path"] = ac.addFile(prefix+".yaml", b)
+		}
+	}
+
+	var err error
+	if ac.Config, err = yaml.Marshal(c); err != nil {
+		return nil, err
+	}
+	return ac, nil
+}
+
+// addKubeConfigs adds the files of the kubeConfigFile settings in v and references them where
+// they are mounted.
+func (ac *AdmissionConfig) addKubeConfigs(v interface{}, prefix string, readFile func(path string) ([]byte, error)) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		// Sort for deterministic file names.
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if file, ok := v[k].(string); ok && k == "kubeConfigFile" {
+				b, err := readFile(file)
+				if err != nil {
+					return err
+				}
+				v[k] = ac.addFile(prefix+"-kubeconfig.yaml", b)
+				continue
+			}
+			if err := ac.addKubeConfigs(v[k], prefix, readFile); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if err := ac.addKubeConfigs(e, prefix, readFile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addFile adds a file with a unique name and returns the path the apiserver mounts it at.
+func (ac *AdmissionConfig) addFile(name string, data []byte) string {
+	ext := path.Ext(name)
+	unique := name
+	for i := 2; ac.Files[path.Join("tls", unique)] != nil || unique == path.Base(AssetPathAdmissionConfig); i++ {
+		unique = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	ac.Files[path.Join("tls", unique)] = data
+	return path.Join("/etc/kubernetes/secrets", unique)
+}
+
+// ExtraAdmissionPlugins are the plugins of the AdmissionConfiguration which the apiserver
+// manifests don't enable by default.
+func (c Config) ExtraAdmissionPlugins() []string {
+	if c.Admission == nil {
+		return nil
+	}
+	var extra []string
+	for _, p := range c.Admission.Plugins {
+		var enabled bool
+		for _, d := range defaultAdmissionPlugins {
+			if d == "NodeRestriction" && c.DisableNodeAuthorization {
+				continue
+			}
+			enabled = enabled || p == d
+		}
+		if !enabled {
+			extra = append(extra, p)
+		}
+	}
+	return extra
+}
+
+// newAdmissionAssets returns the AdmissionConfiguration of the apiserver and the files it
+// references.
+func newAdmissionAssets(conf Config) []Asset {
+	if conf.Admission == nil {
+		return nil
+	}
+	as := []Asset{{Name: AssetPathAdmissionConfig, Data: conf.Admission.Config}}
+	for _, name := range conf.Admission.fileNames() {
+		as = append(as, Asset{Name: name, Data: conf.Admission.Files[name]})
+	}
+	return as
+}
+
+func (ac *AdmissionConfig) fileNames() []string {
+	var names []string
+	for name := range ac.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,132 @@
+package asset
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+func TestAdmissionConfig(t *testing.T) {
+	files := map[string]string{
+		"imagepolicy.yaml":                      "imagePolicy:\n  kubeConfigFile: /etc/webhooks/image-policy.kubeconfig\n  allowTTL: 50\n",
+		"/etc/webhooks/image-policy.kubeconfig": "kind: Config\n",
+		"/etc/webhooks/validating.kubeconfig":   "kind: Config\nclusters: []\n",
+	}
+	readFile := func(p string) ([]byte, error) {
+		f, ok := files[p]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", p)
+		}
+		return []byte(f), nil
+	}
+	config := `apiVersion: apiserver.k8s.io/v1alpha1
+kind: AdmissionConfiguration
+plugins:
+- name: EventRateLimit
+  configuration:
+    apiVersion: eventratelimit.admission.k8s.io/v1alpha1
+    kind: Configuration
+    limits:
+    - type: Server
+      qps: 50
+      burst: 100
+- name: ImagePolicyWebhook
+  path: imagepolicy.yaml
+- name: ValidatingAdmissionWebhook
+  configuration:
+    apiVersion: apiserver.config.k8s.io/v1alpha1
+    kind: WebhookAdmission
+    kubeConfigFile: /etc/webhooks/validating.kubeconfig
+`
+	ac, err := NewAdmissionConfig([]byte(config), readFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"EventRateLimit", "ImagePolicyWebhook", "ValidatingAdmissionWebhook"}; !reflect.DeepEqual(ac.Plugins, want) {
+		t.Errorf("got plugins %v, want: %v", ac.Plugins, want)
+	}
+	for name, want := range map[string]string{
+		"tls/admission-imagepolicywebhook-kubeconfig.yaml":         files["/etc/webhooks/image-policy.kubeconfig"],
+		"tls/admission-validatingadmissionwebhook-kubeconfig.yaml": files["/etc/webhooks/validating.kubeconfig"],
+	} {
+		if got := string(ac.Files[name]); got != want {
+			t.Errorf("%s: got %q, want: %q", name, got, want)
+		}
+	}
+	imagePolicy := string(ac.Files["tls/admission-imagepolicywebhook.yaml"])
+	if !strings.Contains(imagePolicy, "kubeConfigFile: /etc/kubernetes/secrets/admission-imagepolicywebhook-kubeconfig.yaml") {
+		t.Errorf("image policy config does not reference the mounted kubeconfig:\n%s", imagePolicy)
+	}
+	for _, ref := range []string{
+		"path: /etc/kubernetes/secrets/admission-imagepolicywebhook.yaml",
+		"kubeConfigFile: /etc/kubernetes/secrets/admission-validatingadmissionwebhook-kubeconfig.yaml",
+		"qps: 50",
+	} {
+		if !strings.Contains(string(ac.Config), ref) {
+			t.Errorf("admission config does not contain %q:\n%s", ref, ac.Config)
+		}
+	}
+
+	for _, c := range []string{
+		"kind: Policy\n",
+		"kind: AdmissionConfiguration\nplugins: []\n",
+		"kind: AdmissionConfiguration\nplugins:\n- path: x.yaml\n",
+		"kind: AdmissionConfiguration\nplugins:\n- name: ImagePolicyWebhook\n  path: missing.yaml\n",
+	} {
+		if _, err := NewAdmissionConfig([]byte(c), readFile); err == nil {
+			t.Errorf("expected error for config %q", c)
+		}
+	}
+}
+
+func TestAdmissionAssets(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.Admission = &AdmissionConfig{
+		Config:  []byte("kind: AdmissionConfiguration\n"),
+		Files:   map[string][]byte{"tls/admission-imagepolicywebhook-kubeconfig.yaml": []byte("kind: Config\n")},
+		Plugins: []string{"EventRateLimit", "ValidatingAdmissionWebhook"},
+	}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{AssetPathAPIServer, AssetPathBootstrapAPIServer} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, flag := range []string{
+			"--enable-admission-plugins=NamespaceLifecycle,LimitRanger,ServiceAccount,PersistentVolumeClaimResize,DefaultStorageClass,DefaultTolerationSeconds,MutatingAdmissionWebhook,ValidatingAdmissionWebhook,ResourceQuota,Priority,NodeRestriction,EventRateLimit\n",
+			"--admission-control-config-file=/etc/kubernetes/secrets/admission-config.yaml",
+		} {
+			if !strings.Contains(string(a.Data), flag) {
+				t.Errorf("%s does not contain %s", name, flag)
+			}
+		}
+	}
+
+	a, err := as.Get(AssetPathAPIServerSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s secret
+	if err := yaml.Unmarshal(a.Data, &s); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"admission-config.yaml":                        "kind: AdmissionConfiguration\n",
+		"admission-imagepolicywebhook-kubeconfig.yaml": "kind: Config\n",
+	} {
+		got, err := base64.StdEncoding.DecodeString(s.Data[key])
+		if err != nil || string(got) != want {
+			t.Errorf("apiserver secret %s: got %q (%v), want: %q", key, got, err, want)
+		}
+	}
+}
@@ -12,7 +12,12 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
 )
@@ -41,10 +46,25 @@ const (
 	AssetPathKubeletClientKey               = "tls/apiserver-kubelet-client.key"
 	AssetPathAdminKey                       = "tls/admin.key"
 	AssetPathAdminCert                      = "tls/admin.crt"
+	AssetPathAuditPolicy                    = "tls/audit-policy.yaml"
+	AssetPathAuditWebhookConfig             = "tls/audit-webhook-config.yaml"
+	AssetPathEncryptionConfig               = "tls/encryption-config.yaml"
+	AssetPathAdmissionConfig                = "tls/admission-config.yaml"
+	AssetPathOIDCCACert                     = "tls/oidc-ca.crt"
+	AssetPathCloudConfig                    = "tls/cloud-config"
+	AssetPathControllerManagerKubeConfig    = "tls/kube-controller-manager.kubeconfig"
+	AssetPathSchedulerKubeConfig            = "tls/kube-scheduler.kubeconfig"
 	AssetPathAdminKubeConfig                = "auth/kubeconfig"
 	AssetPathKubeletKubeConfig              = "auth/kubeconfig-kubelet"
+	AssetPathBootstrapKubeConfig            = "auth/kubeconfig-bootstrap"
+	AssetPathKubeletBundle                  = "kubelet"
+	AssetPathKubeletBundleKubeConfig        = "kubelet/kubeconfig"
+	AssetPathKubeletBundleCACert            = "kubelet/ca.crt"
+	AssetPathKubeletConfig                  = "kubelet/config.yaml"
+	AssetPathKubeletSystemdUnit             = "kubelet/kubelet.service"
 	AssetPathManifests                      = "manifests"
 	AssetPathKubeConfigInCluster            = "manifests/kubeconfig-in-cluster.yaml"
+	AssetPathKubeConfigInClusterCP          = "manifests/kubeconfig-in-cluster-control-plane.yaml"
 	AssetPathKubeletBootstrapToken          = "manifests/kubelet-bootstrap-token.yaml"
 	AssetPathProxy                          = "manifests/kube-proxy.yaml"
 	AssetPathProxySA                        = "manifests/kube-proxy-sa.yaml"
@@ -68,8 +88,58 @@ const (
 	AssetPathCalicoGlobalNetworkSetsCRD     = "manifests/calico-global-network-sets-crd.yaml"
 	AssetPathCalicoIPPoolsCRD               = "manifests/calico-ip-pools-crd.yaml"
 	AssetPathCalicoClusterInformationsCRD   = "manifests/calico-cluster-informations-crd.yaml"
+	AssetPathCilium                         = "manifests/cilium.yaml"
+	AssetPathCiliumCfg                      = "manifests/cilium-config.yaml"
+	AssetPathCiliumSA                       = "manifests/cilium-sa.yaml"
+	AssetPathCiliumClusterRole              = "manifests/cilium-cluster-role.yaml"
+	AssetPathCiliumClusterRoleBinding       = "manifests/cilium-cluster-role-binding.yaml"
+	AssetPathCiliumOperator                 = "manifests/cilium-operator.yaml"
+	AssetPathCiliumOperatorSA               = "manifests/cilium-operator-sa.yaml"
+	AssetPathCiliumOperatorClusterRole      = "manifests/cilium-operator-cluster-role.yaml"
+	AssetPathCiliumOperatorClusterRoleBind  = "manifests/cilium-operator-cluster-role-binding.yaml"
+	AssetPathWeaveNet                       = "manifests/weave-net.yaml"
+	AssetPathWeaveNetSA                     = "manifests/weave-net-sa.yaml"
+	AssetPathWeaveNetClusterRole            = "manifests/weave-net-cluster-role.yaml"
+	AssetPathWeaveNetClusterRoleBinding     = "manifests/weave-net-cluster-role-binding.yaml"
+	AssetPathWeaveNetRole                   = "manifests/weave-net-role.yaml"
+	AssetPathWeaveNetRoleBinding            = "manifests/weave-net-role-binding.yaml"
+	AssetPathWeaveNetPasswordSecret         = "manifests/weave-net-passwd-secret.yaml"
+	AssetPathKubeRouter                     = "manifests/kube-router.yaml"
+	AssetPathKubeRouterCfg                  = "manifests/kube-router-cfg.yaml"
+	AssetPathKubeRouterSA                   = "manifests/kube-router-sa.yaml"
+	AssetPathKubeRouterClusterRole          = "manifests/kube-router-cluster-role.yaml"
+	AssetPathKubeRouterClusterRoleBinding   = "manifests/kube-router-cluster-role-binding.yaml"
+	AssetPathExternalDNS                    = "manifests/external-dns.yaml"
+	AssetPathExternalDNSAPIServerService    = "manifests/external-dns-apiserver-service.yaml"
+	AssetPathExternalDNSSA                  = "manifests/external-dns-sa.yaml"
+	AssetPathExternalDNSClusterRole         = "manifests/external-dns-cluster-role.yaml"
+	AssetPathExternalDNSClusterRoleBinding  = "manifests/external-dns-cluster-role-binding.yaml"
+	AssetPathDNSAutoscaler                  = "manifests/dns-autoscaler.yaml"
+	AssetPathDNSAutoscalerConfig            = "manifests/dns-autoscaler-config.yaml"
+	AssetPathDNSAutoscalerSA                = "manifests/dns-autoscaler-sa.yaml"
+	AssetPathDNSAutoscalerClusterRole       = "manifests/dns-autoscaler-cluster-role.yaml"
+	AssetPathDNSAutoscalerClusterRoleBind   = "manifests/dns-autoscaler-cluster-role-binding.yaml"
+	AssetPathMetricsServer                  = "manifests/metrics-server.yaml"
+	AssetPathMetricsServerService           = "manifests/metrics-server-service.yaml"
+	AssetPathMetricsServerAPIService        = "manifests/metrics-server-apiservice.yaml"
+	AssetPathMetricsServerSA                = "manifests/metrics-server-sa.yaml"
+	AssetPathMetricsServerClusterRole       = "manifests/metrics-server-cluster-role.yaml"
+	AssetPathMetricsServerClusterRoleBind   = "manifests/metrics-server-cluster-role-binding.yaml"
+	AssetPathMetricsServerAggregatedRole    = "manifests/metrics-server-aggregated-cluster-role.yaml"
+	AssetPathMetricsServerAuthDelegator     = "manifests/metrics-server-auth-delegator.yaml"
+	AssetPathMetricsServerAuthReader        = "manifests/metrics-server-auth-reader.yaml"
 	AssetPathAPIServerSecret                = "manifests/kube-apiserver-secret.yaml"
 	AssetPathAPIServer                      = "manifests/kube-apiserver.yaml"
+	AssetPathAPIServerSA                    = "manifests/kube-apiserver-sa.yaml"
+	AssetPathAPIServerDisruption            = "manifests/kube-apiserver-disruption.yaml"
+	AssetPathPSPPrivileged                  = "manifests/psp-privileged.yaml"
+	AssetPathPSPBaseline                    = "manifests/psp-baseline.yaml"
+	AssetPathPSPPrivilegedClusterRole       = "manifests/psp-privileged-cluster-role.yaml"
+	AssetPathPSPBaselineClusterRole         = "manifests/psp-baseline-cluster-role.yaml"
+	AssetPathPSPBaselineBinding             = "manifests/psp-baseline-cluster-role-binding.yaml"
+	AssetPathPSPNodesBinding                = "manifests/psp-privileged-nodes-cluster-role-binding.yaml"
+	AssetPathPSPControlPlaneBinding         = "manifests/psp-privileged-control-plane-role-binding.yaml"
+	AssetPathPSPControlPlaneNSBinding       = "manifests/psp-privileged-control-plane-namespace-role-binding.yaml"
 	AssetPathControllerManager              = "manifests/kube-controller-manager.yaml"
 	AssetPathControllerManagerSA            = "manifests/kube-controller-manager-service-account.yaml"
 	AssetPathControllerManagerRB            = "manifests/kube-controller-manager-role-binding.yaml"
@@ -77,12 +147,17 @@ const (
 	AssetPathControllerManagerDisruption    = "manifests/kube-controller-manager-disruption.yaml"
 	AssetPathScheduler                      = "manifests/kube-scheduler.yaml"
 	AssetPathSchedulerDisruption            = "manifests/kube-scheduler-disruption.yaml"
+	AssetPathSchedulerSA                    = "manifests/kube-scheduler-sa.yaml"
+	AssetPathSchedulerRoleBinding           = "manifests/kube-scheduler-role-binding.yaml"
+	AssetPathSchedulerVolumeRoleBinding     = "manifests/kube-scheduler-volume-role-binding.yaml"
+	AssetPathAuthenticationReaderBinding    = "manifests/control-plane-authentication-reader-role-binding.yaml"
 	AssetPathCoreDNSClusterRoleBinding      = "manifests/coredns-cluster-role-binding.yaml"
 	AssetPathCoreDNSClusterRole             = "manifests/coredns-cluster-role.yaml"
 	AssetPathCoreDNSConfig                  = "manifests/coredns-config.yaml"
 	AssetPathCoreDNSDeployment              = "manifests/coredns-deployment.yaml"
 	AssetPathCoreDNSSA                      = "manifests/coredns-service-account.yaml"
 	AssetPathCoreDNSSvc                     = "manifests/coredns-service.yaml"
+	AssetPathCoreDNSDisruption              = "manifests/coredns-disruption.yaml"
 	AssetPathSystemNamespace                = "manifests/kube-system-ns.yaml"
 	AssetPathCheckpointer                   = "manifests/pod-checkpointer.yaml"
 	AssetPathCheckpointerSA                 = "manifests/pod-checkpointer-sa.yaml"
@@ -94,6 +169,7 @@ const (
 	AssetPathEtcdPeerSecret                 = "manifests/etcd-peer-tls.yaml"
 	AssetPathEtcdServerSecret               = "manifests/etcd-server-tls.yaml"
 	AssetPathCSRBootstrapRoleBinding        = "manifests/csr-bootstrap-role-binding.yaml"
+	AssetPathNodeRoleBinding                = "manifests/node-role-binding.yaml"
 	AssetPathCSRApproverRoleBinding         = "manifests/csr-approver-role-binding.yaml"
 	AssetPathCSRRenewalRoleBinding          = "manifests/csr-renewal-role-binding.yaml"
 	AssetPathKubeSystemSARoleBinding        = "manifests/kube-system-rbac-role-binding.yaml"
@@ -101,10 +177,23 @@ const (
 	AssetPathBootstrapAPIServer             = "bootstrap-manifests/bootstrap-apiserver.yaml"
 	AssetPathBootstrapControllerManager     = "bootstrap-manifests/bootstrap-controller-manager.yaml"
 	AssetPathBootstrapScheduler             = "bootstrap-manifests/bootstrap-scheduler.yaml"
+	AssetPathStaticManifests                = "static-manifests"
+	AssetPathStaticAPIServer                = "static-manifests/kube-apiserver.yaml"
+	AssetPathStaticControllerManager        = "static-manifests/kube-controller-manager.yaml"
+	AssetPathStaticScheduler                = "static-manifests/kube-scheduler.yaml"
 )
 
 var BootstrapSecretsDir = "/etc/kubernetes/bootstrap-secrets" // Overridden for testing.
 
+// StaticSecretsDir is the host directory of the TLS assets of a static control plane.
+var StaticSecretsDir = "/etc/kubernetes/secrets" // Overridden for testing.
+
+// DefaultKubeletBundleDir is the default directory of the nodes the join bundle is installed to.
+const DefaultKubeletBundleDir = "/etc/kubernetes/kubelet"
+
+// DefaultControlPlaneNamespace is the default namespace of the control plane.
+const DefaultControlPlaneNamespace = "kube-system"
+
 // AssetConfig holds all configuration needed when generating
 // the default set of assets.
 type Config struct {
@@ -127,6 +216,225 @@ type Config struct {
 	BootstrapSecretsSubdir string
 	Images                 ImageVersions
 
+	// CiliumKubeProxyReplacement is the kube-proxy-replacement mode of the cilium network provider.
+	CiliumKubeProxyReplacement string
+
+	// BootstrapKubeConfigTTL is the validity of the credential in the bootstrap kubeconfig.
+	// Defaults to DefaultBootstrapKubeConfigTTL.
+	BootstrapKubeConfigTTL time.Duration
+
+	// BootstrapTokenTTL is the validity of the bootstrap token kubelets join with. Zero means the
+	// token doesn't expire.
+	BootstrapTokenTTL time.Duration
+
+	// KubeRouterServiceProxy makes the kube-router network provider also act as the service proxy,
+	// in which case kube-proxy is not rendered.
+	KubeRouterServiceProxy bool
+
+	// WeaveEncryption generates a network password Secret that weave-net uses to encrypt traffic
+	// between nodes.
+	WeaveEncryption bool
+
+	// Front proxy (request header) authentication settings of the apiserver, comma separated.
+	// The upstream bootkube defaults are used when empty.
+	RequestHeaderAllowedNames       string
+	RequestHeaderUsernameHeaders    string
+	RequestHeaderGroupHeaders       string
+	RequestHeaderExtraHeadersPrefix string
+
+	// ExternalDNSProvider enables publishing the apiserver hostname (the host of the first
+	// APIServers URL) to ExternalDNSZone with external-dns. ExternalDNSTarget is the address the
+	// record points to, typically a load balancer or VIP.
+	ExternalDNSProvider string
+	ExternalDNSZone     string
+	ExternalDNSTarget   string
+
+	// DNSAutoscaler renders the cluster-proportional-autoscaler to scale the CoreDNS replicas
+	// with one replica per DNSAutoscalerCoresPerReplica cores or DNSAutoscalerNodesPerReplica
+	// nodes, whichever is more.
+	DNSAutoscaler                bool
+	DNSAutoscalerCoresPerReplica int
+	DNSAutoscalerNodesPerReplica int
+
+	// MetricsServer renders metrics-server behind the metrics.k8s.io APIService, for kubectl top
+	// and the HorizontalPodAutoscaler.
+	MetricsServer bool
+
+	// Audit enables apiserver audit logging to AuditLogPath on the master nodes, keeping logs
+	// for AuditLogMaxAge days. AuditPolicy defaults to a built-in policy. When
+	// AuditWebhookConfig (a kubeconfig file) is set, events are also sent to the webhook.
+	Audit              bool
+	AuditPolicy        []byte
+	AuditLogPath       string
+	AuditLogMaxAge     int
+	AuditWebhookConfig []byte
+
+	// EncryptionProvider enables encryption at rest of secrets with a generated key for this
+	// provider, EncryptionProviderAESCBC or EncryptionProviderSecretbox.
+	EncryptionProvider string
+
+	// Node resource settings of the KubeletConfiguration, keyed by eviction signal (e.g.
+	// memory.available) or resource name (e.g. cpu). KubeletEvictionSoftGracePeriod has a grace
+	// period for each soft eviction threshold.
+	KubeletEvictionHard            map[string]string
+	KubeletEvictionSoft            map[string]string
+	KubeletEvictionSoftGracePeriod map[string]string
+	KubeletSystemReserved          map[string]string
+	KubeletKubeReserved            map[string]string
+
+	// KubeletBundleDir is the directory of the nodes the join bundle is installed to, which the
+	// KubeletConfiguration and the kubelet unit reference. Defaults to DefaultKubeletBundleDir.
+	// KubeletCgroupDriver is the cgroup driver of the container runtime, cgroupfs or systemd.
+	// KubeletSystemdUnit also renders a systemd unit running the kubelet with the bundle.
+	KubeletBundleDir    string
+	KubeletCgroupDriver string
+	KubeletSystemdUnit  bool
+
+	// FeatureGates of the control plane components and of the kubelet of the join bundle.
+	FeatureGatesAPIServer         FeatureGates
+	FeatureGatesControllerManager FeatureGates
+	FeatureGatesScheduler         FeatureGates
+	FeatureGatesKubelet           FeatureGates
+
+	// Admission configures admission plugins of the apiserver. The plugins it configures are
+	// enabled.
+	Admission *AdmissionConfig
+
+	// CloudConfig is the configuration file of the CloudProvider integration of the apiserver and
+	// controller-manager.
+	CloudConfig []byte
+
+	// OIDCIssuerURL enables authenticating users with OpenID Connect ID tokens of the issuer for
+	// OIDCClientID. OIDCCACert is the CA of the issuer, the host's root CAs are used if unset.
+	OIDCIssuerURL     string
+	OIDCClientID      string
+	OIDCUsernameClaim string
+	OIDCGroupsClaim   string
+	OIDCCACert        []byte
+
+	// Extra flags of the bootstrap and self-hosted control plane components, by flag name without
+	// the leading dashes. They can't override the flags bootkube sets.
+	APIServerExtraFlags         map[string]string
+	ControllerManagerExtraFlags map[string]string
+	SchedulerExtraFlags         map[string]string
+
+	// PodSecurity restricts pods to the baseline Pod Security Standard with PodSecurityPolicies,
+	// exempting the self-hosted control plane and network provider. kube-system and
+	// PodSecurityNamespaces are also labeled for Pod Security admission.
+	PodSecurity           bool
+	PodSecurityNamespaces []string
+
+	// RBACProfile is RBACProfileStrict (the default when empty) or RBACProfileLegacy.
+	RBACProfile string
+
+	// SecurityProfile is SecurityProfileHardened (the default when empty) or
+	// SecurityProfileLegacy.
+	SecurityProfile string
+
+	// StaticControlPlane renders the apiserver, controller-manager and scheduler as permanent
+	// static pods reading the TLS assets from StaticSecretsDir, instead of a bootstrap control
+	// plane that pivots to a self-hosted one. Requires RBACProfileStrict.
+	StaticControlPlane bool
+
+	// ControlPlaneNodeSelector and ControlPlaneTolerations place the self-hosted apiserver,
+	// controller-manager, scheduler and pod checkpointer. When nil, they default to
+	// DefaultControlPlaneNodeSelector and DefaultControlPlaneTolerations.
+	ControlPlaneNodeSelector map[string]string
+	ControlPlaneTolerations  []corev1.Toleration
+
+	// BootstrapMasters are the addresses of the masters that bootstrap the self-hosted control
+	// plane at once, each running bootkube start with the same assets. They are added to the
+	// apiserver certificate and rendered to AssetPathBootstrapMasters.
+	BootstrapMasters []net.IP
+
+	// BootstrapAPIServerPort and BootstrapAdvertiseAddress are the secure port and the advertise
+	// address of the bootstrap apiserver, if they differ from the port of the first APIServers
+	// URL and the node IP, e.g. on a node that already serves that port. The kubeconfigs of
+	// bootkube start and the bootstrap control plane connect to them, see BootstrapAPIServerURL.
+	// BootstrapAdvertiseAddress is added to the apiserver certificate.
+	BootstrapAPIServerPort    int
+	BootstrapAdvertiseAddress net.IP
+
+	// Arch is the architecture of the control plane nodes, ArchAMD64 (the default when empty) or
+	// ArchARM64. The self-hosted control plane is pinned to nodes of it. Use SetArch to select
+	// its images.
+	Arch string
+
+	// APIServerLBAnnotations adds load balancer configuration guidance annotations to the
+	// apiserver DaemonSet.
+	APIServerLBAnnotations bool
+
+	// AnonymousAuth lets the apiservers serve anonymous requests, which RBAC limits to the health
+	// and version endpoints. The self-hosted apiserver then gets a liveness probe on /healthz.
+	AnonymousAuth bool
+
+	// DisableInsecurePort disables the insecure HTTP ports of the bootstrap and static apiserver,
+	// controller-manager and scheduler. The liveness probes of the self-hosted controller-manager
+	// and scheduler use their secure ports instead. The self-hosted apiserver never serves it.
+	DisableInsecurePort bool
+
+	// Konnectivity runs a konnectivity-server sidecar with the apiservers and a konnectivity-agent
+	// on every node, so that the apiservers reach the kubelets, webhooks and aggregated APIs
+	// through the connections of the agents instead of routing to the node and pod networks.
+	// Requires Kubernetes v1.18 or later.
+	Konnectivity bool
+
+	// EtcdBackup renders a CronJob on the control plane nodes taking periodic snapshots of the
+	// first of EtcdServers, kept on a PersistentVolumeClaim or uploaded to S3 or GCS. Disabled if
+	// nil. The snapshots can be restored by bootkube recover --etcd-snapshot.
+	EtcdBackup *EtcdBackupConfig
+
+	// ControlPlaneBackupPath renders a DaemonSet on the control plane nodes running bootkube
+	// backup, which keeps a backup of the control plane at this path of every node as it changes,
+	// for bootkube recover --backup. Disabled if empty.
+	ControlPlaneBackupPath string
+
+	// CheckpointInterval, CheckpointBackoff, MaxCheckpointBackoff, CheckpointAPIServerPollInterval
+	// and CheckpointKubeletPollInterval set the --checkpoint-interval, --checkpoint-backoff,
+	// --max-checkpoint-backoff, --apiserver-poll-interval and --kubelet-poll-interval flags of the
+	// pod checkpointer. Its defaults are used if zero.
+	CheckpointInterval              time.Duration
+	CheckpointBackoff               time.Duration
+	MaxCheckpointBackoff            time.Duration
+	CheckpointAPIServerPollInterval time.Duration
+	CheckpointKubeletPollInterval   time.Duration
+
+	// SchedulerConfig runs the schedulers with a KubeSchedulerConfiguration instead of flags,
+	// SchedulerConfiguration or a default one enabling leader election. The self-hosted
+	// scheduler reads it from a ConfigMap. The kubeconfig of its client connection is set by
+	// bootkube.
+	SchedulerConfig        bool
+	SchedulerConfiguration []byte
+
+	// DisableCSRAutoApproval leaves the client certificate CSRs of bootstrapping and renewing
+	// kubelets pending until approved, e.g. with kubectl certificate approve. The
+	// controller-manager signs approved CSRs with the cluster CA either way.
+	DisableCSRAutoApproval bool
+
+	// DisableNodeAuthorization authorizes the apiserver requests with RBAC only and doesn't enable
+	// the NodeRestriction admission plugin. Kubelets are then bound to the system:node role, which
+	// lets each of them modify the objects of every node. By default the Node authorizer and
+	// NodeRestriction limit kubelets, which authenticate as system:node:<node name> with the
+	// client certificates of their CSRs, to their own node and pods.
+	DisableNodeAuthorization bool
+
+	// Resources are the resource requests and limits of the control plane and pod checkpointer
+	// containers, keyed by one of ResourceComponents. The containers of other components are
+	// unbounded.
+	Resources map[string]ResourceRequirements
+
+	// ControlPlaneNamespace is the namespace of the control plane components, their secrets,
+	// service accounts and RBAC. Node agents, cluster addons and bootstrap tokens stay in
+	// kube-system. Defaults to DefaultControlPlaneNamespace.
+	ControlPlaneNamespace string
+
+	// PreservedTLS are the keys and certificates of a previous render, see LoadPreservedTLS. They
+	// are rendered again instead of new ones, which makes re-rendering unchanged inputs
+	// reproducible aside from the short-lived bootstrap credentials. PreservedTLS includes the
+	// CA, so it can't be combined with CACert. The etcd assets are only preserved if EtcdCACert is
+	// unset.
+	PreservedTLS Assets
+
 	// PodCIDR describes the networking subnet to be used for inter-pod networking.
 	//
 	// Deprecated: PodCIDR exists only for compatibility with older external
@@ -178,11 +486,164 @@ func (c Config) PodCIDRsString() string {
 	return joinStringsFromSliceOrSingle(stringerSlice(c.PodCIDRs), c.PodCIDR)
 }
 
+// SkipKubeProxy reports whether the network provider replaces kube-proxy, in which case the
+// kube-proxy manifests are not rendered.
+func (c Config) SkipKubeProxy() bool {
+	switch c.NetworkProvider {
+	case NetworkCilium:
+		return c.CiliumKubeProxyReplacement == CiliumKubeProxyReplacementStrict
+	case NetworkKubeRouter:
+		return c.KubeRouterServiceProxy
+	}
+	return false
+}
+
+// StrictRBAC reports whether the bootstrap control plane components authenticate with their own
+// client certificates and kube-system service accounts get no permissions by default.
+func (c Config) StrictRBAC() bool {
+	return c.RBACProfile != RBACProfileLegacy
+}
+
+// HardenedSecurity reports whether the control plane containers are rendered with the hardened
+// seccomp profile and security context.
+func (c Config) HardenedSecurity() bool {
+	return c.SecurityProfile != SecurityProfileLegacy
+}
+
+// ControlPlaneSecretsDir returns the host directory the static pods of the control plane read
+// their TLS assets and kubeconfigs from.
+func (c Config) ControlPlaneSecretsDir() string {
+	if c.StaticControlPlane {
+		return StaticSecretsDir
+	}
+	return path.Join("/etc/kubernetes", c.BootstrapSecretsSubdir)
+}
+
+// FeatureGates enables or disables Kubernetes features by name.
+type FeatureGates map[string]bool
+
+// String formats the feature gates as the value of a --feature-gates flag, sorted by name.
+func (f FeatureGates) String() string {
+	var gates []string
+	for gate, enabled := range f {
+		gates = append(gates, fmt.Sprintf("%s=%t", gate, enabled))
+	}
+	sort.Strings(gates)
+	return strings.Join(gates, ",")
+}
+
+// PodSecurityExemptServiceAccounts are the service accounts allowed to run privileged pods when
+// PodSecurity is set, by namespace: those of the control plane in ControlPlaneNamespace and those
+// of the node agents in kube-system.
+func (c Config) PodSecurityExemptServiceAccounts() map[string][]string {
+	sas := map[string][]string{
+		c.ControlPlaneNamespace: {"kube-apiserver", "kube-controller-manager", "pod-checkpointer"},
+	}
+	if c.EtcdBackup != nil {
+		// The snapshots are taken from the host network.
+		sas[c.ControlPlaneNamespace] = append(sas[c.ControlPlaneNamespace], "etcd-backup")
+	}
+	if c.ControlPlaneBackupPath != "" {
+		// The backup is written to the host.
+		sas[c.ControlPlaneNamespace] = append(sas[c.ControlPlaneNamespace], "control-plane-backup")
+	}
+	add := func(names ...string) {
+		sas["kube-system"] = append(sas["kube-system"], names...)
+	}
+	if !c.SkipKubeProxy() {
+		add("kube-proxy")
+	}
+	if c.Konnectivity {
+		add("konnectivity-agent")
+	}
+	switch c.NetworkProvider {
+	case NetworkFlannel:
+		add("flannel")
+	case NetworkCalico, NetworkCalicoExperimental, NetworkCanal:
+		add("calico-node")
+	case NetworkCilium:
+		add("cilium", "cilium-operator")
+	case NetworkWeaveNet:
+		add("weave-net")
+	case NetworkKubeRouter:
+		add("kube-router")
+	}
+	return sas
+}
+
+// AuditLogDir returns the directory of the audit log, which is mounted from the host.
+func (c Config) AuditLogDir() string {
+	return path.Dir(c.AuditLogPath)
+}
+
+// APIServerHostname returns the host of the first apiserver URL, which is the endpoint used in
+// the certificates and kubeconfigs.
+func (c Config) APIServerHostname() string {
+	if len(c.APIServers) == 0 {
+		return ""
+	}
+	return c.APIServers[0].Hostname()
+}
+
+// BootstrapSecurePort returns the secure port of the bootstrap apiserver.
+func (c Config) BootstrapSecurePort() string {
+	if c.BootstrapAPIServerPort != 0 {
+		return strconv.Itoa(c.BootstrapAPIServerPort)
+	}
+	if len(c.APIServers) == 0 {
+		return ""
+	}
+	return c.APIServers[0].Port()
+}
+
+// BootstrapAPIServerURL returns the URL bootkube start and the bootstrap control plane reach the
+// bootstrap apiserver at: the first APIServers URL with the host replaced by
+// BootstrapAdvertiseAddress and the port by BootstrapAPIServerPort, if they are set.
+func (c Config) BootstrapAPIServerURL() *url.URL {
+	if len(c.APIServers) == 0 {
+		return nil
+	}
+	u := *c.APIServers[0]
+	if c.BootstrapAPIServerPort == 0 && c.BootstrapAdvertiseAddress == nil {
+		return &u
+	}
+	host := u.Hostname()
+	if c.BootstrapAdvertiseAddress != nil {
+		host = c.BootstrapAdvertiseAddress.String()
+	}
+	u.Host = net.JoinHostPort(host, c.BootstrapSecurePort())
+	return &u
+}
+
+// PodCIDRIPv4 returns the IPv4 pod CIDR, for network providers that only support a single IPv4 pool.
+func (c Config) PodCIDRIPv4() string {
+	for _, n := range c.PodCIDRs {
+		if n.IP.To4() != nil {
+			return n.String()
+		}
+	}
+	if c.PodCIDR != nil {
+		return c.PodCIDR.String()
+	}
+	return ""
+}
+
 // APIServiceIPsString returns a "," concatenated string for the APIServiceIPs
 func (c Config) APIServiceIPsString() string {
 	return joinStringsFromSliceOrSingle(stringerSlice(c.APIServiceIPs), c.APIServiceIP)
 }
 
+// ClusterDNS returns the DNSServiceIPs, or the DNSServiceIP if there are none.
+func (c Config) ClusterDNS() []string {
+	if len(c.DNSServiceIPs) > 0 {
+		return stringerSlice(c.DNSServiceIPs)
+	}
+	if c.DNSServiceIP == nil {
+		return nil
+	}
+	return []string{c.DNSServiceIP.String()}
+}
+
 // DNSServiceIPsString returns a "," concatenated string for the DNSServiceIPs
 func (c Config) DNSServiceIPsString() string {
 	return joinStringsFromSliceOrSingle(stringerSlice(c.DNSServiceIPs), c.DNSServiceIP)
@@ -244,15 +705,28 @@ func containsNonLocalIPv6(in []net.IP) bool {
 
 // ImageVersions holds all the images (and their versions) that are rendered into the templates.
 type ImageVersions struct {
-	Etcd            string
-	Flannel         string
-	FlannelCNI      string
-	Calico          string
-	CalicoCNI       string
-	CoreDNS         string
-	Hyperkube       string
-	Kenc            string
-	PodCheckpointer string
+	Etcd               string
+	Flannel            string
+	FlannelCNI         string
+	Calico             string
+	CalicoCNI          string
+	Cilium             string
+	CiliumOperator     string
+	WeaveNet           string
+	WeaveNPC           string
+	KubeRouter         string
+	ExternalDNS        string
+	DNSAutoscaler      string
+	MetricsServer      string
+	KonnectivityServer string
+	KonnectivityAgent  string
+	AWSCLI             string
+	CloudSDK           string
+	Bootkube           string
+	CoreDNS            string
+	Hyperkube          string
+	Kenc               string
+	PodCheckpointer    string
 }
 
 // NewDefaultAssets returns a list of default assets, optionally
@@ -260,9 +734,45 @@ type ImageVersions struct {
 // TLS assets (certs, keys and secrets), and k8s component manifests.
 func NewDefaultAssets(conf Config) (Assets, error) {
 	conf.BootstrapSecretsSubdir = path.Base(BootstrapSecretsDir)
+	if conf.ControlPlaneNodeSelector == nil {
+		conf.ControlPlaneNodeSelector = DefaultControlPlaneNodeSelector
+	}
+	if conf.ControlPlaneTolerations == nil {
+		conf.ControlPlaneTolerations = DefaultControlPlaneTolerations
+	}
+	if conf.Arch == "" {
+		conf.Arch = ArchAMD64
+	}
+	if conf.KubeletBundleDir == "" {
+		conf.KubeletBundleDir = DefaultKubeletBundleDir
+	}
+	if conf.ControlPlaneNamespace == "" {
+		conf.ControlPlaneNamespace = DefaultControlPlaneNamespace
+	}
 
 	as := newStaticAssets(conf.Images)
 	as = append(as, newDynamicAssets(conf)...)
+	if err := checkExtraFlags(as, conf); err != nil {
+		return Assets{}, err
+	}
+	if err := checkArchImages(as, conf.Images, conf.Arch); err != nil {
+		return Assets{}, err
+	}
+	if conf.Konnectivity {
+		if err := checkKonnectivityVersion(conf.Images); err != nil {
+			return Assets{}, err
+		}
+	}
+	if conf.EtcdBackup != nil {
+		if err := conf.EtcdBackup.validate(); err != nil {
+			return Assets{}, err
+		}
+	}
+	if conf.ControlPlaneBackupPath != "" {
+		if err := validateControlPlaneBackupPath(conf.ControlPlaneBackupPath); err != nil {
+			return Assets{}, err
+		}
+	}
 
 	// Add kube-apiserver service IP
 	if len(conf.APIServiceIPs) > 0 {
@@ -270,22 +780,38 @@ func NewDefaultAssets(conf Config) (Assets, error) {
 	} else {
 		conf.AltNames.IPs = append(conf.AltNames.IPs, conf.APIServiceIP)
 	}
+	conf.AltNames.IPs = append(conf.AltNames.IPs, conf.BootstrapMasters...)
+	if conf.BootstrapAdvertiseAddress != nil {
+		conf.AltNames.IPs = append(conf.AltNames.IPs, conf.BootstrapAdvertiseAddress)
+	}
 
 	// Create a CA if none was provided.
-	if conf.CACert == nil {
+	if conf.PreservedTLS != nil {
+		if conf.CACert != nil {
+			return Assets{}, errors.New("a CA can't be provided along with preserved TLS assets")
+		}
+		var err error
+		conf.CAPrivKey, conf.CACert, err = preservedCA(conf.PreservedTLS)
+		if err != nil {
+			return Assets{}, err
+		}
+	} else if conf.CACert == nil {
 		var err error
 		conf.CAPrivKey, conf.CACert, err = newCACert()
 		if err != nil {
 			return Assets{}, err
 		}
 	}
+	if err := checkPreservedAPIServerCert(conf.PreservedTLS, *conf.AltNames); err != nil {
+		return Assets{}, err
+	}
 
 	// TLS assets
 	tlsAssets, err := newTLSAssets(conf.CACert, conf.CAPrivKey, *conf.AltNames)
 	if err != nil {
 		return Assets{}, err
 	}
-	as = append(as, tlsAssets...)
+	as = append(as, preserveTLS(tlsAssets, conf.PreservedTLS)...)
 
 	// etcd TLS assets.
 	if conf.EtcdUseTLS {
@@ -293,6 +819,9 @@ func NewDefaultAssets(conf Config) (Assets, error) {
 		if err != nil {
 			return Assets{}, err
 		}
+		if conf.EtcdCACert == nil {
+			etcdTLSAssets = preserveTLS(etcdTLSAssets, conf.PreservedTLS)
+		}
 		as = append(as, etcdTLSAssets...)
 	}
 
@@ -302,19 +831,99 @@ func NewDefaultAssets(conf Config) (Assets, error) {
 	}
 	as = append(as, kubeConfigAssets...)
 
-	// K8S APIServer secret
-	apiSecret, err := newAPIServerSecretAsset(as, conf.EtcdUseTLS)
+	kubeletAssets, err := newKubeletBundleAssets(as, conf)
 	if err != nil {
 		return Assets{}, err
 	}
-	as = append(as, apiSecret)
+	as = append(as, kubeletAssets...)
+
+	if conf.NetworkProvider == NetworkWeaveNet && conf.WeaveEncryption {
+		weaveSecret, err := newWeaveNetPasswordAsset()
+		if err != nil {
+			return Assets{}, err
+		}
+		as = append(as, weaveSecret)
+	}
+
+	// The audit and encryption configurations are files of the apiserver secret, so the bootstrap
+	// apiserver gets them from the bootstrap secrets too.
+	as = append(as, newAuditAssets(conf)...)
+	as = append(as, newAdmissionAssets(conf)...)
+	if conf.SchedulerConfig {
+		schedulerConfigAssets, err := newSchedulerConfigAssets(conf)
+		if err != nil {
+			return Assets{}, err
+		}
+		as = append(as, schedulerConfigAssets...)
+	}
+	if len(conf.CloudConfig) > 0 {
+		as = append(as, Asset{Name: AssetPathCloudConfig, Data: conf.CloudConfig})
+	}
+	if len(conf.OIDCCACert) > 0 {
+		as = append(as, Asset{Name: AssetPathOIDCCACert, Data: conf.OIDCCACert})
+	}
+
+	if conf.EncryptionProvider != "" {
+		encryptionConfig, ok := preservedEncryptionConfig(conf.PreservedTLS, conf.EncryptionProvider)
+		if !ok {
+			if encryptionConfig, err = newEncryptionConfigAsset(conf.EncryptionProvider); err != nil {
+				return Assets{}, err
+			}
+		}
+		as = append(as, encryptionConfig)
+	}
+
+	if conf.Konnectivity {
+		konnectivityTLSAssets, err := newKonnectivityTLSAssets(conf.CACert, conf.CAPrivKey, *conf.AltNames)
+		if err != nil {
+			return Assets{}, err
+		}
+		as = append(as, preserveTLS(konnectivityTLSAssets, conf.PreservedTLS)...)
+		konnectivityAssets, err := newKonnectivityAssets(as, conf)
+		if err != nil {
+			return Assets{}, err
+		}
+		as = append(as, konnectivityAssets...)
+	}
+
+	if conf.EtcdBackup != nil {
+		etcdBackupAssets, err := newEtcdBackupAssets(as, conf)
+		if err != nil {
+			return Assets{}, err
+		}
+		as = append(as, etcdBackupAssets...)
+	}
+	if conf.ControlPlaneBackupPath != "" {
+		as = append(as, newControlPlaneBackupAssets(conf)...)
+	}
+
+	// The secrets of the self-hosted apiserver and controller-manager. A static control plane
+	// reads the TLS assets from the host instead.
+	if !conf.StaticControlPlane {
+		apiSecret, err := newAPIServerSecretAsset(as, conf)
+		if err != nil {
+			return Assets{}, err
+		}
+		as = append(as, apiSecret)
+
+		cmSecret, err := newControllerManagerSecretAsset(as, conf)
+		if err != nil {
+			return Assets{}, err
+		}
+		as = append(as, cmSecret)
+	}
+
+	as = append(as, newImageListAsset(as))
+	if len(conf.BootstrapMasters) > 0 {
+		as = append(as, newBootstrapMastersAsset(conf.BootstrapMasters))
+	}
 
-	// K8S ControllerManager secret
-	cmSecret, err := newControllerManagerSecretAsset(as)
+	// Must be last, it lists the objects of all the manifests above.
+	uninstall, err := newUninstallAsset(as)
 	if err != nil {
 		return Assets{}, err
 	}
-	as = append(as, cmSecret)
+	as = append(as, uninstall)
 
 	return as, nil
 }
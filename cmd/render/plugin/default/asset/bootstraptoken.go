@@ -0,0 +1,43 @@
+package asset
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+)
+
+const (
+	// AssetPathClusterInfo is the cluster-info ConfigMap of kube-public, which joining nodes read
+	// the CA and apiserver URL of the cluster from.
+	AssetPathClusterInfo            = "manifests/cluster-info.yaml"
+	AssetPathClusterInfoRole        = "manifests/cluster-info-role.yaml"
+	AssetPathClusterInfoRoleBinding = "manifests/cluster-info-role-binding.yaml"
+
+	// CACertHashAnnotation is the annotation of the cluster-info ConfigMap with the CACertHash of
+	// the cluster CA, to pin the CA when reading cluster-info unauthenticated.
+	CACertHashAnnotation = "bootkube.alpha.kubernetes.io/ca-cert-hash"
+)
+
+const validBootstrapTokenChars = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// NewBootstrapToken constructs a bootstrap token in conformance with the following format:
+// https://kubernetes.io/docs/admin/bootstrap-tokens/#token-format
+func NewBootstrapToken() (id string, secret string, err error) {
+	// Read 6 random bytes for the id and 16 random bytes for the token (see spec for details).
+	token := make([]byte, 6+16)
+	if _, err := rand.Read(token); err != nil {
+		return "", "", err
+	}
+
+	for i, b := range token {
+		token[i] = validBootstrapTokenChars[int(b)%len(validBootstrapTokenChars)]
+	}
+	return string(token[:6]), string(token[6:]), nil
+}
+
+// CACertHash returns the SHA-256 hash of the public key of the CA certificate, in the
+// "sha256:<hex>" format kubeadm uses for --discovery-token-ca-cert-hash.
+func CACertHash(cert *x509.Certificate) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(cert.RawSubjectPublicKeyInfo))
+}
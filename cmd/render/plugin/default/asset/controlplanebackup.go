@@ -0,0 +1,59 @@
+package asset
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset/internal"
+)
+
+const (
+	AssetPathControlPlaneBackup              = "manifests/control-plane-backup.yaml"
+	AssetPathControlPlaneBackupSA            = "manifests/control-plane-backup-sa.yaml"
+	AssetPathControlPlaneBackupClusterRole   = "manifests/control-plane-backup-cluster-role.yaml"
+	AssetPathControlPlaneBackupRoleBinding   = "manifests/control-plane-backup-role-binding.yaml"
+	AssetPathControlPlaneBackupNSRoleBinding = "manifests/control-plane-backup-namespace-role-binding.yaml"
+)
+
+// validateControlPlaneBackupPath returns an error if the backup can't be written to p on the host.
+func validateControlPlaneBackupPath(p string) error {
+	if !path.IsAbs(p) || path.Clean(p) != p || path.Dir(p) == "/" {
+		return fmt.Errorf("invalid control plane backup path %q, want an absolute path below a directory of the host", p)
+	}
+	return nil
+}
+
+// ControlPlaneBackupDir returns the directory of the host the backup is written to.
+func (c Config) ControlPlaneBackupDir() string {
+	return path.Dir(c.ControlPlaneBackupPath)
+}
+
+// ControlPlaneBackupFile returns the file name of the backup.
+func (c Config) ControlPlaneBackupFile() string {
+	return path.Base(c.ControlPlaneBackupPath)
+}
+
+// newControlPlaneBackupAssets renders the DaemonSet running bootkube backup on the control plane
+// nodes, its service account, and the role reading the control plane in kube-system and
+// ControlPlaneNamespace.
+func newControlPlaneBackupAssets(conf Config) []Asset {
+	assets := []Asset{
+		MustCreateAssetFromTemplate(AssetPathControlPlaneBackup, internal.ControlPlaneBackupTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathControlPlaneBackupSA, internal.ControlPlaneBackupServiceAccount, conf),
+		MustCreateAssetFromTemplate(AssetPathControlPlaneBackupClusterRole, internal.ControlPlaneBackupClusterRole, conf),
+		newControlPlaneBackupRoleBindingAsset(AssetPathControlPlaneBackupRoleBinding, "kube-system", conf.ControlPlaneNamespace),
+	}
+	if conf.ControlPlaneNamespace != "kube-system" {
+		assets = append(assets, newControlPlaneBackupRoleBindingAsset(AssetPathControlPlaneBackupNSRoleBinding, conf.ControlPlaneNamespace, conf.ControlPlaneNamespace))
+	}
+	return assets
+}
+
+// newControlPlaneBackupRoleBindingAsset binds the role of the backup in the namespace ns to the
+// service account of the backup in saNamespace.
+func newControlPlaneBackupRoleBindingAsset(path, ns, saNamespace string) Asset {
+	return MustCreateAssetFromTemplate(path, internal.ControlPlaneBackupRoleBinding, struct {
+		Namespace               string
+		ServiceAccountNamespace string
+	}{ns, saNamespace})
+}
@@ -0,0 +1,187 @@
+package asset
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	defaultRegistry         = "docker.io"
+	defaultRegistryEndpoint = "registry-1.docker.io"
+)
+
+// manifestMediaTypes are the manifest formats accepted when resolving a tag. Manifest lists are
+// preferred so that the pinned digest stays valid for every architecture.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// DigestResolver resolves an image reference to the digest of the manifest it currently points
+// to, e.g. "sha256:...".
+type DigestResolver interface {
+	Resolve(image string) (string, error)
+}
+
+// PinImageDigests returns a copy of images where every image the manifests of as reference, as
+// listed in images.txt, is pinned as "<name>:<tag>@<digest>". The tag is kept for readability, the
+// container runtime pulls by digest. Images that are already pinned or not used by the manifests
+// are left untouched, so that their registries don't have to be reachable.
+func PinImageDigests(images ImageVersions, as Assets, r DigestResolver) (ImageVersions, error) {
+	used := map[string]bool{}
+	for _, image := range strings.Fields(string(newImageListAsset(as).Data)) {
+		used[image] = true
+	}
+	v := reflect.ValueOf(&images).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		image := f.String()
+		if !used[image] || strings.Contains(image, "@") {
+			continue
+		}
+		digest, err := r.Resolve(image)
+		if err != nil {
+			return images, fmt.Errorf("failed to resolve digest of %s image %s: %v", v.Type().Field(i).Name, image, err)
+		}
+		f.SetString(image + "@" + digest)
+	}
+	return images, nil
+}
+
+// NewRegistryDigestResolver returns a DigestResolver that queries the image's registry through
+// the Docker Registry HTTP API V2. Anonymous bearer token authentication is supported.
+func NewRegistryDigestResolver(client *http.Client) DigestResolver {
+	return &registryDigestResolver{client: client}
+}
+
+type registryDigestResolver struct {
+	client *http.Client
+}
+
+func (r *registryDigestResolver) Resolve(image string) (string, error) {
+	registry, repository, reference := parseImageReference(image)
+	if registry == defaultRegistry {
+		registry = defaultRegistryEndpoint
+	}
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repository, reference)
+
+	resp, err := r.getManifest(url, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		token, err := r.token(resp.Header.Get("Www-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+		if resp, err = r.getManifest(url, token); err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	// The registry isn't required to return the digest, compute it from the manifest instead.
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+func (r *registryDigestResolver) getManifest(url, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ","))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r.client.Do(req)
+}
+
+// token fetches an anonymous bearer token for the challenge of a WWW-Authenticate header.
+func (r *registryDigestResolver) token(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, p := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry authentication challenge %q has no realm", challenge)
+	}
+	req, err := http.NewRequest(http.MethodGet, realm, nil)
+	if err != nil {
+		return "", err
+	}
+	q := req.URL.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	req.URL.RawQuery = q.Encode()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", realm, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return "", err
+	}
+	if t.Token != "" {
+		return t.Token, nil
+	}
+	return t.AccessToken, nil
+}
+
+// parseImageReference splits an image reference into registry, repository and tag, applying the
+// same defaults as docker: "etcd" is "docker.io/library/etcd:latest".
+func parseImageReference(image string) (registry, repository, tag string) {
+	registry = defaultRegistry
+	repository = image
+	if i := strings.Index(image, "/"); i >= 0 {
+		if first := image[:i]; strings.ContainsAny(first, ".:") || first == "localhost" {
+			registry, repository = first, image[i+1:]
+		}
+	}
+	tag = "latest"
+	if i := strings.LastIndex(repository, ":"); i >= 0 {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	if registry == defaultRegistry && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return registry, repository, tag
+}
@@ -0,0 +1,135 @@
+package asset
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+func TestParseImageReference(t *testing.T) {
+	for _, tc := range []struct {
+		image, registry, repository, tag string
+	}{
+		{"etcd", "docker.io", "library/etcd", "latest"},
+		{"weaveworks/weave-kube:2.7.0", "docker.io", "weaveworks/weave-kube", "2.7.0"},
+		{"quay.io/coreos/etcd:v3.3.12", "quay.io", "coreos/etcd", "v3.3.12"},
+		{"localhost:5000/hyperkube:v1.16.2", "localhost:5000", "hyperkube", "v1.16.2"},
+		{"k8s.gcr.io/coredns", "k8s.gcr.io", "coredns", "latest"},
+	} {
+		registry, repository, tag := parseImageReference(tc.image)
+		if registry != tc.registry || repository != tc.repository || tag != tc.tag {
+			t.Errorf("%s: got %s %s %s, want: %s %s %s", tc.image, registry, repository, tag, tc.registry, tc.repository, tc.tag)
+		}
+	}
+}
+
+type fakeResolver map[string]string
+
+func (r fakeResolver) Resolve(image string) (string, error) {
+	digest, ok := r[image]
+	if !ok {
+		return "", fmt.Errorf("%s not found", image)
+	}
+	return digest, nil
+}
+
+func TestPinImageDigests(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.Images.Hyperkube += "@sha256:1111"
+	unpinned, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := strings.Fields(string(newImageListAsset(unpinned).Data))
+	r := fakeResolver{}
+	for _, image := range used {
+		r[image] = "sha256:2222"
+	}
+	// The images of other network providers and addons aren't used, and their registries are
+	// unreachable.
+	if r[conf.Images.Cilium] != "" || r[conf.Images.AWSCLI] != "" {
+		t.Fatalf("images %s and %s are unexpectedly used by a flannel render", conf.Images.Cilium, conf.Images.AWSCLI)
+	}
+
+	pinned, err := PinImageDigests(conf.Images, unpinned, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := conf.Images.CoreDNS + "@sha256:2222"; pinned.CoreDNS != want {
+		t.Errorf("CoreDNS: got %s, want: %s", pinned.CoreDNS, want)
+	}
+	if pinned.Hyperkube != conf.Images.Hyperkube {
+		t.Errorf("already pinned image changed to %s", pinned.Hyperkube)
+	}
+	if pinned.Cilium != conf.Images.Cilium || pinned.AWSCLI != conf.Images.AWSCLI {
+		t.Errorf("unused images changed to %s and %s", pinned.Cilium, pinned.AWSCLI)
+	}
+	if strings.Contains(conf.Images.CoreDNS, "@") {
+		t.Errorf("input images modified")
+	}
+
+	// Every image of the manifests rendered with the pinned images is pinned.
+	pinnedConf := conf
+	pinnedConf.Images = pinned
+	as, err := NewDefaultAssets(pinnedConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range strings.Fields(string(newImageListAsset(as).Data)) {
+		if !strings.Contains(image, "@") {
+			t.Errorf("image %s of the manifests isn't pinned", image)
+		}
+	}
+
+	delete(r, conf.Images.CoreDNS)
+	if _, err := PinImageDigests(conf.Images, unpinned, r); err == nil || !strings.Contains(err.Error(), "CoreDNS") {
+		t.Errorf("expected error naming the unresolved image, got: %v", err)
+	}
+}
+
+func TestRegistryDigestResolver(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.URL.Query().Get("scope") != "repository:coreos/etcd:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "secret"}`)
+		case "/v2/coreos/etcd/manifests/v3.3.12":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:coreos/etcd:pull"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), "manifest.list") {
+				http.Error(w, "manifest lists not accepted", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:abcd")
+			fmt.Fprint(w, "{}")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	r := NewRegistryDigestResolver(srv.Client())
+	registry := strings.TrimPrefix(srv.URL, "https://")
+	digest, err := r.Resolve(registry + "/coreos/etcd:v3.3.12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "sha256:abcd" {
+		t.Errorf("got digest %s, want: sha256:abcd", digest)
+	}
+	if _, err := r.Resolve(registry + "/coreos/etcd:missing"); err == nil {
+		t.Error("expected error for missing tag")
+	}
+}
@@ -0,0 +1,155 @@
+package asset
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset/internal"
+)
+
+const (
+	AssetPathEtcdBackupCredentials   = "tls/etcd-backup-credentials"
+	AssetPathEtcdBackup              = "manifests/etcd-backup.yaml"
+	AssetPathEtcdBackupSA            = "manifests/etcd-backup-sa.yaml"
+	AssetPathEtcdBackupSecret        = "manifests/etcd-backup-secret.yaml"
+	AssetPathEtcdBackupVolumeClaim   = "manifests/etcd-backup-pvc.yaml"
+	secretEtcdBackupName             = "etcd-backup"
+	defaultEtcdBackupRetain          = 7
+	defaultEtcdBackupVolumeClaimSize = "10Gi"
+)
+
+// The destinations of the etcd snapshots of EtcdBackupConfig.
+const (
+	EtcdBackupPVC = "pvc"
+	EtcdBackupS3  = "s3"
+	EtcdBackupGCS = "gcs"
+)
+
+// EtcdBackupConfig configures the CronJob taking etcd snapshots of the cluster.
+type EtcdBackupConfig struct {
+	// Schedule is the cron schedule of the snapshots, e.g. "0 */6 * * *".
+	Schedule string
+	// Destination is where the snapshots are stored: EtcdBackupPVC, EtcdBackupS3 or
+	// EtcdBackupGCS.
+	Destination string
+
+	// Retain is how many snapshots are kept on the PersistentVolumeClaim, 7 if zero. Object
+	// storage expires snapshots with the lifecycle rules of its bucket instead.
+	Retain int
+	// VolumeClaimSize and StorageClass are those of the PersistentVolumeClaim, 10Gi and the
+	// default StorageClass if empty.
+	VolumeClaimSize string
+	StorageClass    string
+
+	// URL is the s3:// or gs:// bucket URL of the snapshots, optionally with a path prefix.
+	URL string
+	// Region is the region of the S3 bucket, if the credentials don't set it.
+	Region string
+	// Credentials is an AWS shared credentials file or a GCP service account key, depending on
+	// the Destination. If unset, the credentials of the control plane nodes are used, like an
+	// instance profile or the default service account of the instance.
+	Credentials []byte
+}
+
+// validate returns an error if the configuration of the etcd snapshots is incomplete.
+func (c *EtcdBackupConfig) validate() error {
+	if c.Schedule == "" {
+		return errors.New("the etcd backup needs a schedule")
+	}
+	if len(strings.Fields(c.Schedule)) != 5 && !strings.HasPrefix(c.Schedule, "@") {
+		return fmt.Errorf("invalid etcd backup schedule %q, want a cron schedule of 5 fields", c.Schedule)
+	}
+	switch c.Destination {
+	case EtcdBackupPVC:
+		if c.URL != "" || len(c.Credentials) > 0 {
+			return errors.New("etcd backups to a PersistentVolumeClaim have no URL or credentials")
+		}
+		if c.Retain < 0 {
+			return errors.New("the number of etcd snapshots to retain must not be negative")
+		}
+		if c.VolumeClaimSize != "" {
+			if _, err := resource.ParseQuantity(c.VolumeClaimSize); err != nil {
+				return fmt.Errorf("invalid etcd backup volume size %q: %v", c.VolumeClaimSize, err)
+			}
+		}
+	case EtcdBackupS3, EtcdBackupGCS:
+		scheme := map[string]string{EtcdBackupS3: "s3", EtcdBackupGCS: "gs"}[c.Destination]
+		u, err := url.Parse(c.URL)
+		if err != nil || u.Scheme != scheme || u.Host == "" {
+			return fmt.Errorf("invalid etcd backup URL %q, want %s://<bucket>[/<prefix>]", c.URL, scheme)
+		}
+		if c.Region != "" && c.Destination != EtcdBackupS3 {
+			return errors.New("only etcd backups to S3 have a region")
+		}
+	default:
+		return fmt.Errorf("invalid etcd backup destination %q, want %s, %s or %s", c.Destination, EtcdBackupPVC, EtcdBackupS3, EtcdBackupGCS)
+	}
+	return nil
+}
+
+// EtcdBackupEndpoint returns the etcd server the snapshots are taken from, the first of
+// EtcdServers: etcdctl snapshots a single member.
+func (c Config) EtcdBackupEndpoint() string {
+	if len(c.EtcdServers) == 0 {
+		return ""
+	}
+	return c.EtcdServers[0].String()
+}
+
+// EtcdBackupURL returns the bucket URL of the snapshots without a trailing slash.
+func (c Config) EtcdBackupURL() string {
+	if c.EtcdBackup == nil {
+		return ""
+	}
+	return strings.TrimSuffix(c.EtcdBackup.URL, "/")
+}
+
+// EtcdBackupRetain returns how many snapshots are kept on the PersistentVolumeClaim.
+func (c Config) EtcdBackupRetain() int {
+	if c.EtcdBackup == nil || c.EtcdBackup.Retain == 0 {
+		return defaultEtcdBackupRetain
+	}
+	return c.EtcdBackup.Retain
+}
+
+// EtcdBackupVolumeClaimSize returns the size of the PersistentVolumeClaim of the snapshots.
+func (c Config) EtcdBackupVolumeClaimSize() string {
+	if c.EtcdBackup == nil || c.EtcdBackup.VolumeClaimSize == "" {
+		return defaultEtcdBackupVolumeClaimSize
+	}
+	return c.EtcdBackup.VolumeClaimSize
+}
+
+// newEtcdBackupAssets renders the CronJob taking the etcd snapshots, its service account, the
+// Secret with the etcd client certificate and the credentials of the destination, and the
+// PersistentVolumeClaim of the snapshots for EtcdBackupPVC.
+func newEtcdBackupAssets(as Assets, conf Config) ([]Asset, error) {
+	var secretAssets []string
+	if conf.EtcdUseTLS {
+		secretAssets = append(secretAssets, AssetPathEtcdClientCA, AssetPathEtcdClientCert, AssetPathEtcdClientKey)
+	}
+	var assets []Asset
+	if len(conf.EtcdBackup.Credentials) > 0 {
+		credentials := Asset{Name: AssetPathEtcdBackupCredentials, Data: conf.EtcdBackup.Credentials}
+		assets = append(assets, credentials)
+		as = append(as, credentials)
+		secretAssets = append(secretAssets, AssetPathEtcdBackupCredentials)
+	}
+	secret, err := secretFromAssets(secretEtcdBackupName, conf.ControlPlaneNamespace, secretAssets, as)
+	if err != nil {
+		return nil, err
+	}
+	assets = append(assets,
+		MustCreateAssetFromTemplate(AssetPathEtcdBackup, internal.EtcdBackupCronJobTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathEtcdBackupSA, internal.EtcdBackupServiceAccountTemplate, conf),
+		Asset{Name: AssetPathEtcdBackupSecret, Data: secret},
+	)
+	if conf.EtcdBackup.Destination == EtcdBackupPVC {
+		assets = append(assets, MustCreateAssetFromTemplate(AssetPathEtcdBackupVolumeClaim, internal.EtcdBackupVolumeClaimTemplate, conf))
+	}
+	return assets, nil
+}
@@ -0,0 +1,86 @@
+package asset
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// checkExtraFlags returns an error if an extra flag of a control plane component is one bootkube
+// already sets in the rendered manifests of the component.
+func checkExtraFlags(as Assets, conf Config) error {
+	for _, c := range []struct {
+		container string
+		extra     map[string]string
+		paths     []string
+		static    string
+	}{
+		{"kube-apiserver", conf.APIServerExtraFlags, []string{AssetPathAPIServer, AssetPathBootstrapAPIServer}, AssetPathStaticAPIServer},
+		{"kube-controller-manager", conf.ControllerManagerExtraFlags, []string{AssetPathControllerManager, AssetPathBootstrapControllerManager}, AssetPathStaticControllerManager},
+		{"kube-scheduler", conf.SchedulerExtraFlags, []string{AssetPathScheduler, AssetPathBootstrapScheduler}, AssetPathStaticScheduler},
+	} {
+		if len(c.extra) == 0 {
+			continue
+		}
+		if conf.StaticControlPlane {
+			c.paths = []string{c.static}
+		}
+		for _, p := range c.paths {
+			a, err := as.Get(p)
+			if err != nil {
+				return err
+			}
+			command, err := containerCommand(a.Data, c.container)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %v", p, err)
+			}
+			count := map[string]int{}
+			for _, arg := range command {
+				if strings.HasPrefix(arg, "--") {
+					count[strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)[0]]++
+				}
+			}
+			var conflicts []string
+			for flag := range c.extra {
+				if count[flag] > 1 {
+					conflicts = append(conflicts, "--"+flag)
+				}
+			}
+			if len(conflicts) > 0 {
+				sort.Strings(conflicts)
+				return fmt.Errorf("extra %s flags %s are set by bootkube in %s", c.container, strings.Join(conflicts, ", "), p)
+			}
+		}
+	}
+	return nil
+}
+
+// containerCommand returns the command of the named container of a pod or of the pod template
+// of a workload.
+func containerCommand(manifest []byte, container string) ([]string, error) {
+	type podSpec struct {
+		Containers []struct {
+			Name    string   `json:"name"`
+			Command []string `json:"command"`
+		} `json:"containers"`
+	}
+	var m struct {
+		Spec struct {
+			podSpec
+			Template struct {
+				Spec podSpec `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(manifest, &m); err != nil {
+		return nil, err
+	}
+	for _, c := range append(m.Spec.Containers, m.Spec.Template.Spec.Containers...) {
+		if c.Name == container {
+			return c.Command, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s container", container)
+}
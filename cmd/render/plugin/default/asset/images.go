@@ -1,13 +1,145 @@
 package asset
 
-// DefaultImages are the defualt images bootkube components use.
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/version"
+)
+
+// DefaultImages are the defualt images bootkube components use. The bootkube image is that of this
+// release.
 var DefaultImages = ImageVersions{
-	Etcd:            "quay.io/coreos/etcd:v3.3.12",
-	Flannel:         "quay.io/coreos/flannel:v0.11.0-amd64",
-	FlannelCNI:      "quay.io/coreos/flannel-cni:v0.3.0",
-	Calico:          "quay.io/calico/node:v3.0.3",
-	CalicoCNI:       "quay.io/calico/cni:v2.0.0",
-	CoreDNS:         "k8s.gcr.io/coredns:1.6.5",
-	Hyperkube:       "k8s.gcr.io/hyperkube:v1.16.2",
-	PodCheckpointer: "quay.io/coreos/pod-checkpointer:83e25e5968391b9eb342042c435d1b3eeddb2be1",
+	Etcd:               "quay.io/coreos/etcd:v3.3.12",
+	Flannel:            "quay.io/coreos/flannel:v0.11.0-amd64",
+	FlannelCNI:         "quay.io/coreos/flannel-cni:v0.3.0",
+	Calico:             "quay.io/calico/node:v3.0.3",
+	CalicoCNI:          "quay.io/calico/cni:v2.0.0",
+	Cilium:             "quay.io/cilium/cilium:v1.8.2",
+	CiliumOperator:     "quay.io/cilium/operator-generic:v1.8.2",
+	WeaveNet:           "docker.io/weaveworks/weave-kube:2.7.0",
+	WeaveNPC:           "docker.io/weaveworks/weave-npc:2.7.0",
+	KubeRouter:         "docker.io/cloudnativelabs/kube-router:v1.1.0",
+	ExternalDNS:        "k8s.gcr.io/external-dns/external-dns:v0.7.3",
+	DNSAutoscaler:      "k8s.gcr.io/cpa/cluster-proportional-autoscaler-amd64:1.8.1",
+	MetricsServer:      "k8s.gcr.io/metrics-server/metrics-server:v0.3.7",
+	KonnectivityServer: "k8s.gcr.io/kas-network-proxy/proxy-server:v0.0.12",
+	KonnectivityAgent:  "k8s.gcr.io/kas-network-proxy/proxy-agent:v0.0.12",
+	AWSCLI:             "docker.io/amazon/aws-cli:2.0.50",
+	CloudSDK:           "gcr.io/google.com/cloudsdktool/cloud-sdk:310.0.0-alpine",
+	Bootkube:           "quay.io/coreos/bootkube:" + version.Version,
+	CoreDNS:            "k8s.gcr.io/coredns:1.6.5",
+	Hyperkube:          "k8s.gcr.io/hyperkube:v1.16.2",
+	PodCheckpointer:    "quay.io/coreos/pod-checkpointer:83e25e5968391b9eb342042c435d1b3eeddb2be1",
+}
+
+// SetImageRepository returns a copy of images where every image is pulled from repository
+// instead, e.g. "k8s.gcr.io/hyperkube:v1.16.2" from "registry.internal/k8s/hyperkube:v1.16.2".
+// Tags and digests are kept.
+func SetImageRepository(images ImageVersions, repository string) ImageVersions {
+	repository = strings.TrimSuffix(repository, "/")
+	v := reflect.ValueOf(&images).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if image := f.String(); image != "" {
+			f.SetString(repository + "/" + path.Base(image))
+		}
+	}
+	return images
+}
+
+// AssetPathImages lists the images of the rendered manifests.
+const AssetPathImages = "images.txt"
+
+var imagePattern = regexp.MustCompile(`(?m)^\s*(?:-\s+)?image:\s*["']?([^"'\s]+)`)
+
+// newImageListAsset lists the images of the manifests in as, one per line, for pre-pulling or
+// mirroring them.
+func newImageListAsset(as Assets) Asset {
+	seen := map[string]bool{}
+	var images []string
+	for _, a := range as {
+		switch path.Dir(a.Name) {
+		case AssetPathManifests, AssetPathBootstrapManifests, AssetPathStaticManifests:
+		default:
+			continue
+		}
+		for _, m := range imagePattern.FindAllSubmatch(a.Data, -1) {
+			if image := string(m[1]); !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+	sort.Strings(images)
+	var b bytes.Buffer
+	for _, image := range images {
+		fmt.Fprintln(&b, image)
+	}
+	return Asset{Name: AssetPathImages, Data: b.Bytes()}
+}
+
+// Architectures of the nodes images are rendered for.
+const (
+	ArchAMD64 = "amd64"
+	ArchARM64 = "arm64"
+)
+
+// SetArch returns a copy of images where the default images published per architecture are
+// replaced by their build for arch, e.g. "quay.io/coreos/flannel:v0.11.0-arm64". The other default
+// images are manifest lists. Images from other repositories are kept.
+func SetArch(images ImageVersions, arch string) ImageVersions {
+	if arch == ArchAMD64 {
+		return images
+	}
+	for _, i := range []struct {
+		image, defaultImage *string
+	}{
+		{&images.Flannel, &DefaultImages.Flannel},
+		{&images.DNSAutoscaler, &DefaultImages.DNSAutoscaler},
+	} {
+		if imageName(*i.image) == imageName(*i.defaultImage) {
+			*i.image = strings.Replace(*i.image, "-"+ArchAMD64, "-"+arch, 1)
+		}
+	}
+	// etcd images of other architectures have a suffixed tag.
+	if imageName(images.Etcd) == imageName(DefaultImages.Etcd) && !strings.HasSuffix(images.Etcd, "-"+arch) {
+		images.Etcd += "-" + arch
+	}
+	return images
+}
+
+// checkArchImages returns an error if a default image that is only published for amd64 is used by
+// the manifests of as.
+func checkArchImages(as Assets, images ImageVersions, arch string) error {
+	if arch == ArchAMD64 {
+		return nil
+	}
+	used := map[string]bool{}
+	for _, image := range strings.Fields(string(newImageListAsset(as).Data)) {
+		used[image] = true
+	}
+	for _, name := range []string{"FlannelCNI", "Calico", "CalicoCNI", "PodCheckpointer", "Bootkube"} {
+		image := reflect.ValueOf(images).FieldByName(name).String()
+		defaultImage := reflect.ValueOf(DefaultImages).FieldByName(name).String()
+		// Mirrored images keep their name and tag.
+		if used[image] && path.Base(strings.SplitN(image, "@", 2)[0]) == path.Base(defaultImage) {
+			return fmt.Errorf("image %s is only published for %s, set an %s image as %s in --config", image, ArchAMD64, arch, name)
+		}
+	}
+	return nil
+}
+
+// imageName returns image without its tag and digest.
+func imageName(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
 }
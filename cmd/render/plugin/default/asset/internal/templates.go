@@ -21,6 +21,28 @@ contexts:
 current-context: admin@{{ or .Cluster "local" }}
 `)
 
+// BootstrapKubeConfigTemplate is the short-lived kubeconfig used by bootkube start and the
+// bootstrap control plane.
+var BootstrapKubeConfigTemplate = []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: {{ or .Cluster "local" }}
+  cluster:
+    server: {{ .BootstrapServer }}
+    certificate-authority-data: {{ .CACert }}
+users:
+- name: bootkube
+  user:
+    client-certificate-data: {{ .BootstrapCert }}
+    client-key-data: {{ .BootstrapKey }}
+contexts:
+- context:
+    cluster: {{ or .Cluster "local" }}
+    user: bootkube
+  name: bootkube@{{ or .Cluster "local" }}
+current-context: bootkube@{{ or .Cluster "local" }}
+`)
+
 var KubeletKubeConfigTemplate = []byte(`apiVersion: v1
 kind: Config
 clusters:
@@ -38,6 +60,103 @@ contexts:
     user: kubelet
 `)
 
+// KubeletConfigTemplate is the KubeletConfiguration of the worker join bundle. Settings left out
+// use the kubelet defaults or its command line flags.
+var KubeletConfigTemplate = []byte(`apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+    enabled: true
+  x509:
+    clientCAFile: {{ .KubeletBundleDir }}/ca.crt
+authorization:
+  mode: Webhook
+{{- with .KubeletCgroupDriver }}
+cgroupDriver: {{ . }}
+{{- end }}
+{{- with .ClusterDNS }}
+clusterDNS:
+{{- range . }}
+- {{ . }}
+{{- end }}
+{{- end }}
+clusterDomain: cluster.local
+rotateCertificates: true
+staticPodPath: /etc/kubernetes/manifests
+{{- with .KubeletEvictionHard }}
+evictionHard:
+{{- range $signal, $threshold := . }}
+  {{ $signal }}: {{ printf "%q" $threshold }}
+{{- end }}
+{{- end }}
+{{- with .KubeletEvictionSoft }}
+evictionSoft:
+{{- range $signal, $threshold := . }}
+  {{ $signal }}: {{ printf "%q" $threshold }}
+{{- end }}
+{{- end }}
+{{- with .KubeletEvictionSoftGracePeriod }}
+evictionSoftGracePeriod:
+{{- range $signal, $period := . }}
+  {{ $signal }}: {{ printf "%q" $period }}
+{{- end }}
+{{- end }}
+{{- with .KubeletSystemReserved }}
+systemReserved:
+{{- range $resource, $quantity := . }}
+  {{ $resource }}: {{ printf "%q" $quantity }}
+{{- end }}
+{{- end }}
+{{- with .KubeletKubeReserved }}
+kubeReserved:
+{{- range $resource, $quantity := . }}
+  {{ $resource }}: {{ printf "%q" $quantity }}
+{{- end }}
+{{- end }}
+{{- with .FeatureGatesKubelet }}
+featureGates:
+{{- range $gate, $enabled := . }}
+  {{ $gate }}: {{ $enabled }}
+{{- end }}
+{{- end }}
+`)
+
+// KubeletSystemdUnitTemplate runs the kubelet with the join bundle. It bootstraps a client
+// certificate with the bootstrap token of the bundle kubeconfig. Per-node flags, e.g. node labels,
+// are set with KUBELET_EXTRA_ARGS in /etc/kubernetes/kubelet.env.
+var KubeletSystemdUnitTemplate = []byte(`[Unit]
+Description=Kubernetes Kubelet
+Documentation=https://kubernetes.io/docs/reference/command-line-tools-reference/kubelet/
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+EnvironmentFile=-/etc/kubernetes/kubelet.env
+ExecStartPre=/bin/mkdir -p /etc/kubernetes/manifests
+ExecStartPre=/bin/mkdir -p /etc/kubernetes/checkpoint-secrets
+ExecStartPre=/bin/mkdir -p /etc/kubernetes/inactive-manifests
+ExecStartPre=/bin/mkdir -p /var/lib/kubelet/pki
+ExecStart=/usr/local/bin/kubelet \
+  --bootstrap-kubeconfig={{ .KubeletBundleDir }}/kubeconfig \
+  --kubeconfig=/var/lib/kubelet/kubeconfig \
+  --config={{ .KubeletBundleDir }}/config.yaml \
+  --cert-dir=/var/lib/kubelet/pki \
+{{- with .CloudProvider }}
+  --cloud-provider={{ . }} \
+{{- end }}
+  --network-plugin=cni \
+  --exit-on-lock-contention \
+  --lock-file=/var/run/lock/kubelet.lock \
+  $KUBELET_EXTRA_ARGS
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`)
+
 var KubeletBootstrappingToken = []byte(`apiVersion: v1
 kind: Secret
 metadata:
@@ -47,7 +166,69 @@ type: bootstrap.kubernetes.io/token
 stringData:
   token-id: "{{ .BootstrapTokenID }}"
   token-secret: "{{ .BootstrapTokenSecret }}"
+{{- with .BootstrapTokenExpiration }}
+  expiration: "{{ . }}"
+{{- end }}
+  description: "Rendered by bootkube for the kubelet join bundle."
   usage-bootstrap-authentication: "true"
+  usage-bootstrap-signing: "true"
+`)
+
+// ClusterInfoTemplate is the cluster-info ConfigMap nodes discover the cluster from before they
+// are authenticated. The bootstrapsigner controller signs its kubeconfig with each bootstrap token.
+var ClusterInfoTemplate = []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cluster-info
+  namespace: kube-public
+  annotations:
+    bootkube.alpha.kubernetes.io/ca-cert-hash: "{{ .CACertHash }}"
+data:
+  kubeconfig: |
+    apiVersion: v1
+    kind: Config
+    clusters:
+    - name: ""
+      cluster:
+        server: {{ .Server }}
+        certificate-authority-data: {{ .CACert }}
+    contexts: []
+    current-context: ""
+    preferences: {}
+    users: []
+`)
+
+// ClusterInfoRoleTemplate allows reading the cluster-info ConfigMap.
+var ClusterInfoRoleTemplate = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: bootkube:cluster-info
+  namespace: kube-public
+rules:
+- apiGroups: [""]
+  resources: ["configmaps"]
+  resourceNames: ["cluster-info"]
+  verbs: ["get"]
+`)
+
+// ClusterInfoRoleBindingTemplate lets joining nodes read cluster-info, with a bootstrap token or,
+// when the apiserver allows anonymous requests, without one.
+var ClusterInfoRoleBindingTemplate = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: bootkube:cluster-info
+  namespace: kube-public
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: bootkube:cluster-info
+subjects:
+- kind: Group
+  name: system:bootstrappers
+  apiGroup: rbac.authorization.k8s.io
+- kind: User
+  name: system:anonymous
+  apiGroup: rbac.authorization.k8s.io
 `)
 
 // CSRNodeBootstrapTemplate lets bootstrapping tokens and nodes request CSRs.
@@ -68,11 +249,27 @@ roleRef:
   apiGroup: rbac.authorization.k8s.io
 `)
 
+// NodeClusterRoleBindingTemplate grants kubelets the system:node role when the Node authorizer
+// is disabled. Unlike the Node authorizer, it doesn't limit nodes to their own objects.
+var NodeClusterRoleBindingTemplate = []byte(`kind: ClusterRoleBinding
+apiVersion: rbac.authorization.k8s.io/v1
+metadata:
+  name: system-node
+subjects:
+- kind: Group
+  name: system:nodes
+  apiGroup: rbac.authorization.k8s.io
+roleRef:
+  kind: ClusterRole
+  name: system:node
+  apiGroup: rbac.authorization.k8s.io
+`)
+
 // CSRApproverRoleBindingTemplate instructs the csrapprover controller to
 // automatically approve CSRs made by bootstrapping tokens for client
 // credentials.
 //
-// This binding should be removed to disable CSR auto-approval.
+// It is not rendered when CSR auto-approval is disabled.
 var CSRApproverRoleBindingTemplate = []byte(`kind: ClusterRoleBinding
 apiVersion: rbac.authorization.k8s.io/v1
 metadata:
@@ -108,6 +305,30 @@ roleRef:
   apiGroup: rbac.authorization.k8s.io
 `)
 
+// ComponentKubeConfigTemplate is the kubeconfig a bootstrap control plane component authenticates
+// with using its own client certificate.
+var ComponentKubeConfigTemplate = []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: {{ or .Cluster "local" }}
+  cluster:
+    server: {{ .Server }}
+    certificate-authority-data: {{ .CACert }}
+users:
+- name: {{ .User }}
+  user:
+    client-certificate-data: {{ .Cert }}
+    client-key-data: {{ .Key }}
+contexts:
+- context:
+    cluster: {{ or .Cluster "local" }}
+    user: {{ .User }}
+  name: {{ .User }}@{{ or .Cluster "local" }}
+current-context: {{ .User }}@{{ or .Cluster "local" }}
+`)
+
+// KubeSystemSARoleBindingTemplate grants cluster-admin to the default service account of
+// kube-system. It is only rendered with the legacy RBAC profile.
 var KubeSystemSARoleBindingTemplate = []byte(`apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
 metadata:
@@ -126,10 +347,23 @@ var APIServerTemplate = []byte(`apiVersion: apps/v1
 kind: DaemonSet
 metadata:
   name: kube-apiserver
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
   labels:
     tier: control-plane
     k8s-app: kube-apiserver
+{{- if .APIServerLBAnnotations }}
+  annotations:
+    # Guidance for load balancers fronting the apiserver. Unless anonymous requests are
+    # allowed, HTTP(S) checks against /healthz fail; use TCP checks instead. The apiserver does
+    # not understand the PROXY protocol, so it must be disabled on the load balancer backend.
+{{- if .AnonymousAuth }}
+    bootkube.alpha.kubernetes.io/lb-health-check: "HTTPS:{{ (index .APIServers 0).Port }}/healthz"
+{{- else }}
+    bootkube.alpha.kubernetes.io/lb-health-check: "TCP:{{ (index .APIServers 0).Port }}"
+{{- end }}
+    bootkube.alpha.kubernetes.io/lb-proxy-protocol: "disabled"
+    bootkube.alpha.kubernetes.io/lb-mode: "tcp-passthrough"
+{{- end }}
 spec:
   selector:
     matchLabels:
@@ -141,30 +375,70 @@ spec:
         tier: control-plane
         k8s-app: kube-apiserver
       annotations:
+{{- if .HardenedSecurity }}
+        seccomp.security.alpha.kubernetes.io/pod: runtime/default
+{{- end }}
         checkpointer.alpha.coreos.com/checkpoint: "true"
     spec:
+      priorityClassName: system-node-critical
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/arch
+                operator: In
+                values:
+                - {{ .Arch }}
       containers:
       - name: kube-apiserver
         image: {{ .Images.Hyperkube }}
+{{- with .ContainerResources "kube-apiserver" }}
+        resources:
+{{- with .Requests }}
+          requests:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- with .Limits }}
+          limits:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- end }}
         command:
         - /hyperkube
         - kube-apiserver
-        - --enable-admission-plugins=NamespaceLifecycle,LimitRanger,ServiceAccount,PersistentVolumeClaimResize,DefaultStorageClass,DefaultTolerationSeconds,MutatingAdmissionWebhook,ValidatingAdmissionWebhook,ResourceQuota,Priority,NodeRestriction
+        - --enable-admission-plugins=NamespaceLifecycle,LimitRanger,ServiceAccount,PersistentVolumeClaimResize,DefaultStorageClass,DefaultTolerationSeconds,MutatingAdmissionWebhook,ValidatingAdmissionWebhook,ResourceQuota,Priority{{ if not .DisableNodeAuthorization }},NodeRestriction{{ end }}{{ if .PodSecurity }},PodSecurityPolicy{{ end }}{{ range .ExtraAdmissionPlugins }},{{ . }}{{ end }}
+{{- if .Admission }}
+        - --admission-control-config-file=/etc/kubernetes/secrets/admission-config.yaml
+{{- end }}
         - --advertise-address=$(POD_IP)
         - --allow-privileged=true
-        - --anonymous-auth=false
-        - --authorization-mode=Node,RBAC
+        - --anonymous-auth={{ .AnonymousAuth }}
+        - --authorization-mode={{ if .DisableNodeAuthorization }}RBAC{{ else }}Node,RBAC{{ end }}
         - --bind-address={{ .BindAllAddress }}
         - --client-ca-file=/etc/kubernetes/secrets/ca.crt
         - --requestheader-client-ca-file=/etc/kubernetes/secrets/front-proxy-ca.crt
-        - --requestheader-allowed-names=front-proxy-client
-        - --requestheader-extra-headers-prefix=X-Remote-Extra-
-        - --requestheader-group-headers=X-Remote-Group
-        - --requestheader-username-headers=X-Remote-User
+        - --requestheader-allowed-names={{ or .RequestHeaderAllowedNames "front-proxy-client" }}
+        - --requestheader-extra-headers-prefix={{ or .RequestHeaderExtraHeadersPrefix "X-Remote-Extra-" }}
+        - --requestheader-group-headers={{ or .RequestHeaderGroupHeaders "X-Remote-Group" }}
+        - --requestheader-username-headers={{ or .RequestHeaderUsernameHeaders "X-Remote-User" }}
         - --proxy-client-cert-file=/etc/kubernetes/secrets/front-proxy-client.crt
         - --proxy-client-key-file=/etc/kubernetes/secrets/front-proxy-client.key
         - --cloud-provider={{ .CloudProvider }}
+{{- if .CloudConfig }}
+        - --cloud-config=/etc/kubernetes/secrets/cloud-config
+{{- end }}
         - --enable-bootstrap-token-auth=true
+{{- if .Konnectivity }}
+        - --egress-selector-config-file=/etc/kubernetes/secrets/egress-selector-config.yaml
+{{- end }}
+{{- with .FeatureGatesAPIServer }}
+        - --feature-gates={{ . }}
+{{- end }}
 {{- if .EtcdUseTLS }}
         - --etcd-cafile=/etc/kubernetes/secrets/etcd-client-ca.crt
         - --etcd-certfile=/etc/kubernetes/secrets/etcd-client.crt
@@ -179,11 +453,55 @@ spec:
         - --service-cluster-ip-range={{ .ServiceCIDRsString }}
         - --tls-cert-file=/etc/kubernetes/secrets/apiserver.crt
         - --tls-private-key-file=/etc/kubernetes/secrets/apiserver.key
+{{- if .Audit }}
+        - --audit-policy-file=/etc/kubernetes/secrets/audit-policy.yaml
+        - --audit-log-path={{ .AuditLogPath }}
+        - --audit-log-maxage={{ .AuditLogMaxAge }}
+{{- if .AuditWebhookConfig }}
+        - --audit-webhook-config-file=/etc/kubernetes/secrets/audit-webhook-config.yaml
+{{- end }}
+{{- end }}
+{{- if .EncryptionProvider }}
+        - --encryption-provider-config=/etc/kubernetes/secrets/encryption-config.yaml
+{{- end }}
+{{- if .OIDCIssuerURL }}
+        - --oidc-issuer-url={{ .OIDCIssuerURL }}
+        - --oidc-client-id={{ .OIDCClientID }}
+{{- with .OIDCUsernameClaim }}
+        - --oidc-username-claim={{ . }}
+{{- end }}
+{{- with .OIDCGroupsClaim }}
+        - --oidc-groups-claim={{ . }}
+{{- end }}
+{{- if .OIDCCACert }}
+        - --oidc-ca-file=/etc/kubernetes/secrets/oidc-ca.crt
+{{- end }}
+{{- end }}
+{{- range $flag, $value := .APIServerExtraFlags }}
+        - {{ printf "--%s=%s" $flag $value | printf "%q" }}
+{{- end }}
         env:
         - name: POD_IP
           valueFrom:
             fieldRef:
               fieldPath: status.podIP
+{{- if .AnonymousAuth }}
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: {{ (index .APIServers 0).Port }}
+            scheme: HTTPS
+          failureThreshold: 8
+          initialDelaySeconds: 15
+          timeoutSeconds: 15
+{{- end }}
+{{- if .HardenedSecurity }}
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+          readOnlyRootFilesystem: true
+{{- end }}
         volumeMounts:
         - mountPath: /etc/ssl/certs
           name: ssl-certs-host
@@ -191,13 +509,85 @@ spec:
         - mountPath: /etc/kubernetes/secrets
           name: secrets
           readOnly: true
+{{- if .Audit }}
+        - mountPath: {{ .AuditLogDir }}
+          name: audit-logs
+{{- end }}
+{{- if .Konnectivity }}
+        - mountPath: /etc/kubernetes/konnectivity-server
+          name: konnectivity-uds
+      # The apiserver proxies requests to the node and pod networks through the agents connected
+      # to it.
+      - name: konnectivity-server
+        image: {{ .Images.KonnectivityServer }}
+        command:
+        - /proxy-server
+        - --logtostderr=true
+        - --uds-name=/etc/kubernetes/konnectivity-server/konnectivity-server.socket
+        - --cluster-ca-cert=/etc/kubernetes/secrets/ca.crt
+        - --cluster-cert=/etc/kubernetes/secrets/konnectivity-server.crt
+        - --cluster-key=/etc/kubernetes/secrets/konnectivity-server.key
+        - --mode=grpc
+        - --server-port=0
+        - --agent-port=8132
+        - --admin-port=8133
+        - --health-port=8134
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: 8134
+          initialDelaySeconds: 15
+          timeoutSeconds: 15
+        volumeMounts:
+        - mountPath: /etc/kubernetes/secrets
+          name: secrets
+          readOnly: true
+        - mountPath: /etc/kubernetes/konnectivity-server
+          name: konnectivity-uds
+{{- end }}
+{{- if .Audit }}
+      initContainers:
+      # The apiserver doesn't run as root, so it needs to own the audit log directory.
+      - name: audit-log-dir
+        image: {{ .Images.Hyperkube }}
+        command:
+        - /bin/sh
+        - -c
+        - chown 65534 {{ .AuditLogDir }}
+        securityContext:
+          runAsNonRoot: false
+          runAsUser: 0
+        volumeMounts:
+        - mountPath: {{ .AuditLogDir }}
+          name: audit-logs
+{{- end }}
+{{- if .PodSecurity }}
+      # The service account is only used to exempt the apiserver from the baseline policy.
+      automountServiceAccountToken: false
+{{- end }}
       hostNetwork: true
       nodeSelector:
-        node-role.kubernetes.io/master: ""
+{{- range $key, $value := .ControlPlaneNodeSelector }}
+        {{ $key }}: {{ printf "%q" $value }}
+{{- end }}
+{{- if .PodSecurity }}
+      serviceAccountName: kube-apiserver
+{{- end }}
       tolerations:
-      - key: node-role.kubernetes.io/master
-        operator: Exists
-        effect: NoSchedule
+{{- range .ControlPlaneTolerations }}
+{{- if .Key }}
+      - key: {{ .Key }}
+        operator: {{ .Operator }}
+{{- else }}
+      - operator: {{ .Operator }}
+{{- end }}
+{{- with .Value }}
+        value: {{ printf "%q" . }}
+{{- end }}
+{{- with .Effect }}
+        effect: {{ . }}
+{{- end }}
+{{- end }}
       volumes:
       - name: ssl-certs-host
         hostPath:
@@ -205,6 +595,16 @@ spec:
       - name: secrets
         secret:
           secretName: kube-apiserver
+{{- if .Audit }}
+      - name: audit-logs
+        hostPath:
+          path: {{ .AuditLogDir }}
+          type: DirectoryOrCreate
+{{- end }}
+{{- if .Konnectivity }}
+      - name: konnectivity-uds
+        emptyDir: {}
+{{- end }}
       securityContext:
         runAsNonRoot: true
         runAsUser: 65534
@@ -214,51 +614,140 @@ spec:
     type: RollingUpdate
 `)
 
+var APIServerDisruptionTemplate = []byte(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: kube-apiserver
+  namespace: {{ .ControlPlaneNamespace }}
+spec:
+  minAvailable: 1
+  selector:
+    matchLabels:
+      tier: control-plane
+      k8s-app: kube-apiserver
+`)
+
+var APIServerServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  namespace: {{ .ControlPlaneNamespace }}
+  name: kube-apiserver
+`)
+
 var BootstrapAPIServerTemplate = []byte(`apiVersion: v1
 kind: Pod
 metadata:
-  name: bootstrap-kube-apiserver
-  namespace: kube-system
+  name: {{ if not .StaticControlPlane }}bootstrap-{{ end }}kube-apiserver
+  namespace: {{ .ControlPlaneNamespace }}
+{{- if .HardenedSecurity }}
+  annotations:
+    seccomp.security.alpha.kubernetes.io/pod: runtime/default
+{{- end }}
 spec:
+  priorityClassName: system-node-critical
   containers:
   - name: kube-apiserver
     image: {{ .Images.Hyperkube }}
+{{- with .ContainerResources "kube-apiserver" }}
+    resources:
+{{- with .Requests }}
+      requests:
+{{- range $name, $value := . }}
+        {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- with .Limits }}
+      limits:
+{{- range $name, $value := . }}
+        {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- end }}
     command:
     - /hyperkube
     - kube-apiserver
-    - --advertise-address=$(POD_IP)
+    - --advertise-address={{ with .BootstrapAdvertiseAddress }}{{ . }}{{ else }}$(POD_IP){{ end }}
     - --allow-privileged=true
-    - --authorization-mode=Node,RBAC
+    - --anonymous-auth={{ .AnonymousAuth }}
+    - --authorization-mode={{ if .DisableNodeAuthorization }}RBAC{{ else }}Node,RBAC{{ end }}
     - --bind-address={{ .BindAllAddress }}
     - --client-ca-file=/etc/kubernetes/secrets/ca.crt
     - --requestheader-client-ca-file=/etc/kubernetes/secrets/front-proxy-ca.crt
-    - --requestheader-allowed-names=front-proxy-client
-    - --requestheader-extra-headers-prefix=X-Remote-Extra-
-    - --requestheader-group-headers=X-Remote-Group
-    - --requestheader-username-headers=X-Remote-User
+    - --requestheader-allowed-names={{ or .RequestHeaderAllowedNames "front-proxy-client" }}
+    - --requestheader-extra-headers-prefix={{ or .RequestHeaderExtraHeadersPrefix "X-Remote-Extra-" }}
+    - --requestheader-group-headers={{ or .RequestHeaderGroupHeaders "X-Remote-Group" }}
+    - --requestheader-username-headers={{ or .RequestHeaderUsernameHeaders "X-Remote-User" }}
     - --proxy-client-cert-file=/etc/kubernetes/secrets/front-proxy-client.crt
     - --proxy-client-key-file=/etc/kubernetes/secrets/front-proxy-client.key
-    - --enable-admission-plugins=NamespaceLifecycle,LimitRanger,ServiceAccount,PersistentVolumeClaimResize,DefaultStorageClass,DefaultTolerationSeconds,MutatingAdmissionWebhook,ValidatingAdmissionWebhook,ResourceQuota,Priority,NodeRestriction
+    - --enable-admission-plugins=NamespaceLifecycle,LimitRanger,ServiceAccount,PersistentVolumeClaimResize,DefaultStorageClass,DefaultTolerationSeconds,MutatingAdmissionWebhook,ValidatingAdmissionWebhook,ResourceQuota,Priority{{ if not .DisableNodeAuthorization }},NodeRestriction{{ end }}{{ range .ExtraAdmissionPlugins }},{{ . }}{{ end }}
+{{- if .Admission }}
+    - --admission-control-config-file=/etc/kubernetes/secrets/admission-config.yaml
+{{- end }}
     - --enable-bootstrap-token-auth=true
+{{- if and .Konnectivity .StaticControlPlane }}
+    - --egress-selector-config-file=/etc/kubernetes/secrets/egress-selector-config.yaml
+{{- end }}
+{{- with .FeatureGatesAPIServer }}
+    - --feature-gates={{ . }}
+{{- end }}
 {{- if .EtcdUseTLS }}
     - --etcd-cafile=/etc/kubernetes/secrets/etcd-client-ca.crt
     - --etcd-certfile=/etc/kubernetes/secrets/etcd-client.crt
     - --etcd-keyfile=/etc/kubernetes/secrets/etcd-client.key
 {{- end }}
     - --etcd-servers={{ range $i, $e := .EtcdServers }}{{ if $i }},{{end}}{{ $e }}{{end}}
+{{- if .DisableInsecurePort }}
+    - --insecure-port=0
+{{- end }}
     - --kubelet-client-certificate=/etc/kubernetes/secrets/apiserver-kubelet-client.crt
     - --kubelet-client-key=/etc/kubernetes/secrets/apiserver-kubelet-client.key
-    - --secure-port={{ (index .APIServers 0).Port }}
+    - --secure-port={{ .BootstrapSecurePort }}
     - --service-account-key-file=/etc/kubernetes/secrets/service-account.pub
     - --service-cluster-ip-range={{ .ServiceCIDRsString }}
     - --cloud-provider={{ .CloudProvider }}
+{{- if .CloudConfig }}
+    - --cloud-config=/etc/kubernetes/secrets/cloud-config
+{{- end }}
     - --tls-cert-file=/etc/kubernetes/secrets/apiserver.crt
     - --tls-private-key-file=/etc/kubernetes/secrets/apiserver.key
+{{- if .Audit }}
+    - --audit-policy-file=/etc/kubernetes/secrets/audit-policy.yaml
+    - --audit-log-path={{ .AuditLogPath }}
+    - --audit-log-maxage={{ .AuditLogMaxAge }}
+{{- if .AuditWebhookConfig }}
+    - --audit-webhook-config-file=/etc/kubernetes/secrets/audit-webhook-config.yaml
+{{- end }}
+{{- end }}
+{{- if .EncryptionProvider }}
+    - --encryption-provider-config=/etc/kubernetes/secrets/encryption-config.yaml
+{{- end }}
+{{- if .OIDCIssuerURL }}
+    - --oidc-issuer-url={{ .OIDCIssuerURL }}
+    - --oidc-client-id={{ .OIDCClientID }}
+{{- with .OIDCUsernameClaim }}
+    - --oidc-username-claim={{ . }}
+{{- end }}
+{{- with .OIDCGroupsClaim }}
+    - --oidc-groups-claim={{ . }}
+{{- end }}
+{{- if .OIDCCACert }}
+    - --oidc-ca-file=/etc/kubernetes/secrets/oidc-ca.crt
+{{- end }}
+{{- end }}
+{{- range $flag, $value := .APIServerExtraFlags }}
+    - {{ printf "--%s=%s" $flag $value | printf "%q" }}
+{{- end }}
     env:
     - name: POD_IP
       valueFrom:
         fieldRef:
           fieldPath: status.podIP
+{{- if .HardenedSecurity }}
+    # Keeps running as root with its capabilities to read the secrets of the host.
+    securityContext:
+      allowPrivilegeEscalation: false
+      readOnlyRootFilesystem: true
+{{- end }}
     volumeMounts:
     - mountPath: /etc/ssl/certs
       name: ssl-certs-host
@@ -266,21 +755,59 @@ spec:
     - mountPath: /etc/kubernetes/secrets
       name: secrets
       readOnly: true
+{{- if .Audit }}
+    - mountPath: {{ .AuditLogDir }}
+      name: audit-logs
+{{- end }}
+{{- if and .Konnectivity .StaticControlPlane }}
+    - mountPath: /etc/kubernetes/konnectivity-server
+      name: konnectivity-uds
+  - name: konnectivity-server
+    image: {{ .Images.KonnectivityServer }}
+    command:
+    - /proxy-server
+    - --logtostderr=true
+    - --uds-name=/etc/kubernetes/konnectivity-server/konnectivity-server.socket
+    - --cluster-ca-cert=/etc/kubernetes/secrets/ca.crt
+    - --cluster-cert=/etc/kubernetes/secrets/konnectivity-server.crt
+    - --cluster-key=/etc/kubernetes/secrets/konnectivity-server.key
+    - --mode=grpc
+    - --server-port=0
+    - --agent-port=8132
+    - --admin-port=8133
+    - --health-port=8134
+    volumeMounts:
+    - mountPath: /etc/kubernetes/secrets
+      name: secrets
+      readOnly: true
+    - mountPath: /etc/kubernetes/konnectivity-server
+      name: konnectivity-uds
+{{- end }}
   hostNetwork: true
   volumes:
   - name: secrets
     hostPath:
-      path: /etc/kubernetes/{{ .BootstrapSecretsSubdir }}
+      path: {{ .ControlPlaneSecretsDir }}
   - name: ssl-certs-host
     hostPath:
       path: /usr/share/ca-certificates
+{{- if .Audit }}
+  - name: audit-logs
+    hostPath:
+      path: {{ .AuditLogDir }}
+      type: DirectoryOrCreate
+{{- end }}
+{{- if and .Konnectivity .StaticControlPlane }}
+  - name: konnectivity-uds
+    emptyDir: {}
+{{- end }}
 `)
 
 var CheckpointerTemplate = []byte(`apiVersion: apps/v1
 kind: DaemonSet
 metadata:
   name: pod-checkpointer
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
   labels:
     tier: control-plane
     k8s-app: pod-checkpointer
@@ -297,14 +824,55 @@ spec:
       annotations:
         checkpointer.alpha.coreos.com/checkpoint: "true"
     spec:
+      priorityClassName: system-node-critical
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/arch
+                operator: In
+                values:
+                - {{ .Arch }}
       containers:
       - name: pod-checkpointer
         image: {{ .Images.PodCheckpointer }}
+{{- with .ContainerResources "pod-checkpointer" }}
+        resources:
+{{- with .Requests }}
+          requests:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- with .Limits }}
+          limits:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- end }}
         command:
         - /checkpoint
         - --lock-file=/var/run/lock/pod-checkpointer.lock
         - --kubeconfig=/etc/checkpointer/kubeconfig
         - --checkpoint-grace-period=5m
+        - --healthz-addr=127.0.0.1:9303
+{{- with .CheckpointInterval }}
+        - --checkpoint-interval={{ . }}
+{{- end }}
+{{- with .CheckpointBackoff }}
+        - --checkpoint-backoff={{ . }}
+{{- end }}
+{{- with .MaxCheckpointBackoff }}
+        - --max-checkpoint-backoff={{ . }}
+{{- end }}
+{{- with .CheckpointAPIServerPollInterval }}
+        - --apiserver-poll-interval={{ . }}
+{{- end }}
+{{- with .CheckpointKubeletPollInterval }}
+        - --kubelet-poll-interval={{ . }}
+{{- end }}
         env:
         - name: NODE_NAME
           valueFrom:
@@ -319,6 +887,13 @@ spec:
             fieldRef:
               fieldPath: metadata.namespace
         imagePullPolicy: Always
+        livenessProbe:
+          httpGet:
+            host: 127.0.0.1
+            path: /healthz
+            port: 9303
+          initialDelaySeconds: 15
+          timeoutSeconds: 15
         volumeMounts:
         - mountPath: /etc/checkpointer
           name: kubeconfig
@@ -329,12 +904,25 @@ spec:
       serviceAccountName: pod-checkpointer
       hostNetwork: true
       nodeSelector:
-        node-role.kubernetes.io/master: ""
+{{- range $key, $value := .ControlPlaneNodeSelector }}
+        {{ $key }}: {{ printf "%q" $value }}
+{{- end }}
       restartPolicy: Always
       tolerations:
-      - key: node-role.kubernetes.io/master
-        operator: Exists
-        effect: NoSchedule
+{{- range .ControlPlaneTolerations }}
+{{- if .Key }}
+      - key: {{ .Key }}
+        operator: {{ .Operator }}
+{{- else }}
+      - operator: {{ .Operator }}
+{{- end }}
+{{- with .Value }}
+        value: {{ printf "%q" . }}
+{{- end }}
+{{- with .Effect }}
+        effect: {{ . }}
+{{- end }}
+{{- end }}
       volumes:
       - name: kubeconfig
         configMap:
@@ -354,7 +942,7 @@ spec:
 var CheckpointerServiceAccount = []byte(`apiVersion: v1
 kind: ServiceAccount
 metadata:
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
   name: pod-checkpointer
 `)
 
@@ -362,7 +950,7 @@ var CheckpointerRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
 kind: Role
 metadata:
   name: pod-checkpointer
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
 rules:
 - apiGroups: [""] # "" indicates the core API group
   resources: ["pods"]
@@ -370,13 +958,16 @@ rules:
 - apiGroups: [""] # "" indicates the core API group
   resources: ["secrets", "configmaps"]
   verbs: ["get"]
+- apiGroups: [""] # "" indicates the core API group
+  resources: ["serviceaccounts/token"]
+  verbs: ["create"]
 `)
 
 var CheckpointerRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
 kind: RoleBinding
 metadata:
   name: pod-checkpointer
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
 roleRef:
   apiGroup: rbac.authorization.k8s.io
   kind: Role
@@ -384,7 +975,7 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: pod-checkpointer
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
 `)
 
 var CheckpointerClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
@@ -408,14 +999,14 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: pod-checkpointer
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
 `)
 
 var ControllerManagerTemplate = []byte(`apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: kube-controller-manager
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
   labels:
     tier: control-plane
     k8s-app: kube-controller-manager
@@ -430,8 +1021,21 @@ spec:
       labels:
         tier: control-plane
         k8s-app: kube-controller-manager
+{{- if .HardenedSecurity }}
+      annotations:
+        seccomp.security.alpha.kubernetes.io/pod: runtime/default
+{{- end }}
     spec:
+      priorityClassName: system-cluster-critical
       affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/arch
+                operator: In
+                values:
+                - {{ .Arch }}
         podAntiAffinity:
           preferredDuringSchedulingIgnoredDuringExecution:
           - weight: 100
@@ -450,26 +1054,66 @@ spec:
       containers:
       - name: kube-controller-manager
         image: {{ .Images.Hyperkube }}
+{{- with .ContainerResources "kube-controller-manager" }}
+        resources:
+{{- with .Requests }}
+          requests:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- with .Limits }}
+          limits:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- end }}
         command:
         - ./hyperkube
         - kube-controller-manager
         - --use-service-account-credentials
         - --allocate-node-cidrs=true
+        - --controllers=*,bootstrapsigner,tokencleaner
         - --cloud-provider={{ .CloudProvider }}
+{{- if .CloudConfig }}
+        - --cloud-config=/etc/kubernetes/secrets/cloud-config
+{{- end }}
         - --cluster-cidr={{ .PodCIDRsString }}
         - --service-cluster-ip-range={{ .ServiceCIDRsString }}
         - --cluster-signing-cert-file=/etc/kubernetes/secrets/ca.crt
         - --cluster-signing-key-file=/etc/kubernetes/secrets/ca.key
         - --configure-cloud-routes=false
+{{- with .FeatureGatesControllerManager }}
+        - --feature-gates={{ . }}
+{{- end }}
         - --leader-elect=true
+{{- if .DisableInsecurePort }}
+        - --port=0
+{{- end }}
         - --root-ca-file=/etc/kubernetes/secrets/ca.crt
         - --service-account-private-key-file=/etc/kubernetes/secrets/service-account.key
+{{- range $flag, $value := .ControllerManagerExtraFlags }}
+        - {{ printf "--%s=%s" $flag $value | printf "%q" }}
+{{- end }}
         livenessProbe:
           httpGet:
             path: /healthz
+{{- if .DisableInsecurePort }}
+            port: 10257  # Note: Using default port. Update if --secure-port option is set differently.
+            scheme: HTTPS
+{{- else }}
             port: 10252  # Note: Using default port. Update if --port option is set differently.
+{{- end }}
           initialDelaySeconds: 15
           timeoutSeconds: 15
+{{- if .HardenedSecurity }}
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+          readOnlyRootFilesystem: true
+{{- end }}
         volumeMounts:
         - name: var-run-kubernetes
           mountPath: /var/run/kubernetes
@@ -480,15 +1124,28 @@ spec:
           mountPath: /etc/ssl/certs
           readOnly: true
       nodeSelector:
-        node-role.kubernetes.io/master: ""
+{{- range $key, $value := .ControlPlaneNodeSelector }}
+        {{ $key }}: {{ printf "%q" $value }}
+{{- end }}
       securityContext:
         runAsNonRoot: true
         runAsUser: 65534
       serviceAccountName: kube-controller-manager
       tolerations:
-      - key: node-role.kubernetes.io/master
-        operator: Exists
-        effect: NoSchedule
+{{- range .ControlPlaneTolerations }}
+{{- if .Key }}
+      - key: {{ .Key }}
+        operator: {{ .Operator }}
+{{- else }}
+      - operator: {{ .Operator }}
+{{- end }}
+{{- with .Value }}
+        value: {{ printf "%q" . }}
+{{- end }}
+{{- with .Effect }}
+        effect: {{ . }}
+{{- end }}
+{{- end }}
       volumes:
       - name: var-run-kubernetes
         emptyDir: {}
@@ -504,7 +1161,7 @@ spec:
 var ControllerManagerServiceAccount = []byte(`apiVersion: v1
 kind: ServiceAccount
 metadata:
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
   name: kube-controller-manager
 `)
 
@@ -519,32 +1176,78 @@ roleRef:
 subjects:
 - kind: ServiceAccount
   name: kube-controller-manager
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
 `)
 
 var BootstrapControllerManagerTemplate = []byte(`apiVersion: v1
 kind: Pod
 metadata:
-  name: bootstrap-kube-controller-manager
-  namespace: kube-system
+  name: {{ if not .StaticControlPlane }}bootstrap-{{ end }}kube-controller-manager
+  namespace: {{ .ControlPlaneNamespace }}
+{{- if .HardenedSecurity }}
+  annotations:
+    seccomp.security.alpha.kubernetes.io/pod: runtime/default
+{{- end }}
 spec:
+  priorityClassName: system-node-critical
   containers:
   - name: kube-controller-manager
     image: {{ .Images.Hyperkube }}
+{{- with .ContainerResources "kube-controller-manager" }}
+    resources:
+{{- with .Requests }}
+      requests:
+{{- range $name, $value := . }}
+        {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- with .Limits }}
+      limits:
+{{- range $name, $value := . }}
+        {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- end }}
     command:
     - ./hyperkube
     - kube-controller-manager
     - --allocate-node-cidrs=true
+    - --controllers=*,bootstrapsigner,tokencleaner
     - --cluster-cidr={{ .PodCIDRsString }}
     - --service-cluster-ip-range={{ .ServiceCIDRsString }}
     - --cloud-provider={{ .CloudProvider }}
+{{- if .CloudConfig }}
+    - --cloud-config=/etc/kubernetes/secrets/cloud-config
+{{- end }}
     - --cluster-signing-cert-file=/etc/kubernetes/secrets/ca.crt
     - --cluster-signing-key-file=/etc/kubernetes/secrets/ca.key
     - --configure-cloud-routes=false
+{{- with .FeatureGatesControllerManager }}
+    - --feature-gates={{ . }}
+{{- end }}
+{{- if .StrictRBAC }}
+    - --kubeconfig=/etc/kubernetes/secrets/kube-controller-manager.kubeconfig
+{{- else }}
     - --kubeconfig=/etc/kubernetes/secrets/kubeconfig
+{{- end }}
     - --leader-elect=true
+{{- if .DisableInsecurePort }}
+    - --port=0
+{{- end }}
     - --root-ca-file=/etc/kubernetes/secrets/ca.crt
     - --service-account-private-key-file=/etc/kubernetes/secrets/service-account.key
+{{- if .StrictRBAC }}
+    - --use-service-account-credentials
+{{- end }}
+{{- range $flag, $value := .ControllerManagerExtraFlags }}
+    - {{ printf "--%s=%s" $flag $value | printf "%q" }}
+{{- end }}
+{{- if .HardenedSecurity }}
+    # Keeps running as root with its capabilities to read the secrets of the host.
+    securityContext:
+      allowPrivilegeEscalation: false
+      readOnlyRootFilesystem: true
+{{- end }}
     volumeMounts:
     - name: secrets
       mountPath: /etc/kubernetes/secrets
@@ -556,7 +1259,7 @@ spec:
   volumes:
   - name: secrets
     hostPath:
-      path: /etc/kubernetes/{{ .BootstrapSecretsSubdir }}
+      path: {{ .ControlPlaneSecretsDir }}
   - name: ssl-host
     hostPath:
       path: /usr/share/ca-certificates
@@ -566,7 +1269,7 @@ var ControllerManagerDisruptionTemplate = []byte(`apiVersion: policy/v1beta1
 kind: PodDisruptionBudget
 metadata:
   name: kube-controller-manager
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
 spec:
   minAvailable: 1
   selector:
@@ -579,7 +1282,7 @@ var SchedulerTemplate = []byte(`apiVersion: apps/v1
 kind: Deployment
 metadata:
   name: kube-scheduler
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
   labels:
     tier: control-plane
     k8s-app: kube-scheduler
@@ -594,8 +1297,21 @@ spec:
       labels:
         tier: control-plane
         k8s-app: kube-scheduler
+{{- if .HardenedSecurity }}
+      annotations:
+        seccomp.security.alpha.kubernetes.io/pod: runtime/default
+{{- end }}
     spec:
+      priorityClassName: system-cluster-critical
       affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/arch
+                operator: In
+                values:
+                - {{ .Arch }}
         podAntiAffinity:
           preferredDuringSchedulingIgnoredDuringExecution:
           - weight: 100
@@ -614,41 +1330,204 @@ spec:
       containers:
       - name: kube-scheduler
         image: {{ .Images.Hyperkube }}
+{{- with .ContainerResources "kube-scheduler" }}
+        resources:
+{{- with .Requests }}
+          requests:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- with .Limits }}
+          limits:
+{{- range $name, $value := . }}
+            {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- end }}
         command:
         - ./hyperkube
         - kube-scheduler
+{{- with .FeatureGatesScheduler }}
+        - --feature-gates={{ . }}
+{{- end }}
+{{- if .SchedulerConfig }}
+        - --config=/etc/kubernetes/scheduler/config.yaml
+{{- else }}
         - --leader-elect=true
+{{- end }}
+{{- if .DisableInsecurePort }}
+        - --port=0
+{{- end }}
+{{- range $flag, $value := .SchedulerExtraFlags }}
+        - {{ printf "--%s=%s" $flag $value | printf "%q" }}
+{{- end }}
         livenessProbe:
           httpGet:
             path: /healthz
+{{- if .DisableInsecurePort }}
+            port: 10259  # Note: Using default port. Update if --secure-port option is set differently.
+            scheme: HTTPS
+{{- else }}
             port: 10251  # Note: Using default port. Update if --port option is set differently.
+{{- end }}
           initialDelaySeconds: 15
           timeoutSeconds: 15
+{{- if .HardenedSecurity }}
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+          readOnlyRootFilesystem: true
+{{- end }}
+{{- if .SchedulerConfig }}
+        volumeMounts:
+        - name: config
+          mountPath: /etc/kubernetes/scheduler
+          readOnly: true
+{{- end }}
       nodeSelector:
-        node-role.kubernetes.io/master: ""
+{{- range $key, $value := .ControlPlaneNodeSelector }}
+        {{ $key }}: {{ printf "%q" $value }}
+{{- end }}
       securityContext:
         runAsNonRoot: true
         runAsUser: 65534
+      serviceAccountName: kube-scheduler
       tolerations:
-      - key: node-role.kubernetes.io/master
-        operator: Exists
-        effect: NoSchedule
+{{- range .ControlPlaneTolerations }}
+{{- if .Key }}
+      - key: {{ .Key }}
+        operator: {{ .Operator }}
+{{- else }}
+      - operator: {{ .Operator }}
+{{- end }}
+{{- with .Value }}
+        value: {{ printf "%q" . }}
+{{- end }}
+{{- with .Effect }}
+        effect: {{ . }}
+{{- end }}
+{{- end }}
+{{- if .SchedulerConfig }}
+      volumes:
+      - name: config
+        configMap:
+          name: kube-scheduler-config
+{{- end }}
+`)
+
+var SchedulerServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  namespace: {{ .ControlPlaneNamespace }}
+  name: kube-scheduler
+`)
+
+var SchedulerClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: kube-scheduler
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:kube-scheduler
+subjects:
+- kind: ServiceAccount
+  name: kube-scheduler
+  namespace: {{ .ControlPlaneNamespace }}
+`)
+
+var SchedulerVolumeClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: kube-scheduler-volume-scheduler
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:volume-scheduler
+subjects:
+- kind: ServiceAccount
+  name: kube-scheduler
+  namespace: {{ .ControlPlaneNamespace }}
+`)
+
+// AuthenticationReaderRoleBinding lets the self-hosted controller-manager and scheduler read the
+// client CA and request header configuration for delegated authentication.
+var AuthenticationReaderRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: control-plane-authentication-reader
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: extension-apiserver-authentication-reader
+subjects:
+- kind: ServiceAccount
+  name: kube-controller-manager
+  namespace: {{ .ControlPlaneNamespace }}
+- kind: ServiceAccount
+  name: kube-scheduler
+  namespace: {{ .ControlPlaneNamespace }}
 `)
 
 var BootstrapSchedulerTemplate = []byte(`apiVersion: v1
 kind: Pod
 metadata:
-  name: bootstrap-kube-scheduler
-  namespace: kube-system
+  name: {{ if not .StaticControlPlane }}bootstrap-{{ end }}kube-scheduler
+  namespace: {{ .ControlPlaneNamespace }}
+{{- if .HardenedSecurity }}
+  annotations:
+    seccomp.security.alpha.kubernetes.io/pod: runtime/default
+{{- end }}
 spec:
+  priorityClassName: system-node-critical
   containers:
   - name: kube-scheduler
     image: {{ .Images.Hyperkube }}
+{{- with .ContainerResources "kube-scheduler" }}
+    resources:
+{{- with .Requests }}
+      requests:
+{{- range $name, $value := . }}
+        {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- with .Limits }}
+      limits:
+{{- range $name, $value := . }}
+        {{ $name }}: {{ printf "%q" $value }}
+{{- end }}
+{{- end }}
+{{- end }}
     command:
     - ./hyperkube
     - kube-scheduler
+{{- with .FeatureGatesScheduler }}
+    - --feature-gates={{ . }}
+{{- end }}
+{{- if .SchedulerConfig }}
+    - --config=/etc/kubernetes/secrets/kube-scheduler-config.yaml
+{{- else if .StrictRBAC }}
+    - --kubeconfig=/etc/kubernetes/secrets/kube-scheduler.kubeconfig
+    - --leader-elect=true
+{{- else }}
     - --kubeconfig=/etc/kubernetes/secrets/kubeconfig
     - --leader-elect=true
+{{- end }}
+{{- if .DisableInsecurePort }}
+    - --port=0
+{{- end }}
+{{- range $flag, $value := .SchedulerExtraFlags }}
+    - {{ printf "--%s=%s" $flag $value | printf "%q" }}
+{{- end }}
+{{- if .HardenedSecurity }}
+    # Keeps running as root with its capabilities to read the secrets of the host.
+    securityContext:
+      allowPrivilegeEscalation: false
+      readOnlyRootFilesystem: true
+{{- end }}
     volumeMounts:
     - name: secrets
       mountPath: /etc/kubernetes/secrets
@@ -657,14 +1536,14 @@ spec:
   volumes:
   - name: secrets
     hostPath:
-      path: /etc/kubernetes/{{ .BootstrapSecretsSubdir }}
+      path: {{ .ControlPlaneSecretsDir }}
 `)
 
 var SchedulerDisruptionTemplate = []byte(`apiVersion: policy/v1beta1
 kind: PodDisruptionBudget
 metadata:
   name: kube-scheduler
-  namespace: kube-system
+  namespace: {{ .ControlPlaneNamespace }}
 spec:
   minAvailable: 1
   selector:
@@ -692,6 +1571,7 @@ spec:
         tier: node
         k8s-app: kube-proxy
     spec:
+      priorityClassName: system-node-critical
       containers:
       - name: kube-proxy
         image: {{ .Images.Hyperkube }}
@@ -775,7 +1655,7 @@ var KubeConfigInClusterTemplate = []byte(`apiVersion: v1
 kind: ConfigMap
 metadata:
   name: kubeconfig-in-cluster
-  namespace: kube-system
+  namespace: {{ .Namespace }}
 data:
   kubeconfig: |
     apiVersion: v1
@@ -865,6 +1745,18 @@ data:
     }
 `)
 
+var CoreDNSDisruptionTemplate = []byte(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: coredns
+  namespace: kube-system
+spec:
+  minAvailable: 1
+  selector:
+    matchLabels:
+      k8s-app: coredns
+`)
+
 var CoreDNSDeploymentTemplate = []byte(`apiVersion: apps/v1
 kind: Deployment
 metadata:
@@ -890,6 +1782,7 @@ spec:
       annotations:
         seccomp.security.alpha.kubernetes.io/pod: 'docker/default'
     spec:
+      priorityClassName: system-cluster-critical
       affinity:
         podAntiAffinity:
           preferredDuringSchedulingIgnoredDuringExecution:
@@ -1102,6 +1995,7 @@ spec:
         tier: node
         k8s-app: flannel
     spec:
+      priorityClassName: system-node-critical
       serviceAccountName: flannel
       containers:
       - name: kube-flannel
@@ -1225,6 +2119,7 @@ spec:
       labels:
         k8s-app: calico-node
     spec:
+      priorityClassName: system-node-critical
       hostNetwork: true
       serviceAccountName: calico-node
       tolerations:
@@ -1253,7 +2148,7 @@ spec:
             - name: WAIT_FOR_DATASTORE
               value: "true"
             - name: CALICO_IPV4POOL_CIDR
-              value: "{{ .PodCIDR }}"
+              value: "{{ .PodCIDRIPv4 }}"
             - name: CALICO_IPV4POOL_IPIP
               value: "Always"
             - name: FELIX_IPINIPENABLED
@@ -1353,6 +2248,7 @@ spec:
       labels:
         k8s-app: calico-node
     spec:
+      priorityClassName: system-node-critical
       hostNetwork: true
       serviceAccountName: calico-node
       tolerations:
@@ -1381,7 +2277,7 @@ spec:
             - name: WAIT_FOR_DATASTORE
               value: "true"
             - name: CALICO_IPV4POOL_CIDR
-              value: "{{ .PodCIDR }}"
+              value: "{{ .PodCIDRIPv4 }}"
             - name: CALICO_IPV4POOL_IPIP
               value: "Always"
             - name: NODENAME
@@ -1610,7 +2506,7 @@ rules:
   - apiGroups: [""]
     resources: ["nodes"]
     verbs: ["get", "list", "update", "watch"]
-  - apiGroups: ["extensions"]
+  - apiGroups: ["extensions", "networking.k8s.io"]
     resources: ["networkpolicies"]
     verbs: ["get", "list", "watch"]
   - apiGroups: ["crd.projectcalico.org"]
@@ -1632,4 +2528,1610 @@ subjects:
   namespace: kube-system
 `)
 
+var CiliumCfgTemplate = []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cilium-config
+  namespace: kube-system
+data:
+  identity-allocation-mode: crd
+  debug: "false"
+  enable-ipv4: "true"
+  enable-ipv6: "false"
+  ipam: kubernetes
+  tunnel: vxlan
+  masquerade: "true"
+  native-routing-cidr: "{{ .PodCIDRIPv4 }}"
+  install-iptables-rules: "true"
+  enable-health-checking: "true"
+  enable-endpoint-health-checking: "true"
+  monitor-aggregation: medium
+  preallocate-bpf-maps: "false"
+  kube-proxy-replacement: "{{ .CiliumKubeProxyReplacement }}"
+  cni-conf-dir: /host/etc/cni/net.d
+`)
+
+var CiliumTemplate = []byte(`apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: cilium
+  namespace: kube-system
+  labels:
+    tier: node
+    k8s-app: cilium
+spec:
+  selector:
+    matchLabels:
+      tier: node
+      k8s-app: cilium
+  template:
+    metadata:
+      labels:
+        tier: node
+        k8s-app: cilium
+    spec:
+      serviceAccountName: cilium
+      priorityClassName: system-node-critical
+      containers:
+      - name: cilium-agent
+        image: {{ .Images.Cilium }}
+        command: ["cilium-agent"]
+        args:
+        - --config-dir=/tmp/cilium/config-map
+        env:
+        - name: K8S_NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        - name: CILIUM_K8S_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+{{- if .SkipKubeProxy }}
+        # Without kube-proxy the kubernetes service IP is not reachable, so talk to the apiserver directly.
+        - name: KUBERNETES_SERVICE_HOST
+          value: "{{ (index .APIServers 0).Hostname }}"
+        - name: KUBERNETES_SERVICE_PORT
+          value: "{{ (index .APIServers 0).Port }}"
+{{- end }}
+        lifecycle:
+          postStart:
+            exec:
+              command: ["/cni-install.sh"]
+          preStop:
+            exec:
+              command: ["/cni-uninstall.sh"]
+        livenessProbe:
+          exec:
+            command: ["cilium", "status", "--brief"]
+          initialDelaySeconds: 120
+          periodSeconds: 30
+          timeoutSeconds: 5
+          failureThreshold: 10
+        readinessProbe:
+          exec:
+            command: ["cilium", "status", "--brief"]
+          initialDelaySeconds: 5
+          periodSeconds: 30
+          timeoutSeconds: 5
+        securityContext:
+          privileged: true
+        volumeMounts:
+        - name: bpf-maps
+          mountPath: /sys/fs/bpf
+        - name: cilium-run
+          mountPath: /var/run/cilium
+        - name: cni-path
+          mountPath: /host/opt/cni/bin
+        - name: etc-cni-netd
+          mountPath: /host/etc/cni/net.d
+        - name: cilium-config-path
+          mountPath: /tmp/cilium/config-map
+          readOnly: true
+        - name: lib-modules
+          mountPath: /lib/modules
+          readOnly: true
+        - name: xtables-lock
+          mountPath: /run/xtables.lock
+      hostNetwork: true
+      restartPolicy: Always
+      terminationGracePeriodSeconds: 1
+      tolerations:
+      - operator: Exists
+      volumes:
+      - name: cilium-run
+        hostPath:
+          path: /var/run/cilium
+          type: DirectoryOrCreate
+      - name: bpf-maps
+        hostPath:
+          path: /sys/fs/bpf
+          type: DirectoryOrCreate
+      - name: cni-path
+        hostPath:
+          path: /opt/cni/bin
+          type: DirectoryOrCreate
+      - name: etc-cni-netd
+        hostPath:
+          path: /etc/kubernetes/cni/net.d
+          type: DirectoryOrCreate
+      - name: lib-modules
+        hostPath:
+          path: /lib/modules
+      - name: xtables-lock
+        hostPath:
+          path: /run/xtables.lock
+          type: FileOrCreate
+      - name: cilium-config-path
+        configMap:
+          name: cilium-config
+  updateStrategy:
+    rollingUpdate:
+      maxUnavailable: 2
+    type: RollingUpdate
+`)
+
+var CiliumOperatorTemplate = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cilium-operator
+  namespace: kube-system
+  labels:
+    k8s-app: cilium-operator
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      k8s-app: cilium-operator
+  template:
+    metadata:
+      labels:
+        k8s-app: cilium-operator
+    spec:
+      serviceAccountName: cilium-operator
+      priorityClassName: system-cluster-critical
+      containers:
+      - name: cilium-operator
+        image: {{ .Images.CiliumOperator }}
+        command: ["cilium-operator-generic"]
+        args:
+        - --config-dir=/tmp/cilium/config-map
+        env:
+        - name: K8S_NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        - name: CILIUM_K8S_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+{{- if .SkipKubeProxy }}
+        - name: KUBERNETES_SERVICE_HOST
+          value: "{{ (index .APIServers 0).Hostname }}"
+        - name: KUBERNETES_SERVICE_PORT
+          value: "{{ (index .APIServers 0).Port }}"
+{{- end }}
+        livenessProbe:
+          httpGet:
+            host: 127.0.0.1
+            path: /healthz
+            port: 9234
+            scheme: HTTP
+          initialDelaySeconds: 60
+          periodSeconds: 10
+          timeoutSeconds: 3
+        volumeMounts:
+        - name: cilium-config-path
+          mountPath: /tmp/cilium/config-map
+          readOnly: true
+      hostNetwork: true
+      restartPolicy: Always
+      tolerations:
+      - operator: Exists
+      volumes:
+      - name: cilium-config-path
+        configMap:
+          name: cilium-config
+`)
+
+var CiliumServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cilium
+  namespace: kube-system
+`)
+
+var CiliumOperatorServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cilium-operator
+  namespace: kube-system
+`)
+
+var CiliumClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cilium
+rules:
+  - apiGroups: ["networking.k8s.io"]
+    resources: ["networkpolicies"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: ["discovery.k8s.io"]
+    resources: ["endpointslices"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["namespaces", "services", "nodes", "endpoints", "pods"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["pods", "nodes"]
+    verbs: ["update"]
+  - apiGroups: [""]
+    resources: ["nodes/status"]
+    verbs: ["patch"]
+  - apiGroups: ["apiextensions.k8s.io"]
+    resources: ["customresourcedefinitions"]
+    verbs: ["create", "get", "list", "watch", "update"]
+  - apiGroups: ["cilium.io"]
+    resources: ["*"]
+    verbs: ["*"]
+`)
+
+var CiliumClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: cilium
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cilium
+subjects:
+- kind: ServiceAccount
+  name: cilium
+  namespace: kube-system
+`)
+
+var CiliumOperatorClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cilium-operator
+rules:
+  - apiGroups: [""]
+    resources: ["pods"]
+    verbs: ["get", "list", "watch", "delete"]
+  - apiGroups: ["discovery.k8s.io"]
+    resources: ["endpointslices"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["services", "endpoints", "namespaces", "nodes"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: ["apiextensions.k8s.io"]
+    resources: ["customresourcedefinitions"]
+    verbs: ["create", "get", "list", "update", "watch"]
+  - apiGroups: ["cilium.io"]
+    resources: ["*"]
+    verbs: ["*"]
+  - apiGroups: ["coordination.k8s.io"]
+    resources: ["leases"]
+    verbs: ["create", "get", "update"]
+`)
+
+var CiliumOperatorClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: cilium-operator
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cilium-operator
+subjects:
+- kind: ServiceAccount
+  name: cilium-operator
+  namespace: kube-system
+`)
+
+var WeaveNetTemplate = []byte(`apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: weave-net
+  namespace: kube-system
+  labels:
+    tier: node
+    k8s-app: weave-net
+spec:
+  selector:
+    matchLabels:
+      tier: node
+      k8s-app: weave-net
+  template:
+    metadata:
+      labels:
+        tier: node
+        k8s-app: weave-net
+    spec:
+      serviceAccountName: weave-net
+      priorityClassName: system-node-critical
+      containers:
+      - name: weave
+        image: {{ .Images.WeaveNet }}
+        command: ["/home/weave/launch.sh"]
+        env:
+        - name: HOSTNAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        - name: IPALLOC_RANGE
+          value: "{{ .PodCIDRIPv4 }}"
+{{- if .WeaveEncryption }}
+        - name: WEAVE_PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: weave-passwd
+              key: weave-passwd
+{{- end }}
+        readinessProbe:
+          httpGet:
+            host: 127.0.0.1
+            path: /status
+            port: 6784
+        securityContext:
+          privileged: true
+        volumeMounts:
+        - name: weavedb
+          mountPath: /weavedb
+        - name: cni-bin
+          mountPath: /host/opt
+        - name: cni-bin2
+          mountPath: /host/home
+        - name: cni-conf
+          mountPath: /host/etc/cni/net.d
+        - name: dbus
+          mountPath: /host/var/lib/dbus
+        - name: lib-modules
+          mountPath: /lib/modules
+        - name: xtables-lock
+          mountPath: /run/xtables.lock
+      - name: weave-npc
+        image: {{ .Images.WeaveNPC }}
+        env:
+        - name: HOSTNAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        securityContext:
+          privileged: true
+        volumeMounts:
+        - name: xtables-lock
+          mountPath: /run/xtables.lock
+      hostNetwork: true
+      hostPID: true
+      restartPolicy: Always
+      securityContext:
+        seLinuxOptions: {}
+      tolerations:
+      - effect: NoSchedule
+        operator: Exists
+      - effect: NoExecute
+        operator: Exists
+      volumes:
+      - name: weavedb
+        hostPath:
+          path: /var/lib/weave
+      - name: cni-bin
+        hostPath:
+          path: /opt
+      - name: cni-bin2
+        hostPath:
+          path: /home
+      - name: cni-conf
+        hostPath:
+          path: /etc/kubernetes/cni/net.d
+      - name: dbus
+        hostPath:
+          path: /var/lib/dbus
+      - name: lib-modules
+        hostPath:
+          path: /lib/modules
+      - name: xtables-lock
+        hostPath:
+          path: /run/xtables.lock
+          type: FileOrCreate
+  updateStrategy:
+    rollingUpdate:
+      maxUnavailable: 1
+    type: RollingUpdate
+`)
+
+var WeaveNetServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: weave-net
+  namespace: kube-system
+`)
+
+var WeaveNetClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: weave-net
+rules:
+  - apiGroups: [""]
+    resources: ["pods", "namespaces", "nodes"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: ["networking.k8s.io"]
+    resources: ["networkpolicies"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["nodes/status"]
+    verbs: ["patch", "update"]
+`)
+
+var WeaveNetClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: weave-net
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: weave-net
+subjects:
+- kind: ServiceAccount
+  name: weave-net
+  namespace: kube-system
+`)
+
+// WeaveNetRole lets weave-net keep its peer list in the weave-net ConfigMap.
+var WeaveNetRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: weave-net
+  namespace: kube-system
+rules:
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    resourceNames: ["weave-net"]
+    verbs: ["get", "update"]
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    verbs: ["create"]
+`)
+
+var WeaveNetRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: weave-net
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: weave-net
+subjects:
+- kind: ServiceAccount
+  name: weave-net
+  namespace: kube-system
+`)
+
+var WeaveNetPasswordSecretTemplate = []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: weave-passwd
+  namespace: kube-system
+type: Opaque
+data:
+  weave-passwd: {{ .Password }}
+`)
+
+var KubeRouterCfgTemplate = []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kube-router-cfg
+  namespace: kube-system
+  labels:
+    tier: node
+    k8s-app: kube-router
+data:
+  cni-conf.json: |
+    {
+      "cniVersion": "0.3.0",
+      "name": "kube-router",
+      "plugins": [
+        {
+          "name": "kubernetes",
+          "type": "bridge",
+          "bridge": "kube-bridge",
+          "isDefaultGateway": true,
+          "ipam": {
+            "type": "host-local"
+          }
+        },
+        {
+          "type": "portmap",
+          "snat": true,
+          "capabilities": {"portMappings": true}
+        }
+      ]
+    }
+`)
+
+var KubeRouterTemplate = []byte(`apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: kube-router
+  namespace: kube-system
+  labels:
+    tier: node
+    k8s-app: kube-router
+spec:
+  selector:
+    matchLabels:
+      tier: node
+      k8s-app: kube-router
+  template:
+    metadata:
+      labels:
+        tier: node
+        k8s-app: kube-router
+    spec:
+      serviceAccountName: kube-router
+      priorityClassName: system-node-critical
+      initContainers:
+      - name: install-cni
+        image: {{ .Images.KubeRouter }}
+        command:
+        - /bin/sh
+        - -c
+        - set -e -x;
+          if [ ! -f /etc/cni/net.d/10-kuberouter.conflist ]; then
+            TMP=/etc/cni/net.d/.tmp-kuberouter-cfg;
+            cp /etc/kube-router/cni-conf.json ${TMP};
+            mv ${TMP} /etc/cni/net.d/10-kuberouter.conflist;
+          fi
+        volumeMounts:
+        - name: cni
+          mountPath: /etc/cni/net.d
+        - name: kube-router-cfg
+          mountPath: /etc/kube-router
+      containers:
+      - name: kube-router
+        image: {{ .Images.KubeRouter }}
+        args:
+        - --run-router=true
+        - --run-firewall=true
+        - --run-service-proxy={{ .KubeRouterServiceProxy }}
+        - --bgp-graceful-restart=true
+        env:
+        - name: NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+{{- if .SkipKubeProxy }}
+        # Without kube-proxy the kubernetes service IP is not reachable, so talk to the apiserver directly.
+        - name: KUBERNETES_SERVICE_HOST
+          value: "{{ (index .APIServers 0).Hostname }}"
+        - name: KUBERNETES_SERVICE_PORT
+          value: "{{ (index .APIServers 0).Port }}"
+{{- end }}
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: 20244
+          initialDelaySeconds: 10
+          periodSeconds: 3
+        resources:
+          requests:
+            cpu: 250m
+            memory: 250Mi
+        securityContext:
+          privileged: true
+        volumeMounts:
+        - name: lib-modules
+          mountPath: /lib/modules
+          readOnly: true
+        - name: cni
+          mountPath: /etc/cni/net.d
+        - name: xtables-lock
+          mountPath: /run/xtables.lock
+      hostNetwork: true
+      tolerations:
+      - effect: NoSchedule
+        operator: Exists
+      - effect: NoExecute
+        operator: Exists
+      volumes:
+      - name: lib-modules
+        hostPath:
+          path: /lib/modules
+      - name: cni
+        hostPath:
+          path: /etc/kubernetes/cni/net.d
+      - name: kube-router-cfg
+        configMap:
+          name: kube-router-cfg
+      - name: xtables-lock
+        hostPath:
+          path: /run/xtables.lock
+          type: FileOrCreate
+  updateStrategy:
+    rollingUpdate:
+      maxUnavailable: 1
+    type: RollingUpdate
+`)
+
+var KubeRouterServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: kube-router
+  namespace: kube-system
+`)
+
+var KubeRouterClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: kube-router
+rules:
+  - apiGroups: [""]
+    resources: ["namespaces", "pods", "services", "nodes", "endpoints"]
+    verbs: ["list", "get", "watch"]
+  - apiGroups: ["networking.k8s.io"]
+    resources: ["networkpolicies"]
+    verbs: ["list", "get", "watch"]
+  - apiGroups: ["extensions"]
+    resources: ["networkpolicies"]
+    verbs: ["get", "list", "watch"]
+`)
+
+var KubeRouterClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: kube-router
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: kube-router
+subjects:
+- kind: ServiceAccount
+  name: kube-router
+  namespace: kube-system
+`)
+
+var ExternalDNSTemplate = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: external-dns
+  namespace: kube-system
+  labels:
+    k8s-app: external-dns
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels:
+      k8s-app: external-dns
+  template:
+    metadata:
+      labels:
+        k8s-app: external-dns
+    spec:
+      serviceAccountName: external-dns
+      containers:
+      - name: external-dns
+        image: {{ .Images.ExternalDNS }}
+        args:
+        - --source=service
+        - --publish-internal-services
+        - --namespace=kube-system
+        - --label-filter=k8s-app=kube-apiserver-external-dns
+        - --provider={{ .ExternalDNSProvider }}
+        - --domain-filter={{ .ExternalDNSZone }}
+        - --policy=upsert-only
+        - --registry=txt
+        - --txt-owner-id={{ or .ClusterName "bootkube" }}
+        # Provider credentials are read from the optional external-dns Secret.
+        envFrom:
+        - secretRef:
+            name: external-dns
+            optional: true
+      tolerations:
+      - key: node-role.kubernetes.io/master
+        operator: Exists
+        effect: NoSchedule
+`)
+
+var ExternalDNSAPIServerService = []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: kube-apiserver-external-dns
+  namespace: kube-system
+  labels:
+    k8s-app: kube-apiserver-external-dns
+  annotations:
+    external-dns.alpha.kubernetes.io/hostname: {{ .APIServerHostname }}
+    external-dns.alpha.kubernetes.io/target: {{ .ExternalDNSTarget }}
+spec:
+  # Only carries the DNS record of the apiserver load balancer, it doesn't route any traffic.
+  clusterIP: None
+  ports:
+  - name: https
+    port: {{ (index .APIServers 0).Port }}
+`)
+
+var ExternalDNSServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: external-dns
+  namespace: kube-system
+`)
+
+var ExternalDNSClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: external-dns
+rules:
+  - apiGroups: [""]
+    resources: ["services", "endpoints", "pods"]
+    verbs: ["get", "watch", "list"]
+  - apiGroups: [""]
+    resources: ["nodes"]
+    verbs: ["list", "watch"]
+`)
+
+var ExternalDNSClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: external-dns
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: external-dns
+subjects:
+- kind: ServiceAccount
+  name: external-dns
+  namespace: kube-system
+`)
+
+var DNSAutoscalerConfigTemplate = []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: dns-autoscaler
+  namespace: kube-system
+data:
+  # replicas = max(ceil(cores / coresPerReplica), ceil(nodes / nodesPerReplica)), at least min.
+  linear: |-
+    {
+      "coresPerReplica": {{ .DNSAutoscalerCoresPerReplica }},
+      "nodesPerReplica": {{ .DNSAutoscalerNodesPerReplica }},
+      "min": 2,
+      "preventSinglePointFailure": true
+    }
+`)
+
+var DNSAutoscalerTemplate = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dns-autoscaler
+  namespace: kube-system
+  labels:
+    k8s-app: dns-autoscaler
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      k8s-app: dns-autoscaler
+  template:
+    metadata:
+      labels:
+        k8s-app: dns-autoscaler
+    spec:
+      serviceAccountName: dns-autoscaler
+      priorityClassName: system-cluster-critical
+      containers:
+      - name: autoscaler
+        image: {{ .Images.DNSAutoscaler }}
+        command:
+        - /cluster-proportional-autoscaler
+        - --namespace=kube-system
+        - --configmap=dns-autoscaler
+        - --target=deployment/coredns
+        - --logtostderr=true
+        - --v=2
+        resources:
+          requests:
+            cpu: 20m
+            memory: 10Mi
+      tolerations:
+      - key: node-role.kubernetes.io/master
+        operator: Exists
+        effect: NoSchedule
+`)
+
+var DNSAutoscalerServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: dns-autoscaler
+  namespace: kube-system
+`)
+
+var DNSAutoscalerClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: dns-autoscaler
+rules:
+  - apiGroups: [""]
+    resources: ["nodes"]
+    verbs: ["list", "watch"]
+  - apiGroups: [""]
+    resources: ["replicationcontrollers/scale"]
+    verbs: ["get", "update"]
+  - apiGroups: ["apps"]
+    resources: ["deployments/scale", "replicasets/scale"]
+    verbs: ["get", "update"]
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    verbs: ["get", "create"]
+`)
+
+var DNSAutoscalerClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: dns-autoscaler
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: dns-autoscaler
+subjects:
+- kind: ServiceAccount
+  name: dns-autoscaler
+  namespace: kube-system
+`)
+
+var MetricsServerTemplate = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: metrics-server
+  namespace: kube-system
+  labels:
+    k8s-app: metrics-server
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      k8s-app: metrics-server
+  template:
+    metadata:
+      labels:
+        k8s-app: metrics-server
+    spec:
+      serviceAccountName: metrics-server
+      priorityClassName: system-cluster-critical
+      containers:
+      - name: metrics-server
+        image: {{ .Images.MetricsServer }}
+        args:
+        - --cert-dir=/tmp
+        - --secure-port=4443
+        - --kubelet-preferred-address-types=InternalIP,ExternalIP,Hostname
+        # Kubelet serving certificates are self-signed.
+        - --kubelet-insecure-tls
+        ports:
+        - name: main-port
+          containerPort: 4443
+          protocol: TCP
+        securityContext:
+          readOnlyRootFilesystem: true
+          runAsNonRoot: true
+          runAsUser: 1000
+        resources:
+          requests:
+            cpu: 50m
+            memory: 50Mi
+        volumeMounts:
+        - name: tmp-dir
+          mountPath: /tmp
+      nodeSelector:
+        kubernetes.io/os: linux
+      tolerations:
+      - key: node-role.kubernetes.io/master
+        operator: Exists
+        effect: NoSchedule
+      volumes:
+      - name: tmp-dir
+        emptyDir: {}
+`)
+
+var MetricsServerServiceTemplate = []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: metrics-server
+  namespace: kube-system
+  labels:
+    k8s-app: metrics-server
+spec:
+  selector:
+    k8s-app: metrics-server
+  ports:
+  - port: 443
+    protocol: TCP
+    targetPort: main-port
+`)
+
+var MetricsServerAPIService = []byte(`apiVersion: apiregistration.k8s.io/v1
+kind: APIService
+metadata:
+  name: v1beta1.metrics.k8s.io
+spec:
+  service:
+    name: metrics-server
+    namespace: kube-system
+  group: metrics.k8s.io
+  version: v1beta1
+  # metrics-server serves with a self-signed certificate.
+  insecureSkipTLSVerify: true
+  groupPriorityMinimum: 100
+  versionPriority: 100
+`)
+
+var MetricsServerServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: metrics-server
+  namespace: kube-system
+`)
+
+var MetricsServerClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system:metrics-server
+rules:
+  - apiGroups: [""]
+    resources: ["pods", "nodes", "nodes/stats", "namespaces", "configmaps"]
+    verbs: ["get", "list", "watch"]
+`)
+
+var MetricsServerClusterRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:metrics-server
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:metrics-server
+subjects:
+- kind: ServiceAccount
+  name: metrics-server
+  namespace: kube-system
+`)
+
+var MetricsServerAggregatedClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system:aggregated-metrics-reader
+  labels:
+    rbac.authorization.k8s.io/aggregate-to-view: "true"
+    rbac.authorization.k8s.io/aggregate-to-edit: "true"
+    rbac.authorization.k8s.io/aggregate-to-admin: "true"
+rules:
+  - apiGroups: ["metrics.k8s.io"]
+    resources: ["pods", "nodes"]
+    verbs: ["get", "list", "watch"]
+`)
+
+var MetricsServerAuthDelegatorBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: metrics-server:system:auth-delegator
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:auth-delegator
+subjects:
+- kind: ServiceAccount
+  name: metrics-server
+  namespace: kube-system
+`)
+
+// MetricsServerAuthReaderBinding lets metrics-server read the front-proxy CA and request header
+// settings of the apiserver, to authenticate the requests the aggregator proxies.
+var MetricsServerAuthReaderBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: metrics-server-auth-reader
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: extension-apiserver-authentication-reader
+subjects:
+- kind: ServiceAccount
+  name: metrics-server
+  namespace: kube-system
+`)
+
+// DefaultSchedulerConfig is the KubeSchedulerConfiguration rendered when none is supplied. The
+// kubeconfig of the client connection is set when rendering.
+var DefaultSchedulerConfig = []byte(`apiVersion: kubescheduler.config.k8s.io/v1alpha1
+kind: KubeSchedulerConfiguration
+leaderElection:
+  leaderElect: true
+`)
+
+var DefaultAuditPolicy = []byte(`apiVersion: audit.k8s.io/v1
+kind: Policy
+# Don't generate audit events for the RequestReceived stage.
+omitStages:
+  - RequestReceived
+rules:
+  # High volume, low risk requests.
+  - level: None
+    users: ["system:kube-proxy"]
+    verbs: ["watch"]
+    resources:
+      - group: ""
+        resources: ["endpoints", "services", "services/status"]
+  - level: None
+    userGroups: ["system:nodes"]
+    verbs: ["get"]
+    resources:
+      - group: ""
+        resources: ["nodes", "nodes/status"]
+  - level: None
+    users:
+      - system:kube-controller-manager
+      - system:kube-scheduler
+      - system:serviceaccount:kube-system:endpoint-controller
+    verbs: ["get", "update"]
+    namespaces: ["kube-system"]
+    resources:
+      - group: ""
+        resources: ["endpoints"]
+      - group: "coordination.k8s.io"
+        resources: ["leases"]
+  - level: None
+    nonResourceURLs:
+      - /healthz*
+      - /livez*
+      - /readyz*
+      - /version
+      - /swagger*
+  - level: None
+    resources:
+      - group: ""
+        resources: ["events"]
+  # Secrets, ConfigMaps and token reviews can contain credentials, only log metadata.
+  - level: Metadata
+    resources:
+      - group: ""
+        resources: ["secrets", "configmaps", "serviceaccounts/token"]
+      - group: "authentication.k8s.io"
+        resources: ["tokenreviews"]
+  # Log the request body of changes.
+  - level: Request
+    verbs: ["create", "update", "patch", "delete", "deletecollection"]
+  - level: Metadata
+`)
+
+var EncryptionConfigTemplate = []byte(`apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources:
+      - secrets
+    providers:
+      - {{ .Provider }}:
+          keys:
+            - name: {{ .KeyName }}
+              secret: {{ .Secret }}
+      # Allows reading secrets written before encryption was enabled.
+      - identity: {}
+`)
+
+// PodSecurityPolicyPrivileged is used by the self-hosted control plane, network providers and the
+// mirror pods of static pods.
+var PodSecurityPolicyPrivileged = []byte(`apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: privileged
+  annotations:
+    seccomp.security.alpha.kubernetes.io/allowedProfileNames: '*'
+spec:
+  privileged: true
+  allowPrivilegeEscalation: true
+  allowedCapabilities:
+  - '*'
+  volumes:
+  - '*'
+  hostNetwork: true
+  hostPorts:
+  - min: 0
+    max: 65535
+  hostIPC: true
+  hostPID: true
+  runAsUser:
+    rule: RunAsAny
+  seLinux:
+    rule: RunAsAny
+  supplementalGroups:
+    rule: RunAsAny
+  fsGroup:
+    rule: RunAsAny
+`)
+
+// PodSecurityPolicyBaseline follows the baseline Pod Security Standard: no privileged containers,
+// host namespaces, host ports or host paths, and only the default capabilities can be added.
+var PodSecurityPolicyBaseline = []byte(`apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: baseline
+  annotations:
+    seccomp.security.alpha.kubernetes.io/allowedProfileNames: 'docker/default,runtime/default'
+spec:
+  privileged: false
+  allowPrivilegeEscalation: true
+  allowedCapabilities:
+  - AUDIT_WRITE
+  - CHOWN
+  - DAC_OVERRIDE
+  - FOWNER
+  - FSETID
+  - KILL
+  - MKNOD
+  - NET_BIND_SERVICE
+  - SETFCAP
+  - SETGID
+  - SETPCAP
+  - SETUID
+  - SYS_CHROOT
+  volumes:
+  - configMap
+  - csi
+  - downwardAPI
+  - emptyDir
+  - persistentVolumeClaim
+  - projected
+  - secret
+  hostNetwork: false
+  hostIPC: false
+  hostPID: false
+  runAsUser:
+    rule: RunAsAny
+  seLinux:
+    rule: RunAsAny
+  supplementalGroups:
+    rule: RunAsAny
+  fsGroup:
+    rule: RunAsAny
+`)
+
+var PodSecurityPolicyPrivilegedClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: psp:privileged
+rules:
+- apiGroups: ["policy"]
+  resources: ["podsecuritypolicies"]
+  resourceNames: ["privileged"]
+  verbs: ["use"]
+`)
+
+var PodSecurityPolicyBaselineClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: psp:baseline
+rules:
+- apiGroups: ["policy"]
+  resources: ["podsecuritypolicies"]
+  resourceNames: ["baseline"]
+  verbs: ["use"]
+`)
+
+// PodSecurityPolicyBaselineBinding lets all pods use the baseline policy.
+var PodSecurityPolicyBaselineBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: psp:baseline
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: psp:baseline
+subjects:
+- kind: Group
+  name: system:authenticated
+  apiGroup: rbac.authorization.k8s.io
+- kind: Group
+  name: system:serviceaccounts
+  apiGroup: rbac.authorization.k8s.io
+`)
+
+// PodSecurityPolicyNodesBinding lets kubelets create the mirror pods of static pods, such as the
+// bootstrap control plane and pod checkpoints.
+var PodSecurityPolicyNodesBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: psp:privileged:nodes
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: psp:privileged
+subjects:
+- kind: Group
+  name: system:nodes
+  apiGroup: rbac.authorization.k8s.io
+`)
+
+// PodSecurityPolicyControlPlaneBinding exempts the pods of the self-hosted control plane and node
+// agents from the baseline policy. It only applies to their service accounts in Namespace, so
+// there is a binding for kube-system and one for the control plane namespace.
+var PodSecurityPolicyControlPlaneBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: psp:privileged:control-plane
+  namespace: {{ .Namespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: psp:privileged
+subjects:
+{{- range .ServiceAccounts }}
+- kind: ServiceAccount
+  name: {{ . }}
+  namespace: {{ $.Namespace }}
+{{- end }}
+`)
+
+// PodSecurityNamespaceTemplate creates a namespace, labeled for the Pod Security admission of
+// newer releases if Enforce is set.
+var PodSecurityNamespaceTemplate = []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Name }}
+{{- if .Enforce }}
+  labels:
+    pod-security.kubernetes.io/enforce: {{ .Enforce }}
+    pod-security.kubernetes.io/audit: baseline
+    pod-security.kubernetes.io/warn: baseline
+{{- end }}
+`)
+
+// EgressSelectorConfigTemplate sends the apiserver traffic to the cluster networks through the
+// konnectivity-server sidecar.
+var EgressSelectorConfigTemplate = []byte(`apiVersion: apiserver.k8s.io/v1alpha1
+kind: EgressSelectorConfiguration
+egressSelections:
+- name: cluster
+  connection:
+    proxyProtocol: GRPC
+    transport:
+      uds:
+        udsName: /etc/kubernetes/konnectivity-server/konnectivity-server.socket
+`)
+
+var KonnectivityAgentTemplate = []byte(`apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: konnectivity-agent
+  namespace: kube-system
+  labels:
+    k8s-app: konnectivity-agent
+spec:
+  selector:
+    matchLabels:
+      k8s-app: konnectivity-agent
+  template:
+    metadata:
+      labels:
+        k8s-app: konnectivity-agent
+    spec:
+      priorityClassName: system-node-critical
+      containers:
+      - name: konnectivity-agent
+        image: {{ .Images.KonnectivityAgent }}
+        command:
+        - /proxy-agent
+        - --logtostderr=true
+        - --ca-cert=/etc/kubernetes/secrets/ca.crt
+        - --agent-cert=/etc/kubernetes/secrets/konnectivity-agent.crt
+        - --agent-key=/etc/kubernetes/secrets/konnectivity-agent.key
+        - --proxy-server-host={{ .APIServerHostname }}
+        - --proxy-server-port=8132
+        - --admin-server-port=8094
+        - --health-server-port=8093
+        livenessProbe:
+          httpGet:
+            path: /healthz
+            port: 8093
+          initialDelaySeconds: 15
+          timeoutSeconds: 15
+        volumeMounts:
+        - mountPath: /etc/kubernetes/secrets
+          name: secrets
+          readOnly: true
+      automountServiceAccountToken: false
+      # The agents reach the kubelets and the pods from the host network, before the network
+      # provider is ready.
+      hostNetwork: true
+      nodeSelector:
+        kubernetes.io/os: linux
+      serviceAccountName: konnectivity-agent
+      tolerations:
+      - operator: Exists
+      volumes:
+      - name: secrets
+        secret:
+          secretName: konnectivity-agent
+      securityContext:
+        runAsNonRoot: true
+        runAsUser: 65534
+  updateStrategy:
+    rollingUpdate:
+      maxUnavailable: 1
+    type: RollingUpdate
+`)
+
+var KonnectivityAgentServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  namespace: kube-system
+  name: konnectivity-agent
+`)
+
+// EtcdBackupCronJobTemplate takes an etcd snapshot on the control plane nodes, which reach the
+// etcd servers, and keeps the last snapshots on a PersistentVolumeClaim or uploads it to a bucket.
+var EtcdBackupCronJobTemplate = []byte(`apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: etcd-backup
+  namespace: {{ .ControlPlaneNamespace }}
+  labels:
+    k8s-app: etcd-backup
+spec:
+  schedule: {{ printf "%q" .EtcdBackup.Schedule }}
+  concurrencyPolicy: Forbid
+  successfulJobsHistoryLimit: 3
+  failedJobsHistoryLimit: 3
+  jobTemplate:
+    spec:
+      backoffLimit: 2
+      template:
+        metadata:
+          labels:
+            k8s-app: etcd-backup
+        spec:
+{{- if eq .EtcdBackup.Destination "pvc" }}
+          containers:
+{{- else }}
+          initContainers:
+{{- end }}
+          - name: snapshot
+            image: {{ .Images.Etcd }}
+            command:
+            - /bin/sh
+            - -ec
+            - |
+              f=/backup/etcd-$(date -u +%Y%m%dT%H%M%SZ).db
+              etcdctl --endpoints={{ .EtcdBackupEndpoint }} \
+{{- if .EtcdUseTLS }}
+                --cacert=/etc/etcd-backup/etcd-client-ca.crt \
+                --cert=/etc/etcd-backup/etcd-client.crt \
+                --key=/etc/etcd-backup/etcd-client.key \
+{{- end }}
+                snapshot save "$f.part"
+              mv "$f.part" "$f"
+{{- if eq .EtcdBackup.Destination "pvc" }}
+              ls -1t /backup/etcd-*.db | tail -n +$(({{ .EtcdBackupRetain }} + 1)) | xargs -r rm -f
+{{- end }}
+            env:
+            - name: ETCDCTL_API
+              value: "3"
+            volumeMounts:
+            - mountPath: /backup
+              name: backup
+            - mountPath: /etc/etcd-backup
+              name: secrets
+              readOnly: true
+{{- if ne .EtcdBackup.Destination "pvc" }}
+          containers:
+          - name: upload
+{{- if eq .EtcdBackup.Destination "s3" }}
+            image: {{ .Images.AWSCLI }}
+            command:
+            - /bin/sh
+            - -ec
+            - |
+              for f in /backup/etcd-*.db; do
+                aws s3 cp "$f" "{{ .EtcdBackupURL }}/$(basename "$f")"
+              done
+{{- if or .EtcdBackup.Credentials .EtcdBackup.Region }}
+            env:
+{{- end }}
+{{- if .EtcdBackup.Credentials }}
+            - name: AWS_SHARED_CREDENTIALS_FILE
+              value: /etc/etcd-backup/etcd-backup-credentials
+{{- end }}
+{{- with .EtcdBackup.Region }}
+            - name: AWS_DEFAULT_REGION
+              value: {{ printf "%q" . }}
+{{- end }}
+{{- else }}
+            image: {{ .Images.CloudSDK }}
+            command:
+            - /bin/sh
+            - -ec
+            - |
+{{- if .EtcdBackup.Credentials }}
+              gcloud auth activate-service-account --key-file=/etc/etcd-backup/etcd-backup-credentials
+{{- end }}
+              for f in /backup/etcd-*.db; do
+                gsutil cp "$f" "{{ .EtcdBackupURL }}/$(basename "$f")"
+              done
+{{- end }}
+            volumeMounts:
+            - mountPath: /backup
+              name: backup
+              readOnly: true
+            - mountPath: /etc/etcd-backup
+              name: secrets
+              readOnly: true
+{{- end }}
+          automountServiceAccountToken: false
+          # The etcd servers are reached from the host network of the control plane nodes, like
+          # the apiservers do.
+          hostNetwork: true
+          nodeSelector:
+{{- range $key, $value := .ControlPlaneNodeSelector }}
+            {{ $key }}: {{ printf "%q" $value }}
+{{- end }}
+          restartPolicy: OnFailure
+          serviceAccountName: etcd-backup
+          tolerations:
+{{- range .ControlPlaneTolerations }}
+{{- if .Key }}
+          - key: {{ .Key }}
+            operator: {{ .Operator }}
+{{- else }}
+          - operator: {{ .Operator }}
+{{- end }}
+{{- with .Value }}
+            value: {{ printf "%q" . }}
+{{- end }}
+{{- with .Effect }}
+            effect: {{ . }}
+{{- end }}
+{{- end }}
+          volumes:
+          - name: backup
+{{- if eq .EtcdBackup.Destination "pvc" }}
+            persistentVolumeClaim:
+              claimName: etcd-backup
+{{- else }}
+            emptyDir: {}
+{{- end }}
+          - name: secrets
+            secret:
+              secretName: etcd-backup
+`)
+
+var EtcdBackupServiceAccountTemplate = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  namespace: {{ .ControlPlaneNamespace }}
+  name: etcd-backup
+`)
+
+var EtcdBackupVolumeClaimTemplate = []byte(`apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: etcd-backup
+  namespace: {{ .ControlPlaneNamespace }}
+  labels:
+    k8s-app: etcd-backup
+spec:
+  accessModes:
+  - ReadWriteOnce
+{{- with .EtcdBackup.StorageClass }}
+  storageClassName: {{ . }}
+{{- end }}
+  resources:
+    requests:
+      storage: {{ .EtcdBackupVolumeClaimSize }}
+`)
+
+// ControlPlaneBackupTemplate runs bootkube backup on the control plane nodes, which keeps a backup
+// of the control plane on every one of them for bootkube recover --backup.
+var ControlPlaneBackupTemplate = []byte(`apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: control-plane-backup
+  namespace: {{ .ControlPlaneNamespace }}
+  labels:
+    tier: control-plane
+    k8s-app: control-plane-backup
+spec:
+  selector:
+    matchLabels:
+      tier: control-plane
+      k8s-app: control-plane-backup
+  template:
+    metadata:
+      labels:
+        tier: control-plane
+        k8s-app: control-plane-backup
+    spec:
+      containers:
+      - name: control-plane-backup
+        image: {{ .Images.Bootkube }}
+        command:
+        - /bootkube
+        - backup
+        - --output=/backup/{{ .ControlPlaneBackupFile }}
+{{- if ne .ControlPlaneNamespace "kube-system" }}
+        - --namespaces={{ .ControlPlaneNamespace }}
+{{- end }}
+        volumeMounts:
+        - mountPath: /backup
+          name: backup
+      nodeSelector:
+{{- range $key, $value := .ControlPlaneNodeSelector }}
+        {{ $key }}: {{ printf "%q" $value }}
+{{- end }}
+      serviceAccountName: control-plane-backup
+      tolerations:
+{{- range .ControlPlaneTolerations }}
+{{- if .Key }}
+      - key: {{ .Key }}
+        operator: {{ .Operator }}
+{{- else }}
+      - operator: {{ .Operator }}
+{{- end }}
+{{- with .Value }}
+        value: {{ printf "%q" . }}
+{{- end }}
+{{- with .Effect }}
+        effect: {{ . }}
+{{- end }}
+{{- end }}
+      volumes:
+      - name: backup
+        hostPath:
+          path: {{ .ControlPlaneBackupDir }}
+          type: DirectoryOrCreate
+  updateStrategy:
+    rollingUpdate:
+      maxUnavailable: 1
+    type: RollingUpdate
+`)
+
+var ControlPlaneBackupServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  namespace: {{ .ControlPlaneNamespace }}
+  name: control-plane-backup
+`)
+
+// ControlPlaneBackupClusterRole reads the control plane, which the role bindings of the backup
+// grant in kube-system and the control plane namespace only.
+var ControlPlaneBackupClusterRole = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: control-plane-backup
+rules:
+- apiGroups: [""]
+  resources: ["configmaps", "secrets"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["apps"]
+  resources: ["daemonsets", "deployments"]
+  verbs: ["get", "list", "watch"]
+`)
+
+var ControlPlaneBackupRoleBinding = []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: control-plane-backup
+  namespace: {{ .Namespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: control-plane-backup
+subjects:
+- kind: ServiceAccount
+  name: control-plane-backup
+  namespace: {{ .ServiceAccountNamespace }}
+`)
+
 // vim: set expandtab:tabstop=2
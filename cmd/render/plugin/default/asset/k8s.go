@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"text/template"
+	"time"
 
 	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset/internal"
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
 )
 
 const (
@@ -21,15 +25,68 @@ const (
 	SecretEtcdServer = "etcd-server-tls"
 	SecretEtcdClient = "etcd-client-tls"
 
-	NetworkFlannel = "flannel"
-	NetworkCalico  = "experimental-calico"
-	NetworkCanal   = "experimental-canal"
+	NetworkFlannel    = "flannel"
+	NetworkCalico     = "calico"
+	NetworkCanal      = "experimental-canal"
+	NetworkCilium     = "cilium"
+	NetworkWeaveNet   = "weave-net"
+	NetworkKubeRouter = "kube-router"
+	// NetworkNone renders no CNI manifests, for clusters whose network provider is deployed
+	// separately. Node CIDR allocation in the controller-manager is still configured.
+	NetworkNone = "none"
+
+	// NetworkCalicoExperimental is the deprecated name of NetworkCalico.
+	NetworkCalicoExperimental = "experimental-calico"
+
+	// Encryption at rest providers.
+	EncryptionProviderAESCBC    = "aescbc"
+	EncryptionProviderSecretbox = "secretbox"
+
+	// RBAC profiles. The strict profile binds each control plane component to the built-in role
+	// for it. The legacy profile also grants cluster-admin to the default service account of
+	// kube-system and runs the bootstrap control plane with the bootstrap kubeconfig.
+	RBACProfileStrict = "strict"
+	RBACProfileLegacy = "legacy"
+
+	// Security profiles. The hardened profile runs the control plane containers with the
+	// runtime/default seccomp profile, a read-only root filesystem, no capabilities and no
+	// privilege escalation. The legacy profile leaves them at the container runtime defaults.
+	SecurityProfileHardened = "hardened"
+	SecurityProfileLegacy   = "legacy"
+
+	// Cilium kube-proxy replacement modes. In strict mode cilium handles all service traffic and
+	// kube-proxy is not deployed.
+	CiliumKubeProxyReplacementDisabled = "disabled"
+	CiliumKubeProxyReplacementPartial  = "partial"
+	CiliumKubeProxyReplacementStrict   = "strict"
+
+	// Cloud providers of the in-tree cloud integrations.
+	CloudProviderAWS       = "aws"
+	CloudProviderGCE       = "gce"
+	CloudProviderAzure     = "azure"
+	CloudProviderOpenStack = "openstack"
+
+	// DefaultBootstrapKubeConfigTTL is the default validity of the bootstrap kubeconfig.
+	DefaultBootstrapKubeConfigTTL = 4 * time.Hour
+	// DefaultBootstrapTokenTTL is the default validity of the rendered bootstrap token.
+	DefaultBootstrapTokenTTL = 24 * time.Hour
 
 	secretNamespace     = "kube-system"
 	secretAPIServerName = "kube-apiserver"
 	secretCMName        = "kube-controller-manager"
 )
 
+// DefaultControlPlaneNodeSelector and DefaultControlPlaneTolerations place the self-hosted
+// control plane on the master nodes.
+var (
+	DefaultControlPlaneNodeSelector = map[string]string{"node-role.kubernetes.io/master": ""}
+	DefaultControlPlaneTolerations  = []corev1.Toleration{{
+		Key:      "node-role.kubernetes.io/master",
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoSchedule,
+	}}
+)
+
 type staticConfig struct {
 	Images ImageVersions
 }
@@ -37,42 +94,157 @@ type staticConfig struct {
 func newStaticAssets(imageVersions ImageVersions) Assets {
 	conf := staticConfig{Images: imageVersions}
 	assets := Assets{
-		MustCreateAssetFromTemplate(AssetPathScheduler, internal.SchedulerTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathSchedulerDisruption, internal.SchedulerDisruptionTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathControllerManagerDisruption, internal.ControllerManagerDisruptionTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathCoreDNSClusterRoleBinding, internal.CoreDNSClusterRoleBindingTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathCoreDNSClusterRole, internal.CoreDNSClusterRoleTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathCoreDNSDeployment, internal.CoreDNSDeploymentTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathCoreDNSDisruption, internal.CoreDNSDisruptionTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathCoreDNSSA, internal.CoreDNSServiceAccountTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathCheckpointer, internal.CheckpointerTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathCheckpointerSA, internal.CheckpointerServiceAccount, conf),
-		MustCreateAssetFromTemplate(AssetPathCheckpointerRole, internal.CheckpointerRole, conf),
-		MustCreateAssetFromTemplate(AssetPathCheckpointerRoleBinding, internal.CheckpointerRoleBinding, conf),
-		MustCreateAssetFromTemplate(AssetPathCheckpointerClusterRole, internal.CheckpointerClusterRole, conf),
-		MustCreateAssetFromTemplate(AssetPathCheckpointerClusterRoleBinding, internal.CheckpointerClusterRoleBinding, conf),
-		MustCreateAssetFromTemplate(AssetPathCSRApproverRoleBinding, internal.CSRApproverRoleBindingTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathCSRBootstrapRoleBinding, internal.CSRNodeBootstrapTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathCSRRenewalRoleBinding, internal.CSRRenewalRoleBindingTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathKubeSystemSARoleBinding, internal.KubeSystemSARoleBindingTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathClusterInfoRole, internal.ClusterInfoRoleTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathClusterInfoRoleBinding, internal.ClusterInfoRoleBindingTemplate, conf),
 	}
 	return assets
 }
 
 func newDynamicAssets(conf Config) Assets {
 	assets := Assets{
-		MustCreateAssetFromTemplate(AssetPathControllerManager, internal.ControllerManagerTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathControllerManagerSA, internal.ControllerManagerServiceAccount, conf),
 		MustCreateAssetFromTemplate(AssetPathControllerManagerRB, internal.ControllerManagerClusterRoleBinding, conf),
-		MustCreateAssetFromTemplate(AssetPathAPIServer, internal.APIServerTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathProxy, internal.ProxyTemplate, conf),
-		MustCreateAssetFromTemplate(AssetPathProxySA, internal.ProxyServiceAccount, conf),
-		MustCreateAssetFromTemplate(AssetPathProxyRoleBinding, internal.ProxyClusterRoleBinding, conf),
+		MustCreateAssetFromTemplate(AssetPathSchedulerSA, internal.SchedulerServiceAccount, conf),
+		MustCreateAssetFromTemplate(AssetPathSchedulerRoleBinding, internal.SchedulerClusterRoleBinding, conf),
+		MustCreateAssetFromTemplate(AssetPathSchedulerVolumeRoleBinding, internal.SchedulerVolumeClusterRoleBinding, conf),
+		MustCreateAssetFromTemplate(AssetPathAuthenticationReaderBinding, internal.AuthenticationReaderRoleBinding, conf),
 		MustCreateAssetFromTemplate(AssetPathCoreDNSConfig, internal.CoreDNSConfigTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathCoreDNSSvc, internal.CoreDNSSvcTemplate, conf),
+	}
+	if conf.StaticControlPlane {
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathStaticAPIServer, internal.BootstrapAPIServerTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathStaticControllerManager, internal.BootstrapControllerManagerTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathStaticScheduler, internal.BootstrapSchedulerTemplate, conf),
+		)
+	} else {
+		assets = append(assets, newSelfHostedAssets(conf)...)
+	}
+	if !conf.DisableCSRAutoApproval {
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathCSRApproverRoleBinding, internal.CSRApproverRoleBindingTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathCSRRenewalRoleBinding, internal.CSRRenewalRoleBindingTemplate, conf),
+		)
+	}
+	if conf.DisableNodeAuthorization {
+		assets = append(assets, MustCreateAssetFromTemplate(AssetPathNodeRoleBinding, internal.NodeClusterRoleBindingTemplate, conf))
+	}
+	if !conf.StrictRBAC() {
+		assets = append(assets, MustCreateAssetFromTemplate(AssetPathKubeSystemSARoleBinding, internal.KubeSystemSARoleBindingTemplate, conf))
+	}
+	if !conf.SkipKubeProxy() {
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathProxy, internal.ProxyTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathProxySA, internal.ProxyServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathProxyRoleBinding, internal.ProxyClusterRoleBinding, conf),
+		)
+	}
+	assets = append(assets, newNetworkAssets(conf)...)
+	if conf.ExternalDNSProvider != "" {
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathExternalDNS, internal.ExternalDNSTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathExternalDNSAPIServerService, internal.ExternalDNSAPIServerService, conf),
+			MustCreateAssetFromTemplate(AssetPathExternalDNSSA, internal.ExternalDNSServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathExternalDNSClusterRole, internal.ExternalDNSClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathExternalDNSClusterRoleBinding, internal.ExternalDNSClusterRoleBinding, conf),
+		)
+	}
+	if conf.PodSecurity {
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathAPIServerSA, internal.APIServerServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathPSPPrivileged, internal.PodSecurityPolicyPrivileged, conf),
+			MustCreateAssetFromTemplate(AssetPathPSPBaseline, internal.PodSecurityPolicyBaseline, conf),
+			MustCreateAssetFromTemplate(AssetPathPSPPrivilegedClusterRole, internal.PodSecurityPolicyPrivilegedClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathPSPBaselineClusterRole, internal.PodSecurityPolicyBaselineClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathPSPBaselineBinding, internal.PodSecurityPolicyBaselineBinding, conf),
+			MustCreateAssetFromTemplate(AssetPathPSPNodesBinding, internal.PodSecurityPolicyNodesBinding, conf),
+		)
+		exempt := conf.PodSecurityExemptServiceAccounts()
+		assets = append(assets, newPSPControlPlaneBindingAsset(AssetPathPSPControlPlaneBinding, "kube-system", exempt["kube-system"]))
+		if conf.ControlPlaneNamespace != "kube-system" {
+			assets = append(assets, newPSPControlPlaneBindingAsset(AssetPathPSPControlPlaneNSBinding, conf.ControlPlaneNamespace, exempt[conf.ControlPlaneNamespace]))
+		}
+		// kube-system and the control plane namespace run privileged pods, Pod Security
+		// admission can't exempt them by service account.
+		assets = append(assets, newPodSecurityNamespaceAsset("kube-system", "privileged"))
+		if conf.ControlPlaneNamespace != "kube-system" {
+			assets = append(assets, newPodSecurityNamespaceAsset(conf.ControlPlaneNamespace, "privileged"))
+		}
+		for _, ns := range conf.PodSecurityNamespaces {
+			assets = append(assets, newPodSecurityNamespaceAsset(ns, "baseline"))
+		}
+	} else if conf.ControlPlaneNamespace != "kube-system" {
+		assets = append(assets, newPodSecurityNamespaceAsset(conf.ControlPlaneNamespace, ""))
+	}
+	if conf.DNSAutoscaler {
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathDNSAutoscaler, internal.DNSAutoscalerTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathDNSAutoscalerConfig, internal.DNSAutoscalerConfigTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathDNSAutoscalerSA, internal.DNSAutoscalerServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathDNSAutoscalerClusterRole, internal.DNSAutoscalerClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathDNSAutoscalerClusterRoleBind, internal.DNSAutoscalerClusterRoleBinding, conf),
+		)
+	}
+	if conf.MetricsServer {
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathMetricsServer, internal.MetricsServerTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerService, internal.MetricsServerServiceTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerAPIService, internal.MetricsServerAPIService, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerSA, internal.MetricsServerServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerClusterRole, internal.MetricsServerClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerClusterRoleBind, internal.MetricsServerClusterRoleBinding, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerAggregatedRole, internal.MetricsServerAggregatedClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerAuthDelegator, internal.MetricsServerAuthDelegatorBinding, conf),
+			MustCreateAssetFromTemplate(AssetPathMetricsServerAuthReader, internal.MetricsServerAuthReaderBinding, conf),
+		)
+	}
+	return assets
+}
+
+// newSelfHostedAssets renders the self-hosted control plane and the bootstrap control plane that
+// pivots to it.
+func newSelfHostedAssets(conf Config) Assets {
+	return Assets{
+		MustCreateAssetFromTemplate(AssetPathAPIServer, internal.APIServerTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathAPIServerDisruption, internal.APIServerDisruptionTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathControllerManager, internal.ControllerManagerTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathControllerManagerDisruption, internal.ControllerManagerDisruptionTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathScheduler, internal.SchedulerTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathSchedulerDisruption, internal.SchedulerDisruptionTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathCheckpointer, internal.CheckpointerTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathCheckpointerSA, internal.CheckpointerServiceAccount, conf),
+		MustCreateAssetFromTemplate(AssetPathCheckpointerRole, internal.CheckpointerRole, conf),
+		MustCreateAssetFromTemplate(AssetPathCheckpointerRoleBinding, internal.CheckpointerRoleBinding, conf),
+		MustCreateAssetFromTemplate(AssetPathCheckpointerClusterRole, internal.CheckpointerClusterRole, conf),
+		MustCreateAssetFromTemplate(AssetPathCheckpointerClusterRoleBinding, internal.CheckpointerClusterRoleBinding, conf),
 		MustCreateAssetFromTemplate(AssetPathBootstrapAPIServer, internal.BootstrapAPIServerTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathBootstrapControllerManager, internal.BootstrapControllerManagerTemplate, conf),
 		MustCreateAssetFromTemplate(AssetPathBootstrapScheduler, internal.BootstrapSchedulerTemplate, conf),
 	}
+}
+
+// NewNetworkAssets renders the manifests of the network provider of conf alone, e.g. to deploy a
+// different network provider to an existing cluster.
+func NewNetworkAssets(conf Config) (Assets, error) {
+	switch conf.NetworkProvider {
+	case NetworkFlannel, NetworkCalico, NetworkCalicoExperimental, NetworkCanal, NetworkCilium, NetworkWeaveNet, NetworkKubeRouter:
+	default:
+		return nil, fmt.Errorf("unknown network provider %q", conf.NetworkProvider)
+	}
+	if len(conf.APIServers) == 0 {
+		return nil, errors.New("no apiserver URL configured")
+	}
+	return newNetworkAssets(conf), nil
+}
+
+func newNetworkAssets(conf Config) Assets {
+	var assets Assets
 	switch conf.NetworkProvider {
 	case NetworkFlannel:
 		assets = append(assets,
@@ -82,7 +254,7 @@ func newDynamicAssets(conf Config) Assets {
 			MustCreateAssetFromTemplate(AssetPathFlannelClusterRoleBinding, internal.FlannelClusterRoleBinding, conf),
 			MustCreateAssetFromTemplate(AssetPathFlannelSA, internal.FlannelServiceAccount, conf),
 		)
-	case NetworkCalico:
+	case NetworkCalico, NetworkCalicoExperimental:
 		assets = append(assets,
 			MustCreateAssetFromTemplate(AssetPathCalicoCfg, internal.CalicoCfgTemplate, conf),
 			MustCreateAssetFromTemplate(AssetPathCalicoRole, internal.CalicoRoleTemplate, conf),
@@ -113,25 +285,102 @@ func newDynamicAssets(conf Config) Assets {
 			MustCreateAssetFromTemplate(AssetPathCalicoNetworkPoliciesCRD, internal.CalicoNetworkPoliciesCRD, conf),
 			MustCreateAssetFromTemplate(AssetPathCalicoClusterInformationsCRD, internal.CalicoClusterInformationsCRD, conf),
 			MustCreateAssetFromTemplate(AssetPathCalicoIPPoolsCRD, internal.CalicoIPPoolsCRD, conf))
+	case NetworkCilium:
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathCilium, internal.CiliumTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumCfg, internal.CiliumCfgTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumSA, internal.CiliumServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumClusterRole, internal.CiliumClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumClusterRoleBinding, internal.CiliumClusterRoleBinding, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumOperator, internal.CiliumOperatorTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumOperatorSA, internal.CiliumOperatorServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumOperatorClusterRole, internal.CiliumOperatorClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathCiliumOperatorClusterRoleBind, internal.CiliumOperatorClusterRoleBinding, conf),
+		)
+	case NetworkWeaveNet:
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathWeaveNet, internal.WeaveNetTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathWeaveNetSA, internal.WeaveNetServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathWeaveNetClusterRole, internal.WeaveNetClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathWeaveNetClusterRoleBinding, internal.WeaveNetClusterRoleBinding, conf),
+			MustCreateAssetFromTemplate(AssetPathWeaveNetRole, internal.WeaveNetRole, conf),
+			MustCreateAssetFromTemplate(AssetPathWeaveNetRoleBinding, internal.WeaveNetRoleBinding, conf),
+		)
+	case NetworkNone:
+		// The network provider is deployed separately.
+	case NetworkKubeRouter:
+		assets = append(assets,
+			MustCreateAssetFromTemplate(AssetPathKubeRouter, internal.KubeRouterTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathKubeRouterCfg, internal.KubeRouterCfgTemplate, conf),
+			MustCreateAssetFromTemplate(AssetPathKubeRouterSA, internal.KubeRouterServiceAccount, conf),
+			MustCreateAssetFromTemplate(AssetPathKubeRouterClusterRole, internal.KubeRouterClusterRole, conf),
+			MustCreateAssetFromTemplate(AssetPathKubeRouterClusterRoleBinding, internal.KubeRouterClusterRoleBinding, conf),
+		)
 	}
 	return assets
 }
 
-const validBootstrapTokenChars = "0123456789abcdefghijklmnopqrstuvwxyz"
+// AssetPathPodSecurityNamespace is the path of the Namespace manifest of ns, which labels it for
+// Pod Security admission.
+func AssetPathPodSecurityNamespace(ns string) string {
+	return fmt.Sprintf("%s/namespace-%s.yaml", AssetPathManifests, ns)
+}
+
+func newPodSecurityNamespaceAsset(ns, enforce string) Asset {
+	return MustCreateAssetFromTemplate(AssetPathPodSecurityNamespace(ns), internal.PodSecurityNamespaceTemplate, struct {
+		Name    string
+		Enforce string
+	}{ns, enforce})
+}
+
+func newPSPControlPlaneBindingAsset(path, ns string, serviceAccounts []string) Asset {
+	return MustCreateAssetFromTemplate(path, internal.PodSecurityPolicyControlPlaneBinding, struct {
+		Namespace       string
+		ServiceAccounts []string
+	}{ns, serviceAccounts})
+}
+
+// newWeaveNetPasswordAsset generates a random weave-net network password Secret.
+func newWeaveNetPasswordAsset() (Asset, error) {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return Asset{}, err
+	}
+	// weave-net reads the password as a string, so keep it printable.
+	encoded := base64.RawURLEncoding.EncodeToString(password)
+	return MustCreateAssetFromTemplate(AssetPathWeaveNetPasswordSecret, internal.WeaveNetPasswordSecretTemplate, struct {
+		Password string
+	}{
+		Password: base64.StdEncoding.EncodeToString([]byte(encoded)),
+	}), nil
+}
 
-// newBootstrapToken constructs a bootstrap token in conformance with the following format:
-// https://kubernetes.io/docs/admin/bootstrap-tokens/#token-format
-func newBootstrapToken() (id string, secret string, err error) {
-	// Read 6 random bytes for the id and 16 random bytes for the token (see spec for details).
-	token := make([]byte, 6+16)
-	if _, err := rand.Read(token); err != nil {
-		return "", "", err
+// NewEncryptionKey returns a random 32 byte key, base64 encoded, for the aescbc and secretbox
+// encryption at rest providers.
+func NewEncryptionKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
 	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
 
-	for i, b := range token {
-		token[i] = validBootstrapTokenChars[int(b)%len(validBootstrapTokenChars)]
+// newEncryptionConfigAsset generates an EncryptionConfiguration encrypting secrets with a fresh
+// key of provider.
+func newEncryptionConfigAsset(provider string) (Asset, error) {
+	secret, err := NewEncryptionKey()
+	if err != nil {
+		return Asset{}, err
 	}
-	return string(token[:6]), string(token[6:]), nil
+	return MustCreateAssetFromTemplate(AssetPathEncryptionConfig, internal.EncryptionConfigTemplate, struct {
+		Provider string
+		KeyName  string
+		Secret   string
+	}{
+		Provider: provider,
+		KeyName:  "key1",
+		Secret:   secret,
+	}), nil
 }
 
 func newKubeConfigAssets(assets Assets, conf Config) ([]Asset, error) {
@@ -150,7 +399,28 @@ func newKubeConfigAssets(assets Assets, conf Config) ([]Asset, error) {
 		return nil, err
 	}
 
-	bootstrapTokenID, bootstrapTokenSecret, err := newBootstrapToken()
+	bootstrapTokenID, bootstrapTokenSecret, err := NewBootstrapToken()
+	if err != nil {
+		return nil, err
+	}
+	var bootstrapTokenExpiration string
+	if conf.BootstrapTokenTTL > 0 {
+		bootstrapTokenExpiration = time.Now().Add(conf.BootstrapTokenTTL).UTC().Format(time.RFC3339)
+	}
+
+	// The bootstrap kubeconfig only has to outlive bootkube start, so that a copy left behind on
+	// the provisioning host stops being useful soon after.
+	ttl := conf.BootstrapKubeConfigTTL
+	if ttl == 0 {
+		ttl = DefaultBootstrapKubeConfigTTL
+	}
+	bootstrapKey, bootstrapCert, err := newAdminKeyAndCert(conf.CACert, conf.CAPrivKey, tlsutil.CertConfig{
+		CommonName:         "bootkube",
+		Organization:       []string{orgSystemMasters},
+		OrganizationalUnit: []string{"bootstrap"},
+		Validity:           ttl,
+		ClientOnly:         true,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -158,19 +428,33 @@ func newKubeConfigAssets(assets Assets, conf Config) ([]Asset, error) {
 	cfg := struct {
 		Cluster              string
 		Server               string
+		BootstrapServer      string
 		CACert               string
 		AdminCert            string
 		AdminKey             string
+		BootstrapCert        string
+		BootstrapKey         string
 		BootstrapTokenID     string
 		BootstrapTokenSecret string
+		// BootstrapTokenExpiration is empty for a token that doesn't expire.
+		BootstrapTokenExpiration string
+		CACertHash               string
+		// Namespace is the namespace of the kubeconfig-in-cluster ConfigMap.
+		Namespace string
 	}{
-		Server:               conf.APIServers[0].String(),
-		Cluster:              conf.ClusterName,
-		CACert:               base64.StdEncoding.EncodeToString(caCert.Data),
-		AdminCert:            base64.StdEncoding.EncodeToString(adminCert.Data),
-		AdminKey:             base64.StdEncoding.EncodeToString(adminKey.Data),
-		BootstrapTokenID:     bootstrapTokenID,
-		BootstrapTokenSecret: bootstrapTokenSecret,
+		Server:                   conf.APIServers[0].String(),
+		BootstrapServer:          conf.BootstrapAPIServerURL().String(),
+		Cluster:                  conf.ClusterName,
+		CACert:                   base64.StdEncoding.EncodeToString(caCert.Data),
+		AdminCert:                base64.StdEncoding.EncodeToString(adminCert.Data),
+		AdminKey:                 base64.StdEncoding.EncodeToString(adminKey.Data),
+		BootstrapCert:            base64.StdEncoding.EncodeToString(tlsutil.EncodeCertificatePEM(bootstrapCert)),
+		BootstrapKey:             base64.StdEncoding.EncodeToString(tlsutil.EncodePrivateKeyPEM(bootstrapKey)),
+		BootstrapTokenID:         bootstrapTokenID,
+		BootstrapTokenSecret:     bootstrapTokenSecret,
+		BootstrapTokenExpiration: bootstrapTokenExpiration,
+		CACertHash:               CACertHash(conf.CACert),
+		Namespace:                "kube-system",
 	}
 
 	templates := []struct {
@@ -178,9 +462,11 @@ func newKubeConfigAssets(assets Assets, conf Config) ([]Asset, error) {
 		tmpl []byte
 	}{
 		{AssetPathAdminKubeConfig, internal.AdminKubeConfigTemplate},
+		{AssetPathBootstrapKubeConfig, internal.BootstrapKubeConfigTemplate},
 		{AssetPathKubeConfigInCluster, internal.KubeConfigInClusterTemplate},
 		{AssetPathKubeletKubeConfig, internal.KubeletKubeConfigTemplate},
 		{AssetPathKubeletBootstrapToken, internal.KubeletBootstrappingToken},
+		{AssetPathClusterInfo, internal.ClusterInfoTemplate},
 	}
 
 	var as []Asset
@@ -191,10 +477,112 @@ func newKubeConfigAssets(assets Assets, conf Config) ([]Asset, error) {
 		}
 		as = append(as, a)
 	}
+	// kube-proxy and the pod checkpointer mount kubeconfig-in-cluster from their own namespace.
+	if conf.ControlPlaneNamespace != cfg.Namespace {
+		cfg.Namespace = conf.ControlPlaneNamespace
+		a, err := assetFromTemplate(AssetPathKubeConfigInClusterCP, internal.KubeConfigInClusterTemplate, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("rendering template %s: %v", AssetPathKubeConfigInClusterCP, err)
+		}
+		as = append(as, a)
+	}
+
+	if !conf.StrictRBAC() {
+		return as, nil
+	}
+	// The bootstrap controller-manager and scheduler authenticate as themselves so they only get
+	// the permissions of their built-in roles. Like the bootstrap kubeconfig, their certificates
+	// are only needed until the self-hosted control plane takes over, unless the static control
+	// plane is permanent.
+	componentTTL := ttl
+	if conf.StaticControlPlane {
+		componentTTL = 0
+	}
+	for _, c := range []struct {
+		path string
+		user string
+	}{
+		{AssetPathControllerManagerKubeConfig, "system:kube-controller-manager"},
+		{AssetPathSchedulerKubeConfig, "system:kube-scheduler"},
+	} {
+		key, cert, err := newAdminKeyAndCert(conf.CACert, conf.CAPrivKey, tlsutil.CertConfig{
+			CommonName: c.user,
+			Validity:   componentTTL,
+			ClientOnly: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		a, err := assetFromTemplate(c.path, internal.ComponentKubeConfigTemplate, struct {
+			Cluster string
+			Server  string
+			CACert  string
+			User    string
+			Cert    string
+			Key     string
+		}{
+			Cluster: cfg.Cluster,
+			Server:  cfg.BootstrapServer,
+			CACert:  cfg.CACert,
+			User:    c.user,
+			Cert:    base64.StdEncoding.EncodeToString(tlsutil.EncodeCertificatePEM(cert)),
+			Key:     base64.StdEncoding.EncodeToString(tlsutil.EncodePrivateKeyPEM(key)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rendering template %s: %v", c.path, err)
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// newKubeletBundleAssets returns the worker join bundle: the files a node needs to run a kubelet
+// joining the cluster.
+func newKubeletBundleAssets(assets Assets, conf Config) ([]Asset, error) {
+	kubeConfig, err := assets.Get(AssetPathKubeletKubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := assets.Get(AssetPathCACert)
+	if err != nil {
+		return nil, err
+	}
+	config, err := assetFromTemplate(AssetPathKubeletConfig, internal.KubeletConfigTemplate, conf)
+	if err != nil {
+		return nil, fmt.Errorf("rendering template %s: %v", AssetPathKubeletConfig, err)
+	}
+	as := []Asset{
+		{Name: AssetPathKubeletBundleKubeConfig, Data: kubeConfig.Data},
+		{Name: AssetPathKubeletBundleCACert, Data: caCert.Data},
+		config,
+	}
+	if conf.KubeletSystemdUnit {
+		unit, err := assetFromTemplate(AssetPathKubeletSystemdUnit, internal.KubeletSystemdUnitTemplate, conf)
+		if err != nil {
+			return nil, fmt.Errorf("rendering template %s: %v", AssetPathKubeletSystemdUnit, err)
+		}
+		as = append(as, unit)
+	}
 	return as, nil
 }
 
-func newAPIServerSecretAsset(assets Assets, etcdUseTLS bool) (Asset, error) {
+// newAuditAssets returns the audit policy and webhook configuration of the apiserver.
+func newAuditAssets(conf Config) []Asset {
+	if !conf.Audit {
+		return nil
+	}
+	policy := conf.AuditPolicy
+	if len(policy) == 0 {
+		policy = internal.DefaultAuditPolicy
+	}
+	as := []Asset{{Name: AssetPathAuditPolicy, Data: policy}}
+	if len(conf.AuditWebhookConfig) > 0 {
+		as = append(as, Asset{Name: AssetPathAuditWebhookConfig, Data: conf.AuditWebhookConfig})
+	}
+	return as
+}
+
+func newAPIServerSecretAsset(assets Assets, conf Config) (Asset, error) {
 	secretAssets := []string{
 		AssetPathAPIServerKey,
 		AssetPathAPIServerCert,
@@ -206,15 +594,37 @@ func newAPIServerSecretAsset(assets Assets, etcdUseTLS bool) (Asset, error) {
 		AssetPathKubeletClientKey,
 		AssetPathCACert,
 	}
-	if etcdUseTLS {
+	if conf.EtcdUseTLS {
 		secretAssets = append(secretAssets, []string{
 			AssetPathEtcdClientCA,
 			AssetPathEtcdClientCert,
 			AssetPathEtcdClientKey,
 		}...)
 	}
+	if conf.EncryptionProvider != "" {
+		secretAssets = append(secretAssets, AssetPathEncryptionConfig)
+	}
+	if len(conf.CloudConfig) > 0 {
+		secretAssets = append(secretAssets, AssetPathCloudConfig)
+	}
+	if len(conf.OIDCCACert) > 0 {
+		secretAssets = append(secretAssets, AssetPathOIDCCACert)
+	}
+	if conf.Admission != nil {
+		secretAssets = append(secretAssets, AssetPathAdmissionConfig)
+		secretAssets = append(secretAssets, conf.Admission.fileNames()...)
+	}
+	if conf.Konnectivity {
+		secretAssets = append(secretAssets, AssetPathKonnectivityServerCert, AssetPathKonnectivityServerKey, AssetPathEgressSelectorConfig)
+	}
+	if conf.Audit {
+		secretAssets = append(secretAssets, AssetPathAuditPolicy)
+		if len(conf.AuditWebhookConfig) > 0 {
+			secretAssets = append(secretAssets, AssetPathAuditWebhookConfig)
+		}
+	}
 
-	secretYAML, err := secretFromAssets(secretAPIServerName, secretNamespace, secretAssets, assets)
+	secretYAML, err := secretFromAssets(secretAPIServerName, conf.ControlPlaneNamespace, secretAssets, assets)
 	if err != nil {
 		return Asset{}, err
 	}
@@ -222,14 +632,17 @@ func newAPIServerSecretAsset(assets Assets, etcdUseTLS bool) (Asset, error) {
 	return Asset{Name: AssetPathAPIServerSecret, Data: secretYAML}, nil
 }
 
-func newControllerManagerSecretAsset(assets Assets) (Asset, error) {
+func newControllerManagerSecretAsset(assets Assets, conf Config) (Asset, error) {
 	secretAssets := []string{
 		AssetPathServiceAccountPrivKey,
 		AssetPathCACert,
 		AssetPathCAKey,
 	}
+	if len(conf.CloudConfig) > 0 {
+		secretAssets = append(secretAssets, AssetPathCloudConfig)
+	}
 
-	secretYAML, err := secretFromAssets(secretCMName, secretNamespace, secretAssets, assets)
+	secretYAML, err := secretFromAssets(secretCMName, conf.ControlPlaneNamespace, secretAssets, assets)
 	if err != nil {
 		return Asset{}, err
 	}
@@ -0,0 +1,2155 @@
+package asset
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+func testConfig(t *testing.T, networkProvider string) Config {
+	_, podCIDR, err := net.ParseCIDR("10.2.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, serviceCIDR, err := net.ParseCIDR("10.3.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiServer, err := url.Parse("https://127.0.0.1:6443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etcdServer, err := url.Parse("http://127.0.0.1:2379")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Config{
+		APIServers:            []*url.URL{apiServer},
+		EtcdServers:           []*url.URL{etcdServer},
+		PodCIDRs:              []*net.IPNet{podCIDR},
+		ServiceCIDRs:          []*net.IPNet{serviceCIDR},
+		APIServiceIPs:         []net.IP{net.ParseIP("10.3.0.1")},
+		DNSServiceIPs:         []net.IP{net.ParseIP("10.3.0.10")},
+		NetworkProvider:       networkProvider,
+		Images:                DefaultImages,
+		ControlPlaneNamespace: DefaultControlPlaneNamespace,
+	}
+}
+
+func TestCalicoAssets(t *testing.T) {
+	for _, provider := range []string{NetworkCalico, NetworkCalicoExperimental} {
+		as := newDynamicAssets(testConfig(t, provider))
+		node, err := as.Get(AssetPathCalico)
+		if err != nil {
+			t.Fatalf("%s: %v", provider, err)
+		}
+		if !strings.Contains(string(node.Data), `value: "10.2.0.0/16"`) {
+			t.Errorf("%s: calico-node does not use the pod CIDR:\n%s", provider, node.Data)
+		}
+		for _, name := range []string{AssetPathCalicoCfg, AssetPathCalicoRole, AssetPathCalicoIPPoolsCRD} {
+			if _, err := as.Get(name); err != nil {
+				t.Errorf("%s: %v", provider, err)
+			}
+		}
+		if _, err := as.Get(AssetPathFlannel); err == nil {
+			t.Errorf("%s: unexpected flannel asset", provider)
+		}
+	}
+}
+
+func TestCiliumAssets(t *testing.T) {
+	for _, tc := range []struct {
+		mode          string
+		wantKubeProxy bool
+	}{
+		{mode: CiliumKubeProxyReplacementDisabled, wantKubeProxy: true},
+		{mode: CiliumKubeProxyReplacementPartial, wantKubeProxy: true},
+		{mode: CiliumKubeProxyReplacementStrict, wantKubeProxy: false},
+	} {
+		conf := testConfig(t, NetworkCilium)
+		conf.CiliumKubeProxyReplacement = tc.mode
+		as := newDynamicAssets(conf)
+		for _, name := range []string{AssetPathCilium, AssetPathCiliumCfg, AssetPathCiliumOperator, AssetPathCiliumClusterRole, AssetPathCiliumOperatorClusterRole} {
+			if _, err := as.Get(name); err != nil {
+				t.Errorf("%s: %v", tc.mode, err)
+			}
+		}
+		cfg, err := as.Get(AssetPathCiliumCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(cfg.Data), `kube-proxy-replacement: "`+tc.mode+`"`) {
+			t.Errorf("%s: cilium-config does not set the kube-proxy replacement mode:\n%s", tc.mode, cfg.Data)
+		}
+		if _, err := as.Get(AssetPathProxy); (err == nil) != tc.wantKubeProxy {
+			t.Errorf("%s: kube-proxy rendered = %t, want: %t", tc.mode, err == nil, tc.wantKubeProxy)
+		}
+		ds, err := as.Get(AssetPathCilium)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(string(ds.Data), "KUBERNETES_SERVICE_HOST"); got == tc.wantKubeProxy {
+			t.Errorf("%s: KUBERNETES_SERVICE_HOST set = %t, want: %t", tc.mode, got, !tc.wantKubeProxy)
+		}
+	}
+}
+
+func TestKubeRouterAssets(t *testing.T) {
+	for _, serviceProxy := range []bool{true, false} {
+		conf := testConfig(t, NetworkKubeRouter)
+		conf.KubeRouterServiceProxy = serviceProxy
+		as := newDynamicAssets(conf)
+		for _, name := range []string{AssetPathKubeRouter, AssetPathKubeRouterCfg, AssetPathKubeRouterSA, AssetPathKubeRouterClusterRole, AssetPathKubeRouterClusterRoleBinding} {
+			if _, err := as.Get(name); err != nil {
+				t.Errorf("service proxy %t: %v", serviceProxy, err)
+			}
+		}
+		if _, err := as.Get(AssetPathProxy); (err == nil) == serviceProxy {
+			t.Errorf("service proxy %t: kube-proxy rendered = %t, want: %t", serviceProxy, err == nil, !serviceProxy)
+		}
+		ds, err := as.Get(AssetPathKubeRouter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("--run-service-proxy=%t", serviceProxy); !strings.Contains(string(ds.Data), want) {
+			t.Errorf("service proxy %t: kube-router DaemonSet does not contain %q:\n%s", serviceProxy, want, ds.Data)
+		}
+		if got := strings.Contains(string(ds.Data), "KUBERNETES_SERVICE_HOST"); got != serviceProxy {
+			t.Errorf("service proxy %t: KUBERNETES_SERVICE_HOST set = %t, want: %t", serviceProxy, got, serviceProxy)
+		}
+	}
+}
+
+func TestNoNetworkProviderAssets(t *testing.T) {
+	as := newDynamicAssets(testConfig(t, NetworkNone))
+	for _, a := range as {
+		for _, provider := range []string{"flannel", "calico", "cilium", "weave", "kube-router"} {
+			if strings.Contains(a.Name, provider) {
+				t.Errorf("unexpected %s asset %s", provider, a.Name)
+			}
+		}
+	}
+	if _, err := as.Get(AssetPathProxy); err != nil {
+		t.Errorf("kube-proxy not rendered: %v", err)
+	}
+	for _, name := range []string{AssetPathControllerManager, AssetPathBootstrapControllerManager} {
+		cm, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"--allocate-node-cidrs=true", "--cluster-cidr=10.2.0.0/16"} {
+			if !strings.Contains(string(cm.Data), want) {
+				t.Errorf("%s does not contain %q", name, want)
+			}
+		}
+	}
+}
+
+func TestAPIServerRequestHeaderFlags(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	apiserver, err := newDynamicAssets(conf).Get(AssetPathAPIServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--requestheader-allowed-names=front-proxy-client\n", "--requestheader-username-headers=X-Remote-User\n"} {
+		if !strings.Contains(string(apiserver.Data), want) {
+			t.Errorf("expected default flag %q in kube-apiserver manifest", want)
+		}
+	}
+	if strings.Contains(string(apiserver.Data), "lb-health-check") {
+		t.Errorf("unexpected load balancer annotations in kube-apiserver manifest")
+	}
+
+	conf.RequestHeaderAllowedNames = "front-proxy-client,l7-proxy"
+	conf.APIServerLBAnnotations = true
+	apiserver, err = newDynamicAssets(conf).Get(AssetPathAPIServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--requestheader-allowed-names=front-proxy-client,l7-proxy\n", `lb-health-check: "TCP:6443"`} {
+		if !strings.Contains(string(apiserver.Data), want) {
+			t.Errorf("expected %q in kube-apiserver manifest:\n%s", want, apiserver.Data)
+		}
+	}
+}
+
+func TestAPIServerHardening(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	as := newDynamicAssets(conf)
+	for name, want := range map[string][]string{
+		AssetPathAPIServer:                  {"--anonymous-auth=false\n", "--insecure-port=0\n"},
+		AssetPathBootstrapAPIServer:         {"--anonymous-auth=false\n"},
+		AssetPathControllerManager:          {"port: 10252"},
+		AssetPathScheduler:                  {"port: 10251"},
+		AssetPathBootstrapControllerManager: {"--leader-elect=true\n"},
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("expected %q in %s:\n%s", w, name, a.Data)
+			}
+		}
+		for _, unwanted := range []string{"livenessProbe:\n          httpGet:\n            path: /healthz\n            port: 6443", "--port=0", "scheme: HTTPS"} {
+			if strings.Contains(string(a.Data), unwanted) {
+				t.Errorf("unexpected %q in %s", unwanted, name)
+			}
+		}
+	}
+
+	conf.AnonymousAuth = true
+	conf.DisableInsecurePort = true
+	conf.APIServerLBAnnotations = true
+	as = newDynamicAssets(conf)
+	for name, want := range map[string][]string{
+		AssetPathAPIServer:                  {"--anonymous-auth=true\n", "path: /healthz\n            port: 6443\n            scheme: HTTPS\n", `lb-health-check: "HTTPS:6443/healthz"`},
+		AssetPathBootstrapAPIServer:         {"--anonymous-auth=true\n", "--insecure-port=0\n"},
+		AssetPathControllerManager:          {"--port=0\n", "port: 10257", "scheme: HTTPS"},
+		AssetPathScheduler:                  {"--port=0\n", "port: 10259", "scheme: HTTPS"},
+		AssetPathBootstrapControllerManager: {"--port=0\n"},
+		AssetPathBootstrapScheduler:         {"--port=0\n"},
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("expected %q in %s:\n%s", w, name, a.Data)
+			}
+		}
+	}
+}
+
+func TestWeaveNetAssets(t *testing.T) {
+	conf := testConfig(t, NetworkWeaveNet)
+	as := newDynamicAssets(conf)
+	ds, err := as.Get(AssetPathWeaveNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(ds.Data), `value: "10.2.0.0/16"`) {
+		t.Errorf("weave-net does not use the pod CIDR:\n%s", ds.Data)
+	}
+	if strings.Contains(string(ds.Data), "WEAVE_PASSWORD") {
+		t.Errorf("unexpected WEAVE_PASSWORD without encryption")
+	}
+
+	conf.WeaveEncryption = true
+	as = newDynamicAssets(conf)
+	ds, err = as.Get(AssetPathWeaveNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(ds.Data), "WEAVE_PASSWORD") {
+		t.Errorf("expected WEAVE_PASSWORD with encryption:\n%s", ds.Data)
+	}
+	secret, err := newWeaveNetPasswordAsset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newWeaveNetPasswordAsset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data) == string(other.Data) {
+		t.Errorf("expected a random password for each render")
+	}
+}
+
+func TestExternalDNSAssets(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	if _, err := newDynamicAssets(conf).Get(AssetPathExternalDNS); err == nil {
+		t.Error("external-dns rendered without a provider")
+	}
+
+	apiServer, err := url.Parse("https://api.k8s.example.com:6443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.APIServers = []*url.URL{apiServer}
+	conf.ExternalDNSProvider = "aws"
+	conf.ExternalDNSZone = "example.com"
+	conf.ExternalDNSTarget = "10.0.0.100"
+	as := newDynamicAssets(conf)
+	for _, name := range []string{AssetPathExternalDNS, AssetPathExternalDNSSA, AssetPathExternalDNSClusterRole, AssetPathExternalDNSClusterRoleBinding} {
+		if _, err := as.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+	svc, err := as.Get(AssetPathExternalDNSAPIServerService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Metadata struct {
+			Annotations map[string]string
+		}
+	}
+	if err := yaml.Unmarshal(svc.Data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Metadata.Annotations["external-dns.alpha.kubernetes.io/hostname"]; got != "api.k8s.example.com" {
+		t.Errorf("got hostname annotation %q, want: api.k8s.example.com", got)
+	}
+	if got := s.Metadata.Annotations["external-dns.alpha.kubernetes.io/target"]; got != "10.0.0.100" {
+		t.Errorf("got target annotation %q, want: 10.0.0.100", got)
+	}
+}
+
+func TestDNSAutoscalerAssets(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	if _, err := newDynamicAssets(conf).Get(AssetPathDNSAutoscaler); err == nil {
+		t.Error("dns-autoscaler rendered without --dns-autoscaler")
+	}
+
+	conf.DNSAutoscaler = true
+	conf.DNSAutoscalerCoresPerReplica = 128
+	conf.DNSAutoscalerNodesPerReplica = 8
+	as := newDynamicAssets(conf)
+	for _, name := range []string{AssetPathDNSAutoscaler, AssetPathDNSAutoscalerSA, AssetPathDNSAutoscalerClusterRole, AssetPathDNSAutoscalerClusterRoleBind} {
+		if _, err := as.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+	cm, err := as.Get(AssetPathDNSAutoscalerConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c struct {
+		Data map[string]string
+	}
+	if err := yaml.Unmarshal(cm.Data, &c); err != nil {
+		t.Fatal(err)
+	}
+	var params struct {
+		CoresPerReplica int
+		NodesPerReplica int
+	}
+	if err := json.Unmarshal([]byte(c.Data["linear"]), &params); err != nil {
+		t.Fatalf("invalid linear parameters: %v", err)
+	}
+	if params.CoresPerReplica != 128 || params.NodesPerReplica != 8 {
+		t.Errorf("got %+v, want 128 cores and 8 nodes per replica", params)
+	}
+}
+
+func TestMetricsServerAssets(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	if _, err := newDynamicAssets(conf).Get(AssetPathMetricsServer); err == nil {
+		t.Error("metrics-server rendered without --render-metrics-server")
+	}
+
+	conf.MetricsServer = true
+	as := newDynamicAssets(conf)
+	for _, name := range []string{AssetPathMetricsServer, AssetPathMetricsServerService, AssetPathMetricsServerSA, AssetPathMetricsServerClusterRole, AssetPathMetricsServerClusterRoleBind, AssetPathMetricsServerAggregatedRole, AssetPathMetricsServerAuthDelegator, AssetPathMetricsServerAuthReader} {
+		if _, err := as.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+	a, err := as.Get(AssetPathMetricsServerAPIService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiService struct {
+		Spec struct {
+			Group   string
+			Version string
+			Service struct {
+				Name      string
+				Namespace string
+			}
+		}
+	}
+	if err := yaml.Unmarshal(a.Data, &apiService); err != nil {
+		t.Fatal(err)
+	}
+	if s := apiService.Spec; s.Group != "metrics.k8s.io" || s.Version != "v1beta1" || s.Service.Name != "metrics-server" || s.Service.Namespace != "kube-system" {
+		t.Errorf("unexpected APIService spec %+v", s)
+	}
+}
+
+func TestAuditAssets(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	if as := newAuditAssets(conf); len(as) != 0 {
+		t.Errorf("audit assets rendered with audit disabled: %v", as)
+	}
+
+	conf.Audit = true
+	conf.AuditLogPath = "/var/log/kubernetes/audit/audit.log"
+	conf.AuditLogMaxAge = 7
+	conf.AuditWebhookConfig = []byte("kind: Config\n")
+	audit := newAuditAssets(conf)
+	policy, err := Assets(audit).Get(AssetPathAuditPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p struct {
+		Kind  string
+		Rules []interface{}
+	}
+	if err := yaml.Unmarshal(policy.Data, &p); err != nil || p.Kind != "Policy" || len(p.Rules) == 0 {
+		t.Errorf("invalid default audit policy: %v\n%s", err, policy.Data)
+	}
+	if _, err := Assets(audit).Get(AssetPathAuditWebhookConfig); err != nil {
+		t.Error(err)
+	}
+
+	as := newDynamicAssets(conf)
+	for _, name := range []string{AssetPathAPIServer, AssetPathBootstrapAPIServer} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v map[string]interface{}
+		if err := yaml.Unmarshal(a.Data, &v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, want := range []string{
+			"--audit-policy-file=/etc/kubernetes/secrets/audit-policy.yaml",
+			"--audit-log-path=/var/log/kubernetes/audit/audit.log",
+			"--audit-log-maxage=7",
+			"--audit-webhook-config-file=/etc/kubernetes/secrets/audit-webhook-config.yaml",
+			"path: /var/log/kubernetes/audit",
+		} {
+			if !strings.Contains(string(a.Data), want) {
+				t.Errorf("%s does not contain %q", name, want)
+			}
+		}
+	}
+
+	secret, err := newAPIServerSecretAsset(append(newTestTLSAssets(), audit...), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"audit-policy.yaml", "audit-webhook-config.yaml"} {
+		if !strings.Contains(string(secret.Data), want) {
+			t.Errorf("apiserver secret does not contain %s", want)
+		}
+	}
+}
+
+// newTestTLSAssets returns placeholders for the TLS assets of the apiserver secret.
+func newTestTLSAssets() Assets {
+	var as Assets
+	for _, name := range []string{AssetPathAPIServerKey, AssetPathAPIServerCert, AssetPathServiceAccountPubKey, AssetPathAggregatorCA, AssetPathFrontProxyClientCert, AssetPathFrontProxyClientKey, AssetPathKubeletClientCert, AssetPathKubeletClientKey, AssetPathCACert} {
+		as = append(as, Asset{Name: name, Data: []byte(name)})
+	}
+	return as
+}
+
+func TestEncryptionConfig(t *testing.T) {
+	for _, provider := range []string{EncryptionProviderAESCBC, EncryptionProviderSecretbox} {
+		a, err := newEncryptionConfigAsset(provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config struct {
+			Kind      string
+			Resources []struct {
+				Resources []string
+				Providers []map[string]struct {
+					Keys []struct {
+						Name   string
+						Secret string
+					}
+				}
+			}
+		}
+		if err := yaml.Unmarshal(a.Data, &config); err != nil {
+			t.Fatalf("%s: %v", provider, err)
+		}
+		if config.Kind != "EncryptionConfiguration" || len(config.Resources) != 1 || len(config.Resources[0].Providers) != 2 {
+			t.Fatalf("%s: unexpected encryption config:\n%s", provider, a.Data)
+		}
+		keys := config.Resources[0].Providers[0][provider].Keys
+		if len(keys) != 1 {
+			t.Fatalf("%s: got %d keys, want: 1", provider, len(keys))
+		}
+		if key, err := base64.StdEncoding.DecodeString(keys[0].Secret); err != nil || len(key) != 32 {
+			t.Errorf("%s: invalid key %q: %v", provider, keys[0].Secret, err)
+		}
+		if _, ok := config.Resources[0].Providers[1]["identity"]; !ok {
+			t.Errorf("%s: the identity provider must be last", provider)
+		}
+	}
+
+	conf := testConfig(t, NetworkFlannel)
+	conf.EncryptionProvider = EncryptionProviderAESCBC
+	as := newDynamicAssets(conf)
+	for _, name := range []string{AssetPathAPIServer, AssetPathBootstrapAPIServer} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(a.Data), "--encryption-provider-config=/etc/kubernetes/secrets/encryption-config.yaml") {
+			t.Errorf("%s does not set --encryption-provider-config", name)
+		}
+	}
+}
+
+func TestBootstrapKubeConfig(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.BootstrapKubeConfigTTL = time.Hour
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{AssetPathAdminKubeConfig, AssetPathBootstrapKubeConfig} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var kubeconfig struct {
+			Users []struct {
+				User struct {
+					ClientCertificateData []byte `json:"client-certificate-data"`
+				} `json:"user"`
+			} `json:"users"`
+		}
+		if err := yaml.Unmarshal(a.Data, &kubeconfig); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		cert, err := tlsutil.ParsePEMEncodedCACert(kubeconfig.Users[0].User.ClientCertificateData)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ttl := time.Until(cert.NotAfter)
+		if name == AssetPathBootstrapKubeConfig && (ttl > time.Hour || ttl < 59*time.Minute) {
+			t.Errorf("bootstrap kubeconfig expires in %s, want: 1h", ttl)
+		}
+		if name == AssetPathAdminKubeConfig && ttl < 24*time.Hour {
+			t.Errorf("admin kubeconfig expires in %s, want it to be long-lived", ttl)
+		}
+	}
+}
+
+func TestBootstrapAPIServerAddress(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.BootstrapAPIServerPort = 7443
+	conf.BootstrapAdvertiseAddress = net.ParseIP("10.0.0.5")
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		AssetPathBootstrapAPIServer:          "--secure-port=7443\n",
+		AssetPathAPIServer:                   "--secure-port=6443\n",
+		AssetPathBootstrapKubeConfig:         "server: https://10.0.0.5:7443\n",
+		AssetPathControllerManagerKubeConfig: "server: https://10.0.0.5:7443\n",
+		AssetPathSchedulerKubeConfig:         "server: https://10.0.0.5:7443\n",
+		AssetPathAdminKubeConfig:             "server: https://127.0.0.1:6443\n",
+		AssetPathKubeletKubeConfig:           "server: https://127.0.0.1:6443\n",
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(a.Data), want) {
+			t.Errorf("expected %q in %s:\n%s", want, name, a.Data)
+		}
+	}
+	a, err := as.Get(AssetPathBootstrapAPIServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(a.Data), "--advertise-address=10.0.0.5\n") {
+		t.Errorf("the bootstrap apiserver doesn't advertise 10.0.0.5:\n%s", a.Data)
+	}
+
+	a, err = as.Get(AssetPathAPIServerCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tlsutil.ParsePEMEncodedCACert(a.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, ip := range cert.IPAddresses {
+		found = found || ip.Equal(conf.BootstrapAdvertiseAddress)
+	}
+	if !found {
+		t.Errorf("the apiserver certificate IPs %v don't include the bootstrap advertise address", cert.IPAddresses)
+	}
+}
+
+func TestStaticControlPlane(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.StaticControlPlane = true
+	conf.BootstrapKubeConfigTTL = time.Hour
+	conf.SchedulerExtraFlags = map[string]string{"v": "4"}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{
+		AssetPathAPIServer,
+		AssetPathControllerManager,
+		AssetPathScheduler,
+		AssetPathCheckpointer,
+		AssetPathAPIServerSecret,
+		AssetPathControllerManagerSecret,
+		AssetPathBootstrapAPIServer,
+		AssetPathBootstrapControllerManager,
+		AssetPathBootstrapScheduler,
+	} {
+		if _, err := as.Get(name); err == nil {
+			t.Errorf("%s is rendered for a static control plane", name)
+		}
+	}
+
+	for name, pod := range map[string]string{
+		AssetPathStaticAPIServer:         "kube-apiserver",
+		AssetPathStaticControllerManager: "kube-controller-manager",
+		AssetPathStaticScheduler:         "kube-scheduler",
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				Volumes []struct {
+					Name     string `json:"name"`
+					HostPath struct {
+						Path string `json:"path"`
+					} `json:"hostPath"`
+				} `json:"volumes"`
+			} `json:"spec"`
+		}
+		if err := yaml.Unmarshal(a.Data, &manifest); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if manifest.Metadata.Name != pod {
+			t.Errorf("%s: got pod name %q, want: %q", name, manifest.Metadata.Name, pod)
+		}
+		for _, v := range manifest.Spec.Volumes {
+			if v.Name == "secrets" && v.HostPath.Path != StaticSecretsDir {
+				t.Errorf("%s: got secrets from %s, want: %s", name, v.HostPath.Path, StaticSecretsDir)
+			}
+		}
+	}
+	a, err := as.Get(AssetPathStaticScheduler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(a.Data), `"--v=4"`) {
+		t.Errorf("%s does not contain the extra flags", AssetPathStaticScheduler)
+	}
+
+	// The component kubeconfigs of a static control plane are permanent.
+	for _, name := range []string{AssetPathControllerManagerKubeConfig, AssetPathSchedulerKubeConfig} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var kubeconfig struct {
+			Users []struct {
+				User struct {
+					ClientCertificateData []byte `json:"client-certificate-data"`
+				} `json:"user"`
+			} `json:"users"`
+		}
+		if err := yaml.Unmarshal(a.Data, &kubeconfig); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		cert, err := tlsutil.ParsePEMEncodedCACert(kubeconfig.Users[0].User.ClientCertificateData)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ttl := time.Until(cert.NotAfter); ttl < 24*time.Hour {
+			t.Errorf("%s expires in %s, want it to be long-lived", name, ttl)
+		}
+	}
+}
+
+func TestRBACProfile(t *testing.T) {
+	for _, profile := range []string{"", RBACProfileStrict, RBACProfileLegacy} {
+		conf := testConfig(t, NetworkFlannel)
+		conf.AltNames = &tlsutil.AltNames{}
+		conf.RBACProfile = profile
+		as, err := NewDefaultAssets(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy := profile == RBACProfileLegacy
+
+		if _, err := as.Get(AssetPathKubeSystemSARoleBinding); (err == nil) != legacy {
+			t.Errorf("profile %q: rendered the kube-system cluster-admin binding: %t, want: %t", profile, err == nil, legacy)
+		}
+
+		for _, c := range []struct {
+			bootstrap  string
+			kubeconfig string
+			user       string
+		}{
+			{AssetPathBootstrapControllerManager, AssetPathControllerManagerKubeConfig, "system:kube-controller-manager"},
+			{AssetPathBootstrapScheduler, AssetPathSchedulerKubeConfig, "system:kube-scheduler"},
+		} {
+			a, err := as.Get(c.bootstrap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			flag := "--kubeconfig=/etc/kubernetes/secrets/" + path.Base(c.kubeconfig)
+			if legacy {
+				flag = "--kubeconfig=/etc/kubernetes/secrets/kubeconfig"
+			}
+			if !strings.Contains(string(a.Data), flag) {
+				t.Errorf("profile %q: %s does not use %s", profile, c.bootstrap, flag)
+			}
+
+			kc, err := as.Get(c.kubeconfig)
+			if legacy {
+				if err == nil {
+					t.Errorf("profile %q: rendered %s", profile, c.kubeconfig)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kubeconfig struct {
+				Users []struct {
+					User struct {
+						ClientCertificateData []byte `json:"client-certificate-data"`
+					} `json:"user"`
+				} `json:"users"`
+			}
+			if err := yaml.Unmarshal(kc.Data, &kubeconfig); err != nil {
+				t.Fatalf("%s: %v", c.kubeconfig, err)
+			}
+			cert, err := tlsutil.ParsePEMEncodedCACert(kubeconfig.Users[0].User.ClientCertificateData)
+			if err != nil {
+				t.Fatalf("%s: %v", c.kubeconfig, err)
+			}
+			if cert.Subject.CommonName != c.user || len(cert.Subject.Organization) != 0 {
+				t.Errorf("%s: got subject %s, want: CN=%s", c.kubeconfig, cert.Subject, c.user)
+			}
+		}
+	}
+}
+
+func TestKubeletBundle(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.KubeletEvictionHard = map[string]string{"memory.available": "100Mi", "nodefs.available": "10%"}
+	conf.KubeletEvictionSoft = map[string]string{"memory.available": "500Mi"}
+	conf.KubeletEvictionSoftGracePeriod = map[string]string{"memory.available": "1m30s"}
+	conf.KubeletSystemReserved = map[string]string{"cpu": "100m", "memory": "256Mi"}
+	conf.KubeletKubeReserved = map[string]string{"cpu": "200m"}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := as.Get(AssetPathKubeletConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Kind                    string            `json:"kind"`
+		EvictionHard            map[string]string `json:"evictionHard"`
+		EvictionSoft            map[string]string `json:"evictionSoft"`
+		EvictionSoftGracePeriod map[string]string `json:"evictionSoftGracePeriod"`
+		SystemReserved          map[string]string `json:"systemReserved"`
+		KubeReserved            map[string]string `json:"kubeReserved"`
+	}
+	if err := yaml.Unmarshal(a.Data, &config); err != nil {
+		t.Fatalf("%s: %v", AssetPathKubeletConfig, err)
+	}
+	if config.Kind != "KubeletConfiguration" {
+		t.Errorf("got kind %q, want: KubeletConfiguration", config.Kind)
+	}
+	for name, c := range map[string][2]map[string]string{
+		"evictionHard":            {config.EvictionHard, conf.KubeletEvictionHard},
+		"evictionSoft":            {config.EvictionSoft, conf.KubeletEvictionSoft},
+		"evictionSoftGracePeriod": {config.EvictionSoftGracePeriod, conf.KubeletEvictionSoftGracePeriod},
+		"systemReserved":          {config.SystemReserved, conf.KubeletSystemReserved},
+		"kubeReserved":            {config.KubeReserved, conf.KubeletKubeReserved},
+	} {
+		if fmt.Sprint(c[0]) != fmt.Sprint(c[1]) {
+			t.Errorf("%s: got %v, want: %v", name, c[0], c[1])
+		}
+	}
+
+	for bundle, source := range map[string]string{
+		AssetPathKubeletBundleKubeConfig: AssetPathKubeletKubeConfig,
+		AssetPathKubeletBundleCACert:     AssetPathCACert,
+	} {
+		b, err := as.Get(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := as.Get(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b.Data) != string(s.Data) {
+			t.Errorf("%s differs from %s", bundle, source)
+		}
+	}
+}
+
+func TestPodSecurityAssets(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		conf := testConfig(t, NetworkCalico)
+		conf.AltNames = &tlsutil.AltNames{}
+		conf.PodSecurity = enabled
+		if enabled {
+			conf.PodSecurityNamespaces = []string{"apps"}
+		}
+		as, err := NewDefaultAssets(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, p := range []string{AssetPathPSPPrivileged, AssetPathPSPBaseline, AssetPathPSPControlPlaneBinding, AssetPathPodSecurityNamespace("kube-system"), AssetPathAPIServerSA} {
+			if _, err := as.Get(p); (err == nil) != enabled {
+				t.Errorf("pod security %t: rendered %s: %t", enabled, p, err == nil)
+			}
+		}
+		apiserver, err := as.Get(AssetPathAPIServer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(apiserver.Data), "PodSecurityPolicy") != enabled {
+			t.Errorf("pod security %t: unexpected admission plugins of %s", enabled, AssetPathAPIServer)
+		}
+		if strings.Contains(string(apiserver.Data), "serviceAccountName: kube-apiserver\n") != enabled {
+			t.Errorf("pod security %t: unexpected service account of %s", enabled, AssetPathAPIServer)
+		}
+		bootstrap, err := as.Get(AssetPathBootstrapAPIServer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(bootstrap.Data), "PodSecurityPolicy") {
+			t.Errorf("pod security %t: %s enables PodSecurityPolicy", enabled, AssetPathBootstrapAPIServer)
+		}
+		if !enabled {
+			continue
+		}
+
+		binding, err := as.Get(AssetPathPSPControlPlaneBinding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rb struct {
+			Subjects []struct {
+				Kind      string `json:"kind"`
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"subjects"`
+		}
+		if err := yaml.Unmarshal(binding.Data, &rb); err != nil {
+			t.Fatal(err)
+		}
+		subjects := map[string]bool{}
+		for _, s := range rb.Subjects {
+			if s.Kind != "ServiceAccount" || s.Namespace != "kube-system" {
+				t.Errorf("unexpected subject %+v", s)
+			}
+			subjects[s.Name] = true
+		}
+		for _, sa := range []string{"kube-apiserver", "kube-controller-manager", "pod-checkpointer", "kube-proxy", "calico-node"} {
+			if !subjects[sa] {
+				t.Errorf("%s is not exempt from the baseline policy", sa)
+			}
+		}
+		if subjects["kube-scheduler"] {
+			t.Error("kube-scheduler is exempt from the baseline policy")
+		}
+
+		for ns, enforce := range map[string]string{"kube-system": "privileged", "apps": "baseline"} {
+			a, err := as.Get(AssetPathPodSecurityNamespace(ns))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var namespace struct {
+				Metadata struct {
+					Name   string            `json:"name"`
+					Labels map[string]string `json:"labels"`
+				} `json:"metadata"`
+			}
+			if err := yaml.Unmarshal(a.Data, &namespace); err != nil {
+				t.Fatal(err)
+			}
+			if namespace.Metadata.Name != ns || namespace.Metadata.Labels["pod-security.kubernetes.io/enforce"] != enforce {
+				t.Errorf("namespace %s: got %+v, want enforce=%s", ns, namespace.Metadata, enforce)
+			}
+			if namespace.Metadata.Labels["pod-security.kubernetes.io/warn"] != "baseline" {
+				t.Errorf("namespace %s: got %+v, want warn=baseline", ns, namespace.Metadata)
+			}
+		}
+	}
+}
+
+func TestFeatureGates(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.FeatureGatesAPIServer = FeatureGates{"EphemeralContainers": true, "CSIMigration": false}
+	conf.FeatureGatesControllerManager = FeatureGates{"TTLAfterFinished": true}
+	conf.FeatureGatesScheduler = FeatureGates{"EvenPodsSpread": true}
+	conf.FeatureGatesKubelet = FeatureGates{"EphemeralContainers": true}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, flag := range map[string]string{
+		AssetPathAPIServer:                  "--feature-gates=CSIMigration=false,EphemeralContainers=true",
+		AssetPathBootstrapAPIServer:         "--feature-gates=CSIMigration=false,EphemeralContainers=true",
+		AssetPathControllerManager:          "--feature-gates=TTLAfterFinished=true",
+		AssetPathBootstrapControllerManager: "--feature-gates=TTLAfterFinished=true",
+		AssetPathScheduler:                  "--feature-gates=EvenPodsSpread=true",
+		AssetPathBootstrapScheduler:         "--feature-gates=EvenPodsSpread=true",
+		AssetPathProxy:                      "",
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(a.Data), "--feature-gates="); got != 0 && flag == "" || got != 1 && flag != "" {
+			t.Errorf("%s: got %d --feature-gates flags", name, got)
+		}
+		if flag != "" && !strings.Contains(string(a.Data), flag) {
+			t.Errorf("%s does not contain %s", name, flag)
+		}
+	}
+
+	a, err := as.Get(AssetPathKubeletConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		FeatureGates map[string]bool `json:"featureGates"`
+	}
+	if err := yaml.Unmarshal(a.Data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.FeatureGates) != 1 || !config.FeatureGates["EphemeralContainers"] {
+		t.Errorf("got kubelet feature gates %v, want: EphemeralContainers=true", config.FeatureGates)
+	}
+}
+
+func TestPriorityClasses(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		AssetPathAPIServer:                  "system-node-critical",
+		AssetPathBootstrapAPIServer:         "system-node-critical",
+		AssetPathControllerManager:          "system-cluster-critical",
+		AssetPathBootstrapControllerManager: "system-node-critical",
+		AssetPathScheduler:                  "system-cluster-critical",
+		AssetPathBootstrapScheduler:         "system-node-critical",
+		AssetPathCheckpointer:               "system-node-critical",
+		AssetPathProxy:                      "system-node-critical",
+		AssetPathFlannel:                    "system-node-critical",
+		AssetPathCoreDNSDeployment:          "system-cluster-critical",
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest struct {
+			Spec struct {
+				PriorityClassName string `json:"priorityClassName"`
+				Template          struct {
+					Spec struct {
+						PriorityClassName string `json:"priorityClassName"`
+					} `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		}
+		if err := yaml.Unmarshal(a.Data, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		got := manifest.Spec.PriorityClassName
+		if got == "" {
+			got = manifest.Spec.Template.Spec.PriorityClassName
+		}
+		if got != want {
+			t.Errorf("%s: got priority class %q, want: %q", name, got, want)
+		}
+	}
+}
+
+func TestControlPlanePlacement(t *testing.T) {
+	type placement struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					NodeSelector map[string]string   `json:"nodeSelector"`
+					Tolerations  []corev1.Toleration `json:"tolerations"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	selector := map[string]string{"pool": "control"}
+	tolerations := []corev1.Toleration{
+		{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "true", Effect: corev1.TaintEffectNoExecute},
+		{Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	}
+	for _, c := range []struct {
+		selector        map[string]string
+		tolerations     []corev1.Toleration
+		wantSelector    map[string]string
+		wantTolerations []corev1.Toleration
+	}{
+		{nil, nil, DefaultControlPlaneNodeSelector, DefaultControlPlaneTolerations},
+		{selector, tolerations, selector, tolerations},
+		{map[string]string{}, []corev1.Toleration{}, nil, nil},
+	} {
+		conf := testConfig(t, NetworkFlannel)
+		conf.AltNames = &tlsutil.AltNames{}
+		conf.ControlPlaneNodeSelector = c.selector
+		conf.ControlPlaneTolerations = c.tolerations
+		as, err := NewDefaultAssets(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{AssetPathAPIServer, AssetPathControllerManager, AssetPathScheduler, AssetPathCheckpointer} {
+			a, err := as.Get(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var p placement
+			if err := yaml.Unmarshal(a.Data, &p); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Spec.Template.Spec.NodeSelector; !reflect.DeepEqual(got, c.wantSelector) {
+				t.Errorf("%s: got node selector %v, want: %v", name, got, c.wantSelector)
+			}
+			if got := p.Spec.Template.Spec.Tolerations; !reflect.DeepEqual(got, c.wantTolerations) {
+				t.Errorf("%s: got tolerations %v, want: %v", name, got, c.wantTolerations)
+			}
+		}
+	}
+}
+
+func TestExtraFlags(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.APIServerExtraFlags = map[string]string{"default-watch-cache-size": "200"}
+	conf.ControllerManagerExtraFlags = map[string]string{"node-monitor-grace-period": "20s"}
+	conf.SchedulerExtraFlags = map[string]string{"v": "4"}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]struct {
+		container string
+		flag      string
+	}{
+		AssetPathAPIServer:                  {"kube-apiserver", "--default-watch-cache-size=200"},
+		AssetPathBootstrapAPIServer:         {"kube-apiserver", "--default-watch-cache-size=200"},
+		AssetPathControllerManager:          {"kube-controller-manager", "--node-monitor-grace-period=20s"},
+		AssetPathBootstrapControllerManager: {"kube-controller-manager", "--node-monitor-grace-period=20s"},
+		AssetPathScheduler:                  {"kube-scheduler", "--v=4"},
+		AssetPathBootstrapScheduler:         {"kube-scheduler", "--v=4"},
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		command, err := containerCommand(a.Data, c.container)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if command[len(command)-1] != c.flag {
+			t.Errorf("%s: got command %v, want it to end with %s", name, command, c.flag)
+		}
+	}
+
+	for _, extra := range []map[string]string{{"secure-port": "8443"}, {"enable-admission-plugins": "AlwaysPullImages"}} {
+		conf := testConfig(t, NetworkFlannel)
+		conf.AltNames = &tlsutil.AltNames{}
+		conf.APIServerExtraFlags = extra
+		if _, err := NewDefaultAssets(conf); err == nil || !strings.Contains(err.Error(), "set by bootkube") {
+			t.Errorf("extra flags %v: got error %v, want conflict", extra, err)
+		}
+	}
+	conf = testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.SchedulerExtraFlags = map[string]string{"leader-elect": "false"}
+	if _, err := NewDefaultAssets(conf); err == nil {
+		t.Error("overriding --leader-elect of the scheduler succeeded")
+	}
+}
+
+func TestOIDC(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.OIDCIssuerURL = "https://accounts.example.com"
+	conf.OIDCClientID = "kubernetes"
+	conf.OIDCGroupsClaim = "groups"
+	conf.OIDCCACert = []byte("oidc ca")
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{AssetPathAPIServer, AssetPathBootstrapAPIServer} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, flag := range []string{
+			"--oidc-issuer-url=https://accounts.example.com",
+			"--oidc-client-id=kubernetes",
+			"--oidc-groups-claim=groups",
+			"--oidc-ca-file=/etc/kubernetes/secrets/oidc-ca.crt",
+		} {
+			if !strings.Contains(string(a.Data), flag) {
+				t.Errorf("%s does not contain %s", name, flag)
+			}
+		}
+		if strings.Contains(string(a.Data), "--oidc-username-claim") {
+			t.Errorf("%s sets --oidc-username-claim", name)
+		}
+	}
+	if _, err := as.Get(AssetPathOIDCCACert); err != nil {
+		t.Error(err)
+	}
+	secret, err := as.Get(AssetPathAPIServerSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(secret.Data), "oidc-ca.crt: "+base64.StdEncoding.EncodeToString(conf.OIDCCACert)) {
+		t.Error("the apiserver secret does not contain the OIDC CA")
+	}
+}
+
+func TestCloudConfig(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.CloudProvider = CloudProviderOpenStack
+	conf.CloudConfig = []byte("[Global]\nauth-url=https://keystone.example.com\n")
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{AssetPathAPIServer, AssetPathBootstrapAPIServer, AssetPathControllerManager, AssetPathBootstrapControllerManager} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, flag := range []string{"--cloud-provider=openstack", "--cloud-config=/etc/kubernetes/secrets/cloud-config"} {
+			if !strings.Contains(string(a.Data), flag) {
+				t.Errorf("%s does not contain %s", name, flag)
+			}
+		}
+	}
+	for _, name := range []string{AssetPathAPIServerSecret, AssetPathControllerManagerSecret} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(a.Data), "cloud-config: "+base64.StdEncoding.EncodeToString(conf.CloudConfig)) {
+			t.Errorf("%s does not contain the cloud config", name)
+		}
+	}
+
+	conf.CloudConfig = nil
+	as, err = NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := as.Get(AssetPathAPIServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(a.Data), "--cloud-config") {
+		t.Error("--cloud-config set without a cloud config")
+	}
+}
+
+func TestArch(t *testing.T) {
+	images := SetArch(DefaultImages, ArchARM64)
+	for got, want := range map[string]string{
+		images.Flannel:       "quay.io/coreos/flannel:v0.11.0-arm64",
+		images.DNSAutoscaler: "k8s.gcr.io/cpa/cluster-proportional-autoscaler-arm64:1.8.1",
+		images.Etcd:          "quay.io/coreos/etcd:v3.3.12-arm64",
+		images.Hyperkube:     DefaultImages.Hyperkube,
+	} {
+		if got != want {
+			t.Errorf("got image %s, want: %s", got, want)
+		}
+	}
+	if SetArch(DefaultImages, ArchAMD64) != DefaultImages {
+		t.Error("amd64 images were changed")
+	}
+	if got := SetArch(ImageVersions{Flannel: "registry.example.com/flannel:v0.11.0-amd64"}, ArchARM64).Flannel; got != "registry.example.com/flannel:v0.11.0-amd64" {
+		t.Errorf("image that isn't a default was changed: %s", got)
+	}
+
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.Arch = ArchARM64
+	conf.Images = images
+	if _, err := NewDefaultAssets(conf); err == nil || !strings.Contains(err.Error(), "FlannelCNI") {
+		t.Errorf("NewDefaultAssets() = %v, want an error about the amd64 FlannelCNI image", err)
+	}
+
+	conf.Images.FlannelCNI = "registry.example.com/flannel-cni:v0.3.0-arm64"
+	conf.Images.PodCheckpointer = "registry.example.com/pod-checkpointer:arm64"
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{AssetPathAPIServer, AssetPathControllerManager, AssetPathScheduler, AssetPathCheckpointer} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var obj struct {
+			Spec struct {
+				Template struct {
+					Spec corev1.PodSpec
+				}
+			}
+		}
+		if err := yaml.Unmarshal(a.Data, &obj); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		affinity := obj.Spec.Template.Spec.Affinity
+		if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			t.Errorf("%s is not pinned to an architecture", name)
+			continue
+		}
+		want := []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{ArchARM64}}}}}
+		if got := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got node selector terms %+v, want: %+v", name, got, want)
+		}
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	images := SetImageRepository(DefaultImages, "registry.internal/k8s/")
+	for name, want := range map[string]string{
+		images.Hyperkube:     "registry.internal/k8s/hyperkube:v1.16.2",
+		images.Etcd:          "registry.internal/k8s/etcd:v3.3.12",
+		images.MetricsServer: "registry.internal/k8s/metrics-server:v0.3.7",
+	} {
+		if name != want {
+			t.Errorf("got image %s, want: %s", name, want)
+		}
+	}
+	if got := SetImageRepository(ImageVersions{CoreDNS: "k8s.gcr.io/coredns:1.6.5@sha256:abc"}, "mirror:5000").CoreDNS; got != "mirror:5000/coredns:1.6.5@sha256:abc" {
+		t.Errorf("got pinned image %s", got)
+	}
+
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.Images = images
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := as.Get(AssetPathImages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		images.CoreDNS,
+		images.FlannelCNI,
+		images.Flannel,
+		images.Hyperkube,
+		images.PodCheckpointer,
+	}, "\n") + "\n"
+	if string(a.Data) != want {
+		t.Errorf("got images.txt:\n%s\nwant:\n%s", a.Data, want)
+	}
+	for _, a := range as {
+		if strings.Contains(string(a.Data), "k8s.gcr.io") || strings.Contains(string(a.Data), "quay.io") {
+			t.Errorf("%s references an image outside of the repository", a.Name)
+		}
+	}
+}
+
+func TestBootstrapMasters(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.BootstrapMasters = []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := as.Get(AssetPathBootstrapMasters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	masters, err := ParseBootstrapMasters(a.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(masters, conf.BootstrapMasters) {
+		t.Errorf("got bootstrap masters %v, want: %v", masters, conf.BootstrapMasters)
+	}
+
+	a, err = as.Get(AssetPathAPIServerCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tlsutil.ParsePEMEncodedCACert(a.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, master := range conf.BootstrapMasters {
+		if err := cert.VerifyHostname(master.String()); err != nil {
+			t.Errorf("apiserver certificate is not valid for master %s: %v", master, err)
+		}
+	}
+
+	conf.BootstrapMasters = nil
+	if as, err = NewDefaultAssets(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.Get(AssetPathBootstrapMasters); err == nil {
+		t.Errorf("unexpected %s asset for a single master", AssetPathBootstrapMasters)
+	}
+}
+
+func TestKonnectivity(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.Konnectivity = true
+	if _, err := NewDefaultAssets(conf); err == nil {
+		t.Fatalf("expected an error for hyperkube image %s", conf.Images.Hyperkube)
+	}
+
+	var err error
+	if conf.Images, err = SetKubernetesVersion(conf.Images, "v1.18.8"); err != nil {
+		t.Fatal(err)
+	}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]string{
+		AssetPathAPIServer:              {"--egress-selector-config-file=/etc/kubernetes/secrets/egress-selector-config.yaml\n", "image: " + DefaultImages.KonnectivityServer},
+		AssetPathAPIServerSecret:        {"egress-selector-config.yaml:", "konnectivity-server.crt:", "konnectivity-server.key:"},
+		AssetPathKonnectivityAgent:      {"image: " + DefaultImages.KonnectivityAgent, "--proxy-server-host=127.0.0.1\n", "secretName: konnectivity-agent\n"},
+		AssetPathKonnectivityAgentTLS:   {"ca.crt:", "konnectivity-agent.crt:", "konnectivity-agent.key:"},
+		AssetPathEgressSelectorConfig:   {"udsName: /etc/kubernetes/konnectivity-server/konnectivity-server.socket\n"},
+		AssetPathKonnectivityAgentSA:    {"name: konnectivity-agent\n"},
+		AssetPathKonnectivityServerCert: {"BEGIN CERTIFICATE"},
+		AssetPathKonnectivityAgentCert:  {"BEGIN CERTIFICATE"},
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("expected %q in %s:\n%s", w, name, a.Data)
+			}
+		}
+	}
+	// The bootstrap apiserver doesn't outlive the pivot, it reaches the networks directly.
+	a, err := as.Get(AssetPathBootstrapAPIServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(a.Data), "konnectivity") {
+		t.Errorf("unexpected konnectivity-server in %s", AssetPathBootstrapAPIServer)
+	}
+
+	conf.StaticControlPlane = true
+	if as, err = NewDefaultAssets(conf); err != nil {
+		t.Fatal(err)
+	}
+	a, err = as.Get(AssetPathStaticAPIServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"--egress-selector-config-file=", "name: konnectivity-server\n"} {
+		if !strings.Contains(string(a.Data), w) {
+			t.Errorf("expected %q in %s:\n%s", w, AssetPathStaticAPIServer, a.Data)
+		}
+	}
+}
+
+func TestEtcdBackup(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.EtcdBackup = &EtcdBackupConfig{Schedule: "0 */6 * * *", Destination: EtcdBackupPVC, Retain: 3, StorageClass: "ssd"}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]string{
+		AssetPathEtcdBackup:            {"schedule: \"0 */6 * * *\"\n", "etcdctl --endpoints=" + conf.EtcdServers[0].String(), "tail -n +$((3 + 1))", "claimName: etcd-backup\n", "secretName: etcd-backup\n"},
+		AssetPathEtcdBackupVolumeClaim: {"storageClassName: ssd\n", "storage: 10Gi\n"},
+		AssetPathEtcdBackupSA:          {"name: etcd-backup\n"},
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("expected %q in %s:\n%s", w, name, a.Data)
+			}
+		}
+	}
+	a, err := as.Get(AssetPathEtcdBackup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cronJob batchv1beta1.CronJob
+	if err := yaml.Unmarshal(a.Data, &cronJob); err != nil {
+		t.Fatalf("%s: %v", AssetPathEtcdBackup, err)
+	}
+	if spec := cronJob.Spec.JobTemplate.Spec.Template.Spec; len(spec.Containers) != 1 || len(spec.InitContainers) != 0 || !spec.HostNetwork {
+		t.Errorf("expected a single snapshot container on the host network in %s:\n%s", AssetPathEtcdBackup, a.Data)
+	}
+
+	conf.EtcdBackup = &EtcdBackupConfig{Schedule: "@daily", Destination: EtcdBackupS3, URL: "s3://backups/etcd/", Region: "eu-west-1", Credentials: []byte("[default]\n")}
+	if as, err = NewDefaultAssets(conf); err != nil {
+		t.Fatal(err)
+	}
+	if a, err = as.Get(AssetPathEtcdBackup); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(a.Data, &cronJob); err != nil {
+		t.Fatalf("%s: %v", AssetPathEtcdBackup, err)
+	}
+	spec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	if len(spec.InitContainers) != 1 || len(spec.Containers) != 1 || spec.Containers[0].Image != DefaultImages.AWSCLI {
+		t.Fatalf("expected a snapshot init container and an upload container in %s:\n%s", AssetPathEtcdBackup, a.Data)
+	}
+	for _, w := range []string{`aws s3 cp "$f" "s3://backups/etcd/$(basename "$f")"`, "value: /etc/etcd-backup/etcd-backup-credentials\n", "value: \"eu-west-1\"\n", "emptyDir: {}\n"} {
+		if !strings.Contains(string(a.Data), w) {
+			t.Errorf("expected %q in %s:\n%s", w, AssetPathEtcdBackup, a.Data)
+		}
+	}
+	if a, err = as.Get(AssetPathEtcdBackupSecret); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(a.Data), "etcd-backup-credentials:") {
+		t.Errorf("expected the credentials in %s:\n%s", AssetPathEtcdBackupSecret, a.Data)
+	}
+	if _, err := as.Get(AssetPathEtcdBackupVolumeClaim); err == nil {
+		t.Errorf("unexpected %s for an S3 destination", AssetPathEtcdBackupVolumeClaim)
+	}
+
+	for _, c := range []EtcdBackupConfig{
+		{Destination: EtcdBackupPVC},
+		{Schedule: "daily", Destination: EtcdBackupPVC},
+		{Schedule: "@daily", Destination: "nfs"},
+		{Schedule: "@daily", Destination: EtcdBackupPVC, URL: "s3://backups"},
+		{Schedule: "@daily", Destination: EtcdBackupPVC, VolumeClaimSize: "ten"},
+		{Schedule: "@daily", Destination: EtcdBackupS3, URL: "gs://backups"},
+		{Schedule: "@daily", Destination: EtcdBackupGCS, URL: "gs://backups", Region: "europe-west1"},
+	} {
+		c := c
+		conf.EtcdBackup = &c
+		if _, err := NewDefaultAssets(conf); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func TestControlPlaneBackup(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.ControlPlaneBackupPath = "/var/lib/bootkube/control-plane-backup.json"
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := as.Get(AssetPathControlPlaneBackup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ds appsv1.DaemonSet
+	if err := yaml.Unmarshal(a.Data, &ds); err != nil {
+		t.Fatalf("%s: %v", AssetPathControlPlaneBackup, err)
+	}
+	spec := ds.Spec.Template.Spec
+	if want := []string{"/bootkube", "backup", "--output=/backup/control-plane-backup.json"}; !reflect.DeepEqual(spec.Containers[0].Command, want) {
+		t.Errorf("got command %v, want: %v", spec.Containers[0].Command, want)
+	}
+	if spec.Volumes[0].HostPath == nil || spec.Volumes[0].HostPath.Path != "/var/lib/bootkube" {
+		t.Errorf("expected the backup directory mounted from the host in %s:\n%s", AssetPathControlPlaneBackup, a.Data)
+	}
+	for _, name := range []string{AssetPathControlPlaneBackupSA, AssetPathControlPlaneBackupClusterRole, AssetPathControlPlaneBackupRoleBinding} {
+		if _, err := as.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := as.Get(AssetPathControlPlaneBackupNSRoleBinding); err == nil {
+		t.Errorf("unexpected %s for the control plane in kube-system", AssetPathControlPlaneBackupNSRoleBinding)
+	}
+
+	// A control plane namespace is backed up along with kube-system.
+	conf.ControlPlaneNamespace = "control-plane"
+	if as, err = NewDefaultAssets(conf); err != nil {
+		t.Fatal(err)
+	}
+	if a, err = as.Get(AssetPathControlPlaneBackup); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(a.Data), "- --namespaces=control-plane\n") {
+		t.Errorf("expected the control plane namespace backed up in %s:\n%s", AssetPathControlPlaneBackup, a.Data)
+	}
+	if a, err = as.Get(AssetPathControlPlaneBackupNSRoleBinding); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(a.Data), "  namespace: control-plane\n") {
+		t.Errorf("expected a role binding in the control plane namespace in %s:\n%s", AssetPathControlPlaneBackupNSRoleBinding, a.Data)
+	}
+
+	for _, p := range []string{"backup.json", "/backup.json", "/var/lib/../backup.json"} {
+		conf.ControlPlaneBackupPath = p
+		if _, err := NewDefaultAssets(conf); err == nil {
+			t.Errorf("expected an error for the backup path %s", p)
+		}
+	}
+}
+
+func TestCheckpointerIntervals(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := as.Get(AssetPathCheckpointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(a.Data), "interval=") || strings.Contains(string(a.Data), "backoff=") {
+		t.Errorf("unexpected intervals in %s by default:\n%s", AssetPathCheckpointer, a.Data)
+	}
+
+	conf.CheckpointInterval = 30 * time.Second
+	conf.CheckpointBackoff = time.Minute
+	conf.MaxCheckpointBackoff = 10 * time.Minute
+	conf.CheckpointAPIServerPollInterval = 2 * time.Minute
+	conf.CheckpointKubeletPollInterval = time.Minute
+	if as, err = NewDefaultAssets(conf); err != nil {
+		t.Fatal(err)
+	}
+	if a, err = as.Get(AssetPathCheckpointer); err != nil {
+		t.Fatal(err)
+	}
+	command, err := containerCommand(a.Data, "pod-checkpointer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := map[string]bool{}
+	for _, arg := range command {
+		args[arg] = true
+	}
+	for _, flag := range []string{"--checkpoint-interval=30s", "--checkpoint-backoff=1m0s", "--max-checkpoint-backoff=10m0s", "--apiserver-poll-interval=2m0s", "--kubelet-poll-interval=1m0s"} {
+		if !args[flag] {
+			t.Errorf("expected %s in the command %v", flag, command)
+		}
+	}
+}
+
+func TestDisruptionBudgets(t *testing.T) {
+	as := append(newStaticAssets(DefaultImages), newDynamicAssets(testConfig(t, NetworkFlannel))...)
+	for workload, pdb := range map[string]string{
+		AssetPathAPIServer:         AssetPathAPIServerDisruption,
+		AssetPathControllerManager: AssetPathControllerManagerDisruption,
+		AssetPathScheduler:         AssetPathSchedulerDisruption,
+		AssetPathCoreDNSDeployment: AssetPathCoreDNSDisruption,
+	} {
+		var w struct {
+			Spec struct {
+				Template struct {
+					Metadata struct {
+						Labels map[string]string `json:"labels"`
+					} `json:"metadata"`
+				} `json:"template"`
+			} `json:"spec"`
+		}
+		var p struct {
+			Spec struct {
+				MinAvailable int `json:"minAvailable"`
+				Selector     struct {
+					MatchLabels map[string]string `json:"matchLabels"`
+				} `json:"selector"`
+			} `json:"spec"`
+		}
+		for name, v := range map[string]interface{}{workload: &w, pdb: &p} {
+			a, err := as.Get(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal(a.Data, v); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if p.Spec.MinAvailable < 1 {
+			t.Errorf("%s: got minAvailable %d, want at least 1", pdb, p.Spec.MinAvailable)
+		}
+		for k, v := range p.Spec.Selector.MatchLabels {
+			if w.Spec.Template.Metadata.Labels[k] != v {
+				t.Errorf("%s does not select the pods of %s", pdb, workload)
+			}
+		}
+	}
+}
+
+func TestSchedulerConfig(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.SchedulerConfig = true
+	conf.SchedulerConfiguration = []byte(`apiVersion: kubescheduler.config.k8s.io/v1alpha2
+kind: KubeSchedulerConfiguration
+clientConnection:
+  kubeconfig: /etc/kubernetes/kubeconfig
+  qps: 100
+profiles:
+- schedulerName: default-scheduler
+`)
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]string{
+		AssetPathScheduler:          {"--config=/etc/kubernetes/scheduler/config.yaml\n", "name: kube-scheduler-config\n"},
+		AssetPathBootstrapScheduler: {"--config=/etc/kubernetes/secrets/kube-scheduler-config.yaml\n"},
+		AssetPathSchedulerConfig:    {"kubeconfig: /etc/kubernetes/secrets/kube-scheduler.kubeconfig\n", "qps: 100\n", "schedulerName: default-scheduler\n"},
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("expected %q in %s:\n%s", w, name, a.Data)
+			}
+		}
+		if strings.Contains(string(a.Data), "--leader-elect") {
+			t.Errorf("unexpected --leader-elect in %s", name)
+		}
+	}
+
+	// The self-hosted scheduler uses the in-cluster configuration.
+	a, err := as.Get(AssetPathSchedulerConfigMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cm struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := yaml.Unmarshal(a.Data, &cm); err != nil {
+		t.Fatal(err)
+	}
+	config := cm.Data["config.yaml"]
+	if !strings.Contains(config, "qps: 100\n") || strings.Contains(config, "kubeconfig:") {
+		t.Errorf("unexpected self-hosted scheduler configuration:\n%s", config)
+	}
+
+	conf.SchedulerConfiguration = []byte("kind: KubeletConfiguration\n")
+	if _, err := NewDefaultAssets(conf); err == nil {
+		t.Error("expected an error for a configuration of another kind")
+	}
+}
+
+func TestKubeletSystemdUnit(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.KubeletBundleDir = "/opt/kubelet"
+	conf.KubeletCgroupDriver = "systemd"
+	conf.KubeletSystemdUnit = true
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := as.Get(AssetPathKubeletConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Authentication struct {
+			X509 struct {
+				ClientCAFile string `json:"clientCAFile"`
+			} `json:"x509"`
+		} `json:"authentication"`
+		CgroupDriver string   `json:"cgroupDriver"`
+		ClusterDNS   []string `json:"clusterDNS"`
+	}
+	if err := yaml.Unmarshal(a.Data, &config); err != nil {
+		t.Fatalf("%s: %v", AssetPathKubeletConfig, err)
+	}
+	if config.Authentication.X509.ClientCAFile != "/opt/kubelet/ca.crt" {
+		t.Errorf("got client CA file %q, want: /opt/kubelet/ca.crt", config.Authentication.X509.ClientCAFile)
+	}
+	if config.CgroupDriver != "systemd" {
+		t.Errorf("got cgroup driver %q, want: systemd", config.CgroupDriver)
+	}
+	if !reflect.DeepEqual(config.ClusterDNS, []string{"10.3.0.10"}) {
+		t.Errorf("got cluster DNS %v, want: [10.3.0.10]", config.ClusterDNS)
+	}
+
+	a, err = as.Get(AssetPathKubeletSystemdUnit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"--bootstrap-kubeconfig=/opt/kubelet/kubeconfig \\\n", "--config=/opt/kubelet/config.yaml \\\n"} {
+		if !strings.Contains(string(a.Data), w) {
+			t.Errorf("expected %q in %s:\n%s", w, AssetPathKubeletSystemdUnit, a.Data)
+		}
+	}
+
+	conf.KubeletSystemdUnit = false
+	if as, err = NewDefaultAssets(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.Get(AssetPathKubeletSystemdUnit); err == nil {
+		t.Errorf("unexpected %s", AssetPathKubeletSystemdUnit)
+	}
+}
+
+func TestCSRAutoApproval(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	as := append(newStaticAssets(conf.Images), newDynamicAssets(conf)...)
+	for _, name := range []string{AssetPathCSRBootstrapRoleBinding, AssetPathCSRApproverRoleBinding, AssetPathCSRRenewalRoleBinding} {
+		if _, err := as.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+
+	conf.DisableCSRAutoApproval = true
+	as = append(newStaticAssets(conf.Images), newDynamicAssets(conf)...)
+	if _, err := as.Get(AssetPathCSRBootstrapRoleBinding); err != nil {
+		t.Errorf("kubelets can't request CSRs: %v", err)
+	}
+	for _, name := range []string{AssetPathCSRApproverRoleBinding, AssetPathCSRRenewalRoleBinding} {
+		if _, err := as.Get(name); err == nil {
+			t.Errorf("unexpected %s with auto-approval disabled", name)
+		}
+	}
+}
+
+func TestBootstrapToken(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.BootstrapTokenTTL = time.Hour
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := as.Get(AssetPathKubeletBootstrapToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret corev1.Secret
+	if err := yaml.Unmarshal(a.Data, &secret); err != nil {
+		t.Fatal(err)
+	}
+	expiration, err := time.Parse(time.RFC3339, secret.StringData["expiration"])
+	if err != nil {
+		t.Fatalf("invalid token expiration: %v", err)
+	}
+	if until := time.Until(expiration); until <= 0 || until > time.Hour {
+		t.Errorf("got token expiration %s, want: within an hour", expiration)
+	}
+	if secret.StringData["usage-bootstrap-signing"] != "true" {
+		t.Error("the token can't sign cluster-info")
+	}
+
+	a, err = as.Get(AssetPathClusterInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cm corev1.ConfigMap
+	if err := yaml.Unmarshal(a.Data, &cm); err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := as.Get(AssetPathCACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cm.Data["kubeconfig"], base64.StdEncoding.EncodeToString(caCert.Data)) {
+		t.Errorf("cluster-info kubeconfig doesn't contain the CA:\n%s", cm.Data["kubeconfig"])
+	}
+	ca, err := tlsutil.ParsePEMEncodedCACert(caCert.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := cm.Annotations[CACertHashAnnotation]; hash != CACertHash(ca) {
+		t.Errorf("got CA hash %q, want: %q", hash, CACertHash(ca))
+	}
+	for _, name := range []string{AssetPathClusterInfoRole, AssetPathClusterInfoRoleBinding} {
+		if _, err := as.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+
+	conf.BootstrapTokenTTL = 0
+	if as, err = NewDefaultAssets(conf); err != nil {
+		t.Fatal(err)
+	}
+	if a, err = as.Get(AssetPathKubeletBootstrapToken); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(a.Data), "expiration") {
+		t.Errorf("unexpected expiration of a token without TTL:\n%s", a.Data)
+	}
+}
+
+func TestNodeAuthorization(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	as := newDynamicAssets(conf)
+	for _, name := range []string{AssetPathAPIServer, AssetPathBootstrapAPIServer} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range []string{"--authorization-mode=Node,RBAC\n", ",NodeRestriction"} {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("%s doesn't contain %q", name, w)
+			}
+		}
+	}
+	if _, err := as.Get(AssetPathNodeRoleBinding); err == nil {
+		t.Error("unexpected system:node binding with the Node authorizer")
+	}
+
+	conf.DisableNodeAuthorization = true
+	as = newDynamicAssets(conf)
+	for _, name := range []string{AssetPathAPIServer, AssetPathBootstrapAPIServer} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(a.Data), "--authorization-mode=RBAC\n") {
+			t.Errorf("%s doesn't authorize with RBAC only", name)
+		}
+		if strings.Contains(string(a.Data), "NodeRestriction") {
+			t.Errorf("%s enables NodeRestriction", name)
+		}
+	}
+	if _, err := as.Get(AssetPathNodeRoleBinding); err != nil {
+		t.Errorf("kubelets aren't authorized: %v", err)
+	}
+}
+
+func TestContainerResources(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.Resources = map[string]ResourceRequirements{
+		ComponentAPIServer: {
+			Requests: map[string]string{"cpu": "250m", "memory": "512Mi"},
+			Limits:   map[string]string{"memory": "1Gi"},
+		},
+		ComponentCheckpointer: {Limits: map[string]string{"memory": "50Mi"}},
+	}
+	as := newDynamicAssets(conf)
+	for name, want := range map[string][]string{
+		AssetPathAPIServer:          {"resources:\n          requests:\n            cpu: \"250m\"\n            memory: \"512Mi\"\n          limits:\n            memory: \"1Gi\"\n"},
+		AssetPathBootstrapAPIServer: {"resources:\n      requests:\n        cpu: \"250m\"\n"},
+		AssetPathCheckpointer:       {"resources:\n          limits:\n            memory: \"50Mi\"\n"},
+	} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("%s doesn't contain %q:\n%s", name, w, a.Data)
+			}
+		}
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal(a.Data, &obj); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{AssetPathControllerManager, AssetPathScheduler, AssetPathBootstrapScheduler} {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(a.Data), "resources:\n") {
+			t.Errorf("%s has resources without a setting:\n%s", name, a.Data)
+		}
+	}
+}
+
+func TestSecurityProfile(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	components := []string{
+		AssetPathAPIServer,
+		AssetPathControllerManager,
+		AssetPathScheduler,
+		AssetPathBootstrapAPIServer,
+		AssetPathBootstrapControllerManager,
+		AssetPathBootstrapScheduler,
+	}
+	as := newDynamicAssets(conf)
+	for _, name := range components {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range []string{"seccomp.security.alpha.kubernetes.io/pod: runtime/default\n", "readOnlyRootFilesystem: true\n", "allowPrivilegeEscalation: false\n"} {
+			if !strings.Contains(string(a.Data), w) {
+				t.Errorf("%s doesn't contain %q", name, w)
+			}
+		}
+		// Only the self-hosted components run as non-root users, without capabilities.
+		if dropped := strings.Contains(string(a.Data), "drop: [\"ALL\"]\n"); dropped != !strings.HasPrefix(name, "bootstrap-manifests/") {
+			t.Errorf("%s: capabilities dropped: %t", name, dropped)
+		}
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal(a.Data, &obj); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	conf.SecurityProfile = SecurityProfileLegacy
+	as = newDynamicAssets(conf)
+	for _, name := range components {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(a.Data), "seccomp") || strings.Contains(string(a.Data), "readOnlyRootFilesystem") {
+			t.Errorf("%s is hardened with the legacy profile", name)
+		}
+	}
+}
+
+func TestPreservedTLS(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{IPs: []net.IP{net.ParseIP("10.0.0.1")}}
+	conf.EncryptionProvider = "aescbc"
+	first, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "bootkube-assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := first.WriteFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.AltNames = &tlsutil.AltNames{IPs: []net.IP{net.ParseIP("10.0.0.1")}}
+	conf.PreservedTLS, err = LoadPreservedTLS(dir)
+	if err != nil {
+		t.Fatalf("LoadPreservedTLS() = %v, want: nil", err)
+	}
+	second, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bootstrap credentials are always new.
+	regenerated := map[string]bool{
+		AssetPathKubeletBootstrapToken:       true,
+		AssetPathBootstrapKubeConfig:         true,
+		AssetPathKubeletKubeConfig:           true,
+		AssetPathKubeletBundleKubeConfig:     true,
+		AssetPathControllerManagerKubeConfig: true,
+		AssetPathSchedulerKubeConfig:         true,
+		AssetPathUninstall:                   true,
+	}
+	if len(first) != len(second) {
+		t.Fatalf("got %d assets, want: %d", len(second), len(first))
+	}
+	for i, a := range first {
+		if second[i].Name != a.Name {
+			t.Fatalf("got asset %s, want: %s", second[i].Name, a.Name)
+		}
+		if changed := string(second[i].Data) != string(a.Data); changed != regenerated[a.Name] {
+			t.Errorf("%s changed: %t", a.Name, changed)
+		}
+	}
+
+	conf.AltNames = &tlsutil.AltNames{IPs: []net.IP{net.ParseIP("10.0.0.2")}}
+	if _, err := NewDefaultAssets(conf); err == nil {
+		t.Error("NewDefaultAssets() = nil for an apiserver certificate that doesn't cover the new apiserver IP")
+	}
+}
+
+// regeneratedCredentials matches the values of the bootstrap credentials, which every render
+// generates anew.
+var regeneratedCredentials = regexp.MustCompile(`((client-certificate-data|client-key-data|token|token-id|token-secret): ).*|bootstrap-token-[a-z0-9]{6}`)
+
+func TestDeterministicRender(t *testing.T) {
+	conf := testConfig(t, NetworkCalico)
+	conf.AltNames = &tlsutil.AltNames{IPs: []net.IP{net.ParseIP("10.0.0.1")}}
+	// Maps are rendered in a stable order.
+	conf.ControlPlaneNodeSelector = map[string]string{"pool": "control", "node-role.kubernetes.io/master": "", "zone": "a"}
+	conf.APIServerExtraFlags = map[string]string{"v": "2", "audit-log-maxbackup": "3", "profiling": "false"}
+	conf.FeatureGatesAPIServer = FeatureGates{"TTLAfterFinished": true, "EphemeralContainers": true, "CSIMigration": false}
+	conf.KubeletEvictionHard = map[string]string{"memory.available": "100Mi", "nodefs.available": "10%", "imagefs.available": "15%"}
+	first, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "bootkube-assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := first.WriteFiles(filepath.Join(dir, "previous")); err != nil {
+		t.Fatal(err)
+	}
+	if conf.PreservedTLS, err = LoadPreservedTLS(filepath.Join(dir, "previous")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Render the same inputs twice into separate directories.
+	renders := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for _, d := range renders {
+		conf.AltNames = &tlsutil.AltNames{IPs: []net.IP{net.ParseIP("10.0.0.1")}}
+		as, err := NewDefaultAssets(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := as.WriteFiles(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := func(d string) map[string][]byte {
+		fs := map[string][]byte{}
+		if err := filepath.Walk(d, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(d, p)
+			fs[name] = b
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+	a, b := files(renders[0]), files(renders[1])
+	if len(a) != len(b) {
+		t.Errorf("got %d and %d assets", len(a), len(b))
+	}
+	for name, data := range a {
+		other, ok := b[name]
+		if !ok {
+			t.Errorf("%s was only rendered once", name)
+			continue
+		}
+		if bytes.Equal(data, other) {
+			continue
+		}
+		// The bootstrap credentials differ, but nothing else in their assets does.
+		masked := regeneratedCredentials.ReplaceAll(data, []byte("${1}<regenerated>"))
+		if bytes.Equal(masked, data) || !bytes.Equal(masked, regeneratedCredentials.ReplaceAll(other, []byte("${1}<regenerated>"))) {
+			t.Errorf("%s differs between renders:\n%s\n---\n%s", name, data, other)
+		}
+	}
+}
+
+func TestControlPlaneNamespace(t *testing.T) {
+	conf := testConfig(t, NetworkFlannel)
+	conf.AltNames = &tlsutil.AltNames{}
+	conf.ControlPlaneNamespace = "control-plane"
+	conf.PodSecurity = true
+	as, err := NewDefaultAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces := map[string]string{
+		AssetPathAPIServer:                   "control-plane",
+		AssetPathAPIServerSecret:             "control-plane",
+		AssetPathControllerManager:           "control-plane",
+		AssetPathControllerManagerSecret:     "control-plane",
+		AssetPathScheduler:                   "control-plane",
+		AssetPathSchedulerSA:                 "control-plane",
+		AssetPathCheckpointer:                "control-plane",
+		AssetPathCheckpointerRoleBinding:     "control-plane",
+		AssetPathBootstrapAPIServer:          "control-plane",
+		AssetPathKubeConfigInClusterCP:       "control-plane",
+		AssetPathPSPControlPlaneNSBinding:    "control-plane",
+		AssetPathKubeConfigInCluster:         "kube-system",
+		AssetPathAuthenticationReaderBinding: "kube-system",
+		AssetPathPSPControlPlaneBinding:      "kube-system",
+		AssetPathProxy:                       "kube-system",
+		AssetPathCoreDNSDeployment:           "kube-system",
+		AssetPathKubeletBootstrapToken:       "kube-system",
+	}
+	for name, want := range namespaces {
+		a, err := as.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var obj struct {
+			Metadata struct {
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal(a.Data, &obj); err != nil {
+			t.Fatal(err)
+		}
+		if obj.Metadata.Namespace != want {
+			t.Errorf("%s: got namespace %q, want: %q", name, obj.Metadata.Namespace, want)
+		}
+	}
+	a, err := as.Get(AssetPathAuthenticationReaderBinding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(a.Data), "namespace: control-plane") != 2 {
+		t.Errorf("the control plane service accounts aren't subjects of %s:\n%s", a.Name, a.Data)
+	}
+	if _, err := as.Get(AssetPathPodSecurityNamespace("control-plane")); err != nil {
+		t.Error(err)
+	}
+
+	uninstall, err := as.Get(AssetPathUninstall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []UninstallEntry
+	if err := json.Unmarshal(uninstall.Data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Kind == "Namespace" && e.Name == "control-plane" {
+			t.Error("the namespace of the apiserver is uninstalled")
+		}
+	}
+}
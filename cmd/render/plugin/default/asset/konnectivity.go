@@ -0,0 +1,88 @@
+package asset
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset/internal"
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+const (
+	AssetPathKonnectivityServerCert = "tls/konnectivity-server.crt"
+	AssetPathKonnectivityServerKey  = "tls/konnectivity-server.key"
+	AssetPathKonnectivityAgentCert  = "tls/konnectivity-agent.crt"
+	AssetPathKonnectivityAgentKey   = "tls/konnectivity-agent.key"
+	AssetPathEgressSelectorConfig   = "tls/egress-selector-config.yaml"
+	AssetPathKonnectivityAgent      = "manifests/konnectivity-agent.yaml"
+	AssetPathKonnectivityAgentSA    = "manifests/konnectivity-agent-sa.yaml"
+	AssetPathKonnectivityAgentTLS   = "manifests/konnectivity-agent-tls.yaml"
+
+	secretKonnectivityAgentName = "konnectivity-agent"
+)
+
+// newKonnectivityTLSAssets creates the serving certificate of the konnectivity-server for the
+// apiserver addresses and the client certificate the agents authenticate with.
+func newKonnectivityTLSAssets(caCert *x509.Certificate, caPrivKey *rsa.PrivateKey, altNames tlsutil.AltNames) ([]Asset, error) {
+	serverKey, serverCert, err := newAdminKeyAndCert(caCert, caPrivKey, tlsutil.CertConfig{
+		CommonName: "konnectivity-server",
+		AltNames:   altNames,
+	})
+	if err != nil {
+		return nil, err
+	}
+	agentKey, agentCert, err := newAdminKeyAndCert(caCert, caPrivKey, tlsutil.CertConfig{
+		CommonName: "konnectivity-agent",
+		ClientOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []Asset{
+		{Name: AssetPathKonnectivityServerKey, Data: tlsutil.EncodePrivateKeyPEM(serverKey)},
+		{Name: AssetPathKonnectivityServerCert, Data: tlsutil.EncodeCertificatePEM(serverCert)},
+		{Name: AssetPathKonnectivityAgentKey, Data: tlsutil.EncodePrivateKeyPEM(agentKey)},
+		{Name: AssetPathKonnectivityAgentCert, Data: tlsutil.EncodeCertificatePEM(agentCert)},
+	}, nil
+}
+
+// newKonnectivityAssets renders the egress selector configuration of the apiserver and the agent
+// DaemonSet with its client certificate Secret.
+func newKonnectivityAssets(as Assets, conf Config) ([]Asset, error) {
+	agentTLS, err := secretFromAssets(secretKonnectivityAgentName, secretNamespace, []string{
+		AssetPathCACert,
+		AssetPathKonnectivityAgentCert,
+		AssetPathKonnectivityAgentKey,
+	}, as)
+	if err != nil {
+		return nil, err
+	}
+	return []Asset{
+		MustCreateAssetFromTemplate(AssetPathEgressSelectorConfig, internal.EgressSelectorConfigTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathKonnectivityAgent, internal.KonnectivityAgentTemplate, conf),
+		MustCreateAssetFromTemplate(AssetPathKonnectivityAgentSA, internal.KonnectivityAgentServiceAccount, conf),
+		{Name: AssetPathKonnectivityAgentTLS, Data: agentTLS},
+	}, nil
+}
+
+// checkKonnectivityVersion returns an error if the hyperkube image is older than v1.18, the first
+// release with the egress selector. Images with other tags are not checked.
+func checkKonnectivityVersion(images ImageVersions) error {
+	tag := strings.SplitN(images.Hyperkube, "@", 2)[0]
+	i := strings.LastIndex(tag, ":")
+	if i <= strings.LastIndex(tag, "/") {
+		return nil
+	}
+	v, err := version.ParseGeneric(tag[i+1:])
+	if err != nil {
+		return nil
+	}
+	if v.LessThan(version.MustParseGeneric("v1.18.0")) {
+		return fmt.Errorf("konnectivity requires Kubernetes v1.18 or later, the hyperkube image is %s", images.Hyperkube)
+	}
+	return nil
+}
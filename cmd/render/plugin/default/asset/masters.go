@@ -0,0 +1,36 @@
+package asset
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AssetPathBootstrapMasters lists the addresses of the masters bootkube start runs on at once,
+// one per line, so they pivot to the self-hosted control plane one at a time.
+const AssetPathBootstrapMasters = "bootstrap-masters.txt"
+
+func newBootstrapMastersAsset(masters []net.IP) Asset {
+	var b bytes.Buffer
+	for _, ip := range masters {
+		fmt.Fprintln(&b, ip)
+	}
+	return Asset{Name: AssetPathBootstrapMasters, Data: b.Bytes()}
+}
+
+// ParseBootstrapMasters parses the addresses of an AssetPathBootstrapMasters asset.
+func ParseBootstrapMasters(data []byte) ([]net.IP, error) {
+	var masters []net.IP
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		ip := net.ParseIP(line)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid master address %q", line)
+		}
+		masters = append(masters, ip)
+	}
+	return masters, nil
+}
@@ -0,0 +1,136 @@
+package asset
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+// preservedTLSAssets are the generated keys and certificates a render can take over from a
+// previous one with Config.PreservedTLS. The short-lived bootstrap credentials and the
+// configuration files of the tls directory are always rendered anew.
+var preservedTLSAssets = []string{
+	AssetPathCAKey,
+	AssetPathCACert,
+	AssetPathAPIServerKey,
+	AssetPathAPIServerCert,
+	AssetPathAggregatorCA,
+	AssetPathFrontProxyClientCert,
+	AssetPathFrontProxyClientKey,
+	AssetPathServiceAccountPrivKey,
+	AssetPathServiceAccountPubKey,
+	AssetPathKubeletClientCert,
+	AssetPathKubeletClientKey,
+	AssetPathAdminKey,
+	AssetPathAdminCert,
+	AssetPathEtcdClientCA,
+	AssetPathEtcdClientCert,
+	AssetPathEtcdClientKey,
+	AssetPathEtcdServerCA,
+	AssetPathEtcdServerCert,
+	AssetPathEtcdServerKey,
+	AssetPathEtcdPeerCA,
+	AssetPathEtcdPeerCert,
+	AssetPathEtcdPeerKey,
+	AssetPathEncryptionConfig,
+	AssetPathKonnectivityServerCert,
+	AssetPathKonnectivityServerKey,
+	AssetPathKonnectivityAgentCert,
+	AssetPathKonnectivityAgentKey,
+}
+
+// LoadPreservedTLS reads the keys and certificates of the asset directory of a previous render.
+// Assets the previous render didn't have are left out, and generated by the next render.
+func LoadPreservedTLS(assetDir string) (Assets, error) {
+	var as Assets
+	for _, name := range preservedTLSAssets {
+		b, err := ioutil.ReadFile(filepath.Join(assetDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, Asset{Name: name, Data: b})
+	}
+	if _, err := as.Get(AssetPathCACert); err != nil {
+		return nil, fmt.Errorf("%s has no CA to preserve: %v", assetDir, err)
+	}
+	return as, nil
+}
+
+// preservedCA returns the CA of the preserved assets.
+func preservedCA(preserved Assets) (*rsa.PrivateKey, *x509.Certificate, error) {
+	keyAsset, err := preserved.Get(AssetPathCAKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the CA key can't be preserved: %v", err)
+	}
+	certAsset, err := preserved.Get(AssetPathCACert)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := tlsutil.ParsePEMEncodedPrivateKey(keyAsset.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid preserved CA key: %v", err)
+	}
+	cert, err := tlsutil.ParsePEMEncodedCACert(certAsset.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid preserved CA certificate: %v", err)
+	}
+	return key, cert, nil
+}
+
+// preservedEncryptionConfig returns the preserved encryption configuration if it encrypts with
+// provider, so changing the provider generates a new key.
+func preservedEncryptionConfig(preserved Assets, provider string) (Asset, bool) {
+	a, err := preserved.Get(AssetPathEncryptionConfig)
+	if err != nil || !bytes.Contains(a.Data, []byte("- "+provider+":")) {
+		return Asset{}, false
+	}
+	return a, true
+}
+
+// preserveTLS replaces the assets in as with the preserved ones of the same name.
+func preserveTLS(as []Asset, preserved Assets) []Asset {
+	for i, a := range as {
+		if p, err := preserved.Get(a.Name); err == nil {
+			as[i].Data = p.Data
+		}
+	}
+	return as
+}
+
+// checkPreservedAPIServerCert returns an error if the preserved apiserver certificate doesn't
+// cover altNames, e.g. because the apiservers moved since the previous render.
+func checkPreservedAPIServerCert(preserved Assets, altNames tlsutil.AltNames) error {
+	a, err := preserved.Get(AssetPathAPIServerCert)
+	if err != nil {
+		return nil
+	}
+	cert, err := tlsutil.ParsePEMEncodedCACert(a.Data)
+	if err != nil {
+		return fmt.Errorf("invalid preserved apiserver certificate: %v", err)
+	}
+	for _, name := range altNames.DNSNames {
+		if err := cert.VerifyHostname(name); err != nil {
+			return fmt.Errorf("the preserved apiserver certificate isn't valid for %s, render without preserving TLS assets to issue a new one", name)
+		}
+	}
+	for _, ip := range altNames.IPs {
+		var found bool
+		for _, certIP := range cert.IPAddresses {
+			found = found || certIP.Equal(ip)
+		}
+		if !found {
+			return fmt.Errorf("the preserved apiserver certificate isn't valid for %s, render without preserving TLS assets to issue a new one", net.IP(ip))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package asset
+
+// Components whose containers can be given resource requests and limits with Config.Resources.
+// They name the containers of both the bootstrap and the self-hosted control plane.
+const (
+	ComponentAPIServer         = "kube-apiserver"
+	ComponentControllerManager = "kube-controller-manager"
+	ComponentScheduler         = "kube-scheduler"
+	ComponentCheckpointer      = "pod-checkpointer"
+)
+
+// ResourceComponents are the components of Config.Resources.
+var ResourceComponents = []string{
+	ComponentAPIServer,
+	ComponentControllerManager,
+	ComponentScheduler,
+	ComponentCheckpointer,
+}
+
+// ResourceRequirements are the requests and limits of a container by resource name, e.g.
+// cpu: 250m or memory: 512Mi.
+type ResourceRequirements struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+// ContainerResources returns the resource requirements of the container of component, nil if it
+// has none.
+func (c Config) ContainerResources(component string) *ResourceRequirements {
+	r, ok := c.Resources[component]
+	if !ok || len(r.Requests)+len(r.Limits) == 0 {
+		return nil
+	}
+	return &r
+}
@@ -0,0 +1,95 @@
+package asset
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset/internal"
+)
+
+const (
+	// AssetPathSchedulerConfig is the KubeSchedulerConfiguration of the bootstrap and static
+	// scheduler, which read it from the secrets directory of the host.
+	AssetPathSchedulerConfig = "tls/kube-scheduler-config.yaml"
+	// AssetPathSchedulerConfigMap is the KubeSchedulerConfiguration of the self-hosted scheduler.
+	AssetPathSchedulerConfigMap = "manifests/kube-scheduler-config.yaml"
+
+	schedulerConfigMapName = "kube-scheduler-config"
+	schedulerConfigKey     = "config.yaml"
+)
+
+// newSchedulerConfigAssets renders the scheduler configuration for the bootstrap or static
+// scheduler and, with a self-hosted control plane, the ConfigMap of the self-hosted scheduler. The
+// kubeconfig of the client connection is set for each: the file of the secrets directory, or the
+// in-cluster configuration.
+func newSchedulerConfigAssets(conf Config) ([]Asset, error) {
+	config := conf.SchedulerConfiguration
+	if len(config) == 0 {
+		config = internal.DefaultSchedulerConfig
+	}
+	var c map[string]interface{}
+	if err := yaml.Unmarshal(config, &c); err != nil {
+		return nil, fmt.Errorf("invalid scheduler configuration: %v", err)
+	}
+	if c["kind"] != "KubeSchedulerConfiguration" {
+		return nil, fmt.Errorf("expected kind KubeSchedulerConfiguration, got %q", c["kind"])
+	}
+
+	kubeConfig := "kubeconfig"
+	if conf.StrictRBAC() {
+		kubeConfig = path.Base(AssetPathSchedulerKubeConfig)
+	}
+	static, err := schedulerConfigWithKubeConfig(c, path.Join("/etc/kubernetes/secrets", kubeConfig))
+	if err != nil {
+		return nil, err
+	}
+	as := []Asset{{Name: AssetPathSchedulerConfig, Data: static}}
+	if conf.StaticControlPlane {
+		return as, nil
+	}
+
+	selfHosted, err := schedulerConfigWithKubeConfig(c, "")
+	if err != nil {
+		return nil, err
+	}
+	cm, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]string{
+			"name":      schedulerConfigMapName,
+			"namespace": conf.ControlPlaneNamespace,
+		},
+		"data": map[string]string{schedulerConfigKey: string(selfHosted)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(as, Asset{Name: AssetPathSchedulerConfigMap, Data: cm}), nil
+}
+
+// schedulerConfigWithKubeConfig returns the configuration c connecting with kubeConfig, the
+// in-cluster configuration if empty.
+func schedulerConfigWithKubeConfig(c map[string]interface{}, kubeConfig string) ([]byte, error) {
+	connection := map[string]interface{}{}
+	if cc, ok := c["clientConnection"].(map[string]interface{}); ok {
+		for k, v := range cc {
+			connection[k] = v
+		}
+	}
+	delete(connection, "kubeconfig")
+	if kubeConfig != "" {
+		connection["kubeconfig"] = kubeConfig
+	}
+
+	out := map[string]interface{}{}
+	for k, v := range c {
+		out[k] = v
+	}
+	delete(out, "clientConnection")
+	if len(connection) > 0 {
+		out["clientConnection"] = connection
+	}
+	return yaml.Marshal(out)
+}
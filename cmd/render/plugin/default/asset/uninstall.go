@@ -0,0 +1,146 @@
+package asset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// AssetPathUninstall lists the objects of the rendered manifests in the order they must be
+// deleted in to remove the cluster, consumed by `bootkube teardown --cluster`.
+const AssetPathUninstall = "uninstall.json"
+
+// UninstallEntry identifies an object created from the rendered manifests.
+type UninstallEntry struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// File is the asset the object was rendered to.
+	File string `json:"file"`
+}
+
+func (e UninstallEntry) String() string {
+	if e.Namespace == "" {
+		return fmt.Sprintf("%s %s", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", e.Kind, e.Namespace, e.Name)
+}
+
+// Delete tiers, in order. Workloads go before the configuration and RBAC objects they use, custom
+// resources before their definitions and namespaces last. Unknown kinds are deleted with the
+// workloads.
+var uninstallTiers = map[string]int{
+	"ConfigMap":                1,
+	"Secret":                   1,
+	"Service":                  1,
+	"ServiceAccount":           2,
+	"Role":                     2,
+	"RoleBinding":              2,
+	"ClusterRole":              2,
+	"ClusterRoleBinding":       2,
+	"CustomResourceDefinition": 3,
+	"Namespace":                4,
+}
+
+// uninstallLast are deleted after everything else since the remaining deletes need the
+// apiserver. The pod checkpointer would otherwise restart the apiserver from its checkpoint.
+var uninstallLast = map[string]int{
+	"DaemonSet pod-checkpointer": 1,
+	"DaemonSet kube-apiserver":   2,
+}
+
+// newUninstallAsset lists the objects of the manifests in as in reverse dependency order: the
+// reverse of the order bootkube start creates them in.
+func newUninstallAsset(as Assets) (Asset, error) {
+	var entries []UninstallEntry
+	for _, a := range as {
+		if !strings.HasPrefix(a.Name, AssetPathManifests+"/") {
+			continue
+		}
+		var m struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal(a.Data, &m); err != nil {
+			return Asset{}, fmt.Errorf("failed to parse %s: %v", a.Name, err)
+		}
+		if m.Kind == "Namespace" && m.Metadata.Name == "kube-system" {
+			// Only labeled by bootkube start, deleting it is not possible.
+			continue
+		}
+		entries = append(entries, UninstallEntry{
+			APIVersion: m.APIVersion,
+			Kind:       m.Kind,
+			Namespace:  m.Metadata.Namespace,
+			Name:       m.Metadata.Name,
+			File:       a.Name,
+		})
+	}
+	// Deleting the namespace of the self-hosted apiserver would delete it before the remaining
+	// deletes, so that namespace is kept like kube-system.
+	for _, e := range entries {
+		if e.Kind == "DaemonSet" && e.Name == "kube-apiserver" {
+			for i, n := range entries {
+				if n.Kind == "Namespace" && n.Name == e.Namespace {
+					entries = append(entries[:i], entries[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		li, lj := uninstallLast[entries[i].Kind+" "+entries[i].Name], uninstallLast[entries[j].Kind+" "+entries[j].Name]
+		if li != lj {
+			return li < lj
+		}
+		if ti, tj := uninstallTiers[entries[i].Kind], uninstallTiers[entries[j].Kind]; ti != tj {
+			return ti < tj
+		}
+		// bootkube start creates manifests in file name order.
+		return entries[i].File > entries[j].File
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return Asset{}, err
+	}
+	return Asset{Name: AssetPathUninstall, Data: append(data, '\n')}, nil
+}
+
+// UpdateUninstallList rewrites the uninstall list of assetDir from the manifests currently in it,
+// after manifests were added or removed.
+func UpdateUninstallList(assetDir string) error {
+	files, err := ioutil.ReadDir(filepath.Join(assetDir, AssetPathManifests))
+	if err != nil {
+		return err
+	}
+	var as Assets
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := path.Join(AssetPathManifests, f.Name())
+		data, err := ioutil.ReadFile(filepath.Join(assetDir, name))
+		if err != nil {
+			return err
+		}
+		as = append(as, Asset{Name: name, Data: data})
+	}
+	uninstall, err := newUninstallAsset(as)
+	if err != nil {
+		return err
+	}
+	return uninstall.WriteFile(assetDir)
+}
@@ -0,0 +1,89 @@
+package asset
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUninstallOrder(t *testing.T) {
+	conf := testConfig(t, NetworkCalico)
+	as := append(newStaticAssets(conf.Images), newDynamicAssets(conf)...)
+	uninstall, err := newUninstallAsset(as)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []UninstallEntry
+	if err := json.Unmarshal(uninstall.Data, &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	index := map[string]int{}
+	for i, e := range entries {
+		index[e.Kind+" "+e.Namespace+"/"+e.Name] = i
+	}
+	before := func(first, second string) {
+		i, ok := index[first]
+		if !ok {
+			t.Fatalf("%s not listed", first)
+		}
+		j, ok := index[second]
+		if !ok {
+			t.Fatalf("%s not listed", second)
+		}
+		if i >= j {
+			t.Errorf("%s must be deleted before %s", first, second)
+		}
+	}
+	before("DaemonSet kube-system/calico-node", "ServiceAccount kube-system/calico-node")
+	before("Deployment kube-system/kube-scheduler", "ServiceAccount kube-system/kube-scheduler")
+	before("ConfigMap kube-system/calico-config", "CustomResourceDefinition /ippools.crd.projectcalico.org")
+	before("DaemonSet kube-system/pod-checkpointer", "DaemonSet kube-system/kube-apiserver")
+	if last := entries[len(entries)-1]; last.Kind != "DaemonSet" || last.Name != "kube-apiserver" {
+		t.Errorf("the apiserver must be deleted last, got %s", last)
+	}
+	if len(entries) != len(as)-countNonManifests(as) {
+		t.Errorf("listed %d objects for %d manifests", len(entries), len(as)-countNonManifests(as))
+	}
+}
+
+func countNonManifests(as Assets) int {
+	var n int
+	for _, a := range as {
+		if !strings.HasPrefix(a.Name, AssetPathManifests+"/") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestUpdateUninstallList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := testConfig(t, NetworkFlannel)
+	for _, a := range newNetworkAssets(conf) {
+		if err := a.WriteFile(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := UpdateUninstallList(dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, AssetPathUninstall))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []UninstallEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(newNetworkAssets(conf)) || entries[0].Kind != "DaemonSet" {
+		t.Errorf("got %v, want the flannel objects starting with its DaemonSet", entries)
+	}
+}
@@ -0,0 +1,59 @@
+package asset
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// kubernetesRelease are the images of the cluster add-ons tested with a minor release of
+// Kubernetes.
+type kubernetesRelease struct {
+	coreDNS string
+	etcd    string
+}
+
+// kubernetesReleases are the supported minor releases of Kubernetes. Hyperkube images are
+// published up to v1.18.
+var kubernetesReleases = map[uint]kubernetesRelease{
+	16: {coreDNS: "1.6.5", etcd: "v3.3.12"},
+	17: {coreDNS: "1.6.5", etcd: "v3.4.3"},
+	18: {coreDNS: "1.6.7", etcd: "v3.4.3"},
+}
+
+// SetKubernetesVersion returns a copy of images with the hyperkube image of the Kubernetes
+// version, e.g. "v1.17.4", and the CoreDNS and etcd images tested with its minor release. Images
+// that aren't DefaultImages are kept.
+func SetKubernetesVersion(images ImageVersions, kubernetesVersion string) (ImageVersions, error) {
+	v, err := version.ParseSemantic(kubernetesVersion)
+	if err != nil || !strings.HasPrefix(kubernetesVersion, "v") {
+		return images, fmt.Errorf("invalid Kubernetes version %q, want: v1.x.y", kubernetesVersion)
+	}
+	release, ok := kubernetesReleases[v.Minor()]
+	if v.Major() != 1 || !ok {
+		return images, fmt.Errorf("unsupported Kubernetes version %s, supported are v1.16 to v1.18", kubernetesVersion)
+	}
+	for _, i := range []struct {
+		image, defaultImage *string
+		tag                 string
+	}{
+		{&images.Hyperkube, &DefaultImages.Hyperkube, kubernetesVersion},
+		{&images.CoreDNS, &DefaultImages.CoreDNS, release.coreDNS},
+		{&images.Etcd, &DefaultImages.Etcd, release.etcd},
+	} {
+		if *i.image == *i.defaultImage {
+			*i.image = imageWithTag(*i.image, i.tag)
+		}
+	}
+	return images, nil
+}
+
+// imageWithTag replaces the tag of image, e.g. "k8s.gcr.io/hyperkube:v1.16.2", with tag.
+func imageWithTag(image, tag string) string {
+	name := image
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name + ":" + tag
+}
@@ -0,0 +1,43 @@
+package asset
+
+import "testing"
+
+func TestSetKubernetesVersion(t *testing.T) {
+	images, err := SetKubernetesVersion(DefaultImages, "v1.18.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for got, want := range map[string]string{
+		images.Hyperkube: "k8s.gcr.io/hyperkube:v1.18.3",
+		images.CoreDNS:   "k8s.gcr.io/coredns:1.6.7",
+		images.Etcd:      "quay.io/coreos/etcd:v3.4.3",
+		images.Flannel:   DefaultImages.Flannel,
+	} {
+		if got != want {
+			t.Errorf("got image %s, want: %s", got, want)
+		}
+	}
+
+	custom := DefaultImages
+	custom.Hyperkube = "registry.example.com/hyperkube:v1.17.0-custom"
+	custom.CoreDNS = "k8s.gcr.io/coredns:1.6.2@sha256:abc"
+	if images, err = SetKubernetesVersion(custom, "v1.17.4"); err != nil {
+		t.Fatal(err)
+	}
+	if images.Hyperkube != custom.Hyperkube || images.CoreDNS != custom.CoreDNS {
+		t.Errorf("images that aren't defaults were changed: %s, %s", images.Hyperkube, images.CoreDNS)
+	}
+
+	for _, v := range []string{"1.17.4", "v1.17", "v1.15.3", "v1.19.0", "v2.0.0", "latest"} {
+		if _, err := SetKubernetesVersion(DefaultImages, v); err == nil {
+			t.Errorf("SetKubernetesVersion(%q) = nil, want error", v)
+		}
+	}
+
+	if got := imageWithTag("registry.internal:5000/hyperkube:v1.16.2", "v1.17.0"); got != "registry.internal:5000/hyperkube:v1.17.0" {
+		t.Errorf("got %s", got)
+	}
+	if got := imageWithTag("registry.internal:5000/hyperkube", "v1.17.0"); got != "registry.internal:5000/hyperkube:v1.17.0" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	// The default --node-cidr-mask-size used by the controller-manager for each address family.
+	nodeCIDRMaskSizeIPv4 = 24
+	nodeCIDRMaskSizeIPv6 = 64
+
+	// The apiserver refuses IPv6 service CIDRs with more than 20 host bits.
+	maxServiceCIDRBitsIPv6 = 20
+)
+
+// validateCIDRs checks that the pod and service CIDRs are usable together: they are of matching
+// and distinct address families, they do not overlap each other or the node addresses, the pod
+// CIDRs can be split into per-node ranges, and the service CIDRs can hold the well-known service
+// IPs that are derived from them.
+func validateCIDRs(podNets, serviceNets []*net.IPNet, nodeIPs []net.IP) error {
+	for i, nets := range [][]*net.IPNet{podNets, serviceNets} {
+		kind := "pod"
+		if i == 1 {
+			kind = "service"
+		}
+		if len(nets) == 2 && isIPv4(nets[0].IP) == isIPv4(nets[1].IP) {
+			return fmt.Errorf("dual-stack %s CIDRs %s and %s must be of different address families", kind, nets[0], nets[1])
+		}
+		if len(nets) == 2 && !isIPv4(nets[0].IP) {
+			return fmt.Errorf("dual-stack %s CIDRs must list the IPv4 CIDR first, got %s,%s", kind, nets[0], nets[1])
+		}
+	}
+
+	for _, podNet := range podNets {
+		ones, _ := podNet.Mask.Size()
+		maskSize := nodeCIDRMaskSizeIPv4
+		if !isIPv4(podNet.IP) {
+			maskSize = nodeCIDRMaskSizeIPv6
+		}
+		if ones > maskSize {
+			return fmt.Errorf("pod CIDR %s is too small: it must be at least a /%d so that each node can be allocated a /%d", podNet, maskSize, maskSize)
+		}
+	}
+
+	for _, svcNet := range serviceNets {
+		ones, bits := svcNet.Mask.Size()
+		if !isIPv4(svcNet.IP) && bits-ones > maxServiceCIDRBitsIPv6 {
+			return fmt.Errorf("service CIDR %s is too large: IPv6 service CIDRs must be at least a /%d", svcNet, bits-maxServiceCIDRBitsIPv6)
+		}
+		// The DNS service IP is the largest offset, make sure it is not the broadcast address.
+		if bits-ones < 64 && uint64(1)<<uint(bits-ones) <= dnsOffset+1 {
+			return fmt.Errorf("service CIDR %s is too small: it must contain the kubernetes service IP (offset %d) and the DNS service IP (offset %d)", svcNet, apiOffset, dnsOffset)
+		}
+	}
+
+	for _, podNet := range podNets {
+		for _, svcNet := range serviceNets {
+			if podNet.Contains(svcNet.IP) || svcNet.Contains(podNet.IP) {
+				return fmt.Errorf("Pod CIDR %s and service CIDR %s must not overlap", podNet.String(), svcNet.String())
+			}
+		}
+	}
+
+	for _, ip := range nodeIPs {
+		for _, podNet := range podNets {
+			if podNet.Contains(ip) {
+				return fmt.Errorf("node address %s (from --api-servers or --etcd-servers) must not be inside pod CIDR %s", ip, podNet)
+			}
+		}
+		for _, svcNet := range serviceNets {
+			if svcNet.Contains(ip) {
+				return fmt.Errorf("node address %s (from --api-servers or --etcd-servers) must not be inside service CIDR %s", ip, svcNet)
+			}
+		}
+	}
+	return nil
+}
+
+// parseDNSServiceIPs parses the comma separated DNS service IPs given with --dns-service-ip, one
+// per service CIDR and in the same order. Each must be an assignable address of its service CIDR
+// other than the kubernetes service IP.
+func parseDNSServiceIPs(s string, serviceNets []*net.IPNet, apiServiceIPs []net.IP) ([]net.IP, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != len(serviceNets) {
+		return nil, fmt.Errorf("--dns-service-ip must list one IP per service CIDR, got %d for %d", len(parts), len(serviceNets))
+	}
+	var ips []net.IP
+	for i, part := range parts {
+		ip := net.ParseIP(strings.TrimSpace(part))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid DNS service IP %q", part)
+		}
+		svcNet := serviceNets[i]
+		if !svcNet.Contains(ip) {
+			return nil, fmt.Errorf("DNS service IP %s must be inside service CIDR %s", ip, svcNet)
+		}
+		if ip.Equal(svcNet.IP) || isIPv4(ip) && ip.Equal(broadcastIP(svcNet)) {
+			return nil, fmt.Errorf("DNS service IP %s is not assignable in service CIDR %s", ip, svcNet)
+		}
+		if ip.Equal(apiServiceIPs[i]) {
+			return nil, fmt.Errorf("DNS service IP %s collides with the kubernetes service IP", ip)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// broadcastIP returns the last address of ipNet.
+func broadcastIP(ipNet *net.IPNet) net.IP {
+	ip := make(net.IP, len(ipNet.IP))
+	for i := range ip {
+		ip[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+	}
+	return ip
+}
+
+// nodeIPsFromURLs returns the non-loopback IP addresses found in the hosts of the given URLs.
+// Hostnames are ignored since they can't be resolved reliably at render time.
+func nodeIPsFromURLs(urlLists ...[]*url.URL) []net.IP {
+	var ips []net.IP
+	for _, urls := range urlLists {
+		for _, u := range urls {
+			ip := net.ParseIP(u.Hostname())
+			if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+				continue
+			}
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
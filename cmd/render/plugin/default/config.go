@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// renderConfig is the render config file passed with --config. Flags are keyed by flag name,
+// images by ImageVersions field name and container resources by component. Overlays patch the
+// base settings per environment:
+//
+//	flags:
+//	  network-provider: calico
+//	images:
+//	  Hyperkube: k8s.gcr.io/hyperkube:v1.16.2
+//	resources:
+//	  kube-apiserver:
+//	    requests: {cpu: 250m, memory: 512Mi}
+//	overlays:
+//	  prod:
+//	    flags:
+//	      pod-cidr: 10.10.0.0/16
+type renderConfig struct {
+	renderSettings
+	Overlays map[string]renderSettings `json:"overlays,omitempty"`
+}
+
+type renderSettings struct {
+	Flags  map[string]interface{} `json:"flags,omitempty"`
+	Images map[string]string      `json:"images,omitempty"`
+	// Resources replace the resources of the same components of the base settings in overlays.
+	Resources map[string]asset.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// applyRenderConfig applies the base settings of the config file at path, then the overlay of
+// environment if set, to the flags of fs, to images and to resources. Flags set on the command
+// line take precedence over the config file.
+func applyRenderConfig(fs *flag.FlagSet, images *asset.ImageVersions, resources map[string]asset.ResourceRequirements, path, environment string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file %s: %v", path, err)
+	}
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+	var config renderConfig
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.DisallowUnknownFields()
+	d.UseNumber()
+	if err := d.Decode(&config); err != nil {
+		return fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+
+	settings := []renderSettings{config.renderSettings}
+	if environment != "" {
+		overlay, ok := config.Overlays[environment]
+		if !ok {
+			var envs []string
+			for env := range config.Overlays {
+				envs = append(envs, env)
+			}
+			sort.Strings(envs)
+			return fmt.Errorf("config file %s has no overlay for environment %q, available: %s", path, environment, strings.Join(envs, ", "))
+		}
+		settings = append(settings, overlay)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, s := range settings {
+		if err := s.apply(fs, images, resources, explicit); err != nil {
+			return fmt.Errorf("config file %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func (s renderSettings) apply(fs *flag.FlagSet, images *asset.ImageVersions, resources map[string]asset.ResourceRequirements, explicit map[string]bool) error {
+	// Sort for deterministic error messages.
+	var names []string
+	for name := range s.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "config" || name == "environment" || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if explicit[name] {
+			continue
+		}
+		// Repeatable flags are set once per list element.
+		if l, ok := s.Flags[name].([]interface{}); ok {
+			if _, ok := fs.Lookup(name).Value.(*extraFlags); ok {
+				for _, v := range l {
+					if err := fs.Set(name, fmt.Sprint(v)); err != nil {
+						return fmt.Errorf("invalid value for flag %q: %v", name, err)
+					}
+				}
+				continue
+			}
+		}
+		if err := fs.Set(name, flagValue(s.Flags[name])); err != nil {
+			return fmt.Errorf("invalid value for flag %q: %v", name, err)
+		}
+	}
+
+	v := reflect.ValueOf(images).Elem()
+	for name, image := range s.Images {
+		f := v.FieldByName(name)
+		if !f.IsValid() || f.Kind() != reflect.String {
+			return fmt.Errorf("unknown image %q", name)
+		}
+		f.SetString(image)
+	}
+
+	for component, r := range s.Resources {
+		if err := validateResources(component, r); err != nil {
+			return err
+		}
+		resources[component] = r
+	}
+	return nil
+}
+
+// validateResources checks that component is one of asset.ResourceComponents and that the
+// quantities of r are valid, with requests not exceeding limits.
+func validateResources(component string, r asset.ResourceRequirements) error {
+	var known bool
+	for _, c := range asset.ResourceComponents {
+		known = known || c == component
+	}
+	if !known {
+		return fmt.Errorf("unknown resources component %q, must be one of %s", component, strings.Join(asset.ResourceComponents, ", "))
+	}
+	limits := map[string]resource.Quantity{}
+	for name, value := range r.Limits {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s limit of %s: %v", name, component, err)
+		}
+		limits[name] = q
+	}
+	for name, value := range r.Requests {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s request of %s: %v", name, component, err)
+		}
+		if limit, ok := limits[name]; ok && q.Cmp(limit) > 0 {
+			return fmt.Errorf("%s request of %s exceeds its limit %s", name, component, r.Limits[name])
+		}
+	}
+	return nil
+}
+
+// flagValue formats a config file value as a flag value. Lists are comma separated.
+func flagValue(v interface{}) string {
+	if l, ok := v.([]interface{}); ok {
+		var s []string
+		for _, e := range l {
+			s = append(s, fmt.Sprint(e))
+		}
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// extraFlags is a repeatable flag of key=value pairs, e.g.
+// --apiserver-extra-flags=default-watch-cache-size=200 --apiserver-extra-flags=profiling=false.
+// Keys may have the leading dashes of the component flag.
+type extraFlags map[string]string
+
+func (f *extraFlags) String() string {
+	var kvs []string
+	for k, v := range *f {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+func (f *extraFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	key := strings.TrimLeft(parts[0], "-")
+	if len(parts) != 2 || key == "" {
+		return fmt.Errorf("invalid value %q, want: flag=value", s)
+	}
+	if *f == nil {
+		*f = extraFlags{}
+	}
+	if _, ok := (*f)[key]; ok {
+		return fmt.Errorf("--%s is set more than once", key)
+	}
+	(*f)[key] = parts[1]
+	return nil
+}
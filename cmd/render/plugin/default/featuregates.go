@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// parseFeatureGates parses a comma separated list of feature gates, e.g.
+// 'EphemeralContainers=true,CSIMigration=false'. It returns nil for an empty list.
+func parseFeatureGates(s string) (asset.FeatureGates, error) {
+	kvs, err := parseKeyValues(s, "=")
+	if err != nil || kvs == nil {
+		return nil, err
+	}
+	gates := asset.FeatureGates{}
+	for gate, v := range kvs {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for feature gate %s, want: true or false", v, gate)
+		}
+		gates[gate] = enabled
+	}
+	return gates, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// kubeletEvictionSignals are the eviction signals of the kubelet.
+var kubeletEvictionSignals = map[string]bool{
+	"memory.available":   true,
+	"nodefs.available":   true,
+	"nodefs.inodesFree":  true,
+	"imagefs.available":  true,
+	"imagefs.inodesFree": true,
+	"pid.available":      true,
+}
+
+// kubeletReservedResources are the resources the kubelet can reserve for system daemons and
+// Kubernetes components.
+var kubeletReservedResources = map[string]bool{
+	"cpu":               true,
+	"memory":            true,
+	"ephemeral-storage": true,
+	"pid":               true,
+}
+
+// parseEvictionThresholds parses comma separated eviction thresholds such as
+// "memory.available<100Mi,nodefs.available<10%".
+func parseEvictionThresholds(s string) (map[string]string, error) {
+	thresholds, err := parseKeyValues(s, "<")
+	if err != nil {
+		return nil, err
+	}
+	for signal, threshold := range thresholds {
+		if !kubeletEvictionSignals[signal] {
+			return nil, fmt.Errorf("unknown eviction signal %q", signal)
+		}
+		if p := strings.TrimSuffix(threshold, "%"); p != threshold {
+			if percent, err := strconv.ParseFloat(p, 64); err != nil || percent <= 0 || percent > 100 {
+				return nil, fmt.Errorf("invalid percentage %q for %s", threshold, signal)
+			}
+			continue
+		}
+		if _, err := resource.ParseQuantity(threshold); err != nil {
+			return nil, fmt.Errorf("invalid quantity %q for %s: %v", threshold, signal, err)
+		}
+	}
+	return thresholds, nil
+}
+
+// parseEvictionGracePeriods parses comma separated grace periods of soft eviction thresholds such
+// as "memory.available=1m30s".
+func parseEvictionGracePeriods(s string) (map[string]string, error) {
+	periods, err := parseKeyValues(s, "=")
+	if err != nil {
+		return nil, err
+	}
+	for signal, period := range periods {
+		if !kubeletEvictionSignals[signal] {
+			return nil, fmt.Errorf("unknown eviction signal %q", signal)
+		}
+		if d, err := time.ParseDuration(period); err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid grace period %q for %s", period, signal)
+		}
+	}
+	return periods, nil
+}
+
+// parseReservedResources parses comma separated resource reservations such as
+// "cpu=100m,memory=256Mi".
+func parseReservedResources(s string) (map[string]string, error) {
+	reserved, err := parseKeyValues(s, "=")
+	if err != nil {
+		return nil, err
+	}
+	for name, quantity := range reserved {
+		if !kubeletReservedResources[name] {
+			return nil, fmt.Errorf("unknown resource %q", name)
+		}
+		if _, err := resource.ParseQuantity(quantity); err != nil {
+			return nil, fmt.Errorf("invalid quantity %q for %s: %v", quantity, name, err)
+		}
+	}
+	return reserved, nil
+}
+
+// validateSoftEviction checks that every soft eviction threshold has a grace period and the other
+// way around, as required by the kubelet.
+func validateSoftEviction(soft, gracePeriods map[string]string) error {
+	var missing []string
+	for signal := range soft {
+		if _, ok := gracePeriods[signal]; !ok {
+			missing = append(missing, signal)
+		}
+	}
+	for signal := range gracePeriods {
+		if _, ok := soft[signal]; !ok {
+			missing = append(missing, signal)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("--kubelet-eviction-soft and --kubelet-eviction-soft-grace-period must set the same signals, mismatched: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// parseKeyValues parses a comma separated list of key and value pairs split by sep. It returns nil
+// for an empty list.
+func parseKeyValues(s, sep string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	m := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(kv), sep, 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid value %q, want: key%svalue", kv, sep)
+		}
+		if _, ok := m[parts[0]]; ok {
+			return nil, fmt.Errorf("%s is set more than once", parts[0])
+		}
+		m[parts[0]] = parts[1]
+	}
+	return m, nil
+}
@@ -8,12 +8,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/ghodss/yaml"
 	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
 	"github.com/kubernetes-sigs/bootkube/pkg/plugin"
 	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -27,6 +33,7 @@ var (
 	renderOpts struct {
 		caCertificatePath   string
 		caPrivateKeyPath    string
+		preserveTLS         string
 		etcdCAPath          string
 		etcdCertificatePath string
 		etcdPrivateKeyPath  string
@@ -35,12 +42,124 @@ var (
 		altNames            string
 		podCIDR             string
 		serviceCIDR         string
+		dnsServiceIP        string
 		cloudProvider       string
+		cloudConfig         string
 		networkProvider     string
+		ciliumProxyMode     string
+		weaveEncryption     bool
+		kubeRouterProxy     bool
+		bootstrapTTL        time.Duration
+		bootstrapTokenTTL   time.Duration
 		clusterName         string
+
+		requestHeaderAllowedNames       string
+		requestHeaderUsernameHeaders    string
+		requestHeaderGroupHeaders       string
+		requestHeaderExtraHeadersPrefix string
+		apiServerLBAnnotations          bool
+		pinDigests                      bool
+		imageRepository                 string
+		kubernetesVersion               string
+
+		externalDNSProvider string
+		externalDNSZone     string
+		externalDNSTarget   string
+
+		dnsAutoscaler                bool
+		dnsAutoscalerCoresPerReplica int
+		dnsAutoscalerNodesPerReplica int
+
+		renderMetricsServer bool
+
+		audit                  bool
+		auditPolicyFile        string
+		auditLogPath           string
+		auditLogMaxAge         int
+		auditWebhookConfigFile string
+
+		config      string
+		environment string
+
+		encryptionProvider string
+
+		rbacProfile           string
+		securityProfile       string
+		controlPlaneNamespace string
+
+		podSecurity           bool
+		podSecurityNamespaces string
+
+		featureGatesAPIServer         string
+		featureGatesControllerManager string
+		featureGatesScheduler         string
+		featureGatesKubelet           string
+
+		apiServerExtraFlags         extraFlags
+		controllerManagerExtraFlags extraFlags
+		schedulerExtraFlags         extraFlags
+
+		admissionControlConfigFile string
+
+		oidcIssuerURL     string
+		oidcClientID      string
+		oidcUsernameClaim string
+		oidcGroupsClaim   string
+		oidcCAFile        string
+
+		kubeletEvictionHard            string
+		kubeletEvictionSoft            string
+		kubeletEvictionSoftGracePeriod string
+		kubeletSystemReserved          string
+		kubeletKubeReserved            string
+		kubeletBundleDir               string
+		kubeletCgroupDriver            string
+		kubeletSystemdUnit             bool
+
+		controlPlaneNodeSelector string
+		controlPlaneTolerations  string
+
+		selfHosted bool
+
+		arch string
+
+		bootstrapMasters string
+
+		bootstrapAPIServerPort    int
+		bootstrapAdvertiseAddress string
+
+		anonymousAuth       bool
+		disableInsecurePort bool
+
+		konnectivity bool
+
+		etcdBackupSchedule     string
+		etcdBackupDestination  string
+		etcdBackupRetain       int
+		etcdBackupVolumeSize   string
+		etcdBackupStorageClass string
+		etcdBackupURL          string
+		etcdBackupRegion       string
+		etcdBackupCredentials  string
+
+		controlPlaneBackupPath string
+
+		checkpointInterval              time.Duration
+		checkpointBackoff               time.Duration
+		maxCheckpointBackoff            time.Duration
+		checkpointAPIServerPollInterval time.Duration
+		checkpointKubeletPollInterval   time.Duration
+
+		schedulerConfig     bool
+		schedulerConfigFile string
+
+		csrAutoApproval bool
+
+		nodeAuthorization bool
 	}
 
 	imageVersions = asset.DefaultImages
+	resources     = map[string]asset.ResourceRequirements{}
 )
 
 type render struct{}
@@ -52,6 +171,7 @@ func (*render) Render(opts *plugin.Options, args []string) error {
 
 	CommandLine.StringVar(&renderOpts.caCertificatePath, "ca-certificate-path", "", "Path to an existing PEM encoded CA. If provided, TLS assets will be generated using this certificate authority.")
 	CommandLine.StringVar(&renderOpts.caPrivateKeyPath, "ca-private-key-path", "", "Path to an existing Certificate Authority RSA private key. Required if --ca-certificate is set.")
+	CommandLine.StringVar(&renderOpts.preserveTLS, "preserve-tls", "", "Path to the asset directory of a previous render. Its keys and certificates, including the CA, are rendered again instead of new ones.")
 	CommandLine.StringVar(&renderOpts.etcdCAPath, "etcd-ca-path", "", "Path to an existing PEM encoded CA that will be used for TLS-enabled communication between the apiserver and etcd. Must be used in conjunction with --etcd-certificate-path and --etcd-private-key-path, and must have etcd configured to use TLS with matching secrets.")
 	CommandLine.StringVar(&renderOpts.etcdCertificatePath, "etcd-certificate-path", "", "Path to an existing certificate that will be used for TLS-enabled communication between the apiserver and etcd. Must be used in conjunction with --etcd-ca-path and --etcd-private-key-path, and must have etcd configured to use TLS with matching secrets.")
 	CommandLine.StringVar(&renderOpts.etcdPrivateKeyPath, "etcd-private-key-path", "", "Path to an existing private key that will be used for TLS-enabled communication between the apiserver and etcd. Must be used in conjunction with --etcd-ca-path and --etcd-certificate-path, and must have etcd configured to use TLS with matching secrets.")
@@ -60,12 +180,105 @@ func (*render) Render(opts *plugin.Options, args []string) error {
 	CommandLine.StringVar(&renderOpts.altNames, "api-server-alt-names", "", "List of SANs to use in api-server certificate. Example: 'IP=127.0.0.1,IP=127.0.0.2,DNS=localhost'. If empty, SANs will be extracted from the --api-servers flag.")
 	CommandLine.StringVar(&renderOpts.podCIDR, "pod-cidr", "10.2.0.0/16", "The CIDR range(s) of cluster pods.  If dual-stack, IPv4 must come first, separated by a comma.")
 	CommandLine.StringVar(&renderOpts.serviceCIDR, "service-cidr", "10.3.0.0/24", "The CIDR range(s) of cluster services.  If dual-stack, IPv4 must come first, seprated by a comma.")
-	CommandLine.StringVar(&renderOpts.cloudProvider, "cloud-provider", "", "The provider for cloud services.  Empty string for no provider")
-	CommandLine.StringVar(&renderOpts.networkProvider, "network-provider", "flannel", "CNI network provider (flannel, experimental-canal or experimental-calico).")
+	CommandLine.StringVar(&renderOpts.dnsServiceIP, "dns-service-ip", "", "The cluster DNS service IP(s), one per service CIDR. Defaults to the 10th IP of each service CIDR.")
+	CommandLine.StringVar(&renderOpts.cloudProvider, "cloud-provider", "", "The provider for cloud services (aws, gce, azure or openstack).  Empty string for no provider")
+	CommandLine.StringVar(&renderOpts.cloudConfig, "cloud-config", "", "Path to the cloud provider configuration file of the apiserver and controller-manager. Required for azure and openstack.")
+	CommandLine.StringVar(&renderOpts.networkProvider, "network-provider", "flannel", "CNI network provider (flannel, calico, cilium, weave-net, kube-router, experimental-canal or none). With none no CNI manifests are rendered and the network provider must be deployed separately.")
+	CommandLine.StringVar(&renderOpts.ciliumProxyMode, "cilium-kube-proxy-replacement", asset.CiliumKubeProxyReplacementDisabled, "Cilium kube-proxy replacement mode (disabled, partial or strict). In strict mode the kube-proxy manifests are not rendered. Only used with --network-provider=cilium.")
+	CommandLine.BoolVar(&renderOpts.weaveEncryption, "weave-encryption", false, "Generate a network password Secret to encrypt weave-net traffic between nodes. Only used with --network-provider=weave-net.")
+	CommandLine.BoolVar(&renderOpts.kubeRouterProxy, "kube-router-service-proxy", true, "Run the service proxy in kube-router instead of deploying kube-proxy. Only used with --network-provider=kube-router.")
 	CommandLine.StringVar(&renderOpts.clusterName, "cluster-name", "", "The name of the kubernetes cluster.")
+	CommandLine.DurationVar(&renderOpts.bootstrapTTL, "bootstrap-kubeconfig-ttl", asset.DefaultBootstrapKubeConfigTTL, "Validity of the credential in the bootstrap kubeconfig used by `bootkube start`. bootkube start must be run before it expires.")
+	CommandLine.DurationVar(&renderOpts.bootstrapTokenTTL, "bootstrap-token-ttl", asset.DefaultBootstrapTokenTTL, "Validity of the bootstrap token of the kubelet join bundle. 0 means the token never expires. Create tokens for nodes joining later with `bootkube token create`.")
+	CommandLine.StringVar(&renderOpts.requestHeaderAllowedNames, "requestheader-allowed-names", "front-proxy-client", "List of client certificate common names allowed to authenticate users through request headers (front proxies), comma separated.")
+	CommandLine.StringVar(&renderOpts.requestHeaderUsernameHeaders, "requestheader-username-headers", "X-Remote-User", "List of request headers the apiserver reads the user name from, comma separated.")
+	CommandLine.StringVar(&renderOpts.requestHeaderGroupHeaders, "requestheader-group-headers", "X-Remote-Group", "List of request headers the apiserver reads groups from, comma separated.")
+	CommandLine.StringVar(&renderOpts.requestHeaderExtraHeadersPrefix, "requestheader-extra-headers-prefix", "X-Remote-Extra-", "List of request header prefixes the apiserver reads user extras from, comma separated.")
+	CommandLine.BoolVar(&renderOpts.apiServerLBAnnotations, "api-server-lb-annotations", false, "Annotate the kube-apiserver DaemonSet with health check and PROXY protocol guidance for load balancers fronting the apiserver.")
+
+	CommandLine.StringVar(&renderOpts.externalDNSProvider, "external-dns-provider", "", "Render external-dns with this DNS provider (e.g. aws, google, cloudflare) to publish the hostname of the first --api-servers URL. Provider credentials are read from the optional kube-system/external-dns Secret.")
+	CommandLine.StringVar(&renderOpts.externalDNSZone, "external-dns-zone", "", "DNS zone external-dns manages the apiserver record in. Required with --external-dns-provider.")
+	CommandLine.StringVar(&renderOpts.externalDNSTarget, "external-dns-target", "", "Load balancer or VIP address (IP or hostname) the apiserver record points to. Required with --external-dns-provider.")
+	CommandLine.BoolVar(&renderOpts.dnsAutoscaler, "dns-autoscaler", false, "Render the cluster-proportional-autoscaler to scale the CoreDNS replicas with the size of the cluster.")
+	CommandLine.IntVar(&renderOpts.dnsAutoscalerCoresPerReplica, "dns-autoscaler-cores-per-replica", 256, "Number of cluster CPU cores per CoreDNS replica. Only used with --dns-autoscaler.")
+	CommandLine.IntVar(&renderOpts.dnsAutoscalerNodesPerReplica, "dns-autoscaler-nodes-per-replica", 16, "Number of cluster nodes per CoreDNS replica. Only used with --dns-autoscaler.")
+	CommandLine.BoolVar(&renderOpts.renderMetricsServer, "render-metrics-server", false, "Render metrics-server so that kubectl top and the HorizontalPodAutoscaler work after bootstrap.")
+	CommandLine.BoolVar(&renderOpts.audit, "audit", false, "Enable apiserver audit logging with a built-in audit policy. Implied by --audit-policy-file and --audit-webhook-config-file.")
+	CommandLine.StringVar(&renderOpts.auditPolicyFile, "audit-policy-file", "", "Path to an audit policy file to use instead of the built-in audit policy.")
+	CommandLine.StringVar(&renderOpts.auditLogPath, "audit-log-path", "/var/log/kubernetes/audit/audit.log", "Path of the audit log on the master nodes.")
+	CommandLine.IntVar(&renderOpts.auditLogMaxAge, "audit-log-maxage", 30, "Number of days to keep rotated audit logs.")
+	CommandLine.StringVar(&renderOpts.auditWebhookConfigFile, "audit-webhook-config-file", "", "Path to a kubeconfig formatted file describing an audit webhook to also send audit events to.")
+	CommandLine.BoolVar(&renderOpts.pinDigests, "pin-digests", false, "Resolve the tags of the images of the rendered manifests to digests at render time and pin the manifests to them. Requires access to the registries of those images.")
+	CommandLine.StringVar(&renderOpts.imageRepository, "image-repository", "", "Pull all images from this repository instead, e.g. registry.internal/k8s for registry.internal/k8s/hyperkube. The rendered images.txt lists the images to mirror.")
+	CommandLine.StringVar(&renderOpts.kubernetesVersion, "kubernetes-version", "", "Kubernetes version of the control plane, e.g. v1.17.4, selecting the hyperkube image and the CoreDNS and etcd images tested with it. v1.16 to v1.18 are supported. Defaults to the version of the default hyperkube image.")
+	CommandLine.StringVar(&renderOpts.encryptionProvider, "encryption-provider", "", "Encrypt secrets at rest in etcd with a generated key for this provider (aescbc or secretbox). Rotate the key with `bootkube rotate-encryption-key`.")
+	CommandLine.StringVar(&renderOpts.rbacProfile, "rbac-profile", asset.RBACProfileStrict, "RBAC profile of the control plane (strict or legacy). With legacy the default service account of kube-system is granted cluster-admin and the bootstrap control plane uses the bootstrap kubeconfig, as in earlier releases.")
+	CommandLine.StringVar(&renderOpts.securityProfile, "security-profile", asset.SecurityProfileHardened, "Security profile of the control plane containers (hardened or legacy). hardened runs them with the runtime/default seccomp profile, a read-only root filesystem and no capabilities; legacy uses the container runtime defaults, as in earlier releases.")
+	CommandLine.StringVar(&renderOpts.controlPlaneNamespace, "control-plane-namespace", asset.DefaultControlPlaneNamespace, "Namespace of the control plane components, their secrets, service accounts and RBAC. Node agents and cluster addons stay in kube-system.")
+	CommandLine.StringVar(&renderOpts.kubeletEvictionHard, "kubelet-eviction-hard", "", "Hard eviction thresholds of the kubelet, comma separated. Example: 'memory.available<100Mi,nodefs.available<10%'. Kubelet defaults are used when empty.")
+	CommandLine.StringVar(&renderOpts.kubeletEvictionSoft, "kubelet-eviction-soft", "", "Soft eviction thresholds of the kubelet, comma separated. Example: 'memory.available<500Mi'. Each requires a --kubelet-eviction-soft-grace-period.")
+	CommandLine.StringVar(&renderOpts.kubeletEvictionSoftGracePeriod, "kubelet-eviction-soft-grace-period", "", "Grace periods of the soft eviction thresholds, comma separated. Example: 'memory.available=1m30s'.")
+	CommandLine.StringVar(&renderOpts.kubeletSystemReserved, "kubelet-system-reserved", "", "Resources reserved for system daemons on each node, comma separated. Example: 'cpu=100m,memory=256Mi'.")
+	CommandLine.StringVar(&renderOpts.kubeletKubeReserved, "kubelet-kube-reserved", "", "Resources reserved for the kubelet and container runtime on each node, comma separated. Example: 'cpu=100m,memory=256Mi'.")
+	CommandLine.StringVar(&renderOpts.kubeletBundleDir, "kubelet-bundle-dir", asset.DefaultKubeletBundleDir, "Directory of the nodes the kubelet join bundle is installed to, referenced by its KubeletConfiguration and systemd unit.")
+	CommandLine.StringVar(&renderOpts.kubeletCgroupDriver, "kubelet-cgroup-driver", "", "Cgroup driver of the container runtime of the nodes, cgroupfs or systemd. The kubelet default is used when empty.")
+	CommandLine.BoolVar(&renderOpts.kubeletSystemdUnit, "kubelet-systemd-unit", false, "Also render a systemd unit to the join bundle that runs the kubelet with it.")
+	CommandLine.BoolVar(&renderOpts.podSecurity, "pod-security", false, "Restrict pods to the baseline Pod Security Standard with PodSecurityPolicies. The self-hosted control plane and network provider are exempt.")
+	CommandLine.StringVar(&renderOpts.podSecurityNamespaces, "pod-security-namespaces", "", "Namespaces to create with Pod Security labels enforcing baseline, comma separated. Requires --pod-security.")
+	CommandLine.StringVar(&renderOpts.featureGatesAPIServer, "feature-gates-apiserver", "", "Feature gates of the apiserver, comma separated. Example: 'EphemeralContainers=true'.")
+	CommandLine.StringVar(&renderOpts.featureGatesControllerManager, "feature-gates-controller-manager", "", "Feature gates of the controller-manager, comma separated.")
+	CommandLine.StringVar(&renderOpts.featureGatesScheduler, "feature-gates-scheduler", "", "Feature gates of the scheduler, comma separated.")
+	CommandLine.StringVar(&renderOpts.featureGatesKubelet, "feature-gates-kubelet", "", "Feature gates of the kubelet, rendered into the KubeletConfiguration of the join bundle, comma separated.")
+	CommandLine.Var(&renderOpts.apiServerExtraFlags, "apiserver-extra-flags", "Extra flag of the apiserver as flag=value, can be repeated. Flags set by bootkube can't be overridden.")
+	CommandLine.Var(&renderOpts.controllerManagerExtraFlags, "controller-manager-extra-flags", "Extra flag of the controller-manager as flag=value, can be repeated. Flags set by bootkube can't be overridden.")
+	CommandLine.Var(&renderOpts.schedulerExtraFlags, "scheduler-extra-flags", "Extra flag of the scheduler as flag=value, can be repeated. Flags set by bootkube can't be overridden.")
+	CommandLine.StringVar(&renderOpts.admissionControlConfigFile, "admission-control-config-file", "", "Path to an AdmissionConfiguration of the apiserver. The plugins it configures are enabled, and the files it references, e.g. webhook kubeconfigs, are stored in the apiserver secret.")
+	CommandLine.StringVar(&renderOpts.oidcIssuerURL, "oidc-issuer-url", "", "URL of the OpenID Connect issuer the apiserver authenticates users with, e.g. https://accounts.example.com. Requires --oidc-client-id.")
+	CommandLine.StringVar(&renderOpts.oidcClientID, "oidc-client-id", "", "Client ID that OpenID Connect ID tokens must be issued for.")
+	CommandLine.StringVar(&renderOpts.oidcUsernameClaim, "oidc-username-claim", "", "OpenID Connect claim to use as the user name. The apiserver defaults to sub.")
+	CommandLine.StringVar(&renderOpts.oidcGroupsClaim, "oidc-groups-claim", "", "OpenID Connect claim to use as the groups of the user.")
+	CommandLine.StringVar(&renderOpts.oidcCAFile, "oidc-ca-file", "", "Path to the PEM encoded CA of the OpenID Connect issuer. The host's root CAs are used when empty.")
+	CommandLine.StringVar(&renderOpts.controlPlaneNodeSelector, "control-plane-node-selector", "node-role.kubernetes.io/master=", "Node labels selecting the nodes of the self-hosted control plane and pod checkpointer, comma separated. Example: 'node-role.kubernetes.io/master=,pool=control'. Empty selects all nodes.")
+	CommandLine.StringVar(&renderOpts.controlPlaneTolerations, "control-plane-tolerations", "node-role.kubernetes.io/master:NoSchedule", "Taints the self-hosted control plane and pod checkpointer tolerate as key[=value][:effect], comma separated. Example: 'node-role.kubernetes.io/master:NoSchedule,dedicated=control'.")
+	CommandLine.BoolVar(&renderOpts.selfHosted, "self-hosted", true, "Render a self-hosted control plane and the bootstrap control plane pivoting to it. With --self-hosted=false the apiserver, controller-manager and scheduler are rendered as permanent static pods in static-manifests instead.")
+	CommandLine.StringVar(&renderOpts.arch, "arch", asset.ArchAMD64, "Architecture of the control plane nodes (amd64 or arm64), selecting the images built for it and pinning the self-hosted control plane to nodes of it. Images only published for amd64 must be set in --config.")
+	CommandLine.StringVar(&renderOpts.bootstrapMasters, "bootstrap-masters", "", "IP addresses of the masters bootkube start runs on at once to bootstrap an HA control plane, comma separated. They are added to the apiserver certificate, and the masters pivot to the self-hosted control plane one at a time.")
+	CommandLine.IntVar(&renderOpts.bootstrapAPIServerPort, "bootstrap-apiserver-port", 0, "Secure port of the bootstrap apiserver, if it differs from the port of the first --api-servers URL, e.g. on a node where that port is already taken. bootkube start and the bootstrap control plane connect to it.")
+	CommandLine.StringVar(&renderOpts.bootstrapAdvertiseAddress, "bootstrap-advertise-address", "", "IP address the bootstrap apiserver advertises to the cluster instead of the node IP, e.g. on hosts with several network interfaces. bootkube start and the bootstrap control plane connect to it, and it is added to the apiserver certificate.")
+	CommandLine.BoolVar(&renderOpts.anonymousAuth, "anonymous-auth", false, "Let the apiservers serve anonymous requests, which RBAC limits to the health and version endpoints, and probe the liveness of the self-hosted apiserver on /healthz.")
+	CommandLine.BoolVar(&renderOpts.disableInsecurePort, "disable-insecure-port", false, "Disable the insecure HTTP ports of the bootstrap and static apiserver, controller-manager and scheduler, and probe the liveness of the self-hosted controller-manager and scheduler on their secure ports.")
+	CommandLine.BoolVar(&renderOpts.konnectivity, "konnectivity", false, "Run a konnectivity-server sidecar with the apiservers and a konnectivity-agent on every node, for control planes that can't reach the node and pod networks. The agents connect to port 8132 of the apiserver host. Requires --kubernetes-version v1.18 or later.")
+	CommandLine.StringVar(&renderOpts.etcdBackupSchedule, "etcd-backup-schedule", "", "Cron schedule of a CronJob taking snapshots of the first --etcd-servers on the control plane nodes, e.g. \"0 */6 * * *\". The snapshots can be restored with bootkube recover --etcd-snapshot.")
+	CommandLine.StringVar(&renderOpts.etcdBackupDestination, "etcd-backup-destination", asset.EtcdBackupPVC, "Where the etcd snapshots are stored: pvc for a PersistentVolumeClaim, s3 or gcs for the bucket of --etcd-backup-url.")
+	CommandLine.IntVar(&renderOpts.etcdBackupRetain, "etcd-backup-retain", 7, "Number of etcd snapshots kept on the PersistentVolumeClaim. Buckets expire snapshots with their lifecycle rules instead.")
+	CommandLine.StringVar(&renderOpts.etcdBackupVolumeSize, "etcd-backup-volume-size", "10Gi", "Size of the PersistentVolumeClaim of the etcd snapshots.")
+	CommandLine.StringVar(&renderOpts.etcdBackupStorageClass, "etcd-backup-storage-class", "", "StorageClass of the PersistentVolumeClaim of the etcd snapshots, the default StorageClass if empty.")
+	CommandLine.StringVar(&renderOpts.etcdBackupURL, "etcd-backup-url", "", "s3:// or gs:// URL of the bucket the etcd snapshots are uploaded to, optionally with a path prefix.")
+	CommandLine.StringVar(&renderOpts.etcdBackupRegion, "etcd-backup-region", "", "Region of the S3 bucket of the etcd snapshots, if the credentials don't set it.")
+	CommandLine.StringVar(&renderOpts.etcdBackupCredentials, "etcd-backup-credentials", "", "Path to an AWS shared credentials file or a GCP service account key uploading the etcd snapshots. By default the credentials of the control plane nodes are used.")
+	CommandLine.StringVar(&renderOpts.controlPlaneBackupPath, "control-plane-backup-path", "", "Path on the control plane nodes where a DaemonSet running bootkube backup keeps a backup of the control plane as it changes, e.g. /var/lib/bootkube/control-plane-backup.json. It can be recovered with bootkube recover --backup.")
+	CommandLine.DurationVar(&renderOpts.checkpointInterval, "checkpoint-interval", 0, "How often the pod checkpointer checkpoints pods and updates their checkpoints, 5s if zero. Longer intervals reduce churn on low-power nodes, shorter ones speed up recovery.")
+	CommandLine.DurationVar(&renderOpts.checkpointBackoff, "checkpoint-backoff", 0, "How long the pod checkpointer doesn't checkpoint a pod after it failed to, doubling with every further failure, 10s if zero.")
+	CommandLine.DurationVar(&renderOpts.maxCheckpointBackoff, "max-checkpoint-backoff", 0, "The maximum time the pod checkpointer doesn't checkpoint a pod after repeated failures, 2m if zero.")
+	CommandLine.DurationVar(&renderOpts.checkpointAPIServerPollInterval, "checkpoint-apiserver-poll-interval", 0, "How often the pod checkpointer retrieves parent pods from the apiserver. Every --checkpoint-interval if zero.")
+	CommandLine.DurationVar(&renderOpts.checkpointKubeletPollInterval, "checkpoint-kubelet-poll-interval", 0, "How often the pod checkpointer retrieves parent pods from the kubelet. Every --checkpoint-interval if zero.")
+	CommandLine.BoolVar(&renderOpts.schedulerConfig, "scheduler-config", false, "Configure the schedulers with a KubeSchedulerConfiguration, stored in a ConfigMap for the self-hosted scheduler, instead of flags. Implied by --scheduler-config-file.")
+	CommandLine.StringVar(&renderOpts.schedulerConfigFile, "scheduler-config-file", "", "Path to a KubeSchedulerConfiguration to use instead of the default one, e.g. for scheduling profiles or plugin settings. The kubeconfig of its clientConnection is set by bootkube.")
+	CommandLine.BoolVar(&renderOpts.csrAutoApproval, "csr-auto-approval", true, "Automatically approve the client certificate CSRs of bootstrapping and renewing kubelets. When false, they are approved with kubectl certificate approve.")
+	CommandLine.BoolVar(&renderOpts.nodeAuthorization, "node-authorization", true, "Authorize kubelets with the Node authorizer and the NodeRestriction admission plugin, which limit each node to its own objects. When false, kubelets are authorized with RBAC only.")
+	CommandLine.StringVar(&renderOpts.config, "config", "", "Path to a render config file setting flags and images, optionally with per environment overlays. Flags set on the command line take precedence.")
+	CommandLine.StringVar(&renderOpts.environment, "environment", "", "The overlay of the --config file to apply on top of its base settings, e.g. prod.")
 
 	CommandLine.Parse(args)
 
+	if renderOpts.config != "" {
+		if err := applyRenderConfig(CommandLine, &imageVersions, resources, renderOpts.config, renderOpts.environment); err != nil {
+			return err
+		}
+	} else if renderOpts.environment != "" {
+		return errors.New("--environment requires --config")
+	}
+
 	err := validateRenderOpts()
 	if err != nil {
 		return err
@@ -76,6 +289,28 @@ func (*render) Render(opts *plugin.Options, args []string) error {
 		return err
 	}
 
+	if renderOpts.kubernetesVersion != "" {
+		if config.Images, err = asset.SetKubernetesVersion(config.Images, renderOpts.kubernetesVersion); err != nil {
+			return fmt.Errorf("invalid --kubernetes-version: %v", err)
+		}
+	}
+	config.Images = asset.SetArch(config.Images, renderOpts.arch)
+	if renderOpts.imageRepository != "" {
+		config.Images = asset.SetImageRepository(config.Images, renderOpts.imageRepository)
+	}
+	if renderOpts.pinDigests {
+		// Only the images of the rendered manifests are resolved, so the assets are rendered again
+		// with the pinned images.
+		unpinned, err := asset.NewDefaultAssets(*config)
+		if err != nil {
+			return err
+		}
+		config.Images, err = asset.PinImageDigests(config.Images, unpinned, asset.NewRegistryDigestResolver(&http.Client{Timeout: 30 * time.Second}))
+		if err != nil {
+			return err
+		}
+	}
+
 	as, err := asset.NewDefaultAssets(*config)
 	if err != nil {
 		return err
@@ -96,6 +331,9 @@ func validateRenderOpts() error {
 	if renderOpts.caPrivateKeyPath != "" && renderOpts.caCertificatePath == "" {
 		return errors.New("You must provide the --ca-certificate-path flag when --ca-private-key-path is provided.")
 	}
+	if renderOpts.preserveTLS != "" && renderOpts.caCertificatePath != "" {
+		return errors.New("--preserve-tls preserves the CA too, it can't be combined with --ca-certificate-path.")
+	}
 	if (renderOpts.etcdCAPath != "" || renderOpts.etcdCertificatePath != "" || renderOpts.etcdPrivateKeyPath != "") && (renderOpts.etcdCAPath == "" || renderOpts.etcdCertificatePath == "" || renderOpts.etcdPrivateKeyPath == "") {
 		return errors.New("You must specify either all or none of --etcd-ca-path, --etcd-certificate-path, and --etcd-private-key-path")
 	}
@@ -105,8 +343,216 @@ func validateRenderOpts() error {
 	if renderOpts.apiServers == "" {
 		return errors.New("Missing required flag: --api-servers")
 	}
-	if renderOpts.networkProvider != asset.NetworkFlannel && renderOpts.networkProvider != asset.NetworkCalico && renderOpts.networkProvider != asset.NetworkCanal {
-		return errors.New("Must specify --network-provider flannel or experimental-calico or experimental-canal")
+	if renderOpts.networkProvider == asset.NetworkCalicoExperimental {
+		fmt.Printf("--network-provider=%s is deprecated, use --network-provider=%s instead\n", asset.NetworkCalicoExperimental, asset.NetworkCalico)
+		renderOpts.networkProvider = asset.NetworkCalico
+	}
+	if renderOpts.networkProvider != asset.NetworkFlannel && renderOpts.networkProvider != asset.NetworkCalico && renderOpts.networkProvider != asset.NetworkCanal && renderOpts.networkProvider != asset.NetworkCilium && renderOpts.networkProvider != asset.NetworkWeaveNet && renderOpts.networkProvider != asset.NetworkKubeRouter && renderOpts.networkProvider != asset.NetworkNone {
+		return errors.New("Must specify --network-provider flannel or calico or cilium or weave-net or kube-router or experimental-canal or none")
+	}
+	switch renderOpts.cloudProvider {
+	case "", asset.CloudProviderAWS, asset.CloudProviderGCE, asset.CloudProviderAzure, asset.CloudProviderOpenStack:
+	default:
+		return fmt.Errorf("--cloud-provider must be %s, %s, %s or %s, got %q", asset.CloudProviderAWS, asset.CloudProviderGCE, asset.CloudProviderAzure, asset.CloudProviderOpenStack, renderOpts.cloudProvider)
+	}
+	if renderOpts.cloudConfig != "" && renderOpts.cloudProvider == "" {
+		return errors.New("--cloud-config requires --cloud-provider")
+	}
+	if renderOpts.cloudConfig == "" && (renderOpts.cloudProvider == asset.CloudProviderAzure || renderOpts.cloudProvider == asset.CloudProviderOpenStack) {
+		return fmt.Errorf("--cloud-provider=%s requires --cloud-config", renderOpts.cloudProvider)
+	}
+	if renderOpts.weaveEncryption && renderOpts.networkProvider != asset.NetworkWeaveNet {
+		return errors.New("--weave-encryption requires --network-provider=weave-net")
+	}
+	if renderOpts.dnsAutoscalerCoresPerReplica <= 0 || renderOpts.dnsAutoscalerNodesPerReplica <= 0 {
+		return errors.New("--dns-autoscaler-cores-per-replica and --dns-autoscaler-nodes-per-replica must be positive")
+	}
+	if renderOpts.auditPolicyFile != "" || renderOpts.auditWebhookConfigFile != "" {
+		renderOpts.audit = true
+	}
+	if !path.IsAbs(renderOpts.auditLogPath) || path.Clean(renderOpts.auditLogPath) != renderOpts.auditLogPath || path.Dir(renderOpts.auditLogPath) == "/" {
+		return fmt.Errorf("--audit-log-path must be a clean absolute path outside of /, got %q", renderOpts.auditLogPath)
+	}
+	if renderOpts.auditLogMaxAge < 0 {
+		return errors.New("--audit-log-maxage must not be negative")
+	}
+	if renderOpts.checkpointInterval < 0 || renderOpts.checkpointBackoff < 0 || renderOpts.maxCheckpointBackoff < 0 || renderOpts.checkpointAPIServerPollInterval < 0 || renderOpts.checkpointKubeletPollInterval < 0 {
+		return errors.New("--checkpoint-interval, --checkpoint-backoff, --max-checkpoint-backoff, --checkpoint-apiserver-poll-interval and --checkpoint-kubelet-poll-interval must not be negative")
+	}
+	if renderOpts.encryptionProvider != "" && renderOpts.encryptionProvider != asset.EncryptionProviderAESCBC && renderOpts.encryptionProvider != asset.EncryptionProviderSecretbox {
+		return fmt.Errorf("--encryption-provider must be %s or %s, got %q", asset.EncryptionProviderAESCBC, asset.EncryptionProviderSecretbox, renderOpts.encryptionProvider)
+	}
+	if renderOpts.securityProfile != asset.SecurityProfileHardened && renderOpts.securityProfile != asset.SecurityProfileLegacy {
+		return fmt.Errorf("--security-profile must be %s or %s, got %q", asset.SecurityProfileHardened, asset.SecurityProfileLegacy, renderOpts.securityProfile)
+	}
+	if renderOpts.rbacProfile != asset.RBACProfileStrict && renderOpts.rbacProfile != asset.RBACProfileLegacy {
+		return fmt.Errorf("--rbac-profile must be %s or %s, got %q", asset.RBACProfileStrict, asset.RBACProfileLegacy, renderOpts.rbacProfile)
+	}
+	if errs := validation.IsDNS1123Label(renderOpts.controlPlaneNamespace); len(errs) > 0 {
+		return fmt.Errorf("invalid --control-plane-namespace %q: %s", renderOpts.controlPlaneNamespace, strings.Join(errs, ", "))
+	}
+	switch renderOpts.controlPlaneNamespace {
+	case "default", "kube-public", "kube-node-lease":
+		return fmt.Errorf("--control-plane-namespace can't be %s", renderOpts.controlPlaneNamespace)
+	}
+	if renderOpts.podSecurityNamespaces != "" {
+		if !renderOpts.podSecurity {
+			return errors.New("--pod-security-namespaces requires --pod-security")
+		}
+		namespaces, err := parsePodSecurityNamespaces(renderOpts.podSecurityNamespaces)
+		if err != nil {
+			return fmt.Errorf("invalid --pod-security-namespaces: %v", err)
+		}
+		for _, ns := range namespaces {
+			if ns == renderOpts.controlPlaneNamespace {
+				return fmt.Errorf("invalid --pod-security-namespaces: the control plane namespace %s is always labeled and can't be listed", ns)
+			}
+		}
+	}
+	if err := validateImageRepository(renderOpts.imageRepository); err != nil {
+		return err
+	}
+	if err := validateOIDC(renderOpts.oidcIssuerURL, renderOpts.oidcClientID, renderOpts.oidcUsernameClaim, renderOpts.oidcGroupsClaim, renderOpts.oidcCAFile); err != nil {
+		return err
+	}
+	if !renderOpts.selfHosted && renderOpts.rbacProfile == asset.RBACProfileLegacy {
+		return errors.New("--self-hosted=false requires --rbac-profile=strict")
+	}
+	if renderOpts.arch != asset.ArchAMD64 && renderOpts.arch != asset.ArchARM64 {
+		return fmt.Errorf("--arch must be %s or %s, got %q", asset.ArchAMD64, asset.ArchARM64, renderOpts.arch)
+	}
+	if _, err := parseBootstrapMasters(renderOpts.bootstrapMasters); err != nil {
+		return fmt.Errorf("invalid --bootstrap-masters: %v", err)
+	}
+	if renderOpts.bootstrapAPIServerPort < 0 || renderOpts.bootstrapAPIServerPort > 65535 {
+		return fmt.Errorf("--bootstrap-apiserver-port must be a port number, got %d", renderOpts.bootstrapAPIServerPort)
+	}
+	if renderOpts.bootstrapAdvertiseAddress != "" && net.ParseIP(renderOpts.bootstrapAdvertiseAddress) == nil {
+		return fmt.Errorf("--bootstrap-advertise-address must be an IP address, got %q", renderOpts.bootstrapAdvertiseAddress)
+	}
+	if !renderOpts.selfHosted && (renderOpts.bootstrapAPIServerPort != 0 || renderOpts.bootstrapAdvertiseAddress != "") {
+		return errors.New("--bootstrap-apiserver-port and --bootstrap-advertise-address require a self-hosted control plane, there is no bootstrap apiserver with --self-hosted=false")
+	}
+	if renderOpts.schedulerConfigFile != "" {
+		renderOpts.schedulerConfig = true
+	}
+	switch renderOpts.kubeletCgroupDriver {
+	case "", "cgroupfs", "systemd":
+	default:
+		return fmt.Errorf("--kubelet-cgroup-driver must be cgroupfs or systemd, got %q", renderOpts.kubeletCgroupDriver)
+	}
+	if !path.IsAbs(renderOpts.kubeletBundleDir) {
+		return fmt.Errorf("--kubelet-bundle-dir must be an absolute path, got %q", renderOpts.kubeletBundleDir)
+	}
+	if renderOpts.bootstrapTTL <= 0 {
+		return errors.New("--bootstrap-kubeconfig-ttl must be positive")
+	}
+	if renderOpts.bootstrapTokenTTL < 0 {
+		return errors.New("--bootstrap-token-ttl must not be negative")
+	}
+	for flag, value := range map[string]string{
+		"requestheader-allowed-names":        renderOpts.requestHeaderAllowedNames,
+		"requestheader-username-headers":     renderOpts.requestHeaderUsernameHeaders,
+		"requestheader-group-headers":        renderOpts.requestHeaderGroupHeaders,
+		"requestheader-extra-headers-prefix": renderOpts.requestHeaderExtraHeadersPrefix,
+	} {
+		if err := validateHeaderList(value); err != nil {
+			return fmt.Errorf("invalid --%s: %v", flag, err)
+		}
+	}
+	switch renderOpts.ciliumProxyMode {
+	case asset.CiliumKubeProxyReplacementDisabled, asset.CiliumKubeProxyReplacementPartial, asset.CiliumKubeProxyReplacementStrict:
+	default:
+		return errors.New("Must specify --cilium-kube-proxy-replacement disabled or partial or strict")
+	}
+	if renderOpts.ciliumProxyMode != asset.CiliumKubeProxyReplacementDisabled && renderOpts.networkProvider != asset.NetworkCilium {
+		return errors.New("--cilium-kube-proxy-replacement requires --network-provider=cilium")
+	}
+	if renderOpts.etcdBackupSchedule == "" && (renderOpts.etcdBackupDestination != asset.EtcdBackupPVC || renderOpts.etcdBackupURL != "" || renderOpts.etcdBackupRegion != "" || renderOpts.etcdBackupCredentials != "" || renderOpts.etcdBackupStorageClass != "") {
+		return errors.New("--etcd-backup-destination, --etcd-backup-url, --etcd-backup-region, --etcd-backup-credentials and --etcd-backup-storage-class require --etcd-backup-schedule")
+	}
+	return nil
+}
+
+// validateHeaderList checks that a comma separated list of names or header names is non-empty and
+// can be safely rendered into an apiserver flag.
+func validateHeaderList(list string) error {
+	if list == "" {
+		return errors.New("must not be empty")
+	}
+	for _, v := range strings.Split(list, ",") {
+		if v == "" || strings.ContainsAny(v, " \t\n\"'") {
+			return fmt.Errorf("invalid value %q", v)
+		}
+	}
+	return nil
+}
+
+// validateExternalDNS checks that the apiserver endpoint can be published by external-dns: it
+// must be a hostname inside the managed zone.
+func validateExternalDNS(provider, zone, target string, apiServer *url.URL) error {
+	if provider == "" {
+		if zone != "" || target != "" {
+			return errors.New("--external-dns-zone and --external-dns-target require --external-dns-provider")
+		}
+		return nil
+	}
+	if zone == "" || target == "" {
+		return errors.New("--external-dns-provider requires --external-dns-zone and --external-dns-target")
+	}
+	if strings.ContainsAny(target, " \t\n\"'") {
+		return fmt.Errorf("invalid --external-dns-target %q", target)
+	}
+	host := apiServer.Hostname()
+	if net.ParseIP(host) != nil {
+		return fmt.Errorf("external-dns can't publish %s, the first --api-servers URL must use a hostname", host)
+	}
+	zone = strings.TrimSuffix(zone, ".")
+	if host != zone && !strings.HasSuffix(host, "."+zone) {
+		return fmt.Errorf("apiserver hostname %s is not in --external-dns-zone %s", host, zone)
+	}
+	return nil
+}
+
+// validateImageRepository checks that repository is a registry host, optionally with a port,
+// followed by an optional path, e.g. registry.internal:5000/k8s.
+func validateImageRepository(repository string) error {
+	if repository == "" {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSuffix(repository, "/"), "/")
+	for i, part := range parts {
+		if part == "" || strings.ContainsAny(part, " \t\n\"'@") || i > 0 && strings.Contains(part, ":") {
+			return fmt.Errorf("--image-repository must be a registry host and path without scheme, e.g. registry.internal/k8s, got %q", repository)
+		}
+	}
+	return nil
+}
+
+// validateOIDC checks that OpenID Connect authentication is configured with an https issuer and
+// a client ID, and that the other OIDC settings aren't set without them.
+func validateOIDC(issuerURL, clientID, usernameClaim, groupsClaim, caFile string) error {
+	if issuerURL == "" {
+		if clientID != "" || usernameClaim != "" || groupsClaim != "" || caFile != "" {
+			return errors.New("--oidc-client-id, --oidc-username-claim, --oidc-groups-claim and --oidc-ca-file require --oidc-issuer-url")
+		}
+		return nil
+	}
+	u, err := url.Parse(issuerURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("--oidc-issuer-url must be an https URL, got %q", issuerURL)
+	}
+	if clientID == "" {
+		return errors.New("--oidc-issuer-url requires --oidc-client-id")
+	}
+	for flag, value := range map[string]string{
+		"oidc-client-id":      clientID,
+		"oidc-username-claim": usernameClaim,
+		"oidc-groups-claim":   groupsClaim,
+	} {
+		if strings.ContainsAny(value, " \t\n\"'") {
+			return fmt.Errorf("invalid --%s %q", flag, value)
+		}
 	}
 	return nil
 }
@@ -116,6 +562,9 @@ func flagsToAssetConfig() (c *asset.Config, err error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := validateExternalDNS(renderOpts.externalDNSProvider, renderOpts.externalDNSZone, renderOpts.externalDNSTarget, apiServers[0]); err != nil {
+		return nil, err
+	}
 	altNames, err := parseAltNames(renderOpts.altNames)
 	if err != nil {
 		return nil, err
@@ -125,6 +574,118 @@ func flagsToAssetConfig() (c *asset.Config, err error) {
 		altNames = altNamesFromURLs(apiServers)
 	}
 
+	var auditPolicy, auditWebhookConfig []byte
+	if renderOpts.auditPolicyFile != "" {
+		if auditPolicy, err = readConfigFile(renderOpts.auditPolicyFile, "Policy"); err != nil {
+			return nil, err
+		}
+	}
+	if renderOpts.auditWebhookConfigFile != "" {
+		if auditWebhookConfig, err = readConfigFile(renderOpts.auditWebhookConfigFile, "Config"); err != nil {
+			return nil, err
+		}
+	}
+	var schedulerConfig []byte
+	if renderOpts.schedulerConfigFile != "" {
+		if schedulerConfig, err = readConfigFile(renderOpts.schedulerConfigFile, "KubeSchedulerConfiguration"); err != nil {
+			return nil, err
+		}
+	}
+	var cloudConfig []byte
+	if renderOpts.cloudConfig != "" {
+		if cloudConfig, err = ioutil.ReadFile(renderOpts.cloudConfig); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", renderOpts.cloudConfig, err)
+		}
+	}
+	var etcdBackup *asset.EtcdBackupConfig
+	if renderOpts.etcdBackupSchedule != "" {
+		etcdBackup = &asset.EtcdBackupConfig{
+			Schedule:        renderOpts.etcdBackupSchedule,
+			Destination:     renderOpts.etcdBackupDestination,
+			Retain:          renderOpts.etcdBackupRetain,
+			VolumeClaimSize: renderOpts.etcdBackupVolumeSize,
+			StorageClass:    renderOpts.etcdBackupStorageClass,
+			URL:             renderOpts.etcdBackupURL,
+			Region:          renderOpts.etcdBackupRegion,
+		}
+		if renderOpts.etcdBackupCredentials != "" {
+			if etcdBackup.Credentials, err = ioutil.ReadFile(renderOpts.etcdBackupCredentials); err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", renderOpts.etcdBackupCredentials, err)
+			}
+		}
+	}
+	var oidcCACert []byte
+	if renderOpts.oidcCAFile != "" {
+		if oidcCACert, err = ioutil.ReadFile(renderOpts.oidcCAFile); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", renderOpts.oidcCAFile, err)
+		}
+		if _, err := tlsutil.ParsePEMEncodedCACert(oidcCACert); err != nil {
+			return nil, fmt.Errorf("unable to parse certificate %s: %v", renderOpts.oidcCAFile, err)
+		}
+	}
+	var admission *asset.AdmissionConfig
+	if renderOpts.admissionControlConfigFile != "" {
+		if admission, err = readAdmissionConfig(renderOpts.admissionControlConfigFile); err != nil {
+			return nil, err
+		}
+	}
+
+	evictionHard, err := parseEvictionThresholds(renderOpts.kubeletEvictionHard)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --kubelet-eviction-hard: %v", err)
+	}
+	evictionSoft, err := parseEvictionThresholds(renderOpts.kubeletEvictionSoft)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --kubelet-eviction-soft: %v", err)
+	}
+	evictionSoftGracePeriod, err := parseEvictionGracePeriods(renderOpts.kubeletEvictionSoftGracePeriod)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --kubelet-eviction-soft-grace-period: %v", err)
+	}
+	if err := validateSoftEviction(evictionSoft, evictionSoftGracePeriod); err != nil {
+		return nil, err
+	}
+	systemReserved, err := parseReservedResources(renderOpts.kubeletSystemReserved)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --kubelet-system-reserved: %v", err)
+	}
+	kubeReserved, err := parseReservedResources(renderOpts.kubeletKubeReserved)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --kubelet-kube-reserved: %v", err)
+	}
+	podSecurityNamespaces, err := parsePodSecurityNamespaces(renderOpts.podSecurityNamespaces)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --pod-security-namespaces: %v", err)
+	}
+	apiServerFeatureGates, err := parseFeatureGates(renderOpts.featureGatesAPIServer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --feature-gates-apiserver: %v", err)
+	}
+	controllerManagerFeatureGates, err := parseFeatureGates(renderOpts.featureGatesControllerManager)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --feature-gates-controller-manager: %v", err)
+	}
+	schedulerFeatureGates, err := parseFeatureGates(renderOpts.featureGatesScheduler)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --feature-gates-scheduler: %v", err)
+	}
+	kubeletFeatureGates, err := parseFeatureGates(renderOpts.featureGatesKubelet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --feature-gates-kubelet: %v", err)
+	}
+	controlPlaneNodeSelector, err := parseNodeSelector(renderOpts.controlPlaneNodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --control-plane-node-selector: %v", err)
+	}
+	controlPlaneTolerations, err := parseTolerations(renderOpts.controlPlaneTolerations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --control-plane-tolerations: %v", err)
+	}
+	bootstrapMasters, err := parseBootstrapMasters(renderOpts.bootstrapMasters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --bootstrap-masters: %v", err)
+	}
+
 	var caCert *x509.Certificate
 	var caPrivKey *rsa.PrivateKey
 	if renderOpts.caCertificatePath != "" {
@@ -134,6 +695,13 @@ func flagsToAssetConfig() (c *asset.Config, err error) {
 		}
 	}
 
+	var preservedTLS asset.Assets
+	if renderOpts.preserveTLS != "" {
+		if preservedTLS, err = asset.LoadPreservedTLS(renderOpts.preserveTLS); err != nil {
+			return nil, fmt.Errorf("invalid --preserve-tls: %v", err)
+		}
+	}
+
 	var podNets, serviceNets []*net.IPNet
 
 	for _, cidr := range strings.Split(renderOpts.podCIDR, ",") {
@@ -164,12 +732,13 @@ func flagsToAssetConfig() (c *asset.Config, err error) {
 		return nil, errors.New("kubernetes requires exactly 1 or 2 service networks, and they must be of different address families")
 	}
 
-	for _, podNet := range podNets {
-		for _, svcNet := range serviceNets {
-			if podNet.Contains(svcNet.IP) || svcNet.Contains(podNet.IP) {
-				return nil, fmt.Errorf("Pod CIDR %s and service CIDR %s must not overlap", podNet.String(), svcNet.String())
-			}
-		}
+	etcdServers, err := parseURLs(renderOpts.etcdServers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCIDRs(podNets, serviceNets, nodeIPsFromURLs(apiServers, etcdServers)); err != nil {
+		return nil, err
 	}
 
 	var apiServiceIPs, dnsServiceIPs []net.IP
@@ -186,10 +755,10 @@ func flagsToAssetConfig() (c *asset.Config, err error) {
 		}
 		dnsServiceIPs = append(dnsServiceIPs, dnsServiceIP)
 	}
-
-	etcdServers, err := parseURLs(renderOpts.etcdServers)
-	if err != nil {
-		return nil, err
+	if renderOpts.dnsServiceIP != "" {
+		if dnsServiceIPs, err = parseDNSServiceIPs(renderOpts.dnsServiceIP, serviceNets, apiServiceIPs); err != nil {
+			return nil, err
+		}
 	}
 
 	etcdUseTLS := false
@@ -236,11 +805,150 @@ func flagsToAssetConfig() (c *asset.Config, err error) {
 		APIServiceIPs:   apiServiceIPs,
 		DNSServiceIPs:   dnsServiceIPs,
 		CloudProvider:   renderOpts.cloudProvider,
+		CloudConfig:     cloudConfig,
 		NetworkProvider: renderOpts.networkProvider,
 		Images:          imageVersions,
+
+		CiliumKubeProxyReplacement: renderOpts.ciliumProxyMode,
+		WeaveEncryption:            renderOpts.weaveEncryption,
+		KubeRouterServiceProxy:     renderOpts.kubeRouterProxy,
+		BootstrapKubeConfigTTL:     renderOpts.bootstrapTTL,
+		BootstrapTokenTTL:          renderOpts.bootstrapTokenTTL,
+
+		RequestHeaderAllowedNames:       renderOpts.requestHeaderAllowedNames,
+		RequestHeaderUsernameHeaders:    renderOpts.requestHeaderUsernameHeaders,
+		RequestHeaderGroupHeaders:       renderOpts.requestHeaderGroupHeaders,
+		RequestHeaderExtraHeadersPrefix: renderOpts.requestHeaderExtraHeadersPrefix,
+		APIServerLBAnnotations:          renderOpts.apiServerLBAnnotations,
+
+		ExternalDNSProvider: renderOpts.externalDNSProvider,
+		ExternalDNSZone:     renderOpts.externalDNSZone,
+		ExternalDNSTarget:   renderOpts.externalDNSTarget,
+
+		DNSAutoscaler:                renderOpts.dnsAutoscaler,
+		DNSAutoscalerCoresPerReplica: renderOpts.dnsAutoscalerCoresPerReplica,
+		DNSAutoscalerNodesPerReplica: renderOpts.dnsAutoscalerNodesPerReplica,
+
+		MetricsServer: renderOpts.renderMetricsServer,
+
+		Audit:              renderOpts.audit,
+		AuditPolicy:        auditPolicy,
+		AuditLogPath:       renderOpts.auditLogPath,
+		AuditLogMaxAge:     renderOpts.auditLogMaxAge,
+		AuditWebhookConfig: auditWebhookConfig,
+
+		EncryptionProvider: renderOpts.encryptionProvider,
+
+		RBACProfile:           renderOpts.rbacProfile,
+		SecurityProfile:       renderOpts.securityProfile,
+		ControlPlaneNamespace: renderOpts.controlPlaneNamespace,
+
+		PodSecurity:           renderOpts.podSecurity,
+		PodSecurityNamespaces: podSecurityNamespaces,
+
+		FeatureGatesAPIServer:         apiServerFeatureGates,
+		FeatureGatesControllerManager: controllerManagerFeatureGates,
+		FeatureGatesScheduler:         schedulerFeatureGates,
+		FeatureGatesKubelet:           kubeletFeatureGates,
+
+		APIServerExtraFlags:         renderOpts.apiServerExtraFlags,
+		ControllerManagerExtraFlags: renderOpts.controllerManagerExtraFlags,
+		SchedulerExtraFlags:         renderOpts.schedulerExtraFlags,
+
+		Admission: admission,
+
+		OIDCIssuerURL:     renderOpts.oidcIssuerURL,
+		OIDCClientID:      renderOpts.oidcClientID,
+		OIDCUsernameClaim: renderOpts.oidcUsernameClaim,
+		OIDCGroupsClaim:   renderOpts.oidcGroupsClaim,
+		OIDCCACert:        oidcCACert,
+
+		KubeletEvictionHard:            evictionHard,
+		KubeletEvictionSoft:            evictionSoft,
+		KubeletEvictionSoftGracePeriod: evictionSoftGracePeriod,
+		KubeletSystemReserved:          systemReserved,
+		KubeletKubeReserved:            kubeReserved,
+		KubeletBundleDir:               path.Clean(renderOpts.kubeletBundleDir),
+		KubeletCgroupDriver:            renderOpts.kubeletCgroupDriver,
+		KubeletSystemdUnit:             renderOpts.kubeletSystemdUnit,
+
+		ControlPlaneNodeSelector: controlPlaneNodeSelector,
+		ControlPlaneTolerations:  controlPlaneTolerations,
+
+		StaticControlPlane: !renderOpts.selfHosted,
+
+		Arch: renderOpts.arch,
+
+		BootstrapMasters: bootstrapMasters,
+
+		BootstrapAPIServerPort:    renderOpts.bootstrapAPIServerPort,
+		BootstrapAdvertiseAddress: net.ParseIP(renderOpts.bootstrapAdvertiseAddress),
+
+		AnonymousAuth:       renderOpts.anonymousAuth,
+		DisableInsecurePort: renderOpts.disableInsecurePort,
+
+		Konnectivity: renderOpts.konnectivity,
+
+		EtcdBackup: etcdBackup,
+
+		ControlPlaneBackupPath: renderOpts.controlPlaneBackupPath,
+
+		CheckpointInterval:              renderOpts.checkpointInterval,
+		CheckpointBackoff:               renderOpts.checkpointBackoff,
+		MaxCheckpointBackoff:            renderOpts.maxCheckpointBackoff,
+		CheckpointAPIServerPollInterval: renderOpts.checkpointAPIServerPollInterval,
+		CheckpointKubeletPollInterval:   renderOpts.checkpointKubeletPollInterval,
+
+		SchedulerConfig:        renderOpts.schedulerConfig,
+		SchedulerConfiguration: schedulerConfig,
+
+		DisableCSRAutoApproval: !renderOpts.csrAutoApproval,
+
+		DisableNodeAuthorization: !renderOpts.nodeAuthorization,
+
+		Resources: resources,
+
+		PreservedTLS: preservedTLS,
 	}, nil
 }
 
+// readAdmissionConfig reads the AdmissionConfiguration at p and the files it references. Relative
+// paths are relative to the directory of p.
+func readAdmissionConfig(p string) (*asset.AdmissionConfig, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", p, err)
+	}
+	ac, err := asset.NewAdmissionConfig(b, func(file string) ([]byte, error) {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(p), file)
+		}
+		return ioutil.ReadFile(file)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return ac, nil
+}
+
+// readConfigFile reads a YAML or JSON configuration file and checks that it is of the given kind.
+func readConfigFile(p, kind string) ([]byte, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", p, err)
+	}
+	var typeMeta struct {
+		Kind string `json:"kind"`
+	}
+	if err := yaml.Unmarshal(b, &typeMeta); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", p, err)
+	}
+	if typeMeta.Kind != kind {
+		return nil, fmt.Errorf("%s: expected kind %s, got %q", p, kind, typeMeta.Kind)
+	}
+	return b, nil
+}
+
 func parseCertAndPrivateKeyFromDisk(caCertPath, privKeyPath string) (*rsa.PrivateKey, *x509.Certificate, error) {
 	// Parse CA Private key.
 	keypem, err := ioutil.ReadFile(privKeyPath)
@@ -249,7 +957,7 @@ func parseCertAndPrivateKeyFromDisk(caCertPath, privKeyPath string) (*rsa.Privat
 	}
 	key, err := tlsutil.ParsePEMEncodedPrivateKey(keypem)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to parse CA private key: %v", err)
+		return nil, nil, fmt.Errorf("unable to parse private key %s: %v", privKeyPath, err)
 	}
 	// Parse CA Cert.
 	cert, err := parseCertFromDisk(caCertPath)
@@ -266,7 +974,7 @@ func parseCertFromDisk(caCertPath string) (*x509.Certificate, error) {
 	}
 	cert, err := tlsutil.ParsePEMEncodedCACert(capem)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse CA Cert: %v", err)
+		return nil, fmt.Errorf("unable to parse certificate %s: %v", caCertPath, err)
 	}
 	return cert, nil
 }
@@ -283,6 +991,51 @@ func parseURLs(s string) ([]*url.URL, error) {
 	return out, nil
 }
 
+// parsePodSecurityNamespaces parses a comma separated list of namespace names. kube-system is
+// always labeled and can't be listed.
+func parsePodSecurityNamespaces(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, ns := range strings.Split(s, ",") {
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+		if ns == "kube-system" {
+			return nil, errors.New("kube-system is always labeled and can't be listed")
+		}
+		if seen[ns] {
+			return nil, fmt.Errorf("namespace %q is listed twice", ns)
+		}
+		seen[ns] = true
+		out = append(out, ns)
+	}
+	return out, nil
+}
+
+// parseBootstrapMasters parses a comma separated list of master IP addresses.
+func parseBootstrapMasters(s string) ([]net.IP, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []net.IP
+	seen := map[string]bool{}
+	for _, addr := range strings.Split(s, ",") {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", addr)
+		}
+		if seen[ip.String()] {
+			return nil, fmt.Errorf("address %s is listed twice", ip)
+		}
+		seen[ip.String()] = true
+		out = append(out, ip)
+	}
+	return out, nil
+}
+
 func parseAltNames(s string) (*tlsutil.AltNames, error) {
 	if s == "" {
 		return nil, nil
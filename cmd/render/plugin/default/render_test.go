@@ -1,8 +1,19 @@
 package main
 
 import (
+	"flag"
+	"io/ioutil"
 	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
 )
 
 func TestOffsetIP(t *testing.T) {
@@ -34,3 +45,486 @@ func TestOffsetIP(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateCIDRs(t *testing.T) {
+	cases := []struct {
+		name     string
+		podCIDRs []string
+		svcCIDRs []string
+		nodeIPs  []string
+		wantErr  bool
+	}{
+		{"defaults", []string{"10.2.0.0/16"}, []string{"10.3.0.0/24"}, []string{"192.168.1.10"}, false},
+		{"dual-stack", []string{"10.2.0.0/16", "fd00:2::/56"}, []string{"10.3.0.0/24", "fd00:3::/112"}, nil, false},
+		{"overlap", []string{"10.2.0.0/16"}, []string{"10.2.1.0/24"}, nil, true},
+		{"pod CIDR too small", []string{"10.2.0.0/25"}, []string{"10.3.0.0/24"}, nil, true},
+		{"service CIDR too small", []string{"10.2.0.0/16"}, []string{"10.3.0.0/29"}, nil, true},
+		{"IPv6 service CIDR too large", []string{"fd00:2::/56"}, []string{"fd00:3::/64"}, nil, true},
+		{"same family dual-stack", []string{"10.2.0.0/16", "10.4.0.0/16"}, []string{"10.3.0.0/24", "10.5.0.0/24"}, nil, true},
+		{"node in pod CIDR", []string{"10.2.0.0/16"}, []string{"10.3.0.0/24"}, []string{"10.2.0.5"}, true},
+		{"node in service CIDR", []string{"10.2.0.0/16"}, []string{"10.3.0.0/24"}, []string{"10.3.0.5"}, true},
+	}
+
+	parse := func(cidrs []string) []*net.IPNet {
+		var nets []*net.IPNet
+		for _, c := range cidrs {
+			_, n, err := net.ParseCIDR(c)
+			if err != nil {
+				t.Fatalf("unexpected CIDR parse error: %v", err)
+			}
+			nets = append(nets, n)
+		}
+		return nets
+	}
+
+	for _, c := range cases {
+		var nodeIPs []net.IP
+		for _, ip := range c.nodeIPs {
+			nodeIPs = append(nodeIPs, net.ParseIP(ip))
+		}
+		err := validateCIDRs(parse(c.podCIDRs), parse(c.svcCIDRs), nodeIPs)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: validateCIDRs() = %v, want error: %t", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestParseDNSServiceIPs(t *testing.T) {
+	var serviceNets []*net.IPNet
+	for _, c := range []string{"10.3.0.0/24", "fd00:3::/112"} {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serviceNets = append(serviceNets, n)
+	}
+	apiServiceIPs := []net.IP{net.ParseIP("10.3.0.1"), net.ParseIP("fd00:3::1")}
+
+	for _, c := range []struct {
+		ips     string
+		nets    int
+		wantErr bool
+	}{
+		{"10.3.0.53", 1, false},
+		{"10.3.0.53,fd00:3::53", 2, false},
+		{"10.3.0.53", 2, true},
+		{"10.4.0.53", 1, true},
+		{"10.3.0.0", 1, true},
+		{"10.3.0.255", 1, true},
+		{"10.3.0.1", 1, true},
+		{"10.3.0", 1, true},
+		{"10.3.0.53,fd00:3::1", 2, true},
+	} {
+		ips, err := parseDNSServiceIPs(c.ips, serviceNets[:c.nets], apiServiceIPs)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseDNSServiceIPs(%q) = %v, want error: %t", c.ips, err, c.wantErr)
+		}
+		if err == nil && ips[0].String() != "10.3.0.53" {
+			t.Errorf("parseDNSServiceIPs(%q) = %v", c.ips, ips)
+		}
+	}
+}
+
+func TestValidateHeaderList(t *testing.T) {
+	for _, tc := range []struct {
+		list    string
+		wantErr bool
+	}{
+		{list: "front-proxy-client"},
+		{list: "front-proxy-client,aggregator"},
+		{list: "", wantErr: true},
+		{list: "a,,b", wantErr: true},
+		{list: "X-Remote User", wantErr: true},
+	} {
+		if err := validateHeaderList(tc.list); (err != nil) != tc.wantErr {
+			t.Errorf("validateHeaderList(%q) = %v, want error: %t", tc.list, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateExternalDNS(t *testing.T) {
+	cases := []struct {
+		name                   string
+		provider, zone, target string
+		apiServer              string
+		wantErr                bool
+	}{
+		{"disabled", "", "", "", "https://127.0.0.1:6443", false},
+		{"enabled", "aws", "example.com", "10.0.0.100", "https://api.k8s.example.com:6443", false},
+		{"zone apex", "aws", "example.com.", "lb.example.net", "https://example.com", false},
+		{"zone without provider", "", "example.com", "", "https://api.example.com", true},
+		{"missing target", "aws", "example.com", "", "https://api.example.com", true},
+		{"IP apiserver", "aws", "example.com", "10.0.0.100", "https://10.0.0.1:6443", true},
+		{"outside zone", "aws", "example.com", "10.0.0.100", "https://api.notexample.com", true},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.apiServer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateExternalDNS(c.provider, c.zone, c.target, u)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: validateExternalDNS() = %v, want error: %t", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestValidateImageRepository(t *testing.T) {
+	for repository, valid := range map[string]bool{
+		"":                           true,
+		"registry.internal":          true,
+		"registry.internal/k8s/":     true,
+		"registry.internal:5000/k8s": true,
+		"https://registry.internal":  false,
+		"registry.internal//k8s":     false,
+		"registry.internal/k8s:v1":   false,
+		"registry.internal/k 8s":     false,
+	} {
+		if err := validateImageRepository(repository); (err == nil) != valid {
+			t.Errorf("validateImageRepository(%q) = %v, want valid: %t", repository, err, valid)
+		}
+	}
+}
+
+func TestValidateOIDC(t *testing.T) {
+	cases := []struct {
+		name                                   string
+		issuer, clientID, usernameClaim, group string
+		caFile                                 string
+		wantErr                                bool
+	}{
+		{"disabled", "", "", "", "", "", false},
+		{"enabled", "https://accounts.example.com", "kubernetes", "email", "groups", "/etc/oidc/ca.crt", false},
+		{"client ID without issuer", "", "kubernetes", "", "", "", true},
+		{"CA without issuer", "", "", "", "", "/etc/oidc/ca.crt", true},
+		{"http issuer", "http://accounts.example.com", "kubernetes", "", "", "", true},
+		{"missing client ID", "https://accounts.example.com", "", "", "", "", true},
+		{"invalid claim", "https://accounts.example.com", "kubernetes", "user name", "", "", true},
+	}
+	for _, c := range cases {
+		err := validateOIDC(c.issuer, c.clientID, c.usernameClaim, c.group, c.caFile)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: validateOIDC() = %v, want error: %t", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootkube-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "policy.yaml")
+	if err := ioutil.WriteFile(p, []byte("apiVersion: audit.k8s.io/v1\nkind: Policy\nrules:\n- level: Metadata\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfigFile(p, "Policy"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := readConfigFile(p, "Config"); err == nil {
+		t.Error("expected error for the wrong kind")
+	}
+	if _, err := readConfigFile(filepath.Join(dir, "missing.yaml"), "Policy"); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestApplyRenderConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootkube-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := `flags:
+  network-provider: calico
+  pod-cidr: 10.2.0.0/16
+  dns-autoscaler: false
+  api-servers: [https://10.0.0.1:6443, https://10.0.0.2:6443]
+images:
+  Hyperkube: k8s.gcr.io/hyperkube:v1.16.2
+overlays:
+  prod:
+    flags:
+      pod-cidr: 10.10.0.0/16
+      dns-autoscaler: true
+    images:
+      Hyperkube: registry.example.com/hyperkube:v1.16.2
+  dev:
+    flags:
+      network-provider: flannel
+`
+	p := filepath.Join(dir, "bootkube.yaml")
+	if err := ioutil.WriteFile(p, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newFlags := func(args ...string) (*flag.FlagSet, map[string]*string) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		values := map[string]*string{}
+		for _, name := range []string{"network-provider", "pod-cidr", "dns-autoscaler", "api-servers"} {
+			values[name] = fs.String(name, "", "")
+		}
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return fs, values
+	}
+
+	fs, values := newFlags("--network-provider=cilium")
+	var images asset.ImageVersions
+	if err := applyRenderConfig(fs, &images, nil, p, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"network-provider": "cilium",
+		"pod-cidr":         "10.10.0.0/16",
+		"dns-autoscaler":   "true",
+		"api-servers":      "https://10.0.0.1:6443,https://10.0.0.2:6443",
+	} {
+		if got := *values[name]; got != want {
+			t.Errorf("--%s: got %q, want: %q", name, got, want)
+		}
+	}
+	if want := "registry.example.com/hyperkube:v1.16.2"; images.Hyperkube != want {
+		t.Errorf("Hyperkube image: got %q, want: %q", images.Hyperkube, want)
+	}
+
+	fs, values = newFlags()
+	if err := applyRenderConfig(fs, &images, nil, p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := *values["pod-cidr"]; got != "10.2.0.0/16" {
+		t.Errorf("--pod-cidr without environment: got %q, want: 10.2.0.0/16", got)
+	}
+
+	fs, _ = newFlags()
+	if err := applyRenderConfig(fs, &images, nil, p, "staging"); err == nil || !strings.Contains(err.Error(), "dev, prod") {
+		t.Errorf("expected error listing the environments, got: %v", err)
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	for _, c := range []string{"flags:\n  no-such-flag: x\n", "images:\n  NoSuchImage: x\n", "flag:\n  pod-cidr: x\n"} {
+		if err := ioutil.WriteFile(bad, []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fs, _ = newFlags()
+		if err := applyRenderConfig(fs, &images, nil, bad, ""); err == nil {
+			t.Errorf("expected error for config %q", c)
+		}
+	}
+}
+
+func TestRenderConfigResources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootkube-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := `resources:
+  kube-apiserver:
+    requests: {cpu: 250m, memory: 512Mi}
+  pod-checkpointer:
+    limits: {memory: 50Mi}
+overlays:
+  edge:
+    resources:
+      kube-apiserver:
+        requests: {cpu: 100m}
+        limits: {memory: 256Mi}
+`
+	p := filepath.Join(dir, "bootkube.yaml")
+	if err := ioutil.WriteFile(p, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var images asset.ImageVersions
+	resources := map[string]asset.ResourceRequirements{}
+	if err := applyRenderConfig(flag.NewFlagSet("test", flag.ContinueOnError), &images, resources, p, "edge"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]asset.ResourceRequirements{
+		asset.ComponentAPIServer: {
+			Requests: map[string]string{"cpu": "100m"},
+			Limits:   map[string]string{"memory": "256Mi"},
+		},
+		asset.ComponentCheckpointer: {Limits: map[string]string{"memory": "50Mi"}},
+	}
+	if !reflect.DeepEqual(resources, want) {
+		t.Errorf("got resources %v, want: %v", resources, want)
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	for _, c := range []string{
+		"resources:\n  etcd:\n    limits: {cpu: 1}\n",
+		"resources:\n  kube-scheduler:\n    requests: {cpu: lots}\n",
+		"resources:\n  kube-scheduler:\n    requests: {memory: 1Gi}\n    limits: {memory: 512Mi}\n",
+	} {
+		if err := ioutil.WriteFile(bad, []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyRenderConfig(flag.NewFlagSet("test", flag.ContinueOnError), &images, map[string]asset.ResourceRequirements{}, bad, ""); err == nil {
+			t.Errorf("expected error for config %q", c)
+		}
+	}
+}
+
+func TestParseKubeletSettings(t *testing.T) {
+	cases := []struct {
+		name    string
+		parse   func(string) (map[string]string, error)
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", parseEvictionThresholds, "", nil, false},
+		{"thresholds", parseEvictionThresholds, "memory.available<100Mi, nodefs.available<10%", map[string]string{"memory.available": "100Mi", "nodefs.available": "10%"}, false},
+		{"unknown signal", parseEvictionThresholds, "memory.free<100Mi", nil, true},
+		{"bad percentage", parseEvictionThresholds, "nodefs.available<110%", nil, true},
+		{"bad quantity", parseEvictionThresholds, "memory.available<lots", nil, true},
+		{"missing operator", parseEvictionThresholds, "memory.available=100Mi", nil, true},
+		{"duplicate", parseEvictionThresholds, "memory.available<100Mi,memory.available<1Gi", nil, true},
+		{"grace periods", parseEvictionGracePeriods, "memory.available=1m30s", map[string]string{"memory.available": "1m30s"}, false},
+		{"bad grace period", parseEvictionGracePeriods, "memory.available=90", nil, true},
+		{"reserved", parseReservedResources, "cpu=100m,memory=256Mi", map[string]string{"cpu": "100m", "memory": "256Mi"}, false},
+		{"unknown resource", parseReservedResources, "gpu=1", nil, true},
+	}
+	for _, c := range cases {
+		got, err := c.parse(c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", c.name, err, c.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want: %v", c.name, got, c.want)
+		}
+	}
+
+	if err := validateSoftEviction(map[string]string{"memory.available": "500Mi"}, nil); err == nil {
+		t.Error("validateSoftEviction() without grace period = nil, want error")
+	}
+	if err := validateSoftEviction(map[string]string{"memory.available": "500Mi"}, map[string]string{"memory.available": "1m"}); err != nil {
+		t.Errorf("validateSoftEviction() = %v, want: nil", err)
+	}
+}
+
+func TestParseFeatureGates(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    asset.FeatureGates
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"EphemeralContainers=true, CSIMigration=false", asset.FeatureGates{"EphemeralContainers": true, "CSIMigration": false}, false},
+		{"EphemeralContainers=yes", nil, true},
+		{"EphemeralContainers", nil, true},
+		{"CSIMigration=true,CSIMigration=false", nil, true},
+	}
+	for _, c := range cases {
+		got, err := parseFeatureGates(c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseFeatureGates(%q): got error %v, want error: %t", c.value, err, c.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseFeatureGates(%q) = %v, want: %v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestParseNodeSelector(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"node-role.kubernetes.io/master=, pool=control", map[string]string{"node-role.kubernetes.io/master": "", "pool": "control"}, false},
+		{"pool", nil, true},
+		{"=control", nil, true},
+		{"pool=control plane", nil, true},
+		{"pool=a,pool=b", nil, true},
+	}
+	for _, c := range cases {
+		got, err := parseNodeSelector(c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseNodeSelector(%q): got error %v, want error: %t", c.value, err, c.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseNodeSelector(%q) = %v, want: %v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestParseTolerations(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    []corev1.Toleration
+		wantErr bool
+	}{
+		{"", []corev1.Toleration{}, false},
+		{"node-role.kubernetes.io/master:NoSchedule, dedicated=control", []corev1.Toleration{
+			{Key: "node-role.kubernetes.io/master", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+			{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "control"},
+		}, false},
+		{"dedicated=control:NoExecute", []corev1.Toleration{
+			{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "control", Effect: corev1.TaintEffectNoExecute},
+		}, false},
+		{":NoSchedule", []corev1.Toleration{{Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}, false},
+		{"dedicated:NoWay", nil, true},
+		{"=control:NoSchedule", nil, true},
+		{"dedicated=control plane", nil, true},
+		{"not a key", nil, true},
+	}
+	for _, c := range cases {
+		got, err := parseTolerations(c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseTolerations(%q): got error %v, want error: %t", c.value, err, c.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseTolerations(%q) = %v, want: %v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestExtraFlags(t *testing.T) {
+	var f extraFlags
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&f, "apiserver-extra-flags", "")
+	if err := fs.Parse([]string{"--apiserver-extra-flags=profiling=false", "--apiserver-extra-flags=--tls-cipher-suites=a,b"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (extraFlags{"profiling": "false", "tls-cipher-suites": "a,b"}); !reflect.DeepEqual(f, want) {
+		t.Errorf("got %v, want: %v", f, want)
+	}
+	for _, v := range []string{"profiling", "=false", "profiling=true"} {
+		if err := f.Set(v); err == nil {
+			t.Errorf("Set(%q) = nil, want error", v)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "bootkube-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "bootkube.yaml")
+	config := "flags:\n  scheduler-extra-flags: [profiling=false, v=4]\n"
+	if err := ioutil.WriteFile(p, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var scheduler extraFlags
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&scheduler, "scheduler-extra-flags", "")
+	var images asset.ImageVersions
+	if err := applyRenderConfig(fs, &images, nil, p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if want := (extraFlags{"profiling": "false", "v": "4"}); !reflect.DeepEqual(scheduler, want) {
+		t.Errorf("config file: got %v, want: %v", scheduler, want)
+	}
+}
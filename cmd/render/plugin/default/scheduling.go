@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// parseNodeSelector parses a comma separated list of node labels, e.g.
+// 'node-role.kubernetes.io/master=,pool=control'. Label values may be empty. An empty list
+// selects all nodes.
+func parseNodeSelector(s string) (map[string]string, error) {
+	selector := map[string]string{}
+	if s == "" {
+		return selector, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid value %q, want: key=value", kv)
+		}
+		key, value := parts[0], parts[1]
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label value %q of %s: %s", value, key, strings.Join(errs, ", "))
+		}
+		if _, ok := selector[key]; ok {
+			return nil, fmt.Errorf("%s is set more than once", key)
+		}
+		selector[key] = value
+	}
+	return selector, nil
+}
+
+// parseTolerations parses a comma separated list of tolerations in the taint syntax of kubectl,
+// key[=value][:effect], e.g. 'node-role.kubernetes.io/master:NoSchedule,dedicated=control'.
+// Without a value any value of the taint is tolerated, without an effect any effect, and an
+// empty key with an effect tolerates all taints of that effect. An empty list tolerates no taints.
+func parseTolerations(s string) ([]corev1.Toleration, error) {
+	tolerations := []corev1.Toleration{}
+	if s == "" {
+		return tolerations, nil
+	}
+	for _, spec := range strings.Split(s, ",") {
+		t := strings.TrimSpace(spec)
+		var toleration corev1.Toleration
+		if i := strings.LastIndex(t, ":"); i >= 0 {
+			switch effect := corev1.TaintEffect(t[i+1:]); effect {
+			case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+				toleration.Effect = effect
+			default:
+				return nil, fmt.Errorf("invalid effect %q of toleration %q, want: NoSchedule, PreferNoSchedule or NoExecute", effect, spec)
+			}
+			t = t[:i]
+		}
+		toleration.Operator = corev1.TolerationOpExists
+		if i := strings.Index(t, "="); i >= 0 {
+			toleration.Operator = corev1.TolerationOpEqual
+			toleration.Value = t[i+1:]
+			t = t[:i]
+			if errs := validation.IsValidLabelValue(toleration.Value); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid toleration value %q of %s: %s", toleration.Value, t, strings.Join(errs, ", "))
+			}
+		}
+		toleration.Key = t
+		if toleration.Key == "" {
+			if toleration.Effect == "" || toleration.Operator == corev1.TolerationOpEqual {
+				return nil, fmt.Errorf("invalid toleration %q, want: key[=value][:effect]", spec)
+			}
+		} else if errs := validation.IsQualifiedName(toleration.Key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid toleration key %q: %s", toleration.Key, strings.Join(errs, ", "))
+		}
+		tolerations = append(tolerations, toleration)
+	}
+	return tolerations, nil
+}
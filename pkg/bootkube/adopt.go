@@ -0,0 +1,93 @@
+package bootkube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// adoptProbeTimeout bounds the probe of the cluster in adopt mode, when there is usually no
+// apiserver at all yet.
+const adoptProbeTimeout = 10 * time.Second
+
+// adoptCluster probes the cluster with the admin kubeconfig of the asset directory and, if it is
+// already healthy, creates the assets that are missing instead of bootstrapping it. It reports
+// whether the cluster was adopted.
+func (b *bootkube) adoptCluster(ctx context.Context, skip func(manifest) bool) (bool, error) {
+	kubeConfigPath := filepath.Join(b.assetDir, asset.AssetPathAdminKubeConfig)
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+		&clientcmd.ConfigOverrides{})
+	config, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return false, err
+	}
+	config.Timeout = adoptProbeTimeout
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return false, err
+	}
+	selfHosted := !IsStaticControlPlane(b.assetDir) && !b.noPivot
+	if err := clusterHealthy(ctx, client, ControlPlaneNamespace(b.assetDir), selfHosted); err != nil {
+		UserOutput("Not adopting the cluster, starting the bootstrap control plane: %v\n", err)
+		return false, nil
+	}
+	UserOutput("The cluster is already healthy, adopting it and only creating the missing assets\n")
+	b.kubeConfigPath = kubeConfigPath
+
+	if err := createAssets(ctx, kubeConfig, filepath.Join(b.assetDir, asset.AssetPathManifests), createOptions{
+		apiServerTimeout: b.apiServerTimeout,
+		assetTimeout:     b.assetTimeout,
+		retry:            b.retry,
+		strict:           b.strict,
+		skipExisting:     true,
+		skip:             skip,
+		progress:         b.progress,
+		parallelism:      b.parallelism,
+		allowUpdate:      b.allowUpdate,
+		prune:            b.prune,
+	}); err != nil {
+		return true, err
+	}
+
+	podsCtx, cancel := context.WithTimeout(ctx, b.pivotTimeout)
+	defer cancel()
+	b.progress.setPhase(phaseWaitingForPods)
+	if err := WaitUntilPodsRunning(podsCtx, kubeConfig, b.requiredPods); err != nil {
+		return true, err
+	}
+	if err := b.recordHistory(kubeConfig); err != nil {
+		UserWarning("failed to record bootkube history: %v\n", err)
+	}
+	return true, nil
+}
+
+// clusterHealthy returns an error unless the apiserver is healthy and, for a self-hosted control
+// plane, a self-hosted apiserver pod of namespace is ready.
+func clusterHealthy(ctx context.Context, client kubernetes.Interface, namespace string, selfHosted bool) error {
+	b, err := client.Discovery().RESTClient().Get().AbsPath("/healthz").DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("the apiserver isn't healthy: %v", err)
+	}
+	if s := strings.TrimSpace(string(b)); s != "ok" {
+		return fmt.Errorf("the apiserver isn't healthy: %s", s)
+	}
+	if !selfHosted {
+		return nil
+	}
+	ready, err := selfHostedAPIServerReady(ctx, client, nil, namespace)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return errors.New("the self-hosted control plane isn't running")
+	}
+	return nil
+}
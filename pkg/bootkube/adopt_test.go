@@ -0,0 +1,55 @@
+package bootkube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestClusterHealthy(t *testing.T) {
+	var healthz, pods string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			if healthz != "ok" {
+				http.Error(w, healthz, http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, healthz)
+		case "/api/v1/namespaces/kube-system/pods":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"kind":"PodList","apiVersion":"v1","items":[%s]}`, pods)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyPod := `{"metadata":{"name":"kube-apiserver-abcde"},"status":{"phase":"Running","conditions":[{"type":"Ready","status":"True"}]}}`
+
+	for _, tc := range []struct {
+		healthz, pods string
+		selfHosted    bool
+		wantErr       string
+	}{
+		{"ok", readyPod, true, ""},
+		{"ok", "", false, ""},
+		{"ok", "", true, "self-hosted control plane isn't running"},
+		{"[-]etcd failed", readyPod, true, "apiserver isn't healthy"},
+	} {
+		healthz, pods = tc.healthz, tc.pods
+		err := clusterHealthy(context.Background(), client, "kube-system", tc.selfHosted)
+		if (err == nil) != (tc.wantErr == "") || err != nil && !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("clusterHealthy() with healthz %q and self-hosted %t = %v, want an error containing %q", tc.healthz, tc.selfHosted, err, tc.wantErr)
+		}
+	}
+}
@@ -1,60 +1,349 @@
 package bootkube
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/version"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-const assetTimeout = 20 * time.Minute
+// DefaultPhaseTimeout is the default timeout of each phase of bootkube start.
+const DefaultPhaseTimeout = 20 * time.Minute
 
 type Config struct {
 	AssetDir        string
 	PodManifestPath string
-	Strict          bool
-	RequiredPods    []string
+	// PodManifestPrefix is prepended to the file names of the static manifests bootkube start
+	// copies to PodManifestPath.
+	PodManifestPrefix string
+	Strict            bool
+	RequiredPods      []string
+	// NoPivot keeps the bootstrap control plane as the permanent control plane instead of
+	// pivoting to the self-hosted one.
+	NoPivot bool
+	// VerifyAssets checks the asset directory against its checksums before bootstrapping, and
+	// their signature by the public key at VerifyKeyPath if set.
+	VerifyAssets  bool
+	VerifyKeyPath string
+	// Timeout bounds bootkube start as a whole, zero for no bound. Each phase is also bounded by
+	// its own timeout: APIServerTimeout for the bootstrap apiserver to become ready, AssetTimeout
+	// for creating the assets and PivotTimeout for the required pods to run and the pivot to the
+	// self-hosted control plane. Zero phase timeouts default to DefaultPhaseTimeout.
+	Timeout          time.Duration
+	APIServerTimeout time.Duration
+	AssetTimeout     time.Duration
+	PivotTimeout     time.Duration
+	// Retry is how failed requests to the apiserver are retried while creating the assets. A
+	// zero backoff defaults to the one of DefaultRetryPolicy.
+	Retry RetryPolicy
+	// StatusAddress, if set, is the address bootkube start serves /healthz and the Prometheus
+	// /metrics of its progress on.
+	StatusAddress string
+	// Progress, if set, receives the progress events of bootkube start as newline delimited
+	// JSON.
+	Progress io.Writer
+	// Parallelism is how many manifests are created at once, DefaultParallelism if zero.
+	Parallelism int
+	// AllowUpdate server-side applies the manifests instead of creating them, so that objects
+	// which already exist are updated to match their manifest.
+	AllowUpdate bool
+	// Prune deletes the objects bootkube created from the asset directory whose manifest was
+	// removed from it since.
+	Prune bool
+	// Adopt probes the cluster first and, if it is already healthy, only creates the assets that
+	// are missing instead of starting a bootstrap control plane.
+	Adopt bool
+	// Etcd, if set, is checked to meet EtcdHealth before the bootstrap control plane is torn
+	// down, so that it doesn't pivot onto a degraded self-hosted etcd.
+	Etcd       EtcdClient
+	EtcdHealth EtcdHealth
+	// WriteAdminKubeConfig writes the admin kubeconfig of the bootstrapped cluster to
+	// AssetPathFinalAdminKubeConfig of the asset directory, with the certificates embedded if
+	// AdminKubeConfigEmbedCerts.
+	WriteAdminKubeConfig      bool
+	AdminKubeConfigEmbedCerts bool
 }
 
 type bootkube struct {
-	podManifestPath string
-	assetDir        string
-	strict          bool
-	requiredPods    []string
+	podManifestPath   string
+	podManifestPrefix string
+	assetDir          string
+	strict            bool
+	requiredPods      []string
+	noPivot           bool
+	verifyAssets      bool
+	verifyKeyPath     string
+
+	timeout          time.Duration
+	apiServerTimeout time.Duration
+	assetTimeout     time.Duration
+	pivotTimeout     time.Duration
+	retry            RetryPolicy
+	statusAddress    string
+	parallelism      int
+	allowUpdate      bool
+	prune            bool
+	adopt            bool
+	etcd             EtcdClient
+	etcdHealth       EtcdHealth
+	adminKubeConfig  bool
+	embedCerts       bool
+	// kubeConfigPath is the kubeconfig bootkube start talks to the cluster with.
+	kubeConfigPath string
+
+	progress *progress
 }
 
 func NewBootkube(config Config) (*bootkube, error) {
+	for _, t := range []*time.Duration{&config.APIServerTimeout, &config.AssetTimeout, &config.PivotTimeout} {
+		if *t == 0 {
+			*t = DefaultPhaseTimeout
+		}
+	}
+	if config.Parallelism == 0 {
+		config.Parallelism = DefaultParallelism
+	}
+	if config.Retry.Backoff == 0 {
+		config.Retry.Backoff = DefaultRetryPolicy.Backoff
+	}
 	return &bootkube{
-		assetDir:        config.AssetDir,
-		podManifestPath: config.PodManifestPath,
-		strict:          config.Strict,
-		requiredPods:    config.RequiredPods,
+		assetDir:          config.AssetDir,
+		podManifestPath:   config.PodManifestPath,
+		podManifestPrefix: config.PodManifestPrefix,
+		strict:            config.Strict,
+		requiredPods:      config.RequiredPods,
+		noPivot:           config.NoPivot,
+		verifyAssets:      config.VerifyAssets,
+		verifyKeyPath:     config.VerifyKeyPath,
+
+		timeout:          config.Timeout,
+		apiServerTimeout: config.APIServerTimeout,
+		assetTimeout:     config.AssetTimeout,
+		pivotTimeout:     config.PivotTimeout,
+		retry:            config.Retry,
+		statusAddress:    config.StatusAddress,
+		parallelism:      config.Parallelism,
+		allowUpdate:      config.AllowUpdate,
+		prune:            config.Prune,
+		adopt:            config.Adopt,
+		etcd:             config.Etcd,
+		etcdHealth:       config.EtcdHealth,
+		adminKubeConfig:  config.WriteAdminKubeConfig,
+		embedCerts:       config.AdminKubeConfigEmbedCerts,
+		progress:         newProgress(config.Progress),
 	}, nil
 }
 
 func (b *bootkube) Run() error {
+	stopWatchdog := startWatchdog()
+	defer stopWatchdog()
+
+	if b.statusAddress != "" {
+		stop, err := serveStatus(b.statusAddress, b.progress)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	ctx, interrupted, stopInterrupt := interruptContext(context.Background())
+	defer stopInterrupt()
+	err := b.run(ctx)
+	if err == errBootstrapLeaseHeld {
+		// The bootstrap control plane is torn down, wait for the other node and adopt the
+		// cluster it bootstrapped.
+		UserOutput("Another node took the bootstrap lease first, adopting the cluster it bootstraps\n")
+		b.adopt = true
+		err = b.run(ctx)
+	}
+	sig := interrupted()
+	if sig != nil && err != nil {
+		phase := b.progress.currentPhase()
+		err = fmt.Errorf("interrupted by %v while %s: %v", sig, phase, err)
+		if werr := writeInterrupted(b.assetDir, sig, phase); werr != nil {
+			UserWarning("failed to leave the interruption marker: %v\n", werr)
+		} else {
+			UserOutput("Left %s in %s, run bootkube start again to resume\n", AssetPathInterrupted, b.assetDir)
+		}
+	}
+	if err == nil {
+		if rerr := os.Remove(filepath.Join(b.assetDir, AssetPathInterrupted)); rerr != nil && !os.IsNotExist(rerr) {
+			UserWarning("failed to remove the interruption marker: %v\n", rerr)
+		}
+	}
+	if err == nil && b.adminKubeConfig {
+		if err = writeAdminKubeConfig(b.assetDir, b.embedCerts); err != nil {
+			err = fmt.Errorf("failed to write the admin kubeconfig: %v", err)
+		}
+	}
+	if err != nil {
+		b.progress.fail(err)
+	} else {
+		b.progress.setPhase(phaseDone)
+	}
+	// An interrupted bootkube start exits right away rather than waiting on an apiserver which
+	// is going away.
+	if sig == nil {
+		b.recordBootstrap(err)
+	}
+	return err
+}
+
+func (b *bootkube) run(parent context.Context) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if b.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, b.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+
+	if b.verifyAssets {
+		if err := VerifyAssets(b.assetDir, b.verifyKeyPath); err != nil {
+			return fmt.Errorf("refusing to start from %s: %v", b.assetDir, err)
+		}
+		UserOutput("Verified the checksums of %s\n", b.assetDir)
+	}
+
+	// The assets an interrupted bootkube start created before it was stopped already exist. The
+	// marker isn't covered by the asset checksums, so it isn't trusted with --verify-assets.
+	var resume *interruption
+	if b.verifyAssets {
+		if _, err := os.Stat(filepath.Join(b.assetDir, AssetPathInterrupted)); err == nil {
+			UserWarning("Not resuming from %s, which --verify-assets can't verify\n", AssetPathInterrupted)
+		}
+	} else {
+		var ierr error
+		if resume, ierr = readInterrupted(b.assetDir); ierr != nil {
+			return fmt.Errorf("failed to read %s: %v", AssetPathInterrupted, ierr)
+		}
+	}
+	if resume != nil {
+		UserOutput("Resuming the bootkube start interrupted by %s while %s at %s\n", resume.Signal, resume.Phase, resume.Time.Format(time.RFC3339))
+	}
+
+	// Only one bootkube start bootstraps the cluster at a time, on the node and, once an
+	// apiserver is reachable, in the cluster. The others adopt the cluster once it's done.
+	unlock, waited, lerr := lockLocal(ctx, lockFilePath)
+	if lerr != nil {
+		return fmt.Errorf("failed to lock %s: %v", lockFilePath, lerr)
+	}
+	defer unlock()
+	// Masters rendered to bootstrap at once don't wait for each other, they pivot one at a time.
+	var lease *bootstrapLease
+	if masters, _ := readBootstrapMasters(b.assetDir); len(masters) == 0 {
+		if lease, lerr = newBootstrapLease(b.assetDir, b.leaseDuration()); lerr != nil {
+			return fmt.Errorf("failed to create the bootstrap lease: %v", lerr)
+		}
+		defer lease.release()
+		leaseWaited, lerr := lease.acquire(ctx)
+		if lerr != nil {
+			return fmt.Errorf("failed to acquire the bootstrap lease: %v", lerr)
+		}
+		waited = waited || leaseWaited
+	}
+
+	namespace := ControlPlaneNamespace(b.assetDir)
+	var skip func(manifest) bool
+	if b.noPivot {
+		skip = func(m manifest) bool { return isSelfHostedControlPlane(m, namespace) }
+	}
+	if b.adopt || waited {
+		if adopted, err := b.adoptCluster(ctx, skip); adopted || err != nil {
+			return err
+		}
+	}
+
 	// TODO(diegs): create and share a single client rather than the kubeconfig once all uses of it
 	// are migrated to client-go.
+	kubeConfigPath := startKubeConfigPath(b.assetDir)
+	b.kubeConfigPath = kubeConfigPath
+	if err := checkKubeConfigExpiry(kubeConfigPath); err != nil {
+		return err
+	}
 	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: filepath.Join(b.assetDir, asset.AssetPathAdminKubeConfig)},
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
 		&clientcmd.ConfigOverrides{})
 
 	bcp := NewBootstrapControlPlane(b.assetDir, b.podManifestPath)
+	bcp.static = IsStaticControlPlane(b.assetDir)
+	bcp.manifestPrefix = b.podManifestPrefix
+	if b.noPivot && !bcp.static {
+		// The bootstrap control plane is permanent, so it can't use the short-lived credential.
+		bcp.kubeConfigPath = filepath.Join(b.assetDir, asset.AssetPathAdminKubeConfig)
+	}
+
+	// Masters bootstrapping at once pivot one at a time, so that the others keep serving.
+	var master net.IP
+	if !bcp.static && !b.noPivot {
+		masters, err := readBootstrapMasters(b.assetDir)
+		if err != nil {
+			return err
+		}
+		if len(masters) > 0 {
+			addrs, err := net.InterfaceAddrs()
+			if err != nil {
+				return err
+			}
+			if master, err = localBootstrapMaster(masters, addrs); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A previous bootkube start may have died after the pivot, with nothing left to do.
+	if !bcp.static && !b.noPivot && !bcp.running() && b.pivoted(kubeConfig, master, namespace) {
+		UserOutput("The self-hosted control plane is already running, a previous bootkube start completed the pivot\n")
+		b.progress.event(progressEvent{Event: eventPivotCompleted})
+		if err := b.recordHistory(kubeConfig); err != nil {
+			UserWarning("failed to record bootkube history: %v\n", err)
+		}
+		return nil
+	}
 
+	var err error
 	defer func() {
-		// Always tear down the bootstrap control plane and clean up manifests and secrets.
+		// A static control plane, and the bootstrap control plane in no-pivot mode, are
+		// permanent, so they are only torn down if bootstrapping failed.
+		if bcp.static && err == nil {
+			UserOutput("Keeping static control plane in %s\n", b.podManifestPath)
+			return
+		}
+		if b.noPivot && err == nil {
+			UserOutput("Keeping bootstrap control plane in %s as the permanent control plane\n", b.podManifestPath)
+			return
+		}
+		// Always tear down the bootstrap control plane and clean up manifests and secrets. After
+		// bootstrapping succeeded, this completes the pivot to the self-hosted control plane.
+		if err == nil {
+			b.progress.setPhase(phasePivoting)
+		}
 		if err := bcp.Teardown(); err != nil {
-			UserOutput("Error tearing down temporary bootstrap control plane: %v\n", err)
+			UserError("failed to tear down the temporary bootstrap control plane: %v\n", err)
+			return
+		}
+		if err == nil {
+			b.progress.event(progressEvent{Event: eventPivotCompleted})
 		}
 	}()
 
-	var err error
 	defer func() {
-		// Always report errors.
-		if err != nil {
-			UserOutput("Error: %v\n", err)
+		// Always report errors. Losing the bootstrap lease isn't one, the cluster is adopted.
+		if err != nil && err != errBootstrapLeaseHeld {
+			UserError("%v\n", err)
 		}
 	}()
 
@@ -62,21 +351,182 @@ func (b *bootkube) Run() error {
 		return err
 	}
 
-	if err = CreateAssets(kubeConfig, filepath.Join(b.assetDir, asset.AssetPathManifests), assetTimeout, b.strict); err != nil {
+	if err = createAssets(ctx, kubeConfig, filepath.Join(b.assetDir, asset.AssetPathManifests), createOptions{
+		apiServerTimeout: b.apiServerTimeout,
+		assetTimeout:     b.assetTimeout,
+		retry:            b.retry,
+		strict:           b.strict,
+		skipExisting:     master != nil || bcp.resumed || resume != nil,
+		skip:             skip,
+		progress:         b.progress,
+		parallelism:      b.parallelism,
+		allowUpdate:      b.allowUpdate,
+		prune:            b.prune,
+		apiServerReady: func() error {
+			if lease == nil {
+				return nil
+			}
+			return lease.acquireOnce(ctx)
+		},
+	}); err != nil {
 		return err
 	}
 
-	if err = WaitUntilPodsRunning(kubeConfig, b.requiredPods, assetTimeout); err != nil {
+	pivotCtx, cancelPivot := context.WithTimeout(ctx, b.pivotTimeout)
+	defer cancelPivot()
+	b.progress.setPhase(phaseWaitingForPods)
+	if err = WaitUntilPodsRunning(pivotCtx, kubeConfig, b.requiredPods); err != nil {
 		return err
 	}
+	if b.etcd != nil && !bcp.static && !b.noPivot {
+		if err = waitForEtcdHealthy(pivotCtx, b.etcd, b.etcdHealth); err != nil {
+			return err
+		}
+	}
+
+	if master != nil {
+		b.progress.setPhase(phasePivoting)
+		if err = b.pivot(pivotCtx, kubeConfig, bcp, master, namespace); err != nil {
+			return err
+		}
+	}
+
+	// Recording history is best effort, the cluster is already up at this point.
+	if err := b.recordHistory(kubeConfig); err != nil {
+		UserWarning("failed to record bootkube history: %v\n", err)
+	}
+
+	return nil
+}
+
+// leaseDuration returns how long the bootstrap lease is held, as long as bootkube start may take.
+func (b *bootkube) leaseDuration() time.Duration {
+	if b.timeout > 0 {
+		return b.timeout
+	}
+	return b.apiServerTimeout + b.assetTimeout + b.pivotTimeout
+}
+
+// IsStaticControlPlane reports whether assetDir was rendered with a static control plane
+// (--self-hosted=false), which bootkube start installs instead of a bootstrap control plane.
+func IsStaticControlPlane(assetDir string) bool {
+	_, err := os.Stat(filepath.Join(assetDir, asset.AssetPathStaticManifests))
+	return err == nil
+}
+
+// startKubeConfigPath returns the kubeconfig used to bootstrap the cluster: the short-lived
+// bootstrap kubeconfig, or the admin kubeconfig for asset directories rendered without one.
+func startKubeConfigPath(assetDir string) string {
+	p := filepath.Join(assetDir, asset.AssetPathBootstrapKubeConfig)
+	if _, err := os.Stat(p); err == nil {
+		return p
+	}
+	return filepath.Join(assetDir, asset.AssetPathAdminKubeConfig)
+}
 
+// checkKubeConfigExpiry returns an error if the client certificate of the current context of the
+// kubeconfig has expired, since bootstrapping would otherwise fail with unhelpful auth errors.
+func checkKubeConfigExpiry(path string) error {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return err
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil
+	}
+	authInfo, ok := config.AuthInfos[context.AuthInfo]
+	if !ok || len(authInfo.ClientCertificateData) == 0 {
+		return nil
+	}
+	block, _ := pem.Decode(authInfo.ClientCertificateData)
+	if block == nil {
+		return fmt.Errorf("%s: failed to decode client certificate", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return fmt.Errorf("the credential in %s expired at %s, re-render the assets with bootkube render", path, cert.NotAfter.Format(time.RFC3339))
+	}
 	return nil
 }
 
-// All bootkube printing to stdout should go through this fmt.Printf wrapper.
-// The stdout of bootkube should convey information useful to a human sitting
-// at a terminal watching their cluster bootstrap itself. Otherwise the message
-// should go to stderr.
-func UserOutput(format string, a ...interface{}) {
-	fmt.Printf(format, a...)
+// selfHostedControlPlane lists the workloads of the control plane namespace that replace the
+// bootstrap control plane on pivot.
+var selfHostedControlPlane = map[string]bool{
+	"DaemonSet kube-apiserver":                    true,
+	"Deployment kube-controller-manager":          true,
+	"Deployment kube-scheduler":                   true,
+	"DaemonSet pod-checkpointer":                  true,
+	"PodDisruptionBudget kube-apiserver":          true,
+	"PodDisruptionBudget kube-controller-manager": true,
+	"PodDisruptionBudget kube-scheduler":          true,
+}
+
+func isSelfHostedControlPlane(m manifest, namespace string) bool {
+	return m.namespace == namespace && selfHostedControlPlane[m.kind+" "+m.name]
+}
+
+// ControlPlaneNamespace returns the namespace assetDir renders the control plane into, see
+// --control-plane-namespace of the render plugin.
+func ControlPlaneNamespace(assetDir string) string {
+	for _, p := range []string{asset.AssetPathBootstrapAPIServer, asset.AssetPathStaticAPIServer} {
+		b, err := ioutil.ReadFile(filepath.Join(assetDir, p))
+		if err != nil {
+			continue
+		}
+		ms, err := parseManifests(bytes.NewReader(b))
+		if err == nil && len(ms) == 1 && ms[0].namespace != "" {
+			return ms[0].namespace
+		}
+	}
+	return asset.DefaultControlPlaneNamespace
+}
+
+func (b *bootkube) pivot(ctx context.Context, kubeConfig clientcmd.ClientConfig, bcp *bootstrapControlPlane, master net.IP, namespace string) error {
+	config, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	return pivotOneAtATime(ctx, client, bcp, master, namespace)
+}
+
+// pivoted reports whether the self-hosted apiserver of namespace is ready, on the master if this
+// is one of several bootstrap masters.
+func (b *bootkube) pivoted(kubeConfig clientcmd.ClientConfig, master net.IP, namespace string) bool {
+	config, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return false
+	}
+	// Usually there is no apiserver at all yet.
+	config.Timeout = 10 * time.Second
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return false
+	}
+	ready, err := selfHostedAPIServerReady(context.Background(), client, master, namespace)
+	return err == nil && ready
+}
+
+func (b *bootkube) recordHistory(kubeConfig clientcmd.ClientConfig) error {
+	config, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	entry, err := RecordHistory(client, HistoryEntry{Operation: OperationStart, ToVersion: version.Version}, b.assetDir)
+	if err != nil {
+		return err
+	}
+	UserOutput("Recorded bootkube history revision %d\n", entry.Revision)
+	return nil
 }
@@ -1,7 +1,9 @@
 package bootkube
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,7 +14,19 @@ import (
 type bootstrapControlPlane struct {
 	assetDir        string
 	podManifestPath string
-	ownedManifests  []string
+	// manifestPrefix is prepended to the file names of the manifests in podManifestPath, so that
+	// they don't collide with those of other tools using the same kubelet.
+	manifestPrefix string
+	ownedManifests []string
+	// kubeConfigPath is the kubeconfig handed to the bootstrap control plane. Defaults to
+	// startKubeConfigPath(assetDir).
+	kubeConfigPath string
+	// static starts the permanent static control plane of an asset directory rendered with
+	// --self-hosted=false instead, which reads its own kubeconfigs from StaticSecretsDir.
+	static bool
+	// resumed is set by Start if the control plane was already running, started by a previous
+	// bootkube start that died midway.
+	resumed bool
 }
 
 // NewBootstrapControlPlane constructs a new bootstrap control plane object.
@@ -26,32 +40,74 @@ func NewBootstrapControlPlane(assetDir, podManifestPath string) *bootstrapContro
 // Start seeds static manifests to the kubelet to launch the bootstrap control plane.
 // Users should always ensure that Cleanup() is called even in the case of errors.
 func (b *bootstrapControlPlane) Start() error {
-	UserOutput("Starting temporary bootstrap control plane...\n")
-	// Make secrets temporarily available to bootstrap cluster.
-	if err := os.RemoveAll(asset.BootstrapSecretsDir); err != nil {
+	secretsDir, manifestsDir := b.dirs()
+	b.resumed = b.running()
+	if b.resumed {
+		UserOutput("Resuming with the control plane already in %s...\n", b.podManifestPath)
+	} else if b.static {
+		UserOutput("Starting static control plane...\n")
+	} else {
+		UserOutput("Starting temporary bootstrap control plane...\n")
+		// Make secrets temporarily available to bootstrap cluster.
+		if err := os.RemoveAll(secretsDir); err != nil {
+			return err
+		}
+	}
+	if _, err := copyDirectory(filepath.Join(b.assetDir, asset.AssetPathSecrets), secretsDir, true /* overwrite */); err != nil {
 		return err
 	}
-	secretsDir := filepath.Join(b.assetDir, asset.AssetPathSecrets)
-	if _, err := copyDirectory(secretsDir, asset.BootstrapSecretsDir, true /* overwrite */); err != nil {
+	if !b.static {
+		// Copy the kubeconfig. TODO(diegs): this is kind of a hack, maybe do something better.
+		kubeConfigPath := b.kubeConfigPath
+		if kubeConfigPath == "" {
+			kubeConfigPath = startKubeConfigPath(b.assetDir)
+		}
+		if err := copyFile(kubeConfigPath, filepath.Join(secretsDir, "kubeconfig"), true /* overwrite */); err != nil {
+			return err
+		}
+	}
+
+	// Copy the static manifests to the kubelet's pod manifest path. Manifests already copied by a
+	// previous bootkube start are adopted rather than started twice.
+	srcDir := filepath.Join(b.assetDir, manifestsDir)
+	infos, err := ioutil.ReadDir(srcDir)
+	if err != nil {
 		return err
 	}
-	// Copy the admin kubeconfig. TODO(diegs): this is kind of a hack, maybe do something better.
-	if err := copyFile(filepath.Join(b.assetDir, asset.AssetPathAdminKubeConfig), filepath.Join(asset.BootstrapSecretsDir, "kubeconfig"), true /* overwrite */); err != nil {
+	if err := os.Mkdir(b.podManifestPath, os.FileMode(0700)); err != nil && !os.IsExist(err) {
 		return err
 	}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		src, dst := filepath.Join(srcDir, info.Name()), b.manifestPath(info.Name())
+		if !sameFile(src, dst) {
+			if err := copyFile(src, dst, false /* overwrite */); err != nil {
+				return err
+			}
+		}
+		// Recorded one by one in case of partial failure.
+		b.ownedManifests = append(b.ownedManifests, dst)
+	}
+	return nil
+}
 
-	// Copy the static manifests to the kubelet's pod manifest path.
-	manifestsDir := filepath.Join(b.assetDir, asset.AssetPathBootstrapManifests)
-	ownedManifests, err := copyDirectory(manifestsDir, b.podManifestPath, false /* overwrite */)
-	b.ownedManifests = ownedManifests // always copy in case of partial failure.
-	return err
+// manifestPath returns the path of the static manifest name in the pod manifest path.
+func (b *bootstrapControlPlane) manifestPath(name string) string {
+	return filepath.Join(b.podManifestPath, b.manifestPrefix+name)
 }
 
 // Teardown brings down the bootstrap control plane and cleans up the temporary manifests and
 // secrets. This function is idempotent.
 func (b *bootstrapControlPlane) Teardown() error {
-	UserOutput("Tearing down temporary bootstrap control plane...\n")
-	if err := os.RemoveAll(asset.BootstrapSecretsDir); err != nil {
+	secretsDir, _ := b.dirs()
+	if b.static {
+		UserOutput("Tearing down static control plane...\n")
+	} else {
+		UserOutput("Tearing down temporary bootstrap control plane...\n")
+	}
+	if err := os.RemoveAll(secretsDir); err != nil {
 		return err
 	}
 	for _, manifest := range b.ownedManifests {
@@ -63,6 +119,32 @@ func (b *bootstrapControlPlane) Teardown() error {
 	return nil
 }
 
+// running reports whether all manifests of the control plane are already in the pod manifest
+// path, so that the kubelet runs it.
+func (b *bootstrapControlPlane) running() bool {
+	_, manifestsDir := b.dirs()
+	srcDir := filepath.Join(b.assetDir, manifestsDir)
+	infos, err := ioutil.ReadDir(srcDir)
+	if err != nil || len(infos) == 0 {
+		return false
+	}
+	for _, info := range infos {
+		if info.IsDir() || !sameFile(filepath.Join(srcDir, info.Name()), b.manifestPath(info.Name())) {
+			return false
+		}
+	}
+	return true
+}
+
+// dirs returns the host directory of the control plane secrets and the asset directory of its
+// static manifests.
+func (b *bootstrapControlPlane) dirs() (secretsDir, manifestsDir string) {
+	if b.static {
+		return asset.StaticSecretsDir, asset.AssetPathStaticManifests
+	}
+	return asset.BootstrapSecretsDir, asset.AssetPathBootstrapManifests
+}
+
 // copyFile copies a single file from src to dst. Returns an error if overwrite is true and dst
 // exists, or if any I/O error occurs during copying.
 func copyFile(src, dst string, overwrite bool) error {
@@ -87,8 +169,19 @@ func copyFile(src, dst string, overwrite bool) error {
 	return err
 }
 
+// sameFile reports whether the files a and b exist with the same content.
+func sameFile(a, b string) bool {
+	da, err := ioutil.ReadFile(a)
+	if err != nil {
+		return false
+	}
+	db, err := ioutil.ReadFile(b)
+	return err == nil && bytes.Equal(da, db)
+}
+
 // copyDirectory copies srcDir to dstDir recursively. It returns the paths of files (not
-// directories) that were copied.
+// directories) that were copied. Without overwrite, files that already exist in dstDir with the
+// same content count as copied.
 func copyDirectory(srcDir, dstDir string, overwrite bool) ([]string, error) {
 	var copied []string
 	return copied, filepath.Walk(srcDir, func(src string, info os.FileInfo, err error) error {
@@ -103,6 +196,10 @@ func copyDirectory(srcDir, dstDir string, overwrite bool) ([]string, error) {
 			}
 			return err
 		}
+		if !overwrite && sameFile(src, dst) {
+			copied = append(copied, dst)
+			return nil
+		}
 		if err := copyFile(src, dst, overwrite); err != nil {
 			return err
 		}
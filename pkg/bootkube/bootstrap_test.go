@@ -107,6 +107,77 @@ func TestBootstrapControlPlane(t *testing.T) {
 	}
 }
 
+func TestBootstrapControlPlaneResume(t *testing.T) {
+	assetDir, podManifestPath := setUp(t)
+	defer tearDown(assetDir, podManifestPath, t)
+
+	// A bootkube start that died before tearing down its bootstrap control plane.
+	if err := NewBootstrapControlPlane(assetDir, podManifestPath).Start(); err != nil {
+		t.Fatalf("bcp.Start() = %v, want: nil", err)
+	}
+
+	bcp := NewBootstrapControlPlane(assetDir, podManifestPath)
+	if err := bcp.Start(); err != nil {
+		t.Fatalf("bcp.Start() of a running control plane = %v, want: nil", err)
+	}
+	if !bcp.resumed {
+		t.Error("bcp.Start() didn't resume the running control plane")
+	}
+	// The adopted manifests are torn down.
+	if err := bcp.Teardown(); err != nil {
+		t.Errorf("bcp.Teardown() = %v, want: nil", err)
+	}
+	for _, manifest := range manifests {
+		if fi, err := os.Stat(filepath.Join(podManifestPath, manifest)); fi != nil || !os.IsNotExist(err) {
+			t.Errorf("bcp.Teardown() failed to delete manifest: %v", manifest)
+		}
+	}
+
+	if err := bcp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if bcp.resumed {
+		t.Error("bcp.Start() resumed a control plane that wasn't running")
+	}
+	if err := bcp.Teardown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBootstrapControlPlaneManifestPrefix(t *testing.T) {
+	assetDir, podManifestPath := setUp(t)
+	defer tearDown(assetDir, podManifestPath, t)
+	// A manifest of another tool with the same name isn't touched.
+	if err := ioutil.WriteFile(filepath.Join(podManifestPath, manifests[0]), []byte("other data"), os.FileMode(0644)); err != nil {
+		t.Fatal(err)
+	}
+
+	bcp := NewBootstrapControlPlane(assetDir, podManifestPath)
+	bcp.manifestPrefix = "bootkube-"
+	if err := bcp.Start(); err != nil {
+		t.Fatalf("bcp.Start() = %v, want: nil", err)
+	}
+	for _, manifest := range manifests {
+		if _, err := os.Stat(filepath.Join(podManifestPath, "bootkube-"+manifest)); err != nil {
+			t.Errorf("bcp.Start() failed to copy manifest %v: %v", manifest, err)
+		}
+	}
+	if !bcp.running() {
+		t.Error("bcp.running() = false after bcp.Start(), want: true")
+	}
+
+	if err := bcp.Teardown(); err != nil {
+		t.Errorf("bcp.Teardown() = %v, want: nil", err)
+	}
+	infos, err := ioutil.ReadDir(podManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != manifests[0] {
+		t.Errorf("bcp.Teardown() left %v in the pod manifest path, want only the other manifest", infos)
+	}
+}
+
 func TestBootstrapControlPlaneNoOverwrite(t *testing.T) {
 	assetDir, podManifestPath := setUp(t)
 	defer tearDown(assetDir, podManifestPath, t)
@@ -163,3 +234,57 @@ func TestBootstrapControlPlaneNoOverwrite(t *testing.T) {
 		}
 	}
 }
+
+func TestStaticControlPlane(t *testing.T) {
+	assetDir, podManifestPath := setUp(t)
+	defer tearDown(assetDir, podManifestPath, t)
+	if err := os.Rename(filepath.Join(assetDir, asset.AssetPathBootstrapManifests), filepath.Join(assetDir, asset.AssetPathStaticManifests)); err != nil {
+		t.Fatal(err)
+	}
+	if !IsStaticControlPlane(assetDir) {
+		t.Fatalf("IsStaticControlPlane(%s) = false, want: true", assetDir)
+	}
+	var err error
+	asset.StaticSecretsDir, err = ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(asset.StaticSecretsDir)
+
+	bcp := NewBootstrapControlPlane(assetDir, podManifestPath)
+	bcp.static = true
+	if err := bcp.Start(); err != nil {
+		t.Errorf("bcp.Start() = %v, want: nil", err)
+	}
+	for _, secret := range secrets {
+		if _, err := os.Stat(filepath.Join(asset.StaticSecretsDir, secret)); os.IsNotExist(err) {
+			t.Errorf("bcp.Start() failed to copy secret: %v", secret)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(asset.StaticSecretsDir, "kubeconfig")); !os.IsNotExist(err) {
+		t.Error("bcp.Start() copied a kubeconfig for the static control plane")
+	}
+	for _, manifest := range manifests {
+		if _, err := os.Stat(filepath.Join(podManifestPath, manifest)); os.IsNotExist(err) {
+			t.Errorf("bcp.Start() failed to copy manifest: %v", manifest)
+		}
+	}
+	if _, err := os.Stat(asset.BootstrapSecretsDir); err != nil {
+		t.Errorf("bcp.Start() removed the bootstrap secrets directory: %v", err)
+	}
+}
+
+func TestControlPlaneNamespace(t *testing.T) {
+	assetDir, podManifestPath := setUp(t)
+	defer tearDown(assetDir, podManifestPath, t)
+	if ns := ControlPlaneNamespace(assetDir); ns != "kube-system" {
+		t.Errorf("ControlPlaneNamespace() = %q without an apiserver manifest, want: kube-system", ns)
+	}
+	apiserver := "apiVersion: v1\nkind: Pod\nmetadata:\n  name: bootstrap-kube-apiserver\n  namespace: control-plane\n"
+	if err := ioutil.WriteFile(filepath.Join(assetDir, asset.AssetPathBootstrapAPIServer), []byte(apiserver), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ns := ControlPlaneNamespace(assetDir); ns != "control-plane" {
+		t.Errorf("ControlPlaneNamespace() = %q, want: control-plane", ns)
+	}
+}
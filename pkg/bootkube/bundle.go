@@ -0,0 +1,94 @@
+package bootkube
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ExtractAssetBundle decrypts the age encrypted asset tarball at bundle, a local path or a URL
+// FetchAssets accepts, with the X25519 identities of the age identity file at identityPath, and
+// extracts it like FetchAssets. The tarball is decrypted in memory and only extracted once all of
+// it has been authenticated, so a tampered or truncated bundle leaves nothing behind, and its
+// plaintext is never written anywhere but the asset directory, which is in memory if the node has
+// a /dev/shm.
+func ExtractAssetBundle(ctx context.Context, bundle, identityPath string) (assetDir string, cleanup func(), err error) {
+	identities, err := readAgeIdentities(identityPath)
+	if err != nil {
+		return "", nil, err
+	}
+	var r io.ReadCloser
+	if IsRemoteAssetDir(bundle) {
+		r, err = fetch(ctx, bundle)
+	} else {
+		r, err = os.Open(bundle)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	plaintext, err := ageDecrypt(r, identities)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decrypt the asset bundle %s: %v", RedactAssetSource(bundle), err)
+	}
+	assetDir, cleanup, err = extractAssets(bytes.NewReader(plaintext))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to extract the asset bundle %s: %v", RedactAssetSource(bundle), err)
+	}
+	return assetDir, cleanup, nil
+}
+
+// ageIntro is the start of the header of binary age files.
+const ageIntro = "age-encryption.org/"
+
+// readAgeIdentities reads the X25519 identities of an age identity file, one AGE-SECRET-KEY-1...
+// per line, ignoring empty lines and # comments like age-keygen writes.
+func readAgeIdentities(path string) ([]age.Identity, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var identities []age.Identity
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, err := age.ParseX25519Identity(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid age identity: %v", path, err)
+		}
+		identities = append(identities, identity)
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("%s: no age identities", path)
+	}
+	return identities, nil
+}
+
+// ageDecrypt returns the plaintext of the binary or ASCII armored age file r. The payload is read
+// to the end, so that an error is returned if any of it has been tampered with or truncated.
+func ageDecrypt(r io.Reader, identities []age.Identity) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if start, err := br.Peek(len(armor.Header)); err == nil && string(start) == armor.Header {
+		src = armor.NewReader(br)
+	} else if start, err := br.Peek(len(ageIntro)); err != nil || string(start) != ageIntro {
+		return nil, errors.New("not an age encrypted file")
+	}
+	plaintext, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(plaintext)
+}
@@ -0,0 +1,122 @@
+package bootkube
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// The identity of the age test vectors, a scalar of 0x42 bytes.
+const testAgeIdentity = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+
+// ageChunkSize is the size of the chunks of an age payload.
+const ageChunkSize = 64 * 1024
+
+// ageEncrypt encrypts plaintext to recipient like `age -r`, ASCII armored like `age -a` if armored.
+func ageEncrypt(t *testing.T, recipient age.Recipient, plaintext []byte, armored bool) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	var dst io.Writer = &out
+	var aw io.WriteCloser
+	if armored {
+		aw = armor.NewWriter(&out)
+		dst = aw
+	}
+	w, err := age.Encrypt(dst, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if aw != nil {
+		if err := aw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestExtractAssetBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootkube-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	identityPath := filepath.Join(dir, "key.txt")
+	if err := ioutil.WriteFile(identityPath, []byte("# created: 2020-05-01T00:00:00Z\n# public key: age1...\n"+testAgeIdentity+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	identity, err := age.ParseX25519Identity(testAgeIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A secret larger than a chunk of the payload.
+	secret := bytes.Repeat([]byte("0123456789abcdef"), ageChunkSize/8)
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	for name, data := range map[string][]byte{"manifests/a.yaml": []byte("kind: Pod\n"), "tls/service-account.key": secret} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	tw.Close()
+	encrypted := ageEncrypt(t, identity.Recipient(), tarball.Bytes(), false)
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-100] ^= 1
+
+	for name, data := range map[string][]byte{
+		"assets.tar.age":       encrypted,
+		"armored.tar.age":      ageEncrypt(t, identity.Recipient(), tarball.Bytes(), true),
+		"tampered.tar.age":     tampered,
+		"truncated.tar.age":    encrypted[:len(encrypted)-ageChunkSize/2],
+		"other-key.tar.age":    ageEncrypt(t, otherIdentity.Recipient(), tarball.Bytes(), false),
+		"not-encrypted.tar.gz": tarball.Bytes(),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"assets.tar.age", "armored.tar.age"} {
+		assetDir, cleanup, err := ExtractAssetBundle(context.Background(), filepath.Join(dir, name), identityPath)
+		if err != nil {
+			t.Errorf("%s: ExtractAssetBundle() = %v, want: nil", name, err)
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(assetDir, "tls/service-account.key"))
+		if err != nil || !bytes.Equal(b, secret) {
+			t.Errorf("%s: got a service account key of %d bytes, %v, want: %d bytes", name, len(b), err, len(secret))
+		}
+		cleanup()
+	}
+
+	for name, wantErr := range map[string]string{
+		"tampered.tar.age":     "failed to decrypt and authenticate payload chunk",
+		"truncated.tar.age":    "failed to decrypt and authenticate payload chunk",
+		"other-key.tar.age":    "no identity matched any of the recipients",
+		"not-encrypted.tar.gz": "not an age encrypted file",
+	} {
+		if _, _, err := ExtractAssetBundle(context.Background(), filepath.Join(dir, name), identityPath); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: ExtractAssetBundle() = %v, want an error containing %q", name, err, wantErr)
+		}
+	}
+}
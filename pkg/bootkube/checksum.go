@@ -0,0 +1,225 @@
+package bootkube
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// AssetChecksums is the file of the asset directory with the SHA-256 checksums of all the
+	// other assets, in the format of sha256sum.
+	AssetChecksums = "manifest.sha256"
+	// AssetChecksumsSignature is the detached signature of AssetChecksums, in the format of
+	// `openssl dgst -sha256 -sign`.
+	AssetChecksumsSignature = AssetChecksums + ".sig"
+)
+
+// WriteAssetChecksums writes the checksums of the files of assetDir to AssetChecksums, and signs
+// them with the PEM encoded RSA or ECDSA private key at signingKeyPath unless it is empty.
+func WriteAssetChecksums(assetDir, signingKeyPath string) error {
+	sums, err := assetChecksums(assetDir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var manifest bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&manifest, "%s  %s\n", sums[name], name)
+	}
+	if err := ioutil.WriteFile(filepath.Join(assetDir, AssetChecksums), manifest.Bytes(), 0644); err != nil {
+		return err
+	}
+	if signingKeyPath == "" {
+		return nil
+	}
+
+	signer, err := readSigningKey(signingKeyPath)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(manifest.Bytes())
+	// RSA keys sign PKCS #1 v1.5 and ECDSA keys ASN.1 encoded signatures, like openssl.
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %v", AssetChecksums, err)
+	}
+	return ioutil.WriteFile(filepath.Join(assetDir, AssetChecksumsSignature), sig, 0644)
+}
+
+// VerifyAssets returns an error if the files of assetDir don't match its AssetChecksums, or if
+// files were added since. If publicKeyPath is set, AssetChecksums must also be signed by the
+// private key of the PEM encoded public key or certificate at publicKeyPath.
+func VerifyAssets(assetDir, publicKeyPath string) error {
+	manifest, err := ioutil.ReadFile(filepath.Join(assetDir, AssetChecksums))
+	if err != nil {
+		return fmt.Errorf("failed to read the asset checksums: %v", err)
+	}
+	if publicKeyPath != "" {
+		sig, err := ioutil.ReadFile(filepath.Join(assetDir, AssetChecksumsSignature))
+		if err != nil {
+			return fmt.Errorf("failed to read the asset checksums signature: %v", err)
+		}
+		pub, err := readPublicKey(publicKeyPath)
+		if err != nil {
+			return err
+		}
+		if err := verifySignature(pub, manifest, sig); err != nil {
+			return fmt.Errorf("invalid signature of %s: %v", AssetChecksums, err)
+		}
+	}
+
+	want := map[string]string{}
+	s := bufio.NewScanner(bytes.NewReader(manifest))
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), "  ", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid line of %s: %q", AssetChecksums, s.Text())
+		}
+		want[fields[1]] = fields[0]
+	}
+	got, err := assetChecksums(assetDir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range want {
+		names = append(names, name)
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case got[name] == "":
+			return fmt.Errorf("asset %s is missing", name)
+		case want[name] == "":
+			return fmt.Errorf("asset %s was added after rendering", name)
+		case got[name] != want[name]:
+			return fmt.Errorf("asset %s was modified after rendering", name)
+		}
+	}
+	return nil
+}
+
+// assetChecksums returns the hex encoded SHA-256 checksums of the files of assetDir by their
+// slash separated path, except for the checksums and their signature.
+func assetChecksums(assetDir string) (map[string]string, error) {
+	sums := map[string]string{}
+	err := filepath.Walk(assetDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(assetDir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if name == AssetChecksums || name == AssetChecksumsSignature || name == AssetPathFinalAdminKubeConfig || name == AssetPathInterrupted {
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		sums[name] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	return sums, err
+}
+
+func readSigningKey(path string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM encoded key", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unsupported private key: %v", path, err)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: only RSA and ECDSA keys are supported", path)
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM encoded public key", path)
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return cert.PublicKey, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unsupported public key: %v", path, err)
+	}
+	return key, nil
+}
+
+func verifySignature(pub crypto.PublicKey, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case *ecdsa.PublicKey:
+		var esig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+			return err
+		}
+		if !ecdsa.Verify(pub, digest[:], esig.R, esig.S) {
+			return errors.New("verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key %T", pub)
+}
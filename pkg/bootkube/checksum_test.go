@@ -0,0 +1,119 @@
+package bootkube
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssetChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootkube-checksums")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("manifests/kube-apiserver.yaml", "kind: DaemonSet\n")
+	writeFile("tls/ca.crt", "ca\n")
+
+	if err := WriteAssetChecksums(dir, ""); err != nil {
+		t.Fatalf("WriteAssetChecksums() = %v, want: nil", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, AssetChecksums))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The output of sha256sum.
+	want := "09e6af4300f21b78dfd48e37b00a14e814093898f11341bbd45f95749e4e2296  manifests/kube-apiserver.yaml\n" +
+		"314a01b67979d4ecc6667666046246e726d9848903e33d0e63fab1165aea9d94  tls/ca.crt\n"
+	if string(b) != want {
+		t.Errorf("got checksums:\n%s\nwant:\n%s", b, want)
+	}
+	if err := VerifyAssets(dir, ""); err != nil {
+		t.Errorf("VerifyAssets() = %v, want: nil", err)
+	}
+
+	writeFile("manifests/extra.yaml", "kind: Pod\n")
+	if err := VerifyAssets(dir, ""); err == nil || !strings.Contains(err.Error(), "manifests/extra.yaml was added") {
+		t.Errorf("VerifyAssets() = %v, want an error about the added asset", err)
+	}
+	os.Remove(filepath.Join(dir, "manifests/extra.yaml"))
+	writeFile("tls/ca.crt", "another ca\n")
+	if err := VerifyAssets(dir, ""); err == nil || !strings.Contains(err.Error(), "tls/ca.crt was modified") {
+		t.Errorf("VerifyAssets() = %v, want an error about the modified asset", err)
+	}
+	os.Remove(filepath.Join(dir, "tls/ca.crt"))
+	if err := VerifyAssets(dir, ""); err == nil || !strings.Contains(err.Error(), "tls/ca.crt is missing") {
+		t.Errorf("VerifyAssets() = %v, want an error about the missing asset", err)
+	}
+	writeFile("tls/ca.crt", "ca\n")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []struct {
+		name   string
+		block  *pem.Block
+		public interface{}
+	}{
+		{"rsa", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, &rsaKey.PublicKey},
+		{"ecdsa", &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}, &ecKey.PublicKey},
+	} {
+		pubDER, err := x509.MarshalPKIXPublicKey(k.public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPath := filepath.Join(dir, "..", filepath.Base(dir)+"-"+k.name+".key")
+		pubPath := filepath.Join(dir, "..", filepath.Base(dir)+"-"+k.name+".pub")
+		defer os.Remove(keyPath)
+		defer os.Remove(pubPath)
+		if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(k.block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := WriteAssetChecksums(dir, keyPath); err != nil {
+			t.Fatalf("%s: WriteAssetChecksums() = %v, want: nil", k.name, err)
+		}
+		if err := VerifyAssets(dir, pubPath); err != nil {
+			t.Errorf("%s: VerifyAssets() = %v, want: nil", k.name, err)
+		}
+		// The checksums can't be regenerated without the signing key.
+		writeFile("tls/ca.crt", "another ca\n")
+		if err := WriteAssetChecksums(dir, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyAssets(dir, pubPath); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+			t.Errorf("%s: VerifyAssets() = %v, want an invalid signature error", k.name, err)
+		}
+		writeFile("tls/ca.crt", "ca\n")
+	}
+}
@@ -11,16 +11,17 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/golang/glog"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/discovery"
@@ -35,53 +36,148 @@ const (
 	crdRolloutTimeout  = 2 * time.Minute
 )
 
+// fieldManager is the manager of the fields bootkube sets in the objects it creates.
+const fieldManager = "bootkube"
+
+// DefaultParallelism is how many manifests bootkube start creates at once.
+const DefaultParallelism = 5
+
 func CreateAssets(config clientcmd.ClientConfig, manifestDir string, timeout time.Duration, strict bool) error {
+	return createAssets(context.Background(), config, manifestDir, createOptions{
+		apiServerTimeout: timeout,
+		assetTimeout:     timeout,
+		retry:            DefaultRetryPolicy,
+		strict:           strict,
+		parallelism:      DefaultParallelism,
+	})
+}
+
+// createOptions configures createAssets.
+type createOptions struct {
+	// apiServerTimeout bounds waiting for the apiserver and assetTimeout creating the manifests.
+	apiServerTimeout time.Duration
+	assetTimeout     time.Duration
+	// retry is how failed requests are retried.
+	retry  RetryPolicy
+	strict bool
+	// With skipExisting, objects that already exist, e.g. created by another master
+	// bootstrapping at the same time, are not errors.
+	skipExisting bool
+	// skip returns true for the manifests not to create.
+	skip func(manifest) bool
+	// progress, if set, tracks the phase and the status of each manifest.
+	progress *progress
+	// parallelism is how many manifests are created at once.
+	parallelism int
+	// allowUpdate server-side applies the manifests, updating the objects that already exist.
+	allowUpdate bool
+	// prune deletes the objects bootkube created whose manifest was removed, see prune.
+	prune bool
+	// apiServerReady, if set, is called once the apiserver is ready, before any asset is
+	// created. Assets aren't created if it fails.
+	apiServerReady func() error
+}
+
+// createAssets creates the manifests in manifestDir within the deadline of ctx.
+func createAssets(ctx context.Context, config clientcmd.ClientConfig, manifestDir string, opts createOptions) error {
 	if _, err := os.Stat(manifestDir); os.IsNotExist(err) {
-		UserOutput(fmt.Sprintf("WARNING: %v does not exist, not creating any self-hosted assets.\n", manifestDir))
+		UserWarning("%v does not exist, not creating any self-hosted assets.\n", manifestDir)
 		return nil
 	}
 	c, err := config.ClientConfig()
 	if err != nil {
 		return err
 	}
-	creater, err := newCreater(c, strict)
+	creater, err := newCreater(c, opts.strict)
 	if err != nil {
 		return err
 	}
+	creater.skipExisting = opts.skipExisting
+	creater.retry = opts.retry
+	creater.progress = opts.progress
+	creater.parallelism = opts.parallelism
+	creater.allowUpdate = opts.allowUpdate
 
 	m, err := loadManifests(manifestDir)
 	if err != nil {
 		return fmt.Errorf("loading manifests: %v", err)
 	}
-
-	upFn := func() (bool, error) {
-		if err := apiTest(config); err != nil {
-			glog.Warningf("Unable to determine api-server readiness: %v", err)
-			return false, nil
+	// The skipped manifests are still in the asset directory and their objects aren't pruned.
+	all := m
+	if opts.skip != nil {
+		var filtered []manifest
+		for _, mf := range m {
+			if opts.skip(mf) {
+				opts.progress.setAsset(mf, assetSkipped)
+				UserOutput("Skipping %s\n", mf)
+				continue
+			}
+			filtered = append(filtered, mf)
 		}
-		return true, nil
+		m = filtered
 	}
 
+	opts.progress.setPhase(phaseWaitingForAPIServer)
 	UserOutput("Waiting for api-server...\n")
-	if err := wait.Poll(5*time.Second, timeout, upFn); err != nil {
+	apiServerCtx, cancel := context.WithTimeout(ctx, opts.apiServerTimeout)
+	defer cancel()
+	// The apiserver is retried until it's ready or the timeout expires.
+	if err := opts.retry.retry(apiServerCtx, -1, func() (bool, error) {
+		err := apiTest(config)
+		if err != nil {
+			debugf("Unable to determine api-server readiness: %v", err)
+		}
+		return true, err
+	}); err != nil {
 		err = fmt.Errorf("API Server is not ready: %v", err)
-		glog.Error(err)
+		UserError("%v\n", err)
 		return err
 	}
 
+	if opts.apiServerReady != nil {
+		if err := opts.apiServerReady(); err != nil {
+			return err
+		}
+	}
+
+	opts.progress.setPhase(phaseCreatingAssets)
 	UserOutput("Creating self-hosted assets...\n")
-	if ok := creater.createManifests(m); !ok {
+	assetCtx, cancel := context.WithTimeout(ctx, opts.assetTimeout)
+	defer cancel()
+	creater.ctx = assetCtx
+	ok := creater.createManifests(m)
+	if err := assetCtx.Err(); err != nil {
+		return fmt.Errorf("timed out creating self-hosted assets: %v", err)
+	}
+	if !ok {
+		failures := creater.failures
+		sort.SliceStable(failures, func(i, j int) bool { return failures[i].File < failures[j].File })
+		// In strict mode, the summary is the error bootkube fails with.
+		if opts.strict && len(failures) > 0 {
+			return failures
+		}
+		UserError("%v\n", failures)
 		UserOutput("\nNOTE: Bootkube failed to create some cluster assets. It is important that manifest errors are resolved and resubmitted to the apiserver.\n")
 		UserOutput("For example, after resolving issues: kubectl create -f <failed-manifest>\n\n")
 
 		// Don't fail on manifest creation. It's easier to debug a cluster with a failed
-		// manifest than exiting and tearing down the control plane. If strict
-		// mode is enabled, then error out.
-		if strict {
-			return fmt.Errorf("Self-hosted assets could not be created")
-		}
+		// manifest than exiting and tearing down the control plane.
 	}
 
+	if opts.prune {
+		// A manifest that failed may be for an object of the cluster under another name, e.g.
+		// after a partial rename, so nothing is pruned until all the manifests are created.
+		if !ok {
+			UserWarning("Not pruning cluster assets since some could not be created\n")
+			return nil
+		}
+		if err := creater.prune(all); err != nil {
+			if opts.strict {
+				return err
+			}
+			UserError("%v\n", err)
+		}
+	}
 	return nil
 }
 
@@ -113,6 +209,8 @@ type manifest struct {
 	namespace  string
 	name       string
 	raw        []byte
+	// applyOrder is the value of the ApplyOrderAnnotation, 0 if the manifest has none.
+	applyOrder int
 
 	filepath string
 }
@@ -125,8 +223,25 @@ func (m manifest) String() string {
 }
 
 type creater struct {
-	client *rest.RESTClient
-	strict bool
+	// ctx bounds the requests of the creater.
+	ctx          context.Context
+	client       *rest.RESTClient
+	strict       bool
+	skipExisting bool
+	// retry is how failed creates are retried.
+	retry RetryPolicy
+	// progress, if set, tracks the status of each manifest.
+	progress *progress
+	// parallelism is how many manifests of a stage are created at once.
+	parallelism int
+	// allowUpdate applies the manifests instead of creating them, see apply.
+	allowUpdate bool
+
+	mu sync.Mutex
+	// failures are the manifests that could not be created.
+	failures AssetErrors
+	// failedDependencies are the failed namespaces and CRDs, by dependencyKey.
+	failedDependencies map[string]manifest
 
 	// mapper maps resource kinds ("ConfigMap") with their pluralized URL
 	// path ("configmaps") using the discovery APIs.
@@ -146,12 +261,14 @@ func newCreater(c *rest.Config, strict bool) (*creater, error) {
 	}
 
 	return &creater{
+		ctx:    context.Background(),
 		mapper: newResourceMapper(discoveryClient),
 		client: client,
 		strict: strict,
 	}, nil
 }
 
+// createManifests creates the manifests, and stops early once the ctx of the creater is done.
 func (c *creater) createManifests(manifests []manifest) (ok bool) {
 	ok = true
 	// Bootkube used to create manifests in named order ("01-foo" before "02-foo").
@@ -173,25 +290,69 @@ func (c *creater) createManifests(manifests []manifest) (ok bool) {
 	}
 
 	create := func(m manifest) error {
-		if err := c.create(m); err != nil {
-			ok = false
-			UserOutput("Failed creating %s: %v\n", m, err)
+		if dep, ok := c.failedDependency(m); ok {
+			err := fmt.Errorf("depends on %s, which failed", dep)
+			c.progress.setAsset(m, assetSkipped)
+			UserWarning("Skipping %s, which depends on %s, which failed\n", m, dep)
+			c.fail(m, err)
 			return err
 		}
+		existed, err := c.createWithRetry(m)
+		if c.skipExisting && errors.IsAlreadyExists(err) {
+			c.progress.setAsset(m, assetExisting)
+			UserOutput("Skipped existing %s\n", m)
+			return nil
+		}
+		if err != nil {
+			c.progress.setAsset(m, assetFailed)
+			UserError("failed to create %s: %v\n", m, err)
+			c.fail(m, err)
+			return err
+		}
+		if existed {
+			c.progress.setAsset(m, assetUpdated)
+			UserOutput("Updated %s\n", m)
+			return nil
+		}
+		c.progress.setAsset(m, assetCreated)
 		UserOutput("Created %s\n", m)
 		return nil
 	}
 
-	// Create all namespaces first
+	// Create all namespaces first. Namespaces which already exist, such as kube-system, get the
+	// labels and annotations of their manifest instead.
 	for _, m := range namespaces {
-		if err := create(m); err != nil && c.strict {
+		if c.ctx.Err() != nil {
 			return false
 		}
+		existed, err := c.createWithRetry(m)
+		if errors.IsAlreadyExists(err) {
+			if err = c.patchMetadata(m); err == nil {
+				c.progress.setAsset(m, assetExisting)
+				UserOutput("Updated %s\n", m)
+				continue
+			}
+		}
+		if err == nil && existed {
+			c.progress.setAsset(m, assetUpdated)
+			UserOutput("Updated %s\n", m)
+			continue
+		}
+		if err != nil {
+			ok = false
+			c.progress.setAsset(m, assetFailed)
+			UserError("failed to create %s: %v\n", m, err)
+			c.fail(m, err)
+			continue
+		}
+		c.progress.setAsset(m, assetCreated)
+		UserOutput("Created %s\n", m)
 	}
 
 	// Create the custom resource definition before creating the actual custom resources.
-	for _, m := range crds {
-		if err := create(m); err != nil && c.strict {
+	if !c.createParallel(crds, create) {
+		ok = false
+		if c.ctx.Err() != nil {
 			return false
 		}
 	}
@@ -199,34 +360,239 @@ func (c *creater) createManifests(manifests []manifest) (ok bool) {
 	// Wait until the API server registers the CRDs. Until then it's not safe to create the
 	// manifests for those custom resources.
 	for _, crd := range crds {
+		if c.ctx.Err() != nil {
+			return false
+		}
+		if c.failed(crd) {
+			continue
+		}
 		if err := c.waitForCRD(crd); err != nil {
 			ok = false
-			UserOutput("Failed waiting for %s: %v\n", crd, err)
-			if c.strict {
+			c.progress.setAsset(crd, assetFailed)
+			UserError("failed waiting for %s: %v\n", crd, err)
+			c.fail(crd, fmt.Errorf("not established: %v", err))
+		}
+	}
+
+	// There are cases when a multi-doc YAML contains empty manifests. This
+	// is most often the case when using a templating enging that skips
+	// over a certain manifest in the case that a feature is diabled. This
+	// check is to allow for this. When decoded, the raw string becomes
+	// "null", so we check for that and skip the manifest if it is "null".
+	var nonEmpty []manifest
+	for _, m := range other {
+		if string(m.raw) != "null" {
+			nonEmpty = append(nonEmpty, m)
+		}
+	}
+	for _, stage := range stageManifests(nonEmpty) {
+		if !c.createParallel(stage, create) {
+			ok = false
+			if c.ctx.Err() != nil {
 				return false
 			}
 		}
 	}
+	return ok
+}
 
-	for _, m := range other {
-		// There are cases when a multi-doc YAML contains empty manifests. This
-		// is most often the case when using a templating enging that skips
-		// over a certain manifest in the case that a feature is diabled. This
-		// check is to allow for this. When decoded, the raw string becomes
-		// "null", so we check for that and skip the manifest if it is "null".
-		if string(m.raw) == "null" {
-			continue
+// AssetError is a manifest of the asset directory that could not be created.
+type AssetError struct {
+	File      string
+	Kind      string
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e AssetError) Error() string {
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + name
+	}
+	return fmt.Sprintf("%s %s %s: %v", e.File, e.Kind, name, e.Err)
+}
+
+// AssetErrors are all the manifests of the asset directory that could not be created.
+type AssetErrors []AssetError
+
+func (e AssetErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d cluster assets could not be created:", len(e))
+	for _, err := range e {
+		fmt.Fprintf(&b, "\n  %v", err)
+	}
+	return b.String()
+}
+
+// fail records that the manifest could not be created. The manifests depending on a failed
+// namespace or CRD are skipped.
+func (c *creater) fail(m manifest, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, AssetError{File: m.filepath, Kind: m.kind, Namespace: m.namespace, Name: m.name, Err: err})
+	var key string
+	switch {
+	case m.kind == "Namespace" && m.apiVersion == "v1":
+		key = dependencyKey("v1", "Namespace", m.name)
+	case m.kind == "CustomResourceDefinition" && strings.HasPrefix(m.apiVersion, "apiextensions.k8s.io/"):
+		var crd struct {
+			Spec struct {
+				Group string `json:"group"`
+				Names struct {
+					Kind string `json:"kind"`
+				} `json:"names"`
+			} `json:"spec"`
 		}
+		if json.Unmarshal(m.raw, &crd) != nil {
+			return
+		}
+		key = dependencyKey(crd.Spec.Group, crd.Spec.Names.Kind, "")
+	default:
+		return
+	}
+	if c.failedDependencies == nil {
+		c.failedDependencies = map[string]manifest{}
+	}
+	c.failedDependencies[key] = m
+}
 
-		if err := create(m); err != nil && c.strict {
-			return false
+// failed reports whether the manifest could not be created.
+func (c *creater) failed(m manifest) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.failures {
+		if f.File == m.filepath && f.Kind == m.kind && f.Namespace == m.namespace && f.Name == m.name {
+			return true
 		}
 	}
-	return ok
+	return false
+}
+
+// failedDependency returns the failed namespace of the manifest, or the failed CRD of its kind.
+func (c *creater) failedDependency(m manifest) (manifest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m.namespace != "" {
+		if dep, ok := c.failedDependencies[dependencyKey("v1", "Namespace", m.namespace)]; ok {
+			return dep, true
+		}
+	}
+	group := ""
+	if i := strings.Index(m.apiVersion, "/"); i >= 0 {
+		group = m.apiVersion[:i]
+	}
+	dep, ok := c.failedDependencies[dependencyKey(group, m.kind, "")]
+	return dep, ok
+}
+
+// dependencyKey identifies a namespace by its name, or a CRD by the group and kind it defines.
+func dependencyKey(group, kind, name string) string {
+	return group + "/" + kind + "/" + name
+}
+
+// ApplyOrderAnnotation orders the creation of manifests added to the asset directory: manifests
+// with a lower value, which may be negative, are created before those with a higher one, and
+// manifests without it have the value 0. Namespaces and CRDs are always created first.
+const ApplyOrderAnnotation = "bootkube.alpha.kubernetes.io/apply-order"
+
+// createStages are the kinds of manifests the others depend on, in the order they are created:
+// the service accounts and RBAC rules workloads run with, then the configuration they mount. All
+// other kinds, e.g. the workloads themselves, are created last.
+var createStages = [][]string{
+	{"ServiceAccount", "ClusterRole", "Role", "ClusterRoleBinding", "RoleBinding", "PodSecurityPolicy", "PriorityClass"},
+	{"ConfigMap", "Secret"},
+}
+
+// stageManifests splits the manifests by their applyOrder, and the manifests of each applyOrder
+// into the createStages, followed by the other manifests. Empty stages are left out.
+func stageManifests(manifests []manifest) [][]manifest {
+	byOrder := map[int][]manifest{}
+	var orders []int
+	for _, m := range manifests {
+		if _, ok := byOrder[m.applyOrder]; !ok {
+			orders = append(orders, m.applyOrder)
+		}
+		byOrder[m.applyOrder] = append(byOrder[m.applyOrder], m)
+	}
+	sort.Ints(orders)
+
+	var nonEmpty [][]manifest
+	for _, order := range orders {
+		stages := make([][]manifest, len(createStages)+1)
+		for _, m := range byOrder[order] {
+			i := len(createStages)
+			for j, kinds := range createStages {
+				for _, kind := range kinds {
+					if m.kind == kind {
+						i = j
+					}
+				}
+			}
+			stages[i] = append(stages[i], m)
+		}
+		for _, stage := range stages {
+			if len(stage) > 0 {
+				nonEmpty = append(nonEmpty, stage)
+			}
+		}
+	}
+	return nonEmpty
+}
+
+// createParallel creates the manifests with up to the parallelism of the creater at once, and
+// reports whether all of them were created. No further creates are started once ctx is done.
+func (c *creater) createParallel(manifests []manifest, create func(manifest) error) bool {
+	parallelism := c.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		ok  = true
+		sem = make(chan struct{}, parallelism)
+	)
+	for _, m := range manifests {
+		sem <- struct{}{}
+		if c.ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(m manifest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := create(m); err != nil {
+				mu.Lock()
+				ok = false
+				mu.Unlock()
+			}
+		}(m)
+	}
+	wg.Wait()
+	return ok && c.ctx.Err() == nil
 }
 
-// waitForCRD blocks until the API server begins serving the custom resource this
-// manifest defines. This is determined by listing the custom resource in a loop.
+// createWithRetry creates the manifest, or applies it with allowUpdate, retrying failures that
+// may be transient. It reports whether the applied object already existed.
+func (c *creater) createWithRetry(m manifest) (existed bool, err error) {
+	err = c.retry.retry(c.ctx, c.retry.Retries, func() (bool, error) {
+		var err error
+		if c.allowUpdate {
+			existed, err = c.apply(m)
+		} else {
+			err = c.create(m)
+		}
+		return err != nil && isTransientCreateError(err), err
+	})
+	return existed, err
+}
+
+// waitForCRD blocks until the CRD of this manifest is established and the API server begins
+// serving the custom resource it defines. The latter is determined by listing the custom resource
+// in a loop.
 func (c *creater) waitForCRD(m manifest) error {
 	var crd apiextensionsv1beta1.CustomResourceDefinition
 	if err := json.Unmarshal(m.raw, &crd); err != nil {
@@ -249,10 +615,17 @@ func (c *creater) waitForCRD(m manifest) error {
 		return fmt.Errorf("expected at least one served version")
 	}
 
-	return wait.PollImmediate(crdRolloutDuration, crdRolloutTimeout, func() (bool, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, crdRolloutTimeout)
+	defer cancel()
+	return wait.PollImmediateUntil(crdRolloutDuration, func() (bool, error) {
+		established, err := c.crdEstablished(ctx, m)
+		if err != nil || !established {
+			debugf("Waiting for %s to be established: %v", m, err)
+			return false, nil
+		}
 		// get all resources, giving a 200 result with empty list on success, 404 before the CRD is active.
 		namespaceLessURI := allCustomResourcesURI(schema.GroupVersionResource{Group: crd.Spec.Group, Version: firstVer, Resource: crd.Spec.Names.Plural})
-		res := c.client.Get().RequestURI(namespaceLessURI).Do(context.TODO())
+		res := c.client.Get().RequestURI(namespaceLessURI).Do(ctx)
 		if res.Error() != nil {
 			if errors.IsNotFound(res.Error()) {
 				return false, nil
@@ -260,7 +633,33 @@ func (c *creater) waitForCRD(m manifest) error {
 			return false, res.Error()
 		}
 		return true, nil
-	})
+	}, ctx.Done())
+}
+
+// crdEstablished reports whether the CRD of this manifest has the Established condition, i.e.
+// the API server accepts its custom resources.
+func (c *creater) crdEstablished(ctx context.Context, m manifest) (bool, error) {
+	b, err := c.client.Get().AbsPath("/apis", m.apiVersion, "customresourcedefinitions", m.name).DoRaw(ctx)
+	if err != nil {
+		return false, err
+	}
+	var crd struct {
+		Status struct {
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(b, &crd); err != nil {
+		return false, err
+	}
+	for _, cond := range crd.Status.Conditions {
+		if cond.Type == string(apiextensionsv1beta1.Established) {
+			return cond.Status == string(apiextensionsv1beta1.ConditionTrue), nil
+		}
+	}
+	return false, nil
 }
 
 // allCustomResourcesURI returns the URI for the CRD resource without a namespace, listing
@@ -279,11 +678,65 @@ func (c *creater) create(m manifest) error {
 		return fmt.Errorf("dicovery failed: %v", err)
 	}
 
+	body, err := withManagedLabel(m.raw)
+	if err != nil {
+		return err
+	}
 	return c.client.Post().
 		AbsPath(m.urlPath(info.Name, info.Namespaced)).
-		Body(m.raw).
+		Param("fieldManager", fieldManager).
+		Body(body).
 		SetHeader("Content-Type", "application/json").
-		Do(context.TODO()).Error()
+		Do(c.ctx).Error()
+}
+
+// apply server-side applies the manifest as the bootkube field manager, which creates the object
+// or reconciles the fields of the manifest in the existing one. Fields set by other managers are
+// taken over. It reports whether the object already existed.
+func (c *creater) apply(m manifest) (existed bool, err error) {
+	info, err := c.mapper.resourceInfo(m.apiVersion, m.kind)
+	if err != nil {
+		return false, fmt.Errorf("dicovery failed: %v", err)
+	}
+	body, err := withManagedLabel(m.raw)
+	if err != nil {
+		return false, err
+	}
+	var status int
+	err = c.client.Patch(types.ApplyPatchType).
+		AbsPath(m.urlPath(info.Name, info.Namespaced), m.name).
+		Param("fieldManager", fieldManager).
+		Param("force", "true").
+		Body(body).
+		Do(c.ctx).
+		StatusCode(&status).
+		Error()
+	return status == http.StatusOK, err
+}
+
+// patchMetadata merges the labels and annotations of the manifest into the existing object.
+func (c *creater) patchMetadata(m manifest) error {
+	var obj struct {
+		Metadata struct {
+			Labels      map[string]string `json:"labels,omitempty"`
+			Annotations map[string]string `json:"annotations,omitempty"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(m.raw, &obj); err != nil {
+		return fmt.Errorf("failed to unmarshal manifest: %v", err)
+	}
+	patch, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	info, err := c.mapper.resourceInfo(m.apiVersion, m.kind)
+	if err != nil {
+		return fmt.Errorf("dicovery failed: %v", err)
+	}
+	return c.client.Patch(types.MergePatchType).
+		AbsPath(m.urlPath(info.Name, info.Namespaced), m.name).
+		Body(patch).
+		Do(c.ctx).Error()
 }
 
 func (m manifest) urlPath(plural string, namespaced bool) string {
@@ -374,19 +827,28 @@ func parseJSONManifest(data []byte) (manifest, error) {
 		APIVersion string `json:"apiVersion"`
 		Kind       string `json:"kind"`
 		Metadata   struct {
-			Name      string `json:"name"`
-			Namespace string `json:"namespace"`
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Annotations map[string]string `json:"annotations"`
 		} `json:"metadata"`
 	}
 	if err := json.Unmarshal(data, &m); err != nil {
 		return manifest{}, fmt.Errorf("parse manifest: %v", err)
 	}
+	var applyOrder int
+	if v, ok := m.Metadata.Annotations[ApplyOrderAnnotation]; ok {
+		var err error
+		if applyOrder, err = strconv.Atoi(v); err != nil {
+			return manifest{}, fmt.Errorf("invalid %s annotation of %s %s: %q is not an integer", ApplyOrderAnnotation, m.Kind, m.Metadata.Name, v)
+		}
+	}
 	return manifest{
 		kind:       m.Kind,
 		apiVersion: m.APIVersion,
 		namespace:  m.Metadata.Namespace,
 		name:       m.Metadata.Name,
 		raw:        data,
+		applyOrder: applyOrder,
 	}, nil
 }
 
@@ -436,5 +898,6 @@ func (m *resourceMapper) resourceInfo(groupVersion, kind string) (*metav1.APIRes
 			return &r, nil
 		}
 	}
-	return nil, fmt.Errorf("resource %s %s not found", groupVersion, kind)
+	// Usually the CRD of a custom resource isn't established yet, which is retried.
+	return nil, fmt.Errorf("no matches for kind %q in version %q", kind, groupVersion)
 }
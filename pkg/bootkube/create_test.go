@@ -1,9 +1,19 @@
 package bootkube
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
 )
 
 func TestParseManifests(t *testing.T) {
@@ -104,6 +114,25 @@ data:
 				},
 			},
 		},
+		{
+			name: "apply-order",
+			raw: `
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: policy
+  annotations:
+    bootkube.alpha.kubernetes.io/apply-order: "-10"
+`,
+			want: []manifest{
+				{
+					kind:       "ValidatingWebhookConfiguration",
+					apiVersion: "admissionregistration.k8s.io/v1",
+					name:       "policy",
+					applyOrder: -10,
+				},
+			},
+		},
 		{
 			name: "empty-manifests",
 			raw: `
@@ -136,6 +165,10 @@ data:
 		})
 	}
 
+	invalid := "kind: ConfigMap\nmetadata:\n  name: a-config\n  annotations:\n    bootkube.alpha.kubernetes.io/apply-order: first\n"
+	if _, err := parseManifests(strings.NewReader(invalid)); err == nil || !strings.Contains(err.Error(), "not an integer") {
+		t.Errorf("parseManifests() with an invalid apply order = %v, want an error", err)
+	}
 }
 
 func TestManifestURLPath(t *testing.T) {
@@ -169,3 +202,253 @@ func TestManifestURLPath(t *testing.T) {
 		}
 	}
 }
+
+func TestIsSelfHostedControlPlane(t *testing.T) {
+	tests := []struct {
+		m    manifest
+		want bool
+	}{
+		{manifest{kind: "DaemonSet", namespace: "kube-system", name: "kube-apiserver"}, true},
+		{manifest{kind: "Deployment", namespace: "kube-system", name: "kube-scheduler"}, true},
+		{manifest{kind: "PodDisruptionBudget", namespace: "kube-system", name: "kube-controller-manager"}, true},
+		{manifest{kind: "PodDisruptionBudget", namespace: "kube-system", name: "kube-apiserver"}, true},
+		{manifest{kind: "PodDisruptionBudget", namespace: "kube-system", name: "coredns"}, false},
+		{manifest{kind: "Secret", namespace: "kube-system", name: "kube-apiserver"}, false},
+		{manifest{kind: "Deployment", namespace: "kube-system", name: "coredns"}, false},
+		{manifest{kind: "DaemonSet", namespace: "default", name: "kube-apiserver"}, false},
+	}
+	for _, test := range tests {
+		if got := isSelfHostedControlPlane(test.m, "kube-system"); got != test.want {
+			t.Errorf("isSelfHostedControlPlane(%s) = %t, want: %t", test.m, got, test.want)
+		}
+	}
+}
+
+func TestCreateManifestsDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// The creater has no client, creating a manifest would panic.
+	c := &creater{ctx: ctx}
+	ms := []manifest{
+		{kind: "Namespace", apiVersion: "v1", name: "monitoring"},
+		{kind: "ConfigMap", apiVersion: "v1", namespace: "monitoring", name: "config"},
+	}
+	if c.createManifests(ms) {
+		t.Error("createManifests() = true once the deadline passed, want: false")
+	}
+}
+
+func TestStageManifests(t *testing.T) {
+	ms := []manifest{
+		{kind: "DaemonSet", name: "kube-apiserver"},
+		{kind: "ConfigMap", name: "kube-proxy"},
+		{kind: "ServiceAccount", name: "kube-proxy"},
+		{kind: "Secret", name: "kube-apiserver"},
+		{kind: "ClusterRoleBinding", name: "kube-proxy"},
+		{kind: "Service", name: "kube-dns"},
+	}
+	want := [][]manifest{
+		{{kind: "ServiceAccount", name: "kube-proxy"}, {kind: "ClusterRoleBinding", name: "kube-proxy"}},
+		{{kind: "ConfigMap", name: "kube-proxy"}, {kind: "Secret", name: "kube-apiserver"}},
+		{{kind: "DaemonSet", name: "kube-apiserver"}, {kind: "Service", name: "kube-dns"}},
+	}
+	if got := stageManifests(ms); !reflect.DeepEqual(got, want) {
+		t.Errorf("stageManifests() = %v, want: %v", got, want)
+	}
+	// Empty stages are left out.
+	if got := stageManifests(ms[:1]); len(got) != 1 {
+		t.Errorf("stageManifests() of a single workload = %v, want a single stage", got)
+	}
+
+	// Each apply order is staged on its own, lowest first.
+	ms = []manifest{
+		{kind: "Deployment", name: "operator-instance", applyOrder: 10},
+		{kind: "DaemonSet", name: "kube-apiserver"},
+		{kind: "ServiceAccount", name: "operator", applyOrder: 10},
+		{kind: "ValidatingWebhookConfiguration", name: "policy", applyOrder: -5},
+		{kind: "ConfigMap", name: "kube-proxy"},
+	}
+	want = [][]manifest{
+		{{kind: "ValidatingWebhookConfiguration", name: "policy", applyOrder: -5}},
+		{{kind: "ConfigMap", name: "kube-proxy"}},
+		{{kind: "DaemonSet", name: "kube-apiserver"}},
+		{{kind: "ServiceAccount", name: "operator", applyOrder: 10}},
+		{{kind: "Deployment", name: "operator-instance", applyOrder: 10}},
+	}
+	if got := stageManifests(ms); !reflect.DeepEqual(got, want) {
+		t.Errorf("stageManifests() with apply orders = %v, want: %v", got, want)
+	}
+}
+
+func TestCreateParallel(t *testing.T) {
+	var ms []manifest
+	for i := 0; i < 20; i++ {
+		ms = append(ms, manifest{kind: "ConfigMap", name: fmt.Sprintf("config-%d", i)})
+	}
+	c := &creater{ctx: context.Background(), parallelism: 3}
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	created := map[string]bool{}
+	ok := c.createParallel(ms, func(m manifest) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		created[m.name] = true
+		mu.Unlock()
+		if m.name == "config-7" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if ok {
+		t.Error("createParallel() = true with a failed create, want: false")
+	}
+	if len(created) != len(ms) {
+		t.Errorf("created %d manifests, want: %d", len(created), len(ms))
+	}
+	if maxRunning > 3 {
+		t.Errorf("created %d manifests at once, want at most 3", maxRunning)
+	}
+
+	// In strict mode too, the other manifests are still created after a failure, so that all
+	// failures are reported at once.
+	c.strict = true
+	c.parallelism = 1
+	var calls int
+	c.createParallel(ms, func(m manifest) error {
+		calls++
+		return errors.New("failed")
+	})
+	if calls != len(ms) {
+		t.Errorf("started %d creates after a failure in strict mode, want: %d", calls, len(ms))
+	}
+}
+
+func TestCreateManifestsFailures(t *testing.T) {
+	// The apiserver rejects the monitoring namespace and the CRD of etcd clusters.
+	var mu sync.Mutex
+	var created []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"namespaces","kind":"Namespace"},{"name":"configmaps","namespaced":true,"kind":"ConfigMap"}]}`)
+			return
+		case "/apis/apiextensions.k8s.io/v1beta1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"apiextensions.k8s.io/v1beta1","resources":[{"name":"customresourcedefinitions","kind":"CustomResourceDefinition"}]}`)
+			return
+		case "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions", "/api/v1/namespaces":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Invalid","message":"invalid","code":422}`)
+			return
+		}
+		mu.Lock()
+		created = append(created, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+	c, err := newCreater(&rest.Config{Host: srv.URL}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := []manifest{
+		{filepath: "monitoring-ns.yaml", kind: "Namespace", apiVersion: "v1", name: "monitoring", raw: []byte(`{}`)},
+		{filepath: "etcd-crd.yaml", kind: "CustomResourceDefinition", apiVersion: "apiextensions.k8s.io/v1beta1", name: "etcdclusters.etcd.database.coreos.com",
+			raw: []byte(`{"spec":{"group":"etcd.database.coreos.com","names":{"kind":"EtcdCluster"}}}`)},
+		{filepath: "etcd-cluster.yaml", kind: "EtcdCluster", apiVersion: "etcd.database.coreos.com/v1beta2", namespace: "kube-system", name: "etcd", raw: []byte(`{}`)},
+		{filepath: "monitoring-config.yaml", kind: "ConfigMap", apiVersion: "v1", namespace: "monitoring", name: "config", raw: []byte(`{}`)},
+		{filepath: "proxy-config.yaml", kind: "ConfigMap", apiVersion: "v1", namespace: "kube-system", name: "config", raw: []byte(`{}`)},
+	}
+	if c.createManifests(ms) {
+		t.Error("createManifests() = true with failed manifests, want: false")
+	}
+	// The independent config map is still created.
+	if want := []string{"/api/v1/namespaces/kube-system/configmaps"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("created %v, want: %v", created, want)
+	}
+	want := "4 cluster assets could not be created:\n" +
+		"  etcd-cluster.yaml EtcdCluster kube-system/etcd: depends on etcd-crd.yaml CustomResourceDefinition etcdclusters.etcd.database.coreos.com, which failed\n" +
+		"  etcd-crd.yaml CustomResourceDefinition etcdclusters.etcd.database.coreos.com: invalid\n" +
+		"  monitoring-config.yaml ConfigMap monitoring/config: depends on monitoring-ns.yaml Namespace monitoring, which failed\n" +
+		"  monitoring-ns.yaml Namespace monitoring: invalid"
+	sort.Slice(c.failures, func(i, j int) bool { return c.failures[i].File < c.failures[j].File })
+	if got := c.failures.Error(); got != want {
+		t.Errorf("got failures:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCRDEstablished(t *testing.T) {
+	status := "False"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions/etcdclusters.etcd.database.coreos.com" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"kind":"CustomResourceDefinition","status":{"conditions":[{"type":"NamesAccepted","status":"True"},{"type":"Established","status":"%s"}]}}`, status)
+	}))
+	defer srv.Close()
+	c, err := newCreater(&rest.Config{Host: srv.URL}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := manifest{kind: "CustomResourceDefinition", apiVersion: "apiextensions.k8s.io/v1beta1", name: "etcdclusters.etcd.database.coreos.com"}
+
+	if established, err := c.crdEstablished(context.TODO(), m); err != nil || established {
+		t.Errorf("crdEstablished() = %v, %v, want: false, nil", established, err)
+	}
+	status = "True"
+	if established, err := c.crdEstablished(context.TODO(), m); err != nil || !established {
+		t.Errorf("crdEstablished() = %v, %v, want: true, nil", established, err)
+	}
+	m.name = "missing"
+	if _, err := c.crdEstablished(context.TODO(), m); err == nil {
+		t.Error("crdEstablished() of a missing CRD = nil error, want an error")
+	}
+}
+
+func TestApply(t *testing.T) {
+	var existing bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1" {
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"configmaps","namespaced":true,"kind":"ConfigMap"}]}`)
+			return
+		}
+		if r.Method != "PATCH" || r.URL.Path != "/api/v1/namespaces/kube-system/configmaps/kube-proxy" ||
+			r.Header.Get("Content-Type") != "application/apply-patch+yaml" ||
+			r.URL.Query().Get("fieldManager") != "bootkube" || r.URL.Query().Get("force") != "true" {
+			t.Errorf("unexpected request %s %s with content type %s", r.Method, r.URL, r.Header.Get("Content-Type"))
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if !existing {
+			w.WriteHeader(http.StatusCreated)
+		}
+		fmt.Fprint(w, `{"kind":"ConfigMap","apiVersion":"v1"}`)
+	}))
+	defer srv.Close()
+	c, err := newCreater(&rest.Config{Host: srv.URL}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.allowUpdate = true
+	m := manifest{kind: "ConfigMap", apiVersion: "v1", namespace: "kube-system", name: "kube-proxy", raw: []byte(`{"kind":"ConfigMap","apiVersion":"v1"}`)}
+
+	if existed, err := c.createWithRetry(m); err != nil || existed {
+		t.Errorf("createWithRetry() = %v, %v, want: false, nil", existed, err)
+	}
+	existing = true
+	if existed, err := c.createWithRetry(m); err != nil || !existed {
+		t.Errorf("createWithRetry() of an existing object = %v, %v, want: true, nil", existed, err)
+	}
+}
@@ -0,0 +1,149 @@
+package bootkube
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"text/template"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+// breakGlassOU marks client certificates issued by bootkube outside of the normal credential flow,
+// so they can be told apart from the admin and component credentials in the apiserver audit log.
+const breakGlassOU = "bootkube-break-glass"
+
+// CredentialConfig describes a short-lived client credential.
+type CredentialConfig struct {
+	User   string
+	Groups []string
+	TTL    time.Duration
+	// Server is the apiserver URL written to the kubeconfig.
+	Server string
+	// CACert is the PEM encoded cluster CA certificate.
+	CACert []byte
+	// CAKey is the PEM encoded cluster CA private key. When empty, a certificate signing request is
+	// produced for signing by an external CA instead of a certificate.
+	CAKey []byte
+}
+
+// Credential is an issued client credential. When the CA key was not available, Certificate and
+// KubeConfig are empty and CSR contains the request to be signed by the external CA.
+type Credential struct {
+	PrivateKey   []byte
+	Certificate  []byte
+	CSR          []byte
+	KubeConfig   []byte
+	SerialNumber string
+	NotAfter     time.Time
+}
+
+// IssueCredential generates a new private key for the given user and signs a client certificate
+// from the cluster CA that expires after the configured TTL.
+func IssueCredential(cfg CredentialConfig) (*Credential, error) {
+	if cfg.User == "" {
+		return nil, errors.New("user must be set")
+	}
+	if cfg.TTL <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+	caCert, err := tlsutil.ParsePEMEncodedCACert(cfg.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+	key, err := tlsutil.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	certCfg := tlsutil.CertConfig{
+		CommonName:         cfg.User,
+		Organization:       cfg.Groups,
+		OrganizationalUnit: []string{breakGlassOU},
+		Validity:           cfg.TTL,
+		ClientOnly:         true,
+	}
+	cred := &Credential{PrivateKey: tlsutil.EncodePrivateKeyPEM(key)}
+
+	if len(cfg.CAKey) == 0 {
+		if cred.CSR, err = tlsutil.NewCertificateRequestPEM(certCfg, key); err != nil {
+			return nil, err
+		}
+		return cred, nil
+	}
+
+	caKey, err := tlsutil.ParsePEMEncodedPrivateKey(cfg.CAKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA private key: %v", err)
+	}
+	cert, err := tlsutil.NewSignedCertificate(certCfg, key, caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+	cred.Certificate = tlsutil.EncodeCertificatePEM(cert)
+	cred.SerialNumber = cert.SerialNumber.String()
+	cred.NotAfter = cert.NotAfter
+	if cred.KubeConfig, err = credentialKubeConfig(cfg, cred); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// ServerFromKubeConfig returns the apiserver URL of the current context of a kubeconfig.
+func ServerFromKubeConfig(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return "", err
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return "", fmt.Errorf("%s: current context %q not found", path, config.CurrentContext)
+	}
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok {
+		return "", fmt.Errorf("%s: cluster %q not found", path, context.Cluster)
+	}
+	return cluster.Server, nil
+}
+
+var credentialKubeConfigTemplate = template.Must(template.New("kubeconfig").Parse(`apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: {{ .Server }}
+    certificate-authority-data: {{ .CACert }}
+users:
+- name: {{ .User }}
+  user:
+    client-certificate-data: {{ .Cert }}
+    client-key-data: {{ .Key }}
+contexts:
+- context:
+    cluster: local
+    user: {{ .User }}
+  name: {{ .Context }}
+current-context: {{ .Context }}
+`))
+
+func credentialKubeConfig(cfg CredentialConfig, cred *Credential) ([]byte, error) {
+	var buf bytes.Buffer
+	err := credentialKubeConfigTemplate.Execute(&buf, map[string]string{
+		"Server":  cfg.Server,
+		"CACert":  base64.StdEncoding.EncodeToString(cfg.CACert),
+		"User":    strconv.Quote(cfg.User),
+		"Context": strconv.Quote(cfg.User + "@local"),
+		"Cert":    base64.StdEncoding.EncodeToString(cred.Certificate),
+		"Key":     base64.StdEncoding.EncodeToString(cred.PrivateKey),
+	})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,135 @@
+package bootkube
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+func TestIssueCredential(t *testing.T) {
+	caKey, err := tlsutil.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := tlsutil.NewSelfSignedCACertificate(tlsutil.CertConfig{CommonName: "kube-ca"}, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := CredentialConfig{
+		User:   "alice",
+		Groups: []string{"system:masters"},
+		TTL:    2 * time.Hour,
+		Server: "https://10.0.0.1:6443",
+		CACert: tlsutil.EncodeCertificatePEM(caCert),
+		CAKey:  tlsutil.EncodePrivateKeyPEM(caKey),
+	}
+
+	cred, err := IssueCredential(cfg)
+	if err != nil {
+		t.Fatalf("IssueCredential() = %v, want: nil", err)
+	}
+	cert, err := tlsutil.ParsePEMEncodedCACert(cred.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "alice" || len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "system:masters" {
+		t.Errorf("unexpected subject %v", cert.Subject)
+	}
+	if ttl := cert.NotAfter.Sub(time.Now()); ttl > cfg.TTL || ttl < cfg.TTL-time.Minute {
+		t.Errorf("certificate expires in %s, want: %s", ttl, cfg.TTL)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("got ExtKeyUsage %v, want: client auth only", cert.ExtKeyUsage)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: rootPool(caCert), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("certificate does not verify against the CA: %v", err)
+	}
+
+	config, err := clientcmd.Load(cred.KubeConfig)
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	if server := config.Clusters[config.Contexts[config.CurrentContext].Cluster].Server; server != cfg.Server {
+		t.Errorf("kubeconfig server = %q, want: %q", server, cfg.Server)
+	}
+
+	// Without the CA key a CSR is produced instead.
+	cfg.CAKey = nil
+	cred, err = IssueCredential(cfg)
+	if err != nil {
+		t.Fatalf("IssueCredential() = %v, want: nil", err)
+	}
+	if cred.Certificate != nil || cred.KubeConfig != nil {
+		t.Errorf("expected no certificate or kubeconfig in external CA mode")
+	}
+	block, _ := pem.Decode(cred.CSR)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		t.Fatalf("expected a PEM encoded CSR, got %q", cred.CSR)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.Subject.CommonName != "alice" {
+		t.Errorf("CSR common name = %q, want: %q", csr.Subject.CommonName, "alice")
+	}
+}
+
+func rootPool(cert *x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool
+}
+
+func TestCheckKubeConfigExpiry(t *testing.T) {
+	caKey, err := tlsutil.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := tlsutil.NewSelfSignedCACertificate(tlsutil.CertConfig{CommonName: "kube-ca"}, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{ttl: time.Hour},
+		{ttl: -time.Minute, wantErr: true},
+	} {
+		cfg := CredentialConfig{User: "bootkube", TTL: time.Hour, Server: "https://10.0.0.1:6443", CACert: tlsutil.EncodeCertificatePEM(caCert)}
+		key, err := tlsutil.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := tlsutil.NewSignedCertificate(tlsutil.CertConfig{CommonName: "bootkube", Validity: tc.ttl, ClientOnly: true}, key, caCert, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kubeconfig, err := credentialKubeConfig(cfg, &Credential{Certificate: tlsutil.EncodeCertificatePEM(cert), PrivateKey: tlsutil.EncodePrivateKeyPEM(key)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "kubeconfig")
+		if err := ioutil.WriteFile(path, kubeconfig, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkKubeConfigExpiry(path); (err != nil) != tc.wantErr {
+			t.Errorf("ttl %s: checkKubeConfigExpiry() = %v, want error: %t", tc.ttl, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package bootkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// DiffCluster compares the manifests in assetDir with the objects of the cluster and writes the
+// changes re-applying them would make to w. Objects are created or merge patched with server-side
+// dry-run, so the diff includes the defaults and admission changes of the apiserver.
+func DiffCluster(config clientcmd.ClientConfig, assetDir string, w io.Writer) error {
+	manifests, err := loadManifests(filepath.Join(assetDir, asset.AssetPathManifests))
+	if err != nil {
+		return fmt.Errorf("loading manifests: %v", err)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].filepath < manifests[j].filepath
+	})
+	c, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	creater, err := newCreater(c, false)
+	if err != nil {
+		return err
+	}
+
+	var create, update, unchanged, failed int
+	for _, m := range manifests {
+		if string(m.raw) == "null" {
+			continue
+		}
+		created, changes, err := creater.diff(m)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(w, "! %s: %v\n", m, err)
+		case created:
+			create++
+			fmt.Fprintf(w, "+ %s\n", m)
+		case len(changes) > 0:
+			update++
+			fmt.Fprintf(w, "~ %s\n", m)
+			for _, ch := range changes {
+				fmt.Fprintf(w, "    %s\n", ch)
+			}
+		default:
+			unchanged++
+		}
+	}
+	fmt.Fprintf(w, "\n%d to create, %d to update, %d unchanged\n", create, update, unchanged)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d manifests could not be compared", failed, len(manifests))
+	}
+	return nil
+}
+
+// diff dry-runs the manifest against the cluster. It reports whether the object would be created
+// and otherwise the changes to the live object.
+func (c *creater) diff(m manifest) (bool, []fieldChange, error) {
+	info, err := c.mapper.resourceInfo(m.apiVersion, m.kind)
+	if err != nil {
+		return false, nil, fmt.Errorf("discovery failed: %v", err)
+	}
+	path := m.urlPath(info.Name, info.Namespaced)
+
+	live, err := c.client.Get().AbsPath(path, m.name).Do(context.TODO()).Raw()
+	if errors.IsNotFound(err) {
+		err = c.client.Post().
+			AbsPath(path).
+			Param("dryRun", "All").
+			Body(m.raw).
+			SetHeader("Content-Type", "application/json").
+			Do(context.TODO()).Error()
+		return err == nil, nil, err
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	patched, err := c.client.Patch(types.MergePatchType).
+		AbsPath(path, m.name).
+		Param("dryRun", "All").
+		Body(m.raw).
+		Do(context.TODO()).Raw()
+	if err != nil {
+		return false, nil, err
+	}
+
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(live, &before); err != nil {
+		return false, nil, err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return false, nil, err
+	}
+	return false, diffObjects(before, after), nil
+}
+
+// fieldChange is a change of a field of an object. Old is nil for added fields and New for
+// removed fields.
+type fieldChange struct {
+	Path     string
+	Old, New interface{}
+}
+
+func (f fieldChange) String() string {
+	switch {
+	case f.Old == nil:
+		return fmt.Sprintf("+ %s: %s", f.Path, formatValue(f.New))
+	case f.New == nil:
+		return fmt.Sprintf("- %s: %s", f.Path, formatValue(f.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", f.Path, formatValue(f.Old), formatValue(f.New))
+}
+
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// diffIgnoredMetadata are the metadata fields the apiserver maintains, which change without
+// affecting the object.
+var diffIgnoredMetadata = []string{"creationTimestamp", "generation", "managedFields", "resourceVersion", "selfLink", "uid"}
+
+// diffObjects returns the changes from the object before to after, ignoring their status and the
+// metadata maintained by the apiserver. The values of secrets are masked.
+func diffObjects(before, after map[string]interface{}) []fieldChange {
+	for _, obj := range []map[string]interface{}{before, after} {
+		delete(obj, "status")
+		if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+			for _, f := range diffIgnoredMetadata {
+				delete(metadata, f)
+			}
+		}
+	}
+	var changes []fieldChange
+	diffValues("", before, after, &changes)
+	if after["kind"] == "Secret" {
+		for i, ch := range changes {
+			if strings.HasPrefix(ch.Path, "data") || strings.HasPrefix(ch.Path, "stringData") {
+				if ch.Old != nil {
+					changes[i].Old = "(sensitive)"
+				}
+				if ch.New != nil {
+					changes[i].New = "(sensitive)"
+				}
+			}
+		}
+	}
+	return changes
+}
+
+func diffValues(path string, before, after interface{}, changes *[]fieldChange) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for k := range b {
+			keys[k] = true
+		}
+		for k := range a {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(fieldPath(path, k), b[k], a[k], changes)
+		}
+		return
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok || len(a) != len(b) {
+			break
+		}
+		for i := range b {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), b[i], a[i], changes)
+		}
+		return
+	}
+	*changes = append(*changes, fieldChange{Path: path, Old: before, New: after})
+}
+
+var simpleFieldName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// fieldPath appends a field to a path, quoting field names such as label keys that contain dots.
+func fieldPath(path, field string) string {
+	if !simpleFieldName.MatchString(field) {
+		return fmt.Sprintf("%s[%q]", path, field)
+	}
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
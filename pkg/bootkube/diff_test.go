@@ -0,0 +1,53 @@
+package bootkube
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffObjects(t *testing.T) {
+	parse := func(s string) map[string]interface{} {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	cases := []struct {
+		before, after string
+		want          []string
+	}{
+		{
+			before: `{"kind": "ConfigMap", "metadata": {"name": "a", "resourceVersion": "1"}, "data": {"k": "v"}}`,
+			after:  `{"kind": "ConfigMap", "metadata": {"name": "a", "resourceVersion": "2"}, "data": {"k": "v"}}`,
+			want:   nil,
+		},
+		{
+			before: `{"kind": "DaemonSet", "metadata": {"labels": {"k8s-app": "proxy"}}, "spec": {"containers": [{"image": "a:1", "args": ["-v"]}]}, "status": {"ready": 1}}`,
+			after:  `{"kind": "DaemonSet", "metadata": {"labels": {"k8s-app": "proxy", "node-role.kubernetes.io/master": ""}}, "spec": {"containers": [{"image": "a:2"}]}, "status": {"ready": 0}}`,
+			want: []string{
+				`+ metadata.labels["node-role.kubernetes.io/master"]: ""`,
+				`- spec.containers[0].args: ["-v"]`,
+				`~ spec.containers[0].image: "a:1" -> "a:2"`,
+			},
+		},
+		{
+			before: `{"kind": "Secret", "data": {"ca.crt": "b2xk"}}`,
+			after:  `{"kind": "Secret", "data": {"ca.crt": "bmV3", "ca.key": "a2V5"}}`,
+			want: []string{
+				`~ data["ca.crt"]: "(sensitive)" -> "(sensitive)"`,
+				`+ data["ca.key"]: "(sensitive)"`,
+			},
+		},
+	}
+	for i, c := range cases {
+		var got []string
+		for _, ch := range diffObjects(parse(c.before), parse(c.after)) {
+			got = append(got, ch.String())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: got changes %q, want: %q", i, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package bootkube
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// Rotating the encryption at rest key of a cluster is done in three steps, each rolled out to all
+// apiservers before the next one:
+//
+//  1. AddEncryptionKey, so that every apiserver can decrypt secrets written with the new key.
+//  2. PromoteEncryptionKey, so that new writes use the new key, then re-encrypt all secrets.
+//  3. PruneEncryptionKeys, once no secret is encrypted with an old key.
+//
+// Each step updates the EncryptionConfiguration in the asset directory and the kube-apiserver
+// secret manifest.
+
+// AddEncryptionKey appends a new key to the encryption provider of secrets and returns its name.
+func AddEncryptionKey(assetDir string) (string, error) {
+	var name string
+	err := updateEncryptionKeys(assetDir, func(keys []interface{}) ([]interface{}, error) {
+		secret, err := asset.NewEncryptionKey()
+		if err != nil {
+			return nil, err
+		}
+		name = nextEncryptionKeyName(keys)
+		return append(keys, map[string]interface{}{"name": name, "secret": secret}), nil
+	})
+	return name, err
+}
+
+// PromoteEncryptionKey makes the last added key the one new secrets are encrypted with and returns
+// its name.
+func PromoteEncryptionKey(assetDir string) (string, error) {
+	var name string
+	err := updateEncryptionKeys(assetDir, func(keys []interface{}) ([]interface{}, error) {
+		if len(keys) < 2 {
+			return nil, errors.New("there is no new key to promote, add one first")
+		}
+		last := keys[len(keys)-1]
+		name = encryptionKeyName(last)
+		return append([]interface{}{last}, keys[:len(keys)-1]...), nil
+	})
+	return name, err
+}
+
+// PruneEncryptionKeys removes all keys but the one new secrets are encrypted with and returns the
+// names of the removed keys.
+func PruneEncryptionKeys(assetDir string) ([]string, error) {
+	var pruned []string
+	err := updateEncryptionKeys(assetDir, func(keys []interface{}) ([]interface{}, error) {
+		for _, k := range keys[1:] {
+			pruned = append(pruned, encryptionKeyName(k))
+		}
+		return keys[:1], nil
+	})
+	return pruned, err
+}
+
+// updateEncryptionKeys applies update to the keys of the aescbc or secretbox provider of secrets.
+func updateEncryptionKeys(assetDir string, update func(keys []interface{}) ([]interface{}, error)) error {
+	configPath := filepath.Join(assetDir, asset.AssetPathEncryptionConfig)
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("error reading encryption config, was the cluster rendered with --encryption-provider? %v", err)
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", configPath, err)
+	}
+	provider, err := secretsEncryptionProvider(config)
+	if err != nil {
+		return fmt.Errorf("%s: %v", configPath, err)
+	}
+	keys, _ := provider["keys"].([]interface{})
+	if len(keys) == 0 {
+		return fmt.Errorf("%s: the encryption provider of secrets has no keys", configPath)
+	}
+	if provider["keys"], err = update(keys); err != nil {
+		return err
+	}
+	if b, err = yaml.Marshal(config); err != nil {
+		return err
+	}
+
+	// Update the secret first so that a failure leaves the asset directory unchanged. A static
+	// control plane has no secret, it reads the configuration from the host.
+	if !IsStaticControlPlane(assetDir) {
+		secretPath := filepath.Join(assetDir, asset.AssetPathAPIServerSecret)
+		if err := updateSecretFile(secretPath, filepath.Base(asset.AssetPathEncryptionConfig), b); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(configPath, b, 0600)
+}
+
+// secretsEncryptionProvider returns the settings of the first aescbc or secretbox provider for
+// secrets in an EncryptionConfiguration.
+func secretsEncryptionProvider(config map[string]interface{}) (map[string]interface{}, error) {
+	resources, _ := config["resources"].([]interface{})
+	for _, r := range resources {
+		r, _ := r.(map[string]interface{})
+		names, _ := r["resources"].([]interface{})
+		var secrets bool
+		for _, n := range names {
+			if n == "secrets" {
+				secrets = true
+			}
+		}
+		if !secrets {
+			continue
+		}
+		providers, _ := r["providers"].([]interface{})
+		for _, p := range providers {
+			p, _ := p.(map[string]interface{})
+			for _, name := range []string{asset.EncryptionProviderAESCBC, asset.EncryptionProviderSecretbox} {
+				if settings, ok := p[name].(map[string]interface{}); ok {
+					return settings, nil
+				}
+			}
+		}
+		return nil, errors.New("secrets are not encrypted with the aescbc or secretbox provider")
+	}
+	return nil, errors.New("secrets are not encrypted")
+}
+
+func encryptionKeyName(key interface{}) string {
+	k, _ := key.(map[string]interface{})
+	name, _ := k["name"].(string)
+	return name
+}
+
+// nextEncryptionKeyName returns "key<n>", with n one more than the highest numbered key.
+func nextEncryptionKeyName(keys []interface{}) string {
+	var max int
+	for _, k := range keys {
+		if n, err := strconv.Atoi(strings.TrimPrefix(encryptionKeyName(k), "key")); err == nil && n > max {
+			max = n
+		}
+	}
+	return fmt.Sprintf("key%d", max+1)
+}
+
+// updateSecretFile sets a data key of the Secret manifest at path.
+func updateSecretFile(path, key string, value []byte) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var secret map[string]interface{}
+	if err := yaml.Unmarshal(b, &secret); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	data, ok := secret["data"].(map[string]interface{})
+	if !ok || data[key] == nil {
+		return fmt.Errorf("%s has no %s", path, key)
+	}
+	data[key] = base64.StdEncoding.EncodeToString(value)
+	if b, err = yaml.Marshal(secret); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
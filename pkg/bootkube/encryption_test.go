@@ -0,0 +1,117 @@
+package bootkube
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+const testEncryptionConfig = `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources:
+      - secrets
+    providers:
+      - aescbc:
+          keys:
+            - name: key1
+              secret: c2VjcmV0IGlzIHNlY3VyZSwgb3IgaXMgaXQ/Cg==
+      - identity: {}
+`
+
+func TestRotateEncryptionKey(t *testing.T) {
+	assetDir, err := ioutil.TempDir("", "bootkube-encryption")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(assetDir)
+	for _, dir := range []string{asset.AssetPathSecrets, asset.AssetPathManifests} {
+		if err := os.MkdirAll(filepath.Join(assetDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(assetDir, asset.AssetPathEncryptionConfig), []byte(testEncryptionConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: kube-apiserver\n  namespace: kube-system\ntype: Opaque\ndata:\n  ca.crt: Y2E=\n  encryption-config.yaml: " + base64.StdEncoding.EncodeToString([]byte(testEncryptionConfig)) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(assetDir, asset.AssetPathAPIServerSecret), []byte(secret), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// keyNames returns the key names of the asset directory and the secret manifest.
+	keyNames := func() []string {
+		b, err := ioutil.ReadFile(filepath.Join(assetDir, asset.AssetPathAPIServerSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s struct {
+			Data map[string]string
+		}
+		if err := yaml.Unmarshal(b, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Data["ca.crt"] != "Y2E=" {
+			t.Errorf("other secret data changed: %v", s.Data)
+		}
+		fromSecret, err := base64.StdEncoding.DecodeString(s.Data["encryption-config.yaml"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromAssets, err := ioutil.ReadFile(filepath.Join(assetDir, asset.AssetPathEncryptionConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(fromSecret) != string(fromAssets) {
+			t.Errorf("secret and asset directory encryption configs differ")
+		}
+		var config map[string]interface{}
+		if err := yaml.Unmarshal(fromAssets, &config); err != nil {
+			t.Fatal(err)
+		}
+		provider, err := secretsEncryptionProvider(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, k := range provider["keys"].([]interface{}) {
+			names = append(names, encryptionKeyName(k))
+		}
+		return names
+	}
+
+	if _, err := PromoteEncryptionKey(assetDir); err == nil {
+		t.Error("expected error promoting without a new key")
+	}
+	if name, err := AddEncryptionKey(assetDir); err != nil || name != "key2" {
+		t.Fatalf("AddEncryptionKey() = %q, %v, want: key2", name, err)
+	}
+	if got, want := keyNames(), []string{"key1", "key2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after add: got keys %v, want: %v", got, want)
+	}
+	if name, err := PromoteEncryptionKey(assetDir); err != nil || name != "key2" {
+		t.Fatalf("PromoteEncryptionKey() = %q, %v, want: key2", name, err)
+	}
+	if got, want := keyNames(), []string{"key2", "key1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after promote: got keys %v, want: %v", got, want)
+	}
+	pruned, err := PruneEncryptionKeys(assetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"key1"}; !reflect.DeepEqual(pruned, want) {
+		t.Errorf("pruned %v, want: %v", pruned, want)
+	}
+	if got, want := keyNames(), []string{"key2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after prune: got keys %v, want: %v", got, want)
+	}
+	if name, err := AddEncryptionKey(assetDir); err != nil || name != "key3" {
+		t.Errorf("AddEncryptionKey() = %q, %v, want: key3", name, err)
+	}
+}
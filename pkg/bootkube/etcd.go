@@ -0,0 +1,117 @@
+package bootkube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// etcdStatusTimeout bounds the status request to each etcd member.
+const etcdStatusTimeout = 5 * time.Second
+
+// EtcdClient is the part of the etcd client bootkube start checks the health of etcd with.
+// *clientv3.Client implements it.
+type EtcdClient interface {
+	clientv3.Cluster
+	clientv3.Maintenance
+}
+
+// EtcdHealth is what bootkube start expects of the self-hosted etcd members, all members but the
+// bootstrap one, before it tears down the bootstrap control plane. Beyond them, the members must
+// agree on a leader and the cluster must have no alarms.
+type EtcdHealth struct {
+	// Members is how many self-hosted members to wait for, any number if zero.
+	Members int
+	// MinHealthy is how many self-hosted members must be healthy, a quorum of them if zero.
+	MinHealthy int
+}
+
+// etcdHealthy returns an error unless the self-hosted members of etcd meet the expectations of h.
+func etcdHealthy(ctx context.Context, etcd EtcdClient, h EtcdHealth) error {
+	resp, err := etcd.MemberList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list the etcd members: %v", err)
+	}
+	var members, healthy int
+	var unhealthy []string
+	leaders := map[uint64]bool{}
+	for _, m := range resp.Members {
+		// Members that haven't started yet have no name.
+		if m.Name == bootstrapEtcdMember || m.Name == "" || m.IsLearner {
+			continue
+		}
+		members++
+		var status *clientv3.StatusResponse
+		for _, u := range m.ClientURLs {
+			statusCtx, cancel := context.WithTimeout(ctx, etcdStatusTimeout)
+			status, err = etcd.Status(statusCtx, u)
+			cancel()
+			if err == nil {
+				break
+			}
+		}
+		switch {
+		case status == nil:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %v", m.Name, err))
+		case len(status.Errors) > 0:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", m.Name, strings.Join(status.Errors, ", ")))
+		case status.Leader == 0:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: no leader", m.Name))
+		default:
+			healthy++
+			leaders[status.Leader] = true
+		}
+	}
+
+	if members < h.Members {
+		return fmt.Errorf("%d of %d self-hosted etcd members started", members, h.Members)
+	}
+	minHealthy := h.MinHealthy
+	if minHealthy == 0 {
+		minHealthy = members/2 + 1
+	}
+	if healthy < minHealthy {
+		return fmt.Errorf("%d self-hosted etcd members are healthy, want %d: %s", healthy, minHealthy, strings.Join(unhealthy, "; "))
+	}
+	if len(leaders) > 1 {
+		return fmt.Errorf("the self-hosted etcd members disagree on the leader")
+	}
+
+	alarms, err := etcd.AlarmList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list the etcd alarms: %v", err)
+	}
+	if len(alarms.Alarms) > 0 {
+		var s []string
+		for _, a := range alarms.Alarms {
+			s = append(s, fmt.Sprintf("%s on member %x", a.Alarm, a.MemberID))
+		}
+		return fmt.Errorf("etcd has alarms: %s", strings.Join(s, ", "))
+	}
+	return nil
+}
+
+// waitForEtcdHealthy waits for the self-hosted etcd members to meet the expectations of h.
+func waitForEtcdHealthy(ctx context.Context, etcd EtcdClient, h EtcdHealth) error {
+	UserOutput("Waiting for the self-hosted etcd cluster to be healthy...\n")
+	var lastErr error
+	err := wait.PollImmediateUntil(pivotInterval, func() (bool, error) {
+		lastErr = etcdHealthy(ctx, etcd, h)
+		if lastErr != nil {
+			debugf("etcd isn't healthy yet: %v", lastErr)
+		}
+		return lastErr == nil, nil
+	}, ctx.Done())
+	if err != nil && lastErr != nil {
+		return fmt.Errorf("the self-hosted etcd cluster isn't healthy, not pivoting: %v", lastErr)
+	}
+	if err != nil {
+		return err
+	}
+	UserOutput("The self-hosted etcd cluster is healthy\n")
+	return nil
+}
@@ -0,0 +1,99 @@
+package bootkube
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/etcdserverpb"
+)
+
+// fakeEtcd is an etcd cluster whose members report the statuses by client URL.
+type fakeEtcd struct {
+	fakeEtcdCluster
+	clientv3.Maintenance
+	statuses map[string]*clientv3.StatusResponse
+	alarms   []*etcdserverpb.AlarmMember
+}
+
+func (f *fakeEtcd) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	if s, ok := f.statuses[endpoint]; ok {
+		return s, nil
+	}
+	return nil, errors.New("connection refused")
+}
+
+func (f *fakeEtcd) AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error) {
+	return &clientv3.AlarmResponse{Alarms: f.alarms}, nil
+}
+
+func TestEtcdHealthy(t *testing.T) {
+	members := []*etcdserverpb.Member{
+		{ID: 1, Name: bootstrapEtcdMember, ClientURLs: []string{"https://10.0.0.1:12379"}},
+		{ID: 2, Name: "etcd-a", ClientURLs: []string{"https://10.0.0.2:2379"}},
+		{ID: 3, Name: "etcd-b", ClientURLs: []string{"https://10.0.0.3:2379"}},
+		{ID: 4, Name: "etcd-c", ClientURLs: []string{"https://10.0.0.4:2379"}},
+	}
+	healthy := &clientv3.StatusResponse{Leader: 2}
+	for _, tt := range []struct {
+		name     string
+		members  []*etcdserverpb.Member
+		statuses map[string]*clientv3.StatusResponse
+		alarms   []*etcdserverpb.AlarmMember
+		health   EtcdHealth
+		wantErr  string
+	}{{
+		name:     "all healthy",
+		members:  members,
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.2:2379": healthy, "https://10.0.0.3:2379": healthy, "https://10.0.0.4:2379": healthy},
+		health:   EtcdHealth{Members: 3},
+	}, {
+		name:     "quorum healthy",
+		members:  members,
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.2:2379": healthy, "https://10.0.0.3:2379": healthy},
+	}, {
+		name:     "all must be healthy",
+		members:  members,
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.2:2379": healthy, "https://10.0.0.3:2379": healthy},
+		health:   EtcdHealth{MinHealthy: 3},
+		wantErr:  "2 self-hosted etcd members are healthy, want 3: etcd-c: connection refused",
+	}, {
+		name:     "only the bootstrap member is healthy",
+		members:  members,
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.1:12379": healthy, "https://10.0.0.2:2379": healthy},
+		wantErr:  "1 self-hosted etcd members are healthy, want 2",
+	}, {
+		name:     "members still starting",
+		members:  append(members[:3:3], &etcdserverpb.Member{ID: 4, PeerURLs: []string{"https://10.0.0.4:2380"}}),
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.2:2379": healthy, "https://10.0.0.3:2379": healthy},
+		health:   EtcdHealth{Members: 3},
+		wantErr:  "2 of 3 self-hosted etcd members started",
+	}, {
+		name:     "no leader",
+		members:  members[:2],
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.2:2379": {}},
+		wantErr:  "etcd-a: no leader",
+	}, {
+		name:     "split leaders",
+		members:  members[:3],
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.2:2379": healthy, "https://10.0.0.3:2379": {Leader: 3}},
+		wantErr:  "disagree on the leader",
+	}, {
+		name:     "alarm",
+		members:  members,
+		statuses: map[string]*clientv3.StatusResponse{"https://10.0.0.2:2379": healthy, "https://10.0.0.3:2379": healthy, "https://10.0.0.4:2379": healthy},
+		alarms:   []*etcdserverpb.AlarmMember{{MemberID: 3, Alarm: etcdserverpb.AlarmType_NOSPACE}},
+		wantErr:  "etcd has alarms: NOSPACE on member 3",
+	}} {
+		etcd := &fakeEtcd{fakeEtcdCluster: fakeEtcdCluster{members: tt.members}, statuses: tt.statuses, alarms: tt.alarms}
+		err := etcdHealthy(context.TODO(), etcd, tt.health)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: etcdHealthy() = %v, want: nil", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: etcdHealthy() = %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
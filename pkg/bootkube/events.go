@@ -0,0 +1,227 @@
+package bootkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/version"
+)
+
+const (
+	bootstrapNamespace     = "kube-system"
+	bootstrapConfigMapName = "bootkube-bootstrap"
+	bootstrapComponent     = "bootkube"
+	// bootstrapRecordTimeout bounds recording the bootstrap, best effort after it's over.
+	bootstrapRecordTimeout = 30 * time.Second
+)
+
+// The reasons of the events bootkube start posts.
+const (
+	reasonPhaseCompleted     = "PhaseCompleted"
+	reasonAssetFailed        = "AssetFailed"
+	reasonAssetPruned        = "AssetPruned"
+	reasonBootstrapSucceeded = "BootstrapSucceeded"
+	reasonBootstrapFailed    = "BootstrapFailed"
+)
+
+// bootstrapSummary is the outcome of a bootkube start.
+type bootstrapSummary struct {
+	Node      string        `json:"node"`
+	Version   string        `json:"version"`
+	Started   time.Time     `json:"started"`
+	Completed time.Time     `json:"completed"`
+	Phases    []phaseTiming `json:"phases"`
+	// Assets counts the manifests by status, and Failed and Pruned are those that failed and
+	// the objects that were pruned.
+	Assets map[string]int `json:"assets"`
+	Failed []string       `json:"failed,omitempty"`
+	Pruned []string       `json:"pruned,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// summary returns the summary of the bootkube start that ended with err.
+func (p *progress) summary(err error) bootstrapSummary {
+	p.Lock()
+	defer p.Unlock()
+	node, _ := os.Hostname()
+	s := bootstrapSummary{
+		Node:      node,
+		Version:   version.Version,
+		Started:   p.start.UTC(),
+		Completed: time.Now().UTC(),
+		Phases:    append([]phaseTiming{}, p.completed...),
+		Assets:    map[string]int{},
+	}
+	for a, status := range p.assets {
+		s.Assets[status]++
+		name := strings.TrimSpace(manifest{filepath: a.file, kind: a.kind, namespace: a.namespace, name: a.name}.String())
+		switch status {
+		case assetFailed:
+			s.Failed = append(s.Failed, name)
+		case assetPruned:
+			s.Pruned = append(s.Pruned, name)
+		}
+	}
+	sort.Strings(s.Failed)
+	sort.Strings(s.Pruned)
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s
+}
+
+// reachedAPIServer reports whether bootkube start got as far as an apiserver.
+func (p *progress) reachedAPIServer() bool {
+	if p == nil {
+		return false
+	}
+	p.Lock()
+	defer p.Unlock()
+	for _, t := range p.completed {
+		if t.Phase == phaseWaitingForAPIServer {
+			return true
+		}
+	}
+	return false
+}
+
+// recordBootstrap records the summary of the bootkube start that ended with err in the cluster,
+// unless it never got as far as an apiserver. It's best effort: the cluster may be gone after a
+// failure.
+func (b *bootkube) recordBootstrap(err error) {
+	if b.kubeConfigPath == "" || !b.progress.reachedAPIServer() {
+		return
+	}
+	config, cerr := clientcmd.BuildConfigFromFlags("", b.kubeConfigPath)
+	if cerr != nil {
+		UserWarning("failed to record the bootstrap: %v\n", cerr)
+		return
+	}
+	config.Timeout = bootstrapRecordTimeout
+	client, cerr := kubernetes.NewForConfig(config)
+	if cerr != nil {
+		UserWarning("failed to record the bootstrap: %v\n", cerr)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), bootstrapRecordTimeout)
+	defer cancel()
+	if err := postBootstrapSummary(ctx, client, b.progress.summary(err)); err != nil {
+		UserWarning("failed to record the bootstrap: %v\n", err)
+		return
+	}
+	UserOutput("Recorded the bootstrap in the %s/%s config map\n", bootstrapNamespace, bootstrapConfigMapName)
+}
+
+// postBootstrapSummary writes the summary of a bootkube start to the bootkube-bootstrap ConfigMap
+// of kube-system and posts its phases, failed and pruned assets and outcome as events of the
+// ConfigMap, so that how a cluster was bootstrapped can be audited without the logs of the
+// bootstrap node. The ConfigMap is replaced by every bootkube start, the events are kept for the
+// event TTL of the apiserver.
+func postBootstrapSummary(ctx context.Context, client kubernetes.Interface, s bootstrapSummary) error {
+	phases, err := json.Marshal(s.Phases)
+	if err != nil {
+		return err
+	}
+	assets, err := json.Marshal(s.Assets)
+	if err != nil {
+		return err
+	}
+	outcome := "succeeded"
+	if s.Error != "" {
+		outcome = "failed"
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapConfigMapName,
+			Namespace: bootstrapNamespace,
+		},
+		Data: map[string]string{
+			"outcome":   outcome,
+			"node":      s.Node,
+			"version":   s.Version,
+			"started":   s.Started.Format(time.RFC3339),
+			"completed": s.Completed.Format(time.RFC3339),
+			"duration":  s.Completed.Sub(s.Started).Round(time.Second).String(),
+			"phases":    string(phases),
+			"assets":    string(assets),
+		},
+	}
+	if s.Error != "" {
+		cm.Data["error"] = s.Error
+	}
+	configMaps := client.CoreV1().ConfigMaps(bootstrapNamespace)
+	created, err := configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		var existing *corev1.ConfigMap
+		if existing, err = configMaps.Get(ctx, bootstrapConfigMapName, metav1.GetOptions{}); err == nil {
+			existing.Data = cm.Data
+			created, err = configMaps.Update(ctx, existing, metav1.UpdateOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the %s config map: %v", bootstrapConfigMapName, err)
+	}
+
+	type event struct {
+		eventType, reason, message string
+		at                         time.Time
+	}
+	var events []event
+	for _, t := range s.Phases {
+		events = append(events, event{corev1.EventTypeNormal, reasonPhaseCompleted,
+			fmt.Sprintf("Completed phase %s in %s", t.Phase, t.Completed.Sub(t.Started).Round(time.Millisecond)), t.Completed})
+	}
+	for _, a := range s.Failed {
+		events = append(events, event{corev1.EventTypeWarning, reasonAssetFailed, fmt.Sprintf("Failed to create %s", a), s.Completed})
+	}
+	for _, a := range s.Pruned {
+		events = append(events, event{corev1.EventTypeNormal, reasonAssetPruned, fmt.Sprintf("Pruned %s", a), s.Completed})
+	}
+	if s.Error != "" {
+		events = append(events, event{corev1.EventTypeWarning, reasonBootstrapFailed, fmt.Sprintf("bootkube start failed on %s: %s", s.Node, s.Error), s.Completed})
+	} else {
+		events = append(events, event{corev1.EventTypeNormal, reasonBootstrapSucceeded, fmt.Sprintf("bootkube start succeeded on %s in %s", s.Node, cm.Data["duration"]), s.Completed})
+	}
+
+	ref := corev1.ObjectReference{
+		Kind:            "ConfigMap",
+		APIVersion:      "v1",
+		Namespace:       bootstrapNamespace,
+		Name:            bootstrapConfigMapName,
+		UID:             created.UID,
+		ResourceVersion: created.ResourceVersion,
+	}
+	for i, e := range events {
+		at := metav1.NewTime(e.at)
+		_, err := client.CoreV1().Events(bootstrapNamespace).Create(ctx, &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				// Events are named after the object and a unique suffix, like the event recorder does.
+				Name:      fmt.Sprintf("%s.%x", bootstrapConfigMapName, s.Completed.UnixNano()+int64(i)),
+				Namespace: bootstrapNamespace,
+			},
+			InvolvedObject: ref,
+			Reason:         e.reason,
+			Message:        e.message,
+			Type:           e.eventType,
+			Source:         corev1.EventSource{Component: bootstrapComponent, Host: s.Node},
+			FirstTimestamp: at,
+			LastTimestamp:  at,
+			Count:          1,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to post the %s event: %v", e.reason, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package bootkube
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPostBootstrapSummary(t *testing.T) {
+	p := newProgress(nil)
+	p.setPhase(phaseWaitingForAPIServer)
+	if p.reachedAPIServer() {
+		t.Error("reachedAPIServer() = true while waiting for the apiserver, want: false")
+	}
+	p.setPhase(phaseCreatingAssets)
+	p.setAsset(manifest{filepath: "manifests/a.yaml", kind: "ConfigMap", namespace: "kube-system", name: "a"}, assetCreated)
+	p.setAsset(manifest{filepath: "manifests/b.yaml", kind: "ConfigMap", namespace: "kube-system", name: "b"}, assetFailed)
+	p.setAsset(manifest{kind: "ConfigMap", namespace: "kube-system", name: "c"}, assetPruned)
+	if !p.reachedAPIServer() {
+		t.Error("reachedAPIServer() = false after waiting for the apiserver, want: true")
+	}
+	p.fail(errors.New("required pods not running"))
+
+	client := fake.NewSimpleClientset()
+	ctx := context.TODO()
+	for i := 0; i < 2; i++ {
+		if err := postBootstrapSummary(ctx, client, p.summary(errors.New("required pods not running"))); err != nil {
+			t.Fatalf("postBootstrapSummary() failed: %v", err)
+		}
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(bootstrapNamespace).Get(ctx, bootstrapConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"outcome": "failed",
+		"assets":  `{"created":1,"failed":1,"pruned":1}`,
+		"error":   "required pods not running",
+	} {
+		if cm.Data[k] != want {
+			t.Errorf("config map %s = %q, want %q", k, cm.Data[k], want)
+		}
+	}
+
+	events, err := client.CoreV1().Events(bootstrapNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, e := range events.Items {
+		if e.InvolvedObject.Name != bootstrapConfigMapName || e.Source.Component != bootstrapComponent {
+			t.Errorf("event %s is about %s from %s, want the %s config map from %s", e.Name, e.InvolvedObject.Name, e.Source.Component, bootstrapConfigMapName, bootstrapComponent)
+		}
+		if e.Reason == reasonAssetFailed && e.Message != "Failed to create manifests/b.yaml ConfigMap kube-system/b" {
+			t.Errorf("unexpected %s event message %q", e.Reason, e.Message)
+		}
+		reasons = append(reasons, e.Reason)
+	}
+	// Posting twice posts the events twice.
+	want := map[string]int{reasonPhaseCompleted: 4, reasonAssetFailed: 2, reasonAssetPruned: 2, reasonBootstrapFailed: 2}
+	got := map[string]int{}
+	for _, r := range reasons {
+		got[r]++
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("posted events %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,325 @@
+package bootkube
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+const (
+	historyNamespace     = "kube-system"
+	historyConfigMapName = "bootkube-history"
+	historyRevisionKey   = "revision-"
+	historySnapshotKey   = "manifests.tar.gz"
+	historyLabel         = "bootkube.alpha.kubernetes.io/history"
+)
+
+// Operations that are recorded in the cluster history.
+const (
+	OperationStart    = "start"
+	OperationRecover  = "recover"
+	OperationRollback = "rollback"
+)
+
+// HistoryEntry describes a single bootkube operation that was performed against a cluster.
+type HistoryEntry struct {
+	Revision    int       `json:"revision"`
+	Operation   string    `json:"operation"`
+	User        string    `json:"user"`
+	Timestamp   time.Time `json:"timestamp"`
+	FromVersion string    `json:"fromVersion,omitempty"`
+	ToVersion   string    `json:"toVersion"`
+	AssetHash   string    `json:"assetHash,omitempty"`
+}
+
+// RecordHistory appends an entry for the given operation to the in-cluster history. The manifests
+// found in assetDir are snapshotted alongside the entry so that they can later be restored with
+// RestoreRevision. The Revision, User, Timestamp, FromVersion and AssetHash fields are filled in
+// automatically when left empty.
+func RecordHistory(client kubernetes.Interface, entry HistoryEntry, assetDir string) (*HistoryEntry, error) {
+	ctx := context.TODO()
+	cm, err := client.CoreV1().ConfigMaps(historyNamespace).Get(ctx, historyConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm, err = client.CoreV1().ConfigMaps(historyNamespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      historyConfigMapName,
+				Namespace: historyNamespace,
+				Labels:    map[string]string{historyLabel: "true"},
+			},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %v", err)
+	}
+
+	entries, err := historyFromConfigMap(cm)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Revision == 0 {
+		entry.Revision = 1
+		if len(entries) > 0 {
+			entry.Revision = entries[len(entries)-1].Revision + 1
+		}
+	}
+	if entry.FromVersion == "" && len(entries) > 0 {
+		entry.FromVersion = entries[len(entries)-1].ToVersion
+	}
+	if entry.User == "" {
+		entry.User = currentUser()
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+
+	var snapshot []byte
+	if assetDir != "" {
+		if entry.AssetHash == "" {
+			if entry.AssetHash, err = HashAssetDir(assetDir); err != nil {
+				return nil, err
+			}
+		}
+		if snapshot, err = snapshotManifests(filepath.Join(assetDir, asset.AssetPathManifests)); err != nil {
+			return nil, err
+		}
+	}
+
+	// The snapshot contains secrets, so it is stored in a Secret rather than the ConfigMap.
+	if snapshot != nil {
+		_, err = client.CoreV1().Secrets(historyNamespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      historySecretName(entry.Revision),
+				Namespace: historyNamespace,
+				Labels:    map[string]string{historyLabel: "true"},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{historySnapshotKey: snapshot},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store snapshot for revision %d: %v", entry.Revision, err)
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	key := historyRevisionKey + strconv.Itoa(entry.Revision)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if cm == nil {
+			if cm, err = client.CoreV1().ConfigMaps(historyNamespace).Get(ctx, historyConfigMapName, metav1.GetOptions{}); err != nil {
+				return err
+			}
+			if _, ok := cm.Data[key]; ok {
+				return fmt.Errorf("revision %d was recorded concurrently", entry.Revision)
+			}
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[key] = string(data)
+		_, err := client.CoreV1().ConfigMaps(historyNamespace).Update(ctx, cm, metav1.UpdateOptions{})
+		// The history changed meanwhile, it's retried on the latest one.
+		cm = nil
+		return err
+	})
+	if err != nil {
+		// The snapshot of a revision that isn't recorded is never restored.
+		if snapshot != nil {
+			if derr := client.CoreV1().Secrets(historyNamespace).Delete(ctx, historySecretName(entry.Revision), metav1.DeleteOptions{}); derr != nil {
+				UserWarning("failed to remove the snapshot of revision %d: %v\n", entry.Revision, derr)
+			}
+		}
+		return nil, fmt.Errorf("failed to record history: %v", err)
+	}
+	return &entry, nil
+}
+
+// ListHistory returns all recorded history entries, ordered by revision.
+func ListHistory(client kubernetes.Interface) ([]HistoryEntry, error) {
+	cm, err := client.CoreV1().ConfigMaps(historyNamespace).Get(context.TODO(), historyConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %v", err)
+	}
+	return historyFromConfigMap(cm)
+}
+
+// RestoreRevision writes the manifests that were snapshotted for the given revision into
+// assetDir, using the same layout as `bootkube render`.
+func RestoreRevision(client kubernetes.Interface, revision int, assetDir string) error {
+	secret, err := client.CoreV1().Secrets(historyNamespace).Get(context.TODO(), historySecretName(revision), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("no manifest snapshot recorded for revision %d", revision)
+	}
+	if err != nil {
+		return err
+	}
+	as, err := restoreManifests(secret.Data[historySnapshotKey])
+	if err != nil {
+		return fmt.Errorf("failed to restore revision %d: %v", revision, err)
+	}
+	return as.WriteFiles(assetDir)
+}
+
+func historyFromConfigMap(cm *corev1.ConfigMap) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	for k, v := range cm.Data {
+		if !strings.HasPrefix(k, historyRevisionKey) {
+			continue
+		}
+		var e HistoryEntry
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse history entry %s: %v", k, err)
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Revision < entries[j].Revision
+	})
+	return entries, nil
+}
+
+func historySecretName(revision int) string {
+	return fmt.Sprintf("%s-%d", historyConfigMapName, revision)
+}
+
+func currentUser() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name = name + "@" + host
+	}
+	return name
+}
+
+// HashAssetDir returns a stable SHA-256 digest over the relative paths and content of every file
+// in the asset directory.
+func HashAssetDir(assetDir string) (string, error) {
+	var files []string
+	err := filepath.Walk(assetDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		rel, err := filepath.Rel(assetDir, f)
+		if err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// snapshotManifests returns a gzipped tarball of the manifest directory. Returns nil if the
+// directory does not exist.
+func snapshotManifests(manifestDir string) ([]byte, error) {
+	if _, err := os.Stat(manifestDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(manifestDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.Dir(manifestDir), path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: filepath.ToSlash(rel), Mode: 0600, Size: int64(len(data))}); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func restoreManifests(snapshot []byte) (asset.Assets, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(snapshot))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var as asset.Assets
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return as, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("invalid path in snapshot: %s", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, asset.Asset{Name: name, Data: data})
+	}
+}
@@ -0,0 +1,117 @@
+package bootkube
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+func TestHistory(t *testing.T) {
+	assetDir, err := ioutil.TempDir("", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(assetDir)
+	if err := os.MkdirAll(filepath.Join(assetDir, asset.AssetPathManifests), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(assetDir, asset.AssetPathManifests, "pod.yaml"), []byte("manifest data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewSimpleClientset()
+	first, err := RecordHistory(client, HistoryEntry{Operation: OperationStart, ToVersion: "v1"}, assetDir)
+	if err != nil {
+		t.Fatalf("RecordHistory() = %v, want: nil", err)
+	}
+	second, err := RecordHistory(client, HistoryEntry{Operation: OperationStart, ToVersion: "v2"}, "")
+	if err != nil {
+		t.Fatalf("RecordHistory() = %v, want: nil", err)
+	}
+	if first.Revision != 1 || second.Revision != 2 {
+		t.Errorf("got revisions %d, %d, want: 1, 2", first.Revision, second.Revision)
+	}
+	if second.FromVersion != "v1" {
+		t.Errorf("got FromVersion %q, want: %q", second.FromVersion, "v1")
+	}
+	if first.AssetHash == "" {
+		t.Errorf("expected asset hash to be recorded")
+	}
+
+	entries, err := ListHistory(client)
+	if err != nil {
+		t.Fatalf("ListHistory() = %v, want: nil", err)
+	}
+	if len(entries) != 2 || entries[0].Revision != 1 || entries[1].Revision != 2 {
+		t.Errorf("ListHistory() = %v, want revisions 1 and 2", entries)
+	}
+
+	restoreDir, err := ioutil.TempDir("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(restoreDir)
+	if err := RestoreRevision(client, 1, restoreDir); err != nil {
+		t.Fatalf("RestoreRevision() = %v, want: nil", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(restoreDir, asset.AssetPathManifests, "pod.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "manifest data" {
+		t.Errorf("restored manifest = %q, want: %q", data, "manifest data")
+	}
+	if err := RestoreRevision(client, 2, restoreDir); err == nil {
+		t.Errorf("RestoreRevision() of revision without a snapshot = nil, want error")
+	}
+}
+
+func TestRecordHistoryConflict(t *testing.T) {
+	assetDir, err := ioutil.TempDir("", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(assetDir)
+	if err := os.MkdirAll(filepath.Join(assetDir, asset.AssetPathManifests), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewSimpleClientset()
+	conflicts := 1
+	client.PrependReactor("update", "configmaps", func(ktesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, historyConfigMapName, errors.New("changed"))
+	})
+	if _, err := RecordHistory(client, HistoryEntry{Operation: OperationStart, ToVersion: "v1"}, assetDir); err != nil {
+		t.Fatalf("RecordHistory() after a conflict = %v, want: nil", err)
+	}
+	if entries, err := ListHistory(client); err != nil || len(entries) != 1 {
+		t.Errorf("ListHistory() = %v, %v, want: revision 1", entries, err)
+	}
+
+	client = fake.NewSimpleClientset()
+	client.PrependReactor("update", "configmaps", func(ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	if _, err := RecordHistory(client, HistoryEntry{Operation: OperationStart, ToVersion: "v1"}, assetDir); err == nil {
+		t.Fatal("RecordHistory() with a failing update = nil, want error")
+	}
+	if _, err := client.CoreV1().Secrets(historyNamespace).Get(context.TODO(), historySecretName(1), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("got the snapshot of an unrecorded revision: %v", err)
+	}
+}
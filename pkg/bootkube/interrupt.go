@@ -0,0 +1,90 @@
+package bootkube
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// AssetPathInterrupted is the marker bootkube start leaves in the asset directory when it's
+// interrupted, so that the next bootkube start resumes the bootstrap. It isn't an asset, so it's
+// left out of the asset checksums.
+const AssetPathInterrupted = "bootkube-interrupted.json"
+
+// interruption is the content of AssetPathInterrupted.
+type interruption struct {
+	Signal string    `json:"signal"`
+	Phase  string    `json:"phase"`
+	Time   time.Time `json:"time"`
+}
+
+// interruptContext returns a context that is canceled on the first SIGINT or SIGTERM, and a
+// function that returns that signal, nil until then. Further signals terminate the process as
+// usual, in case cleaning up hangs. stop stops catching the signals.
+func interruptContext(parent context.Context) (ctx context.Context, received func() os.Signal, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	var mu sync.Mutex
+	var sig os.Signal
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-ch:
+			signal.Stop(ch)
+			mu.Lock()
+			sig = s
+			mu.Unlock()
+			UserWarning("Received %v, stopping and cleaning up the bootstrap control plane...\n", s)
+			cancel()
+		case <-done:
+		}
+	}()
+	received = func() os.Signal {
+		mu.Lock()
+		defer mu.Unlock()
+		return sig
+	}
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+			cancel()
+		})
+	}
+	return ctx, received, stop
+}
+
+// writeInterrupted leaves the marker of the bootkube start interrupted by sig during phase in
+// assetDir.
+func writeInterrupted(assetDir string, sig os.Signal, phase string) error {
+	b, err := json.Marshal(interruption{Signal: sig.String(), Phase: phase, Time: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(assetDir, AssetPathInterrupted), b, 0600)
+}
+
+// readInterrupted returns the marker of an interrupted bootkube start in assetDir, nil if there
+// is none.
+func readInterrupted(assetDir string) (*interruption, error) {
+	b, err := ioutil.ReadFile(filepath.Join(assetDir, AssetPathInterrupted))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var i interruption
+	if err := json.Unmarshal(b, &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
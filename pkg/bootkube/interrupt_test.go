@@ -0,0 +1,67 @@
+package bootkube
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptContext(t *testing.T) {
+	ctx, received, stop := interruptContext(context.Background())
+	defer stop()
+	if sig := received(); sig != nil {
+		t.Fatalf("got signal %v before any was sent", sig)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the context wasn't canceled by SIGTERM")
+	}
+	if sig := received(); sig != syscall.SIGTERM {
+		t.Errorf("got signal %v, want: %v", sig, syscall.SIGTERM)
+	}
+
+	// Stopping cancels the context without a signal.
+	ctx, received, stop = interruptContext(context.Background())
+	stop()
+	stop()
+	if ctx.Err() == nil || received() != nil {
+		t.Errorf("got context error %v and signal %v after stop, want canceled without a signal", ctx.Err(), received())
+	}
+}
+
+func TestInterruptionMarker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootkube-interrupted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := WriteAssetChecksums(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if i, err := readInterrupted(dir); i != nil || err != nil {
+		t.Fatalf("readInterrupted() = %v, %v, want: nil, nil", i, err)
+	}
+	if err := writeInterrupted(dir, syscall.SIGINT, phaseCreatingAssets); err != nil {
+		t.Fatal(err)
+	}
+	i, err := readInterrupted(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i == nil || i.Signal != syscall.SIGINT.String() || i.Phase != phaseCreatingAssets || i.Time.IsZero() {
+		t.Errorf("readInterrupted() = %+v, want the signal and phase of the interruption", i)
+	}
+
+	// The marker isn't an asset, the resumed bootkube start verifies.
+	if err := VerifyAssets(dir, ""); err != nil {
+		t.Errorf("VerifyAssets() = %v, want: nil", err)
+	}
+}
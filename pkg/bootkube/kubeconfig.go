@@ -0,0 +1,89 @@
+package bootkube
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// AssetPathFinalAdminKubeConfig is the admin kubeconfig bootkube start writes to the asset
+// directory once the cluster is bootstrapped. It isn't an asset, so it's left out of the asset
+// checksums.
+const AssetPathFinalAdminKubeConfig = "auth/admin-kubeconfig"
+
+var adminKubeConfigTemplate = template.Must(template.New("kubeconfig").Parse(`apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: {{ .Server }}
+{{- if .Embed }}
+    certificate-authority-data: {{ .CACert }}
+{{- else }}
+    certificate-authority: {{ .CACert }}
+{{- end }}
+users:
+- name: admin
+  user:
+{{- if .Embed }}
+    client-certificate-data: {{ .Cert }}
+    client-key-data: {{ .Key }}
+{{- else }}
+    client-certificate: {{ .Cert }}
+    client-key: {{ .Key }}
+{{- end }}
+contexts:
+- context:
+    cluster: local
+    user: admin
+  name: admin@local
+current-context: admin@local
+`))
+
+// writeAdminKubeConfig writes the admin kubeconfig of the bootstrapped cluster to
+// AssetPathFinalAdminKubeConfig of assetDir, replacing an existing one. It points at the
+// apiserver of the kubelet kubeconfig, the final control plane, unlike the bootstrap kubeconfig
+// which may point at the bootstrap apiserver. With embedCerts, the CA and the admin client
+// certificate are embedded, otherwise it refers to their files in the asset directory.
+func writeAdminKubeConfig(assetDir string, embedCerts bool) error {
+	server, err := ServerFromKubeConfig(filepath.Join(assetDir, asset.AssetPathKubeletKubeConfig))
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(assetDir)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{"Server": server, "Embed": embedCerts}
+	for key, name := range map[string]string{
+		"CACert": asset.AssetPathCACert,
+		"Cert":   asset.AssetPathAdminCert,
+		"Key":    asset.AssetPathAdminKey,
+	} {
+		path := filepath.Join(dir, name)
+		if !embedCerts {
+			values[key] = strconv.Quote(path)
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		values[key] = base64.StdEncoding.EncodeToString(b)
+	}
+	var buf bytes.Buffer
+	if err := adminKubeConfigTemplate.Execute(&buf, values); err != nil {
+		return err
+	}
+	p := filepath.Join(assetDir, AssetPathFinalAdminKubeConfig)
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	UserOutput("Wrote the admin kubeconfig of the cluster to %s\n", p)
+	return nil
+}
@@ -0,0 +1,89 @@
+package bootkube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+func TestWriteAdminKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootkube-kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(asset.AssetPathKubeletKubeConfig, `apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: https://10.0.0.10:6443
+users:
+- name: kubelet
+  user:
+    token: abc
+contexts:
+- name: kubelet-context
+  context:
+    cluster: local
+    user: kubelet
+current-context: kubelet-context
+`)
+	writeFile(asset.AssetPathCACert, "ca\n")
+	writeFile(asset.AssetPathAdminCert, "cert\n")
+	writeFile(asset.AssetPathAdminKey, "key\n")
+	if err := WriteAssetChecksums(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, embed := range []bool{true, false} {
+		if err := writeAdminKubeConfig(dir, embed); err != nil {
+			t.Fatalf("writeAdminKubeConfig(%v) = %v, want: nil", embed, err)
+		}
+		config, err := clientcmd.LoadFromFile(filepath.Join(dir, AssetPathFinalAdminKubeConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.CurrentContext != "admin@local" {
+			t.Errorf("embed %v: got current context %q, want: admin@local", embed, config.CurrentContext)
+		}
+		cluster, user := config.Clusters["local"], config.AuthInfos["admin"]
+		if cluster == nil || user == nil {
+			t.Fatalf("embed %v: got clusters %v and users %v, want local and admin", embed, config.Clusters, config.AuthInfos)
+		}
+		if cluster.Server != "https://10.0.0.10:6443" {
+			t.Errorf("embed %v: got server %q, want: https://10.0.0.10:6443", embed, cluster.Server)
+		}
+		if embed {
+			if string(cluster.CertificateAuthorityData) != "ca\n" || string(user.ClientCertificateData) != "cert\n" ||
+				string(user.ClientKeyData) != "key\n" || cluster.CertificateAuthority != "" || user.ClientCertificate != "" {
+				t.Errorf("got cluster %+v and user %+v, want the certificates embedded", cluster, user)
+			}
+		} else {
+			if cluster.CertificateAuthority != filepath.Join(dir, asset.AssetPathCACert) ||
+				user.ClientKey != filepath.Join(dir, asset.AssetPathAdminKey) || len(user.ClientCertificateData) > 0 {
+				t.Errorf("got cluster %+v and user %+v, want the paths of the certificates", cluster, user)
+			}
+		}
+	}
+
+	// The admin kubeconfig isn't an asset, re-running bootkube start from the directory verifies.
+	if err := VerifyAssets(dir, ""); err != nil {
+		t.Errorf("VerifyAssets() = %v, want: nil", err)
+	}
+}
@@ -0,0 +1,143 @@
+package bootkube
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+const (
+	// bootstrapLeaseName is the Lease in kube-system the node bootstrapping the cluster holds, so
+	// that other nodes running bootkube start at the same time adopt the cluster instead of
+	// starting bootstrap control planes of their own.
+	bootstrapLeaseName = "bootkube-bootstrap"
+	// lockFilePath is the lock file held by the bootkube start of the node. It isn't in the pod
+	// manifest path, where the pod checkpointer removes files starting with a dot.
+	lockFilePath = "/var/lock/bootkube.lock"
+)
+
+// errBootstrapLeaseHeld is returned by a bootkube start that found the bootstrap lease held by
+// another node only once its own bootstrap apiserver was up.
+var errBootstrapLeaseHeld = errors.New("another node is bootstrapping the cluster")
+
+// lockLocal takes the lock file at path, waiting for another bootkube start on the node to
+// release it until ctx is done. It reports whether it had to wait.
+func lockLocal(ctx context.Context, path string) (unlock func(), waited bool, err error) {
+	if err := os.Mkdir(filepath.Dir(path), os.FileMode(0700)); err != nil && !os.IsExist(err) {
+		return nil, false, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, os.FileMode(0600))
+	if err != nil {
+		return nil, false, err
+	}
+	err = wait.PollImmediateUntil(pivotInterval, func() (bool, error) {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == syscall.EWOULDBLOCK {
+			if !waited {
+				UserOutput("Waiting for another bootkube start on this node to finish...\n")
+			}
+			waited = true
+			return false, nil
+		}
+		return err == nil, err
+	}, ctx.Done())
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, waited, nil
+}
+
+// bootstrapLease is the bootstrap lease of the cluster, held through the admin kubeconfig, i.e.
+// the apiserver endpoint every node bootstraps the cluster behind.
+type bootstrapLease struct {
+	client   kubernetes.Interface
+	holder   string
+	duration time.Duration
+	held     bool
+}
+
+// newBootstrapLease returns the bootstrap lease of the cluster for this node, held for duration.
+func newBootstrapLease(assetDir string, duration time.Duration) (*bootstrapLease, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", filepath.Join(assetDir, asset.AssetPathAdminKubeConfig))
+	if err != nil {
+		return nil, err
+	}
+	// Usually there is no apiserver at all yet.
+	config.Timeout = adoptProbeTimeout
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	holder, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return &bootstrapLease{client: client, holder: holder, duration: duration}, nil
+}
+
+// acquire waits until the node holds the bootstrap lease, or ctx is done, and reports whether it
+// had to wait for another node. If no apiserver is reachable, nobody holds it yet, and acquire
+// returns without it.
+func (l *bootstrapLease) acquire(ctx context.Context) (waited bool, err error) {
+	err = wait.PollImmediateUntil(pivotInterval, func() (bool, error) {
+		acquired, err := tryAcquireLease(ctx, l.client, bootstrapLeaseName, l.holder, l.duration)
+		if err != nil {
+			if !waited {
+				debugf("Not taking the bootstrap lease, the apiserver isn't reachable: %v", err)
+				return true, nil
+			}
+			// The apiserver of the other node is down while it pivots.
+			debugf("Unable to acquire the bootstrap lease: %v", err)
+			return false, nil
+		}
+		if !acquired && !waited {
+			UserOutput("Another node is bootstrapping the cluster, waiting for it to finish...\n")
+		}
+		waited = waited || !acquired
+		l.held = acquired
+		return acquired, nil
+	}, ctx.Done())
+	return waited, err
+}
+
+// acquireOnce takes the bootstrap lease, unless it's already held, once the apiserver is
+// reachable. It fails with errBootstrapLeaseHeld if another node holds the lease.
+func (l *bootstrapLease) acquireOnce(ctx context.Context) error {
+	if l.held {
+		return nil
+	}
+	acquired, err := tryAcquireLease(ctx, l.client, bootstrapLeaseName, l.holder, l.duration)
+	if err != nil {
+		UserWarning("Bootstrapping without the bootstrap lease, the apiserver of the admin kubeconfig isn't reachable: %v\n", err)
+		return nil
+	}
+	if !acquired {
+		return errBootstrapLeaseHeld
+	}
+	l.held = true
+	return nil
+}
+
+// release releases the bootstrap lease if the node holds it.
+func (l *bootstrapLease) release() {
+	if !l.held {
+		return
+	}
+	if err := releaseLease(l.client, bootstrapLeaseName, l.holder); err != nil {
+		UserWarning("failed to release the bootstrap lease, other nodes adopt the cluster when it expires: %v\n", err)
+	}
+	l.held = false
+}
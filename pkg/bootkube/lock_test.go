@@ -0,0 +1,107 @@
+package bootkube
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestLockLocal(t *testing.T) {
+	defer func(interval time.Duration) { pivotInterval = interval }(pivotInterval)
+	pivotInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "bootkube-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lock", filepath.Base(lockFilePath))
+
+	unlock, waited, err := lockLocal(context.Background(), path)
+	if err != nil || waited {
+		t.Fatalf("lockLocal() = %v, waited %t, want: nil without waiting", err, waited)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := lockLocal(ctx, path); err == nil {
+		t.Fatal("took the lock held by another bootkube start")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		unlock()
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	unlockSecond, waited, err := lockLocal(ctx, path)
+	if err != nil || !waited {
+		t.Fatalf("lockLocal() = %v, waited %t, want: nil after waiting", err, waited)
+	}
+	unlockSecond()
+}
+
+func TestBootstrapLease(t *testing.T) {
+	defer func(interval time.Duration) { pivotInterval = interval }(pivotInterval)
+	pivotInterval = 10 * time.Millisecond
+
+	other := "node-a"
+	duration := int32(60)
+	renewed := metav1.NewMicroTime(time.Now())
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: bootstrapLeaseName, Namespace: metav1.NamespaceSystem},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &other,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renewed,
+		},
+	})
+	lease := &bootstrapLease{client: client, holder: "node-b", duration: time.Minute}
+	if err := lease.acquireOnce(context.Background()); err != errBootstrapLeaseHeld {
+		t.Fatalf("acquireOnce() = %v, want: %v", err, errBootstrapLeaseHeld)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		releaseLease(client, bootstrapLeaseName, other)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	waited, err := lease.acquire(ctx)
+	if err != nil || !waited || !lease.held {
+		t.Fatalf("acquire() = %v, waited %t, held %t, want: nil, held after waiting", err, waited, lease.held)
+	}
+	got, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(context.TODO(), bootstrapLeaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Spec.HolderIdentity != "node-b" || *got.Spec.LeaseDurationSeconds != 60 {
+		t.Errorf("got lease held by %s for %ds, want: node-b for 60s", *got.Spec.HolderIdentity, *got.Spec.LeaseDurationSeconds)
+	}
+	lease.release()
+	if _, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(context.TODO(), bootstrapLeaseName, metav1.GetOptions{}); err == nil {
+		t.Error("the lease wasn't released")
+	}
+
+	// Without a reachable apiserver, nobody holds the lease.
+	client = fake.NewSimpleClientset()
+	client.PrependReactor("get", "leases", func(ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	lease = &bootstrapLease{client: client, holder: "node-b", duration: time.Minute}
+	if waited, err := lease.acquire(context.Background()); err != nil || waited || lease.held {
+		t.Errorf("acquire() without an apiserver = %v, waited %t, held %t, want: nil, not held without waiting", err, waited, lease.held)
+	}
+	if err := lease.acquireOnce(context.Background()); err != nil || lease.held {
+		t.Errorf("acquireOnce() without an apiserver = %v, held %t, want: nil, not held", err, lease.held)
+	}
+}
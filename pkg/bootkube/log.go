@@ -0,0 +1,117 @@
+package bootkube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The formats of the bootkube output. The text format is meant for a human sitting at a terminal
+// watching their cluster bootstrap itself, the JSON format for provisioning systems: every
+// message is a JSON object on its own line with the time, level and message.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// The levels of the bootkube output, from the most to the least verbose.
+const (
+	LogLevelDebug   = "debug"
+	LogLevelInfo    = "info"
+	LogLevelWarning = "warning"
+	LogLevelError   = "error"
+)
+
+var logLevels = map[string]int{
+	LogLevelDebug:   0,
+	LogLevelInfo:    1,
+	LogLevelWarning: 2,
+	LogLevelError:   3,
+}
+
+var logger = struct {
+	sync.Mutex
+	out    io.Writer
+	format string
+	level  int
+}{
+	out:    os.Stdout,
+	format: LogFormatText,
+	level:  logLevels[LogLevelInfo],
+}
+
+// ConfigureLogging sets the format and the minimum level of the bootkube output.
+func ConfigureLogging(format, level string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf("log format must be %s or %s, got %q", LogFormatText, LogFormatJSON, format)
+	}
+	l, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("log level must be %s, %s, %s or %s, got %q", LogLevelDebug, LogLevelInfo, LogLevelWarning, LogLevelError, level)
+	}
+	logger.Lock()
+	defer logger.Unlock()
+	logger.format = format
+	logger.level = l
+	return nil
+}
+
+// All bootkube printing to stdout should go through UserOutput, UserWarning and UserError,
+// which print a message at the info, warning and error level. Diagnostics that are only useful
+// when debugging go through debugf.
+func UserOutput(format string, a ...interface{}) {
+	logf(LogLevelInfo, format, a...)
+}
+
+func UserWarning(format string, a ...interface{}) {
+	logf(LogLevelWarning, format, a...)
+}
+
+func UserError(format string, a ...interface{}) {
+	logf(LogLevelError, format, a...)
+}
+
+func debugf(format string, a ...interface{}) {
+	logf(LogLevelDebug, format, a...)
+}
+
+func logf(level, format string, a ...interface{}) {
+	logger.Lock()
+	defer logger.Unlock()
+	if logLevels[level] < logger.level {
+		return
+	}
+	msg := fmt.Sprintf(format, a...)
+
+	if logger.format == LogFormatJSON {
+		b, err := json.Marshal(struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{
+			Time:  time.Now().UTC().Format(time.RFC3339Nano),
+			Level: level,
+			Msg:   strings.TrimSpace(msg),
+		})
+		if err != nil {
+			return
+		}
+		logger.out.Write(append(b, '\n'))
+		return
+	}
+
+	switch level {
+	case LogLevelWarning:
+		msg = "WARNING: " + msg
+	case LogLevelError:
+		msg = "Error: " + msg
+	}
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	io.WriteString(logger.out, msg)
+}
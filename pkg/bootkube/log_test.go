@@ -0,0 +1,81 @@
+package bootkube
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger.out = &buf
+	defer func() {
+		logger.out = os.Stdout
+		ConfigureLogging(LogFormatText, LogLevelInfo)
+	}()
+
+	logAll := func() {
+		debugf("Unable to list apiserver pods: %v", "timeout")
+		UserOutput("Created %s\n", "kube-system/kube-apiserver DaemonSet")
+		UserWarning("failed to record bootkube history: %v\n", "read-only file system")
+		UserError("%v\n", "timed out")
+	}
+
+	if err := ConfigureLogging(LogFormatText, LogLevelInfo); err != nil {
+		t.Fatal(err)
+	}
+	logAll()
+	want := "Created kube-system/kube-apiserver DaemonSet\n" +
+		"WARNING: failed to record bootkube history: read-only file system\n" +
+		"Error: timed out\n"
+	if buf.String() != want {
+		t.Errorf("got text output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := ConfigureLogging(LogFormatJSON, LogLevelDebug); err != nil {
+		t.Fatal(err)
+	}
+	logAll()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	wantLines := []struct{ level, msg string }{
+		{LogLevelDebug, "Unable to list apiserver pods: timeout"},
+		{LogLevelInfo, "Created kube-system/kube-apiserver DaemonSet"},
+		{LogLevelWarning, "failed to record bootkube history: read-only file system"},
+		{LogLevelError, "timed out"},
+	}
+	if len(lines) != len(wantLines) {
+		t.Fatalf("got %d lines of JSON output, want: %d:\n%s", len(lines), len(wantLines), buf.String())
+	}
+	for i, line := range lines {
+		var entry struct{ Time, Level, Msg string }
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d is not JSON: %v: %s", i, err, line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, entry.Time); err != nil {
+			t.Errorf("line %d: invalid time: %v", i, err)
+		}
+		if entry.Level != wantLines[i].level || entry.Msg != wantLines[i].msg {
+			t.Errorf("line %d: got level %q and message %q, want: %q and %q", i, entry.Level, entry.Msg, wantLines[i].level, wantLines[i].msg)
+		}
+	}
+
+	buf.Reset()
+	if err := ConfigureLogging(LogFormatJSON, LogLevelWarning); err != nil {
+		t.Fatal(err)
+	}
+	logAll()
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("got %d lines at the warning level, want: 2:\n%s", n, buf.String())
+	}
+
+	if err := ConfigureLogging("yaml", LogLevelInfo); err == nil {
+		t.Error("ConfigureLogging() with an unknown format = nil, want an error")
+	}
+	if err := ConfigureLogging(LogFormatText, "verbose"); err == nil {
+		t.Error("ConfigureLogging() with an unknown level = nil, want an error")
+	}
+}
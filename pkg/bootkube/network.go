@@ -0,0 +1,548 @@
+package bootkube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// NetworkMigrationLabel is set on the nodes that were moved to the new network provider while a
+// network migration is in progress. Its value is the new network provider.
+const NetworkMigrationLabel = "bootkube.io/network-provider"
+
+const (
+	flannelDaemonSet = "kube-flannel"
+	flannelConfigMap = "kube-flannel-cfg"
+
+	networkMigrationPollInterval = 2 * time.Second
+)
+
+// NetworkMigrationTargets are the network providers a flannel cluster can be migrated to.
+var NetworkMigrationTargets = []string{asset.NetworkCalico, asset.NetworkCilium, asset.NetworkKubeRouter, asset.NetworkWeaveNet}
+
+type NetworkMigrationConfig struct {
+	// AssetDir is updated with the manifests of the new network provider once all nodes are
+	// migrated.
+	AssetDir string
+	// To is the network provider to migrate to, one of NetworkMigrationTargets.
+	To string
+	// Timeout bounds each step of migrating a node.
+	Timeout time.Duration
+}
+
+// MigrateNetwork moves a cluster from flannel to another network provider, one node at a time:
+//
+//  1. flannel is restricted to nodes without NetworkMigrationLabel and the new network provider,
+//     rendered for the pod CIDR of flannel, to nodes with it.
+//  2. For each node: cordon it, evict its pods, label it, remove the flannel CNI configuration and
+//     interfaces, wait for the new network provider to be ready, restart the DaemonSet pods using
+//     the pod network, check that a pod on the node reaches the apiserver service and uncordon it.
+//  3. The new network provider is allowed on all nodes, flannel is deleted and the manifests of the
+//     new network provider replace the flannel manifests in the asset directory.
+//
+// Nodes that are already labeled are skipped, so a failed migration can be resumed by running it
+// again. A node that failed to migrate is left cordoned.
+func MigrateNetwork(config clientcmd.ClientConfig, cfg NetworkMigrationConfig) error {
+	if !isNetworkMigrationTarget(cfg.To) {
+		return fmt.Errorf("cannot migrate to network provider %q, supported: %s", cfg.To, strings.Join(NetworkMigrationTargets, ", "))
+	}
+	c, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(c)
+	if err != nil {
+		return err
+	}
+	creater, err := newCreater(c, false)
+	if err != nil {
+		return err
+	}
+
+	flannel, err := client.AppsV1().DaemonSets(metav1.NamespaceSystem).Get(context.TODO(), flannelDaemonSet, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("DaemonSet %s/%s not found, only clusters using flannel can be migrated", metav1.NamespaceSystem, flannelDaemonSet)
+	}
+	if err != nil {
+		return err
+	}
+	controlPlaneNamespace := metav1.NamespaceSystem
+	if cfg.AssetDir != "" {
+		controlPlaneNamespace = ControlPlaneNamespace(cfg.AssetDir)
+	}
+	control, err := client.AppsV1().Deployments(controlPlaneNamespace).Get(context.TODO(), "kube-controller-manager", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	conf, err := networkMigrationAssetConfig(client, c.Host)
+	if err != nil {
+		return err
+	}
+	conf.NetworkProvider = asset.NetworkFlannel
+	oldAssets, err := asset.NewNetworkAssets(conf)
+	if err != nil {
+		return err
+	}
+	conf.NetworkProvider = cfg.To
+	newAssets, err := asset.NewNetworkAssets(conf)
+	if err != nil {
+		return err
+	}
+	manifests, err := networkMigrationManifests(newAssets, cfg.To)
+	if err != nil {
+		return err
+	}
+
+	m := &networkMigration{
+		client:  client,
+		to:      cfg.To,
+		timeout: cfg.Timeout,
+	}
+	if m.cleanupPod, err = flannelCleanupPod(flannel); err != nil {
+		return err
+	}
+	m.checkPod = connectivityCheckPod(control)
+	for _, mf := range manifests {
+		if mf.kind == "DaemonSet" {
+			m.daemonSets = append(m.daemonSets, mf.name)
+		}
+	}
+
+	UserOutput("Restricting flannel to nodes that were not migrated...\n")
+	restrict := fmt.Sprintf(`{"spec":{"template":{"spec":{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":%q,"operator":"DoesNotExist"}]}]}}}}}}}`, NetworkMigrationLabel)
+	if _, err := client.AppsV1().DaemonSets(metav1.NamespaceSystem).Patch(context.TODO(), flannelDaemonSet, types.StrategicMergePatchType, []byte(restrict), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to restrict flannel to unmigrated nodes: %v", err)
+	}
+
+	UserOutput("Creating %s...\n", cfg.To)
+	for _, mf := range manifests {
+		if err := creater.create(mf); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed creating %s: %v", mf, err)
+		}
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	sort.Slice(nodes.Items, func(i, j int) bool { return nodes.Items[i].Name < nodes.Items[j].Name })
+	for _, node := range nodes.Items {
+		if node.Labels[NetworkMigrationLabel] == cfg.To {
+			UserOutput("Node %s was already migrated\n", node.Name)
+			continue
+		}
+		if err := m.migrateNode(node.Name); err != nil {
+			return fmt.Errorf("failed migrating node %s, it is left cordoned, run the migration again to resume: %v", node.Name, err)
+		}
+	}
+
+	UserOutput("All nodes migrated, removing flannel...\n")
+	unrestrict := fmt.Sprintf(`{"spec":{"template":{"spec":{"nodeSelector":{%q:null}}}}}`, NetworkMigrationLabel)
+	for _, name := range m.daemonSets {
+		if _, err := client.AppsV1().DaemonSets(metav1.NamespaceSystem).Patch(context.TODO(), name, types.MergePatchType, []byte(unrestrict), metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to allow %s on all nodes: %v", name, err)
+		}
+	}
+	for _, a := range oldAssets {
+		ms, err := parseManifests(bytes.NewReader(a.Data))
+		if err != nil {
+			return err
+		}
+		for _, mf := range ms {
+			if err := creater.delete(mf); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed deleting %s %s: %v", mf.kind, mf.name, err)
+			}
+		}
+	}
+	unlabel := fmt.Sprintf(`{"metadata":{"labels":{%q:null}}}`, NetworkMigrationLabel)
+	for _, node := range nodes.Items {
+		if _, err := client.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, []byte(unlabel), metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to remove the migration label of node %s: %v", node.Name, err)
+		}
+	}
+
+	if cfg.AssetDir == "" {
+		return nil
+	}
+	for _, a := range oldAssets {
+		if err := os.Remove(filepath.Join(cfg.AssetDir, a.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, a := range newAssets {
+		if err := a.WriteFile(cfg.AssetDir); err != nil {
+			return err
+		}
+	}
+	return asset.UpdateUninstallList(cfg.AssetDir)
+}
+
+func isNetworkMigrationTarget(provider string) bool {
+	for _, p := range NetworkMigrationTargets {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// networkMigrationAssetConfig returns the configuration to render the network provider of a
+// cluster with: the pod CIDR of flannel and the apiserver at server.
+func networkMigrationAssetConfig(client kubernetes.Interface, server string) (asset.Config, error) {
+	cm, err := client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(context.TODO(), flannelConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return asset.Config{}, err
+	}
+	var netConf struct {
+		Network string
+	}
+	if err := json.Unmarshal([]byte(cm.Data["net-conf.json"]), &netConf); err != nil {
+		return asset.Config{}, fmt.Errorf("failed to parse net-conf.json of ConfigMap %s: %v", flannelConfigMap, err)
+	}
+	_, podCIDR, err := net.ParseCIDR(netConf.Network)
+	if err != nil {
+		return asset.Config{}, fmt.Errorf("invalid pod network in ConfigMap %s: %v", flannelConfigMap, err)
+	}
+	apiServer, err := url.Parse(server)
+	if err != nil {
+		return asset.Config{}, err
+	}
+	return asset.Config{
+		APIServers: []*url.URL{apiServer},
+		PodCIDR:    podCIDR,
+		PodCIDRs:   []*net.IPNet{podCIDR},
+		Images:     asset.DefaultImages,
+		// kube-proxy keeps handling services.
+		CiliumKubeProxyReplacement: asset.CiliumKubeProxyReplacementDisabled,
+		KubeRouterServiceProxy:     false,
+	}, nil
+}
+
+// networkMigrationManifests parses the manifests of the new network provider and restricts its
+// DaemonSets to the migrated nodes.
+func networkMigrationManifests(as asset.Assets, to string) ([]manifest, error) {
+	var manifests []manifest
+	for _, a := range as {
+		ms, err := parseManifests(bytes.NewReader(a.Data))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %v", a.Name, err)
+		}
+		for _, m := range ms {
+			m.filepath = a.Name
+			if m.kind == "DaemonSet" {
+				var ds appsv1.DaemonSet
+				if err := json.Unmarshal(m.raw, &ds); err != nil {
+					return nil, fmt.Errorf("parse %s: %v", a.Name, err)
+				}
+				if ds.Spec.Template.Spec.NodeSelector == nil {
+					ds.Spec.Template.Spec.NodeSelector = map[string]string{}
+				}
+				ds.Spec.Template.Spec.NodeSelector[NetworkMigrationLabel] = to
+				if m.raw, err = json.Marshal(ds); err != nil {
+					return nil, err
+				}
+			}
+			manifests = append(manifests, m)
+		}
+	}
+	return manifests, nil
+}
+
+// flannelCleanupPod returns a pod removing the flannel CNI configuration and interfaces of a node,
+// using the image and CNI configuration directory of the flannel DaemonSet.
+func flannelCleanupPod(flannel *appsv1.DaemonSet) (*corev1.Pod, error) {
+	var image, cniDir string
+	for _, c := range flannel.Spec.Template.Spec.Containers {
+		if c.Name == "kube-flannel" {
+			image = c.Image
+		}
+	}
+	for _, v := range flannel.Spec.Template.Spec.Volumes {
+		if v.Name == "cni" && v.HostPath != nil {
+			cniDir = v.HostPath.Path
+		}
+	}
+	if image == "" || cniDir == "" {
+		return nil, fmt.Errorf("DaemonSet %s/%s has no kube-flannel container or cni volume", metav1.NamespaceSystem, flannelDaemonSet)
+	}
+	privileged := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "network-migrate-cleanup", Namespace: metav1.NamespaceSystem},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:            "cleanup",
+				Image:           image,
+				Command:         []string{"/bin/sh", "-c", "rm -f /host/etc/cni/net.d/10-flannel.conf*; ip link delete cni0; ip link delete flannel.1; true"},
+				SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+				VolumeMounts:    []corev1.VolumeMount{{Name: "cni", MountPath: "/host/etc/cni/net.d"}},
+			}},
+			HostNetwork:   true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations:   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Volumes: []corev1.Volume{{
+				Name:         "cni",
+				VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: cniDir}},
+			}},
+		},
+	}, nil
+}
+
+// connectivityCheckPod returns a pod on the pod network that succeeds once it reaches the
+// apiserver through its service IP, using the hyperkube image of the controller-manager.
+func connectivityCheckPod(control *appsv1.Deployment) *corev1.Pod {
+	image := asset.DefaultImages.Hyperkube
+	if cs := control.Spec.Template.Spec.Containers; len(cs) > 0 {
+		image = cs[0].Image
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "network-migrate-check", Namespace: metav1.NamespaceSystem},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "check",
+				Image:   image,
+				Command: []string{"./hyperkube", "kubectl", "get", "--raw=/healthz"},
+			}},
+			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations:   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		},
+	}
+}
+
+type networkMigration struct {
+	client  kubernetes.Interface
+	to      string
+	timeout time.Duration
+
+	// daemonSets of the new network provider.
+	daemonSets []string
+	cleanupPod *corev1.Pod
+	checkPod   *corev1.Pod
+}
+
+func (m *networkMigration) migrateNode(node string) error {
+	UserOutput("Migrating node %s...\n", node)
+	if err := m.patchNode(node, `{"spec":{"unschedulable":true}}`); err != nil {
+		return fmt.Errorf("cordon: %v", err)
+	}
+
+	pods, err := m.nodePods(node)
+	if err != nil {
+		return err
+	}
+	evict := podsToEvict(pods)
+	for _, p := range evict {
+		err := m.client.PolicyV1beta1().Evictions(p.Namespace).Evict(context.TODO(), &policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: p.Name, Namespace: p.Namespace},
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("evicting pod %s/%s: %v", p.Namespace, p.Name, err)
+		}
+	}
+	if err := m.waitForPodsDeleted(evict); err != nil {
+		return fmt.Errorf("waiting for evicted pods: %v", err)
+	}
+
+	if err := m.patchNode(node, fmt.Sprintf(`{"metadata":{"labels":{%q:%q}}}`, NetworkMigrationLabel, m.to)); err != nil {
+		return fmt.Errorf("label: %v", err)
+	}
+	if err := m.waitForFlannelRemoved(node); err != nil {
+		return fmt.Errorf("waiting for flannel to stop: %v", err)
+	}
+	if err := m.runPod(m.cleanupPod, node); err != nil {
+		return fmt.Errorf("removing the flannel configuration: %v", err)
+	}
+	for _, ds := range m.daemonSets {
+		if err := m.waitForDaemonSetPodReady(ds, node); err != nil {
+			return fmt.Errorf("waiting for %s: %v", ds, err)
+		}
+	}
+
+	// DaemonSet pods are not evicted, restart the ones still using a flannel address.
+	if pods, err = m.nodePods(node); err != nil {
+		return err
+	}
+	for _, p := range pods {
+		if p.Spec.HostNetwork || !ownedByDaemonSet(p) || m.isNetworkProviderPod(p) {
+			continue
+		}
+		if err := m.client.CoreV1().Pods(p.Namespace).Delete(context.TODO(), p.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("restarting pod %s/%s: %v", p.Namespace, p.Name, err)
+		}
+	}
+
+	if err := m.runPod(m.checkPod, node); err != nil {
+		return fmt.Errorf("pod connectivity check: %v", err)
+	}
+	if err := m.patchNode(node, `{"spec":{"unschedulable":false}}`); err != nil {
+		return fmt.Errorf("uncordon: %v", err)
+	}
+	UserOutput("Migrated node %s\n", node)
+	return nil
+}
+
+func (m *networkMigration) patchNode(node, patch string) error {
+	_, err := m.client.CoreV1().Nodes().Patch(context.TODO(), node, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+func (m *networkMigration) nodePods(node string) ([]corev1.Pod, error) {
+	pods, err := m.client.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{FieldSelector: "spec.nodeName=" + node})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// podsToEvict returns the pods that are moved off a node before changing its network provider:
+// all but DaemonSet, static and host network pods.
+func podsToEvict(pods []corev1.Pod) []corev1.Pod {
+	var evict []corev1.Pod
+	for _, p := range pods {
+		if p.Spec.HostNetwork || ownedByDaemonSet(p) {
+			continue
+		}
+		if _, ok := p.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		if p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		evict = append(evict, p)
+	}
+	return evict
+}
+
+func ownedByDaemonSet(p corev1.Pod) bool {
+	for _, o := range p.OwnerReferences {
+		if o.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *networkMigration) isNetworkProviderPod(p corev1.Pod) bool {
+	for _, o := range p.OwnerReferences {
+		for _, ds := range m.daemonSets {
+			if o.Kind == "DaemonSet" && o.Name == ds && p.Namespace == metav1.NamespaceSystem {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *networkMigration) waitForPodsDeleted(pods []corev1.Pod) error {
+	return wait.PollImmediate(networkMigrationPollInterval, m.timeout, func() (bool, error) {
+		for _, p := range pods {
+			current, err := m.client.CoreV1().Pods(p.Namespace).Get(context.TODO(), p.Name, metav1.GetOptions{})
+			if errors.IsNotFound(err) || (err == nil && current.UID != p.UID) {
+				continue
+			}
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+func (m *networkMigration) waitForFlannelRemoved(node string) error {
+	return wait.PollImmediate(networkMigrationPollInterval, m.timeout, func() (bool, error) {
+		pods, err := m.nodePods(node)
+		if err != nil {
+			return false, nil
+		}
+		for _, p := range pods {
+			for _, o := range p.OwnerReferences {
+				if o.Kind == "DaemonSet" && o.Name == flannelDaemonSet {
+					return false, nil
+				}
+			}
+		}
+		return true, nil
+	})
+}
+
+func (m *networkMigration) waitForDaemonSetPodReady(name, node string) error {
+	ds, err := m.client.AppsV1().DaemonSets(metav1.NamespaceSystem).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	selector := labels.SelectorFromSet(ds.Spec.Selector.MatchLabels).String()
+	return wait.PollImmediate(networkMigrationPollInterval, m.timeout, func() (bool, error) {
+		pods, err := m.client.CoreV1().Pods(metav1.NamespaceSystem).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: selector,
+			FieldSelector: "spec.nodeName=" + node,
+		})
+		if err != nil {
+			return false, nil
+		}
+		for _, p := range pods.Items {
+			for _, c := range p.Status.Conditions {
+				if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	})
+}
+
+// runPod runs a copy of pod on node to completion and deletes it.
+func (m *networkMigration) runPod(pod *corev1.Pod, node string) error {
+	p := pod.DeepCopy()
+	p.Spec.NodeName = node
+	pods := m.client.CoreV1().Pods(p.Namespace)
+	// Remove a pod left behind by an interrupted migration.
+	if err := pods.Delete(context.TODO(), p.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err := wait.PollImmediate(networkMigrationPollInterval, m.timeout, func() (bool, error) {
+		_, err := pods.Get(context.TODO(), p.Name, metav1.GetOptions{})
+		return errors.IsNotFound(err), nil
+	}); err != nil {
+		return fmt.Errorf("waiting for the previous pod %s to be deleted: %v", p.Name, err)
+	}
+	if _, err := pods.Create(context.TODO(), p, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	defer pods.Delete(context.TODO(), p.Name, metav1.DeleteOptions{})
+
+	var phase corev1.PodPhase
+	err := wait.PollImmediate(networkMigrationPollInterval, m.timeout, func() (bool, error) {
+		current, err := pods.Get(context.TODO(), p.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		phase = current.Status.Phase
+		return phase == corev1.PodSucceeded || phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("pod %s did not complete, last phase %q: %v", p.Name, phase, err)
+	}
+	if phase == corev1.PodFailed {
+		logs, _ := pods.GetLogs(p.Name, &corev1.PodLogOptions{}).Do(context.TODO()).Raw()
+		return fmt.Errorf("pod %s failed: %s", p.Name, strings.TrimSpace(string(logs)))
+	}
+	return nil
+}
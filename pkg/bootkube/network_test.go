@@ -0,0 +1,98 @@
+package bootkube
+
+import (
+	"encoding/json"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+func TestNetworkMigrationManifests(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: flannelConfigMap, Namespace: metav1.NamespaceSystem},
+		Data:       map[string]string{"net-conf.json": `{"Network": "10.5.0.0/16", "Backend": {"Type": "vxlan"}}`},
+	})
+	conf, err := networkMigrationAssetConfig(client, "https://10.0.0.1:6443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conf.PodCIDRIPv4(); got != "10.5.0.0/16" {
+		t.Errorf("got pod CIDR %s, want: 10.5.0.0/16", got)
+	}
+	conf.NetworkProvider = asset.NetworkCalico
+	as, err := asset.NewNetworkAssets(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := networkMigrationManifests(as, asset.NetworkCalico)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var daemonSets int
+	for _, m := range manifests {
+		if m.kind != "DaemonSet" {
+			continue
+		}
+		daemonSets++
+		var ds appsv1.DaemonSet
+		if err := json.Unmarshal(m.raw, &ds); err != nil {
+			t.Fatal(err)
+		}
+		if got := ds.Spec.Template.Spec.NodeSelector[NetworkMigrationLabel]; got != asset.NetworkCalico {
+			t.Errorf("DaemonSet %s is restricted to %s=%q, want: %q", ds.Name, NetworkMigrationLabel, got, asset.NetworkCalico)
+		}
+	}
+	if daemonSets != 1 {
+		t.Errorf("got %d DaemonSets, want: 1", daemonSets)
+	}
+}
+
+func TestMigrateNetworkUnsupportedTarget(t *testing.T) {
+	for _, to := range []string{"", asset.NetworkFlannel, asset.NetworkCanal, asset.NetworkNone} {
+		if err := MigrateNetwork(nil, NetworkMigrationConfig{To: to}); err == nil {
+			t.Errorf("MigrateNetwork(--to=%q) = nil, want error", to)
+		}
+	}
+}
+
+func TestPodsToEvict(t *testing.T) {
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "app"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "daemon", OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "kube-proxy"}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "static", Annotations: map[string]string{corev1.MirrorPodAnnotationKey: "hash"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "host"}, Spec: corev1.PodSpec{HostNetwork: true}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "done"}, Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "replica", OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "coredns"}}}},
+	}
+	var got []string
+	for _, p := range podsToEvict(pods) {
+		got = append(got, p.Name)
+	}
+	if len(got) != 2 || got[0] != "app" || got[1] != "replica" {
+		t.Errorf("got %v, want: [app replica]", got)
+	}
+}
+
+func TestFlannelCleanupPod(t *testing.T) {
+	flannel := &appsv1.DaemonSet{}
+	if _, err := flannelCleanupPod(flannel); err == nil {
+		t.Error("flannelCleanupPod() of a DaemonSet without flannel container = nil, want error")
+	}
+	flannel.Spec.Template.Spec.Containers = []corev1.Container{{Name: "kube-flannel", Image: "quay.io/coreos/flannel:v0.11.0-amd64"}}
+	flannel.Spec.Template.Spec.Volumes = []corev1.Volume{{
+		Name:         "cni",
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/etc/kubernetes/cni/net.d"}},
+	}}
+	pod, err := flannelCleanupPod(flannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Spec.Containers[0].Image != "quay.io/coreos/flannel:v0.11.0-amd64" || pod.Spec.Volumes[0].HostPath.Path != "/etc/kubernetes/cni/net.d" {
+		t.Errorf("cleanup pod does not use the flannel image and CNI directory: %+v", pod.Spec)
+	}
+}
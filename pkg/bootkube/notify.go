@@ -0,0 +1,85 @@
+package bootkube
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The states of sd_notify(3) bootkube start sends.
+const (
+	notifyReady    = "READY=1"
+	notifyStatus   = "STATUS="
+	notifyWatchdog = "WATCHDOG=1"
+)
+
+// phaseStatus are the systemd status lines of the phases of bootkube start.
+var phaseStatus = map[string]string{
+	phaseStartingControlPlane: "Starting the bootstrap control plane",
+	phaseWaitingForAPIServer:  "Waiting for the apiserver",
+	phaseCreatingAssets:       "Creating the cluster assets",
+	phaseWaitingForPods:       "Waiting for the required pods",
+	phasePivoting:             "Pivoting to the self-hosted control plane",
+	phaseDone:                 "The cluster is bootstrapped",
+	phaseFailed:               "Bootstrapping failed",
+}
+
+// sdNotify sends the state to the service manager if bootkube start runs as a systemd service of
+// Type=notify, see sd_notify(3). It does nothing otherwise.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading @ is an abstract socket.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often to ping the watchdog of the systemd service, half its
+// WatchdogSec=, or zero if it isn't enabled for bootkube.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// startWatchdog pings the watchdog of the systemd service, if enabled, until the returned
+// function is called. The process is alive as long as it pings, a hanging bootstrap is bounded by
+// --timeout instead.
+func startWatchdog() (stop func()) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := sdNotify(notifyWatchdog); err != nil {
+					debugf("failed to ping the systemd watchdog: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,80 @@
+package bootkube
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSDNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("NOTIFY_SOCKET", socket)
+
+	p := newProgress(nil)
+	p.setPhase(phasePivoting)
+	p.setPhase(phaseDone)
+	p.fail(errors.New("timed out"))
+
+	want := []string{
+		"STATUS=Starting the bootstrap control plane",
+		"STATUS=Pivoting to the self-hosted control plane",
+		"READY=1\nSTATUS=The cluster is bootstrapped",
+		"STATUS=Bootstrapping failed: timed out",
+	}
+	var got []string
+	buf := make([]byte, 1024)
+	for range want {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got notifications %q, want %q", got, want)
+	}
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	if err := sdNotify(notifyReady); err != nil {
+		t.Errorf("sdNotify() without NOTIFY_SOCKET = %v, want: nil", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	for _, tt := range []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"invalid", "", 0},
+		{"10000000", "", 5 * time.Second},
+		{"10000000", strconv.Itoa(os.Getpid()), 5 * time.Second},
+		{"10000000", "1", 0},
+	} {
+		os.Setenv("WATCHDOG_USEC", tt.usec)
+		os.Setenv("WATCHDOG_PID", tt.pid)
+		if got := watchdogInterval(); got != tt.want {
+			t.Errorf("watchdogInterval() with WATCHDOG_USEC=%q WATCHDOG_PID=%q = %v, want %v", tt.usec, tt.pid, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package bootkube
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// pivotLeaseName is the Lease in kube-system a master bootstrapping at once with others holds
+// while it replaces its bootstrap control plane, so that the others keep serving.
+const pivotLeaseName = "bootkube-pivot"
+
+// pivotInterval is how often the pivot lease and the self-hosted apiserver are checked.
+var pivotInterval = 5 * time.Second // Overridden for testing.
+
+// readBootstrapMasters returns the masters assetDir was rendered to bootstrap at once, nil if it
+// was rendered for a single master.
+func readBootstrapMasters(assetDir string) ([]net.IP, error) {
+	b, err := ioutil.ReadFile(filepath.Join(assetDir, asset.AssetPathBootstrapMasters))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return asset.ParseBootstrapMasters(b)
+}
+
+// localBootstrapMaster returns the master that has one of the addresses of this host.
+func localBootstrapMaster(masters []net.IP, addrs []net.Addr) (net.IP, error) {
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		for _, master := range masters {
+			if master.Equal(ipNet.IP) {
+				return master, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("none of the bootstrap masters %v is an address of this host", masters)
+}
+
+// pivotOneAtATime tears down the bootstrap control plane of the master once it holds the pivot
+// lease, and releases the lease when its self-hosted apiserver is ready.
+func pivotOneAtATime(ctx context.Context, client kubernetes.Interface, bcp *bootstrapControlPlane, master net.IP, namespace string) error {
+	holder := master.String()
+	UserOutput("Waiting for the other bootstrap masters to pivot...\n")
+	if err := acquirePivotLease(ctx, client, holder); err != nil {
+		return fmt.Errorf("failed to acquire the pivot lease: %v", err)
+	}
+	defer func() {
+		if err := releasePivotLease(client, holder); err != nil {
+			UserWarning("failed to release the pivot lease, the other masters pivot when it expires: %v\n", err)
+		}
+	}()
+
+	if err := bcp.Teardown(); err != nil {
+		return err
+	}
+	UserOutput("Waiting for the self-hosted apiserver on %s...\n", master)
+	return waitForSelfHostedAPIServer(ctx, client, master, namespace)
+}
+
+// acquirePivotLease waits until holder holds the pivot lease, or ctx is done. Leases of other
+// holders are taken over once expired, e.g. when bootkube start failed on their master. The lease
+// is held until the deadline of ctx, by which the pivot is over either way.
+func acquirePivotLease(ctx context.Context, client kubernetes.Interface, holder string) error {
+	return wait.PollImmediateUntil(pivotInterval, func() (bool, error) {
+		duration := DefaultPhaseTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			duration = time.Until(deadline)
+		}
+		acquired, err := tryAcquireLease(ctx, client, pivotLeaseName, holder, duration)
+		if err != nil {
+			debugf("Unable to acquire the pivot lease: %v", err)
+			return false, nil
+		}
+		return acquired, nil
+	}, ctx.Done())
+}
+
+// tryAcquireLease acquires the lease name in kube-system for holder for duration, unless another
+// holder holds it and it hasn't expired. Conflicts with other holders acquiring it at the same time
+// aren't errors, the lease just isn't acquired.
+func tryAcquireLease(ctx context.Context, client kubernetes.Interface, name, holder string, duration time.Duration) (bool, error) {
+	leases := client.CoordinationV1().Leases(metav1.NamespaceSystem)
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(duration / time.Second)
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &seconds,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem},
+			Spec:       spec,
+		}, metav1.CreateOptions{})
+		return leaseResult(err)
+	}
+	if err != nil {
+		return false, err
+	}
+	if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != holder && !leaseExpired(lease, now.Time) {
+		return false, nil
+	}
+	lease.Spec = spec
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return leaseResult(err)
+}
+
+// leaseResult reports whether creating or updating a lease acquired it.
+func leaseResult(err error) (bool, error) {
+	if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return now.After(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// releasePivotLease deletes the pivot lease if holder holds it.
+func releasePivotLease(client kubernetes.Interface, holder string) error {
+	return releaseLease(client, pivotLeaseName, holder)
+}
+
+// releaseLease deletes the lease name in kube-system if holder holds it.
+func releaseLease(client kubernetes.Interface, name, holder string) error {
+	leases := client.CoordinationV1().Leases(metav1.NamespaceSystem)
+	lease, err := leases.Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return nil
+	}
+	err = leases.Delete(context.TODO(), name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// waitForSelfHostedAPIServer waits until the self-hosted apiserver pod in namespace on the master
+// is ready. The apiserver is unreachable through the master in the meantime, so errors are retried.
+func waitForSelfHostedAPIServer(ctx context.Context, client kubernetes.Interface, master net.IP, namespace string) error {
+	return wait.PollImmediateUntil(pivotInterval, func() (bool, error) {
+		ready, err := selfHostedAPIServerReady(ctx, client, master, namespace)
+		if err != nil {
+			debugf("Unable to list apiserver pods: %v", err)
+		}
+		return ready, nil
+	}, ctx.Done())
+}
+
+// selfHostedAPIServerReady reports whether a self-hosted apiserver pod in namespace is ready, on
+// the master unless it is nil.
+func selfHostedAPIServerReady(ctx context.Context, client kubernetes.Interface, master net.IP, namespace string) (bool, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "tier=control-plane,k8s-app=kube-apiserver",
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		if master != nil && !master.Equal(net.ParseIP(pod.Status.HostIP)) {
+			continue
+		}
+		if podReady(&pod) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
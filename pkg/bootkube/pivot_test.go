@@ -0,0 +1,125 @@
+package bootkube
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLocalBootstrapMaster(t *testing.T) {
+	masters := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+		&net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(24, 32)},
+	}
+	master, err := localBootstrapMaster(masters, addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !master.Equal(masters[1]) {
+		t.Errorf("got master %s, want: %s", master, masters[1])
+	}
+	if _, err := localBootstrapMaster(masters, addrs[:1]); err == nil {
+		t.Error("expected an error for a host that isn't a bootstrap master")
+	}
+}
+
+func TestPivotLease(t *testing.T) {
+	defer func(interval time.Duration) { pivotInterval = interval }(pivotInterval)
+	pivotInterval = 10 * time.Millisecond
+
+	other := "10.0.0.1"
+	duration := int32(60)
+	renewed := metav1.NewMicroTime(time.Now())
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: pivotLeaseName, Namespace: metav1.NamespaceSystem},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &other,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renewed,
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := acquirePivotLease(ctx, client, "10.0.0.2"); err == nil {
+		t.Fatal("acquired a lease held by another master")
+	}
+	if err := releasePivotLease(client, "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(context.TODO(), pivotLeaseName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("released the lease of another master: %v", err)
+	}
+
+	if err := releasePivotLease(client, other); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := acquirePivotLease(ctx, client, "10.0.0.2"); err != nil {
+		t.Fatalf("acquirePivotLease() = %v, want: nil", err)
+	}
+	lease, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Get(context.TODO(), pivotLeaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *lease.Spec.HolderIdentity != "10.0.0.2" {
+		t.Errorf("got lease holder %s, want: 10.0.0.2", *lease.Spec.HolderIdentity)
+	}
+
+	// An expired lease is taken over.
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	lease.Spec.RenewTime = &expired
+	if _, err := client.CoordinationV1().Leases(metav1.NamespaceSystem).Update(context.TODO(), lease, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := acquirePivotLease(ctx, client, "10.0.0.3"); err != nil {
+		t.Fatalf("acquirePivotLease() = %v, want: nil", err)
+	}
+}
+
+func TestWaitForSelfHostedAPIServer(t *testing.T) {
+	defer func(interval time.Duration) { pivotInterval = interval }(pivotInterval)
+	pivotInterval = 10 * time.Millisecond
+
+	pod := func(name, hostIP string, labels map[string]string, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem, Labels: labels},
+			Status: corev1.PodStatus{
+				HostIP:     hostIP,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+			},
+		}
+	}
+	labels := map[string]string{"tier": "control-plane", "k8s-app": "kube-apiserver"}
+	client := fake.NewSimpleClientset(
+		pod("bootstrap-kube-apiserver-master-2", "10.0.0.2", nil, corev1.ConditionTrue),
+		pod("kube-apiserver-a", "10.0.0.1", labels, corev1.ConditionTrue),
+		pod("kube-apiserver-b", "10.0.0.2", labels, corev1.ConditionFalse),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := waitForSelfHostedAPIServer(ctx, client, net.ParseIP("10.0.0.2"), metav1.NamespaceSystem); err == nil {
+		t.Error("waitForSelfHostedAPIServer() = nil for an apiserver that isn't ready")
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := waitForSelfHostedAPIServer(ctx, client, net.ParseIP("10.0.0.1"), metav1.NamespaceSystem); err != nil {
+		t.Errorf("waitForSelfHostedAPIServer() = %v, want: nil", err)
+	}
+	// Without a master, any ready apiserver will do.
+	if ready, err := selfHostedAPIServerReady(context.TODO(), client, nil, metav1.NamespaceSystem); err != nil || !ready {
+		t.Errorf("selfHostedAPIServerReady() = %v, %v, want: true, nil", ready, err)
+	}
+	if ready, err := selfHostedAPIServerReady(context.TODO(), client, nil, "other"); err != nil || ready {
+		t.Errorf("selfHostedAPIServerReady() in another namespace = %v, %v, want: false, nil", ready, err)
+	}
+}
@@ -0,0 +1,276 @@
+package bootkube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The phases of bootkube start, in order. A failed start ends in phaseFailed instead of phaseDone.
+const (
+	phaseStartingControlPlane = "starting-control-plane"
+	phaseWaitingForAPIServer  = "waiting-for-apiserver"
+	phaseCreatingAssets       = "creating-assets"
+	phaseWaitingForPods       = "waiting-for-pods"
+	phasePivoting             = "pivoting"
+	phaseDone                 = "done"
+	phaseFailed               = "failed"
+)
+
+var phases = []string{
+	phaseStartingControlPlane,
+	phaseWaitingForAPIServer,
+	phaseCreatingAssets,
+	phaseWaitingForPods,
+	phasePivoting,
+	phaseDone,
+	phaseFailed,
+}
+
+// The statuses of a manifest of the asset directory.
+const (
+	assetCreated  = "created"
+	assetExisting = "existing"
+	assetUpdated  = "updated"
+	assetSkipped  = "skipped"
+	assetFailed   = "failed"
+	assetPruned   = "pruned"
+)
+
+// The progress events of bootkube start.
+const (
+	eventPhaseStarted   = "phase-started"
+	eventPhaseCompleted = "phase-completed"
+	eventAsset          = "asset"
+	eventError          = "error"
+	eventPivotCompleted = "pivot-completed"
+)
+
+// progressEvent is a line of the progress event stream.
+type progressEvent struct {
+	Time      string `json:"time"`
+	Event     string `json:"event"`
+	Phase     string `json:"phase,omitempty"`
+	File      string `json:"file,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// progress tracks the phase of bootkube start and the status of each manifest, for the status
+// endpoint, and writes each change to the progress event stream if there is one. All methods can
+// be called on a nil progress, which tracks nothing.
+type progress struct {
+	sync.Mutex
+	start      time.Time
+	phase      string
+	phaseStart time.Time
+	// completed are the phases completed so far, in order.
+	completed []phaseTiming
+	assets    map[assetKey]string
+	events    io.Writer
+}
+
+// phaseTiming is when a phase of bootkube start started and completed.
+type phaseTiming struct {
+	Phase     string    `json:"phase"`
+	Started   time.Time `json:"started"`
+	Completed time.Time `json:"completed"`
+}
+
+// assetKey identifies a manifest of the asset directory.
+type assetKey struct {
+	file, kind, namespace, name string
+}
+
+// newProgress returns the progress of a bootkube start that writes its events to events, unless
+// it is nil.
+func newProgress(events io.Writer) *progress {
+	now := time.Now()
+	p := &progress{
+		start:      now,
+		phase:      phaseStartingControlPlane,
+		phaseStart: now,
+		assets:     map[assetKey]string{},
+		events:     events,
+	}
+	p.event(progressEvent{Event: eventPhaseStarted, Phase: p.phase})
+	p.notify(p.phase, nil)
+	return p
+}
+
+// setPhase completes the current phase and starts the next one.
+func (p *progress) setPhase(phase string) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if phase == p.phase {
+		return
+	}
+	now := time.Now()
+	if phase != phaseFailed {
+		p.writeEvent(progressEvent{Event: eventPhaseCompleted, Phase: p.phase})
+		p.completed = append(p.completed, phaseTiming{Phase: p.phase, Started: p.phaseStart, Completed: now})
+	}
+	p.phase = phase
+	p.phaseStart = now
+	p.writeEvent(progressEvent{Event: eventPhaseStarted, Phase: phase})
+	if phase != phaseFailed {
+		p.notify(phase, nil)
+	}
+}
+
+// fail reports the error bootkube start failed with during the current phase.
+func (p *progress) fail(err error) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	p.writeEvent(progressEvent{Event: eventError, Phase: p.phase, Error: err.Error()})
+	p.Unlock()
+	p.setPhase(phaseFailed)
+	p.notify(phaseFailed, err)
+}
+
+// currentPhase returns the phase bootkube start is in.
+func (p *progress) currentPhase() string {
+	if p == nil {
+		return ""
+	}
+	p.Lock()
+	defer p.Unlock()
+	return p.phase
+}
+
+// notify sends the status of the phase to systemd, and that bootkube start is ready once it's
+// done, i.e. after the pivot.
+func (p *progress) notify(phase string, err error) {
+	state := notifyStatus + phaseStatus[phase]
+	if err != nil {
+		state += ": " + err.Error()
+	}
+	if phase == phaseDone {
+		state = notifyReady + "\n" + state
+	}
+	if err := sdNotify(state); err != nil {
+		debugf("failed to notify systemd: %v", err)
+	}
+}
+
+func (p *progress) setAsset(m manifest, status string) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.assets[assetKey{m.filepath, m.kind, m.namespace, m.name}] = status
+	p.writeEvent(progressEvent{Event: eventAsset, Phase: p.phase, File: m.filepath, Kind: m.kind, Namespace: m.namespace, Name: m.name, Status: status})
+}
+
+func (p *progress) event(e progressEvent) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.writeEvent(e)
+}
+
+// writeEvent writes the event to the progress event stream. The caller holds the lock.
+func (p *progress) writeEvent(e progressEvent) {
+	if p.events == nil {
+		return
+	}
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	p.events.Write(append(b, '\n'))
+}
+
+// serveStatus serves the progress on addr until the returned function is called: /healthz answers
+// ok unless bootkube start failed, and /metrics the progress in the Prometheus text format.
+func serveStatus(addr string, p *progress) (stop func(), err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve the status on %s: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", p.serveHealthz)
+	mux.HandleFunc("/metrics", p.serveMetrics)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	UserOutput("Serving the bootstrap status on http://%s/healthz and http://%s/metrics\n", l.Addr(), l.Addr())
+	return func() { srv.Close() }, nil
+}
+
+func (p *progress) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	p.Lock()
+	phase := p.phase
+	p.Unlock()
+	if phase == phaseFailed {
+		http.Error(w, phase, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "ok: %s\n", phase)
+}
+
+func (p *progress) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	p.writeMetrics(w)
+}
+
+func (p *progress) writeMetrics(w io.Writer) {
+	p.Lock()
+	defer p.Unlock()
+
+	fmt.Fprintln(w, "# HELP bootkube_phase The phase of bootkube start, 1 for the current phase.")
+	fmt.Fprintln(w, "# TYPE bootkube_phase gauge")
+	for _, phase := range phases {
+		var v int
+		if phase == p.phase {
+			v = 1
+		}
+		fmt.Fprintf(w, "bootkube_phase{phase=%q} %d\n", phase, v)
+	}
+
+	fmt.Fprintln(w, "# HELP bootkube_elapsed_seconds The time since bootkube start started.")
+	fmt.Fprintln(w, "# TYPE bootkube_elapsed_seconds gauge")
+	fmt.Fprintf(w, "bootkube_elapsed_seconds %g\n", time.Since(p.start).Seconds())
+
+	var lines []string
+	counts := map[string]int{}
+	for a, status := range p.assets {
+		counts[status]++
+		lines = append(lines, fmt.Sprintf("bootkube_asset_status{file=\"%s\",kind=\"%s\",namespace=\"%s\",name=\"%s\",status=\"%s\"} 1",
+			escapeLabel(a.file), escapeLabel(a.kind), escapeLabel(a.namespace), escapeLabel(a.name), status))
+	}
+	sort.Strings(lines)
+	fmt.Fprintln(w, "# HELP bootkube_asset_status The status of each manifest of the asset directory.")
+	fmt.Fprintln(w, "# TYPE bootkube_asset_status gauge")
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+
+	fmt.Fprintln(w, "# HELP bootkube_assets The number of manifests of the asset directory by status.")
+	fmt.Fprintln(w, "# TYPE bootkube_assets gauge")
+	for _, status := range []string{assetCreated, assetExisting, assetUpdated, assetSkipped, assetFailed, assetPruned} {
+		fmt.Fprintf(w, "bootkube_assets{status=%q} %d\n", status, counts[status])
+	}
+}
+
+// escapeLabel escapes a label value of the Prometheus text format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,90 @@
+package bootkube
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	p := newProgress(nil)
+	p.setPhase(phaseCreatingAssets)
+	p.setAsset(manifest{filepath: "manifests/kube-apiserver.yaml", kind: "DaemonSet", namespace: "kube-system", name: "kube-apiserver"}, assetCreated)
+	p.setAsset(manifest{filepath: "manifests/bad.yaml", kind: "ConfigMap", namespace: "kube-system", name: `bad"name`}, assetFailed)
+
+	var buf bytes.Buffer
+	p.writeMetrics(&buf)
+	for _, want := range []string{
+		`bootkube_phase{phase="creating-assets"} 1`,
+		`bootkube_phase{phase="waiting-for-apiserver"} 0`,
+		`bootkube_asset_status{file="manifests/kube-apiserver.yaml",kind="DaemonSet",namespace="kube-system",name="kube-apiserver",status="created"} 1`,
+		`bootkube_asset_status{file="manifests/bad.yaml",kind="ConfigMap",namespace="kube-system",name="bad\"name",status="failed"} 1`,
+		`bootkube_assets{status="created"} 1`,
+		`bootkube_assets{status="failed"} 1`,
+		`bootkube_assets{status="skipped"} 0`,
+		"bootkube_elapsed_seconds ",
+	} {
+		if !strings.Contains(buf.String(), "\n"+want) {
+			t.Errorf("metrics don't contain %s:\n%s", want, buf.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	p.serveHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok: creating-assets\n" {
+		t.Errorf("got healthz %d %q, want: 200 ok", w.Code, w.Body.String())
+	}
+	p.setPhase(phaseFailed)
+	w = httptest.NewRecorder()
+	p.serveHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got healthz %d once bootkube start failed, want: 500", w.Code)
+	}
+
+	// A nil progress tracks nothing.
+	var nilProgress *progress
+	nilProgress.setPhase(phaseDone)
+	nilProgress.setAsset(manifest{}, assetCreated)
+}
+
+func TestProgressEvents(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf)
+	p.setPhase(phaseCreatingAssets)
+	p.setAsset(manifest{filepath: "manifests/kube-apiserver.yaml", kind: "DaemonSet", namespace: "kube-system", name: "kube-apiserver"}, assetCreated)
+	p.setPhase(phaseWaitingForPods)
+	p.fail(errors.New("timed out"))
+
+	want := []progressEvent{
+		{Event: eventPhaseStarted, Phase: phaseStartingControlPlane},
+		{Event: eventPhaseCompleted, Phase: phaseStartingControlPlane},
+		{Event: eventPhaseStarted, Phase: phaseCreatingAssets},
+		{Event: eventAsset, Phase: phaseCreatingAssets, File: "manifests/kube-apiserver.yaml", Kind: "DaemonSet", Namespace: "kube-system", Name: "kube-apiserver", Status: assetCreated},
+		{Event: eventPhaseCompleted, Phase: phaseCreatingAssets},
+		{Event: eventPhaseStarted, Phase: phaseWaitingForPods},
+		{Event: eventError, Phase: phaseWaitingForPods, Error: "timed out"},
+		{Event: eventPhaseStarted, Phase: phaseFailed},
+	}
+	var got []progressEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e progressEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, e.Time); err != nil {
+			t.Errorf("invalid time of %s event: %v", e.Event, err)
+		}
+		e.Time = ""
+		got = append(got, e)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events:\n%+v\nwant:\n%+v", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package bootkube
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+)
+
+// ManagedLabel marks the objects bootkube start created from the asset directory. With --prune,
+// the objects with the label whose manifest was removed from the asset directory are deleted.
+const ManagedLabel = "bootkube.alpha.kubernetes.io/managed"
+
+// neverPruned are the kinds that aren't pruned even if they have the ManagedLabel: deleting a
+// namespace or a CRD deletes all the objects in it, including those bootkube doesn't manage.
+var neverPruned = map[string]bool{
+	"Namespace":                true,
+	"CustomResourceDefinition": true,
+}
+
+// withManagedLabel returns the raw manifest with the ManagedLabel.
+func withManagedLabel(raw []byte) ([]byte, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %v", err)
+	}
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		obj["metadata"] = metadata
+	}
+	labels, _ := metadata["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = map[string]interface{}{}
+		metadata["labels"] = labels
+	}
+	labels[ManagedLabel] = "true"
+	return json.Marshal(obj)
+}
+
+// prune deletes the objects with the ManagedLabel that none of the manifests are for, like
+// `kubectl apply --prune`. Objects are matched by kind, namespace and name, so that those served
+// by several API groups, like Ingresses, aren't taken for removed ones. Objects owned by others
+// are left to the garbage collector.
+func (c *creater) prune(manifests []manifest) error {
+	type object struct{ kind, namespace, name string }
+	desired := map[object]bool{}
+	clusterScoped := map[object]bool{}
+	for _, m := range manifests {
+		desired[object{m.kind, m.namespace, m.name}] = true
+		clusterScoped[object{m.kind, "", m.name}] = true
+	}
+
+	lists, err := c.mapper.discoveryClient.ServerPreferredResources()
+	if err != nil {
+		// The objects of API groups that can't be discovered, e.g. of an unavailable aggregated
+		// apiserver, aren't pruned.
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return fmt.Errorf("discovery failed: %v", err)
+		}
+		UserWarning("Not pruning some API groups: %v\n", err)
+	}
+
+	UserOutput("Pruning cluster assets removed from the asset directory...\n")
+	var failed int
+	pruned := map[object]bool{}
+	for _, l := range lists {
+		for _, r := range l.APIResources {
+			if strings.Contains(r.Name, "/") || neverPruned[r.Kind] || !hasVerbs(r.Verbs, "list", "delete") {
+				continue
+			}
+			b, err := c.client.Get().
+				AbsPath(manifest{apiVersion: l.GroupVersion}.urlPath(r.Name, false)).
+				Param("labelSelector", ManagedLabel+"=true").
+				DoRaw(c.ctx)
+			if err != nil {
+				failed++
+				UserError("failed to list the %s of %s to prune: %v\n", r.Name, l.GroupVersion, err)
+				continue
+			}
+			var list struct {
+				Items []struct {
+					Metadata struct {
+						Name            string            `json:"name"`
+						Namespace       string            `json:"namespace"`
+						OwnerReferences []json.RawMessage `json:"ownerReferences"`
+					} `json:"metadata"`
+				} `json:"items"`
+			}
+			if err := json.Unmarshal(b, &list); err != nil {
+				return fmt.Errorf("failed to parse the %s list: %v", r.Kind, err)
+			}
+			for _, item := range list.Items {
+				o := object{r.Kind, item.Metadata.Namespace, item.Metadata.Name}
+				if desired[o] || (!r.Namespaced && clusterScoped[o]) || len(item.Metadata.OwnerReferences) > 0 || pruned[o] {
+					continue
+				}
+				pruned[o] = true
+				m := manifest{kind: r.Kind, apiVersion: l.GroupVersion, namespace: o.namespace, name: o.name}
+				if err := c.delete(m); err != nil && !errors.IsNotFound(err) {
+					failed++
+					c.progress.setAsset(m, assetFailed)
+					UserError("failed to prune%s: %v\n", m, err)
+					continue
+				}
+				c.progress.setAsset(m, assetPruned)
+				UserOutput("Pruned%s\n", m)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d cluster assets could not be pruned", failed)
+	}
+	return nil
+}
+
+func hasVerbs(verbs []string, want ...string) bool {
+	has := map[string]bool{}
+	for _, v := range verbs {
+		has[v] = true
+	}
+	for _, v := range want {
+		if !has[v] {
+			return false
+		}
+	}
+	return true
+}
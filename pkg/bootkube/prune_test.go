@@ -0,0 +1,99 @@
+package bootkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestWithManagedLabel(t *testing.T) {
+	for _, raw := range []string{
+		`{"kind":"ConfigMap","apiVersion":"v1"}`,
+		`{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"kube-proxy","labels":{"k8s-app":"kube-proxy"}}}`,
+	} {
+		b, err := withManagedLabel([]byte(raw))
+		if err != nil {
+			t.Fatalf("withManagedLabel(%s) failed: %v", raw, err)
+		}
+		var obj struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(b, &obj); err != nil {
+			t.Fatal(err)
+		}
+		if obj.Kind != "ConfigMap" || obj.Metadata.Labels[ManagedLabel] != "true" {
+			t.Errorf("withManagedLabel(%s) = %s, want the ConfigMap with the %s label", raw, b, ManagedLabel)
+		}
+	}
+	if _, err := withManagedLabel([]byte("kind: ConfigMap")); err == nil {
+		t.Error("withManagedLabel() of invalid JSON = nil error, want an error")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api":
+			fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+		case r.URL.Path == "/apis":
+			fmt.Fprint(w, `{"kind":"APIGroupList","groups":[]}`)
+		case r.URL.Path == "/api/v1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[`+
+				`{"name":"configmaps","namespaced":true,"kind":"ConfigMap","verbs":["list","delete"]},`+
+				`{"name":"namespaces","namespaced":false,"kind":"Namespace","verbs":["list","delete"]},`+
+				`{"name":"pods/log","namespaced":true,"kind":"Pod","verbs":["get"]}]}`)
+		case r.Method == "GET" && r.URL.Path == "/api/v1/configmaps":
+			if r.URL.Query().Get("labelSelector") != ManagedLabel+"=true" {
+				t.Errorf("unexpected label selector %q", r.URL.Query().Get("labelSelector"))
+			}
+			fmt.Fprint(w, `{"kind":"ConfigMapList","items":[`+
+				`{"metadata":{"name":"kept","namespace":"kube-system"}},`+
+				`{"metadata":{"name":"removed","namespace":"kube-system"}},`+
+				`{"metadata":{"name":"kept","namespace":"default"}},`+
+				`{"metadata":{"name":"owned","namespace":"kube-system","ownerReferences":[{"kind":"Deployment","name":"owner"}]}}]}`)
+		case r.Method == "DELETE":
+			mu.Lock()
+			deleted = append(deleted, r.URL.Path)
+			mu.Unlock()
+			fmt.Fprint(w, `{"kind":"Status","status":"Success"}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	c, err := newCreater(&rest.Config{Host: srv.URL}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ctx = context.TODO()
+
+	if err := c.prune([]manifest{
+		{kind: "ConfigMap", apiVersion: "v1", namespace: "kube-system", name: "kept"},
+		{kind: "Namespace", apiVersion: "v1", name: "kube-system"},
+	}); err != nil {
+		t.Fatalf("prune() failed: %v", err)
+	}
+	sort.Strings(deleted)
+	want := []string{
+		"/api/v1/namespaces/default/configmaps/kept",
+		"/api/v1/namespaces/kube-system/configmaps/removed",
+	}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("prune() deleted %v, want %v", deleted, want)
+	}
+}
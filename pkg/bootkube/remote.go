@@ -0,0 +1,285 @@
+package bootkube
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+// The schemes of remote asset directories: a tarball of the asset directory, optionally gzipped,
+// in an S3 or GCS bucket or at an HTTPS URL.
+const (
+	schemeS3    = "s3"
+	schemeGCS   = "gs"
+	schemeHTTPS = "https"
+)
+
+// The client HTTPS assets are downloaded with, and the configuration of the S3 and GCS clients on
+// top of their default credential chains. Tests point them at a local server.
+var (
+	assetClient = http.DefaultClient
+	s3Config    = aws.NewConfig()
+	gcsOptions  []option.ClientOption
+)
+
+// IsRemoteAssetDir returns whether assetDir is an s3://, gs:// or https:// URL of an asset tarball
+// instead of a local path.
+func IsRemoteAssetDir(assetDir string) bool {
+	u, err := url.Parse(assetDir)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case schemeS3, schemeGCS, schemeHTTPS:
+		return true
+	}
+	return false
+}
+
+// RedactAssetSource returns the asset directory or bundle source to be printed: URLs without their
+// query, which holds the credentials of presigned URLs.
+func RedactAssetSource(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || u.RawQuery == "" {
+		return source
+	}
+	u.RawQuery = ""
+	return u.String() + "?..."
+}
+
+// FetchAssets downloads the asset tarball at source, extracts it into a new temporary directory
+// and returns the asset directory in it, and a function removing it. The tarball either holds the
+// contents of the asset directory or the asset directory itself.
+//
+// S3 and GCS objects are read with the default credential chains of the AWS and Google Cloud
+// SDKs, HTTPS URLs are fetched as they are, e.g. presigned URLs.
+func FetchAssets(ctx context.Context, source string) (assetDir string, cleanup func(), err error) {
+	body, err := fetch(ctx, source)
+	if err != nil {
+		return "", nil, err
+	}
+	defer body.Close()
+	assetDir, cleanup, err = extractAssets(body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to extract the assets from %s: %v", RedactAssetSource(source), err)
+	}
+	return assetDir, cleanup, nil
+}
+
+// fetch returns the body of the object at the s3://, gs:// or https:// URL source.
+func fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	name := RedactAssetSource(source)
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid asset URL %s", name)
+	}
+	object := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != schemeHTTPS && (u.Host == "" || object == "") {
+		return nil, fmt.Errorf("invalid asset URL %s: want %s://<bucket>/<object>", name, u.Scheme)
+	}
+
+	var body io.ReadCloser
+	switch u.Scheme {
+	case schemeS3:
+		body, err = fetchS3(ctx, u.Host, object)
+	case schemeGCS:
+		body, err = fetchGCS(ctx, u.Host, object)
+	case schemeHTTPS:
+		body, err = fetchHTTPS(ctx, source)
+	default:
+		return nil, fmt.Errorf("unsupported asset URL %s: want an s3://, gs:// or https:// URL", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the assets from %s: %v", name, err)
+	}
+	return body, nil
+}
+
+// fetchS3 returns the body of an S3 object, read with the default credentials of the AWS SDK: the
+// environment, the shared credentials file, or the role of the ECS task or EC2 instance. The
+// region is that of AWS_REGION or the shared config file, or else the region of the bucket.
+func fetchS3(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *s3Config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		region, err := s3manager.GetBucketRegion(ctx, sess, bucket, endpoints.UsEast1RegionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the region of bucket %s: %v", bucket, err)
+		}
+		sess.Config.Region = aws.String(region)
+	}
+	out, err := s3.New(sess).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// fetchGCS returns the body of a GCS object, read with the application default credentials of the
+// Google Cloud SDK: GOOGLE_APPLICATION_CREDENTIALS, the gcloud credentials, or the service account
+// of the GCE instance. Without credentials, the bucket must be public.
+func fetchGCS(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+	opts := gcsOptions
+	if _, err := google.FindDefaultCredentials(ctx, storage.ScopeReadOnly); err != nil {
+		opts = append(opts[:len(opts):len(opts)], option.WithoutAuthentication())
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &gcsObject{Reader: r, client: client}, nil
+}
+
+// gcsObject is the body of a GCS object, closing its client with it.
+type gcsObject struct {
+	*storage.Reader
+	client *storage.Client
+}
+
+func (o *gcsObject) Close() error {
+	err := o.Reader.Close()
+	o.client.Close()
+	return err
+}
+
+// fetchHTTPS returns the body of the object at the https:// URL source.
+func fetchHTTPS(ctx context.Context, source string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := assetClient.Do(req.WithContext(ctx))
+	if uerr, ok := err.(*url.Error); ok {
+		// The error of the client repeats the URL with its query.
+		err = uerr.Err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return resp.Body, nil
+}
+
+// extractAssets extracts the asset tarball into a new temporary directory, in memory if the node
+// has a /dev/shm, and returns the asset directory in it, and a function removing it.
+func extractAssets(r io.Reader) (assetDir string, cleanup func(), err error) {
+	var tmp string
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		tmp = "/dev/shm"
+	}
+	dir, err := ioutil.TempDir(tmp, "bootkube-assets")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := extractTarball(r, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return assetRoot(dir), cleanup, nil
+}
+
+// assetRoot returns the asset directory of an extracted tarball: dir itself, or the only
+// directory in it if the tarball was made of the asset directory instead of its contents.
+func assetRoot(dir string) string {
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil || len(fs) != 1 || !fs[0].IsDir() {
+		return dir
+	}
+	return filepath.Join(dir, fs[0].Name())
+}
+
+// extractTarball extracts the regular files and directories of the tarball, which may be gzipped,
+// into dir. Entries outside of dir are an error.
+func extractTarball(r io.Reader, dir string) error {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(h.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%s is outside of the asset directory", h.Name)
+		}
+		if name == "." {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(h.Mode)&0777|0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unsupported tar entry type %q", h.Name, h.Typeflag)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package bootkube
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// maxRetryBackoff caps the exponential backoff of a RetryPolicy.
+	maxRetryBackoff = 10 * time.Second
+	// retryJitter is the fraction of the backoff added at random, so that masters bootstrapping
+	// at once don't retry in lockstep.
+	retryJitter = 0.2
+)
+
+// RetryPolicy is how bootkube start retries failed requests to the apiserver while creating the
+// assets.
+type RetryPolicy struct {
+	// Retries is how often a failed request is retried.
+	Retries int
+	// Backoff is the wait before the first retry. It doubles with each further retry, up to 10
+	// seconds.
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy of bootkube start.
+var DefaultRetryPolicy = RetryPolicy{Retries: 5, Backoff: time.Second}
+
+// backoff returns the wait before retry n, counting from zero.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < n && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return wait.Jitter(d, retryJitter)
+}
+
+// retry calls fn until it succeeds, fails permanently, was retried the given number of times or ctx
+// is done, and returns its last error. fn reports whether its error may be transient. With a
+// negative number of retries, fn is retried until ctx is done.
+func (p RetryPolicy) retry(ctx context.Context, retries int, fn func() (transient bool, err error)) error {
+	for n := 0; ; n++ {
+		transient, err := fn()
+		if err == nil || !transient || (retries >= 0 && n >= retries) {
+			return err
+		}
+		d := p.backoff(n)
+		debugf("Retrying in %v: %v", d, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
+
+// isTransientCreateError reports whether creating a manifest may succeed when retried, e.g. once
+// the apiserver recovers from throttling or the API of a custom resource is served. Conflicts with
+// existing objects and invalid manifests fail the same way every time.
+func isTransientCreateError(err error) bool {
+	return !errors.IsAlreadyExists(err) && !errors.IsInvalid(err) && !errors.IsBadRequest(err) && !errors.IsMethodNotSupported(err)
+}
@@ -0,0 +1,84 @@
+package bootkube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second}
+	for n, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, maxRetryBackoff, maxRetryBackoff} {
+		got := p.backoff(n)
+		if got < want || got > time.Duration(float64(want)*(1+retryJitter)) {
+			t.Errorf("backoff(%d) = %v, want: %v plus up to %v jitter", n, got, want, retryJitter)
+		}
+	}
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	p := RetryPolicy{Retries: 3, Backoff: time.Millisecond}
+	transientErr := errors.New("connection refused")
+
+	var calls int
+	err := p.retry(context.Background(), p.Retries, func() (bool, error) {
+		calls++
+		return true, transientErr
+	})
+	if err != transientErr || calls != 4 {
+		t.Errorf("got error %v after %d calls, want: %v after 4 calls", err, calls, transientErr)
+	}
+
+	calls = 0
+	err = p.retry(context.Background(), p.Retries, func() (bool, error) {
+		calls++
+		if calls < 3 {
+			return true, transientErr
+		}
+		return false, nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got error %v after %d calls, want: nil after 3 calls", err, calls)
+	}
+
+	calls = 0
+	err = p.retry(context.Background(), p.Retries, func() (bool, error) {
+		calls++
+		return false, transientErr
+	})
+	if err != transientErr || calls != 1 {
+		t.Errorf("got error %v after %d calls, want: %v after a single call for a permanent error", err, calls, transientErr)
+	}
+
+	// Unlimited retries end with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = p.retry(ctx, -1, func() (bool, error) {
+		return true, transientErr
+	})
+	if err != transientErr {
+		t.Errorf("got error %v, want: %v", err, transientErr)
+	}
+}
+
+func TestIsTransientCreateError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "configmaps"}
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("dicovery failed: no resource"), true},
+		{apierrors.NewTooManyRequests("throttled", 1), true},
+		{apierrors.NewServiceUnavailable("starting"), true},
+		{apierrors.NewAlreadyExists(gr, "config"), false},
+		{apierrors.NewBadRequest("bad manifest"), false},
+	} {
+		if got := isTransientCreateError(tt.err); got != tt.want {
+			t.Errorf("isTransientCreateError(%v) = %v, want: %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -20,20 +19,77 @@ import (
 
 const (
 	doesNotExist = "DoesNotExist"
+	// notReady is the status of a running pod that isn't ready yet.
+	notReady = "NotReady"
+	// workloadReady is the status of a workload whose pods are all ready.
+	workloadReady = "Ready"
 )
 
-func WaitUntilPodsRunning(c clientcmd.ClientConfig, pods []string, timeout time.Duration) error {
+// requiredWorkloadKinds are the kinds of workloads that can be required as
+// <namespace>/<kind>/<name>, with the number of their ready and desired pods.
+var requiredWorkloadKinds = map[string]func(c kubernetes.Interface, namespace, name string) (ready, desired int32, err error){
+	"daemonset": func(c kubernetes.Interface, namespace, name string) (int32, int32, error) {
+		ds, err := c.AppsV1().DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, err
+		}
+		return ds.Status.NumberReady, ds.Status.DesiredNumberScheduled, nil
+	},
+	"deployment": func(c kubernetes.Interface, namespace, name string) (int32, int32, error) {
+		d, err := c.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, err
+		}
+		desired := int32(1)
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		return d.Status.ReadyReplicas, desired, nil
+	},
+	"statefulset": func(c kubernetes.Interface, namespace, name string) (int32, int32, error) {
+		ss, err := c.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, err
+		}
+		desired := int32(1)
+		if ss.Spec.Replicas != nil {
+			desired = *ss.Spec.Replicas
+		}
+		return ss.Status.ReadyReplicas, desired, nil
+	},
+}
+
+// ParseRequiredPod validates a required pod, written as <namespace>/<pod-name> to require the
+// pod whose name starts with pod-name, or as <namespace>/<kind>/<name> to require all pods of a
+// DaemonSet, Deployment or StatefulSet.
+func ParseRequiredPod(p string) error {
+	parts := strings.Split(p, "/")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return nil
+	case len(parts) == 3 && parts[0] != "" && parts[2] != "":
+		if _, ok := requiredWorkloadKinds[strings.ToLower(parts[1])]; !ok {
+			return fmt.Errorf("invalid required pod %q: the kind must be DaemonSet, Deployment or StatefulSet", p)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid required pod: expected %q to be of shape <namespace>/<pod-name> or <namespace>/<kind>/<name>", p)
+}
+
+// WaitUntilPodsRunning waits until the pods are running and ready, or ctx is done. See
+// ParseRequiredPod for the format of the pods.
+func WaitUntilPodsRunning(ctx context.Context, c clientcmd.ClientConfig, pods []string) error {
 	sc, err := NewStatusController(c, pods)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	sc.Run(ctx)
 
-	if err := wait.Poll(5*time.Second, timeout, sc.AllRunning); err != nil {
+	if err := wait.PollUntil(5*time.Second, sc.AllRunning, ctx.Done()); err != nil {
 		return fmt.Errorf("error while checking pod status: %v", err)
 	}
 
@@ -46,7 +102,9 @@ type statusController struct {
 	podStore           cache.Store
 	nodeStore          cache.Store
 	watchPods          []string
+	watchWorkloads     []string
 	lastPodPhases      map[string]corev1.PodPhase
+	lastWorkloads      map[string]string
 	lastNodeConditions map[string]corev1.NodeCondition
 }
 
@@ -59,7 +117,15 @@ func NewStatusController(c clientcmd.ClientConfig, pods []string) (*statusContro
 	if err != nil {
 		return nil, err
 	}
-	return &statusController{client: client, watchPods: pods}, nil
+	s := &statusController{client: client}
+	for _, p := range pods {
+		if strings.Count(p, "/") == 2 {
+			s.watchWorkloads = append(s.watchWorkloads, p)
+		} else {
+			s.watchPods = append(s.watchPods, p)
+		}
+	}
+	return s, nil
 }
 
 func (s *statusController) Run(ctx context.Context) {
@@ -116,7 +182,7 @@ func (s *statusController) nodeWatcher(ctx context.Context) {
 func (s *statusController) AllRunning() (bool, error) {
 	var podsRunning, nodesReady, running bool
 
-	podsRunning = s.allPodsRunning()
+	podsRunning = s.allPodsRunning() && s.allWorkloadsReady()
 
 	if podsRunning {
 		nodesReady = s.allNodesReady()
@@ -132,7 +198,7 @@ func (s *statusController) AllRunning() (bool, error) {
 func (s *statusController) allPodsRunning() bool {
 	ps, err := s.PodStatus()
 	if err != nil {
-		glog.Infof("Error retriving pod statuses: %v", err)
+		debugf("Error retrieving pod statuses: %v", err)
 		return false
 	}
 
@@ -157,11 +223,51 @@ func (s *statusController) allPodsRunning() bool {
 	return running
 }
 
+func (s *statusController) allWorkloadsReady() bool {
+	ws := s.WorkloadStatus()
+	if s.lastWorkloads == nil {
+		s.lastWorkloads = ws
+	}
+	changed := !reflect.DeepEqual(ws, s.lastWorkloads)
+	s.lastWorkloads = ws
+
+	ready := true
+	for w, status := range ws {
+		if changed {
+			UserOutput("\tWorkload Status:%24s\t%s\n", w, status)
+		}
+		if status != workloadReady {
+			ready = false
+		}
+	}
+	return ready
+}
+
+// WorkloadStatus returns the status of the required workloads: Ready once all their desired pods
+// are ready, else their number of ready and desired pods or why they can't be determined.
+func (s *statusController) WorkloadStatus() map[string]string {
+	status := make(map[string]string)
+	for _, w := range s.watchWorkloads {
+		parts := strings.Split(w, "/")
+		ready, desired, err := requiredWorkloadKinds[strings.ToLower(parts[1])](s.client, parts[0], parts[2])
+		switch {
+		case err != nil:
+			debugf("Error retrieving the status of %s: %v", w, err)
+			status[w] = doesNotExist
+		case desired > 0 && ready >= desired:
+			status[w] = workloadReady
+		default:
+			status[w] = fmt.Sprintf("%d/%d ready", ready, desired)
+		}
+	}
+	return status
+}
+
 func (s *statusController) allNodesReady() bool {
 	// Check node status to ensure all nodes are Ready
 	ns, err := s.NodeStatus()
 	if err != nil {
-		glog.Infof("Error retrieving node conditions: %v", err)
+		debugf("Error retrieving node conditions: %v", err)
 		return false
 	}
 
@@ -207,11 +313,23 @@ func (s *statusController) PodStatus() (map[string]corev1.PodPhase, error) {
 		}
 		if p, ok := p.(*corev1.Pod); ok {
 			status[watchedPod] = p.Status.Phase
+			if p.Status.Phase == corev1.PodRunning && !podReady(p) {
+				status[watchedPod] = notReady
+			}
 		}
 	}
 	return status, nil
 }
 
+func podReady(p *corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
 func (s *statusController) NodeStatus() (map[string]corev1.NodeCondition, error) {
 	status := make(map[string]corev1.NodeCondition)
 
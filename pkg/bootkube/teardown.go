@@ -0,0 +1,231 @@
+package bootkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// TeardownCluster deletes the objects created from the manifests in assetDir, in the order
+// recorded by bootkube render. Deleting continues past failures, which are reported at the end.
+func TeardownCluster(config clientcmd.ClientConfig, assetDir string) error {
+	entries, err := loadUninstallList(assetDir)
+	if err != nil {
+		return err
+	}
+	c, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	creater, err := newCreater(c, false)
+	if err != nil {
+		return err
+	}
+
+	UserOutput("Deleting cluster assets...\n")
+	var failed int
+	for _, e := range entries {
+		err := creater.delete(manifest{kind: e.Kind, apiVersion: e.APIVersion, namespace: e.Namespace, name: e.Name})
+		switch {
+		case errors.IsNotFound(err):
+			UserOutput("Already deleted %s\n", e)
+		case err != nil:
+			failed++
+			UserError("failed to delete %s: %v\n", e, err)
+		default:
+			UserOutput("Deleted %s\n", e)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cluster assets could not be deleted", failed, len(entries))
+	}
+	return nil
+}
+
+// bootstrapEtcdMember is the name of the etcd member of a bootstrap etcd, as started by recover.
+const bootstrapEtcdMember = "boot-etcd"
+
+// teardownHealthTimeout bounds how long TeardownBootstrap waits for the self-hosted control plane
+// to be healthy after each removal step.
+var teardownHealthTimeout = 2 * time.Minute // Overridden for testing.
+
+// TeardownBootstrap removes what a bootstrap control plane left behind on the node: its static
+// pod manifests in podManifestPath, its secrets in BootstrapSecretsDir and, if etcd is set, the
+// bootstrap etcd member. The self-hosted control plane must be healthy before, and is checked to
+// still be healthy after each step, which stops the teardown otherwise.
+func TeardownBootstrap(config clientcmd.ClientConfig, assetDir, podManifestPath, podManifestPrefix string, etcd clientv3.Cluster) error {
+	if IsStaticControlPlane(assetDir) {
+		return fmt.Errorf("%s was rendered with a static control plane, which has no bootstrap control plane", assetDir)
+	}
+	c, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(c)
+	if err != nil {
+		return err
+	}
+	namespace := ControlPlaneNamespace(assetDir)
+	if err := clusterHealthy(context.Background(), client, namespace, true); err != nil {
+		return fmt.Errorf("refusing to tear down the bootstrap control plane: %v", err)
+	}
+
+	steps := []teardownStep{
+		{"the bootstrap static pod manifests", func() (bool, error) { return removeBootstrapManifests(assetDir, podManifestPath, podManifestPrefix) }},
+		{"the bootstrap secrets", func() (bool, error) { return removeBootstrapSecrets() }},
+	}
+	if etcd != nil {
+		steps = append(steps, teardownStep{"the bootstrap etcd member", func() (bool, error) { return removeBootstrapEtcdMember(etcd) }})
+	}
+	for _, step := range steps {
+		removed, err := step.remove()
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %v", step.name, err)
+		}
+		if !removed {
+			UserOutput("No %s left to remove\n", strings.TrimPrefix(step.name, "the "))
+			continue
+		}
+		UserOutput("Removed %s, checking the self-hosted control plane...\n", step.name)
+		if err := waitForClusterHealthy(client, namespace); err != nil {
+			return fmt.Errorf("the self-hosted control plane isn't healthy after removing %s: %v", step.name, err)
+		}
+	}
+	UserOutput("The bootstrap control plane is torn down and the self-hosted control plane is healthy\n")
+	return nil
+}
+
+// teardownStep removes a part of the bootstrap control plane, reporting whether there was any.
+type teardownStep struct {
+	name   string
+	remove func() (bool, error)
+}
+
+// removeBootstrapManifests removes the bootstrap manifests of assetDir, with the file name prefix,
+// from podManifestPath. Manifests that were edited since are left alone.
+func removeBootstrapManifests(assetDir, podManifestPath, prefix string) (bool, error) {
+	srcDir := filepath.Join(assetDir, asset.AssetPathBootstrapManifests)
+	infos, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return false, err
+	}
+	var removed bool
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		p := filepath.Join(podManifestPath, prefix+info.Name())
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		if !sameFile(filepath.Join(srcDir, info.Name()), p) {
+			UserWarning("Keeping %s, which differs from the bootstrap manifest %s\n", p, info.Name())
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return removed, err
+		}
+		UserOutput("Removed %s\n", p)
+		removed = true
+	}
+	return removed, nil
+}
+
+func removeBootstrapSecrets() (bool, error) {
+	if _, err := os.Stat(asset.BootstrapSecretsDir); os.IsNotExist(err) {
+		return false, nil
+	}
+	return true, os.RemoveAll(asset.BootstrapSecretsDir)
+}
+
+// removeBootstrapEtcdMember removes the bootstrap etcd member, unless it is the last member.
+func removeBootstrapEtcdMember(etcd clientv3.Cluster) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := etcd.MemberList(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range resp.Members {
+		if m.Name != bootstrapEtcdMember {
+			continue
+		}
+		if len(resp.Members) == 1 {
+			return false, fmt.Errorf("%s is the only etcd member", bootstrapEtcdMember)
+		}
+		if _, err := etcd.MemberRemove(ctx, m.ID); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// waitForClusterHealthy waits up to teardownHealthTimeout for the self-hosted control plane of
+// namespace to be healthy.
+func waitForClusterHealthy(client kubernetes.Interface, namespace string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), teardownHealthTimeout)
+	defer cancel()
+	var lastErr error
+	err := wait.PollImmediateUntil(pivotInterval, func() (bool, error) {
+		lastErr = clusterHealthy(ctx, client, namespace, true)
+		return lastErr == nil, nil
+	}, ctx.Done())
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// loadUninstallList reads the delete-ordered object list rendered into assetDir.
+func loadUninstallList(assetDir string) ([]asset.UninstallEntry, error) {
+	p := filepath.Join(assetDir, asset.AssetPathUninstall)
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s not found, the asset directory was rendered by an older bootkube", p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []asset.UninstallEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", p, err)
+	}
+	return entries, nil
+}
+
+func (c *creater) delete(m manifest) error {
+	info, err := c.mapper.resourceInfo(m.apiVersion, m.kind)
+	if err != nil {
+		return fmt.Errorf("discovery failed: %v", err)
+	}
+
+	// Delete the pods of workloads too.
+	propagation := metav1.DeletePropagationBackground
+	body, err := json.Marshal(metav1.DeleteOptions{
+		TypeMeta:          metav1.TypeMeta{APIVersion: "v1", Kind: "DeleteOptions"},
+		PropagationPolicy: &propagation,
+	})
+	if err != nil {
+		return err
+	}
+	return c.client.Delete().
+		AbsPath(m.urlPath(info.Name, info.Namespaced), m.name).
+		Body(body).
+		SetHeader("Content-Type", "application/json").
+		Do(context.TODO()).Error()
+}
@@ -0,0 +1,157 @@
+package bootkube
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/etcdserverpb"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+func TestLoadUninstallList(t *testing.T) {
+	assetDir, err := ioutil.TempDir("", "bootkube-teardown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(assetDir)
+
+	if _, err := loadUninstallList(assetDir); err == nil || !strings.Contains(err.Error(), "older bootkube") {
+		t.Errorf("expected error for missing uninstall list, got: %v", err)
+	}
+
+	list := `[
+  {"apiVersion": "apps/v1", "kind": "DaemonSet", "namespace": "kube-system", "name": "kube-proxy", "file": "manifests/kube-proxy.yaml"},
+  {"apiVersion": "v1", "kind": "ServiceAccount", "namespace": "kube-system", "name": "kube-proxy", "file": "manifests/kube-proxy-sa.yaml"}
+]`
+	if err := ioutil.WriteFile(filepath.Join(assetDir, asset.AssetPathUninstall), []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := loadUninstallList(assetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].String() != "DaemonSet kube-system/kube-proxy" || entries[1].Kind != "ServiceAccount" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
+
+// fakeEtcdCluster is the member API of an etcd cluster.
+type fakeEtcdCluster struct {
+	clientv3.Cluster
+	members []*etcdserverpb.Member
+}
+
+func (f *fakeEtcdCluster) MemberList(ctx context.Context) (*clientv3.MemberListResponse, error) {
+	return &clientv3.MemberListResponse{Members: f.members}, nil
+}
+
+func (f *fakeEtcdCluster) MemberRemove(ctx context.Context, id uint64) (*clientv3.MemberRemoveResponse, error) {
+	for i, m := range f.members {
+		if m.ID == id {
+			f.members = append(f.members[:i], f.members[i+1:]...)
+			return &clientv3.MemberRemoveResponse{}, nil
+		}
+	}
+	return nil, fmt.Errorf("no member %x", id)
+}
+
+func TestTeardownBootstrap(t *testing.T) {
+	defer func(interval, timeout time.Duration) { pivotInterval, teardownHealthTimeout = interval, timeout }(pivotInterval, teardownHealthTimeout)
+	pivotInterval, teardownHealthTimeout = 10*time.Millisecond, 100*time.Millisecond
+	tmp, err := ioutil.TempDir("", "bootkube-teardown-bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer func(dir string) { asset.BootstrapSecretsDir = dir }(asset.BootstrapSecretsDir)
+	asset.BootstrapSecretsDir = filepath.Join(tmp, "bootstrap-secrets")
+	assetDir := filepath.Join(tmp, "assets")
+	podManifestPath := filepath.Join(tmp, "manifests")
+	for path, data := range map[string]string{
+		filepath.Join(assetDir, asset.AssetPathBootstrapManifests, "bootstrap-apiserver.yaml"): "kind: Pod\n",
+		filepath.Join(assetDir, asset.AssetPathBootstrapManifests, "bootstrap-scheduler.yaml"): "kind: Pod\n",
+		filepath.Join(podManifestPath, "bootstrap-apiserver.yaml"):                             "kind: Pod\n",
+		filepath.Join(podManifestPath, "bootstrap-scheduler.yaml"):                             "kind: Pod\nedited: true\n",
+		filepath.Join(podManifestPath, "etcd.yaml"):                                            "kind: Pod\n",
+		filepath.Join(asset.BootstrapSecretsDir, "kubeconfig"):                                 "kubeconfig\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Once needsSecrets is set, the self-hosted control plane is only healthy while the bootstrap
+	// secrets exist.
+	var needsSecrets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			if _, err := os.Stat(asset.BootstrapSecretsDir); err != nil && atomic.LoadInt32(&needsSecrets) == 1 {
+				http.Error(w, "[-]etcd failed", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		case "/api/v1/namespaces/kube-system/pods":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"kind":"PodList","apiVersion":"v1","items":[{"status":{"phase":"Running","conditions":[{"type":"Ready","status":"True"}]}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	kubeConfig := clientcmd.NewDefaultClientConfig(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"c": {Server: srv.URL}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"u": {}},
+		Contexts:       map[string]*clientcmdapi.Context{"c": {Cluster: "c", AuthInfo: "u"}},
+		CurrentContext: "c",
+	}, &clientcmd.ConfigOverrides{})
+	etcd := &fakeEtcdCluster{members: []*etcdserverpb.Member{{ID: 1, Name: "boot-etcd"}, {ID: 2, Name: "etcd-0"}}}
+
+	if err := TeardownBootstrap(kubeConfig, assetDir, podManifestPath, "", etcd); err != nil {
+		t.Fatalf("TeardownBootstrap() = %v, want: nil", err)
+	}
+	for path, want := range map[string]bool{
+		filepath.Join(podManifestPath, "bootstrap-apiserver.yaml"): false,
+		filepath.Join(podManifestPath, "bootstrap-scheduler.yaml"): true, // edited
+		filepath.Join(podManifestPath, "etcd.yaml"):                true, // not a bootstrap manifest
+		asset.BootstrapSecretsDir:                                  false,
+	} {
+		if _, err := os.Stat(path); os.IsNotExist(err) == want {
+			t.Errorf("%s exists: %t, want: %t", path, !want, want)
+		}
+	}
+	if len(etcd.members) != 1 || etcd.members[0].Name != "etcd-0" {
+		t.Errorf("got etcd members %v, want: etcd-0", etcd.members)
+	}
+	// Tearing down again has nothing left to do.
+	if err := TeardownBootstrap(kubeConfig, assetDir, podManifestPath, "", etcd); err != nil {
+		t.Errorf("second TeardownBootstrap() = %v, want: nil", err)
+	}
+
+	atomic.StoreInt32(&needsSecrets, 1)
+	if err := TeardownBootstrap(kubeConfig, assetDir, podManifestPath, "", nil); err == nil || !strings.Contains(err.Error(), "refusing to tear down") {
+		t.Errorf("TeardownBootstrap() of an unhealthy cluster = %v, want a refusal", err)
+	}
+	if err := os.MkdirAll(asset.BootstrapSecretsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := TeardownBootstrap(kubeConfig, assetDir, podManifestPath, "", nil); err == nil || !strings.Contains(err.Error(), "isn't healthy after removing the bootstrap secrets") {
+		t.Errorf("TeardownBootstrap() breaking the cluster = %v, want an unhealthy error", err)
+	}
+}
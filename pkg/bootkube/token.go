@@ -0,0 +1,159 @@
+package bootkube
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+const bootstrapTokenSecretPrefix = "bootstrap-token-"
+
+var bootstrapTokenIDRegexp = regexp.MustCompile(`^[a-z0-9]{6}$`)
+
+// BootstrapToken is a bootstrap token kubelets authenticate with to join the cluster.
+type BootstrapToken struct {
+	ID string
+	// Secret is only known when the token is created.
+	Secret      string
+	Description string
+	// Expiration is zero for a token that doesn't expire.
+	Expiration time.Time
+	Usages     []string
+}
+
+// Token returns the bearer token, "<id>.<secret>".
+func (t BootstrapToken) Token() string {
+	return t.ID + "." + t.Secret
+}
+
+// CreateBootstrapToken creates a bootstrap token Secret in kube-system that can authenticate
+// joining kubelets and sign the cluster-info ConfigMap. A zero ttl creates a token that doesn't
+// expire.
+func CreateBootstrapToken(client kubernetes.Interface, ttl time.Duration, description string) (*BootstrapToken, error) {
+	id, secret, err := asset.NewBootstrapToken()
+	if err != nil {
+		return nil, err
+	}
+	t := &BootstrapToken{
+		ID:          id,
+		Secret:      secret,
+		Description: description,
+		Usages:      []string{"authentication", "signing"},
+	}
+	data := map[string]string{
+		"token-id":     id,
+		"token-secret": secret,
+	}
+	if description != "" {
+		data["description"] = description
+	}
+	if ttl > 0 {
+		t.Expiration = time.Now().Add(ttl).UTC().Truncate(time.Second)
+		data["expiration"] = t.Expiration.Format(time.RFC3339)
+	}
+	for _, usage := range t.Usages {
+		data["usage-bootstrap-"+usage] = "true"
+	}
+
+	_, err = client.CoreV1().Secrets(metav1.NamespaceSystem).Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: bootstrapTokenSecretPrefix + id, Namespace: metav1.NamespaceSystem},
+		Type:       corev1.SecretTypeBootstrapToken,
+		StringData: data,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bootstrap token: %v", err)
+	}
+	return t, nil
+}
+
+// ListBootstrapTokens returns the bootstrap tokens of the cluster, ordered by ID. Their secrets
+// are not returned.
+func ListBootstrapTokens(client kubernetes.Interface) ([]BootstrapToken, error) {
+	secrets, err := client.CoreV1().Secrets(metav1.NamespaceSystem).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "type=" + string(corev1.SecretTypeBootstrapToken),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var tokens []BootstrapToken
+	for _, s := range secrets.Items {
+		if s.Type != corev1.SecretTypeBootstrapToken {
+			continue
+		}
+		t, err := bootstrapTokenFromSecret(s)
+		if err != nil {
+			UserWarning("skipping bootstrap token Secret %s: %v\n", s.Name, err)
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+// DeleteBootstrapToken deletes the bootstrap token with the given ID, or "<id>.<secret>" token.
+func DeleteBootstrapToken(client kubernetes.Interface, id string) error {
+	id = strings.SplitN(id, ".", 2)[0]
+	if !bootstrapTokenIDRegexp.MatchString(id) {
+		return fmt.Errorf("invalid bootstrap token ID %q", id)
+	}
+	err := client.CoreV1().Secrets(metav1.NamespaceSystem).Delete(context.TODO(), bootstrapTokenSecretPrefix+id, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("bootstrap token %s not found", id)
+	}
+	return err
+}
+
+// ClusterCACertHash returns the hash of the cluster CA recorded in the cluster-info ConfigMap,
+// which joining nodes can pin the CA with.
+func ClusterCACertHash(client kubernetes.Interface) (string, error) {
+	cm, err := client.CoreV1().ConfigMaps(metav1.NamespacePublic).Get(context.TODO(), "cluster-info", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	hash, ok := cm.Annotations[asset.CACertHashAnnotation]
+	if !ok {
+		return "", fmt.Errorf("cluster-info has no %s annotation", asset.CACertHashAnnotation)
+	}
+	return hash, nil
+}
+
+func bootstrapTokenFromSecret(s corev1.Secret) (BootstrapToken, error) {
+	// Secrets read back from the apiserver have Data, objects of fake clients may only have
+	// StringData.
+	value := func(key string) string {
+		if v, ok := s.Data[key]; ok {
+			return string(v)
+		}
+		return s.StringData[key]
+	}
+	t := BootstrapToken{
+		ID:          value("token-id"),
+		Description: value("description"),
+	}
+	if !bootstrapTokenIDRegexp.MatchString(t.ID) {
+		return BootstrapToken{}, fmt.Errorf("invalid token-id %q", t.ID)
+	}
+	if exp := value("expiration"); exp != "" {
+		var err error
+		if t.Expiration, err = time.Parse(time.RFC3339, exp); err != nil {
+			return BootstrapToken{}, fmt.Errorf("invalid expiration: %v", err)
+		}
+	}
+	for _, usage := range []string{"authentication", "signing"} {
+		if value("usage-bootstrap-"+usage) == "true" {
+			t.Usages = append(t.Usages, usage)
+		}
+	}
+	return t, nil
+}
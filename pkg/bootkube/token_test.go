@@ -0,0 +1,76 @@
+package bootkube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBootstrapTokens(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: metav1.NamespaceSystem},
+		Type:       corev1.SecretTypeOpaque,
+	})
+
+	created, err := CreateBootstrapToken(client, time.Hour, "test")
+	if err != nil {
+		t.Fatalf("CreateBootstrapToken() = %v, want: nil", err)
+	}
+	if len(created.Token()) != 23 {
+		t.Errorf("got token %q, want: <6 chars>.<16 chars>", created.Token())
+	}
+	if until := time.Until(created.Expiration); until <= 0 || until > time.Hour {
+		t.Errorf("got expiration %s, want: within an hour", created.Expiration)
+	}
+	secret, err := client.CoreV1().Secrets(metav1.NamespaceSystem).Get(context.TODO(), "bootstrap-token-"+created.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.StringData["token-secret"] != created.Secret || secret.StringData["usage-bootstrap-authentication"] != "true" {
+		t.Errorf("got secret data %v", secret.StringData)
+	}
+
+	permanent, err := CreateBootstrapToken(client, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := ListBootstrapTokens(client)
+	if err != nil {
+		t.Fatalf("ListBootstrapTokens() = %v, want: nil", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("got %d tokens, want: 2", len(tokens))
+	}
+	for _, tok := range tokens {
+		if tok.Secret != "" {
+			t.Errorf("ListBootstrapTokens() returned the secret of token %s", tok.ID)
+		}
+		if !reflect.DeepEqual(tok.Usages, []string{"authentication", "signing"}) {
+			t.Errorf("got usages %v of token %s", tok.Usages, tok.ID)
+		}
+		if tok.ID == permanent.ID && !tok.Expiration.IsZero() {
+			t.Errorf("got expiration %s of a token that doesn't expire", tok.Expiration)
+		}
+		if tok.ID == created.ID && (!tok.Expiration.Equal(created.Expiration) || tok.Description != "test") {
+			t.Errorf("got token %+v, want: %+v", tok, created)
+		}
+	}
+
+	if err := DeleteBootstrapToken(client, created.Token()); err != nil {
+		t.Fatalf("DeleteBootstrapToken() = %v, want: nil", err)
+	}
+	if err := DeleteBootstrapToken(client, created.ID); err == nil {
+		t.Error("DeleteBootstrapToken() = nil for a deleted token")
+	}
+	if err := DeleteBootstrapToken(client, "../kube-apiserver"); err == nil {
+		t.Error("DeleteBootstrapToken() = nil for an invalid ID")
+	}
+	if tokens, err = ListBootstrapTokens(client); err != nil || len(tokens) != 1 || tokens[0].ID != permanent.ID {
+		t.Errorf("ListBootstrapTokens() = %v, %v, want: [%s]", tokens, err, permanent.ID)
+	}
+}
@@ -0,0 +1,749 @@
+package bootkube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// Severities of validation findings. Errors make the asset directory unusable, warnings point out
+// what could not be checked or is likely wrong.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Checks of bootkube validate.
+const (
+	CheckSchema     = "schema"
+	CheckReferences = "references"
+	CheckTLS        = "tls"
+	CheckAssetPaths = "asset-paths"
+	// CheckRecovery is only run on the assets of bootkube recover.
+	CheckRecovery = "recovery"
+)
+
+// etcdVerifyTimeout bounds resolving and connecting to each etcd server of recovered assets.
+const etcdVerifyTimeout = 5 * time.Second
+
+// Finding is a problem found in an asset directory.
+type Finding struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	// File is the path of the asset relative to the asset directory.
+	File string `json:"file,omitempty"`
+	// Object is the kind, namespace and name of the object the finding is about.
+	Object  string `json:"object,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	var where []string
+	for _, s := range []string{f.File, f.Object} {
+		if s != "" {
+			where = append(where, s)
+		}
+	}
+	if len(where) == 0 {
+		return fmt.Sprintf("%s: %s: %s", f.Severity, f.Check, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", f.Severity, f.Check, strings.Join(where, " "), f.Message)
+}
+
+// apiLifecycles are the Kubernetes minor versions group versions, or kinds of a group version, were
+// first served in and removed in. A zero version is unbounded.
+var apiLifecycles = map[string]struct{ introduced, removed uint }{
+	"extensions/v1beta1":                      {0, 16},
+	"extensions/v1beta1 Ingress":              {0, 22},
+	"apps/v1beta1":                            {0, 16},
+	"apps/v1beta2":                            {0, 16},
+	"rbac.authorization.k8s.io/v1alpha1":      {0, 22},
+	"rbac.authorization.k8s.io/v1beta1":       {0, 22},
+	"apiextensions.k8s.io/v1beta1":            {0, 22},
+	"apiextensions.k8s.io/v1":                 {16, 0},
+	"apiregistration.k8s.io/v1beta1":          {0, 22},
+	"admissionregistration.k8s.io/v1beta1":    {0, 22},
+	"admissionregistration.k8s.io/v1":         {16, 0},
+	"scheduling.k8s.io/v1beta1":               {0, 22},
+	"policy/v1beta1":                          {0, 25},
+	"policy/v1":                               {21, 0},
+	"batch/v1beta1":                           {0, 25},
+	"batch/v1 CronJob":                        {21, 0},
+	"networking.k8s.io/v1 Ingress":            {19, 0},
+	"networking.k8s.io/v1beta1":               {0, 22},
+	"discovery.k8s.io/v1":                     {21, 0},
+	"storage.k8s.io/v1beta1 CSIDriver":        {0, 22},
+	"storage.k8s.io/v1beta1 CSINode":          {0, 22},
+	"storage.k8s.io/v1beta1 StorageClass":     {0, 22},
+	"storage.k8s.io/v1beta1 VolumeAttachment": {0, 22},
+}
+
+// hostSecretsFiles returns the files bootkube start adds to the tls directory when copying it to
+// a host directory of the control plane, and whether hostPath is such a directory.
+func hostSecretsFiles(hostPath string) ([]string, bool) {
+	switch path.Clean(hostPath) {
+	case path.Join("/etc/kubernetes", path.Base(asset.BootstrapSecretsDir)):
+		return []string{"kubeconfig"}, true
+	case asset.StaticSecretsDir:
+		return nil, true
+	}
+	return nil, false
+}
+
+// ValidateAssets checks the manifests, TLS assets and kubeconfigs of an asset directory:
+//
+//   - manifests decode as the objects of their kind and their API versions are served by
+//     kubernetesVersion, e.g. v1.17.4. It defaults to the version of the rendered apiserver image.
+//   - Secrets, ConfigMaps and ServiceAccounts used by pods are rendered, with the keys they use.
+//   - the apiserver and etcd certificates are valid for the endpoints kubeconfigs and the
+//     apiserver use.
+//   - files referenced by the command of a container exist in the volume mounted at their path.
+func ValidateAssets(assetDir, kubernetesVersion string) ([]Finding, error) {
+	v, err := validate(assetDir, kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	return v.findings, nil
+}
+
+// ValidateRecoveredAssets checks the assets bootkube recover wrote to recoveryDir like
+// ValidateAssets, and that the bootstrap control plane can boot from them:
+//
+//   - the host directories of the bootstrap secrets the bootstrap pods mount, and the files their
+//     commands use in them, were recovered.
+//   - the etcd servers of the bootstrap pods resolve, serve a certificate the recovered etcd CA
+//     verifies, and the recovered etcd client certificate has not expired.
+func ValidateRecoveredAssets(recoveryDir, kubernetesVersion string) ([]Finding, error) {
+	v, err := validate(recoveryDir, kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	v.checkRecovered()
+	return v.findings, nil
+}
+
+// validate runs the checks of ValidateAssets.
+func validate(assetDir, kubernetesVersion string) (*validator, error) {
+	v := &validator{assetDir: assetDir}
+	for _, dir := range []string{asset.AssetPathManifests, asset.AssetPathBootstrapManifests, asset.AssetPathStaticManifests} {
+		if _, err := os.Stat(filepath.Join(assetDir, dir)); os.IsNotExist(err) {
+			continue
+		}
+		ms, err := loadManifests(filepath.Join(assetDir, dir))
+		if err != nil {
+			return nil, fmt.Errorf("loading manifests: %v", err)
+		}
+		for _, m := range ms {
+			if string(m.raw) == "null" {
+				continue
+			}
+			m.filepath, _ = filepath.Rel(assetDir, m.filepath)
+			v.manifests = append(v.manifests, m)
+		}
+	}
+	if len(v.manifests) == 0 {
+		return nil, fmt.Errorf("no manifests found in %s, is it an asset directory?", assetDir)
+	}
+	sort.SliceStable(v.manifests, func(i, j int) bool {
+		return v.manifests[i].filepath < v.manifests[j].filepath
+	})
+
+	target, err := v.targetVersion(kubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+	v.checkSchemas(target)
+	v.checkReferences()
+	v.checkTLS()
+	return v, nil
+}
+
+type validator struct {
+	assetDir  string
+	manifests []manifest
+	// objects are the decoded manifests, by index in manifests. Manifests of unknown kinds are
+	// missing.
+	objects  map[int]runtime.Object
+	findings []Finding
+}
+
+func (v *validator) add(severity, check string, m *manifest, format string, a ...interface{}) {
+	f := Finding{Severity: severity, Check: check, Message: fmt.Sprintf(format, a...)}
+	if m != nil {
+		f.File = m.filepath
+		f.Object = objectName(*m)
+	}
+	v.findings = append(v.findings, f)
+}
+
+func objectName(m manifest) string {
+	if m.namespace == "" {
+		return m.kind + " " + m.name
+	}
+	return m.kind + " " + m.namespace + "/" + m.name
+}
+
+var imageVersionTag = regexp.MustCompile(`/(?:hyperkube|kube-apiserver)(?:-[a-z0-9]+)?:(v[0-9][^@\s]*)`)
+
+// targetVersion parses the Kubernetes version to validate for, defaulting to the tag of the
+// apiserver image of the bootstrap or static control plane. It returns nil if it is unknown.
+func (v *validator) targetVersion(kubernetesVersion string) (*version.Version, error) {
+	if kubernetesVersion != "" {
+		target, err := version.ParseGeneric(kubernetesVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kubernetes version %q: %v", kubernetesVersion, err)
+		}
+		return target, nil
+	}
+	for _, m := range v.manifests {
+		if m.kind != "Pod" || !strings.Contains(m.name, "kube-apiserver") {
+			continue
+		}
+		if match := imageVersionTag.FindSubmatch(m.raw); match != nil {
+			if target, err := version.ParseGeneric(string(match[1])); err == nil {
+				return target, nil
+			}
+		}
+	}
+	v.add(SeverityWarning, CheckSchema, nil, "unknown Kubernetes version, pass --kubernetes-version to check the API versions of manifests")
+	return nil, nil
+}
+
+func (v *validator) checkSchemas(target *version.Version) {
+	v.objects = map[int]runtime.Object{}
+	crds := map[string]bool{}
+	for _, m := range v.manifests {
+		if m.kind == "CustomResourceDefinition" {
+			var crd struct {
+				Spec struct {
+					Group string `json:"group"`
+					Names struct {
+						Kind string `json:"kind"`
+					} `json:"names"`
+				} `json:"spec"`
+			}
+			if err := json.Unmarshal(m.raw, &crd); err == nil {
+				crds[crd.Spec.Group+" "+crd.Spec.Names.Kind] = true
+			}
+		}
+	}
+
+	for i := range v.manifests {
+		m := &v.manifests[i]
+		if m.apiVersion == "" || m.kind == "" || m.name == "" {
+			v.add(SeverityError, CheckSchema, m, "apiVersion, kind and metadata.name are required")
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(m.apiVersion)
+		if err != nil {
+			v.add(SeverityError, CheckSchema, m, "invalid apiVersion: %v", err)
+			continue
+		}
+		if target != nil {
+			v.checkAPIVersion(m, target)
+		}
+
+		obj, err := scheme.Scheme.New(gv.WithKind(m.kind))
+		if err != nil {
+			if !crds[gv.Group+" "+m.kind] {
+				v.add(SeverityWarning, CheckSchema, m, "unknown kind, the manifest is not validated")
+			}
+			continue
+		}
+		d := json.NewDecoder(bytes.NewReader(m.raw))
+		d.DisallowUnknownFields()
+		if err := d.Decode(obj); err != nil {
+			v.add(SeverityError, CheckSchema, m, "invalid %s: %v", m.kind, err)
+			continue
+		}
+		v.objects[i] = obj
+	}
+}
+
+func (v *validator) checkAPIVersion(m *manifest, target *version.Version) {
+	for _, key := range []string{m.apiVersion + " " + m.kind, m.apiVersion} {
+		l, ok := apiLifecycles[key]
+		if !ok {
+			continue
+		}
+		if l.introduced != 0 && target.Minor() < l.introduced {
+			v.add(SeverityError, CheckSchema, m, "%s %s is not served before Kubernetes v1.%d, the target version is v%s", m.apiVersion, m.kind, l.introduced, target)
+		}
+		if l.removed != 0 && target.Minor() >= l.removed {
+			v.add(SeverityError, CheckSchema, m, "%s %s is not served since Kubernetes v1.%d, the target version is v%s", m.apiVersion, m.kind, l.removed, target)
+		}
+		return
+	}
+}
+
+// podSpec returns the pod spec of a pod or of the pod template of a workload.
+func podSpec(obj runtime.Object) *corev1.PodSpec {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return &o.Spec
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template.Spec
+	case *appsv1.Deployment:
+		return &o.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template.Spec
+	case *appsv1.ReplicaSet:
+		return &o.Spec.Template.Spec
+	case *batchv1.Job:
+		return &o.Spec.Template.Spec
+	case *batchv1beta1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.Spec
+	}
+	return nil
+}
+
+func (v *validator) checkReferences() {
+	// Keys of the rendered Secrets and ConfigMaps and the rendered ServiceAccounts, by
+	// "namespace/name".
+	secrets, configMaps, serviceAccounts := map[string]map[string]bool{}, map[string]map[string]bool{}, map[string]bool{}
+	for _, obj := range v.objects {
+		switch o := obj.(type) {
+		case *corev1.Secret:
+			keys := map[string]bool{}
+			for k := range o.Data {
+				keys[k] = true
+			}
+			for k := range o.StringData {
+				keys[k] = true
+			}
+			secrets[o.Namespace+"/"+o.Name] = keys
+		case *corev1.ConfigMap:
+			keys := map[string]bool{}
+			for k := range o.Data {
+				keys[k] = true
+			}
+			for k := range o.BinaryData {
+				keys[k] = true
+			}
+			configMaps[o.Namespace+"/"+o.Name] = keys
+		case *corev1.ServiceAccount:
+			serviceAccounts[o.Namespace+"/"+o.Name] = true
+		}
+	}
+	tlsFiles, err := ioutil.ReadDir(filepath.Join(v.assetDir, asset.AssetPathSecrets))
+	if err != nil {
+		v.add(SeverityError, CheckAssetPaths, nil, "%v", err)
+	}
+
+	for i := range v.manifests {
+		m := &v.manifests[i]
+		spec := podSpec(v.objects[i])
+		if spec == nil {
+			continue
+		}
+		namespace := m.namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		// Static pods can't use the API objects of the cluster.
+		static := m.kind == "Pod"
+
+		// checkKeys reports a missing object, or missing keys of it, unless optional.
+		checkKeys := func(kind string, objects map[string]map[string]bool, name string, keys []string, optional *bool) map[string]bool {
+			if optional != nil && *optional {
+				return nil
+			}
+			if static {
+				v.add(SeverityError, CheckReferences, m, "static pods can't use %s %s", kind, name)
+				return nil
+			}
+			data, ok := objects[namespace+"/"+name]
+			if !ok {
+				v.add(SeverityError, CheckReferences, m, "uses %s %s/%s, which is not in the asset directory", kind, namespace, name)
+				return nil
+			}
+			for _, k := range keys {
+				if !data[k] {
+					v.add(SeverityError, CheckReferences, m, "uses key %s of %s %s/%s, which it doesn't have", k, kind, namespace, name)
+				}
+			}
+			return data
+		}
+
+		if sa := spec.ServiceAccountName; sa != "" && sa != "default" && !static && !serviceAccounts[namespace+"/"+sa] {
+			v.add(SeverityError, CheckReferences, m, "runs as ServiceAccount %s/%s, which is not in the asset directory", namespace, sa)
+		}
+
+		// Files of each volume, nil if unknown.
+		volumeFiles := map[string]map[string]bool{}
+		for _, vol := range spec.Volumes {
+			switch {
+			case vol.Secret != nil:
+				data := checkKeys("Secret", secrets, vol.Secret.SecretName, itemKeys(vol.Secret.Items), vol.Secret.Optional)
+				volumeFiles[vol.Name] = itemFiles(vol.Secret.Items, data)
+			case vol.ConfigMap != nil:
+				data := checkKeys("ConfigMap", configMaps, vol.ConfigMap.Name, itemKeys(vol.ConfigMap.Items), vol.ConfigMap.Optional)
+				volumeFiles[vol.Name] = itemFiles(vol.ConfigMap.Items, data)
+			case vol.Projected != nil:
+				for _, src := range vol.Projected.Sources {
+					if src.Secret != nil {
+						checkKeys("Secret", secrets, src.Secret.Name, itemKeys(src.Secret.Items), src.Secret.Optional)
+					}
+					if src.ConfigMap != nil {
+						checkKeys("ConfigMap", configMaps, src.ConfigMap.Name, itemKeys(src.ConfigMap.Items), src.ConfigMap.Optional)
+					}
+				}
+			case vol.HostPath != nil && static:
+				extra, ok := hostSecretsFiles(vol.HostPath.Path)
+				if !ok {
+					continue
+				}
+				files := map[string]bool{}
+				for _, f := range tlsFiles {
+					files[f.Name()] = true
+				}
+				for _, f := range extra {
+					files[f] = true
+				}
+				volumeFiles[vol.Name] = files
+			}
+		}
+
+		for _, c := range append(spec.InitContainers, spec.Containers...) {
+			for _, env := range c.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+				if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+					checkKeys("Secret", secrets, ref.Name, []string{ref.Key}, ref.Optional)
+				}
+				if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+					checkKeys("ConfigMap", configMaps, ref.Name, []string{ref.Key}, ref.Optional)
+				}
+			}
+			for _, src := range c.EnvFrom {
+				if src.SecretRef != nil {
+					checkKeys("Secret", secrets, src.SecretRef.Name, nil, src.SecretRef.Optional)
+				}
+				if src.ConfigMapRef != nil {
+					checkKeys("ConfigMap", configMaps, src.ConfigMapRef.Name, nil, src.ConfigMapRef.Optional)
+				}
+			}
+			v.checkCommandPaths(m, c, volumeFiles)
+		}
+	}
+}
+
+func itemKeys(items []corev1.KeyToPath) []string {
+	var keys []string
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+// itemFiles returns the files of a Secret or ConfigMap volume with the keys data.
+func itemFiles(items []corev1.KeyToPath, data map[string]bool) map[string]bool {
+	if data == nil || len(items) == 0 {
+		return data
+	}
+	files := map[string]bool{}
+	for _, item := range items {
+		files[item.Path] = true
+	}
+	return files
+}
+
+var commandPath = regexp.MustCompile(`/[^\s,=:"']+`)
+
+// checkCommandPaths checks that the files the command of a container references in a mounted
+// Secret, ConfigMap or host secrets directory exist.
+func (v *validator) checkCommandPaths(m *manifest, c corev1.Container, volumeFiles map[string]map[string]bool) {
+	for _, mount := range c.VolumeMounts {
+		files := volumeFiles[mount.Name]
+		if files == nil || mount.SubPath != "" {
+			continue
+		}
+		dir := path.Clean(mount.MountPath) + "/"
+		for _, arg := range append(c.Command, c.Args...) {
+			for _, p := range commandPath.FindAllString(arg, -1) {
+				if !strings.HasPrefix(p, dir) {
+					continue
+				}
+				if f := strings.TrimPrefix(p, dir); !files[f] {
+					v.add(SeverityError, CheckAssetPaths, m, "container %s uses %s, which is not in volume %s", c.Name, p, mount.Name)
+				}
+			}
+		}
+	}
+}
+
+// kubeconfigPaths are the kubeconfigs of an asset directory relative to it, besides the
+// component kubeconfigs in the tls directory.
+var kubeconfigPaths = []string{
+	asset.AssetPathAdminKubeConfig,
+	asset.AssetPathBootstrapKubeConfig,
+	asset.AssetPathKubeletKubeConfig,
+	asset.AssetPathKubeletBundleKubeConfig,
+}
+
+func (v *validator) checkTLS() {
+	apiServerCert, err := v.readCert(asset.AssetPathAPIServerCert)
+	if err != nil {
+		v.add(SeverityError, CheckTLS, nil, "%v", err)
+		return
+	}
+	v.checkExpiry(asset.AssetPathAPIServerCert, apiServerCert)
+
+	paths := append([]string{}, kubeconfigPaths...)
+	if matches, err := filepath.Glob(filepath.Join(v.assetDir, asset.AssetPathSecrets, "*.kubeconfig")); err == nil {
+		for _, p := range matches {
+			rel, _ := filepath.Rel(v.assetDir, p)
+			paths = append(paths, rel)
+		}
+	}
+	for _, p := range paths {
+		config, err := clientcmd.LoadFromFile(filepath.Join(v.assetDir, p))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			v.findings = append(v.findings, Finding{Severity: SeverityError, Check: CheckTLS, File: p, Message: err.Error()})
+			continue
+		}
+		for name, cluster := range config.Clusters {
+			u, err := url.Parse(cluster.Server)
+			if err != nil {
+				v.findings = append(v.findings, Finding{Severity: SeverityError, Check: CheckTLS, File: p, Message: fmt.Sprintf("cluster %s: invalid server: %v", name, err)})
+				continue
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(cluster.CertificateAuthorityData) {
+				v.findings = append(v.findings, Finding{Severity: SeverityWarning, Check: CheckTLS, File: p, Message: fmt.Sprintf("cluster %s has no certificate-authority-data, the apiserver certificate is not verified", name)})
+				continue
+			}
+			if _, err := apiServerCert.Verify(x509.VerifyOptions{DNSName: u.Hostname(), Roots: roots}); err != nil {
+				v.findings = append(v.findings, Finding{Severity: SeverityError, Check: CheckTLS, File: p, Message: fmt.Sprintf("cluster %s: %s is not valid for %s: %v", name, asset.AssetPathAPIServerCert, u.Hostname(), err)})
+			}
+		}
+	}
+
+	// The etcd server certificate is only used when bootkube renders it for TLS-enabled etcd.
+	etcdServerCert, err := v.readCert(asset.AssetPathEtcdServerCert)
+	if err != nil {
+		return
+	}
+	v.checkExpiry(asset.AssetPathEtcdServerCert, etcdServerCert)
+	for i := range v.manifests {
+		m := &v.manifests[i]
+		spec := podSpec(v.objects[i])
+		if spec == nil {
+			continue
+		}
+		for _, c := range spec.Containers {
+			for _, arg := range append(c.Command, c.Args...) {
+				if !strings.HasPrefix(arg, "--etcd-servers=") {
+					continue
+				}
+				for _, s := range strings.Split(strings.TrimPrefix(arg, "--etcd-servers="), ",") {
+					u, err := url.Parse(s)
+					if err != nil || u.Scheme != "https" {
+						continue
+					}
+					if err := etcdServerCert.VerifyHostname(u.Hostname()); err != nil {
+						v.add(SeverityError, CheckTLS, m, "%s is not valid for etcd server %s: %v", asset.AssetPathEtcdServerCert, s, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) readCert(p string) (*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(filepath.Join(v.assetDir, p))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: failed to decode certificate", p)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func (v *validator) checkExpiry(p string, cert *x509.Certificate) {
+	if time.Now().After(cert.NotAfter) {
+		v.findings = append(v.findings, Finding{Severity: SeverityError, Check: CheckTLS, File: p, Message: fmt.Sprintf("expired at %s", cert.NotAfter.Format(time.RFC3339))})
+	}
+}
+
+// checkRecovered checks that the bootstrap pods of recovered assets can run.
+func (v *validator) checkRecovered() {
+	for i := range v.manifests {
+		m := &v.manifests[i]
+		spec := podSpec(v.objects[i])
+		if m.kind != "Pod" || spec == nil || !strings.HasPrefix(m.filepath, asset.AssetPathBootstrapManifests+"/") {
+			continue
+		}
+		for _, vol := range spec.Volumes {
+			if vol.HostPath == nil {
+				continue
+			}
+			// The directory of the bootstrap secrets itself is checked by checkReferences.
+			if rel, ok := bootstrapSecretsPath(vol.HostPath.Path); ok && rel != "" {
+				if _, err := os.Stat(filepath.Join(v.assetDir, asset.AssetPathSecrets, rel)); err != nil {
+					v.add(SeverityError, CheckRecovery, m, "mounts %s, which is not recovered to %s", vol.HostPath.Path, path.Join(asset.AssetPathSecrets, rel))
+				}
+			}
+		}
+		for _, c := range append(spec.InitContainers, spec.Containers...) {
+			for _, arg := range append(c.Command, c.Args...) {
+				for _, p := range commandPath.FindAllString(arg, -1) {
+					if f, nested := v.recoveredFile(*spec, c, p); nested {
+						if _, err := os.Stat(f); err != nil {
+							v.add(SeverityError, CheckRecovery, m, "container %s uses %s, which is not recovered", c.Name, p)
+						}
+					}
+				}
+			}
+			v.checkRecoveredEtcd(m, *spec, c)
+		}
+	}
+}
+
+// bootstrapSecretsPath returns the path of hostPath relative to the host directory of the
+// bootstrap secrets, and whether it is below it.
+func bootstrapSecretsPath(hostPath string) (string, bool) {
+	dir, p := path.Join("/etc/kubernetes", path.Base(asset.BootstrapSecretsDir)), path.Clean(hostPath)
+	if p == dir {
+		return "", true
+	}
+	if !strings.HasPrefix(p, dir+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(p, dir+"/"), true
+}
+
+// recoveredFile returns the file of the asset directory the container reads at p from the
+// bootstrap secrets, or "" if it reads it from elsewhere. nested is whether p is in a volume of a
+// directory below the bootstrap secrets.
+func (v *validator) recoveredFile(spec corev1.PodSpec, c corev1.Container, p string) (file string, nested bool) {
+	var mount *corev1.VolumeMount
+	for i, m := range c.VolumeMounts {
+		dir := path.Clean(m.MountPath)
+		if m.SubPath == "" && strings.HasPrefix(p, dir+"/") && (mount == nil || len(dir) > len(path.Clean(mount.MountPath))) {
+			mount = &c.VolumeMounts[i]
+		}
+	}
+	if mount == nil {
+		return "", false
+	}
+	for _, vol := range spec.Volumes {
+		if vol.Name != mount.Name || vol.HostPath == nil {
+			continue
+		}
+		rel, ok := bootstrapSecretsPath(vol.HostPath.Path)
+		if !ok {
+			return "", false
+		}
+		f := strings.TrimPrefix(p, path.Clean(mount.MountPath)+"/")
+		return filepath.Join(v.assetDir, asset.AssetPathSecrets, filepath.FromSlash(path.Join(rel, f))), rel != ""
+	}
+	return "", false
+}
+
+// checkRecoveredEtcd checks the etcd servers of the container against the recovered etcd client
+// TLS files. Servers that are not reachable, e.g. a seed member that is not running yet, are only
+// warned about.
+func (v *validator) checkRecoveredEtcd(m *manifest, spec corev1.PodSpec, c corev1.Container) {
+	flags := map[string]string{}
+	for _, arg := range append(c.Command, c.Args...) {
+		if kv := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2); strings.HasPrefix(arg, "--etcd-") && len(kv) == 2 {
+			flags[kv[0]] = kv[1]
+		}
+	}
+	if flags["etcd-servers"] == "" {
+		return
+	}
+
+	tlsConfig := &tls.Config{}
+	if f, _ := v.recoveredFile(spec, c, flags["etcd-cafile"]); f != "" {
+		if data, err := ioutil.ReadFile(f); err == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+				v.add(SeverityError, CheckRecovery, m, "invalid etcd CA %s", flags["etcd-cafile"])
+			}
+		}
+	}
+	certFile, _ := v.recoveredFile(spec, c, flags["etcd-certfile"])
+	keyFile, _ := v.recoveredFile(spec, c, flags["etcd-keyfile"])
+	if certFile != "" && keyFile != "" {
+		if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			v.add(SeverityError, CheckRecovery, m, "invalid etcd client certificate: %v", err)
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{cert}
+			if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Now().After(leaf.NotAfter) {
+				v.add(SeverityError, CheckRecovery, m, "etcd client certificate %s expired at %s", flags["etcd-certfile"], leaf.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+
+	for _, s := range strings.Split(flags["etcd-servers"], ",") {
+		u, err := url.Parse(s)
+		if err != nil || u.Hostname() == "" {
+			v.add(SeverityError, CheckRecovery, m, "invalid etcd server %q", s)
+			continue
+		}
+		if net.ParseIP(u.Hostname()) == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), etcdVerifyTimeout)
+			_, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+			cancel()
+			if err != nil {
+				v.add(SeverityError, CheckRecovery, m, "etcd server %s does not resolve: %v", s, err)
+				continue
+			}
+		}
+		if u.Scheme != "https" {
+			continue
+		}
+		cfg := tlsConfig.Clone()
+		cfg.ServerName = u.Hostname()
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: etcdVerifyTimeout}, "tcp", u.Host, cfg)
+		if err != nil {
+			var (
+				unknownAuthority x509.UnknownAuthorityError
+				hostname         x509.HostnameError
+				invalid          x509.CertificateInvalidError
+			)
+			if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+				v.add(SeverityError, CheckRecovery, m, "etcd server %s has an invalid certificate: %v", s, err)
+			} else {
+				v.add(SeverityWarning, CheckRecovery, m, "etcd server %s is not reachable, its certificate is not checked: %v", s, err)
+			}
+			continue
+		}
+		conn.Close()
+	}
+}
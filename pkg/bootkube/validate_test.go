@@ -0,0 +1,229 @@
+package bootkube
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+func TestValidateAssets(t *testing.T) {
+	assetDir, err := ioutil.TempDir("", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(assetDir)
+
+	_, podCIDR, _ := net.ParseCIDR("10.2.0.0/16")
+	_, serviceCIDR, _ := net.ParseCIDR("10.3.0.0/24")
+	apiServer, _ := url.Parse("https://127.0.0.1:6443")
+	etcdServer, _ := url.Parse("http://127.0.0.1:2379")
+	as, err := asset.NewDefaultAssets(asset.Config{
+		APIServers:      []*url.URL{apiServer},
+		EtcdServers:     []*url.URL{etcdServer},
+		PodCIDRs:        []*net.IPNet{podCIDR},
+		ServiceCIDRs:    []*net.IPNet{serviceCIDR},
+		APIServiceIPs:   []net.IP{net.ParseIP("10.3.0.1")},
+		DNSServiceIPs:   []net.IP{net.ParseIP("10.3.0.10")},
+		NetworkProvider: asset.NetworkFlannel,
+		Images:          asset.DefaultImages,
+		AltNames:        &tlsutil.AltNames{IPs: []net.IP{net.ParseIP("127.0.0.1")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := as.WriteFiles(assetDir); err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := ValidateAssets(assetDir, "")
+	if err != nil {
+		t.Fatalf("ValidateAssets() = %v, want: nil", err)
+	}
+	if len(findings) > 0 {
+		t.Fatalf("rendered assets have findings: %v", findings)
+	}
+
+	// Break a reference, an asset path and an API version.
+	if err := os.Remove(filepath.Join(assetDir, asset.AssetPathCoreDNSConfig)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(assetDir, asset.AssetPathServiceAccountPubKey), filepath.Join(assetDir, asset.AssetPathSecrets, "sa.pub")); err != nil {
+		t.Fatal(err)
+	}
+	findings, err = ValidateAssets(assetDir, "v1.25.0")
+	if err != nil {
+		t.Fatalf("ValidateAssets() = %v, want: nil", err)
+	}
+	for _, want := range []struct{ check, message string }{
+		{CheckReferences, "uses ConfigMap kube-system/coredns, which is not in the asset directory"},
+		{CheckAssetPaths, "service-account.pub, which is not in volume"},
+		{CheckSchema, "policy/v1beta1 PodDisruptionBudget is not served since Kubernetes v1.25"},
+	} {
+		var found bool
+		for _, f := range findings {
+			if f.Severity == SeverityError && f.Check == want.check && strings.Contains(f.Message, want.message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no %s finding %q in %v", want.check, want.message, findings)
+		}
+	}
+}
+
+func TestValidateRecoveredAssets(t *testing.T) {
+	recoveryDir, err := ioutil.TempDir("", "recovered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(recoveryDir)
+	defer func(dir string) { asset.BootstrapSecretsDir = dir }(asset.BootstrapSecretsDir)
+	asset.BootstrapSecretsDir = "/etc/kubernetes/bootstrap-secrets"
+
+	// An etcd server with a certificate of the recovered etcd CA, and one of another CA.
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	newEtcdServer := func(caCert *x509.Certificate, caKey *rsa.PrivateKey) string {
+		key, err := tlsutil.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := tlsutil.NewSignedCertificate(tlsutil.CertConfig{CommonName: "etcd", AltNames: tlsutil.AltNames{IPs: []net.IP{net.ParseIP("127.0.0.1")}}}, key, caCert, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+		listeners = append(listeners, l)
+		return "https://" + l.Addr().String()
+	}
+	newCA := func() (*x509.Certificate, *rsa.PrivateKey) {
+		key, err := tlsutil.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := tlsutil.NewSelfSignedCACertificate(tlsutil.CertConfig{CommonName: "etcd-ca"}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+	caCert, caKey := newCA()
+	otherCACert, otherCAKey := newCA()
+	goodServer, badServer := newEtcdServer(caCert, caKey), newEtcdServer(otherCACert, otherCAKey)
+
+	clientKey, err := tlsutil.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := tlsutil.NewSignedCertificate(tlsutil.CertConfig{CommonName: "etcd-client", ClientOnly: true}, clientKey, caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"tls/etcd-client-ca.crt":                    tlsutil.EncodeCertificatePEM(caCert),
+		"tls/etcd-client.crt":                       tlsutil.EncodeCertificatePEM(clientCert),
+		"tls/etcd-client.key":                       tlsutil.EncodePrivateKeyPEM(clientKey),
+		"tls/secrets/control-plane/webhook/tls.crt": []byte("cert"),
+		asset.AssetPathBootstrapAPIServer: []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: bootstrap-kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - name: kube-apiserver
+    image: k8s.gcr.io/kube-apiserver:v1.18.2
+    command:
+    - kube-apiserver
+    - --etcd-cafile=/etc/kubernetes/secrets/etcd-client-ca.crt
+    - --etcd-certfile=/etc/kubernetes/secrets/etcd-client.crt
+    - --etcd-keyfile=/etc/kubernetes/secrets/etcd-client.key
+    - --etcd-servers=` + goodServer + `,` + badServer + `,https://etcd.invalid:2379
+    - --webhook-cert=/etc/webhook/tls.crt
+    - --webhook-key=/etc/webhook/tls.key
+    volumeMounts:
+    - mountPath: /etc/kubernetes/secrets
+      name: secrets
+    - mountPath: /etc/webhook
+      name: webhook
+    - mountPath: /etc/oidc
+      name: oidc
+  volumes:
+  - name: secrets
+    hostPath:
+      path: /etc/kubernetes/bootstrap-secrets
+  - name: webhook
+    hostPath:
+      path: /etc/kubernetes/bootstrap-secrets/secrets/control-plane/webhook
+  - name: oidc
+    hostPath:
+      path: /etc/kubernetes/bootstrap-secrets/secrets/control-plane/oidc
+`),
+	}
+	for name, data := range files {
+		p := filepath.Join(recoveryDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	findings, err := ValidateRecoveredAssets(recoveryDir, "")
+	if err != nil {
+		t.Fatalf("ValidateRecoveredAssets() = %v, want: nil", err)
+	}
+	var recovery []Finding
+	for _, f := range findings {
+		if f.Check == CheckRecovery {
+			recovery = append(recovery, f)
+		}
+	}
+	for _, want := range []string{
+		"mounts /etc/kubernetes/bootstrap-secrets/secrets/control-plane/oidc, which is not recovered",
+		"container kube-apiserver uses /etc/webhook/tls.key, which is not recovered",
+		"etcd server " + badServer + " has an invalid certificate",
+		"etcd server https://etcd.invalid:2379 does not resolve",
+	} {
+		var found bool
+		for _, f := range recovery {
+			if f.Severity == SeverityError && strings.Contains(f.Message, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no recovery finding %q in %v", want, recovery)
+		}
+	}
+	if len(recovery) != 4 {
+		t.Errorf("got recovery findings %v, want 4", recovery)
+	}
+}
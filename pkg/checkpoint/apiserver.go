@@ -10,16 +10,28 @@ import (
 )
 
 // getAPIParentPods will retrieve all pods from apiserver that are parents & should be checkpointed
-// Returns false if we could not contact the apiserver.
+// in the checkpoint namespaces. Returns false if we could not contact the apiserver.
 func (c *checkpointer) getAPIParentPods(nodeName string) (bool, map[string]*v1.Pod) {
 	opts := metav1.ListOptions{
 		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
 	}
 
-	podList, err := c.apiserver.CoreV1().Pods(c.checkpointerPod.PodNamespace).List(context.TODO(), opts)
-	if err != nil {
-		glog.Warningf("Unable to contact APIServer, skipping garbage collection: %v", err)
-		return false, nil
+	namespaces := checkpointNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{c.checkpointerPod.PodNamespace}
 	}
-	return true, podListToParentPods(podList)
+	parents := make(map[string]*v1.Pod)
+	for _, ns := range namespaces {
+		podList, err := c.apiserver.CoreV1().Pods(ns).List(context.TODO(), opts)
+		if err != nil {
+			glog.Warningf("Unable to contact APIServer, skipping garbage collection: %v", err)
+			health.recordSync("apiserver", err)
+			return false, nil
+		}
+		for id, pod := range podListToParentPods(podList) {
+			parents[id] = pod
+		}
+	}
+	health.recordSync("apiserver", nil)
+	return true, parents
 }
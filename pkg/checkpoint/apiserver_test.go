@@ -0,0 +1,68 @@
+package checkpoint
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetAPIParentPods(t *testing.T) {
+	checkpointSelector = labels.SelectorFromSet(labels.Set{"tier": "control-plane"})
+	checkpointNamespaces = []string{"kube-system", "monitoring"}
+	defer func() { checkpointSelector, checkpointNamespaces = nil, nil }()
+
+	pod := func(namespace, name string, l, a map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: l, Annotations: a},
+			Spec:       v1.PodSpec{NodeName: "mynode"},
+		}
+	}
+	controlPlane := map[string]string{"tier": "control-plane"}
+	c := &checkpointer{
+		apiserver: fake.NewSimpleClientset(
+			pod("kube-system", "kube-apiserver", nil, map[string]string{shouldCheckpointAnnotation: "true"}),
+			pod("kube-system", "kube-scheduler", controlPlane, nil),
+			pod("kube-system", "kube-proxy", nil, nil),
+			pod("monitoring", "prometheus", controlPlane, nil),
+			pod("default", "nginx", controlPlane, nil),
+		),
+		checkpointerPod: CheckpointerPod{NodeName: "mynode", PodNamespace: "kube-system"},
+	}
+
+	ok, parents := c.getAPIParentPods("mynode")
+	if !ok {
+		t.Fatal("Expected the apiserver to be available")
+	}
+	var got []string
+	for id := range parents {
+		got = append(got, id)
+	}
+	sort.Strings(got)
+	expected := []string{"kube-system/kube-apiserver", "kube-system/kube-scheduler", "monitoring/prometheus"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected parents: %v Got: %v", expected, got)
+	}
+}
+
+func TestPollAPIServer(t *testing.T) {
+	apiserverPollInterval = time.Minute
+	defer func() { apiserverPollInterval = 0 }()
+
+	client := fake.NewSimpleClientset()
+	c := &checkpointer{apiserver: client, checkpointerPod: CheckpointerPod{NodeName: "mynode", PodNamespace: "kube-system"}}
+	start := time.Unix(0, 0)
+	for _, now := range []time.Time{start, start.Add(30 * time.Second), start.Add(time.Minute), start.Add(90 * time.Second)} {
+		if ok, _ := c.pollAPIServer(now); !ok {
+			t.Fatalf("Expected the apiserver to be available at %s", now.Sub(start))
+		}
+	}
+	if got := len(client.Actions()); got != 2 {
+		t.Errorf("Expected the apiserver to be polled 2 times, got %d", got)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
 const (
@@ -17,6 +20,8 @@ const (
 	inactiveCheckpointPath  = "/etc/kubernetes/inactive-manifests"
 	checkpointSecretPath    = "/etc/kubernetes/checkpoint-secrets"
 	checkpointConfigMapPath = "/etc/kubernetes/checkpoint-configmaps"
+	checkpointHistoryPath   = "/etc/kubernetes/checkpoint-history"
+	checkpointVolumePath    = "/etc/kubernetes/checkpoint-volumes"
 
 	shouldCheckpointAnnotation = "checkpointer.alpha.coreos.com/checkpoint"    // = "true"
 	checkpointParentAnnotation = "checkpointer.alpha.coreos.com/checkpoint-of" // = "podName"
@@ -27,6 +32,8 @@ const (
 
 	defaultPollingFrequency  = 5 * time.Second
 	defaultCheckpointTimeout = 1 * time.Minute
+	defaultCheckpointBackoff = 10 * time.Second
+	defaultMaxBackoff        = 2 * time.Minute
 
 	rootUID = 0
 	rootGID = 0
@@ -35,6 +42,14 @@ const (
 var (
 	lastCheckpoint        time.Time
 	checkpointGracePeriod time.Duration
+	checkpointRetention   time.Duration
+	checkpointHistory     int
+	checkpointSelector    labels.Selector
+	checkpointNamespaces  []string
+	checkpointInterval    time.Duration
+	apiserverPollInterval time.Duration
+	kubeletPollInterval   time.Duration
+	dryRun                bool
 )
 
 // Options defines the parameters that are required to start the checkpointer.
@@ -50,6 +65,39 @@ type Options struct {
 	// CheckpointGracePeriod is the timeout that is used for cleaning up checkpoints when the parent
 	// pod is deleted.
 	CheckpointGracePeriod time.Duration
+	// CheckpointRetention is how long inactive checkpoints are retained once their parent pod is
+	// no longer seen by the apiserver or kubelet, even if the apiserver is unavailable. Zero
+	// retains them until the apiserver confirms the deletion of the parent.
+	CheckpointRetention time.Duration
+	// CheckpointHistory is the number of previous versions of the checkpoint manifest of each pod to
+	// keep in the checkpoint history path.
+	CheckpointHistory int
+	// CheckpointSelector selects pods to checkpoint in addition to those with the checkpoint
+	// annotation, if set. Only pods in the checkpoint namespaces are selected.
+	CheckpointSelector labels.Selector
+	// CheckpointNamespaces are namespaces to checkpoint pods of in addition to the namespace of this
+	// checkpointer pod.
+	CheckpointNamespaces []string
+	// CheckpointInterval is how often the checkpointer checkpoints pods and updates the state of
+	// the checkpoints. Defaults to 5 seconds.
+	CheckpointInterval time.Duration
+	// CheckpointBackoff and MaxCheckpointBackoff are the initial and maximum time a pod is not
+	// checkpointed after repeated failures, doubling with every failure. Default to 10 seconds and 2
+	// minutes.
+	CheckpointBackoff    time.Duration
+	MaxCheckpointBackoff time.Duration
+	// APIServerPollInterval and KubeletPollInterval are how often the parent pods are retrieved from
+	// the apiserver and kubelet. Between polls the checkpointer uses the last retrieved ones. Default
+	// to every checkpoint interval.
+	APIServerPollInterval time.Duration
+	KubeletPollInterval   time.Duration
+	// MetricsAddr is the address to serve Prometheus metrics on at /metrics, if set.
+	MetricsAddr string
+	// HealthzAddr is the address to serve the health of the checkpointer on at /healthz, if set.
+	HealthzAddr string
+	// DryRun logs the decisions of the checkpointer and the files it would write or remove, without
+	// writing or removing them.
+	DryRun bool
 }
 
 // CheckpointerPod holds information about this checkpointer pod.
@@ -69,6 +117,15 @@ type checkpointer struct {
 	cri             *remoteRuntimeService
 	checkpointerPod CheckpointerPod
 	checkpoints     checkpoints
+	// backoff delays checkpointing pods that repeatedly failed to be checkpointed.
+	backoff *flowcontrol.Backoff
+
+	// The results of the latest polls of the apiserver and kubelet.
+	lastAPIServerPoll time.Time
+	apiAvailable      bool
+	apiParentPods     map[string]*v1.Pod
+	lastKubeletPoll   time.Time
+	localParentPods   map[string]*v1.Pod
 }
 
 // Run instantiates and starts a new checkpointer. Returns error if there was a problem creating
@@ -88,12 +145,46 @@ func Run(opts Options) error {
 	}
 
 	checkpointGracePeriod = opts.CheckpointGracePeriod
+	checkpointRetention = opts.CheckpointRetention
+	checkpointHistory = opts.CheckpointHistory
+	checkpointSelector = opts.CheckpointSelector
+	checkpointNamespaces = []string{opts.CheckpointerPod.PodNamespace}
+	for _, ns := range opts.CheckpointNamespaces {
+		if ns != opts.CheckpointerPod.PodNamespace {
+			checkpointNamespaces = append(checkpointNamespaces, ns)
+		}
+	}
+
+	checkpointInterval = opts.CheckpointInterval
+	if checkpointInterval == 0 {
+		checkpointInterval = defaultPollingFrequency
+	}
+	apiserverPollInterval = opts.APIServerPollInterval
+	kubeletPollInterval = opts.KubeletPollInterval
+	backoff, maxBackoff := opts.CheckpointBackoff, opts.MaxCheckpointBackoff
+	if backoff == 0 {
+		backoff = defaultCheckpointBackoff
+	}
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	dryRun = opts.DryRun
+	if dryRun {
+		glog.Infof("Dry run: checkpoints are not written, started, stopped or removed")
+		// The state directories aren't written to, and may be used by another checkpointer.
+		health.stateDirs = nil
+	}
+
+	health.recordLoop(time.Now())
+	serveHTTP(opts.MetricsAddr, opts.HealthzAddr)
 
 	cp := &checkpointer{
 		apiserver:       apiserver,
 		kubelet:         kubelet,
 		cri:             cri,
 		checkpointerPod: opts.CheckpointerPod,
+		backoff:         flowcontrol.NewBackOff(backoff, maxBackoff),
 	}
 	cp.run()
 
@@ -103,25 +194,26 @@ func Run(opts Options) error {
 // run is the main checkpointing loop.
 func (c *checkpointer) run() {
 	// Make sure the inactive checkpoint path exists.
-	if err := os.MkdirAll(inactiveCheckpointPath, 0700); err != nil {
+	if dryRun {
+		glog.Infof("Dry run: not creating %s", inactiveCheckpointPath)
+	} else if err := os.MkdirAll(inactiveCheckpointPath, 0700); err != nil {
 		glog.Fatalf("Could not create inactive checkpoint path: %v", err)
 	}
 
 	for {
-		time.Sleep(defaultPollingFrequency)
+		time.Sleep(checkpointInterval)
 
 		// We must use both the kubelet /pods endpoint and CRI shim, because /pods
 		// endpoint could have stale data. The /pods endpoint will only show the last cached
 		// status which has successfully been written to an apiserver. However, if there is
 		// no apiserver, we may get stale state (e.g. saying pod is running, when it really is
 		// not).
-		localParentPods := c.kubelet.localParentPods()
+		localParentPods := c.pollKubelet(time.Now())
 		localRunningPods := c.cri.localRunningPods()
 
 		// Try to get scheduled pods from the apiserver.
 		// These will be used to GC checkpoints for parents no longer scheduled to this node.
-		// TODO(aaron): only check this every 30 seconds or so
-		apiAvailable, apiParentPods := c.getAPIParentPods(c.checkpointerPod.NodeName)
+		apiAvailable, apiParentPods := c.pollAPIServer(time.Now())
 
 		// Get on disk copies of (in)active checkpoints
 		//TODO(aaron): Could be racy to load from disk each time, but much easier than trying to keep in-memory state in sync.
@@ -142,5 +234,29 @@ func (c *checkpointer) run() {
 		handleStop(stop)
 		handleStart(start)
 		handleRemove(remove)
+		c.checkpoints.removeOrphans()
+		c.checkpoints.updateCheckpointMetrics(remove)
+		c.backoff.GC()
+		health.recordLoop(time.Now())
+	}
+}
+
+// pollKubelet returns the parent pods of the kubelet, retrieving them at most every kubelet poll
+// interval.
+func (c *checkpointer) pollKubelet(now time.Time) map[string]*v1.Pod {
+	if c.lastKubeletPoll.IsZero() || now.Sub(c.lastKubeletPoll) >= kubeletPollInterval {
+		c.localParentPods = c.kubelet.localParentPods()
+		c.lastKubeletPoll = now
+	}
+	return c.localParentPods
+}
+
+// pollAPIServer returns whether the apiserver is available and its parent pods, retrieving them at
+// most every apiserver poll interval.
+func (c *checkpointer) pollAPIServer(now time.Time) (bool, map[string]*v1.Pod) {
+	if c.lastAPIServerPoll.IsZero() || now.Sub(c.lastAPIServerPoll) >= apiserverPollInterval {
+		c.apiAvailable, c.apiParentPods = c.getAPIParentPods(c.checkpointerPod.NodeName)
+		c.lastAPIServerPoll = now
 	}
+	return c.apiAvailable, c.apiParentPods
 }
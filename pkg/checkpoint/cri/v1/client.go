@@ -0,0 +1,58 @@
+// Package v1 is a client of the v1 CRI runtime service, which containerd and CRI-O serve instead of
+// v1alpha2. Only the methods the checkpointer calls are implemented. The v1 messages are wire
+// compatible with those of v1alpha2, so the vendored v1alpha2 messages are used.
+package v1
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/checkpoint/cri/v1alpha2"
+)
+
+// RuntimeServiceClient is the client API for the v1 RuntimeService.
+type RuntimeServiceClient interface {
+	// Version returns the runtime name, runtime version, and runtime API version.
+	Version(ctx context.Context, in *v1alpha2.VersionRequest, opts ...grpc.CallOption) (*v1alpha2.VersionResponse, error)
+	// ListPodSandbox returns a list of PodSandboxes.
+	ListPodSandbox(ctx context.Context, in *v1alpha2.ListPodSandboxRequest, opts ...grpc.CallOption) (*v1alpha2.ListPodSandboxResponse, error)
+	// ListContainers lists all containers by filters.
+	ListContainers(ctx context.Context, in *v1alpha2.ListContainersRequest, opts ...grpc.CallOption) (*v1alpha2.ListContainersResponse, error)
+}
+
+type runtimeServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewRuntimeServiceClient returns a client of the v1 RuntimeService of the connection.
+func NewRuntimeServiceClient(cc *grpc.ClientConn) RuntimeServiceClient {
+	return &runtimeServiceClient{cc}
+}
+
+func (c *runtimeServiceClient) Version(ctx context.Context, in *v1alpha2.VersionRequest, opts ...grpc.CallOption) (*v1alpha2.VersionResponse, error) {
+	out := new(v1alpha2.VersionResponse)
+	err := c.cc.Invoke(ctx, "/runtime.v1.RuntimeService/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runtimeServiceClient) ListPodSandbox(ctx context.Context, in *v1alpha2.ListPodSandboxRequest, opts ...grpc.CallOption) (*v1alpha2.ListPodSandboxResponse, error) {
+	out := new(v1alpha2.ListPodSandboxResponse)
+	err := c.cc.Invoke(ctx, "/runtime.v1.RuntimeService/ListPodSandbox", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runtimeServiceClient) ListContainers(ctx context.Context, in *v1alpha2.ListContainersRequest, opts ...grpc.CallOption) (*v1alpha2.ListContainersResponse, error) {
+	out := new(v1alpha2.ListContainersResponse)
+	err := c.cc.Invoke(ctx, "/runtime.v1.RuntimeService/ListContainers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// checkpointEnv replaces the environment variables the containers of the pod read from
+// ConfigMaps, with env or envFrom, by their values. Static pods can't reference API objects, so
+// the values are stored in the checkpoint manifest. Pods reading Secrets into their environment
+// can't be checkpointed: the kubelet publishes the manifest as a mirror pod, which would show the
+// values of the Secrets to anyone who can read pods.
+func (c *checkpointer) checkpointEnv(pod *corev1.Pod) error {
+	if name, ok := envSecret(pod); ok {
+		return fmt.Errorf("pod %s/%s reads Secret %s into its environment, whose values would be published in the checkpoint's mirror pod", pod.Namespace, pod.Name, name)
+	}
+	configMaps := map[string]map[string]string{}
+	// data returns the data of a ConfigMap, nil if it is optional and missing.
+	data := func(name string, optional *bool) (map[string]string, error) {
+		if d, ok := configMaps[name]; ok {
+			return d, nil
+		}
+		cm, err := c.apiserver.CoreV1().ConfigMaps(pod.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		var d map[string]string
+		if err == nil {
+			d = cm.Data
+		} else if apierrors.IsNotFound(err) && optional != nil && *optional {
+			err = nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve ConfigMap %s/%s: %v", pod.Namespace, name, err)
+		}
+		configMaps[name] = d
+		return d, nil
+	}
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			ctr := &containers[i]
+			var env []corev1.EnvVar
+			index := map[string]int{}
+			// set adds a variable, replacing earlier ones of the name like the kubelet.
+			set := func(e corev1.EnvVar) {
+				if j, ok := index[e.Name]; ok {
+					env[j] = e
+					return
+				}
+				index[e.Name] = len(env)
+				env = append(env, e)
+			}
+
+			for _, from := range ctr.EnvFrom {
+				if from.ConfigMapRef == nil {
+					continue
+				}
+				d, err := data(from.ConfigMapRef.Name, from.ConfigMapRef.Optional)
+				if err != nil {
+					return err
+				}
+				var keys []string
+				for k := range d {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					// The kubelet skips keys that are invalid variable names too.
+					if len(validation.IsEnvVarName(from.Prefix+k)) == 0 {
+						set(corev1.EnvVar{Name: from.Prefix + k, Value: d[k]})
+					}
+				}
+			}
+
+			for _, e := range ctr.Env {
+				if e.ValueFrom == nil || e.ValueFrom.ConfigMapKeyRef == nil {
+					set(e)
+					continue
+				}
+				ref := e.ValueFrom.ConfigMapKeyRef
+				d, err := data(ref.Name, ref.Optional)
+				if err != nil {
+					return err
+				}
+				v, ok := d[ref.Key]
+				if !ok {
+					if ref.Optional != nil && *ref.Optional {
+						continue
+					}
+					return fmt.Errorf("ConfigMap %s/%s has no key %s", pod.Namespace, ref.Name, ref.Key)
+				}
+				set(corev1.EnvVar{Name: e.Name, Value: v})
+			}
+			ctr.Env, ctr.EnvFrom = env, nil
+		}
+	}
+	return nil
+}
+
+// envSecret returns the name of a Secret a container of the pod reads into its environment.
+func envSecret(pod *corev1.Pod) (string, bool) {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, ctr := range containers {
+			for _, from := range ctr.EnvFrom {
+				if from.SecretRef != nil {
+					return from.SecretRef.Name, true
+				}
+			}
+			for _, e := range ctr.Env {
+				if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+					return e.ValueFrom.SecretKeyRef.Name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,121 @@
+package checkpoint
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckpointEnv(t *testing.T) {
+	optional := true
+	c := &checkpointer{apiserver: fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "apiserver", Namespace: "kube-system"},
+		Data:       map[string]string{"LOG_LEVEL": "2", "AUDIT": "true", "1-invalid": "json"},
+	})}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-apiserver", Namespace: "kube-system"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "kube-apiserver",
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "apiserver"}}},
+				{Prefix: "EXTRA_", ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Optional: &optional}},
+			},
+			Env: []corev1.EnvVar{
+				{Name: "LOG_LEVEL", Value: "4"},
+				{Name: "AUDIT_ENABLED", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "apiserver"}, Key: "AUDIT",
+				}}},
+				{Name: "OPTIONAL", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "apiserver"}, Key: "missing", Optional: &optional,
+				}}},
+				{Name: "NODE_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+			},
+		}}},
+	}
+	if err := c.checkpointEnv(pod); err != nil {
+		t.Fatal(err)
+	}
+	ctr := pod.Spec.Containers[0]
+	want := []corev1.EnvVar{
+		{Name: "AUDIT", Value: "true"},
+		{Name: "LOG_LEVEL", Value: "4"},
+		{Name: "AUDIT_ENABLED", Value: "true"},
+		{Name: "NODE_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+	}
+	if !reflect.DeepEqual(ctr.Env, want) || ctr.EnvFrom != nil {
+		t.Errorf("got env %+v and envFrom %+v, want env %+v", ctr.Env, ctr.EnvFrom, want)
+	}
+
+	// A required ConfigMap that is missing fails the checkpoint.
+	pod.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}}}}
+	if err := c.checkpointEnv(pod); err == nil {
+		t.Error("expected an error for a missing ConfigMap")
+	}
+}
+
+func TestCheckpointEnvRefusesSecrets(t *testing.T) {
+	c := &checkpointer{apiserver: fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "oidc", Namespace: "kube-system"},
+		Data:       map[string][]byte{"client-secret": []byte("s3cr3t-value")},
+	})}
+	for name, ctr := range map[string]corev1.Container{
+		"env": {Name: "kube-apiserver", Env: []corev1.EnvVar{{Name: "OIDC_CLIENT_SECRET", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "oidc"}, Key: "client-secret",
+		}}}}},
+		"envFrom": {Name: "kube-apiserver", EnvFrom: []corev1.EnvFromSource{{Prefix: "OIDC_", SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "oidc"}}}}},
+	} {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-apiserver", Namespace: "kube-system"},
+			Spec:       corev1.PodSpec{InitContainers: []corev1.Container{ctr}},
+		}
+		err := c.checkpointEnv(pod)
+		if err == nil || !strings.Contains(err.Error(), "Secret oidc") {
+			t.Errorf("%s: checkpointEnv() = %v, want an error about Secret oidc", name, err)
+		}
+		if !reflect.DeepEqual(pod.Spec.InitContainers[0], ctr) {
+			t.Errorf("%s: the environment was changed to %+v", name, pod.Spec.InitContainers[0])
+		}
+	}
+}
+
+func TestCheckpointManifestHasNoSecrets(t *testing.T) {
+	c := &checkpointer{apiserver: fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "apiserver", Namespace: "kube-system"},
+			Data:       map[string][]byte{"service-account.key": []byte("s3cr3t-value")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "apiserver", Namespace: "kube-system"},
+			Data:       map[string]string{"LOG_LEVEL": "2"},
+		},
+	)}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-apiserver", Namespace: "kube-system"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:         "kube-apiserver",
+				EnvFrom:      []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "apiserver"}}}},
+				VolumeMounts: []corev1.VolumeMount{{Name: "secrets", MountPath: "/etc/kubernetes/secrets"}},
+			}},
+			Volumes: []corev1.Volume{{Name: "secrets", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "apiserver"}}}},
+		},
+	}
+	if err := c.checkpointEnv(pod); err != nil {
+		t.Fatal(err)
+	}
+	var manifest bytes.Buffer
+	if err := podSerializer.Encode(sanitizeCheckpointPod(pod), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(manifest.String(), "s3cr3t-value") {
+		t.Errorf("the checkpoint manifest holds the value of a Secret:\n%s", manifest.String())
+	}
+	if !strings.Contains(manifest.String(), `"LOG_LEVEL"`) {
+		t.Errorf("the checkpoint manifest lacks the environment of its ConfigMap:\n%s", manifest.String())
+	}
+}
@@ -0,0 +1,157 @@
+package checkpoint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// healthzSyncTimeout is how long the checkpointer may take to complete a loop before it is
+// considered wedged.
+const healthzSyncTimeout = 5 * time.Minute
+
+// health holds the results of the latest requests of the checkpointer.
+// The pod manifest path of the kubelet isn't probed, since the checkpointer removes the temporary
+// files in it meanwhile.
+var health = &checkpointerHealth{
+	syncErrors: map[string]error{},
+	stateDirs:  []string{inactiveCheckpointPath, checkpointSecretPath, checkpointConfigMapPath, checkpointVolumePath},
+}
+
+// checkpointerHealth reports whether the checkpointer works at /healthz.
+type checkpointerHealth struct {
+	mu sync.Mutex
+	// lastSync is when the checkpointer last completed a loop, or started.
+	lastSync time.Time
+	// syncErrors are the errors of the latest requests to the kubelet, cri and apiserver.
+	syncErrors map[string]error
+	// stateDirs are the directories the checkpointer must be able to write to.
+	stateDirs []string
+}
+
+// recordSync records the result of a request to api, the kubelet, cri or apiserver.
+func (h *checkpointerHealth) recordSync(api string, err error) {
+	if err != nil {
+		apiSyncErrors.WithLabelValues(api).Inc()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.syncErrors[api] = err
+}
+
+// recordLoop records that the checkpointer completed a loop at now.
+func (h *checkpointerHealth) recordLoop(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSync = now
+}
+
+// check returns the results of the health checks, and whether the checkpointer is healthy. The
+// checkpointer is unhealthy if it can't reach the kubelet or cri, can't write to its state
+// directories, or is wedged. It is healthy while the apiserver is unreachable, since that is when
+// checkpoints are needed.
+func (h *checkpointerHealth) check(now time.Time) ([]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var results []string
+	healthy := true
+	report := func(name string, err error, fatal bool) {
+		switch {
+		case err == nil:
+			results = append(results, fmt.Sprintf("[+]%s ok", name))
+		case fatal:
+			results = append(results, fmt.Sprintf("[-]%s failed: %v", name, err))
+			healthy = false
+		default:
+			results = append(results, fmt.Sprintf("[-]%s failed (ignored): %v", name, err))
+		}
+	}
+
+	var err error
+	if d := now.Sub(h.lastSync); d > healthzSyncTimeout {
+		err = fmt.Errorf("no loop completed in %s", d.Round(time.Second))
+	}
+	report("sync", err, true)
+
+	var apis []string
+	for api := range h.syncErrors {
+		apis = append(apis, api)
+	}
+	sort.Strings(apis)
+	for _, api := range apis {
+		report(api, h.syncErrors[api], api != "apiserver")
+	}
+
+	for _, dir := range h.stateDirs {
+		report("write "+dir, checkWritable(dir), true)
+	}
+	return results, healthy
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP().
+func (h *checkpointerHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	results, healthy := h.check(time.Now())
+	if !healthy {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	for _, result := range results {
+		fmt.Fprintln(w, result)
+	}
+	if healthy {
+		fmt.Fprintln(w, "healthz check passed")
+	} else {
+		fmt.Fprintln(w, "healthz check failed")
+	}
+}
+
+// checkWritable returns an error unless a file can be written to dir, which is created if missing.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// Temporary files start with a "." so that they aren't read as checkpoints or static pods.
+	f, err := ioutil.TempFile(dir, ".healthz")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	// It may have been removed as a leftover temporary file already.
+	if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// serveHTTP serves the Prometheus metrics of the checkpointer on metricsAddr at /metrics, and its
+// health on healthzAddr at /healthz, if set, in the background.
+func serveHTTP(metricsAddr, healthzAddr string) {
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if metricsAddr != "" {
+		mux(metricsAddr).Handle("/metrics", promhttp.Handler())
+	}
+	if healthzAddr != "" {
+		mux(healthzAddr).Handle("/healthz", health)
+	}
+	for addr, m := range muxes {
+		go func(addr string, m *http.ServeMux) {
+			glog.Infof("Serving on %s", addr)
+			if err := http.ListenAndServe(addr, m); err != nil {
+				glog.Errorf("Failed to serve on %s: %v", addr, err)
+			}
+		}(addr, m)
+	}
+}
@@ -0,0 +1,67 @@
+package checkpoint
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckpointerHealth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	notDir := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(notDir, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		desc          string
+		lastSync      time.Time
+		syncErrors    map[string]error
+		stateDirs     []string
+		expected      []string
+		expectHealthy bool
+	}{{
+		desc:          "All checks pass",
+		lastSync:      now,
+		syncErrors:    map[string]error{"apiserver": nil, "cri": nil, "kubelet": nil},
+		stateDirs:     []string{filepath.Join(dir, "manifests")},
+		expected:      []string{"[+]sync ok", "[+]apiserver ok", "[+]cri ok", "[+]kubelet ok", "[+]write " + filepath.Join(dir, "manifests") + " ok"},
+		expectHealthy: true,
+	}, {
+		desc:          "Apiserver unreachable: still healthy",
+		lastSync:      now,
+		syncErrors:    map[string]error{"apiserver": errors.New("connection refused"), "kubelet": nil},
+		expected:      []string{"[+]sync ok", "[-]apiserver failed (ignored): connection refused", "[+]kubelet ok"},
+		expectHealthy: true,
+	}, {
+		desc:       "Kubelet unreachable",
+		lastSync:   now,
+		syncErrors: map[string]error{"kubelet": errors.New("connection refused")},
+		expected:   []string{"[+]sync ok", "[-]kubelet failed: connection refused"},
+	}, {
+		desc:     "Wedged loop",
+		lastSync: now.Add(-10 * time.Minute),
+		expected: []string{"[-]sync failed: no loop completed in 10m0s"},
+	}} {
+		h := &checkpointerHealth{lastSync: tc.lastSync, syncErrors: tc.syncErrors, stateDirs: tc.stateDirs}
+		got, healthy := h.check(now)
+		if !reflect.DeepEqual(tc.expected, got) || tc.expectHealthy != healthy {
+			t.Errorf("For test: %s\nExpected: %q healthy: %t\nGot: %q healthy: %t", tc.desc, tc.expected, tc.expectHealthy, got, healthy)
+		}
+	}
+
+	// A state directory that can't be created fails the check.
+	h := &checkpointerHealth{lastSync: now, stateDirs: []string{filepath.Join(notDir, "manifests")}}
+	if _, healthy := h.check(now); healthy {
+		t.Errorf("Expected a state directory that can't be written to fail the check")
+	}
+}
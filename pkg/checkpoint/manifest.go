@@ -5,7 +5,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
@@ -18,6 +20,10 @@ func getFileCheckpoints(path string) map[string]*corev1.Pod {
 	checkpoints := make(map[string]*corev1.Pod)
 
 	fi, err := ioutil.ReadDir(path)
+	// A dry run doesn't create the inactive checkpoint path.
+	if os.IsNotExist(err) && dryRun {
+		return checkpoints
+	}
 	if err != nil {
 		glog.Fatalf("Failed to read checkpoint manifest path: %v", err)
 	}
@@ -28,7 +34,7 @@ func getFileCheckpoints(path string) map[string]*corev1.Pod {
 		// Check for leftover temporary checkpoints.
 		if strings.HasPrefix(filepath.Base(manifest), ".") {
 			glog.V(4).Infof("Found temporary checkpoint %s, removing.", manifest)
-			if err := os.Remove(manifest); err != nil {
+			if err := removeFile(manifest); err != nil {
 				glog.V(4).Infof("Error removing temporary checkpoint %s: %v.", manifest, err)
 			}
 			continue
@@ -47,6 +53,7 @@ func getFileCheckpoints(path string) map[string]*corev1.Pod {
 		}
 
 		if isCheckpoint(cp) {
+			migrateCheckpointManifest(manifest, cp)
 			if _, ok := checkpoints[podFullName(cp)]; ok { // sanity check
 				glog.Warningf("Found multiple checkpoint pods in %s with same id: %s", path, podFullName(cp))
 			}
@@ -56,6 +63,32 @@ func getFileCheckpoints(path string) map[string]*corev1.Pod {
 	return checkpoints
 }
 
+// migrateCheckpointManifest migrates the checkpoint cp read from manifest to the current version,
+// then rewrites the manifest. Checkpoints that can't be migrated are used as they are.
+func migrateCheckpointManifest(manifest string, cp *corev1.Pod) {
+	migrated, err := migrateCheckpoint(cp)
+	if _, ok := err.(errNewerCheckpoint); ok {
+		glog.Warningf("Using checkpoint %s as it is: %v", manifest, err)
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to migrate checkpoint %s, using it as it is: %v", manifest, err)
+		return
+	}
+	if !migrated {
+		return
+	}
+	buff := &bytes.Buffer{}
+	if err := podSerializer.Encode(cp, buff); err != nil {
+		glog.Errorf("Failed to encode migrated checkpoint %s: %v", manifest, err)
+		return
+	}
+	glog.Infof("Migrating checkpoint %s to version %d", manifest, checkpointVersion)
+	if err := writeAndAtomicRename(manifest, buff.Bytes(), rootUID, rootGID, 0600); err != nil {
+		glog.Errorf("Failed to write migrated checkpoint %s: %v", manifest, err)
+	}
+}
+
 // writeCheckpointManifest will save the pod to the inactive checkpoint location if it doesn't already exist.
 func writeCheckpointManifest(pod *corev1.Pod) (bool, error) {
 	buff := &bytes.Buffer{}
@@ -63,41 +96,64 @@ func writeCheckpointManifest(pod *corev1.Pod) (bool, error) {
 		return false, err
 	}
 	path := filepath.Join(inactiveCheckpointPath, pod.Namespace+"-"+pod.Name+".json")
+	if checkpointHistory > 0 {
+		if err := archiveManifest(path, podFullName(pod), buff.Bytes(), time.Now()); err != nil {
+			glog.Errorf("Failed to archive the checkpoint manifest of %s: %v", podFullName(pod), err)
+		}
+	}
 	return writeManifestIfDifferent(path, podFullName(pod), buff.Bytes())
 }
 
-// writeManifestIfDifferent writes `data` to `path` if data is different from the existing content.
-// The `name` parameter is used for debug output.
-func writeManifestIfDifferent(path, name string, data []byte) (bool, error) {
+// archiveManifest copies the manifest at path to the history of the pod id before it is replaced
+// by data, keeping the last checkpointHistory versions.
+func archiveManifest(path, id string, data []byte, now time.Time) error {
 	existing, err := ioutil.ReadFile(path)
-	if err != nil && !os.IsNotExist(err) {
-		return false, err
+	if os.IsNotExist(err) || (err == nil && bytes.Equal(existing, data)) {
+		return nil
 	}
-	if bytes.Equal(existing, data) {
-		glog.V(4).Infof("Checkpoint manifest for %q already exists. Skipping", name)
-		return false, nil
-	}
-	glog.Infof("Writing manifest for %q to %q", name, path)
-	return true, writeAndAtomicRename(path, data, rootUID, rootGID, 0644)
-}
-
-func writeAndAtomicRename(path string, data []byte, uid, gid int, perm os.FileMode) error {
-	// Ensure that the temporary file is on the same filesystem so that os.Rename() does not error.
-	tmpfile, err := ioutil.TempFile(filepath.Dir(path), ".")
 	if err != nil {
 		return err
 	}
-	if _, err := tmpfile.Write(data); err != nil {
+	dir := podFullNameToHistoryPath(id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return err
 	}
-	if err := tmpfile.Chmod(perm); err != nil {
+	// The names sort by the time the manifests were replaced.
+	name := now.UTC().Format("20060102T150405.000000000Z") + ".json"
+	if err := writeAndAtomicRename(filepath.Join(dir, name), existing, rootUID, rootGID, 0600); err != nil {
 		return err
 	}
-	if err := tmpfile.Close(); err != nil {
+	fi, err := ioutil.ReadDir(dir)
+	if err != nil {
 		return err
 	}
-	if err := os.Rename(tmpfile.Name(), path); err != nil {
-		return err
+	var versions []string
+	for _, f := range fi {
+		if !strings.HasPrefix(f.Name(), ".") {
+			versions = append(versions, f.Name())
+		}
+	}
+	sort.Strings(versions)
+	for len(versions) > checkpointHistory {
+		if err := os.Remove(filepath.Join(dir, versions[0])); err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+	return nil
+}
+
+// writeManifestIfDifferent writes `data` to `path` if data is different from the existing content.
+// The `name` parameter is used for debug output.
+func writeManifestIfDifferent(path, name string, data []byte) (bool, error) {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
 	}
-	return os.Chown(path, uid, gid)
+	if bytes.Equal(existing, data) {
+		glog.V(4).Infof("Checkpoint manifest for %q already exists. Skipping", name)
+		return false, nil
+	}
+	glog.Infof("Writing manifest for %q to %q", name, path)
+	return true, writeAndAtomicRename(path, data, rootUID, rootGID, 0600)
 }
@@ -0,0 +1,51 @@
+package checkpoint
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const metricsNamespace = "pod_checkpointer"
+
+var (
+	activeCheckpointsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_checkpoints",
+		Help:      "Number of checkpoints that are active, i.e. in the pod manifest path of the kubelet.",
+	})
+	checkpointWriteFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "checkpoint_write_failures_total",
+		Help:      "Number of times the checkpoint of a pod, or its secrets, configMaps or environment, failed to be written.",
+	}, []string{"pod"})
+	lastCheckpointTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_checkpoint_timestamp_seconds",
+		Help:      "Unix time of the last successful checkpoint of a pod.",
+	}, []string{"pod"})
+	apiSyncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_sync_errors_total",
+		Help:      "Number of failed requests listing pods, by the API they were sent to.",
+	}, []string{"api"})
+)
+
+func init() {
+	prometheus.MustRegister(activeCheckpointsGauge, checkpointWriteFailures, lastCheckpointTimestamp, apiSyncErrors)
+}
+
+// updateCheckpointMetrics updates the metrics derived from the checkpoint states, removing the
+// series of the removed checkpoints.
+func (cs *checkpoints) updateCheckpointMetrics(removed []string) {
+	active := 0
+	for _, cp := range cs.checkpoints {
+		if cp.state.action() == start {
+			active++
+		}
+	}
+	if cs.selfCheckpoint != nil && cs.selfCheckpoint.state.action() == start {
+		active++
+	}
+	activeCheckpointsGauge.Set(float64(active))
+	for _, id := range removed {
+		checkpointWriteFailures.DeleteLabelValues(id)
+		lastCheckpointTimestamp.DeleteLabelValues(id)
+	}
+}
@@ -0,0 +1,47 @@
+package checkpoint
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countMetrics returns the number of series c collects.
+func countMetrics(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	n := 0
+	for range ch {
+		n++
+	}
+	return n
+}
+
+func TestUpdateCheckpointMetrics(t *testing.T) {
+	cs := checkpoints{
+		checkpoints: map[string]*checkpoint{
+			"kube-system/kube-apiserver": {name: "kube-system/kube-apiserver", state: stateActive{}},
+			"kube-system/kube-scheduler": {name: "kube-system/kube-scheduler", state: stateInactive{}},
+		},
+		selfCheckpoint: &checkpoint{name: "kube-system/pod-checkpointer", state: stateSelfCheckpointActive{}},
+	}
+	checkpointWriteFailures.WithLabelValues("kube-system/kube-controller-manager").Inc()
+	lastCheckpointTimestamp.WithLabelValues("kube-system/kube-controller-manager").SetToCurrentTime()
+	lastCheckpointTimestamp.WithLabelValues("kube-system/kube-apiserver").SetToCurrentTime()
+
+	cs.updateCheckpointMetrics([]string{"kube-system/kube-controller-manager"})
+
+	if got := testutil.ToFloat64(activeCheckpointsGauge); got != 2 {
+		t.Errorf("Expected 2 active checkpoints, got %v", got)
+	}
+	if got := countMetrics(lastCheckpointTimestamp); got != 1 {
+		t.Errorf("Expected the last checkpoint timestamp of 1 pod, got %d", got)
+	}
+	if got := countMetrics(checkpointWriteFailures); got != 0 {
+		t.Errorf("Expected no checkpoint write failures of removed pods, got %d", got)
+	}
+}
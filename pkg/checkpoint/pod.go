@@ -8,6 +8,7 @@ import (
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/client-go/kubernetes/scheme"
 )
@@ -58,6 +59,7 @@ func sanitizeCheckpointPod(cp *corev1.Pod) *corev1.Pod {
 
 	// Track this checkpoint's parent pod
 	cp.Annotations[checkpointParentAnnotation] = cp.Name
+	setCheckpointVersion(cp)
 
 	// Remove Service Account
 	cp.Spec.ServiceAccountName = ""
@@ -78,6 +80,9 @@ func sanitizeCheckpointPod(cp *corev1.Pod) *corev1.Pod {
 		} else if v.ConfigMap != nil {
 			v.HostPath = &corev1.HostPathVolumeSource{Path: configMapPath(cp.Namespace, cp.Name, v.ConfigMap.Name)}
 			v.ConfigMap = nil
+		} else if v.DownwardAPI != nil || v.Projected != nil {
+			v.HostPath = &corev1.HostPathVolumeSource{Path: volumePath(cp.Namespace, cp.Name, v.Name)}
+			v.DownwardAPI, v.Projected = nil, nil
 		}
 	}
 
@@ -133,18 +138,29 @@ func podListToMap(pl *corev1.PodList, filter filterFn) map[string]*corev1.Pod {
 }
 
 // A valid checkpoint parent:
-//    has the checkpoint=true annotation
+//    has the checkpoint=true annotation, or is selected by the checkpoint selector
 //    is not a static pod itself
 //    is not a checkpoint pod itself
 func isValidParent(pod *corev1.Pod) bool {
-	if pod.Annotations == nil {
-		return false
-	}
-	shouldCheckpoint := pod.Annotations[shouldCheckpointAnnotation] == shouldCheckpoint
+	shouldCheckpoint := pod.Annotations[shouldCheckpointAnnotation] == shouldCheckpoint || isSelectedParent(pod)
 	isStatic := pod.Annotations[podSourceAnnotation] == podSourceFile
 	return shouldCheckpoint && !isStatic && !isCheckpoint(pod)
 }
 
+// isSelectedParent returns whether the checkpoint selector selects the pod, which must be in one of
+// the checkpoint namespaces.
+func isSelectedParent(pod *corev1.Pod) bool {
+	if checkpointSelector == nil || checkpointSelector.Empty() {
+		return false
+	}
+	for _, ns := range checkpointNamespaces {
+		if pod.Namespace == ns {
+			return checkpointSelector.Matches(labels.Set(pod.Labels))
+		}
+	}
+	return false
+}
+
 func isCheckpoint(pod *corev1.Pod) bool {
 	if pod.Annotations == nil {
 		return false
@@ -165,6 +181,10 @@ func podFullNameToActiveCheckpointPath(id string) string {
 	return filepath.Join(activeCheckpointPath, strings.Replace(id, "/", "-", -1)+".json")
 }
 
+func podFullNameToHistoryPath(id string) string {
+	return filepath.Join(checkpointHistoryPath, id)
+}
+
 // ErrorConflictingSecurityContexts is returned when a pod has a PodSecurityContext and/or
 // SecurityContext(s) that have conflicting RunAsUser values.
 var ErrorConflictingSecurityContexts = errors.New("pod and/or container(s) have conflicting SecurityContext.RunAsUser values")
@@ -7,6 +7,7 @@ import (
 	"k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func TestSanitizeCheckpointPod(t *testing.T) {
@@ -30,7 +31,7 @@ func TestSanitizeCheckpointPod(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:            "podname",
 					Namespace:       "podnamespace",
-					Annotations:     map[string]string{checkpointParentAnnotation: "podname"},
+					Annotations:     map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
 					OwnerReferences: []metav1.OwnerReference{{Name: "podname", Controller: &trueVar}},
 				},
 			},
@@ -48,7 +49,7 @@ func TestSanitizeCheckpointPod(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:            "podname",
 					Namespace:       "podnamespace",
-					Annotations:     map[string]string{checkpointParentAnnotation: "podname"},
+					Annotations:     map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
 					OwnerReferences: []metav1.OwnerReference{{Name: "podname", Controller: &trueVar}},
 				},
 			},
@@ -66,7 +67,7 @@ func TestSanitizeCheckpointPod(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:            "podname",
 					Namespace:       "podnamespace",
-					Annotations:     map[string]string{checkpointParentAnnotation: "podname"},
+					Annotations:     map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
 					OwnerReferences: []metav1.OwnerReference{{Name: "podname", Controller: &trueVar}},
 				},
 			},
@@ -84,11 +85,36 @@ func TestSanitizeCheckpointPod(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:            "podname",
 					Namespace:       "podnamespace",
-					Annotations:     map[string]string{checkpointParentAnnotation: "podname"},
+					Annotations:     map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
 					OwnerReferences: []metav1.OwnerReference{{Name: "podname", Controller: &trueVar}},
 				},
 			},
 		},
+		{
+			desc: "Downward API and projected volumes are converted to hostPaths",
+			pod: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "podname",
+					Namespace: "podnamespace",
+				},
+				Spec: v1.PodSpec{Volumes: []v1.Volume{
+					{Name: "podinfo", VolumeSource: v1.VolumeSource{DownwardAPI: &v1.DownwardAPIVolumeSource{}}},
+					{Name: "token", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{}}},
+				}},
+			},
+			expected: &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "podname",
+					Namespace:       "podnamespace",
+					Annotations:     map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
+					OwnerReferences: []metav1.OwnerReference{{Name: "podname", Controller: &trueVar}},
+				},
+				Spec: v1.PodSpec{Volumes: []v1.Volume{
+					{Name: "podinfo", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/checkpoint-volumes/podnamespace/podname/podinfo"}}},
+					{Name: "token", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/checkpoint-volumes/podnamespace/podname/token"}}},
+				}},
+			},
+		},
 		{
 			desc: "Labels are preserved",
 			pod: &v1.Pod{
@@ -103,7 +129,7 @@ func TestSanitizeCheckpointPod(t *testing.T) {
 					Name:            "podname",
 					Namespace:       "podnamespace",
 					Labels:          map[string]string{"foo": "bar"},
-					Annotations:     map[string]string{checkpointParentAnnotation: "podname"},
+					Annotations:     map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
 					OwnerReferences: []metav1.OwnerReference{{Name: "podname", Controller: &trueVar}},
 				},
 			},
@@ -132,7 +158,7 @@ func TestSanitizeCheckpointPod(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Name:        "podname",
 					Namespace:   "podnamespace",
-					Annotations: map[string]string{checkpointParentAnnotation: "podname"},
+					Annotations: map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
 					OwnerReferences: []metav1.OwnerReference{
 						{APIVersion: "v1", Kind: "Pod", Name: "podname", UID: "pod-uid", Controller: &trueVar},
 					},
@@ -296,6 +322,51 @@ func TestIsValidParent(t *testing.T) {
 	}
 }
 
+func TestIsValidParentSelected(t *testing.T) {
+	checkpointSelector = labels.SelectorFromSet(labels.Set{"tier": "control-plane"})
+	checkpointNamespaces = []string{"podnamespace"}
+	defer func() { checkpointSelector, checkpointNamespaces = nil, nil }()
+
+	podWithLabels := func(namespace string, l map[string]string, a map[string]string) *v1.Pod {
+		pod := podWithAnnotations(a)
+		pod.Namespace, pod.Labels = namespace, l
+		return pod
+	}
+	for _, tc := range []struct {
+		desc     string
+		pod      *v1.Pod
+		expected bool
+	}{{
+		desc:     "Selected pod",
+		pod:      podWithLabels("podnamespace", map[string]string{"tier": "control-plane"}, nil),
+		expected: true,
+	}, {
+		desc:     "Pod not selected",
+		pod:      podWithLabels("podnamespace", map[string]string{"tier": "node"}, nil),
+		expected: false,
+	}, {
+		desc:     "Selected pod in another namespace",
+		pod:      podWithLabels("other", map[string]string{"tier": "control-plane"}, nil),
+		expected: false,
+	}, {
+		desc:     "Selected static pod",
+		pod:      podWithLabels("podnamespace", map[string]string{"tier": "control-plane"}, map[string]string{podSourceAnnotation: "file"}),
+		expected: false,
+	}, {
+		desc:     "Selected checkpoint",
+		pod:      podWithLabels("podnamespace", map[string]string{"tier": "control-plane"}, map[string]string{checkpointParentAnnotation: "foo/bar"}),
+		expected: false,
+	}, {
+		desc:     "Annotated pod not selected",
+		pod:      podWithLabels("podnamespace", nil, map[string]string{shouldCheckpointAnnotation: "true"}),
+		expected: true,
+	}} {
+		if got := isValidParent(tc.pod); tc.expected != got {
+			t.Errorf("Expected: %t Got: %t For test: %s", tc.expected, got, tc.desc)
+		}
+	}
+}
+
 func TestIsCheckpoint(t *testing.T) {
 	type testCase struct {
 		desc     string
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"time"
 
@@ -20,6 +21,9 @@ type checkpoint struct {
 	pod *v1.Pod
 	// state is the current state of the checkpoint.
 	state checkpointState
+	// lastSeen is the last time the parent pod was seen by the apiserver or kubelet, or the
+	// checkpoint was first processed.
+	lastSeen time.Time
 }
 
 // String() implements fmt.Stringer.String().
@@ -168,6 +172,9 @@ func (cs *checkpoints) process(now time.Time, apiAvailable bool, localRunningPod
 
 	// Update states for all the checkpoints and compute which to start / stop / remove.
 	for name, cp := range cs.checkpoints {
+		if cp.lastSeen.IsZero() || apiParentPods[name] != nil || localParentPods[name] != nil {
+			cp.lastSeen = now
+		}
 		state := cp.state.transition(now, apiCondition{
 			apiAvailable: apiAvailable,
 			apiParent:    apiParentPods[name] != nil,
@@ -175,6 +182,13 @@ func (cs *checkpoints) process(now time.Time, apiAvailable bool, localRunningPod
 			localParent:  localParentPods[name] != nil,
 		})
 
+		// Inactive checkpoints of parents that were not seen in the retention period are removed,
+		// even if the apiserver is unavailable to confirm their deletion.
+		if checkpointRetention > 0 && state.action() == stop && now.Sub(cp.lastSeen) >= checkpointRetention {
+			glog.Infof("Retention period exceeded for checkpoint %s, last seen at %s", cp, cp.lastSeen.Format(time.RFC3339))
+			state = stateRemove{}
+		}
+
 		if state != cp.state {
 			// Apply state transition.
 			// TODO(diegs): always apply this.
@@ -203,7 +217,7 @@ func (cs *checkpoints) process(now time.Time, apiAvailable bool, localRunningPod
 }
 
 // createCheckpointsForValidParents will iterate through pods which are candidates for checkpointing, then:
-// - checkpoint any remote assets they need (e.g. secrets, configmaps)
+// - checkpoint any remote assets they need (e.g. secrets, configmaps, including those of the environment)
 // - sanitize their podSpec, removing unnecessary information
 // - store the manifest on disk in an "inactive" checkpoint location
 func (c *checkpointer) createCheckpointsForValidParents() {
@@ -222,13 +236,32 @@ func (c *checkpointer) createCheckpointsForValidParents() {
 	for _, pod := range parents {
 		id := podFullName(pod)
 
+		// Pods that repeatedly failed to be checkpointed are retried after a backoff.
+		if c.backoff.IsInBackOffSinceUpdate(id, time.Now()) {
+			glog.V(4).Infof("Not checkpointing %s for %s after failures", id, c.backoff.Get(id))
+			continue
+		}
+
 		cp := pod.DeepCopy()
 
+		// The values of the environment are read every time, since they are part of the manifest.
+		if err := c.checkpointEnv(cp); err != nil {
+			glog.Errorf("Failed to checkpoint the environment of pod %s: %v", id, err)
+			c.checkpointFailed(id)
+			continue
+		}
+
 		cp = sanitizeCheckpointPod(cp)
 
+		if dryRun {
+			glog.V(2).Infof("Dry run: not writing the checkpoint of %s", id)
+			continue
+		}
+
 		podChanged, err := writeCheckpointManifest(cp)
 		if err != nil {
 			glog.Errorf("Failed to write checkpoint for %s: %v", id, err)
+			c.checkpointFailed(id)
 			continue
 		}
 
@@ -240,6 +273,7 @@ func (c *checkpointer) createCheckpointsForValidParents() {
 				//TODO(aaron): This can end up spamming logs at times when api-server is unavailable. To reduce spam
 				//             we could only log error if api-server can't be contacted and existing secret doesn't exist.
 				glog.Errorf("Failed to checkpoint secrets for pod %s: %v", id, err)
+				c.checkpointFailed(id)
 				continue
 			}
 
@@ -248,9 +282,19 @@ func (c *checkpointer) createCheckpointsForValidParents() {
 				//TODO(aaron): This can end up spamming logs at times when api-server is unavailable. To reduce spam
 				//             we could only log error if api-server can't be contacted and existing configmap doesn't exist.
 				glog.Errorf("Failed to checkpoint configMaps for pod %s: %v", id, err)
+				c.checkpointFailed(id)
+				continue
+			}
+
+			if err := c.checkpointProjectedVolumes(pod); err != nil {
+				glog.Errorf("Failed to checkpoint volumes for pod %s: %v", id, err)
+				c.checkpointFailed(id)
 				continue
 			}
 		}
+
+		lastCheckpointTimestamp.WithLabelValues(id).SetToCurrentTime()
+		c.backoff.Reset(id)
 	}
 
 	// If the secrets/manifests were checked update the lastCheckpoint
@@ -259,25 +303,48 @@ func (c *checkpointer) createCheckpointsForValidParents() {
 	}
 }
 
+// checkpointFailed records a failure to checkpoint the pod id, backing off checkpointing it.
+func (c *checkpointer) checkpointFailed(id string) {
+	checkpointWriteFailures.WithLabelValues(id).Inc()
+	c.backoff.Next(id, time.Now())
+}
+
+// dryRunActive holds the checkpoints that would be active in a dry run, in which they aren't written
+// to the pod manifest path of the kubelet.
+var dryRunActive = map[string]bool{}
+
 func handleRemove(remove []string) {
 	for _, id := range remove {
 		glog.Infof("Removing checkpoint of: %s", id)
+		delete(dryRunActive, id)
 
 		// Remove Secrets
 		p := podFullNameToSecretPath(id)
-		if err := os.RemoveAll(p); err != nil {
+		if err := removeAll(p); err != nil {
 			glog.Errorf("Failed to remove pod secrets from %s: %s", p, err)
 		}
 
 		// Remove ConfipMaps
 		p = podFullNameToConfigMapPath(id)
-		if err := os.RemoveAll(p); err != nil {
+		if err := removeAll(p); err != nil {
 			glog.Errorf("Failed to remove pod configMaps from %s: %s", p, err)
 		}
 
+		// Remove downwardAPI and projected volumes
+		p = podFullNameToVolumePath(id)
+		if err := removeAll(p); err != nil {
+			glog.Errorf("Failed to remove pod volumes from %s: %s", p, err)
+		}
+
+		// Remove the history of the checkpoint
+		p = podFullNameToHistoryPath(id)
+		if err := removeAll(p); err != nil {
+			glog.Errorf("Failed to remove checkpoint history from %s: %s", p, err)
+		}
+
 		// Remove inactive checkpoints
 		p = podFullNameToInactiveCheckpointPath(id)
-		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		if err := removeFile(p); err != nil && !os.IsNotExist(err) {
 			glog.Errorf("Failed to remove inactive checkpoint %s: %v", p, err)
 			continue
 		}
@@ -293,7 +360,7 @@ func handleRemove(remove []string) {
 		// However, since we are not waiting for them to terminate anyway, so it's
 		// ok to just leave as is for now. We can handle this more gracefully later.
 		p = podFullNameToActiveCheckpointPath(id)
-		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		if err := removeFile(p); err != nil && !os.IsNotExist(err) {
 			glog.Errorf("Failed to remove active checkpoint %s: %v", p, err)
 			continue
 		}
@@ -303,8 +370,9 @@ func handleRemove(remove []string) {
 func handleStop(stop []string) {
 	for _, id := range stop {
 		glog.Infof("Stopping active checkpoint: %s", id)
+		delete(dryRunActive, id)
 		p := podFullNameToActiveCheckpointPath(id)
-		if err := os.Remove(p); err != nil {
+		if err := removeFile(p); err != nil {
 			if os.IsNotExist(err) { // Sanity check (it's fine - just want to surface this if it's occurring)
 				glog.Warningf("Attempted to remove active checkpoint, but manifest no longer exists: %s", p)
 			} else {
@@ -316,6 +384,15 @@ func handleStop(stop []string) {
 
 func handleStart(start []string) {
 	for _, id := range start {
+		if dryRun {
+			// The self-checkpoint is started on every loop, so it is only logged once.
+			if !dryRunActive[id] {
+				glog.Infof("Dry run: not starting checkpoint %s at %s", id, podFullNameToActiveCheckpointPath(id))
+				dryRunActive[id] = true
+			}
+			continue
+		}
+
 		src := podFullNameToInactiveCheckpointPath(id)
 		data, err := ioutil.ReadFile(src)
 		if err != nil {
@@ -329,3 +406,45 @@ func handleStart(start []string) {
 		}
 	}
 }
+
+// removeOrphans removes the secrets, configMaps, volumes and history of pods that have no checkpoint, such
+// as those left behind by a checkpointer that stopped while removing a checkpoint.
+func (cs *checkpoints) removeOrphans() {
+	known := map[string]bool{}
+	for name := range cs.checkpoints {
+		known[name] = true
+	}
+	if cs.selfCheckpoint != nil {
+		known[cs.selfCheckpoint.name] = true
+	}
+	for _, dir := range []string{checkpointSecretPath, checkpointConfigMapPath, checkpointVolumePath, checkpointHistoryPath} {
+		namespaces, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				glog.Errorf("Failed to read %s: %v", dir, err)
+			}
+			continue
+		}
+		for _, ns := range namespaces {
+			pods, err := ioutil.ReadDir(filepath.Join(dir, ns.Name()))
+			if err != nil {
+				glog.Errorf("Failed to read %s: %v", filepath.Join(dir, ns.Name()), err)
+				continue
+			}
+			for _, pod := range pods {
+				id := ns.Name() + "/" + pod.Name()
+				if known[id] {
+					continue
+				}
+				if _, err := os.Stat(podFullNameToInactiveCheckpointPath(id)); err == nil {
+					continue
+				}
+				p := filepath.Join(dir, ns.Name(), pod.Name())
+				glog.Infof("Removing %s of pod %s, which has no checkpoint", p, id)
+				if err := removeAll(p); err != nil {
+					glog.Errorf("Failed to remove %s: %v", p, err)
+				}
+			}
+		}
+	}
+}
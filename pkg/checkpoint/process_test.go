@@ -346,3 +346,57 @@ func TestProcess(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessRetention(t *testing.T) {
+	checkpointRetention = time.Minute
+	defer func() { checkpointRetention = 0 }()
+
+	cp := CheckpointerPod{
+		NodeName:     "mynode",
+		PodName:      "pod-checkpointer",
+		PodNamespace: "kube-system",
+	}
+	for _, tc := range []struct {
+		desc         string
+		localParents map[string]*v1.Pod
+		expectRemove []string
+	}{{
+		desc:         "Inactive checkpoint without parent: should remove after retention",
+		expectRemove: []string{"AA"},
+	}, {
+		desc:         "Inactive checkpoint with kubelet parent: no change",
+		localParents: map[string]*v1.Pod{"AA": {}},
+	}} {
+		// The apiserver is unavailable and a pod of the checkpoint is running, so it stays inactive.
+		localRunning := map[string]*v1.Pod{"AA": {}}
+		inactiveCheckpoints := map[string]*v1.Pod{"AA": {}}
+		c := checkpoints{}
+		var gotRemove []string
+		start := time.Unix(0, 0)
+		for now := start; !now.After(start.Add(checkpointRetention)); now = now.Add(checkpointRetention / 2) {
+			c.update(localRunning, tc.localParents, nil, nil, inactiveCheckpoints, cp)
+			_, _, remove := c.process(now, false, localRunning, tc.localParents, nil)
+			gotRemove = append(gotRemove, remove...)
+		}
+		if !reflect.DeepEqual(tc.expectRemove, gotRemove) {
+			t.Errorf("For test: %s\nExpected remove: %s Got: %s", tc.desc, tc.expectRemove, gotRemove)
+		}
+	}
+}
+
+func TestHandleDryRun(t *testing.T) {
+	dryRun = true
+	defer func() { dryRun = false }()
+	dryRunActive = map[string]bool{}
+
+	handleStart([]string{"kube-system/pod-checkpointer", "kube-system/kube-apiserver"})
+	handleStart([]string{"kube-system/pod-checkpointer"})
+	if expected := map[string]bool{"kube-system/pod-checkpointer": true, "kube-system/kube-apiserver": true}; !reflect.DeepEqual(expected, dryRunActive) {
+		t.Errorf("Expected dry run active checkpoints %v, got %v", expected, dryRunActive)
+	}
+	handleStop([]string{"kube-system/kube-apiserver"})
+	handleRemove([]string{"kube-system/pod-checkpointer"})
+	if len(dryRunActive) != 0 {
+		t.Errorf("Expected no dry run active checkpoints, got %v", dryRunActive)
+	}
+}
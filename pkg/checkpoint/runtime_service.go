@@ -2,6 +2,9 @@ package checkpoint
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -9,6 +12,7 @@ import (
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 
+	criv1 "github.com/kubernetes-sigs/bootkube/pkg/checkpoint/cri/v1"
 	"github.com/kubernetes-sigs/bootkube/pkg/checkpoint/cri/v1alpha1"
 	"github.com/kubernetes-sigs/bootkube/pkg/checkpoint/cri/v1alpha2"
 	"github.com/kubernetes-sigs/bootkube/pkg/checkpoint/internal"
@@ -23,13 +27,34 @@ const (
 	kubernetesContainerTypeLabel = "io.kubernetes.container.type"
 )
 
+// defaultRuntimeEndpoints are the CRI endpoints of dockershim, containerd and CRI-O, in the order
+// they are tried if no endpoint is set.
+var defaultRuntimeEndpoints = []string{
+	"unix:///var/run/dockershim.sock",
+	"unix:///var/run/containerd/containerd.sock",
+	"unix:///var/run/crio/crio.sock",
+}
+
+// criRuntimeService is the part of the v1 and v1alpha2 runtime services the checkpointer uses.
+type criRuntimeService interface {
+	ListPodSandbox(ctx context.Context, in *v1alpha2.ListPodSandboxRequest, opts ...grpc.CallOption) (*v1alpha2.ListPodSandboxResponse, error)
+	ListContainers(ctx context.Context, in *v1alpha2.ListContainersRequest, opts ...grpc.CallOption) (*v1alpha2.ListContainersResponse, error)
+}
+
 type remoteRuntimeService struct {
 	timeout        time.Duration
+	v1Client       criv1.RuntimeServiceClient
 	v1alpha1Client v1alpha1.RuntimeServiceClient
 	v1alpha2Client v1alpha2.RuntimeServiceClient
 }
 
 func newRemoteRuntimeService(endpoint string, connectionTimeout time.Duration) (*remoteRuntimeService, error) {
+	if endpoint == "" {
+		var err error
+		if endpoint, err = detectRuntimeEndpoint(); err != nil {
+			return nil, err
+		}
+	}
 	glog.Infof("Connecting to runtime service %s", endpoint)
 	addr, dialer, err := internal.GetAddressAndDialer(endpoint)
 	if err != nil {
@@ -44,11 +69,38 @@ func newRemoteRuntimeService(endpoint string, connectionTimeout time.Duration) (
 
 	return &remoteRuntimeService{
 		timeout:        connectionTimeout,
+		v1Client:       criv1.NewRuntimeServiceClient(conn),
 		v1alpha1Client: v1alpha1.NewRuntimeServiceClient(conn),
 		v1alpha2Client: v1alpha2.NewRuntimeServiceClient(conn),
 	}, nil
 }
 
+// detectRuntimeEndpoint returns the first of the defaultRuntimeEndpoints with a socket, so that the
+// checkpointer runs with any of these container runtimes.
+func detectRuntimeEndpoint() (string, error) {
+	for _, endpoint := range defaultRuntimeEndpoints {
+		if fi, err := os.Stat(strings.TrimPrefix(endpoint, "unix://")); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return endpoint, nil
+		}
+	}
+	return "", fmt.Errorf("no container runtime socket at %s", strings.Join(defaultRuntimeEndpoints, ", "))
+}
+
+// runtimeService returns the runtime service of the newest CRI version the runtime serves, v1 or
+// v1alpha2, or nil if it only serves v1alpha1.
+func (r *remoteRuntimeService) runtimeService(ctx context.Context) (criRuntimeService, error) {
+	if _, err := r.v1Client.Version(ctx, &v1alpha2.VersionRequest{}); err == nil {
+		return r.v1Client, nil
+	}
+	if _, err := r.v1alpha2Client.Version(ctx, &v1alpha2.VersionRequest{}); err == nil {
+		return r.v1alpha2Client, nil
+	}
+	if _, err := r.v1alpha1Client.Version(ctx, &v1alpha1.VersionRequest{}); err != nil {
+		return nil, fmt.Errorf("runtime service serves none of the CRI versions v1, v1alpha2 and v1alpha1: %v", err)
+	}
+	return nil, nil
+}
+
 // localRunningPods uses the CRI shim to retrieve the local container runtime pod state
 func (r *remoteRuntimeService) localRunningPods() map[string]*v1.Pod {
 	pods := make(map[string]*v1.Pod)
@@ -57,6 +109,7 @@ func (r *remoteRuntimeService) localRunningPods() map[string]*v1.Pod {
 	sandboxes, err := r.getRunningKubeletSandboxes()
 	if err != nil {
 		glog.Errorf("failed to list running sandboxes: %v", err)
+		health.recordSync("cri", err)
 		return nil
 	}
 
@@ -76,6 +129,7 @@ func (r *remoteRuntimeService) localRunningPods() map[string]*v1.Pod {
 	containers, err := r.getRunningKubeletContainers()
 	if err != nil {
 		glog.Errorf("failed to list running containers: %v", err)
+		health.recordSync("cri", err)
 		return nil
 	}
 
@@ -93,6 +147,7 @@ func (r *remoteRuntimeService) localRunningPods() map[string]*v1.Pod {
 		}
 	}
 
+	health.recordSync("cri", nil)
 	return pods
 }
 
@@ -111,8 +166,12 @@ func (r *remoteRuntimeService) getRunningKubeletContainers() ([]criContainer, er
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
+	service, err := r.runtimeService(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var containers []criContainer
-	if _, err := r.v1alpha1Client.Version(ctx, &v1alpha1.VersionRequest{}); err == nil {
+	if service == nil {
 		resp, err := r.v1alpha1Client.ListContainers(ctx, &v1alpha1.ListContainersRequest{
 			Filter: &v1alpha1.ContainerFilter{
 				State: &v1alpha1.ContainerStateValue{
@@ -135,8 +194,7 @@ func (r *remoteRuntimeService) getRunningKubeletContainers() ([]criContainer, er
 		return containers, nil
 	}
 
-	// Try v1alpha2
-	resp, err := r.v1alpha2Client.ListContainers(ctx, &v1alpha2.ListContainersRequest{
+	resp, err := service.ListContainers(ctx, &v1alpha2.ListContainersRequest{
 		Filter: &v1alpha2.ContainerFilter{
 			State: &v1alpha2.ContainerStateValue{
 				// Filter out non-running containers
@@ -162,8 +220,12 @@ func (r *remoteRuntimeService) getRunningKubeletSandboxes() ([]criSandbox, error
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
+	service, err := r.runtimeService(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var sandboxes []criSandbox
-	if _, err := r.v1alpha1Client.Version(ctx, &v1alpha1.VersionRequest{}); err == nil {
+	if service == nil {
 		resp, err := r.v1alpha1Client.ListPodSandbox(ctx, &v1alpha1.ListPodSandboxRequest{
 			Filter: &v1alpha1.PodSandboxFilter{
 				// Filter out non-running sandboxes
@@ -190,7 +252,7 @@ func (r *remoteRuntimeService) getRunningKubeletSandboxes() ([]criSandbox, error
 		}
 		return sandboxes, nil
 	}
-	resp, err := r.v1alpha2Client.ListPodSandbox(ctx, &v1alpha2.ListPodSandboxRequest{
+	resp, err := service.ListPodSandbox(ctx, &v1alpha2.ListPodSandboxRequest{
 		Filter: &v1alpha2.PodSandboxFilter{
 			// Filter out non-running sandboxes
 			State: &v1alpha2.PodSandboxStateValue{
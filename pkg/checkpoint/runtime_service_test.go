@@ -0,0 +1,106 @@
+package checkpoint
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/kubernetes-sigs/bootkube/pkg/checkpoint/cri/v1alpha2"
+)
+
+// v1Runtime serves the v1 runtime service of a container runtime like containerd, which does not
+// serve v1alpha2.
+func v1Runtime(t *testing.T, socket string, sandboxes []*v1alpha2.PodSandbox, containers []*v1alpha2.Container) *grpc.Server {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(req interface{}, resp interface{}) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+		return func(_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "runtime.v1.RuntimeService",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "Version", Handler: handler(&v1alpha2.VersionRequest{}, &v1alpha2.VersionResponse{RuntimeApiVersion: "v1"})},
+			{MethodName: "ListPodSandbox", Handler: handler(&v1alpha2.ListPodSandboxRequest{}, &v1alpha2.ListPodSandboxResponse{Items: sandboxes})},
+			{MethodName: "ListContainers", Handler: handler(&v1alpha2.ListContainersRequest{}, &v1alpha2.ListContainersResponse{Containers: containers})},
+		},
+	}, struct{}{})
+	go s.Serve(l)
+	return s
+}
+
+func TestLocalRunningPodsV1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "containerd.sock")
+	s := v1Runtime(t, socket, []*v1alpha2.PodSandbox{{
+		Metadata: &v1alpha2.PodSandboxMetadata{Name: "kube-apiserver-abcde", Namespace: "kube-system", Uid: "uid-1"},
+	}}, []*v1alpha2.Container{{
+		Metadata: &v1alpha2.ContainerMetadata{Name: "kube-scheduler"},
+		Labels: map[string]string{
+			kubernetesPodNameLabel:      "kube-scheduler-abcde",
+			kubernetesPodNamespaceLabel: "kube-system",
+			kubernetesPodUIDLabel:       "uid-2",
+		},
+	}})
+	defer s.Stop()
+
+	defer func(endpoints []string) { defaultRuntimeEndpoints = endpoints }(defaultRuntimeEndpoints)
+	defaultRuntimeEndpoints = []string{"unix://" + filepath.Join(dir, "dockershim.sock"), "unix://" + socket}
+	r, err := newRemoteRuntimeService("", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods := r.localRunningPods()
+	if len(pods) != 2 {
+		t.Fatalf("got pods %v, want kube-apiserver-abcde and kube-scheduler-abcde", pods)
+	}
+	for name, uid := range map[string]string{"kube-system/kube-apiserver-abcde": "uid-1", "kube-system/kube-scheduler-abcde": "uid-2"} {
+		if p := pods[name]; p == nil || string(p.UID) != uid {
+			t.Errorf("got pod %s %v, want UID %s", name, p, uid)
+		}
+	}
+}
+
+func TestDetectRuntimeEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(endpoints []string) { defaultRuntimeEndpoints = endpoints }(defaultRuntimeEndpoints)
+	defaultRuntimeEndpoints = []string{"unix://" + filepath.Join(dir, "dockershim.sock"), "unix://" + filepath.Join(dir, "crio.sock")}
+	if _, err := detectRuntimeEndpoint(); err == nil {
+		t.Error("expected an error without a runtime socket")
+	}
+
+	// Files other than sockets are not runtime endpoints.
+	if err := ioutil.WriteFile(filepath.Join(dir, "dockershim.sock"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(dir, "crio.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if endpoint, err := detectRuntimeEndpoint(); err != nil || endpoint != defaultRuntimeEndpoints[1] {
+		t.Errorf("detectRuntimeEndpoint() = %q, %v, want %q", endpoint, err, defaultRuntimeEndpoints[1])
+	}
+}
@@ -0,0 +1,80 @@
+package checkpoint
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	checkpointVersionAnnotation = "checkpointer.alpha.coreos.com/checkpoint-version"
+
+	// checkpointVersion is the version of the checkpoints written by this checkpointer. Whenever the
+	// format of checkpoints changes it is incremented, with a migration from the previous version.
+	checkpointVersion = 1
+)
+
+// checkpointMigrations migrate a checkpoint from the version of their index to the next version,
+// in place.
+var checkpointMigrations = []func(*corev1.Pod) error{
+	// Version 0 checkpoints set no version. They are only rewritten, readable by root alone, since
+	// they may hold the values of Secrets of the environment of the pod.
+	func(*corev1.Pod) error { return nil },
+}
+
+// errNewerCheckpoint is returned for checkpoints written by a newer checkpointer, which are used
+// as they are.
+type errNewerCheckpoint struct {
+	version int
+}
+
+func (e errNewerCheckpoint) Error() string {
+	return fmt.Sprintf("checkpoint version %d is newer than version %d of this checkpointer", e.version, checkpointVersion)
+}
+
+// getCheckpointVersion returns the version of the checkpoint, 0 if it sets none.
+func getCheckpointVersion(cp *corev1.Pod) (int, error) {
+	v, ok := cp.Annotations[checkpointVersionAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid checkpoint version %q", v)
+	}
+	return version, nil
+}
+
+// setCheckpointVersion sets the version of the checkpoint to the current version.
+func setCheckpointVersion(cp *corev1.Pod) {
+	if cp.Annotations == nil {
+		cp.Annotations = make(map[string]string)
+	}
+	cp.Annotations[checkpointVersionAnnotation] = strconv.Itoa(checkpointVersion)
+}
+
+// migrateCheckpoint migrates the checkpoint to the current version in place, returning whether it
+// was migrated. The checkpoint is unchanged if any migration fails.
+func migrateCheckpoint(cp *corev1.Pod) (bool, error) {
+	version, err := getCheckpointVersion(cp)
+	if err != nil {
+		return false, err
+	}
+	if version > checkpointVersion {
+		return false, errNewerCheckpoint{version: version}
+	}
+	if version == checkpointVersion {
+		return false, nil
+	}
+
+	migrated := cp.DeepCopy()
+	for ; version < checkpointVersion; version++ {
+		if err := checkpointMigrations[version](migrated); err != nil {
+			return false, fmt.Errorf("failed to migrate checkpoint from version %d: %v", version, err)
+		}
+	}
+	setCheckpointVersion(migrated)
+	*cp = *migrated
+	return true, nil
+}
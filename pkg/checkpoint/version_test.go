@@ -0,0 +1,87 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointMigrations(t *testing.T) {
+	if len(checkpointMigrations) != checkpointVersion {
+		t.Errorf("Expected a migration for each of the %d versions before version %d, got %d", checkpointVersion, checkpointVersion, len(checkpointMigrations))
+	}
+}
+
+func TestMigrateCheckpoint(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		annotations   map[string]string
+		expectMigrate bool
+		expectErr     bool
+		expectVersion string
+	}{{
+		desc:          "Unversioned checkpoint: should migrate",
+		annotations:   map[string]string{checkpointParentAnnotation: "podname"},
+		expectMigrate: true,
+		expectVersion: "1",
+	}, {
+		desc:          "Current checkpoint: no change",
+		annotations:   map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "1"},
+		expectVersion: "1",
+	}, {
+		desc:          "Newer checkpoint: unchanged",
+		annotations:   map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "2"},
+		expectErr:     true,
+		expectVersion: "2",
+	}, {
+		desc:          "Invalid version: unchanged",
+		annotations:   map[string]string{checkpointParentAnnotation: "podname", checkpointVersionAnnotation: "v1"},
+		expectErr:     true,
+		expectVersion: "v1",
+	}} {
+		cp := podWithAnnotations(tc.annotations)
+		migrated, err := migrateCheckpoint(cp)
+		if migrated != tc.expectMigrate || (err != nil) != tc.expectErr || cp.Annotations[checkpointVersionAnnotation] != tc.expectVersion {
+			t.Errorf("For test: %s\nExpected migrated: %t error: %t version: %q\nGot migrated: %t error: %v version: %q",
+				tc.desc, tc.expectMigrate, tc.expectErr, tc.expectVersion, migrated, err, cp.Annotations[checkpointVersionAnnotation])
+		}
+	}
+}
+
+func TestGetFileCheckpointsMigrates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := filepath.Join(dir, "kube-system-kube-apiserver.json")
+	if err := ioutil.WriteFile(old, []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"kube-apiserver","namespace":"kube-system","annotations":{"checkpointer.alpha.coreos.com/checkpoint-of":"kube-apiserver"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newer := filepath.Join(dir, "kube-system-kube-scheduler.json")
+	newerData := []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"kube-scheduler","namespace":"kube-system","annotations":{"checkpointer.alpha.coreos.com/checkpoint-of":"kube-scheduler","checkpointer.alpha.coreos.com/checkpoint-version":"99"}}}`)
+	if err := ioutil.WriteFile(newer, newerData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints := getFileCheckpoints(dir)
+	if len(checkpoints) != 2 {
+		t.Fatalf("Expected 2 checkpoints, got %d", len(checkpoints))
+	}
+	if v := checkpoints["kube-system/kube-apiserver"].Annotations[checkpointVersionAnnotation]; v != "1" {
+		t.Errorf("Expected the loaded checkpoint to be migrated to version 1, got %q", v)
+	}
+
+	reread := getFileCheckpoints(dir)
+	if v := reread["kube-system/kube-apiserver"].Annotations[checkpointVersionAnnotation]; v != "1" {
+		t.Errorf("Expected the migrated checkpoint to be written, got version %q", v)
+	}
+	if fi, err := os.Stat(old); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected the migrated checkpoint to be readable by root only, got %v: %v", fi.Mode(), err)
+	}
+	if b, err := ioutil.ReadFile(newer); err != nil || string(b) != string(newerData) {
+		t.Errorf("Expected the newer checkpoint to be unchanged, got %s: %v", b, err)
+	}
+}
@@ -0,0 +1,288 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultTokenExpirationSeconds is the expiration of service account tokens that don't set one, as
+// for the kubelet.
+const defaultTokenExpirationSeconds = 60 * 60
+
+// checkpointProjectedVolumes ensures that the files of all pod downwardAPI and projected volumes are
+// checkpointed locally, which converts them to hostpaths. Their values are those of the parent pod,
+// and service account tokens are requested for the service account of the pod.
+func (c *checkpointer) checkpointProjectedVolumes(pod *corev1.Pod) error {
+	uid, gid, err := podUserAndGroup(pod)
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint volumes for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+
+	for _, v := range pod.Spec.Volumes {
+		var files map[string][]byte
+		switch {
+		case v.DownwardAPI != nil:
+			files, err = downwardAPIFiles(pod, v.DownwardAPI.Items)
+		case v.Projected != nil:
+			files, err = c.projectedFiles(pod, v.Projected.Sources)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to checkpoint volume %s for pod %s/%s: %v", v.Name, pod.Namespace, pod.Name, err)
+		}
+		if err := writeVolumeFiles(volumePath(pod.Namespace, pod.Name, v.Name), files, uid, gid); err != nil {
+			return fmt.Errorf("failed to checkpoint volume %s for pod %s/%s: %v", v.Name, pod.Namespace, pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// projectedFiles returns the contents of the files of a projected volume by path.
+func (c *checkpointer) projectedFiles(pod *corev1.Pod, sources []corev1.VolumeProjection) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, s := range sources {
+		switch {
+		case s.Secret != nil:
+			secret, err := c.apiserver.CoreV1().Secrets(pod.Namespace).Get(context.TODO(), s.Secret.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) && s.Secret.Optional != nil && *s.Secret.Optional {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to retrieve secret %s/%s: %v", pod.Namespace, s.Secret.Name, err)
+			}
+			if err := projectKeys(files, secret.Data, s.Secret.Items, s.Secret.Optional); err != nil {
+				return nil, fmt.Errorf("secret %s/%s: %v", pod.Namespace, s.Secret.Name, err)
+			}
+		case s.ConfigMap != nil:
+			configMap, err := c.apiserver.CoreV1().ConfigMaps(pod.Namespace).Get(context.TODO(), s.ConfigMap.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) && s.ConfigMap.Optional != nil && *s.ConfigMap.Optional {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to retrieve configMap %s/%s: %v", pod.Namespace, s.ConfigMap.Name, err)
+			}
+			data := map[string][]byte{}
+			for k, v := range configMap.Data {
+				data[k] = []byte(v)
+			}
+			for k, v := range configMap.BinaryData {
+				data[k] = v
+			}
+			if err := projectKeys(files, data, s.ConfigMap.Items, s.ConfigMap.Optional); err != nil {
+				return nil, fmt.Errorf("configMap %s/%s: %v", pod.Namespace, s.ConfigMap.Name, err)
+			}
+		case s.DownwardAPI != nil:
+			downward, err := downwardAPIFiles(pod, s.DownwardAPI.Items)
+			if err != nil {
+				return nil, err
+			}
+			for p, d := range downward {
+				files[p] = d
+			}
+		case s.ServiceAccountToken != nil:
+			token, err := c.serviceAccountToken(pod, s.ServiceAccountToken)
+			if err != nil {
+				return nil, err
+			}
+			files[s.ServiceAccountToken.Path] = []byte(token)
+		}
+	}
+	return files, nil
+}
+
+// projectKeys adds the data of a Secret or ConfigMap to files, by key or at the paths of items.
+func projectKeys(files, data map[string][]byte, items []corev1.KeyToPath, optional *bool) error {
+	if len(items) == 0 {
+		for k, v := range data {
+			files[k] = v
+		}
+		return nil
+	}
+	for _, item := range items {
+		v, ok := data[item.Key]
+		if !ok {
+			if optional != nil && *optional {
+				continue
+			}
+			return fmt.Errorf("no key %s", item.Key)
+		}
+		files[item.Path] = v
+	}
+	return nil
+}
+
+// serviceAccountToken requests a token of the service account of the pod. It isn't bound to the
+// parent pod, since the checkpoint must run while the parent is gone.
+func (c *checkpointer) serviceAccountToken(pod *corev1.Pod, p *corev1.ServiceAccountTokenProjection) (string, error) {
+	serviceAccount := pod.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	expirationSeconds := int64(defaultTokenExpirationSeconds)
+	if p.ExpirationSeconds != nil {
+		expirationSeconds = *p.ExpirationSeconds
+	}
+	req := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	if p.Audience != "" {
+		req.Spec.Audiences = []string{p.Audience}
+	}
+	resp, err := c.apiserver.CoreV1().ServiceAccounts(pod.Namespace).CreateToken(context.TODO(), serviceAccount, req, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to request a token of service account %s/%s: %v", pod.Namespace, serviceAccount, err)
+	}
+	return resp.Status.Token, nil
+}
+
+// downwardAPIFiles returns the contents of the files of downward API items by path, with the
+// values of the pod.
+func downwardAPIFiles(pod *corev1.Pod, items []corev1.DownwardAPIVolumeFile) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, item := range items {
+		var value string
+		var err error
+		switch {
+		case item.FieldRef != nil:
+			value, err = podFieldValue(pod, item.FieldRef.FieldPath)
+		case item.ResourceFieldRef != nil:
+			value, err = containerResourceValue(pod, item.ResourceFieldRef)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", item.Path, err)
+		}
+		files[item.Path] = []byte(value)
+	}
+	return files, nil
+}
+
+// podFieldValue returns the value of a field of the pod supported by downward API volumes.
+func podFieldValue(pod *corev1.Pod, fieldPath string) (string, error) {
+	switch fieldPath {
+	case "metadata.name":
+		return pod.Name, nil
+	case "metadata.namespace":
+		return pod.Namespace, nil
+	case "metadata.uid":
+		return string(pod.UID), nil
+	case "metadata.labels":
+		return formatMap(pod.Labels), nil
+	case "metadata.annotations":
+		return formatMap(pod.Annotations), nil
+	}
+	for prefix, m := range map[string]map[string]string{"metadata.labels": pod.Labels, "metadata.annotations": pod.Annotations} {
+		if strings.HasPrefix(fieldPath, prefix+"['") && strings.HasSuffix(fieldPath, "']") {
+			return m[strings.TrimSuffix(strings.TrimPrefix(fieldPath, prefix+"['"), "']")], nil
+		}
+	}
+	return "", fmt.Errorf("unsupported field path %s", fieldPath)
+}
+
+// formatMap formats labels or annotations like the kubelet, one key="value" per line.
+func formatMap(m map[string]string) string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%v=%q\n", k, m[k])
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// containerResourceValue returns the value of a resource of a container of the pod, rounded up to
+// the divisor. Limits must be set, since the node allocatable the kubelet defaults to is unknown.
+func containerResourceValue(pod *corev1.Pod, ref *corev1.ResourceFieldSelector) (string, error) {
+	var container *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == ref.ContainerName || (ref.ContainerName == "" && len(pod.Spec.Containers) == 1) {
+			container = &pod.Spec.Containers[i]
+		}
+	}
+	if container == nil {
+		return "", fmt.Errorf("no container %q", ref.ContainerName)
+	}
+	var resources corev1.ResourceList
+	var name string
+	switch {
+	case strings.HasPrefix(ref.Resource, "limits."):
+		resources, name = container.Resources.Limits, strings.TrimPrefix(ref.Resource, "limits.")
+	case strings.HasPrefix(ref.Resource, "requests."):
+		resources, name = container.Resources.Requests, strings.TrimPrefix(ref.Resource, "requests.")
+	default:
+		return "", fmt.Errorf("unsupported resource %s", ref.Resource)
+	}
+	q, ok := resources[corev1.ResourceName(name)]
+	if !ok && strings.HasPrefix(ref.Resource, "limits.") {
+		return "", fmt.Errorf("container %s has no %s", container.Name, ref.Resource)
+	}
+	divisor := ref.Divisor
+	if divisor.IsZero() {
+		divisor = resource.MustParse("1")
+	}
+	return fmt.Sprintf("%d", int64(math.Ceil(float64(q.MilliValue())/float64(divisor.MilliValue())))), nil
+}
+
+// writeVolumeFiles writes the files of a volume below basePath, then removes any other files left
+// by earlier versions of it. The files are replaced in place, since an active checkpoint may be
+// reading them.
+func writeVolumeFiles(basePath string, files map[string][]byte, uid, gid int) error {
+	dirs := []string{basePath}
+	for p := range files {
+		dirs = append(dirs, filepath.Dir(filepath.Join(basePath, p)))
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create volume checkpoint path %s: %v", dir, err)
+		}
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return fmt.Errorf("failed to chown volume checkpoint path %s: %v", dir, err)
+		}
+	}
+	for p, d := range files {
+		if err := writeAndAtomicRename(filepath.Join(basePath, p), d, uid, gid, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %v", p, err)
+		}
+	}
+	return filepath.Walk(basePath, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(basePath, p)
+		if err != nil {
+			return err
+		}
+		if _, ok := files[rel]; !ok {
+			return os.Remove(p)
+		}
+		return nil
+	})
+}
+
+func volumePath(namespace, podName, volumeName string) string {
+	return filepath.Join(checkpointVolumePath, namespace, podName, volumeName)
+}
+
+func podFullNameToVolumePath(id string) string {
+	namespace, podname := path.Split(id)
+	return filepath.Join(checkpointVolumePath, namespace, podname)
+}
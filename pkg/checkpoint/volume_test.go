@@ -0,0 +1,117 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestProjectedFiles(t *testing.T) {
+	optional := true
+	expiration := int64(600)
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "kube-system"},
+			Data:       map[string]string{"ca.crt": "ca", "other": "other"},
+		},
+	)
+	var tokenRequest *authenticationv1.TokenRequest
+	client.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenRequest = action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenRequest)
+		return true, &authenticationv1.TokenRequest{Status: authenticationv1.TokenRequestStatus{Token: "token"}}, nil
+	})
+	c := &checkpointer{apiserver: client}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kube-controller-manager",
+			Namespace: "kube-system",
+			UID:       "uid",
+			Labels:    map[string]string{"tier": "control-plane", "k8s-app": "kube-controller-manager"},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "kube-controller-manager",
+			Containers: []corev1.Container{{
+				Name: "kube-controller-manager",
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+			}},
+		},
+	}
+
+	files, err := c.projectedFiles(pod, []corev1.VolumeProjection{
+		{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token", Audience: "api", ExpirationSeconds: &expiration}},
+		{ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "kube-root-ca.crt"},
+			Items:                []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+		}},
+		{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Optional: &optional}},
+		{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{
+			{Path: "namespace", FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+			{Path: "labels", FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels"}},
+			{Path: "meta/tier", FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['tier']"}},
+			{Path: "memory", ResourceFieldRef: &corev1.ResourceFieldSelector{
+				ContainerName: "kube-controller-manager", Resource: "limits.memory", Divisor: resource.MustParse("1Mi"),
+			}},
+			{Path: "cpu", ResourceFieldRef: &corev1.ResourceFieldSelector{
+				ContainerName: "kube-controller-manager", Resource: "requests.cpu",
+			}},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("projectedFiles() failed: %v", err)
+	}
+	expected := map[string][]byte{
+		"token":     []byte("token"),
+		"ca.crt":    []byte("ca"),
+		"namespace": []byte("kube-system"),
+		"labels":    []byte("k8s-app=\"kube-controller-manager\"\ntier=\"control-plane\""),
+		"meta/tier": []byte("control-plane"),
+		"memory":    []byte("1024"),
+		"cpu":       []byte("0"),
+	}
+	if !reflect.DeepEqual(expected, files) {
+		t.Errorf("Expected files:\n%q\nGot:\n%q", expected, files)
+	}
+	if tokenRequest == nil || !reflect.DeepEqual(tokenRequest.Spec.Audiences, []string{"api"}) || *tokenRequest.Spec.ExpirationSeconds != expiration {
+		t.Errorf("Unexpected token request: %+v", tokenRequest)
+	}
+
+	if _, err := c.projectedFiles(pod, []corev1.VolumeProjection{{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{
+		{Path: "cpu", ResourceFieldRef: &corev1.ResourceFieldSelector{ContainerName: "kube-controller-manager", Resource: "limits.cpu"}},
+	}}}}); err == nil {
+		t.Errorf("Expected an error for a limit that isn't set")
+	}
+}
+
+func TestWriteVolumeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if err := writeVolumeFiles(dir, map[string][]byte{"token": []byte("old"), "meta/labels": []byte("labels")}, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeVolumeFiles(dir, map[string][]byte{"token": []byte("new")}, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "token")); err != nil || string(b) != "new" {
+		t.Errorf("Expected the token to be replaced, got %q: %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "meta/labels")); !os.IsNotExist(err) {
+		t.Errorf("Expected the file of the earlier version to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// The file system operations of writeAndAtomicRename, replaced by tests to simulate crashes.
+var (
+	syncFile   = (*os.File).Sync
+	renameFile = os.Rename
+	syncDir    = fsyncDir
+)
+
+// writeAndAtomicRename writes data to path, readable by uid and gid with perm, so that path holds
+// either its previous contents or data even if the node crashes meanwhile. The data is written to a
+// temporary file that is synced before it is renamed to path, then the directory is synced so that
+// the rename is durable. Otherwise the kubelet could be left a truncated static pod manifest.
+func writeAndAtomicRename(path string, data []byte, uid, gid int, perm os.FileMode) error {
+	if dryRun {
+		glog.Infof("Dry run: not writing %s", path)
+		return nil
+	}
+
+	// Ensure that the temporary file is on the same filesystem so that os.Rename() does not error.
+	// Temporary files start with a "." so that they aren't read as checkpoints or static pods.
+	tmpfile, err := ioutil.TempFile(filepath.Dir(path), ".")
+	if err != nil {
+		return err
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			tmpfile.Close()
+			os.Remove(tmpfile.Name())
+		}
+	}()
+
+	if _, err := tmpfile.Write(data); err != nil {
+		return err
+	}
+	if err := tmpfile.Chmod(perm); err != nil {
+		return err
+	}
+	// The owner is set before the rename, so that path is never readable by the wrong user.
+	if err := tmpfile.Chown(uid, gid); err != nil {
+		return err
+	}
+	if err := syncFile(tmpfile); err != nil {
+		return err
+	}
+	if err := tmpfile.Close(); err != nil {
+		return err
+	}
+	if err := renameFile(tmpfile.Name(), path); err != nil {
+		return err
+	}
+	renamed = true
+	return syncDir(filepath.Dir(path))
+}
+
+// removeFile removes the file at path, unless this is a dry run.
+func removeFile(path string) error {
+	if dryRun {
+		glog.Infof("Dry run: not removing %s", path)
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// removeAll removes path and its children, unless this is a dry run.
+func removeAll(path string) error {
+	if dryRun {
+		glog.Infof("Dry run: not removing %s", path)
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
+// fsyncDir syncs the directory dir, persisting the files created, renamed or removed in it.
+func fsyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,137 @@
+package checkpoint
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// stubWriteOps replaces the file system operations of writeAndAtomicRename with ones that record
+// their order and fail at the step fail, returning a function restoring them.
+func stubWriteOps(ops *[]string, fail string) func() {
+	origSyncFile, origRenameFile, origSyncDir := syncFile, renameFile, syncDir
+	step := func(name string, op func() error) error {
+		*ops = append(*ops, name)
+		if name == fail {
+			return errors.New("crash")
+		}
+		return op()
+	}
+	syncFile = func(f *os.File) error { return step("sync", func() error { return origSyncFile(f) }) }
+	renameFile = func(from, to string) error { return step("rename", func() error { return origRenameFile(from, to) }) }
+	syncDir = func(dir string) error { return step("syncdir", func() error { return origSyncDir(dir) }) }
+	return func() {
+		syncFile, renameFile, syncDir = origSyncFile, origRenameFile, origSyncDir
+	}
+}
+
+func TestWriteAndAtomicRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kube-system-kube-apiserver.json")
+
+	var ops []string
+	defer stubWriteOps(&ops, "")()
+	if err := writeAndAtomicRename(path, []byte("new"), os.Getuid(), os.Getgid(), 0600); err != nil {
+		t.Fatalf("writeAndAtomicRename() failed: %v", err)
+	}
+	// The data must be synced before the rename makes it visible, and the rename synced after.
+	if expected := []string{"sync", "rename", "syncdir"}; !reflect.DeepEqual(expected, ops) {
+		t.Errorf("Expected operations %v, got %v", expected, ops)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "new" {
+		t.Errorf("Expected %s to be written, got %q: %v", path, b, err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected %s to have mode 0600, got %v: %v", path, fi, err)
+	}
+}
+
+func TestWriteAndAtomicRenameCrash(t *testing.T) {
+	for _, tc := range []struct {
+		fail     string
+		expected string
+	}{
+		{fail: "sync", expected: "old"},
+		{fail: "rename", expected: "old"},
+		// The rename happened, but may not be durable.
+		{fail: "syncdir", expected: "new"},
+	} {
+		t.Run(tc.fail, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "checkpoint-write")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "kube-system-kube-apiserver.json")
+			if err := ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var ops []string
+			defer stubWriteOps(&ops, tc.fail)()
+			if err := writeAndAtomicRename(path, []byte("new"), os.Getuid(), os.Getgid(), 0600); err == nil {
+				t.Errorf("Expected an error when %s fails", tc.fail)
+			}
+			if b, err := ioutil.ReadFile(path); err != nil || string(b) != tc.expected {
+				t.Errorf("Expected %s to hold %q, got %q: %v", path, tc.expected, b, err)
+			}
+			// No temporary files are left behind, where they would be read as secrets or configMaps.
+			fi, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fi) != 1 {
+				var names []string
+				for _, f := range fi {
+					names = append(names, f.Name())
+				}
+				t.Errorf("Expected only %s to be left, got %v", path, names)
+			}
+		})
+	}
+}
+
+func TestDryRunWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint-write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, "existing")
+	if err := os.MkdirAll(existing, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(existing, "file"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun = true
+	defer func() { dryRun = false }()
+	path := filepath.Join(dir, "kube-system-kube-apiserver.json")
+	if err := writeAndAtomicRename(path, []byte("new"), os.Getuid(), os.Getgid(), 0600); err != nil {
+		t.Errorf("writeAndAtomicRename() failed: %v", err)
+	}
+	if err := removeFile(filepath.Join(existing, "file")); err != nil {
+		t.Errorf("removeFile() failed: %v", err)
+	}
+	if err := removeAll(existing); err != nil {
+		t.Errorf("removeAll() failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s not to be written in a dry run, got %v", path, err)
+	}
+	if _, err := os.Stat(filepath.Join(existing, "file")); err != nil {
+		t.Errorf("Expected %s not to be removed in a dry run: %v", existing, err)
+	}
+	// The inactive checkpoint path isn't created in a dry run.
+	if cps := getFileCheckpoints(filepath.Join(dir, "inactive-manifests")); len(cps) != 0 {
+		t.Errorf("Expected no checkpoints in a missing path, got %v", cps)
+	}
+}
@@ -34,27 +34,29 @@ func NewAPIServerBackend(kubeConfigPath string) (Backend, error) {
 }
 
 // read implements Backend.read().
-func (b *apiServerBackend) read(ctx context.Context) (*controlPlane, error) {
+func (b *apiServerBackend) read(ctx context.Context, namespaces []string) (*controlPlane, error) {
 	cp := &controlPlane{}
-	configMaps, err := b.client.CoreV1().ConfigMaps("kube-system").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
-	}
-	cp.configMaps = *configMaps
-	deployments, err := b.client.AppsV1().Deployments("kube-system").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
-	}
-	cp.deployments = *deployments
-	daemonSets, err := b.client.AppsV1().DaemonSets("kube-system").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
-	}
-	cp.daemonSets = *daemonSets
-	secrets, err := b.client.CoreV1().Secrets("kube-system").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
+	for _, ns := range namespaces {
+		configMaps, err := b.client.CoreV1().ConfigMaps(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		cp.configMaps.Items = append(cp.configMaps.Items, configMaps.Items...)
+		deployments, err := b.client.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		cp.deployments.Items = append(cp.deployments.Items, deployments.Items...)
+		daemonSets, err := b.client.AppsV1().DaemonSets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		cp.daemonSets.Items = append(cp.daemonSets.Items, daemonSets.Items...)
+		secrets, err := b.client.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		cp.secrets.Items = append(cp.secrets.Items, secrets.Items...)
 	}
-	cp.secrets = *secrets
 	return cp, nil
 }
@@ -0,0 +1,302 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	v1apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// BackupController continuously exports the control plane to a backup file, from which
+// NewBackupBackend recovers it. It watches the DaemonSets, Deployments, ConfigMaps and Secrets of
+// the namespaces of its Selection, and writes the selected DaemonSets and Deployments with the
+// ConfigMaps and Secrets they mount once they change.
+type BackupController struct {
+	client   kubernetes.Interface
+	sel      Selection
+	path     string
+	interval time.Duration
+
+	stores  []cache.Store
+	changed chan struct{}
+}
+
+// NewBackupController constructs a controller backing up the control plane selected by sel to the
+// file at path, at most once per interval.
+func NewBackupController(client kubernetes.Interface, sel Selection, path string, interval time.Duration) *BackupController {
+	return &BackupController{
+		client:   client,
+		sel:      sel,
+		path:     path,
+		interval: interval,
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// Run backs up the control plane until ctx is done. Failed backups are logged and retried after
+// the interval.
+func (c *BackupController) Run(ctx context.Context) error {
+	var synced []cache.InformerSynced
+	for _, ns := range c.sel.namespaces() {
+		synced = append(synced, c.watch(ctx, ns)...)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return ctx.Err()
+	}
+	var last []byte
+	for {
+		data, err := c.backup()
+		if err == nil && !bytes.Equal(data, last) {
+			if err = writeBackup(c.path, data); err == nil {
+				glog.Infof("Backed up the control plane to %s", c.path)
+				last = data
+			}
+		}
+		if err != nil {
+			glog.Errorf("Failed to back up the control plane: %v", err)
+		}
+		// Changes are written together, at most once per interval.
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.interval):
+		}
+		if err != nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.changed:
+		}
+	}
+}
+
+// watch starts the informers of the objects of the namespace, returning when they are synced.
+func (c *BackupController) watch(ctx context.Context, namespace string) []cache.InformerSynced {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.notify() },
+		UpdateFunc: func(interface{}, interface{}) { c.notify() },
+		DeleteFunc: func(interface{}) { c.notify() },
+	}
+	var synced []cache.InformerSynced
+	for _, lw := range []struct {
+		obj   runtime.Object
+		list  cache.ListFunc
+		watch cache.WatchFunc
+	}{{
+		&v1.ConfigMap{},
+		func(lo metav1.ListOptions) (runtime.Object, error) {
+			return c.client.CoreV1().ConfigMaps(namespace).List(ctx, lo)
+		},
+		func(lo metav1.ListOptions) (watch.Interface, error) {
+			return c.client.CoreV1().ConfigMaps(namespace).Watch(ctx, lo)
+		},
+	}, {
+		&v1apps.DaemonSet{},
+		func(lo metav1.ListOptions) (runtime.Object, error) {
+			return c.client.AppsV1().DaemonSets(namespace).List(ctx, lo)
+		},
+		func(lo metav1.ListOptions) (watch.Interface, error) {
+			return c.client.AppsV1().DaemonSets(namespace).Watch(ctx, lo)
+		},
+	}, {
+		&v1apps.Deployment{},
+		func(lo metav1.ListOptions) (runtime.Object, error) {
+			return c.client.AppsV1().Deployments(namespace).List(ctx, lo)
+		},
+		func(lo metav1.ListOptions) (watch.Interface, error) {
+			return c.client.AppsV1().Deployments(namespace).Watch(ctx, lo)
+		},
+	}, {
+		&v1.Secret{},
+		func(lo metav1.ListOptions) (runtime.Object, error) {
+			return c.client.CoreV1().Secrets(namespace).List(ctx, lo)
+		},
+		func(lo metav1.ListOptions) (watch.Interface, error) {
+			return c.client.CoreV1().Secrets(namespace).Watch(ctx, lo)
+		},
+	}} {
+		store, controller := cache.NewInformer(&cache.ListWatch{ListFunc: lw.list, WatchFunc: lw.watch}, lw.obj, 0, handler)
+		c.stores = append(c.stores, store)
+		synced = append(synced, controller.HasSynced)
+		go controller.Run(ctx.Done())
+	}
+	return synced
+}
+
+// notify marks the control plane as changed since the last backup.
+func (c *BackupController) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// backup returns the backup of the control plane in the informer stores.
+func (c *BackupController) backup() ([]byte, error) {
+	cp := &controlPlane{}
+	for _, s := range c.stores {
+		for _, obj := range s.List() {
+			cp.add(obj.(runtime.Object).DeepCopyObject())
+		}
+	}
+	return cp.backup(c.sel)
+}
+
+// backup returns the DaemonSets and Deployments selected by sel and the ConfigMaps and Secrets
+// they mount as a v1 List, sorted by kind, namespace and name.
+func (cp *controlPlane) backup(sel Selection) ([]byte, error) {
+	requiredConfigMaps, requiredSecrets := map[string]bool{}, map[string]bool{}
+	var objs []runtime.Object
+	addPodSpec := func(namespace string, spec v1.PodSpec) {
+		for _, vol := range spec.Volumes {
+			if vol.Secret != nil {
+				requiredSecrets[objectKey(namespace, vol.Secret.SecretName)] = true
+			} else if vol.ConfigMap != nil {
+				requiredConfigMaps[objectKey(namespace, vol.ConfigMap.Name)] = true
+			}
+		}
+	}
+	for i := range cp.daemonSets.Items {
+		if ds := &cp.daemonSets.Items[i]; sel.selects(ds.Labels) {
+			addPodSpec(ds.Namespace, ds.Spec.Template.Spec)
+			objs = append(objs, ds)
+		}
+	}
+	for i := range cp.deployments.Items {
+		if d := &cp.deployments.Items[i]; sel.selects(d.Labels) {
+			addPodSpec(d.Namespace, d.Spec.Template.Spec)
+			objs = append(objs, d)
+		}
+	}
+	for i := range cp.configMaps.Items {
+		if cm := &cp.configMaps.Items[i]; requiredConfigMaps[objectKey(cm.Namespace, cm.Name)] {
+			objs = append(objs, cm)
+		}
+	}
+	for i := range cp.secrets.Items {
+		if s := &cp.secrets.Items[i]; requiredSecrets[objectKey(s.Namespace, s.Name)] {
+			objs = append(objs, s)
+		}
+	}
+
+	type item struct {
+		key string
+		obj runtime.Object
+	}
+	var items []item
+	for _, obj := range objs {
+		if err := setTypeMeta(obj); err != nil {
+			return nil, err
+		}
+		namespace, err := metaAccessor.Namespace(obj)
+		if err != nil {
+			return nil, err
+		}
+		name, err := metaAccessor.Name(obj)
+		if err != nil {
+			return nil, err
+		}
+		kind, err := metaAccessor.Kind(obj)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item{key: fmt.Sprintf("%s %s/%s", kind, namespace, name), obj: obj})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+
+	list := v1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+	for _, item := range items {
+		raw, err := json.Marshal(item.obj)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, runtime.RawExtension{Raw: raw})
+	}
+	return json.MarshalIndent(list, "", "  ")
+}
+
+// writeBackup replaces the backup file at path with data, which is never partially written.
+func writeBackup(path string, data []byte) error {
+	// The temporary file is on the same filesystem so that os.Rename() does not fail.
+	tmpfile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpfile.Name())
+	if _, err := tmpfile.Write(data); err != nil {
+		tmpfile.Close()
+		return err
+	}
+	if err := tmpfile.Sync(); err != nil {
+		tmpfile.Close()
+		return err
+	}
+	if err := tmpfile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile.Name(), path)
+}
+
+type backupBackend struct {
+	path string
+}
+
+// NewBackupBackend constructs a new backend reading the control plane from a backup file written
+// by a BackupController.
+func NewBackupBackend(path string) Backend {
+	return &backupBackend{path: path}
+}
+
+// read implements Backend.read().
+func (b *backupBackend) read(ctx context.Context, namespaces []string) (*controlPlane, error) {
+	data, err := ioutil.ReadFile(b.path)
+	if err != nil {
+		return nil, err
+	}
+	var list v1.List
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode the backup %s: %v", b.path, err)
+	}
+	read := map[string]bool{}
+	for _, ns := range namespaces {
+		read[ns] = true
+	}
+	cp := &controlPlane{}
+	for _, item := range list.Items {
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(item.Raw, &typeMeta); err != nil {
+			return nil, fmt.Errorf("failed to decode the backup %s: %v", b.path, err)
+		}
+		obj := newControlPlaneObject(typeMeta.Kind)
+		if obj == nil {
+			return nil, fmt.Errorf("unexpected %s in the backup %s", typeMeta.Kind, b.path)
+		}
+		if err := json.Unmarshal(item.Raw, obj); err != nil {
+			return nil, fmt.Errorf("failed to decode a %s of the backup %s: %v", typeMeta.Kind, b.path, err)
+		}
+		namespace, err := metaAccessor.Namespace(obj)
+		if err != nil {
+			return nil, err
+		}
+		if read[namespace] {
+			cp.add(obj)
+		}
+	}
+	return cp, nil
+}
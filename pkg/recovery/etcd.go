@@ -9,10 +9,12 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"go.etcd.io/etcd/clientv3"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
 
 	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
@@ -49,7 +51,7 @@ func NewEtcdBackendWithTransformer(client *clientv3.Client, pathPrefix string, t
 }
 
 // read implements Backend.read().
-func (s *etcdBackend) read(ctx context.Context) (*controlPlane, error) {
+func (s *etcdBackend) read(ctx context.Context, namespaces []string) (*controlPlane, error) {
 	cp := &controlPlane{}
 	for _, r := range []struct {
 		etcdKeyName string
@@ -67,8 +69,10 @@ func (s *etcdBackend) read(ctx context.Context) (*controlPlane, error) {
 		etcdKeyName: "secrets",
 		obj:         &cp.secrets,
 	}} {
-		if err := s.list(ctx, r.etcdKeyName, r.obj); err != nil {
-			return nil, err
+		for _, ns := range namespaces {
+			if err := s.list(ctx, r.etcdKeyName, ns, r.obj); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -121,13 +125,14 @@ func (s *etcdBackend) getBytes(ctx context.Context, key string) ([]byte, error)
 	return value, nil
 }
 
-// list fetches a list runtime.Object from etcd located at key prefix `key`.
-func (s *etcdBackend) list(ctx context.Context, key string, listObj runtime.Object) error {
+// list appends the objects in namespace located at key prefix `key` in etcd to the list
+// runtime.Object.
+func (s *etcdBackend) list(ctx context.Context, key, namespace string, listObj runtime.Object) error {
 	listPtr, err := meta.GetItemsPtr(listObj)
 	if err != nil {
 		return err
 	}
-	key = path.Join(s.pathPrefix, key, "kube-system")
+	key = path.Join(s.pathPrefix, key, namespace)
 	if !strings.HasSuffix(key, "/") {
 		key += "/"
 	}
@@ -175,6 +180,40 @@ func StartRecoveryEtcdForBackup(p, backupPath string) error {
 	return as.WriteFile(p)
 }
 
+// recoveryEtcdInterval is how often the recovery etcd is checked while it starts.
+const recoveryEtcdInterval = 5 * time.Second
+
+// WaitForRecoveryEtcd waits until the recovery etcd started by StartRecoveryEtcdForBackup serves
+// the restored backup, or ctx is done, and returns a client of it. The kubelet may have to pull
+// the etcd image first.
+func WaitForRecoveryEtcd(ctx context.Context) (*clientv3.Client, error) {
+	var client *clientv3.Client
+	var lastErr error
+	err := wait.PollImmediateUntil(recoveryEtcdInterval, func() (bool, error) {
+		client, lastErr = clientv3.New(clientv3.Config{
+			Endpoints:   []string{RecoveryEtcdClientAddr},
+			DialTimeout: 5 * time.Second,
+		})
+		if lastErr != nil {
+			return false, nil
+		}
+		statusCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if _, lastErr = client.Status(statusCtx, RecoveryEtcdClientAddr); lastErr != nil {
+			client.Close()
+			return false, nil
+		}
+		return true, nil
+	}, ctx.Done())
+	if err != nil && lastErr != nil {
+		return nil, fmt.Errorf("the recovery etcd didn't start: %v", lastErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
 // CleanRecoveryEtcd removes the recovery etcd static pod manifest and stops the recovery
 // etcd container.
 func CleanRecoveryEtcd(p string) error {
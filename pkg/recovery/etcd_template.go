@@ -42,12 +42,39 @@ spec:
     - --listen-peer-urls=http://0.0.0.0:52380
     - --advertise-client-urls={{ .ClientAddr }}
     - --data-dir=/var/etcd/recovery
+    env:
+    - name: ETCDCTL_API
+      value: "3"
+    livenessProbe:
+      exec:
+        command:
+        - /usr/local/bin/etcdctl
+        - --endpoints={{ .ClientAddr }}
+        - --command-timeout=5s
+        - endpoint
+        - health
+      initialDelaySeconds: 15
+      periodSeconds: 10
+      timeoutSeconds: 10
+      failureThreshold: 3
+    readinessProbe:
+      exec:
+        command:
+        - /usr/local/bin/etcdctl
+        - --endpoints={{ .ClientAddr }}
+        - --command-timeout=5s
+        - endpoint
+        - health
+      periodSeconds: 5
+      timeoutSeconds: 10
     volumeMounts:
       - mountPath: /var/etcd
         name: etcd
         readOnly: false
   hostNetwork: true
-  restartPolicy: Never
+  # The restored data lives in an emptyDir, so restarting an unhealthy etcd
+  # container keeps it while the init container is not re-run.
+  restartPolicy: OnFailure
   volumes:
     - name: etcd
       emptyDir: {}
@@ -131,6 +158,37 @@ spec:
     - --trusted-ca-file=/etc/kubernetes/secrets/etcd/server-ca.crt
     - --cert-file=/etc/kubernetes/secrets/etcd/server.crt
     - --key-file=/etc/kubernetes/secrets/etcd/server.key
+    env:
+    - name: ETCDCTL_API
+      value: "3"
+    livenessProbe:
+      exec:
+        command:
+        - /usr/local/bin/etcdctl
+        - --endpoints=https://127.0.0.1:12379
+        - --cacert=/etc/kubernetes/secrets/etcd/server-ca.crt
+        - --cert=/etc/kubernetes/secrets/etcd-client.crt
+        - --key=/etc/kubernetes/secrets/etcd-client.key
+        - --command-timeout=5s
+        - endpoint
+        - health
+      initialDelaySeconds: 15
+      periodSeconds: 10
+      timeoutSeconds: 10
+      failureThreshold: 3
+    readinessProbe:
+      exec:
+        command:
+        - /usr/local/bin/etcdctl
+        - --endpoints=https://127.0.0.1:12379
+        - --cacert=/etc/kubernetes/secrets/etcd/server-ca.crt
+        - --cert=/etc/kubernetes/secrets/etcd-client.crt
+        - --key=/etc/kubernetes/secrets/etcd-client.key
+        - --command-timeout=5s
+        - endpoint
+        - health
+      periodSeconds: 5
+      timeoutSeconds: 10
     volumeMounts:
       - mountPath: /var/etcd
         name: etcd
@@ -140,7 +198,9 @@ spec:
         readOnly: true
   hostNetwork: true
   dnsPolicy: ClusterFirstWithHostNet
-  restartPolicy: Never
+  # The restored data lives in an emptyDir, so restarting an unhealthy etcd
+  # container keeps it while the init containers are not re-run.
+  restartPolicy: OnFailure
   volumes:
     - name: etcd
       emptyDir: {}
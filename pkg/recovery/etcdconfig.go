@@ -0,0 +1,122 @@
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	v1apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdConfig is how an apiserver reaches etcd.
+type EtcdConfig struct {
+	// Servers are the URLs of the etcd servers.
+	Servers []string
+	// Prefix is the path prefix of the cluster data in etcd, if set.
+	Prefix string
+	// CAFile, CertFile and KeyFile are the paths on the host of the TLS files of the etcd client,
+	// if set and mounted from the host.
+	CAFile, CertFile, KeyFile string
+}
+
+// EtcdConfigFromManifest returns how the kube-apiserver of the manifest at p reaches etcd, such as
+// its checkpoint in the pod manifest path or the bootstrap-apiserver.yaml of an earlier recovery.
+// The manifest holds a Pod, DaemonSet or Deployment with a container setting --etcd-servers.
+func EtcdConfigFromManifest(p string) (*EtcdConfig, error) {
+	docs, err := readManifestFile(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(doc, &typeMeta); err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		var spec *v1.PodSpec
+		switch typeMeta.Kind {
+		case "Pod":
+			var pod v1.Pod
+			if err := json.Unmarshal(doc, &pod); err != nil {
+				return nil, fmt.Errorf("%s: failed to decode a Pod: %v", p, err)
+			}
+			spec = &pod.Spec
+		case "DaemonSet":
+			var ds v1apps.DaemonSet
+			if err := json.Unmarshal(doc, &ds); err != nil {
+				return nil, fmt.Errorf("%s: failed to decode a DaemonSet: %v", p, err)
+			}
+			spec = &ds.Spec.Template.Spec
+		case "Deployment":
+			var d v1apps.Deployment
+			if err := json.Unmarshal(doc, &d); err != nil {
+				return nil, fmt.Errorf("%s: failed to decode a Deployment: %v", p, err)
+			}
+			spec = &d.Spec.Template.Spec
+		default:
+			continue
+		}
+		for _, c := range spec.Containers {
+			flags := containerFlags(c)
+			if flags["etcd-servers"] == "" {
+				continue
+			}
+			return &EtcdConfig{
+				Servers:  strings.Split(flags["etcd-servers"], ","),
+				Prefix:   flags["etcd-prefix"],
+				CAFile:   hostPath(*spec, c, flags["etcd-cafile"]),
+				CertFile: hostPath(*spec, c, flags["etcd-certfile"]),
+				KeyFile:  hostPath(*spec, c, flags["etcd-keyfile"]),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no container sets --etcd-servers", p)
+}
+
+// containerFlags returns the values of the long flags of the command and args of the container,
+// set as either --flag=value or --flag value.
+func containerFlags(c v1.Container) map[string]string {
+	flags := map[string]string{}
+	args := append(append([]string{}, c.Command...), c.Args...)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		name := strings.TrimPrefix(args[i], "--")
+		if j := strings.Index(name, "="); j >= 0 {
+			flags[name[:j]] = name[j+1:]
+		} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			flags[name] = args[i+1]
+			i++
+		}
+	}
+	return flags
+}
+
+// hostPath returns the path on the host of the file p of the container, or "" unless it is mounted
+// from a hostPath volume. The deepest mount of p is used, as in the container.
+func hostPath(spec v1.PodSpec, c v1.Container, p string) string {
+	if p == "" {
+		return ""
+	}
+	var mount *v1.VolumeMount
+	for i, m := range c.VolumeMounts {
+		if p != m.MountPath && !strings.HasPrefix(p, strings.TrimSuffix(m.MountPath, "/")+"/") {
+			continue
+		}
+		if mount == nil || len(m.MountPath) > len(mount.MountPath) {
+			mount = &c.VolumeMounts[i]
+		}
+	}
+	if mount == nil {
+		return ""
+	}
+	for _, vol := range spec.Volumes {
+		if vol.Name == mount.Name && vol.HostPath != nil {
+			return path.Join(vol.HostPath.Path, mount.SubPath, strings.TrimPrefix(p, mount.MountPath))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package recovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+type manifestDirBackend struct {
+	dir string
+}
+
+// NewManifestDirBackend constructs a new backend reading the control plane from a directory of
+// exported objects, such as the YAML of `kubectl get -o yaml` or the JSON of a velero backup. The
+// files below the directory may hold any number of objects or Lists of objects. Objects other than
+// ConfigMaps, DaemonSets, Deployments and Secrets are ignored, as are further copies of an object.
+func NewManifestDirBackend(dir string) Backend {
+	return &manifestDirBackend{dir: dir}
+}
+
+// read implements Backend.read().
+func (b *manifestDirBackend) read(ctx context.Context, namespaces []string) (*controlPlane, error) {
+	read := map[string]bool{}
+	for _, ns := range namespaces {
+		read[ns] = true
+	}
+	cp := &controlPlane{}
+	seen := map[string]bool{}
+	err := filepath.Walk(b.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(p) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		docs, err := readManifestFile(p)
+		if err != nil {
+			return err
+		}
+		for len(docs) > 0 {
+			doc := docs[0]
+			docs = docs[1:]
+			var typeMeta metav1.TypeMeta
+			if err := json.Unmarshal(doc, &typeMeta); err != nil {
+				return fmt.Errorf("%s: %v", p, err)
+			}
+			if strings.HasSuffix(typeMeta.Kind, "List") {
+				var list v1.List
+				if err := json.Unmarshal(doc, &list); err != nil {
+					return fmt.Errorf("%s: %v", p, err)
+				}
+				for _, item := range list.Items {
+					raw, err := listItem(item.Raw, strings.TrimSuffix(typeMeta.Kind, "List"))
+					if err != nil {
+						return fmt.Errorf("%s: %v", p, err)
+					}
+					docs = append(docs, raw)
+				}
+				continue
+			}
+			obj := newControlPlaneObject(typeMeta.Kind)
+			if obj == nil {
+				continue
+			}
+			if err := json.Unmarshal(doc, obj); err != nil {
+				return fmt.Errorf("%s: failed to decode a %s: %v", p, typeMeta.Kind, err)
+			}
+			namespace, err := metaAccessor.Namespace(obj)
+			if err != nil {
+				return err
+			}
+			name, err := metaAccessor.Name(obj)
+			if err != nil {
+				return err
+			}
+			key := fmt.Sprintf("%s %s/%s", typeMeta.Kind, namespace, name)
+			if read[namespace] && !seen[key] {
+				seen[key] = true
+				cp.add(obj)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// listItem returns an item of a List. Items of typed lists, like a ConfigMapList, get the kind of
+// the list if they have none of their own.
+func listItem(raw []byte, kind string) ([]byte, error) {
+	var item map[string]interface{}
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, err
+	}
+	if k, _ := item["kind"].(string); k != "" || kind == "" {
+		return raw, nil
+	}
+	item["kind"] = kind
+	return json.Marshal(item)
+}
+
+// readManifestFile returns the JSON of the documents of a YAML or JSON file.
+func readManifestFile(p string) ([][]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if filepath.Ext(p) == ".json" {
+		var docs [][]byte
+		dec := json.NewDecoder(f)
+		for {
+			var doc json.RawMessage
+			if err := dec.Decode(&doc); err == io.EOF {
+				return docs, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %v", p, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+	var docs [][]byte
+	reader := yaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		if doc = bytes.TrimSpace(doc); len(doc) == 0 {
+			continue
+		}
+		data, err := yaml.ToJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid manifest: %v", p, err)
+		}
+		if string(data) != "null" {
+			docs = append(docs, data)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+// Plan is what a recovery would do, without writing any assets.
+type Plan struct {
+	// Found are the objects read from the backend, as "<Kind> <namespace>/<name>".
+	Found []string
+	// Assets are the names of the assets the recovery would write.
+	Assets []string
+	// Missing are the objects the recovered control plane requires but the backend lacks. The
+	// recovery fails unless there are none.
+	Missing []string
+	// Expired are the assets holding expired certificates, which the recovery renews given the CA.
+	Expired []string
+}
+
+// PlanRecover returns what Recover, or RecoverSeedEtcd if seed is set, would recover from the
+// backend.
+func PlanRecover(ctx context.Context, backend Backend, kubeConfigPath string, sel Selection, seed *SeedEtcdConfig) (*Plan, error) {
+	cp, err := backend.read(ctx, sel.namespaces())
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	for _, objs := range []runtime.Object{&cp.configMaps, &cp.daemonSets, &cp.deployments, &cp.secrets} {
+		names, err := objectNames(objs)
+		if err != nil {
+			return nil, err
+		}
+		plan.Found = append(plan.Found, names...)
+	}
+
+	pods, err := extractBootstrapPods(cp.daemonSets.Items, cp.deployments.Items, sel)
+	if err != nil {
+		return nil, err
+	}
+	if sel.Selector != nil {
+		if len(pods) == 0 {
+			plan.Missing = append(plan.Missing, fmt.Sprintf("DaemonSets or Deployments matching %s", sel.Selector))
+		}
+	} else {
+		extracted := map[string]bool{}
+		for _, ds := range cp.daemonSets.Items {
+			extracted[bootstrapApp(ds.Labels)] = true
+		}
+		for _, d := range cp.deployments.Items {
+			extracted[bootstrapApp(d.Labels)] = true
+		}
+		for app := range bootstrapK8sApps {
+			if !extracted[app] {
+				plan.Missing = append(plan.Missing, fmt.Sprintf("DaemonSet or Deployment %s/%s", recoveryNamespace, app))
+			}
+		}
+	}
+	requiredConfigMaps, requiredSecrets := fixUpBootstrapPods(pods)
+	if seed != nil {
+		seedEtcdServers(pods, requiredSecrets)
+	}
+	as, err := outputBootstrapPods(pods)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range []struct {
+		kind     string
+		objs     runtime.Object
+		required map[string]string
+		output   func(map[string]string) (asset.Assets, error)
+	}{
+		{"ConfigMap", &cp.configMaps, requiredConfigMaps, func(required map[string]string) (asset.Assets, error) {
+			return outputBootstrapConfigMaps(cp.configMaps, required)
+		}},
+		{"Secret", &cp.secrets, requiredSecrets, func(required map[string]string) (asset.Assets, error) {
+			return outputBootstrapSecrets(cp.secrets, required)
+		}},
+	} {
+		found, missing, err := splitRequired(r.objs, r.required)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range missing {
+			if !strings.Contains(key, "/") {
+				key = path.Join(recoveryNamespace, key)
+			}
+			plan.Missing = append(plan.Missing, fmt.Sprintf("%s %s", r.kind, key))
+		}
+		data, err := r.output(found)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, data...)
+	}
+
+	if kc, err := renderKubeConfig(kubeConfigPath, cp.secrets); err != nil {
+		plan.Missing = append(plan.Missing, fmt.Sprintf("kubeconfig %s", kubeConfigPath))
+	} else {
+		as = append(as, kc)
+	}
+	if seed != nil {
+		eb, ok := backend.(*etcdBackend)
+		if !ok {
+			return nil, errors.New("only a control plane recovered from etcd can seed etcd")
+		}
+		if cluster, err := eb.getBytes(ctx, etcdCRDKey); err != nil {
+			plan.Missing = append(plan.Missing, "EtcdCluster kube-system/kube-etcd")
+		} else {
+			as = append(as, seed.assets(eb.pathPrefix, cluster)...)
+		}
+	}
+	for _, a := range as {
+		plan.Assets = append(plan.Assets, a.Name)
+	}
+	plan.Expired = ExpiredCerts(as, time.Now())
+	sort.Strings(plan.Assets)
+	sort.Strings(plan.Missing)
+	return plan, nil
+}
+
+// objectNames returns the objects of the list objs as "<Kind> <namespace>/<name>".
+func objectNames(objs runtime.Object) ([]string, error) {
+	items, err := meta.ExtractList(objs)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, obj := range items {
+		kind := typeMetas[reflect.TypeOf(obj)].Kind
+		namespace, err := metaAccessor.Namespace(obj)
+		if err != nil {
+			return nil, err
+		}
+		name, err := metaAccessor.Name(obj)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, fmt.Sprintf("%s %s/%s", kind, namespace, name))
+	}
+	return names, nil
+}
+
+// splitRequired splits the required objects into those of the list objs, with their output
+// paths, and the keys of those missing from it.
+func splitRequired(objs runtime.Object, required map[string]string) (found map[string]string, missing []string, err error) {
+	items, err := meta.ExtractList(objs)
+	if err != nil {
+		return nil, nil, err
+	}
+	present := map[string]bool{}
+	for _, obj := range items {
+		name, err := metaAccessor.Name(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		namespace, err := metaAccessor.Namespace(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		present[objectKey(namespace, name)] = true
+	}
+	found = map[string]string{}
+	for key, p := range required {
+		if present[key] {
+			found[key] = p
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return found, missing, nil
+}
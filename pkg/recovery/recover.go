@@ -4,17 +4,21 @@
 //
 // The recovery tool assumes that the component names for the control plane elements are the same as
 // what is output by `bootkube render`. The `bootkube start` command also makes this assumption.
-// It also assumes that kubeconfig on the kubelet is located at /etc/kubernetes/kubeconfig, though
-// that can be changed in the bootstrap manifests that are rendered.
+// The assets are laid out like those of `bootkube render`: the bootstrap manifests are named alike,
+// and the files of the Secrets in kube-system are written to tls/, so that the bootstrap control
+// plane finds them in the bootstrap secrets where `bootkube start` copies them.
 package recovery
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"path"
 	"path/filepath"
 	"reflect"
+	"text/template"
 
 	"github.com/ghodss/yaml"
 	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
@@ -24,13 +28,16 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
 	k8sAppLabel            = "k8s-app"   // The label used in versions > v0.4.2
 	componentAppLabel      = "component" // The label used in versions <= v0.4.2
-	kubeletKubeConfigPath  = "/etc/kubernetes"
 	apiServerContainerName = "kube-apiserver"
+	// apiServerSecretName is the Secret of the kube-apiserver, which holds the CA and the
+	// system:masters client certificate the admin kubeconfig is reconstructed from.
+	apiServerSecretName = "kube-apiserver"
 )
 
 var (
@@ -47,6 +54,13 @@ var (
 		"kube-controller-manager": {},
 		"kube-scheduler":          {},
 	}
+	// bootstrapManifestPaths maps the bootstrap pods of the components of `bootkube render` to the
+	// paths render outputs them at. Other bootstrap pods are output as bootstrap-<name>.yaml.
+	bootstrapManifestPaths = map[string]string{
+		"bootstrap-kube-apiserver":          asset.AssetPathBootstrapAPIServer,
+		"bootstrap-kube-controller-manager": asset.AssetPathBootstrapControllerManager,
+		"bootstrap-kube-scheduler":          asset.AssetPathBootstrapScheduler,
+	}
 	// typeMetas contains a mapping from API object types to the TypeMeta struct that should be
 	// populated for them when they are serialized.
 	typeMetas    = make(map[reflect.Type]metav1.TypeMeta)
@@ -70,7 +84,7 @@ func init() {
 
 // Backend defines an interface for any backend that can populate a controlPlane struct.
 type Backend interface {
-	read(context.Context) (*controlPlane, error)
+	read(ctx context.Context, namespaces []string) (*controlPlane, error)
 }
 
 // controlPlane holds the control plane objects that are recovered from a backend.
@@ -81,21 +95,58 @@ type controlPlane struct {
 	secrets     v1.SecretList
 }
 
+// newControlPlaneObject returns a new ConfigMap, DaemonSet, Deployment or Secret of the kind, or nil
+// for other kinds.
+func newControlPlaneObject(kind string) runtime.Object {
+	switch kind {
+	case "ConfigMap":
+		return &v1.ConfigMap{}
+	case "DaemonSet":
+		return &v1apps.DaemonSet{}
+	case "Deployment":
+		return &v1apps.Deployment{}
+	case "Secret":
+		return &v1.Secret{}
+	}
+	return nil
+}
+
+// add adds a ConfigMap, DaemonSet, Deployment or Secret to the control plane. Other objects are
+// ignored.
+func (cp *controlPlane) add(obj runtime.Object) {
+	switch o := obj.(type) {
+	case *v1.ConfigMap:
+		cp.configMaps.Items = append(cp.configMaps.Items, *o)
+	case *v1apps.DaemonSet:
+		cp.daemonSets.Items = append(cp.daemonSets.Items, *o)
+	case *v1apps.Deployment:
+		cp.deployments.Items = append(cp.deployments.Items, *o)
+	case *v1.Secret:
+		cp.secrets.Items = append(cp.secrets.Items, *o)
+	}
+}
+
 // Recover recovers a control plane using the provided backend and kubeConfigPath, returning assets
 // for the existing control plane and a bootstrap control plane that can be used with `bootkube
-// start` to re-bootstrap the control plane.
-func Recover(ctx context.Context, backend Backend, kubeConfigPath string) (asset.Assets, error) {
-	cp, err := backend.read(ctx)
+// start` to re-bootstrap the control plane. sel tells which objects make up the control plane.
+func Recover(ctx context.Context, backend Backend, kubeConfigPath string, sel Selection) (asset.Assets, error) {
+	return recoverControlPlane(ctx, backend, kubeConfigPath, sel, false)
+}
+
+// recoverControlPlane implements Recover, with the bootstrap apiserver using the etcd seed member
+// of RecoverSeedEtcd if seedEtcd is set.
+func recoverControlPlane(ctx context.Context, backend Backend, kubeConfigPath string, sel Selection, seedEtcd bool) (asset.Assets, error) {
+	cp, err := backend.read(ctx, sel.namespaces())
 	if err != nil {
 		return nil, err
 	}
 
-	as, err := cp.renderBootstrap()
+	as, err := cp.renderBootstrap(sel, seedEtcd)
 	if err != nil {
 		return nil, err
 	}
 
-	kc, err := renderKubeConfig(kubeConfigPath)
+	kc, err := renderKubeConfig(kubeConfigPath, cp.secrets)
 	if err != nil {
 		return nil, err
 	}
@@ -107,12 +158,15 @@ func Recover(ctx context.Context, backend Backend, kubeConfigPath string) (asset
 // renderBootstrap returns assets for a bootstrap control plane that can be used with `bootkube
 // start` to re-bootstrap a control plane. These assets are derived from the self-hosted control
 // plane that was recovered by the backend, but modified for direct injection into a kubelet.
-func (cp *controlPlane) renderBootstrap() (asset.Assets, error) {
-	pods, err := extractBootstrapPods(cp.daemonSets.Items, cp.deployments.Items)
+func (cp *controlPlane) renderBootstrap(sel Selection, seedEtcd bool) (asset.Assets, error) {
+	pods, err := extractBootstrapPods(cp.daemonSets.Items, cp.deployments.Items, sel)
 	if err != nil {
 		return nil, err
 	}
 	requiredConfigMaps, requiredSecrets := fixUpBootstrapPods(pods)
+	if seedEtcd {
+		seedEtcdServers(pods, requiredSecrets)
+	}
 	as, err := outputBootstrapPods(pods)
 	if err != nil {
 		return nil, err
@@ -131,11 +185,12 @@ func (cp *controlPlane) renderBootstrap() (asset.Assets, error) {
 	return as, nil
 }
 
-// extractBootstrapPods extracts bootstrap pod specs from daemonsets and deployments.
-func extractBootstrapPods(daemonSets []v1apps.DaemonSet, deployments []v1apps.Deployment) ([]v1.Pod, error) {
+// extractBootstrapPods extracts bootstrap pod specs from the daemonsets and deployments selected
+// by sel.
+func extractBootstrapPods(daemonSets []v1apps.DaemonSet, deployments []v1apps.Deployment, sel Selection) ([]v1.Pod, error) {
 	var pods []v1.Pod
 	for _, ds := range daemonSets {
-		if isBootstrapApp(ds.Labels) {
+		if sel.selects(ds.Labels) {
 			pod := v1.Pod{Spec: ds.Spec.Template.Spec}
 			if err := setBootstrapPodMetadata(&pod, ds.ObjectMeta); err != nil {
 				return nil, err
@@ -144,7 +199,7 @@ func extractBootstrapPods(daemonSets []v1apps.DaemonSet, deployments []v1apps.De
 		}
 	}
 	for _, ds := range deployments {
-		if isBootstrapApp(ds.Labels) {
+		if sel.selects(ds.Labels) {
 			pod := v1.Pod{Spec: ds.Spec.Template.Spec}
 			if err := setBootstrapPodMetadata(&pod, ds.ObjectMeta); err != nil {
 				return nil, err
@@ -158,14 +213,18 @@ func extractBootstrapPods(daemonSets []v1apps.DaemonSet, deployments []v1apps.De
 // isBootstrapApp returns true if this app belongs to the bootstrap control plane, based on its
 // labels.
 func isBootstrapApp(labels map[string]string) bool {
-	k8sApp := labels[k8sAppLabel]
-	if k8sApp == "" {
-		k8sApp = labels[componentAppLabel]
-	}
-	_, ok := bootstrapK8sApps[k8sApp]
+	_, ok := bootstrapK8sApps[bootstrapApp(labels)]
 	return ok
 }
 
+// bootstrapApp returns the app of the labels, in any version.
+func bootstrapApp(labels map[string]string) string {
+	if k8sApp := labels[k8sAppLabel]; k8sApp != "" {
+		return k8sApp
+	}
+	return labels[componentAppLabel]
+}
+
 // setBootstrapPodMetadata creates valid metadata for a bootstrap pod. Currently it sets the
 // TypeMeta and Name, Namespace, and Annotations on the ObjectMeta.
 func setBootstrapPodMetadata(pod *v1.Pod, parent metav1.ObjectMeta) error {
@@ -182,8 +241,10 @@ func setBootstrapPodMetadata(pod *v1.Pod, parent metav1.ObjectMeta) error {
 
 // fixUpBootstrapPods modifies extracted bootstrap pod specs to have correct metadata and point to
 // filesystem-mount-based secrets, and removes any security contexts that might prevent the pods
-// from accessing those secrets. It returns mappings from configMap and secret names to output
-// paths that must also be rendered in order for the bootstrap pods to be functional.
+// from accessing those secrets. It returns mappings from configMap and secret keys, see objectKey,
+// to output paths that must also be rendered in order for the bootstrap pods to be functional.
+// Like with `bootkube render`, the Secrets in kube-system are all output to tls/ and mounted from
+// the bootstrap secrets, while those of other namespaces keep a directory of their own.
 func fixUpBootstrapPods(pods []v1.Pod) (requiredConfigMaps, requiredSecrets map[string]string) {
 	requiredConfigMaps, requiredSecrets = make(map[string]string), make(map[string]string)
 	for i := range pods {
@@ -202,13 +263,19 @@ func fixUpBootstrapPods(pods []v1.Pod) (requiredConfigMaps, requiredSecrets map[
 		for i := range pod.Spec.Volumes {
 			vol := &pod.Spec.Volumes[i]
 			if vol.Secret != nil {
-				pathSuffix := filepath.Join("secrets", vol.Secret.SecretName)
-				requiredSecrets[vol.Secret.SecretName] = filepath.Join(asset.AssetPathSecrets, pathSuffix)
-				vol.HostPath = &v1.HostPathVolumeSource{Path: filepath.Join(asset.BootstrapSecretsDir, pathSuffix)}
+				key := objectKey(pod.Namespace, vol.Secret.SecretName)
+				output, hostPath := asset.AssetPathSecrets, asset.BootstrapSecretsDir
+				if key != vol.Secret.SecretName {
+					pathSuffix := filepath.Join("secrets", key)
+					output, hostPath = filepath.Join(output, pathSuffix), filepath.Join(hostPath, pathSuffix)
+				}
+				requiredSecrets[key] = output
+				vol.HostPath = &v1.HostPathVolumeSource{Path: hostPath}
 				vol.Secret = nil
 			} else if vol.ConfigMap != nil {
-				pathSuffix := filepath.Join("config-maps", vol.ConfigMap.Name)
-				requiredConfigMaps[vol.ConfigMap.Name] = filepath.Join(asset.AssetPathSecrets, pathSuffix)
+				key := objectKey(pod.Namespace, vol.ConfigMap.Name)
+				pathSuffix := filepath.Join("config-maps", key)
+				requiredConfigMaps[key] = filepath.Join(asset.AssetPathSecrets, pathSuffix)
 				vol.HostPath = &v1.HostPathVolumeSource{Path: path.Join(asset.BootstrapSecretsDir, pathSuffix)}
 				vol.ConfigMap = nil
 			}
@@ -235,20 +302,24 @@ func fixUpBootstrapPods(pods []v1.Pod) (requiredConfigMaps, requiredSecrets map[
 			}
 		}
 
-		// Add a mount for the kubeconfig.
+		// Add a mount for the kubeconfig, which `bootkube start` copies to the bootstrap secrets.
 		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
-			VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: kubeletKubeConfigPath}},
+			VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: asset.BootstrapSecretsDir}},
 			Name:         "kubeconfig",
 		})
 	}
 	return
 }
 
-// outputBootstrapPods outputs the bootstrap pod definitions.
+// outputBootstrapPods outputs the bootstrap pod definitions, at the paths of bootstrapManifestPaths.
 func outputBootstrapPods(pods []v1.Pod) (asset.Assets, error) {
 	var as asset.Assets
 	for _, pod := range pods {
-		a, err := serializeObjToYAML(path.Join(asset.AssetPathBootstrapManifests, pod.Name+".yaml"), &pod)
+		name, ok := bootstrapManifestPaths[pod.Name]
+		if !ok {
+			name = path.Join(asset.AssetPathBootstrapManifests, pod.Name+".yaml")
+		}
+		a, err := serializeObjToYAML(name, &pod)
 		if err != nil {
 			return nil, err
 		}
@@ -285,9 +356,12 @@ func outputBootstrapSecrets(secrets v1.SecretList, requiredSecrets map[string]st
 }
 
 // outputKeyValueData takes a key-value object (such as a Secret or ConfigMap) and outputs assets
-// for each key-value pair. See outputBootstrapConfigMaps or outputBootstrapSecrets for usage.
+// for each key-value pair. See outputBootstrapConfigMaps or outputBootstrapSecrets for usage. Objects
+// may share an output path, as long as the data of any key they have in common is the same.
 func outputKeyValueData(objList runtime.Object, requiredObjs map[string]string, extractData func(runtime.Object) map[string][]byte) (asset.Assets, error) {
 	var as asset.Assets
+	// outputs maps the names of the assets to the keys of the objects they came from.
+	outputs := make(map[string]string)
 	objs, err := meta.ExtractList(objList)
 	if err != nil {
 		return nil, err
@@ -297,14 +371,24 @@ func outputKeyValueData(objList runtime.Object, requiredObjs map[string]string,
 		if err != nil {
 			return nil, err
 		}
-		if namePrefix, ok := requiredObjs[name]; ok {
-			for key, data := range extractData(obj) {
-				as = append(as, asset.Asset{
-					Name: path.Join(namePrefix, key),
-					Data: data,
-				})
+		namespace, err := metaAccessor.Namespace(obj)
+		if err != nil {
+			return nil, err
+		}
+		key := objectKey(namespace, name)
+		if namePrefix, ok := requiredObjs[key]; ok {
+			for k, data := range extractData(obj) {
+				a := asset.Asset{Name: path.Join(namePrefix, k), Data: data}
+				if from, ok := outputs[a.Name]; ok {
+					if i := assetIndex(as, a.Name); !bytes.Equal(as[i].Data, data) {
+						return nil, fmt.Errorf("%s and %s have different data for %s", from, key, a.Name)
+					}
+					continue
+				}
+				outputs[a.Name] = key
+				as = append(as, a)
 			}
-			delete(requiredObjs, name)
+			delete(requiredObjs, key)
 		}
 	}
 	if len(requiredObjs) > 0 {
@@ -317,17 +401,90 @@ func outputKeyValueData(objList runtime.Object, requiredObjs map[string]string,
 	return as, nil
 }
 
-// renderKubeConfig outputs kubeconfig assets to ensure that the kubeconfig will be rendered to the
-// assetDir for use by `bootkube start`.
-func renderKubeConfig(kubeConfigPath string) (asset.Asset, error) {
+// assetIndex returns the index of the asset called name in as, or -1.
+func assetIndex(as asset.Assets, name string) int {
+	for i, a := range as {
+		if a.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+var adminKubeConfigTemplate = template.Must(template.New("kubeconfig").Parse(`apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: {{ .Server }}
+    certificate-authority-data: {{ .CACert }}
+users:
+- name: admin
+  user:
+    client-certificate-data: {{ .Cert }}
+    client-key-data: {{ .Key }}
+contexts:
+- context:
+    cluster: local
+    user: admin
+  name: admin@local
+current-context: admin@local
+`))
+
+// renderKubeConfig outputs the admin kubeconfig used by `bootkube start` and the bootstrap control
+// plane. Like the one of `bootkube render`, it authenticates with the system:masters client
+// certificate of the recovered kube-apiserver Secret, against the apiserver of the kubeconfig at
+// kubeConfigPath. Without such a Secret, the kubeconfig at kubeConfigPath is output as is.
+func renderKubeConfig(kubeConfigPath string, secrets v1.SecretList) (asset.Asset, error) {
 	kubeConfig, err := ioutil.ReadFile(kubeConfigPath)
 	if err != nil {
 		return asset.Asset{}, err
 	}
-	return asset.Asset{
+	a := asset.Asset{
 		Name: asset.AssetPathAdminKubeConfig, // used by `bootkube start`.
 		Data: kubeConfig,
-	}, nil
+	}
+	var secret *v1.Secret
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		if s.Name == apiServerSecretName && objectKey(s.Namespace, s.Name) == s.Name {
+			secret = s
+		}
+	}
+	if secret == nil {
+		return a, nil
+	}
+	values := make(map[string]string)
+	for key, name := range map[string]string{
+		"CACert": asset.AssetPathCACert,
+		"Cert":   asset.AssetPathKubeletClientCert,
+		"Key":    asset.AssetPathKubeletClientKey,
+	} {
+		data, ok := secret.Data[path.Base(name)]
+		if !ok {
+			return a, nil
+		}
+		values[key] = base64.StdEncoding.EncodeToString(data)
+	}
+	config, err := clientcmd.Load(kubeConfig)
+	if err != nil {
+		return asset.Asset{}, fmt.Errorf("failed to load kubeconfig %s: %v", kubeConfigPath, err)
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return asset.Asset{}, fmt.Errorf("%s: current context %q not found", kubeConfigPath, config.CurrentContext)
+	}
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok {
+		return asset.Asset{}, fmt.Errorf("%s: cluster %q not found", kubeConfigPath, context.Cluster)
+	}
+	values["Server"] = cluster.Server
+	var buf bytes.Buffer
+	if err := adminKubeConfigTemplate.Execute(&buf, values); err != nil {
+		return asset.Asset{}, err
+	}
+	a.Data = buf.Bytes()
+	return a, nil
 }
 
 // setTypeMeta sets the TypeMeta for a runtime.Object.
@@ -1,14 +1,29 @@
 package recovery
 
 import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ghodss/yaml"
 	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
 	v1apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 var (
@@ -99,7 +114,7 @@ var (
 )
 
 func TestExtractBootstrapPods(t *testing.T) {
-	got, err := extractBootstrapPods(cp.daemonSets.Items, cp.deployments.Items)
+	got, err := extractBootstrapPods(cp.daemonSets.Items, cp.deployments.Items, Selection{})
 	want := []v1.Pod{{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Pod",
@@ -270,10 +285,10 @@ func TestFixUpBootstrapPods(t *testing.T) {
 				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/bootstrap-secrets/config-maps/kube-apiserver"}},
 			}, {
 				Name:         "secrets",
-				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/bootstrap-secrets/secrets/kube-apiserver"}},
+				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/bootstrap-secrets"}},
 			}, {
 				Name:         "kubeconfig",
-				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes"}},
+				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/bootstrap-secrets"}},
 			}},
 		},
 	}, {
@@ -300,7 +315,7 @@ func TestFixUpBootstrapPods(t *testing.T) {
 			HostNetwork: true,
 			Volumes: []v1.Volume{{
 				Name:         "kubeconfig",
-				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes"}},
+				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/bootstrap-secrets"}},
 			}},
 		},
 	}, {
@@ -327,12 +342,12 @@ func TestFixUpBootstrapPods(t *testing.T) {
 			HostNetwork: true,
 			Volumes: []v1.Volume{{
 				Name:         "kubeconfig",
-				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes"}},
+				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/kubernetes/bootstrap-secrets"}},
 			}},
 		},
 	}}
 	wantConfigMaps := map[string]string{"kube-apiserver": "tls/config-maps/kube-apiserver"}
-	wantSecrets := map[string]string{"kube-apiserver": "tls/secrets/kube-apiserver"}
+	wantSecrets := map[string]string{"kube-apiserver": "tls"}
 	gotConfigMaps, gotSecrets := fixUpBootstrapPods(pods)
 	if !reflect.DeepEqual(gotSecrets, wantSecrets) || !reflect.DeepEqual(gotConfigMaps, wantConfigMaps) {
 		t.Errorf("fixUpBootstrapPods(%v) = %v, %v, want: %v, %v", pods, gotConfigMaps, gotSecrets, wantConfigMaps, wantSecrets)
@@ -375,6 +390,87 @@ func TestOutputKeyValueDataKeyMissing(t *testing.T) {
 	}
 }
 
+func TestOutputBootstrapSecretsSharedPath(t *testing.T) {
+	secrets := v1.SecretList{Items: []v1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Name: "kube-apiserver", Namespace: "kube-system"}, Data: map[string][]byte{"ca.crt": []byte("ca"), "apiserver.crt": secretData}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "kube-controller-manager", Namespace: "kube-system"}, Data: map[string][]byte{"ca.crt": []byte("ca")}},
+	}}
+	required := map[string]string{"kube-apiserver": "tls", "kube-controller-manager": "tls"}
+	as, err := outputBootstrapSecrets(secrets, required)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(as) != 2 {
+		t.Errorf("got assets %v, want tls/ca.crt once and tls/apiserver.crt", as)
+	}
+
+	secrets.Items[1].Data["ca.crt"] = []byte("other ca")
+	required = map[string]string{"kube-apiserver": "tls", "kube-controller-manager": "tls"}
+	if as, err := outputBootstrapSecrets(secrets, required); err == nil {
+		t.Errorf("outputBootstrapSecrets() = %v, want an error for the different data of tls/ca.crt", as)
+	}
+}
+
+func TestRenderKubeConfig(t *testing.T) {
+	p, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(p)
+	kubeConfig := filepath.Join(p, "kubeconfig")
+	data := []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: https://10.0.0.1:6443
+users:
+- name: kubelet
+  user:
+    token: token
+contexts:
+- context:
+    cluster: local
+    user: kubelet
+  name: kubelet
+current-context: kubelet
+`)
+	if err := ioutil.WriteFile(kubeConfig, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the kube-apiserver secret, the kubeconfig is copied.
+	a, err := renderKubeConfig(kubeConfig, v1.SecretList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != asset.AssetPathAdminKubeConfig || string(a.Data) != string(data) {
+		t.Errorf("got %s:\n%s\nwant a copy of the kubeconfig", a.Name, a.Data)
+	}
+
+	secrets := v1.SecretList{Items: []v1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-apiserver", Namespace: "kube-system"},
+		Data: map[string][]byte{
+			"ca.crt":                       []byte("ca"),
+			"apiserver-kubelet-client.crt": []byte("cert"),
+			"apiserver-kubelet-client.key": []byte("key"),
+		},
+	}}}
+	if a, err = renderKubeConfig(kubeConfig, secrets); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"server: https://10.0.0.1:6443\n",
+		"certificate-authority-data: Y2E=\n",
+		"client-certificate-data: Y2VydA==\n",
+		"client-key-data: a2V5\n",
+	} {
+		if !strings.Contains(string(a.Data), want) {
+			t.Errorf("expected %q in the kubeconfig:\n%s", want, a.Data)
+		}
+	}
+}
+
 func TestIsBootstrapApp(t *testing.T) {
 	for app := range bootstrapK8sApps {
 		labels := map[string]string{
@@ -431,3 +527,532 @@ func TestSetTypeMeta(t *testing.T) {
 func boolPtr(b bool) *bool { return &b }
 
 func int64Ptr(i int64) *int64 { return &i }
+
+func TestRecoveryEtcdHealthProbes(t *testing.T) {
+	p, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(p)
+	if err := StartRecoveryEtcdForBackup(p, "/var/backup/etcd.db"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p, assetPathRecoveryEtcd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pod v1.Pod
+	if err := yaml.Unmarshal(data, &pod); err != nil {
+		t.Fatalf("failed to parse recovery etcd manifest: %v", err)
+	}
+	etcd := pod.Spec.Containers[0]
+	for name, probe := range map[string]*v1.Probe{"liveness": etcd.LivenessProbe, "readiness": etcd.ReadinessProbe} {
+		if probe == nil || probe.Exec == nil {
+			t.Errorf("expected an exec %s probe, got %v", name, probe)
+			continue
+		}
+		if cmd := strings.Join(probe.Exec.Command, " "); !strings.Contains(cmd, "--endpoints="+RecoveryEtcdClientAddr) || !strings.HasSuffix(cmd, "endpoint health") {
+			t.Errorf("unexpected %s probe command %q", name, cmd)
+		}
+	}
+	if pod.Spec.RestartPolicy != v1.RestartPolicyOnFailure {
+		t.Errorf("got restart policy %q, want: %q", pod.Spec.RestartPolicy, v1.RestartPolicyOnFailure)
+	}
+}
+
+func TestSeedEtcd(t *testing.T) {
+	seedCP := &controlPlane{
+		daemonSets: *cp.daemonSets.DeepCopy(),
+		secrets:    *cp.secrets.DeepCopy(),
+	}
+	apiServer := &seedCP.daemonSets.Items[0].Spec.Template.Spec.Containers[0]
+	apiServer.Command = append(apiServer.Command, "--etcd-servers=https://10.3.0.15:2379")
+	for _, s := range []v1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Name: asset.SecretEtcdPeer}, Data: map[string][]byte{"peer.crt": secretData}},
+		{ObjectMeta: metav1.ObjectMeta{Name: asset.SecretEtcdServer}, Data: map[string][]byte{"server.crt": secretData}},
+	} {
+		seedCP.secrets.Items = append(seedCP.secrets.Items, s)
+	}
+	as, err := seedCP.renderBootstrap(Selection{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"tls/etcd/peer.crt", "tls/etcd/server.crt"} {
+		if _, err := as.Get(name); err != nil {
+			t.Error(err)
+		}
+	}
+	a, err := as.Get("bootstrap-manifests/bootstrap-apiserver.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(a.Data), "--etcd-servers="+seedEtcdClientURL) || strings.Contains(string(a.Data), "10.3.0.15") {
+		t.Errorf("expected the bootstrap apiserver to use the seed member:\n%s", a.Data)
+	}
+
+	cluster, err := seedEtcdCluster([]byte(`{"apiVersion":"etcd.database.coreos.com/v1beta2","kind":"EtcdCluster","metadata":{"name":"kube-etcd","namespace":"kube-system","uid":"1234","resourceVersion":"42"},"spec":{"size":3,"version":"3.3.12","selfHosted":{"bootMemberClientEndpoint":"https://10.3.0.20:12379"}},"status":{"phase":"Failed"}}`), net.ParseIP("10.3.0.30"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(cluster, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"apiVersion": "etcd.database.coreos.com/v1beta2",
+		"kind":       "EtcdCluster",
+		"metadata":   map[string]interface{}{"name": "kube-etcd", "namespace": "kube-system"},
+		"spec": map[string]interface{}{
+			"size":       float64(3),
+			"version":    "3.3.12",
+			"selfHosted": map[string]interface{}{"bootMemberClientEndpoint": "https://10.3.0.30:12379"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("seedEtcdCluster() = %v, want: %v", got, want)
+	}
+
+	seed := SeedEtcdConfig{Snapshot: "/var/lib/etcd/member/snap/db", ServiceIP: net.ParseIP("10.3.0.30")}
+	as = seed.assets("/registry", cluster)
+	if a, err = as.Get(assetPathSeedEtcd); err != nil {
+		t.Fatal(err)
+	}
+	var pod v1.Pod
+	if err := yaml.Unmarshal(a.Data, &pod); err != nil {
+		t.Fatalf("failed to parse the seed etcd manifest: %v", err)
+	}
+	for _, w := range []string{"/var/etcd-backupdir/db", "--initial-cluster=boot-etcd=https://10.3.0.30:12380", "del /registry/" + etcdCRDKey, "del --prefix /registry/" + etcdMemberPodPrefix} {
+		if !strings.Contains(string(a.Data), w) {
+			t.Errorf("expected %q in %s:\n%s", w, assetPathSeedEtcd, a.Data)
+		}
+	}
+	if pod.Spec.Volumes[1].HostPath.Path != "/var/lib/etcd/member/snap/" {
+		t.Errorf("got snapshot dir %s, want: /var/lib/etcd/member/snap/", pod.Spec.Volumes[1].HostPath.Path)
+	}
+	etcd := pod.Spec.Containers[0]
+	for name, probe := range map[string]*v1.Probe{"liveness": etcd.LivenessProbe, "readiness": etcd.ReadinessProbe} {
+		if probe == nil || probe.Exec == nil {
+			t.Errorf("expected an exec %s probe, got %v", name, probe)
+			continue
+		}
+		cmd := strings.Join(probe.Exec.Command, " ")
+		for _, w := range []string{"--endpoints=" + seedEtcdClientURL, "--cacert=/etc/kubernetes/secrets/etcd/server-ca.crt", "--cert=/etc/kubernetes/secrets/etcd-client.crt", "--key=/etc/kubernetes/secrets/etcd-client.key"} {
+			if !strings.Contains(cmd, w) {
+				t.Errorf("expected %q in the %s probe command %q", w, name, cmd)
+			}
+		}
+		if !strings.HasSuffix(cmd, "endpoint health") {
+			t.Errorf("unexpected %s probe command %q", name, cmd)
+		}
+	}
+	if pod.Spec.RestartPolicy != v1.RestartPolicyOnFailure {
+		t.Errorf("got restart policy %q, want: %q", pod.Spec.RestartPolicy, v1.RestartPolicyOnFailure)
+	}
+	if a, err = as.Get(assetPathSeedEtcdService); err != nil {
+		t.Fatal(err)
+	}
+	var svc v1.Service
+	if err := json.Unmarshal(a.Data, &svc); err != nil || svc.Spec.ClusterIP != "10.3.0.30" {
+		t.Errorf("got service %s, %v, want the cluster IP 10.3.0.30", a.Data, err)
+	}
+}
+
+type fakeBackend struct {
+	cp *controlPlane
+}
+
+func (b fakeBackend) read(context.Context, []string) (*controlPlane, error) {
+	return b.cp, nil
+}
+
+func TestPlanRecover(t *testing.T) {
+	planCP := &controlPlane{
+		configMaps:  *cp.configMaps.DeepCopy(),
+		daemonSets:  *cp.daemonSets.DeepCopy(),
+		deployments: *cp.deployments.DeepCopy(),
+	}
+	plan, err := PlanRecover(context.Background(), fakeBackend{planCP}, "/nonexistent/kubeconfig", Selection{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Plan{
+		Found: []string{
+			"ConfigMap kube-system/kube-apiserver",
+			"DaemonSet kube-system/kube-apiserver",
+			"Deployment kube-system/kube-scheduler",
+		},
+		Assets: []string{
+			"bootstrap-manifests/bootstrap-apiserver.yaml",
+			"bootstrap-manifests/bootstrap-scheduler.yaml",
+		},
+		Missing: []string{
+			"DaemonSet or Deployment kube-system/kube-controller-manager",
+			"Secret kube-system/kube-apiserver",
+			"kubeconfig /nonexistent/kubeconfig",
+		},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("PlanRecover() = %+v, want: %+v", plan, want)
+	}
+
+	// A recoverable control plane.
+	p, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(p)
+	kubeConfig := filepath.Join(p, "kubeconfig")
+	if err := ioutil.WriteFile(kubeConfig, []byte("apiVersion: v1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// fixUpBootstrapPods changed the volumes of the daemonset.
+	planCP.daemonSets = *cp.daemonSets.DeepCopy()
+	planCP.secrets = *cp.secrets.DeepCopy()
+	planCP.deployments.Items = append(planCP.deployments.Items, v1apps.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-controller-manager", Namespace: "kube-system", Labels: map[string]string{"component": "kube-controller-manager"}},
+	})
+	if plan, err = PlanRecover(context.Background(), fakeBackend{planCP}, kubeConfig, Selection{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Missing) != 0 {
+		t.Errorf("got missing objects %v, want none", plan.Missing)
+	}
+	for _, w := range []string{"tls/apiserver.crt", asset.AssetPathAdminKubeConfig} {
+		found := false
+		for _, a := range plan.Assets {
+			found = found || a == w
+		}
+		if !found {
+			t.Errorf("expected asset %s in %v", w, plan.Assets)
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	sel := Selection{
+		Namespaces: []string{"control-plane", "kube-system", "control-plane"},
+		Selector:   labels.SelectorFromSet(labels.Set{"tier": "control-plane"}),
+	}
+	if got, want := sel.namespaces(), []string{"kube-system", "control-plane"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaces() = %v, want: %v", got, want)
+	}
+
+	selCP := &controlPlane{
+		daemonSets: v1apps.DaemonSetList{Items: []v1apps.DaemonSet{{
+			ObjectMeta: metav1.ObjectMeta{Name: "apiserver", Namespace: "control-plane", Labels: map[string]string{"tier": "control-plane"}},
+			Spec: v1apps.DaemonSetSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "apiserver", Command: []string{"kube-apiserver"}}},
+				Volumes: []v1.Volume{{
+					Name:         "secrets",
+					VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "apiserver"}},
+				}},
+			}}},
+		}, {
+			// The default selection of the kube-apiserver app doesn't apply.
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-apiserver", Namespace: "kube-system", Labels: map[string]string{"k8s-app": "kube-apiserver"}},
+		}}},
+		secrets: v1.SecretList{Items: []v1.Secret{
+			{ObjectMeta: metav1.ObjectMeta{Name: "apiserver", Namespace: "kube-system"}, Data: map[string][]byte{"other.crt": secretData}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "apiserver", Namespace: "control-plane"}, Data: map[string][]byte{"apiserver.crt": secretData}},
+		}},
+	}
+	as, err := selCP.renderBootstrap(sel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range as {
+		names = append(names, a.Name)
+	}
+	if want := []string{"bootstrap-manifests/bootstrap-apiserver.yaml", "tls/secrets/control-plane/apiserver/apiserver.crt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got assets %v, want: %v", names, want)
+	}
+	if !strings.Contains(string(as[0].Data), "path: /etc/kubernetes/bootstrap-secrets/secrets/control-plane/apiserver\n") {
+		t.Errorf("expected the secret of the control-plane namespace mounted from the bootstrap secrets:\n%s", as[0].Data)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	p, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(p)
+	backup := filepath.Join(p, "control-plane.json")
+
+	bcp := &controlPlane{
+		configMaps:  *cp.configMaps.DeepCopy(),
+		daemonSets:  *cp.daemonSets.DeepCopy(),
+		deployments: *cp.deployments.DeepCopy(),
+		secrets:     *cp.secrets.DeepCopy(),
+	}
+	client := fake.NewSimpleClientset(
+		&bcp.configMaps.Items[0],
+		&bcp.daemonSets.Items[0],
+		&bcp.deployments.Items[0],
+		&bcp.secrets.Items[0],
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "kube-system"}},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- NewBackupController(client, Selection{}, backup, 10*time.Millisecond).Run(ctx)
+	}()
+	for i := 0; ; i++ {
+		if _, err := os.Stat(backup); err == nil {
+			break
+		} else if i == 100 {
+			t.Fatalf("no backup written: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// The backup holds the control plane and the Secrets it mounts, and nothing else.
+	got, err := PlanRecover(context.Background(), NewBackupBackend(backup), "/nonexistent/kubeconfig", Selection{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"DaemonSet kube-system/kube-apiserver",
+		"Deployment kube-system/kube-scheduler",
+		"Secret kube-system/kube-apiserver",
+	}
+	if !reflect.DeepEqual(got.Found, want) {
+		t.Errorf("got %v in the backup, want: %v", got.Found, want)
+	}
+	found := false
+	for _, name := range got.Assets {
+		found = found || name == "tls/apiserver.crt"
+	}
+	if !found {
+		t.Errorf("expected tls/apiserver.crt recovered from the backup in %v", got.Assets)
+	}
+}
+
+func TestManifestDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range map[string]string{
+		// kubectl get daemonsets,pods -n kube-system -o yaml
+		"kube-system.yaml": `apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: DaemonSet
+  metadata:
+    name: kube-apiserver
+    namespace: kube-system
+    labels:
+      k8s-app: kube-apiserver
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: kube-apiserver-x8k2p
+    namespace: kube-system
+`,
+		"configmaps.yml": `---
+apiVersion: v1
+kind: ConfigMapList
+items:
+- metadata:
+    name: kube-apiserver
+    namespace: kube-system
+  data:
+    key: value
+---
+`,
+		"other.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kube-scheduler
+  namespace: other
+`,
+		// A velero backup keeps the objects of every version of a resource.
+		"resources/secrets/namespaces/kube-system/kube-apiserver.json":                     `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"kube-apiserver","namespace":"kube-system"},"data":{"apiserver.crt":"c2VjcmV0"}}`,
+		"resources/secrets/v1-preferredversion/namespaces/kube-system/kube-apiserver.json": `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"kube-apiserver","namespace":"kube-system"},"data":{"apiserver.crt":"c2VjcmV0"}}`,
+		"README.txt": "not a manifest",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := PlanRecover(context.Background(), NewManifestDirBackend(dir), "/nonexistent/kubeconfig", Selection{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ConfigMap kube-system/kube-apiserver",
+		"DaemonSet kube-system/kube-apiserver",
+		"Secret kube-system/kube-apiserver",
+	}
+	if !reflect.DeepEqual(plan.Found, want) {
+		t.Errorf("got %v in the manifests, want: %v", plan.Found, want)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "invalid.yaml"), []byte("kind: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewManifestDirBackend(dir).read(context.Background(), []string{"kube-system"}); err == nil {
+		t.Error("expected an error for an invalid manifest")
+	}
+}
+
+func TestRenewExpiredCerts(t *testing.T) {
+	now := time.Now().Add(2 * time.Hour)
+	newCA := func() (*x509.Certificate, *rsa.PrivateKey) {
+		key, err := tlsutil.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := tlsutil.NewSelfSignedCACertificate(tlsutil.CertConfig{CommonName: "kube-ca"}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+	newCert := func(caCert *x509.Certificate, caKey *rsa.PrivateKey, cfg tlsutil.CertConfig) []byte {
+		key, err := tlsutil.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := tlsutil.NewSignedCertificate(cfg, key, caCert, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tlsutil.EncodeCertificatePEM(cert)
+	}
+	caCert, caKey := newCA()
+	otherCACert, otherCAKey := newCA()
+	expired := newCert(caCert, caKey, tlsutil.CertConfig{
+		CommonName: "kube-apiserver",
+		AltNames:   tlsutil.AltNames{DNSNames: []string{"kubernetes"}, IPs: []net.IP{net.ParseIP("10.3.0.1")}},
+		Validity:   time.Hour,
+	})
+	as := asset.Assets{
+		{Name: asset.AssetPathCACert, Data: tlsutil.EncodeCertificatePEM(caCert)},
+		{Name: asset.AssetPathAPIServerCert, Data: expired},
+		{Name: asset.AssetPathAdminKubeConfig, Data: []byte("client-certificate-data: " + base64.StdEncoding.EncodeToString(expired) + "\n")},
+		{Name: asset.AssetPathKubeletClientCert, Data: newCert(caCert, caKey, tlsutil.CertConfig{CommonName: "kubelet"})},
+		{Name: asset.AssetPathFrontProxyClientCert, Data: newCert(otherCACert, otherCAKey, tlsutil.CertConfig{CommonName: "front-proxy", Validity: time.Hour})},
+	}
+
+	want := []string{asset.AssetPathAPIServerCert, asset.AssetPathFrontProxyClientCert}
+	if got := ExpiredCerts(as, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpiredCerts() = %v, want %v", got, want)
+	}
+	renewed, notRenewed, err := RenewExpiredCerts(as, caCert, caKey, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{asset.AssetPathAPIServerCert}; !reflect.DeepEqual(renewed, want) {
+		t.Errorf("renewed %v, want %v", renewed, want)
+	}
+	if want := []string{asset.AssetPathFrontProxyClientCert}; !reflect.DeepEqual(notRenewed, want) {
+		t.Errorf("did not renew %v, want %v", notRenewed, want)
+	}
+
+	cert, err := tlsutil.ParsePEMEncodedCACert(as[1].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := tlsutil.ParsePEMEncodedCACert(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !now.Before(cert.NotAfter) {
+		t.Errorf("renewed certificate expires at %s", cert.NotAfter)
+	}
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("renewed certificate is not signed by the CA: %v", err)
+	}
+	if cert.Subject.CommonName != "kube-apiserver" || !reflect.DeepEqual(cert.DNSNames, old.DNSNames) || !cert.IPAddresses[0].Equal(old.IPAddresses[0]) {
+		t.Errorf("renewed certificate has subject %s, DNS names %v and IPs %v, want those of the expired one", cert.Subject, cert.DNSNames, cert.IPAddresses)
+	}
+	if !reflect.DeepEqual(cert.PublicKey, old.PublicKey) {
+		t.Error("renewed certificate does not keep the key of the expired one")
+	}
+	if want := "client-certificate-data: " + base64.StdEncoding.EncodeToString(as[1].Data) + "\n"; string(as[2].Data) != want {
+		t.Errorf("kubeconfig embeds %q, want the renewed certificate", as[2].Data)
+	}
+	if got := ExpiredCerts(as, now); !reflect.DeepEqual(got, []string{asset.AssetPathFrontProxyClientCert}) {
+		t.Errorf("ExpiredCerts() = %v after renewal", got)
+	}
+
+	if _, _, err := RenewExpiredCerts(as, caCert, caKey, now.Add(20*365*24*time.Hour)); err == nil {
+		t.Error("expected renewal with an expired CA to fail")
+	}
+}
+
+func TestEtcdConfigFromManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "bootstrap-apiserver.yaml")
+	if err := ioutil.WriteFile(p, []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: bootstrap-kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - name: kube-apiserver
+    command:
+    - /hyperkube
+    - kube-apiserver
+    - --etcd-cafile=/etc/kubernetes/secrets/etcd-client-ca.crt
+    - --etcd-certfile=/etc/kubernetes/secrets/etcd/etcd-client.crt
+    - --etcd-keyfile=/etc/kubernetes/secrets/etcd/etcd-client.key
+    - --etcd-prefix
+    - /cluster
+    - --etcd-servers=https://10.0.0.1:2379,https://10.0.0.2:2379
+    volumeMounts:
+    - mountPath: /etc/kubernetes/secrets
+      name: secrets
+    - mountPath: /etc/kubernetes/secrets/etcd
+      name: etcd
+  volumes:
+  - name: secrets
+    hostPath:
+      path: /etc/kubernetes/bootstrap-secrets
+  - name: etcd
+    hostPath:
+      path: /etc/etcd/tls
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := EtcdConfigFromManifest(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EtcdConfig{
+		Servers:  []string{"https://10.0.0.1:2379", "https://10.0.0.2:2379"},
+		Prefix:   "/cluster",
+		CAFile:   "/etc/kubernetes/bootstrap-secrets/etcd-client-ca.crt",
+		CertFile: "/etc/etcd/tls/etcd-client.crt",
+		KeyFile:  "/etc/etcd/tls/etcd-client.key",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+
+	if err := ioutil.WriteFile(p, []byte("apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: kube-scheduler\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EtcdConfigFromManifest(p); err == nil {
+		t.Error("expected an error for a manifest without --etcd-servers")
+	}
+}
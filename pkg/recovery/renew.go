@@ -0,0 +1,111 @@
+package recovery
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+	"github.com/kubernetes-sigs/bootkube/pkg/tlsutil"
+)
+
+// renewClockSkew is subtracted from the NotBefore of renewed certificates.
+const renewClockSkew = 5 * time.Minute
+
+// ExpiredCerts returns the names of the assets holding a leaf certificate that expired before now,
+// a common reason for a control plane to be down.
+func ExpiredCerts(as asset.Assets, now time.Time) []string {
+	var names []string
+	for _, a := range as {
+		if cert := leafCert(a); cert != nil && now.After(cert.NotAfter) {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// RenewExpiredCerts re-issues the expired leaf certificates of as that are signed by caCert, in
+// place. A renewed certificate keeps the public key, subject, alternative names and usages of the
+// expired one, and is valid for as long from now. Where another asset embeds the expired
+// certificate, like a kubeconfig, it is replaced too. RenewExpiredCerts returns the names of the
+// renewed certificates, and of the expired ones signed by another CA, which it can't renew.
+func RenewExpiredCerts(as asset.Assets, caCert *x509.Certificate, caKey *rsa.PrivateKey, now time.Time) (renewed, notRenewed []string, err error) {
+	if now.After(caCert.NotAfter) {
+		return nil, nil, fmt.Errorf("the CA %s expired at %s", caCert.Subject.CommonName, caCert.NotAfter.Format(time.RFC3339))
+	}
+	for i := range as {
+		cert := leafCert(as[i])
+		if cert == nil || !now.After(cert.NotAfter) {
+			continue
+		}
+		if err := cert.CheckSignatureFrom(caCert); err != nil {
+			notRenewed = append(notRenewed, as[i].Name)
+			continue
+		}
+		renewedCert, err := renewCert(cert, caCert, caKey, now)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to renew %s: %v", as[i].Name, err)
+		}
+		// Further certificates of the file, like intermediate CAs, are kept.
+		_, rest := pem.Decode(as[i].Data)
+		data := append(tlsutil.EncodeCertificatePEM(renewedCert), rest...)
+		old, updated := base64.StdEncoding.EncodeToString(as[i].Data), base64.StdEncoding.EncodeToString(data)
+		for j := range as {
+			if j != i {
+				as[j].Data = bytes.Replace(as[j].Data, []byte(old), []byte(updated), -1)
+			}
+		}
+		as[i].Data = data
+		renewed = append(renewed, as[i].Name)
+	}
+	return renewed, notRenewed, nil
+}
+
+// leafCert returns the first certificate of a .crt asset unless it is a CA, or nil.
+func leafCert(a asset.Asset) *x509.Certificate {
+	if !strings.HasSuffix(a.Name, ".crt") {
+		return nil
+	}
+	block, _ := pem.Decode(a.Data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || cert.IsCA {
+		return nil
+	}
+	return cert
+}
+
+// renewCert signs a copy of cert valid from now for as long as cert was.
+func renewCert(cert, caCert *x509.Certificate, caKey *rsa.PrivateKey, now time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := x509.Certificate{
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		IPAddresses:    cert.IPAddresses,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           cert.URIs,
+		SerialNumber:   serial,
+		NotBefore:      now.Add(-renewClockSkew).UTC(),
+		NotAfter:       now.Add(cert.NotAfter.Sub(cert.NotBefore)).UTC(),
+		KeyUsage:       cert.KeyUsage,
+		ExtKeyUsage:    cert.ExtKeyUsage,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, cert.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,153 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-sigs/bootkube/cmd/render/plugin/default/asset"
+)
+
+const (
+	assetPathSeedEtcd        = "bootstrap-manifests/bootstrap-etcd.yaml"
+	assetPathSeedEtcdService = "manifests/bootstrap-etcd-service.json"
+	assetPathSeedEtcdCluster = "manifests/kube-etcd-cluster.json"
+	// seedEtcdClientURL is where the bootstrap apiserver reaches the seed member, on the host
+	// network of the node: the bootstrap-etcd-service only routes once kube-proxy runs.
+	seedEtcdClientURL = "https://127.0.0.1:12379"
+	// seedEtcdClusterToken is the initial cluster token of the seed member, which keeps members
+	// of the lost etcd cluster from joining it.
+	seedEtcdClusterToken = "bootkube-seed-etcd"
+)
+
+// SeedEtcdConfig configures the single-member etcd RecoverSeedEtcd reconstitutes a self-hosted
+// etcd cluster from.
+type SeedEtcdConfig struct {
+	// Snapshot is the absolute path of the etcd snapshot restored into the seed member, as saved
+	// by etcdctl snapshot save or the database of a member, see SnapshotFromDataDir. It must
+	// still be there when bootkube start runs.
+	Snapshot string
+	// ServiceIP is the cluster IP of the bootstrap-etcd-service in the service CIDR of the
+	// cluster, through which the etcd-operator grows the self-hosted cluster from the seed member.
+	ServiceIP net.IP
+}
+
+// SnapshotFromDataDir returns the database in the data dir of an etcd member, which etcdctl
+// snapshot restore reads like a snapshot, though without an integrity hash. The member must be
+// stopped.
+func SnapshotFromDataDir(dataDir string) string {
+	return filepath.Join(dataDir, "member", "snap", "db")
+}
+
+// RecoverSeedEtcd recovers a control plane like Recover, and additionally renders the assets
+// recovering the self-hosted etcd cluster of the etcd backend, which lost its quorum: a boot-etcd
+// seed member restored from seed.Snapshot, the bootstrap apiserver using it, and the kube-etcd
+// EtcdCluster with which the etcd-operator scales the self-hosted cluster back out from the seed
+// member. bootkube start then removes the seed member after the pivot.
+func RecoverSeedEtcd(ctx context.Context, backend Backend, kubeConfigPath string, sel Selection, seed SeedEtcdConfig) (asset.Assets, error) {
+	eb, ok := backend.(*etcdBackend)
+	if !ok {
+		return nil, errors.New("only a control plane recovered from etcd can seed etcd")
+	}
+	if !filepath.IsAbs(seed.Snapshot) {
+		return nil, fmt.Errorf("the etcd snapshot %s must be an absolute path", seed.Snapshot)
+	}
+	if seed.ServiceIP == nil {
+		return nil, errors.New("the bootstrap etcd service needs a cluster IP")
+	}
+	cluster, err := eb.getBytes(ctx, etcdCRDKey)
+	if err != nil {
+		return nil, fmt.Errorf("no self-hosted etcd cluster to seed: %v", err)
+	}
+	cluster, err = seedEtcdCluster(cluster, seed.ServiceIP)
+	if err != nil {
+		return nil, err
+	}
+	as, err := recoverControlPlane(ctx, backend, kubeConfigPath, sel, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(as, seed.assets(eb.pathPrefix, cluster)...), nil
+}
+
+// assets returns the seed member, its service and the EtcdCluster growing from it.
+func (seed SeedEtcdConfig) assets(pathPrefix string, cluster []byte) asset.Assets {
+	d, f := path.Split(seed.Snapshot)
+	config := struct {
+		Image             string
+		BackupFile        string
+		BackupDir         string
+		BootEtcdServiceIP string
+		ClusterToken      string
+		CRDKey            string
+		MemberPodPrefix   string
+	}{
+		Image:             asset.DefaultImages.Etcd,
+		BackupFile:        f,
+		BackupDir:         d,
+		BootEtcdServiceIP: seed.ServiceIP.String(),
+		ClusterToken:      seedEtcdClusterToken,
+		// The EtcdCluster and the member pods of the lost cluster are removed from the restored
+		// data, so that the etcd-operator starts the members anew.
+		CRDKey:          path.Join(pathPrefix, etcdCRDKey),
+		MemberPodPrefix: path.Join(pathPrefix, etcdMemberPodPrefix),
+	}
+	return asset.Assets{
+		asset.MustCreateAssetFromTemplate(assetPathSeedEtcd, bootFromBackupEtcdTemplate, config),
+		asset.MustCreateAssetFromTemplate(assetPathSeedEtcdService, recoveryEtcdSvcTemplate, config),
+		{Name: assetPathSeedEtcdCluster, Data: cluster},
+	}
+}
+
+// seedEtcdCluster returns the EtcdCluster stored in etcd as a manifest creating it anew, self-hosted
+// and grown from the boot-etcd seed member behind serviceIP.
+func seedEtcdCluster(data []byte, serviceIP net.IP) ([]byte, error) {
+	var cluster map[string]interface{}
+	if err := json.Unmarshal(data, &cluster); err != nil {
+		return nil, fmt.Errorf("failed to decode the self-hosted etcd cluster: %v", err)
+	}
+	metadata, _ := cluster["metadata"].(map[string]interface{})
+	spec, _ := cluster["spec"].(map[string]interface{})
+	if metadata == nil || spec == nil {
+		return nil, errors.New("the self-hosted etcd cluster has no metadata or spec")
+	}
+	for _, field := range []string{"creationTimestamp", "generation", "managedFields", "resourceVersion", "selfLink", "uid"} {
+		delete(metadata, field)
+	}
+	delete(cluster, "status")
+	selfHosted, _ := spec["selfHosted"].(map[string]interface{})
+	if selfHosted == nil {
+		selfHosted = map[string]interface{}{}
+	}
+	selfHosted["bootMemberClientEndpoint"] = "https://" + net.JoinHostPort(serviceIP.String(), "12379")
+	spec["selfHosted"] = selfHosted
+	return json.MarshalIndent(cluster, "", "  ")
+}
+
+// seedEtcdServers points the bootstrap apiservers at the seed member, and maps the etcd peer and
+// server TLS secrets the seed member reads to the bootstrap secrets.
+func seedEtcdServers(pods []v1.Pod, requiredSecrets map[string]string) {
+	for i := range pods {
+		for j := range pods[i].Spec.Containers {
+			cn := &pods[i].Spec.Containers[j]
+			if cn.Name != apiServerContainerName {
+				continue
+			}
+			for k, arg := range cn.Command {
+				if strings.HasPrefix(arg, "--etcd-servers=") {
+					cn.Command[k] = "--etcd-servers=" + seedEtcdClientURL
+				}
+			}
+		}
+	}
+	for _, name := range []string{asset.SecretEtcdPeer, asset.SecretEtcdServer} {
+		requiredSecrets[name] = path.Join(asset.AssetPathSecrets, "etcd")
+	}
+}
@@ -0,0 +1,54 @@
+package recovery
+
+import (
+	"path"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// recoveryNamespace is the namespace the control plane is always recovered from.
+const recoveryNamespace = "kube-system"
+
+// Selection tells a recovery which objects make up the control plane, for control planes that
+// differ from what bootkube render outputs.
+type Selection struct {
+	// Namespaces are read from the backend besides kube-system, e.g. a custom control plane
+	// namespace or that of an operator the control plane needs.
+	Namespaces []string
+	// Selector selects the DaemonSets and Deployments of the bootstrap control plane, e.g. renamed
+	// components. If nil, those of the kube-apiserver, kube-controller-manager and kube-scheduler
+	// apps are selected.
+	Selector labels.Selector
+}
+
+// namespaces returns the namespaces to read from the backend.
+func (s Selection) namespaces() []string {
+	namespaces := []string{recoveryNamespace}
+	seen := map[string]bool{recoveryNamespace: true}
+	for _, ns := range s.Namespaces {
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// selects reports whether a DaemonSet or Deployment with the labels belongs to the bootstrap
+// control plane.
+func (s Selection) selects(l map[string]string) bool {
+	if s.Selector == nil {
+		return isBootstrapApp(l)
+	}
+	return s.Selector.Matches(labels.Set(l))
+}
+
+// objectKey returns the key of a ConfigMap or Secret required by the bootstrap control plane: its
+// name in kube-system, and "<namespace>/<name>" in other namespaces. The key is also the path of
+// its data below the bootstrap secrets.
+func objectKey(namespace, name string) string {
+	if namespace == "" || namespace == recoveryNamespace {
+		return name
+	}
+	return path.Join(namespace, name)
+}
@@ -0,0 +1,23 @@
+//go:build go1.18
+// +build go1.18
+
+package tlsutil
+
+import "testing"
+
+// FuzzParsePEM checks that malformed input is rejected with an error instead of a panic.
+func FuzzParsePEM(f *testing.F) {
+	keyPEM, certPEM := newTestCA(f)
+	f.Add(certPEM)
+	f.Add(keyPEM)
+	f.Add(append(append([]byte{0xEF, 0xBB, 0xBF}, certPEM...), keyPEM...))
+	f.Add([]byte("-----BEGIN CERTIFICATE-----\r\n\r\n-----END CERTIFICATE-----\r\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if cert, err := ParsePEMEncodedCACert(data); err == nil && cert == nil {
+			t.Error("nil certificate without an error")
+		}
+		if key, err := ParsePEMEncodedPrivateKey(data); err == nil && key == nil {
+			t.Error("nil key without an error")
+		}
+	})
+}
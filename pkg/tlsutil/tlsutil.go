@@ -1,21 +1,27 @@
 package tlsutil
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"math"
 	"math/big"
 	"net"
+	"strings"
 	"time"
 )
 
 const (
 	RSAKeySize   = 2048
 	Duration365d = time.Hour * 24 * 365
+
+	// clockSkew is subtracted from the NotBefore of short-lived certificates.
+	clockSkew = 5 * time.Minute
 )
 
 type CertConfig struct {
@@ -23,6 +29,10 @@ type CertConfig struct {
 	Organization       []string
 	OrganizationalUnit []string
 	AltNames           AltNames
+	// Validity overrides the default validity of signed certificates when non-zero.
+	Validity time.Duration
+	// ClientOnly restricts signed certificates to client authentication.
+	ClientOnly bool
 }
 
 // AltNames contains the domain names and IP addresses that will be added
@@ -88,20 +98,106 @@ func NewSelfSignedCACertificate(cfg CertConfig, key *rsa.PrivateKey) (*x509.Cert
 	return x509.ParseCertificate(certDERBytes)
 }
 
-func ParsePEMEncodedCACert(pemdata []byte) (*x509.Certificate, error) {
-	decoded, _ := pem.Decode(pemdata)
-	if decoded == nil {
+// ParsePEMBlocks decodes all PEM blocks of pemdata. Concatenated bundles, CRLF line endings, a
+// leading UTF-8 byte order mark and text around the blocks (e.g. comments) are accepted.
+func ParsePEMBlocks(pemdata []byte) ([]*pem.Block, error) {
+	rest := bytes.TrimPrefix(pemdata, utf8BOM)
+	rest = bytes.Replace(rest, []byte("\r\n"), []byte("\n"), -1)
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		if _, err := x509.ParseCertificate(pemdata); err == nil {
+			return nil, errors.New("no PEM data found, the data is a DER encoded certificate")
+		}
+		if bytes.Contains(rest, []byte("-----BEGIN")) {
+			return nil, errors.New("no PEM data found, a PEM block is malformed or truncated")
+		}
 		return nil, errors.New("no PEM data found")
 	}
-	return x509.ParseCertificate(decoded.Bytes)
+	return blocks, nil
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ParsePEMEncodedCACert parses the first certificate of pemdata.
+func ParsePEMEncodedCACert(pemdata []byte) (*x509.Certificate, error) {
+	certs, err := ParsePEMEncodedCerts(pemdata)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
 }
 
+// ParsePEMEncodedCerts parses all certificates of a PEM bundle. Errors identify the offending
+// block by its index, starting at 0.
+func ParsePEMEncodedCerts(pemdata []byte) ([]*x509.Certificate, error) {
+	blocks, err := ParsePEMBlocks(pemdata)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for i, block := range blocks {
+		if block.Type != "CERTIFICATE" {
+			if strings.Contains(block.Type, "PRIVATE KEY") {
+				return nil, fmt.Errorf("PEM block %d: expected CERTIFICATE, got %s", i, block.Type)
+			}
+			// Skip other blocks such as parameters.
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("PEM block %d: %v", i, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no CERTIFICATE found in %d PEM block(s)", len(blocks))
+	}
+	return certs, nil
+}
+
+// ParsePEMEncodedPrivateKey parses the first private key of pemdata, in PKCS#1 or PKCS#8 form.
+// Only unencrypted RSA keys are supported.
 func ParsePEMEncodedPrivateKey(pemdata []byte) (*rsa.PrivateKey, error) {
-	decoded, _ := pem.Decode(pemdata)
-	if decoded == nil {
-		return nil, errors.New("no PEM data found")
+	blocks, err := ParsePEMBlocks(pemdata)
+	if err != nil {
+		return nil, err
+	}
+	for i, block := range blocks {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			if _, ok := block.Headers["DEK-Info"]; ok {
+				return nil, fmt.Errorf("PEM block %d: the private key is encrypted, decrypt it first (openssl rsa -in <key> -out <decrypted key>)", i)
+			}
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("PEM block %d: %v", i, err)
+			}
+			return key, nil
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("PEM block %d: %v", i, err)
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("PEM block %d: expected an RSA private key, got %T", i, key)
+			}
+			return rsaKey, nil
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, fmt.Errorf("PEM block %d: the private key is encrypted, decrypt it first (openssl pkcs8 -in <key> -out <decrypted key>)", i)
+		case "EC PRIVATE KEY":
+			return nil, fmt.Errorf("PEM block %d: expected an RSA private key, got %s", i, block.Type)
+		}
 	}
-	return x509.ParsePKCS1PrivateKey(decoded.Bytes)
+	return nil, fmt.Errorf("no private key found in %d PEM block(s)", len(blocks))
 }
 
 func NewSignedCertificate(cfg CertConfig, key *rsa.PrivateKey, caCert *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, error) {
@@ -110,18 +206,30 @@ func NewSignedCertificate(cfg CertConfig, key *rsa.PrivateKey, caCert *x509.Cert
 		return nil, err
 	}
 
+	notBefore, notAfter := caCert.NotBefore, time.Now().Add(Duration365d).UTC()
+	if cfg.Validity != 0 {
+		// Short-lived certificates shouldn't be valid before they were issued.
+		notBefore = time.Now().Add(-clockSkew).UTC()
+		notAfter = time.Now().Add(cfg.Validity).UTC()
+	}
+	extKeyUsage := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	if cfg.ClientOnly {
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
 	certTmpl := x509.Certificate{
 		Subject: pkix.Name{
-			CommonName:   cfg.CommonName,
-			Organization: cfg.Organization,
+			CommonName:         cfg.CommonName,
+			Organization:       cfg.Organization,
+			OrganizationalUnit: cfg.OrganizationalUnit,
 		},
 		DNSNames:     cfg.AltNames.DNSNames,
 		IPAddresses:  cfg.AltNames.IPs,
 		SerialNumber: serial,
-		NotBefore:    caCert.NotBefore,
-		NotAfter:     time.Now().Add(Duration365d).UTC(),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
 		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		ExtKeyUsage:  extKeyUsage,
 	}
 	certDERBytes, err := x509.CreateCertificate(rand.Reader, &certTmpl, caCert, key.Public(), caKey)
 	if err != nil {
@@ -129,3 +237,22 @@ func NewSignedCertificate(cfg CertConfig, key *rsa.PrivateKey, caCert *x509.Cert
 	}
 	return x509.ParseCertificate(certDERBytes)
 }
+
+// NewCertificateRequestPEM returns a PEM encoded certificate signing request for the given config,
+// for use when the certificate is signed by an external CA.
+func NewCertificateRequestPEM(cfg CertConfig, key *rsa.PrivateKey) ([]byte, error) {
+	tmpl := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:         cfg.CommonName,
+			Organization:       cfg.Organization,
+			OrganizationalUnit: cfg.OrganizationalUnit,
+		},
+		DNSNames:    cfg.AltNames.DNSNames,
+		IPAddresses: cfg.AltNames.IPs,
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &tmpl, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
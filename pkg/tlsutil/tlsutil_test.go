@@ -0,0 +1,140 @@
+package tlsutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func newTestCA(t testing.TB) (keyPEM, certPEM []byte) {
+	key, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := NewSelfSignedCACertificate(CertConfig{CommonName: "test-ca"}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return EncodePrivateKeyPEM(key), EncodeCertificatePEM(cert)
+}
+
+func TestParsePEMEncodedCACert(t *testing.T) {
+	_, certPEM := newTestCA(t)
+	_, otherPEM := newTestCA(t)
+	crlf := bytes.Replace(certPEM, []byte("\n"), []byte("\r\n"), -1)
+
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"plain", certPEM},
+		{"BOM", append([]byte{0xEF, 0xBB, 0xBF}, certPEM...)},
+		{"CRLF", crlf},
+		{"BOM and CRLF", append([]byte{0xEF, 0xBB, 0xBF}, crlf...)},
+		{"leading comment", append([]byte("# cluster CA\nsubject=CN = test-ca\n"), certPEM...)},
+		{"bundle", append(append([]byte{}, certPEM...), otherPEM...)},
+	} {
+		cert, err := ParsePEMEncodedCACert(c.data)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if cert.Subject.CommonName != "test-ca" {
+			t.Errorf("%s: got CN %q", c.name, cert.Subject.CommonName)
+		}
+	}
+
+	certs, err := ParsePEMEncodedCerts(append(append([]byte{}, certPEM...), otherPEM...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Errorf("got %d certificates from bundle, want: 2", len(certs))
+	}
+}
+
+func TestParsePEMEncodedCACertErrors(t *testing.T) {
+	keyPEM, certPEM := newTestCA(t)
+	block, _ := pem.Decode(certPEM)
+	corrupt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes[:len(block.Bytes)/2]})
+
+	for _, c := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "no PEM data found"},
+		{"DER", block.Bytes, "DER encoded"},
+		{"truncated", certPEM[:len(certPEM)-20], "malformed or truncated"},
+		{"private key", keyPEM, "PEM block 0: expected CERTIFICATE, got RSA PRIVATE KEY"},
+		{"corrupt second block", append(append([]byte{}, certPEM...), corrupt...), "PEM block 1:"},
+	} {
+		_, err := ParsePEMEncodedCACert(c.data)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected error containing %q, got: %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestParsePEMEncodedPrivateKey(t *testing.T) {
+	keyPEM, certPEM := newTestCA(t)
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"PKCS#1", keyPEM},
+		{"PKCS#8", pkcs8PEM},
+		{"CRLF", bytes.Replace(keyPEM, []byte("\n"), []byte("\r\n"), -1)},
+		{"cert and key bundle", append(append([]byte{}, certPEM...), keyPEM...)},
+	} {
+		got, err := ParsePEMEncodedPrivateKey(c.data)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got.N.Cmp(key.N) != 0 {
+			t.Errorf("%s: parsed a different key", c.name)
+		}
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-128-CBC,00000000000000000000000000000000"}, Bytes: block.Bytes})
+	for _, c := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"encrypted PKCS#1", encrypted, "PEM block 0: the private key is encrypted"},
+		{"encrypted PKCS#8", pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{0}}), "the private key is encrypted"},
+		{"ECDSA", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecDER}), "expected an RSA private key"},
+		{"certificate only", certPEM, "no private key found in 1 PEM block(s)"},
+	} {
+		_, err := ParsePEMEncodedPrivateKey(c.data)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected error containing %q, got: %v", c.name, c.want, err)
+		}
+	}
+}